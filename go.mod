@@ -34,6 +34,8 @@ require (
 	github.com/pelletier/go-buffruneio v0.3.0 // indirect
 	github.com/prometheus/alertmanager v0.20.0
 	github.com/prometheus/client_golang v1.2.1
+	github.com/prometheus/client_model v0.2.0
+	github.com/prometheus/common v0.7.0
 	github.com/russross/blackfriday/v2 v2.0.1
 	github.com/shogo82148/go-shuffle v0.0.0-20180218125048-27e6095f230d // indirect
 	github.com/spf13/cobra v1.0.0
@@ -43,6 +45,8 @@ require (
 	github.com/xeipuuv/gojsonschema v1.2.0
 	golang.org/x/tools v0.1.0
 	gonum.org/v1/netlib v0.0.0-20191031114514-eccb95939662 // indirect
+	google.golang.org/grpc v1.31.1
+	google.golang.org/protobuf v1.25.0
 	gopkg.in/neurosnap/sentences.v1 v1.0.6 // indirect
 	gopkg.in/russross/blackfriday.v2 v2.0.0 // indirect
 	gopkg.in/src-d/go-billy-siva.v4 v4.2.2 // indirect
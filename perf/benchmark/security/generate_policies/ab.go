@@ -0,0 +1,278 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ABResult compares the istiod revisions a corpus was applied to.
+type ABResult struct {
+	Revisions []RevisionResult `json:"revisions"`
+}
+
+// RevisionResult records how an istiod revision handled the corpus, from the first apply to the
+// end of the run.
+type RevisionResult struct {
+	Revision  string `json:"revision"`
+	Pod       string `json:"pod"`
+	Namespace string `json:"namespace"`
+	// Pushes is the number of xDS pushes to the proxies of the revision.
+	Pushes float64 `json:"pushes"`
+	// ConvergenceSeconds is the time from the first apply to the last push, once istiod pushed
+	// nothing for the quiet period.
+	ConvergenceSeconds float64 `json:"convergenceSeconds"`
+	Converged          bool    `json:"converged"`
+	// PushLatency is pilot_proxy_convergence_time, the time from a config change to its push to a
+	// proxy, in seconds.
+	PushLatency HistogramSummary `json:"pushLatency"`
+	// ConfigSize is pilot_xds_config_size_bytes, the size of the pushed xDS resources.
+	ConfigSize HistogramSummary `json:"configSize"`
+}
+
+// abRevision is an istiod revision being measured.
+type abRevision struct {
+	result  RevisionResult
+	metrics *istiodMetrics
+	before  metricFamilies
+	// pushes and lastPush track the pushes while waiting for the convergence.
+	pushes   float64
+	lastPush time.Time
+}
+
+// revisionSelector returns the label selector of the istiod pods of revision.
+func revisionSelector(revision string) string {
+	if revision == "" {
+		revision = "default"
+	}
+	return "app=istiod,istio.io/rev=" + revision
+}
+
+// copyCorpus returns the documents of the policies moved into namespace.
+func copyCorpus(policies []policyObject, namespace string) ([]string, error) {
+	docs := make([]string, len(policies))
+	for i, p := range policies {
+		p.Namespace = namespace
+		doc, err := policyObjectYAML(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", p, err)
+		}
+		docs[i] = doc
+	}
+	return docs, nil
+}
+
+// waitConvergence polls the pushes of the revisions until none of them pushed for quietPeriod,
+// or until the timeout.
+func waitConvergence(ctx context.Context, revisions []*abRevision, start time.Time, pollInterval, quietPeriod, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for _, r := range revisions {
+		r.pushes = r.before.counter("pilot_xds_pushes")
+		r.lastPush = start
+	}
+	for {
+		quiet := true
+		for _, r := range revisions {
+			families, err := r.metrics.scrape(ctx)
+			if err != nil {
+				return err
+			}
+			if pushes := families.counter("pilot_xds_pushes"); pushes != r.pushes {
+				r.pushes, r.lastPush = pushes, time.Now()
+			}
+			r.result.ConvergenceSeconds = r.lastPush.Sub(start).Seconds()
+			r.result.Converged = time.Since(r.lastPush) >= quietPeriod
+			quiet = quiet && r.result.Converged
+		}
+		if quiet || time.Now().After(deadline) {
+			return nil
+		}
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func printABResult(result *ABResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	row := func(name string, value func(RevisionResult) string) {
+		cells := []string{name}
+		for _, r := range result.Revisions {
+			cells = append(cells, value(r))
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t")+"\t")
+	}
+	row("revision", func(r RevisionResult) string { return r.Revision })
+	row("pushes", func(r RevisionResult) string { return fmt.Sprintf("%.0f", r.Pushes) })
+	row("convergence (s)", func(r RevisionResult) string {
+		if !r.Converged {
+			return fmt.Sprintf(">%.1f", r.ConvergenceSeconds)
+		}
+		return fmt.Sprintf("%.1f", r.ConvergenceSeconds)
+	})
+	row("push latency mean (s)", func(r RevisionResult) string { return fmt.Sprintf("%.3f", r.PushLatency.Mean) })
+	row("push latency p99 (s)", func(r RevisionResult) string { return fmt.Sprintf("%.3f", r.PushLatency.P99) })
+	row("config size mean (B)", func(r RevisionResult) string { return fmt.Sprintf("%.0f", r.ConfigSize.Mean) })
+	row("config size p99 (B)", func(r RevisionResult) string { return fmt.Sprintf("%.0f", r.ConfigSize.P99) })
+	_ = w.Flush()
+}
+
+func runAB(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("ab", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the generated policies")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	policyFile := fs.String("policyFile", "", "A YAML file of policies to apply instead of the generated ones")
+	revisionA := fs.String("revisionA", "default", "The first istiod revision")
+	revisionB := fs.String("revisionB", "", "The second istiod revision")
+	namespaceA := fs.String("namespaceA", "", "The namespace of the workloads of the first revision, the corpus is applied to it")
+	namespaceB := fs.String("namespaceB", "", "The namespace of the workloads of the second revision, the corpus is applied to it")
+	istioNamespace := fs.String("istioNamespace", "istio-system", "The namespace istiod runs in")
+	batchSize := fs.Int("batchSize", 100, "The number of policies of each copy applied per kubectl invocation")
+	pollInterval := fs.Duration("pollInterval", time.Second, "The interval between scrapes of the istiod metrics")
+	quietPeriod := fs.Duration("quietPeriod", 10*time.Second, "The time without pushes after which a revision has converged")
+	timeout := fs.Duration("timeout", 10*time.Minute, "The maximum time waited for the revisions to converge")
+	keep := fs.Bool("keep", false, "Keep the policies in the cluster at the end of the run")
+	outDir := fs.String("outDir", "run", "The directory the run report is written to")
+	_ = fs.Parse(args)
+
+	if *revisionB == "" || *namespaceA == "" || *namespaceB == "" {
+		return fmt.Errorf("-revisionB, -namespaceA and -namespaceB are required")
+	}
+	if *namespaceA == *namespaceB {
+		return fmt.Errorf("the revisions need their own namespace, got %s twice", *namespaceA)
+	}
+	if *batchSize <= 0 {
+		return fmt.Errorf("invalid batchSize: %d", *batchSize)
+	}
+	docs, err := loadPolicyDocuments(ctx, *scenarioName, *configFile, *policyFile)
+	if err != nil {
+		return err
+	}
+	policies, err := parsePolicyObjects(docs)
+	if err != nil {
+		return err
+	}
+	// Both istiods watch every namespace, each copy of the corpus is pushed to the proxies of one
+	// revision only.
+	docsA, err := copyCorpus(policies, *namespaceA)
+	if err != nil {
+		return err
+	}
+	docsB, err := copyCorpus(policies, *namespaceB)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+
+	var revisions []*abRevision
+	for _, side := range []struct{ revision, namespace string }{{*revisionA, *namespaceA}, {*revisionB, *namespaceB}} {
+		m, err := newIstiodMetrics(ctx, *istioNamespace, revisionSelector(side.revision))
+		if err != nil {
+			return fmt.Errorf("revision %s: %v", side.revision, err)
+		}
+		defer m.close()
+		before, err := m.scrape(ctx)
+		if err != nil {
+			return err
+		}
+		revisions = append(revisions, &abRevision{
+			result:  RevisionResult{Revision: side.revision, Pod: m.pod, Namespace: side.namespace},
+			metrics: m,
+			before:  before,
+		})
+	}
+
+	report := newRunReport("ab", *configFile, fs)
+	if !*keep {
+		defer func() {
+			// Delete the policies even when interrupted, so that the cluster is left clean.
+			all := strings.Join(append(docsA, docsB...), "---\n")
+			_, cleanupSpan := startSpan(ctx, "cleanup")
+			_, err := kubectl(context.Background(), strings.NewReader(all), "delete", "--ignore-not-found", "-f", "-")
+			cleanupSpan.end(err)
+			if err != nil {
+				log.Printf("failed to delete the policies: %v", err)
+			}
+		}()
+	}
+
+	// The copies are applied batch by batch together, so that both revisions receive the same
+	// config changes at the same time.
+	applyCtx, applySpan := startSpan(ctx, "apply")
+	for start := 0; start < len(docsA) && ctx.Err() == nil; start += *batchSize {
+		end := start + *batchSize
+		if end > len(docsA) {
+			end = len(docsA)
+		}
+		batch := append(append([]string{}, docsA[start:end]...), docsB[start:end]...)
+		if err := inSpan(applyCtx, "batch", func(ctx context.Context) error { return kubectlApply(ctx, batch) }); err != nil {
+			if ctx.Err() == nil {
+				report.Errors = append(report.Errors, err.Error())
+			}
+			break
+		}
+		report.PoliciesApplied = 2 * end
+	}
+	applySpan.setAttribute("policiesApplied", report.PoliciesApplied)
+	applySpan.end(nil)
+	if len(report.Errors) == 0 && ctx.Err() == nil {
+		err := inSpan(ctx, "wait", func(ctx context.Context) error {
+			return waitConvergence(ctx, revisions, report.StartTime, *pollInterval, *quietPeriod, *timeout)
+		})
+		if err != nil && ctx.Err() == nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+
+	report.AB = &ABResult{}
+	for _, r := range revisions {
+		after, err := r.metrics.scrape(context.Background())
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+		r.result.Pushes = after.counter("pilot_xds_pushes") - r.before.counter("pilot_xds_pushes")
+		r.result.PushLatency = after.histogram("pilot_proxy_convergence_time").sub(r.before.histogram("pilot_proxy_convergence_time")).summary()
+		r.result.ConfigSize = after.histogram("pilot_xds_config_size_bytes").sub(r.before.histogram("pilot_xds_config_size_bytes")).summary()
+		report.AB.Revisions = append(report.AB.Revisions, r.result)
+	}
+
+	if ctx.Err() != nil {
+		report.Interrupted = true
+		err = fmt.Errorf("interrupted after applying %d of %d policies, see %s", report.PoliciesApplied, len(docsA)+len(docsB),
+			filepath.Join(*outDir, "report.json"))
+		report.Errors = append(report.Errors, err.Error())
+	} else if len(report.Errors) > 0 {
+		err = fmt.Errorf("%s", report.Errors[0])
+	}
+	report.EndTime = time.Now()
+	if writeErr := writeRunReport(*outDir, report); writeErr != nil {
+		return writeErr
+	}
+	printABResult(report.AB)
+	return err
+}
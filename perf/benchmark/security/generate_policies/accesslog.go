@@ -0,0 +1,307 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// observedRequest is a request of an access log, allowed by the current policies.
+type observedRequest struct {
+	// principal is the peer principal of the source, empty for plaintext requests.
+	principal string
+	// service and namespace are the destination of the request, from its authority.
+	service, namespace string
+	method, path       string
+}
+
+// accessLogSkips counts the lines of access logs which do not make an observed request.
+type accessLogSkips struct {
+	invalid, denied, noHTTP, noService int
+}
+
+func (s accessLogSkips) String() string {
+	return fmt.Sprintf("%d invalid, %d denied, %d without a method or path, %d without a service host",
+		s.invalid, s.denied, s.noHTTP, s.noService)
+}
+
+// logField returns the string of the field key of an access log entry, empty when it is unset or
+// "-", the value of Envoy for the operators without a value.
+func logField(entry map[string]interface{}, key string) string {
+	v, ok := entry[key]
+	if !ok || v == nil {
+		return ""
+	}
+	s := fmt.Sprint(v)
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+// parseAccessLogs returns the requests of r, Envoy access logs in the JSON format, one entry per
+// line. The source principal is the downstream_peer_uri_san field, set by %DOWNSTREAM_PEER_URI_SAN%,
+// or else source_principal. defaultNamespace is the namespace of the services of short hosts.
+func parseAccessLogs(r io.Reader, defaultNamespace string) ([]observedRequest, accessLogSkips, error) {
+	var requests []observedRequest
+	var skips accessLogSkips
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			skips.invalid++
+			continue
+		}
+		if logField(entry, "response_code") == "403" ||
+			strings.HasPrefix(logField(entry, "response_code_details"), "rbac_access_denied") {
+			skips.denied++
+			continue
+		}
+		method, path := logField(entry, "method"), logField(entry, "path")
+		if method == "" || path == "" {
+			skips.noHTTP++
+			continue
+		}
+		if i := strings.IndexAny(path, "?#"); i >= 0 {
+			path = path[:i]
+		}
+		service, namespace := serviceOfHost(logField(entry, "authority"), defaultNamespace)
+		if service == "" {
+			skips.noService++
+			continue
+		}
+		principal := logField(entry, "downstream_peer_uri_san")
+		if principal == "" {
+			principal = logField(entry, "source_principal")
+		}
+		requests = append(requests, observedRequest{
+			principal: strings.TrimPrefix(principal, "spiffe://"),
+			service:   service,
+			namespace: namespace,
+			method:    method,
+			path:      path,
+		})
+	}
+	return requests, skips, scanner.Err()
+}
+
+// serviceOfHost returns the service and namespace of a host such as web, web.prod or
+// web.prod.svc.cluster.local, with an optional port. IP addresses have no service.
+func serviceOfHost(host, defaultNamespace string) (service, namespace string) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "" || net.ParseIP(host) != nil {
+		return "", ""
+	}
+	labels := strings.Split(host, ".")
+	if len(labels) == 1 {
+		return labels[0], defaultNamespace
+	}
+	return labels[0], labels[1]
+}
+
+// collapsePaths replaces the paths sharing a parent by the prefix match of the parent when they
+// are more than limit, e.g. /users/1, /users/2 and /users/3 by /users/* for a limit of 2. A
+// limit of 0 keeps every path.
+func collapsePaths(paths map[string]bool, limit int) map[string]bool {
+	if limit <= 0 {
+		return paths
+	}
+	children := map[string]int{}
+	for path := range paths {
+		if i := strings.LastIndex(path, "/"); i > 0 {
+			children[path[:i]]++
+		}
+	}
+	collapsed := map[string]bool{}
+	for path := range paths {
+		if i := strings.LastIndex(path, "/"); i > 0 && children[path[:i]] > limit {
+			collapsed[path[:i]+"/*"] = true
+		} else {
+			collapsed[path] = true
+		}
+	}
+	return collapsed
+}
+
+func sortedSet(set map[string]bool) []string {
+	values := make([]string, 0, len(set))
+	for v := range set {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// synthesizePolicies returns the least privilege ALLOW policies of the observed requests: a policy
+// per destination service, selecting its workloads by appLabel, with a rule per source principal.
+// The paths of a source called with the same methods share an operation, so that a rule allows the
+// observed method and path pairs only, and no combination of the methods of a path with another.
+func synthesizePolicies(requests []observedRequest, appLabel string, collapseLimit int) []policyObject {
+	type destination struct{ namespace, service string }
+	// observed maps a destination and a source principal to the methods of each path.
+	observed := map[destination]map[string]map[string]map[string]bool{}
+	for _, r := range requests {
+		d := destination{r.namespace, r.service}
+		if observed[d] == nil {
+			observed[d] = map[string]map[string]map[string]bool{}
+		}
+		if observed[d][r.principal] == nil {
+			observed[d][r.principal] = map[string]map[string]bool{}
+		}
+		if observed[d][r.principal][r.path] == nil {
+			observed[d][r.principal][r.path] = map[string]bool{}
+		}
+		observed[d][r.principal][r.path][r.method] = true
+	}
+
+	var policies []policyObject
+	for d, sources := range observed {
+		principals := make([]string, 0, len(sources))
+		for principal := range sources {
+			principals = append(principals, principal)
+		}
+		sort.Strings(principals)
+		var rules []interface{}
+		for _, principal := range principals {
+			// Collapse the paths of every method before grouping them by their methods.
+			byMethod := map[string]map[string]bool{}
+			for path, methods := range sources[principal] {
+				for method := range methods {
+					if byMethod[method] == nil {
+						byMethod[method] = map[string]bool{}
+					}
+					byMethod[method][path] = true
+				}
+			}
+			methodsOfPath := map[string]map[string]bool{}
+			for method, paths := range byMethod {
+				for path := range collapsePaths(paths, collapseLimit) {
+					if methodsOfPath[path] == nil {
+						methodsOfPath[path] = map[string]bool{}
+					}
+					methodsOfPath[path][method] = true
+				}
+			}
+			pathsOfMethods := map[string][]string{}
+			for path, methods := range methodsOfPath {
+				key := strings.Join(sortedSet(methods), ",")
+				pathsOfMethods[key] = append(pathsOfMethods[key], path)
+			}
+			var operations []interface{}
+			for _, methods := range sortedKeysOf(pathsOfMethods) {
+				sort.Strings(pathsOfMethods[methods])
+				operations = append(operations, map[string]interface{}{
+					"operation": map[string]interface{}{
+						"methods": strings.Split(methods, ","),
+						"paths":   pathsOfMethods[methods],
+					},
+				})
+			}
+			rule := map[string]interface{}{"to": operations}
+			if principal != "" {
+				rule["from"] = []interface{}{map[string]interface{}{
+					"source": map[string]interface{}{"principals": []string{principal}},
+				}}
+			}
+			rules = append(rules, rule)
+		}
+		policies = append(policies, policyObject{
+			APIVersion: "security.istio.io/v1beta1",
+			Kind:       "AuthorizationPolicy",
+			Namespace:  d.namespace,
+			Name:       "observed-" + d.service,
+			Spec: map[string]interface{}{
+				"selector": map[string]interface{}{"matchLabels": map[string]interface{}{appLabel: d.service}},
+				"action":   "ALLOW",
+				"rules":    rules,
+			},
+		})
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].String() < policies[j].String() })
+	return policies
+}
+
+func sortedKeysOf(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func runSynthesize(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("synthesize", flag.ExitOnError)
+	accessLogs := fs.String("accessLogs", "-", "Comma separated files of Envoy access logs in the JSON format, - for the standard input")
+	namespace := fs.String("namespace", generatepolicies.DefaultNamespace, "The namespace of the services of hosts without a namespace")
+	appLabel := fs.String("appLabel", "app", "The label selecting the workloads of a service, set to the service name")
+	collapse := fs.Int("collapsePaths", 0, "Replace the paths of a parent called by a source with the same method by a prefix match when they are more than this number, 0 keeps every path")
+	_ = fs.Parse(args)
+
+	var requests []observedRequest
+	var skips accessLogSkips
+	for _, file := range strings.Split(*accessLogs, ",") {
+		r := io.Reader(os.Stdin)
+		if file != "-" {
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		observed, skipped, err := parseAccessLogs(r, *namespace)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		requests = append(requests, observed...)
+		skips.invalid += skipped.invalid
+		skips.denied += skipped.denied
+		skips.noHTTP += skipped.noHTTP
+		skips.noService += skipped.noService
+	}
+	if len(requests) == 0 {
+		return fmt.Errorf("no allowed HTTP request in the access logs, skipped %v", skips)
+	}
+
+	policies := synthesizePolicies(requests, *appLabel, *collapse)
+	for _, p := range policies {
+		doc, err := policyObjectYAML(p)
+		if err != nil {
+			return fmt.Errorf("%s: %v", p, err)
+		}
+		fmt.Println(doc + "---")
+	}
+	fmt.Fprintf(os.Stderr, "synthesized %d policies from %d requests, skipped %v\n", len(policies), len(requests), skips)
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSynthesizePolicies(t *testing.T) {
+	logs := `{"method":"GET","path":"/users/1?page=2","authority":"web.prod.svc.cluster.local:8080","response_code":200,"downstream_peer_uri_san":"spiffe://cluster.local/ns/prod/sa/api"}
+{"method":"GET","path":"/users/2","authority":"web.prod:8080","response_code":200,"downstream_peer_uri_san":"spiffe://cluster.local/ns/prod/sa/api"}
+{"method":"GET","path":"/users/3","authority":"web.prod","response_code":"200","downstream_peer_uri_san":"spiffe://cluster.local/ns/prod/sa/api"}
+{"method":"POST","path":"/orders","authority":"web.prod","response_code":201,"downstream_peer_uri_san":"spiffe://cluster.local/ns/prod/sa/api"}
+{"method":"GET","path":"/orders","authority":"web.prod","response_code":200,"source_principal":"cluster.local/ns/prod/sa/admin"}
+{"method":"DELETE","path":"/admin","authority":"web.prod","response_code":403,"response_code_details":"rbac_access_denied_matched_policy[none]"}
+{"method":"GET","path":"/healthz","authority":"10.0.0.1:8080","response_code":200}
+{"bytes_received":10,"upstream_cluster":"inbound|9000||"}
+[2021-01-07T00:00:00.000Z] "GET / HTTP/1.1" 200
+{"method":"GET","path":"/","authority":"fortioserver:8080","response_code":200,"downstream_peer_uri_san":"-"}
+`
+	requests, skips, err := parseAccessLogs(strings.NewReader(logs), "twopods-istio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (accessLogSkips{invalid: 1, denied: 1, noHTTP: 1, noService: 1}); skips != want {
+		t.Errorf("got skips %v, want %v", skips, want)
+	}
+	if len(requests) != 6 {
+		t.Fatalf("got %d requests, want 6", len(requests))
+	}
+
+	policies := synthesizePolicies(requests, "app", 2)
+	if len(policies) != 2 || policies[0].String() != "AuthorizationPolicy prod/observed-web" ||
+		policies[1].String() != "AuthorizationPolicy twopods-istio/observed-fortioserver" {
+		t.Fatalf("got policies %v", policies)
+	}
+	rules := policies[0].Spec["rules"].([]interface{})
+	if len(rules) != 2 {
+		t.Fatalf("got %d rules, want a rule per principal", len(rules))
+	}
+	// The GET of /users/* and the POST of /orders are separate operations, not allowing POST /users/*.
+	want := []interface{}{
+		map[string]interface{}{"operation": map[string]interface{}{"methods": []string{"GET"}, "paths": []string{"/users/*"}}},
+		map[string]interface{}{"operation": map[string]interface{}{"methods": []string{"POST"}, "paths": []string{"/orders"}}},
+	}
+	if got := rules[1].(map[string]interface{})["to"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got operations %v, want %v", got, want)
+	}
+	if _, ok := policies[1].Spec["rules"].([]interface{})[0].(map[string]interface{})["from"]; ok {
+		t.Errorf("the rule of plaintext requests has a source")
+	}
+
+	rules = synthesizePolicies(requests, "app", 0)[0].Spec["rules"].([]interface{})
+	operation := rules[1].(map[string]interface{})["to"].([]interface{})[0].(map[string]interface{})["operation"]
+	if paths := operation.(map[string]interface{})["paths"]; !reflect.DeepEqual(paths, []string{"/users/1", "/users/2", "/users/3"}) {
+		t.Errorf("got uncollapsed paths %v", paths)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// alertThresholds are the values the alerts of a scenario fire above.
+type alertThresholds struct {
+	// PushSeconds is the p99 of pilot_xds_push_time, the time istiod takes to push a proxy.
+	PushSeconds float64
+	// ConvergenceSeconds is the p99 of pilot_proxy_convergence_time, the time from a config
+	// change to its push to a proxy.
+	ConvergenceSeconds float64
+	ProxyMemoryBytes   float64
+	// DenyRate is the share of the requests to the policy namespaces answered with a 403.
+	DenyRate float64
+}
+
+// baselineThresholds returns thresholds with the convergence time of a baseline run of the
+// scenario, the highest p99 of pilot_proxy_convergence_time of its batches and soak snapshots,
+// multiplied by tolerance. The other thresholds are unchanged, the run reports do not record them.
+func baselineThresholds(t alertThresholds, baseline *RunReport, tolerance float64) (alertThresholds, error) {
+	max := 0.0
+	if baseline.Convergence != nil {
+		for _, b := range baseline.Convergence.Batches {
+			if b.PushLatency.P99 > max {
+				max = b.PushLatency.P99
+			}
+		}
+	}
+	if baseline.Soak != nil {
+		for _, s := range baseline.Soak.Snapshots {
+			if s.PushLatency.P99 > max {
+				max = s.PushLatency.P99
+			}
+		}
+	}
+	if max == 0 {
+		return t, fmt.Errorf("the baseline has no push latency, run apply with -convergence or soak")
+	}
+	t.ConvergenceSeconds = max * tolerance
+	return t, nil
+}
+
+// prometheusRule returns a PrometheusRule of the Prometheus operator with the alerts of a policy
+// scale soak test of the policies of namespaces.
+func prometheusRule(name, namespace string, labels map[string]string, namespaces []string, t alertThresholds, forDuration time.Duration) ([]byte, error) {
+	selector := fmt.Sprintf(`namespace=~"%s"`, strings.Join(namespaces, "|"))
+	destination := fmt.Sprintf(`reporter="destination",destination_workload_namespace=~"%s"`, strings.Join(namespaces, "|"))
+	alert := func(name, expr, summary string) map[string]interface{} {
+		return map[string]interface{}{
+			"alert":       name,
+			"expr":        expr,
+			"for":         forDuration.String(),
+			"labels":      map[string]string{"severity": "page"},
+			"annotations": map[string]string{"summary": summary},
+		}
+	}
+	rules := []interface{}{
+		alert("SecurityPolicyPushLatencyHigh",
+			fmt.Sprintf(`histogram_quantile(0.99, sum(rate(pilot_xds_push_time_bucket[5m])) by (le)) > %g`, t.PushSeconds),
+			fmt.Sprintf("The p99 of the pushes of istiod is above %gs.", t.PushSeconds)),
+		alert("SecurityPolicyConvergenceSlow",
+			fmt.Sprintf(`histogram_quantile(0.99, sum(rate(pilot_proxy_convergence_time_bucket[5m])) by (le)) > %g`, t.ConvergenceSeconds),
+			fmt.Sprintf("The p99 of the time from a config change to its push to the proxies is above %gs.", t.ConvergenceSeconds)),
+		alert("SecurityPolicyProxyMemoryHigh",
+			fmt.Sprintf(`max(container_memory_working_set_bytes{container="istio-proxy",%s}) by (namespace, pod) > %.0f`, selector, t.ProxyMemoryBytes),
+			fmt.Sprintf("The istio-proxy of {{ $labels.namespace }}/{{ $labels.pod }} uses more than %.0fMiB.", t.ProxyMemoryBytes/1024/1024)),
+		alert("SecurityPolicyUnexpectedDenials",
+			fmt.Sprintf(`sum(rate(istio_requests_total{%s,response_code="403"}[5m])) / sum(rate(istio_requests_total{%s}[5m])) > %g`, destination, destination, t.DenyRate),
+			fmt.Sprintf("More than %g of the requests to the policy namespaces are denied.", t.DenyRate)),
+		alert("SecurityPolicySoakProbeMismatch",
+			`increase(security_soak_probes_total{matched="false"}[15m]) > 0`,
+			"Enforcement probes of the soak run were not decided as expected."),
+	}
+	return yaml.Marshal(map[string]interface{}{
+		"apiVersion": "monitoring.coreos.com/v1",
+		"kind":       "PrometheusRule",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace, "labels": labels},
+		"spec": map[string]interface{}{
+			"groups": []interface{}{map[string]interface{}{"name": name, "rules": rules}},
+		},
+	})
+}
+
+func runAlerts(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("alerts", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the soaked policies")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	policyFile := fs.String("policyFile", "", "A yaml file of the soaked policies, instead of generating them")
+	baselineFile := fs.String("baseline", "", "The report.json of a baseline run of the scenario, apply with -convergence or soak, the convergence threshold is derived from")
+	tolerance := fs.Float64("tolerance", 1.5, "The factor the values of the baseline are multiplied by")
+	pushSeconds := fs.Float64("pushSeconds", 1, "The p99 of the push time of istiod to alert above, in seconds")
+	convergenceSeconds := fs.Float64("convergenceSeconds", 10, "The p99 of the convergence time of the proxies to alert above, in seconds, unless -baseline is set")
+	proxyMemoryMiB := fs.Float64("proxyMemoryMiB", 256, "The working set of an istio-proxy of the policy namespaces to alert above, in MiB")
+	denyRate := fs.Float64("denyRate", 0, "The share of the requests to the policy namespaces expected to be denied, between 0 and 1")
+	denyRateTolerance := fs.Float64("denyRateTolerance", 0.05, "The share of requests denied above -denyRate to alert above")
+	forDuration := fs.Duration("for", 10*time.Minute, "The time a threshold must be exceeded before the alert fires")
+	name := fs.String("name", "security-policy-soak", "The name of the PrometheusRule")
+	namespace := fs.String("namespace", "istio-system", "The namespace of the PrometheusRule")
+	labels := fs.String("labels", "", "Comma separated key=value labels of the PrometheusRule, matched by the ruleSelector of the Prometheus")
+	_ = fs.Parse(args)
+
+	if err := validateDenyRate(*denyRate); err != nil {
+		return err
+	}
+	ruleLabels, err := parseLabels(*labels)
+	if err != nil {
+		return err
+	}
+	docs, err := loadPolicyDocuments(ctx, *scenarioName, *configFile, *policyFile)
+	if err != nil {
+		return err
+	}
+	namespaces, err := docNamespaces(docs)
+	if err != nil {
+		return err
+	}
+	if len(namespaces) == 0 {
+		return fmt.Errorf("the policies have no namespace")
+	}
+	t := alertThresholds{
+		PushSeconds:        *pushSeconds,
+		ConvergenceSeconds: *convergenceSeconds,
+		ProxyMemoryBytes:   *proxyMemoryMiB * 1024 * 1024,
+		DenyRate:           *denyRate + *denyRateTolerance,
+	}
+	if *baselineFile != "" {
+		baseline, err := readRunReport(*baselineFile)
+		if err != nil {
+			return err
+		}
+		if t, err = baselineThresholds(t, baseline, *tolerance); err != nil {
+			return fmt.Errorf("%s: %v", *baselineFile, err)
+		}
+	}
+	out, err := prometheusRule(*name, *namespace, ruleLabels, namespaces, t, *forDuration)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(out))
+	return nil
+}
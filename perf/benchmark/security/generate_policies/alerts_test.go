@@ -0,0 +1,85 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestBaselineThresholds(t *testing.T) {
+	baseline := &RunReport{
+		Convergence: &ConvergenceResult{Batches: []BatchConvergence{
+			{PushLatency: HistogramSummary{P99: 2}},
+			{PushLatency: HistogramSummary{P99: 4}},
+		}},
+		Soak: &SoakResult{Snapshots: []SoakSnapshot{{PushLatency: HistogramSummary{P99: 3}}}},
+	}
+	got, err := baselineThresholds(alertThresholds{PushSeconds: 1, ConvergenceSeconds: 10}, baseline, 1.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ConvergenceSeconds != 6 || got.PushSeconds != 1 {
+		t.Errorf("got %+v, want a convergence of 6s and an unchanged push of 1s", got)
+	}
+	if _, err := baselineThresholds(got, &RunReport{}, 1.5); err == nil {
+		t.Error("expected an error for a baseline without push latency")
+	}
+}
+
+func TestPrometheusRule(t *testing.T) {
+	thresholds := alertThresholds{PushSeconds: 1, ConvergenceSeconds: 6, ProxyMemoryBytes: 256 * 1024 * 1024, DenyRate: 0.25}
+	out, err := prometheusRule("soak", "istio-system", map[string]string{"release": "prometheus"}, []string{"ns-1", "ns-2"}, thresholds, 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rule struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			Groups []struct {
+				Rules []struct {
+					Alert string `json:"alert"`
+					Expr  string `json:"expr"`
+					For   string `json:"for"`
+				} `json:"rules"`
+			} `json:"groups"`
+		} `json:"spec"`
+	}
+	if err := yaml.Unmarshal(out, &rule); err != nil {
+		t.Fatal(err)
+	}
+	if rule.Kind != "PrometheusRule" || len(rule.Spec.Groups) != 1 {
+		t.Fatalf("got %s", out)
+	}
+	exprs := map[string]string{}
+	for _, r := range rule.Spec.Groups[0].Rules {
+		exprs[r.Alert] = r.Expr
+		if r.For != "10m0s" {
+			t.Errorf("%s: got for %s, want 10m0s", r.Alert, r.For)
+		}
+	}
+	for alert, want := range map[string]string{
+		"SecurityPolicyConvergenceSlow":   "pilot_proxy_convergence_time_bucket[5m])) by (le)) > 6",
+		"SecurityPolicyProxyMemoryHigh":   `namespace=~"ns-1|ns-2"}) by (namespace, pod) > 268435456`,
+		"SecurityPolicyUnexpectedDenials": "> 0.25",
+	} {
+		if !strings.Contains(exprs[alert], want) {
+			t.Errorf("%s: got %q, want it to contain %q", alert, exprs[alert], want)
+		}
+	}
+}
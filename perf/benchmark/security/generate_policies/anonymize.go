@@ -0,0 +1,300 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// keptNames are the namespaces and trust domains with a meaning to Istio, which are not
+// anonymized.
+var keptNames = map[string]bool{
+	"cluster.local": true,
+	"default":       true,
+	"istio-system":  true,
+	"kube-system":   true,
+}
+
+// anonymizer replaces the names of a policy set with placeholders. A name is always replaced
+// with the same placeholder, so the policies keep referencing the same namespaces, principals
+// and hosts as each other.
+type anonymizer struct {
+	// placeholders maps the category of a name, such as ns or host, to the placeholders of the
+	// names of the category.
+	placeholders map[string]map[string]string
+}
+
+func newAnonymizer() *anonymizer {
+	return &anonymizer{placeholders: make(map[string]map[string]string)}
+}
+
+// name returns the placeholder <category>-<n> of the name s.
+func (a *anonymizer) name(category, s string) string {
+	if s == "" || keptNames[s] {
+		return s
+	}
+	names, ok := a.placeholders[category]
+	if !ok {
+		names = make(map[string]string)
+		a.placeholders[category] = names
+	}
+	if placeholder, ok := names[s]; ok {
+		return placeholder
+	}
+	placeholder := fmt.Sprintf("%s-%d", category, len(names)+1)
+	names[s] = placeholder
+	return placeholder
+}
+
+// token returns the placeholder of s keeping its prefix or suffix wildcard.
+func (a *anonymizer) token(category, s string) string {
+	switch {
+	case s == "*":
+		return s
+	case strings.HasPrefix(s, "*"):
+		return "*" + a.name(category, s[1:])
+	case strings.HasSuffix(s, "*"):
+		return a.name(category, s[:len(s)-1]) + "*"
+	}
+	return a.name(category, s)
+}
+
+// segments returns s with each of its parts separated by sep replaced with a placeholder, so that
+// paths and hosts keep their depth and their wildcards.
+func (a *anonymizer) segments(category, s, sep string) string {
+	parts := strings.Split(s, sep)
+	for i, part := range parts {
+		parts[i] = a.token(category, part)
+	}
+	return strings.Join(parts, sep)
+}
+
+func (a *anonymizer) path(s string) string {
+	return a.segments("seg", s, "/")
+}
+
+// host keeps the port of s and the wildcard label of a suffix match.
+func (a *anonymizer) host(s string) string {
+	port := ""
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		s, port = s[:i], s[i:]
+	}
+	return a.segments("host", s, ".") + port
+}
+
+// principal keeps the <trust domain>/ns/<namespace>/sa/<service account> form of s, its namespace
+// replaced with the same placeholder as in metadata.namespace and namespaces.
+func (a *anonymizer) principal(s string) string {
+	parts := strings.Split(s, "/")
+	for i, part := range parts {
+		switch {
+		case i == 0:
+			parts[i] = a.token("td", part)
+		case (part == "ns" || part == "sa") && i%2 == 1:
+		case i > 0 && parts[i-1] == "ns":
+			parts[i] = a.token("ns", part)
+		case i > 0 && parts[i-1] == "sa":
+			parts[i] = a.token("sa", part)
+		default:
+			parts[i] = a.token("seg", part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// url keeps the scheme of s, replacing its host and path segments.
+func (a *anonymizer) url(s string) string {
+	scheme := ""
+	if i := strings.Index(s, "://"); i >= 0 {
+		scheme, s = s[:i+3], s[i+3:]
+	}
+	host, path := s, ""
+	if i := strings.Index(s, "/"); i >= 0 {
+		host, path = s[:i], s[i:]
+	}
+	return scheme + a.host(host) + a.path(path)
+}
+
+// requestPrincipal replaces the issuer and the subject of the <iss>/<sub> s.
+func (a *anonymizer) requestPrincipal(s string) string {
+	i := strings.LastIndex(s, "/")
+	if i < 0 {
+		return a.token("sub", s)
+	}
+	issuer, subject := s[:i], s[i+1:]
+	if issuer != "*" {
+		issuer = a.url(issuer)
+	}
+	return issuer + "/" + a.token("sub", subject)
+}
+
+// field returns the anonymizer of the string values of the spec field, nil for the fields kept.
+func (a *anonymizer) field(field string) func(string) string {
+	switch field {
+	case "principals", "notPrincipals":
+		return a.principal
+	case "requestPrincipals", "notRequestPrincipals":
+		return a.requestPrincipal
+	case "namespaces", "notNamespaces":
+		return func(s string) string { return a.token("ns", s) }
+	case "paths", "notPaths":
+		return a.path
+	case "hosts", "notHosts":
+		return a.host
+	case "audiences":
+		return func(s string) string { return a.token("aud", s) }
+	case "issuer", "jwksUri":
+		return a.url
+	}
+	return nil
+}
+
+// condition returns the anonymizer of the values of a condition on key, nil for the keys
+// matching IP addresses and ports.
+func (a *anonymizer) condition(key string) func(string) string {
+	switch {
+	case strings.HasPrefix(key, "request.auth.claims["):
+		return func(s string) string { return a.token("claim", s) }
+	case key == "request.auth.principal":
+		return a.requestPrincipal
+	case key == "request.auth.audiences":
+		return func(s string) string { return a.token("aud", s) }
+	case key == "request.auth.presenter":
+		return func(s string) string { return a.token("presenter", s) }
+	case key == "source.principal":
+		return a.principal
+	case key == "source.namespace":
+		return func(s string) string { return a.token("ns", s) }
+	case key == "connection.sni":
+		return a.host
+	case strings.HasPrefix(key, "request.headers["):
+		return func(s string) string { return a.token("value", s) }
+	}
+	return nil
+}
+
+// policy returns the anonymized copy of p.
+func (a *anonymizer) policy(p policyObject) policyObject {
+	spec, _ := a.value(p.Spec, nil).(map[string]interface{})
+	if spec == nil {
+		spec = map[string]interface{}{}
+	}
+	return policyObject{
+		APIVersion: p.APIVersion,
+		Kind:       p.Kind,
+		Namespace:  a.token("ns", p.Namespace),
+		Name:       a.name(strings.ToLower(p.Kind), p.Name),
+		Spec:       spec,
+	}
+}
+
+// value returns a copy of v with its strings replaced by anonymize. The keys of the maps are
+// walked in order, so that the same policy set always gets the same placeholders.
+func (a *anonymizer) value(v interface{}, anonymize func(string) string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		conditionKey, _ := v["key"].(string)
+		anonymized := make(map[string]interface{}, len(v))
+		for _, key := range keys {
+			var child func(string) string
+			switch key {
+			case "matchLabels":
+				anonymized[key] = a.labels(v[key])
+				continue
+			case "values", "notValues":
+				child = a.condition(conditionKey)
+			default:
+				child = a.field(key)
+			}
+			anonymized[key] = a.value(v[key], child)
+		}
+		return anonymized
+	case []interface{}:
+		anonymized := make([]interface{}, len(v))
+		for i, item := range v {
+			anonymized[i] = a.value(item, anonymize)
+		}
+		return anonymized
+	case string:
+		if anonymize != nil {
+			return anonymize(v)
+		}
+	}
+	return v
+}
+
+// labels replaces the values of the labels of a selector, keeping their keys.
+func (a *anonymizer) labels(v interface{}) interface{} {
+	labels, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	anonymized := make(map[string]interface{}, len(labels))
+	for _, key := range keys {
+		if value, ok := labels[key].(string); ok {
+			anonymized[key] = a.token("label", value)
+		} else {
+			anonymized[key] = labels[key]
+		}
+	}
+	return anonymized
+}
+
+func runAnonymize(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("anonymize", flag.ExitOnError)
+	policyFile := fs.String("policyFile", "", "A YAML file or a directory of YAML files of policies to anonymize instead of the policies of the cluster")
+	mappingFile := fs.String("mappingFile", "", "A file the placeholders of every name are written to, which must not be shared with the corpus")
+	_ = fs.Parse(args)
+
+	policies, err := importPolicies(ctx, *policyFile)
+	if err != nil {
+		return err
+	}
+	a := newAnonymizer()
+	for _, p := range policies {
+		doc, err := policyObjectYAML(a.policy(p))
+		if err != nil {
+			return fmt.Errorf("%s: %v", p, err)
+		}
+		fmt.Println(doc + "---")
+	}
+
+	if *mappingFile != "" {
+		mapping, err := json.MarshalIndent(a.placeholders, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(*mappingFile, mapping, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestAnonymize(t *testing.T) {
+	policies, err := parsePolicyObjects([]string{`
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: billing-allow
+  namespace: billing
+spec:
+  selector:
+    matchLabels:
+      app: invoices
+  rules:
+  - from:
+    - source:
+        principals: ["corp.example/ns/billing/sa/invoices", "corp.example/ns/billing/*"]
+        namespaces: ["billing", "istio-system"]
+        ipBlocks: ["10.4.0.0/16"]
+    to:
+    - operation:
+        hosts: ["*.billing.corp.example:8443"]
+        paths: ["/invoices/*", "/billing"]
+        methods: ["GET"]
+    when:
+    - key: request.auth.claims[team]
+      values: ["payments"]
+    - key: destination.port
+      values: ["8443"]
+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := policyObjectYAML(newAnonymizer().policy(policies[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: authorizationpolicy-1
+  namespace: ns-1
+spec:
+  rules:
+  - from:
+    - source:
+        ipBlocks:
+        - 10.4.0.0/16
+        namespaces:
+        - ns-1
+        - istio-system
+        principals:
+        - td-1/ns/ns-1/sa/sa-1
+        - td-1/ns/ns-1/*
+    to:
+    - operation:
+        hosts:
+        - '*.host-1.host-2.host-3:8443'
+        methods:
+        - GET
+        paths:
+        - /seg-1/*
+        - /seg-2
+    when:
+    - key: request.auth.claims[team]
+      values:
+      - claim-1
+    - key: destination.port
+      values:
+      - "8443"
+  selector:
+    matchLabels:
+      app: label-1
+`
+	if doc != want {
+		t.Errorf("got\n%s\nwant\n%s", doc, want)
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+	"sigs.k8s.io/yaml"
+)
+
+// APIServerResult is the load of an apply on the Kubernetes control plane, from the metrics of the
+// API server scraped before and after it.
+type APIServerResult struct {
+	DurationSeconds float64 `json:"durationSeconds"`
+	// Requests and RequestsPerSecond are the requests served by the API server during the apply,
+	// on every resource.
+	Requests          float64 `json:"requests"`
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	// CorpusRequests are the requests on the resources of the corpus, by verb.
+	CorpusRequests map[string]float64 `json:"corpusRequests,omitempty"`
+	// Throttled are the requests answered with a 429.
+	Throttled float64 `json:"throttled"`
+	// Objects are the objects stored in etcd of the resources of the corpus.
+	Objects []ResourceObjects `json:"objects,omitempty"`
+	// DBSizeBytesBefore and DBSizeBytesAfter are the size of the etcd database, the largest of its
+	// endpoints. Compactions during the apply shrink it.
+	DBSizeBytesBefore float64 `json:"dbSizeBytesBefore"`
+	DBSizeBytesAfter  float64 `json:"dbSizeBytesAfter"`
+	// DBGrowthBytesPerPolicy is the growth of the etcd database divided by the policies applied.
+	DBGrowthBytesPerPolicy float64 `json:"dbGrowthBytesPerPolicy"`
+}
+
+// ResourceObjects is the number of objects of a resource stored in etcd.
+type ResourceObjects struct {
+	// Resource is <plural>.<group>, or <plural> for the core group.
+	Resource string  `json:"resource"`
+	Before   float64 `json:"before"`
+	After    float64 `json:"after"`
+}
+
+// apiServerScrape is a scrape of the API server metrics.
+type apiServerScrape struct {
+	time     time.Time
+	families metricFamilies
+}
+
+// scrapeAPIServer returns the metrics of the API server kubectl talks to. With several replicas,
+// they are the ones of a single replica.
+func scrapeAPIServer(ctx context.Context) (apiServerScrape, error) {
+	out, err := kubectl(ctx, nil, "get", "--raw", "/metrics")
+	if err != nil {
+		return apiServerScrape{}, err
+	}
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(out))
+	if err != nil {
+		return apiServerScrape{}, fmt.Errorf("scraping the API server: %v", err)
+	}
+	return apiServerScrape{time: time.Now(), families: families}, nil
+}
+
+// resourceName returns the plural resource of kind, lowercased as the API server names them.
+func resourceName(kind string) string {
+	plural := strings.ToLower(kind)
+	switch {
+	case strings.HasSuffix(plural, "y"):
+		return strings.TrimSuffix(plural, "y") + "ies"
+	case strings.HasSuffix(plural, "s"):
+		return plural + "es"
+	default:
+		return plural + "s"
+	}
+}
+
+// corpusResource is the group and plural resource of the objects of a corpus.
+type corpusResource struct {
+	group, resource string
+}
+
+// String returns <plural>.<group>, the resource label of the storage metrics.
+func (r corpusResource) String() string {
+	if r.group == "" {
+		return r.resource
+	}
+	return r.resource + "." + r.group
+}
+
+// docResources returns the sorted resources of the objects of docs.
+func docResources(docs []string) ([]corpusResource, error) {
+	seen := map[corpusResource]bool{}
+	for _, doc := range docs {
+		var object struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+		}
+		if err := yaml.Unmarshal([]byte(doc), &object); err != nil {
+			return nil, err
+		}
+		if object.Kind == "" {
+			continue
+		}
+		group := ""
+		if i := strings.Index(object.APIVersion, "/"); i >= 0 {
+			group = object.APIVersion[:i]
+		}
+		seen[corpusResource{group: group, resource: resourceName(object.Kind)}] = true
+	}
+	resources := make([]corpusResource, 0, len(seen))
+	for r := range seen {
+		resources = append(resources, r)
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].String() < resources[j].String() })
+	return resources, nil
+}
+
+// seriesSum returns the sum of the series of the counter or gauge name whose labels match.
+// max sums the largest series instead, for the replicas of a same value.
+func (f metricFamilies) seriesSum(name string, match func(labels map[string]string) bool, max bool) float64 {
+	family, ok := f[name]
+	if !ok {
+		return 0
+	}
+	result := 0.0
+	for _, m := range family.Metric {
+		labels := map[string]string{}
+		for _, l := range m.Label {
+			labels[l.GetName()] = l.GetValue()
+		}
+		if match != nil && !match(labels) {
+			continue
+		}
+		var v float64
+		switch {
+		case m.Counter != nil:
+			v = m.Counter.GetValue()
+		case m.Gauge != nil:
+			v = m.Gauge.GetValue()
+		case m.Untyped != nil:
+			v = m.Untyped.GetValue()
+		}
+		if max {
+			if v > result {
+				result = v
+			}
+		} else {
+			result += v
+		}
+	}
+	return result
+}
+
+// storageObjects returns the objects of resource stored in etcd, from apiserver_storage_objects or,
+// before Kubernetes 1.21, etcd_object_counts.
+func (s apiServerScrape) storageObjects(resource string) float64 {
+	match := func(labels map[string]string) bool { return labels["resource"] == resource }
+	if _, ok := s.families["apiserver_storage_objects"]; ok {
+		return s.families.seriesSum("apiserver_storage_objects", match, false)
+	}
+	return s.families.seriesSum("etcd_object_counts", match, false)
+}
+
+// dbSize returns the size of the etcd database, from apiserver_storage_db_total_size_in_bytes or,
+// before Kubernetes 1.23, etcd_db_total_size_in_bytes.
+func (s apiServerScrape) dbSize() float64 {
+	if _, ok := s.families["apiserver_storage_db_total_size_in_bytes"]; ok {
+		return s.families.seriesSum("apiserver_storage_db_total_size_in_bytes", nil, true)
+	}
+	return s.families.seriesSum("etcd_db_total_size_in_bytes", nil, true)
+}
+
+// newAPIServerResult returns the load of the apply of policiesApplied policies of resources
+// between the before and after scrapes.
+func newAPIServerResult(before, after apiServerScrape, resources []corpusResource, policiesApplied int) *APIServerResult {
+	r := &APIServerResult{DurationSeconds: after.time.Sub(before.time).Seconds()}
+	delta := func(name string, match func(labels map[string]string) bool) float64 {
+		return after.families.seriesSum(name, match, false) - before.families.seriesSum(name, match, false)
+	}
+	r.Requests = delta("apiserver_request_total", nil)
+	if r.DurationSeconds > 0 {
+		r.RequestsPerSecond = r.Requests / r.DurationSeconds
+	}
+	r.Throttled = delta("apiserver_request_total", func(labels map[string]string) bool { return labels["code"] == "429" })
+
+	verbs := map[string]bool{}
+	for _, scrape := range []apiServerScrape{before, after} {
+		if family, ok := scrape.families["apiserver_request_total"]; ok {
+			for _, m := range family.Metric {
+				for _, l := range m.Label {
+					if l.GetName() == "verb" {
+						verbs[l.GetValue()] = true
+					}
+				}
+			}
+		}
+	}
+	for verb := range verbs {
+		verb := verb
+		n := delta("apiserver_request_total", func(labels map[string]string) bool {
+			if labels["verb"] != verb {
+				return false
+			}
+			for _, res := range resources {
+				if labels["group"] == res.group && labels["resource"] == res.resource {
+					return true
+				}
+			}
+			return false
+		})
+		if n > 0 {
+			if r.CorpusRequests == nil {
+				r.CorpusRequests = map[string]float64{}
+			}
+			r.CorpusRequests[verb] = n
+		}
+	}
+
+	for _, res := range resources {
+		r.Objects = append(r.Objects, ResourceObjects{
+			Resource: res.String(),
+			Before:   before.storageObjects(res.String()),
+			After:    after.storageObjects(res.String()),
+		})
+	}
+	r.DBSizeBytesBefore, r.DBSizeBytesAfter = before.dbSize(), after.dbSize()
+	if policiesApplied > 0 {
+		r.DBGrowthBytesPerPolicy = (r.DBSizeBytesAfter - r.DBSizeBytesBefore) / float64(policiesApplied)
+	}
+	return r
+}
+
+func (r *APIServerResult) print(w io.Writer) error {
+	fmt.Fprintf(w, "API server: %.0f requests in %.1fs, %.1f/s, %.0f throttled\n", r.Requests, r.DurationSeconds, r.RequestsPerSecond, r.Throttled)
+	var verbs []string
+	for verb := range r.CorpusRequests {
+		verbs = append(verbs, verb)
+	}
+	sort.Strings(verbs)
+	for _, verb := range verbs {
+		fmt.Fprintf(w, "  %s on the resources of the corpus: %.0f\n", verb, r.CorpusRequests[verb])
+	}
+	fmt.Fprintf(w, "etcd: database %.0f bytes before, %.0f after, %.0f per policy applied\n",
+		r.DBSizeBytesBefore, r.DBSizeBytesAfter, r.DBGrowthBytesPerPolicy)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "resource\tobjects before\tobjects after\t")
+	for _, o := range r.Objects {
+		fmt.Fprintf(tw, "%s\t%.0f\t%.0f\t\n", o.Resource, o.Before, o.After)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,71 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewAPIServerResult(t *testing.T) {
+	docs := []string{
+		"apiVersion: v1\nkind: Namespace\nmetadata:\n  name: ns\n",
+		"apiVersion: security.istio.io/v1beta1\nkind: AuthorizationPolicy\nmetadata:\n  name: a\n",
+		"apiVersion: telemetry.istio.io/v1alpha1\nkind: Telemetry\nmetadata:\n  name: t\n",
+	}
+	resources, err := docResources(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []corpusResource{{"security.istio.io", "authorizationpolicies"}, {"", "namespaces"}, {"telemetry.istio.io", "telemetries"}}
+	if !reflect.DeepEqual(resources, want) {
+		t.Fatalf("got resources %v, want %v", resources, want)
+	}
+
+	before := apiServerScrape{time: time.Unix(0, 0), families: parseMetrics(t, `# TYPE apiserver_request_total counter
+apiserver_request_total{code="200",group="",resource="pods",verb="GET"} 100
+apiserver_request_total{code="201",group="security.istio.io",resource="authorizationpolicies",verb="POST"} 10
+# TYPE apiserver_storage_objects gauge
+apiserver_storage_objects{resource="authorizationpolicies.security.istio.io"} 10
+# TYPE apiserver_storage_db_total_size_in_bytes gauge
+apiserver_storage_db_total_size_in_bytes{endpoint="https://etcd-0:2379"} 1e+06
+apiserver_storage_db_total_size_in_bytes{endpoint="https://etcd-1:2379"} 900000
+`)}
+	after := apiServerScrape{time: time.Unix(10, 0), families: parseMetrics(t, `# TYPE apiserver_request_total counter
+apiserver_request_total{code="200",group="",resource="pods",verb="GET"} 150
+apiserver_request_total{code="201",group="security.istio.io",resource="authorizationpolicies",verb="POST"} 110
+apiserver_request_total{code="200",group="security.istio.io",resource="authorizationpolicies",verb="PATCH"} 20
+apiserver_request_total{code="429",group="security.istio.io",resource="authorizationpolicies",verb="PATCH"} 5
+# TYPE apiserver_storage_objects gauge
+apiserver_storage_objects{resource="authorizationpolicies.security.istio.io"} 110
+# TYPE apiserver_storage_db_total_size_in_bytes gauge
+apiserver_storage_db_total_size_in_bytes{endpoint="https://etcd-0:2379"} 1.2e+06
+apiserver_storage_db_total_size_in_bytes{endpoint="https://etcd-1:2379"} 1.1e+06
+`)}
+	r := newAPIServerResult(before, after, resources, 100)
+	if r.Requests != 175 || r.RequestsPerSecond != 17.5 || r.Throttled != 5 {
+		t.Errorf("got %v requests, %v/s, %v throttled, want 175, 17.5 and 5", r.Requests, r.RequestsPerSecond, r.Throttled)
+	}
+	if !reflect.DeepEqual(r.CorpusRequests, map[string]float64{"POST": 100, "PATCH": 25}) {
+		t.Errorf("got corpus requests %v, want 100 POST and 25 PATCH", r.CorpusRequests)
+	}
+	if r.Objects[0] != (ResourceObjects{Resource: "authorizationpolicies.security.istio.io", Before: 10, After: 110}) {
+		t.Errorf("got objects %+v", r.Objects)
+	}
+	if r.DBSizeBytesBefore != 1e6 || r.DBSizeBytesAfter != 1.2e6 || r.DBGrowthBytesPerPolicy != 2000 {
+		t.Errorf("got database %v to %v, %v per policy, want the largest endpoint, 1e6 to 1.2e6 and 2000", r.DBSizeBytesBefore, r.DBSizeBytesAfter, r.DBGrowthBytesPerPolicy)
+	}
+}
@@ -0,0 +1,376 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+func runApply(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The name of the config json file")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	trafficFile := fs.String("trafficFile", "traffic.json", "The file the traffic profile of the scenario is written to")
+	denyRate := fs.Float64("denyRate", 0, "The share of requests of the scenario traffic profile expected to be denied")
+	expectationsFile := fs.String("expectationsFile", "", "A JSON file the expected decision and matching policy of requests sampled from the policies are written to")
+	batchSize := fs.Int("batchSize", 100, "The number of policies applied per kubectl invocation")
+	outDir := fs.String("outDir", "run", "The directory the run report and profiles are written to")
+	profileAt := fs.String("profileAt", "",
+		"Comma separated percentages of the corpus applied (e.g. 0,50,100) at which istiod profiles are captured")
+	profileSeconds := fs.Int("profileSeconds", 30, "The duration of each istiod CPU profile, 0 disables CPU profiles")
+	profileHeap := fs.Bool("profileHeap", true, "Whether to capture an istiod heap profile at each profile point")
+	istioNamespace := fs.String("istioNamespace", "istio-system", "The namespace istiod runs in")
+	validateSchema := fs.Bool("validateSchema", false, "Validate the policies against the OpenAPI schemas of their CRDs before applying them")
+	schemaFile := fs.String("schemaFile", "", "A path or URL of the CRDs to validate against, defaults to the bundled security.istio.io CRDs")
+	maxRetries := fs.Int("maxRetries", 5, "The number of times a batch throttled by the API server is retried")
+	initialBackoff := fs.Duration("initialBackoff", time.Second, "The time waited before the first retry of a throttled batch, doubled on every retry")
+	maxBackoff := fs.Duration("maxBackoff", 30*time.Second, "The maximum time waited between two retries of a throttled batch")
+	ready := fs.Bool("ready", false, "Probe the policies after applying them and signal when the proxies enforce them in the ConfigMap readyConfigMap")
+	readyConfigMapName := fs.String("readyConfigMap", "generate-policies-corpus", "The ConfigMap whose data.ready is set to true once the corpus is enforced")
+	readyNamespace := fs.String("readyNamespace", "", "The namespace of readyConfigMap and readyClient, defaults to the namespace of the policies")
+	readyClient := fs.String("readyClient", "deploy/client", "The pod sending the readiness and enforcement probes with curl, as a kubectl exec target")
+	readyContainer := fs.String("readyContainer", "", "The container of readyClient with curl, defaults to its default container")
+	readyURL := fs.String("readyURL", "http://fortioserver:8080", "The URL of the workload of the policies the probes are sent to")
+	readyProbes := fs.Int("readyProbes", 2, "The number of probes sampled from the policies, half of them expected to be denied")
+	readyTimeout := fs.Duration("readyTimeout", 5*time.Minute, "The maximum time waited for the proxies to enforce the corpus")
+	stamp := fs.Bool("stamp", false, "Annotate every generated object with the tool version, git SHA and flags of the run")
+	owner := fs.String("owner", "", "The name of a parent ConfigMap created in every namespace of the policies and owning them, so that deleting it garbage collects the corpus")
+	convergence := fs.Bool("convergence", false, "Wait for istiod to converge after every batch and correlate its push latency with the policies applied")
+	pollInterval := fs.Duration("pollInterval", time.Second, "The interval between scrapes of the istiod metrics while waiting for the convergence")
+	quietPeriod := fs.Duration("quietPeriod", 10*time.Second, "The time without pushes after which istiod has converged after a batch")
+	convergenceTimeout := fs.Duration("convergenceTimeout", 5*time.Minute, "The maximum time waited for istiod to converge after a batch")
+	enforcement := fs.Bool("enforcement", false, "Apply a DENY policy after every batch and measure the time until the probes from readyClient are denied")
+	enforcementSelector := fs.String("enforcementSelector", "app=fortioserver", "The comma separated labels of the workloads the DENY policy of -enforcement selects")
+	enforcementInterval := fs.Duration("enforcementInterval", 100*time.Millisecond, "The interval between two probes of -enforcement")
+	enforcementTimeout := fs.Duration("enforcementTimeout", 2*time.Minute, "The maximum time waited for the DENY policy of -enforcement to be enforced or lifted")
+	listenerRBACFlag := fs.Bool("listenerRBAC", false, "Report the RBAC policies of every filter chain of the proxies of listenerRBACSelector after the apply")
+	listenerRBACSelector := fs.String("listenerRBACSelector", "app=fortioserver", "The label selector of the pods of -listenerRBAC, in the namespace of the policies")
+	skewThreshold := fs.Float64("skewThreshold", 2, "The ratio of the policies of the most loaded filter chain of a proxy to their mean above which -listenerRBAC reports it skewed")
+	apiServer := fs.Bool("apiserver", false, "Record the requests of the API server, and the objects and database size of etcd, before and after the apply")
+	_ = fs.Parse(args)
+
+	if *batchSize <= 0 {
+		return fmt.Errorf("invalid batchSize: %d", *batchSize)
+	}
+	if *maxRetries < 0 {
+		return fmt.Errorf("invalid maxRetries: %d", *maxRetries)
+	}
+	if *initialBackoff <= 0 || *maxBackoff < *initialBackoff {
+		return fmt.Errorf("invalid backoff: initialBackoff %v must be positive and not exceed maxBackoff %v", *initialBackoff, *maxBackoff)
+	}
+	retries := backoff{maxRetries: *maxRetries, initial: *initialBackoff, max: *maxBackoff}
+	points, err := parseProfilePoints(*profileAt)
+	if err != nil {
+		return err
+	}
+	policyData, err := loadSecurityPolicy(*scenarioName, *configFile)
+	if err != nil {
+		return err
+	}
+	genCtx, genSpan := startSpan(ctx, "generate")
+	policies, err := generatePolicies(genCtx, policyData)
+	genSpan.setAttribute("documents", len(policies))
+	genSpan.end(err)
+	if err != nil {
+		return err
+	}
+	if *stamp {
+		if policies, err = stampDocs(policies, newRunMetadata(fs, nil)); err != nil {
+			return err
+		}
+	}
+	namespace := *readyNamespace
+	if namespace == "" {
+		namespace = policyData.Namespace
+	}
+	if namespace == "" {
+		namespace = generatepolicies.DefaultNamespace
+	}
+	client := probeClient{namespace: namespace, target: *readyClient, container: *readyContainer}
+	var readiness readinessOptions
+	var readyProfile *TrafficProfile
+	generation := generationHash(policies)
+	if *ready {
+		if readyProfile, err = sampleTraffic(policyData, *readyProbes, 0.5); err != nil {
+			return err
+		}
+		if readyProfile.External {
+			return fmt.Errorf("the traffic of scenario %s is sent from outside the mesh, readiness probes from a client in the mesh", *scenarioName)
+		}
+		readiness = readinessOptions{
+			namespace: namespace,
+			configMap: *readyConfigMapName,
+			client:    client,
+			url:       *readyURL,
+			interval:  5 * time.Second,
+			timeout:   *readyTimeout,
+		}
+		// The policies carry the generation the ConfigMap reports ready.
+		for i := range policies {
+			if policies[i], err = annotate(policies[i], map[string]string{generationAnnotation: generation}); err != nil {
+				return err
+			}
+		}
+		if err := signalReadiness(ctx, readiness, generation, false, "applying"); err != nil {
+			return err
+		}
+	}
+	var enforcer enforcementOptions
+	if *enforcement {
+		// The request is allowed by the corpus, so that only the DENY policy denies it.
+		profile, err := sampleTraffic(policyData, 1, 0)
+		if err != nil {
+			return err
+		}
+		if profile.External {
+			return fmt.Errorf("the traffic of scenario %s is sent from outside the mesh, enforcement probes from a client in the mesh", *scenarioName)
+		}
+		selector, err := parseLabels(*enforcementSelector)
+		if err != nil {
+			return err
+		}
+		enforcer = enforcementOptions{
+			namespace: namespace,
+			selector:  selector,
+			client:    client,
+			url:       *readyURL,
+			request:   profile.Requests[0],
+			interval:  *enforcementInterval,
+			timeout:   *enforcementTimeout,
+		}
+	}
+	if *validateSchema {
+		if err := validateSchemas(policies, *schemaFile); err != nil {
+			return err
+		}
+	}
+	if err := writeScenarioTraffic(*scenarioName, policyData, *trafficFile, *denyRate); err != nil {
+		return err
+	}
+	if err := writeExpectations(*scenarioName, policyData, policies, *expectationsFile); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+	if *owner != "" {
+		owners, err := createRunOwners(ctx, *owner, generation, policies)
+		if err != nil {
+			return err
+		}
+		for i := range policies {
+			if policies[i], err = setOwner(policies[i], owners); err != nil {
+				return err
+			}
+		}
+		log.Printf("the policies are owned by the ConfigMaps %s of %d namespaces, delete them with kubectl delete configmap -A -l %s=%s",
+			*owner, len(owners), runLabel, *owner)
+	}
+
+	report := newRunReport("apply", *configFile, fs)
+	prof := newProfiler(profileOptions{
+		points:     points,
+		cpuSeconds: *profileSeconds,
+		heap:       *profileHeap,
+		namespace:  *istioNamespace,
+		selector:   "app=istiod",
+	}, *outDir)
+
+	var tracker *convergenceTracker
+	if *convergence {
+		if tracker, err = newConvergenceTracker(ctx, *istioNamespace, *pollInterval, *quietPeriod, *convergenceTimeout); err != nil {
+			return err
+		}
+		defer tracker.close()
+	}
+	if *enforcement {
+		report.Enforcement = &EnforcementResult{Request: enforcer.request}
+	}
+
+	nextPoint := 0
+	captureReached := func(applied int) {
+		for nextPoint < len(points) && applied*100 >= points[nextPoint]*len(policies) {
+			prof.capture(ctx, fmt.Sprintf("p%d", points[nextPoint]))
+			nextPoint++
+		}
+	}
+
+	var apiServerBefore apiServerScrape
+	var resources []corpusResource
+	if *apiServer {
+		if resources, err = docResources(policies); err != nil {
+			return err
+		}
+		if apiServerBefore, err = scrapeAPIServer(ctx); err != nil {
+			return err
+		}
+	}
+
+	captureReached(0)
+	applyCtx, applySpan := startSpan(ctx, "apply")
+	applySpan.setAttribute("policies", len(policies))
+	for start := 0; start < len(policies); start += *batchSize {
+		if ctx.Err() != nil {
+			break
+		}
+		end := start + *batchSize
+		if end > len(policies) {
+			end = len(policies)
+		}
+		batchStart := time.Now()
+		batchCtx, batchSpan := startSpan(applyCtx, "batch")
+		batchSpan.setAttribute("index", len(report.Batches))
+		batchSpan.setAttribute("policies", end-start)
+		// Applying is idempotent, so a batch throttled half way is simply applied again.
+		var retried int
+		var waited time.Duration
+		retried, waited, err = retryThrottled(ctx, retries, func() error {
+			return kubectlApply(ctx, policies[start:end])
+		})
+		batchSpan.setAttribute("retries", retried)
+		batchSpan.end(err)
+		if retried > 0 {
+			report.addThrottling(retried, waited)
+		}
+		if ctx.Err() != nil {
+			// kubectl was killed, the batch may have been applied partially.
+			break
+		}
+		report.Batches = append(report.Batches, BatchResult{
+			Index:           len(report.Batches),
+			Policies:        end - start,
+			DurationSeconds: time.Since(batchStart).Seconds(),
+			Retries:         retried,
+			BackoffSeconds:  waited.Seconds(),
+		})
+		if err != nil && isThrottled(err) {
+			err = fmt.Errorf("batch %d still throttled after %d retries: %v", len(report.Batches)-1, retried, err)
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			break
+		}
+		report.PoliciesApplied = end
+		if tracker != nil {
+			err = inSpan(batchCtx, "wait", func(ctx context.Context) error {
+				return tracker.batchApplied(ctx, len(report.Batches)-1, end, batchStart)
+			})
+			if err != nil {
+				if ctx.Err() == nil {
+					report.Errors = append(report.Errors, err.Error())
+				}
+				break
+			}
+		}
+		if report.Enforcement != nil {
+			err = inSpan(batchCtx, "enforcement", func(ctx context.Context) error {
+				b, err := measureEnforcement(ctx, enforcer, len(report.Batches)-1, end)
+				if err == nil {
+					report.Enforcement.Batches = append(report.Enforcement.Batches, b)
+				}
+				return err
+			})
+			if err != nil {
+				if ctx.Err() == nil {
+					report.Errors = append(report.Errors, err.Error())
+				}
+				break
+			}
+		}
+		captureReached(end)
+	}
+	applySpan.setAttribute("policiesApplied", report.PoliciesApplied)
+	applySpan.end(err)
+	if *apiServer && ctx.Err() == nil {
+		after, scrapeErr := scrapeAPIServer(ctx)
+		if scrapeErr != nil {
+			report.Errors = append(report.Errors, scrapeErr.Error())
+		} else {
+			report.APIServer = newAPIServerResult(apiServerBefore, after, resources, report.PoliciesApplied)
+		}
+	}
+
+	if *ready && err == nil && ctx.Err() == nil {
+		err = inSpan(ctx, "wait", func(ctx context.Context) error {
+			var waitErr error
+			report.Readiness, waitErr = waitCorpusReady(ctx, readiness, generation, readyProfile)
+			return waitErr
+		})
+		if err != nil && ctx.Err() == nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+	if *listenerRBACFlag && err == nil && ctx.Err() == nil {
+		err = inSpan(ctx, "listeners", func(ctx context.Context) error {
+			pods, err := proxyPods(ctx, namespace, *listenerRBACSelector)
+			if err != nil {
+				return err
+			}
+			report.ListenerRBAC, err = listenerRBAC(ctx, namespace, pods, *skewThreshold)
+			return err
+		})
+		if err != nil && ctx.Err() == nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+	if ctx.Err() != nil {
+		report.Interrupted = true
+		err = fmt.Errorf("interrupted after applying %d of %d policies, see %s", report.PoliciesApplied, len(policies),
+			filepath.Join(*outDir, "report.json"))
+		report.Errors = append(report.Errors, err.Error())
+	}
+	profiles, profileErrs := prof.wait()
+	report.Profiles = profiles
+	for _, e := range profileErrs {
+		report.Errors = append(report.Errors, e.Error())
+	}
+	if tracker != nil {
+		report.Convergence = &tracker.result
+		if err := report.Convergence.print(os.Stdout); err != nil {
+			return err
+		}
+	}
+	if report.Enforcement != nil {
+		if err := report.Enforcement.print(os.Stdout); err != nil {
+			return err
+		}
+	}
+	if report.APIServer != nil {
+		if err := report.APIServer.print(os.Stdout); err != nil {
+			return err
+		}
+	}
+	if report.ListenerRBAC != nil {
+		if err := report.ListenerRBAC.print(os.Stdout); err != nil {
+			return err
+		}
+	}
+	if t := report.Throttling; t != nil {
+		log.Printf("throttled by the API server: %d batches retried %d times, %.1fs backoff", t.ThrottledBatches, t.Retries, t.BackoffSeconds)
+	}
+	report.EndTime = time.Now()
+	if writeErr := writeRunReport(*outDir, report); writeErr != nil {
+		return writeErr
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// throttledMessages are lower case substrings of kubectl errors caused by the API server
+// rejecting a request with 429 Too Many Requests, either because of its max-inflight limits
+// ("the server has received too many requests and has asked us to try again later") or
+// API Priority and Fairness ("Too many requests, please try again later."), or by the client
+// side rate limiter of kubectl giving up.
+var throttledMessages = []string{
+	"too many requests",
+	"toomanyrequests",
+	"rate limiter wait returned an error",
+}
+
+// isThrottled returns whether err was caused by the API server or kubectl throttling requests.
+func isThrottled(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, m := range throttledMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff is an exponential backoff schedule for retrying throttled requests.
+type backoff struct {
+	maxRetries int
+	initial    time.Duration
+	max        time.Duration
+}
+
+// delay returns the time waited before the given retry, counted from 0.
+func (b backoff) delay(retry int) time.Duration {
+	d := b.initial
+	for i := 0; i < retry && d < b.max; i++ {
+		d *= 2
+	}
+	if d > b.max {
+		d = b.max
+	}
+	return d
+}
+
+// retryThrottled calls f until it succeeds, fails with an error that is not a throttling error,
+// the retries are exhausted or ctx is cancelled. It returns the number of retries and the total
+// time waited between them.
+func retryThrottled(ctx context.Context, b backoff, f func() error) (int, time.Duration, error) {
+	var waited time.Duration
+	for retry := 0; ; retry++ {
+		err := f()
+		if !isThrottled(err) || retry >= b.maxRetries || ctx.Err() != nil {
+			return retry, waited, err
+		}
+		d := b.delay(retry)
+		select {
+		case <-time.After(d):
+			waited += d
+		case <-ctx.Done():
+			return retry, waited, err
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIsThrottled(t *testing.T) {
+	cases := []struct {
+		err  string
+		want bool
+	}{
+		{"kubectl apply -f -: exit status 1: Error from server (TooManyRequests): the server has received too many requests and has asked us to try again later", true},
+		{"kubectl apply -f -: exit status 1: Error from server: Too many requests, please try again later.", true},
+		{"kubectl apply -f -: exit status 1: client rate limiter Wait returned an error: context deadline exceeded", true},
+		{"kubectl apply -f -: exit status 1: error validating data: unknown field \"rules\"", false},
+	}
+	for _, c := range cases {
+		if got := isThrottled(errors.New(c.err)); got != c.want {
+			t.Errorf("isThrottled(%q) = %v, want %v", c.err, got, c.want)
+		}
+	}
+	if isThrottled(nil) {
+		t.Error("isThrottled(nil) = true")
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	b := backoff{initial: time.Second, max: 5 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for retry, w := range want {
+		if got := b.delay(retry); got != w {
+			t.Errorf("delay(%d) = %v, want %v", retry, got, w)
+		}
+	}
+}
+
+func TestRetryThrottled(t *testing.T) {
+	throttled := errors.New("Error from server (TooManyRequests): the server has received too many requests")
+	b := backoff{maxRetries: 2, initial: time.Millisecond, max: time.Millisecond}
+
+	calls := 0
+	retries, waited, err := retryThrottled(context.Background(), b, func() error {
+		calls++
+		if calls < 2 {
+			return throttled
+		}
+		return nil
+	})
+	if err != nil || retries != 1 || calls != 2 || waited != time.Millisecond {
+		t.Errorf("got retries %d, waited %v, calls %d, err %v", retries, waited, calls, err)
+	}
+
+	calls = 0
+	retries, _, err = retryThrottled(context.Background(), b, func() error {
+		calls++
+		return throttled
+	})
+	if err != throttled || retries != 2 || calls != 3 {
+		t.Errorf("exhausted: got retries %d, calls %d, err %v", retries, calls, err)
+	}
+
+	calls = 0
+	other := errors.New("invalid policy")
+	if _, _, err := retryThrottled(context.Background(), b, func() error {
+		calls++
+		return other
+	}); err != other || calls != 1 {
+		t.Errorf("other error: got calls %d, err %v", calls, err)
+	}
+}
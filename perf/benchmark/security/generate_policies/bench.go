@@ -0,0 +1,137 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+func runBench(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	url := fs.String("url", "", "The base URL the paths of the traffic profile are appended to")
+	trafficFile := fs.String("trafficFile", "", "The traffic profile to send, as written by the traffic subcommand. Default: GET url")
+	qps := fs.Float64("qps", 100, "The requests per second, 0 sends as fast as possible")
+	conns := fs.Int("conns", 8, "The number of concurrent connections")
+	duration := fs.Duration("duration", 30*time.Second, "The duration of the load")
+	warmup := fs.Duration("warmup", 0, "The duration of a warmup phase excluded from the results")
+	warmupRequests := fs.Int("warmupRequests", 0, "The number of requests of a warmup phase excluded from the results")
+	outDir := fs.String("outDir", "run", "The directory the run report is written to")
+	rbacStats := fs.Bool("rbacStats", false, "Scrape the RBAC filter counters of the proxies of -proxySelector before and after the load")
+	proxyNamespace := fs.String("proxyNamespace", generatepolicies.DefaultNamespace, "The namespace of the proxies whose RBAC counters are scraped")
+	proxySelector := fs.String("proxySelector", "app=fortioserver", "The label selector of the pods whose RBAC counters are scraped")
+	_ = fs.Parse(args)
+
+	opts := loadOptions{
+		url:            *url,
+		qps:            *qps,
+		conns:          *conns,
+		duration:       *duration,
+		warmup:         *warmup,
+		warmupRequests: *warmupRequests,
+	}
+	denyRate := 0.0
+	if *trafficFile != "" {
+		profile, err := readTrafficProfile(*trafficFile)
+		if err != nil {
+			return err
+		}
+		opts.requests = profile.Requests
+		denyRate = profile.DenyRate
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+
+	report := newRunReport("bench", "", fs)
+	var pods []string
+	var before map[string]RBACCounts
+	if *rbacStats {
+		var err error
+		if pods, err = proxyPods(ctx, *proxyNamespace, *proxySelector); err == nil {
+			before, err = scrapeRBAC(ctx, *proxyNamespace, pods)
+		}
+		if err != nil {
+			return fmt.Errorf("scraping the RBAC counters: %v", err)
+		}
+	}
+	var result *LoadResult
+	err := inSpan(ctx, "load", func(ctx context.Context) error {
+		var loadErr error
+		result, loadErr = runLoad(ctx, opts)
+		return loadErr
+	})
+	report.Load = result
+	if before != nil {
+		after, scrapeErr := scrapeRBAC(ctx, *proxyNamespace, pods)
+		if scrapeErr != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("scraping the RBAC counters: %v", scrapeErr))
+		} else {
+			report.RBAC = newRBACResult(before, after, expectedDenyRatio(opts.requests, denyRate))
+		}
+	}
+	if err == nil && ctx.Err() != nil {
+		report.Interrupted = true
+		err = fmt.Errorf("interrupted after %d requests, the results cover the partial run", result.Requests)
+	}
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	report.EndTime = time.Now()
+	if writeErr := writeRunReport(*outDir, report); writeErr != nil {
+		return writeErr
+	}
+	if result != nil {
+		printLoadResult(result)
+	}
+	if report.RBAC != nil {
+		printRBACResult(report.RBAC)
+	}
+	return err
+}
+
+func printLoadResult(result *LoadResult) {
+	if result.WarmupRequests > 0 {
+		fmt.Printf("%d warmup requests excluded\n", result.WarmupRequests)
+	}
+	fmt.Printf("%d requests, %d errors, %.1f qps\n", result.Requests, result.Errors, result.ActualQPS)
+	if result.UnexpectedDecisions > 0 {
+		fmt.Printf("%d responses did not match the expected decision\n", result.UnexpectedDecisions)
+	}
+	for _, outcome := range outcomes {
+		if l, ok := result.LatencyByOutcome[outcome]; ok {
+			fmt.Printf("%-16s %.1f qps p50=%.3fms p90=%.3fms p99=%.3fms\n", outcome, result.QPSByOutcome[outcome], l.P50, l.P90, l.P99)
+		}
+	}
+}
+
+func readTrafficProfile(file string) (*TrafficProfile, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	profile := &TrafficProfile{}
+	if err := json.Unmarshal(data, profile); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return profile, nil
+}
@@ -0,0 +1,323 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// dryRunAnnotation makes the RBAC filters only record the decisions of an AuthorizationPolicy as
+// shadow decisions, without changing the outcome of the requests.
+const dryRunAnnotation = "istio.io/dry-run"
+
+// The stages of a canary rollout, in order.
+const (
+	canaryBaseline = "baseline"
+	canaryDryRun   = "dry-run"
+	canaryEnforced = "enforced"
+)
+
+// CanaryResult records a corpus rolled out the way production rollouts are recommended to: applied
+// in dry-run mode first, to see what it would deny from the shadow decisions, then enforced.
+type CanaryResult struct {
+	Policies int `json:"policies"`
+	// HeldBack is the number of CUSTOM policies, which do not support dry-run and are only applied
+	// by the enforced stage.
+	HeldBack int           `json:"heldBack,omitempty"`
+	Stages   []CanaryStage `json:"stages"`
+}
+
+// CanaryStage is the load measured once the policies of a stage took effect.
+type CanaryStage struct {
+	Name         string      `json:"name"`
+	ApplySeconds float64     `json:"applySeconds,omitempty"`
+	Load         *LoadResult `json:"load,omitempty"`
+	RBAC         *RBACResult `json:"rbac,omitempty"`
+	// ShadowDenyRatio is the share of the shadow decisions which denied the request, what the
+	// dry-run policies would deny once enforced.
+	ShadowDenyRatio float64 `json:"shadowDenyRatio"`
+	// AddedLatency is the latency of the stage minus the one of the baseline.
+	AddedLatency *LatencySummary `json:"addedLatency,omitempty"`
+}
+
+// stage returns the stage named name, or nil if the run did not reach it.
+func (r *CanaryResult) stage(name string) *CanaryStage {
+	for i := range r.Stages {
+		if r.Stages[i].Name == name {
+			return &r.Stages[i]
+		}
+	}
+	return nil
+}
+
+// compare sets the shadow deny ratio of the stages and their latency added to the baseline.
+func (r *CanaryResult) compare() {
+	baseline := r.stage(canaryBaseline)
+	for i := range r.Stages {
+		s := &r.Stages[i]
+		if s.RBAC != nil {
+			if shadow := s.RBAC.Total.ShadowAllowed + s.RBAC.Total.ShadowDenied; shadow > 0 {
+				s.ShadowDenyRatio = s.RBAC.Total.ShadowDenied / shadow
+			}
+		}
+		if s.Name != canaryBaseline && baseline != nil && baseline.Load != nil && s.Load != nil {
+			added := s.Load.Latency.sub(baseline.Load.Latency)
+			s.AddedLatency = &added
+		}
+	}
+}
+
+// canaryDocs returns docs with the dry-run annotation of their AuthorizationPolicies set to
+// dryRun, the other resources are unchanged. CUSTOM policies do not support dry-run, so they are
+// left out in dry-run mode and the number of them is returned.
+func canaryDocs(docs []string, dryRun bool) ([]string, int, error) {
+	var out []string
+	heldBack := 0
+	for _, doc := range docs {
+		var resource struct {
+			Kind     string                          `json:"kind"`
+			Metadata generatepolicies.MetadataStruct `json:"metadata"`
+			Spec     struct {
+				Action string `json:"action"`
+			} `json:"spec"`
+		}
+		if err := yaml.Unmarshal([]byte(doc), &resource); err != nil {
+			return nil, 0, err
+		}
+		if resource.Kind != "AuthorizationPolicy" {
+			out = append(out, doc)
+			continue
+		}
+		if dryRun && resource.Spec.Action == "CUSTOM" {
+			heldBack++
+			continue
+		}
+		annotated, err := annotate(doc, map[string]string{dryRunAnnotation: strconv.FormatBool(dryRun)})
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s/%s: %v", resource.Metadata.Namespace, resource.Metadata.Name, err)
+		}
+		out = append(out, annotated)
+	}
+	return out, heldBack, nil
+}
+
+// canaryRun holds what every stage of a canary run needs.
+type canaryRun struct {
+	opts              loadOptions
+	namespace         string
+	pods              []string
+	expectedDenyRatio float64
+	batchSize         int
+	settle            time.Duration
+}
+
+// runStage applies docs batch by batch, waits for them to take effect and measures the load with
+// the RBAC counters of the proxies scraped before and after it.
+func (c *canaryRun) runStage(ctx context.Context, name string, docs []string) (*CanaryStage, error) {
+	stage := &CanaryStage{Name: name}
+	if len(docs) > 0 {
+		start := time.Now()
+		applyCtx, applySpan := startSpan(ctx, "apply "+name)
+		for i := 0; i < len(docs); i += c.batchSize {
+			end := i + c.batchSize
+			if end > len(docs) {
+				end = len(docs)
+			}
+			batch := docs[i:end]
+			if err := inSpan(applyCtx, "batch", func(ctx context.Context) error { return kubectlApply(ctx, batch) }); err != nil {
+				applySpan.end(err)
+				return stage, err
+			}
+		}
+		applySpan.end(nil)
+		stage.ApplySeconds = time.Since(start).Seconds()
+		select {
+		case <-time.After(c.settle):
+		case <-ctx.Done():
+			return stage, fmt.Errorf("interrupted while waiting for the %s policies to take effect", name)
+		}
+	}
+
+	before, err := scrapeRBAC(ctx, c.namespace, c.pods)
+	if err != nil {
+		return stage, fmt.Errorf("scraping the RBAC counters: %v", err)
+	}
+	err = inSpan(ctx, "load "+name, func(ctx context.Context) error {
+		var loadErr error
+		stage.Load, loadErr = runLoad(ctx, c.opts)
+		return loadErr
+	})
+	if err != nil {
+		return stage, err
+	}
+	if ctx.Err() != nil {
+		return stage, fmt.Errorf("interrupted during the %s load", name)
+	}
+	after, err := scrapeRBAC(ctx, c.namespace, c.pods)
+	if err != nil {
+		return stage, fmt.Errorf("scraping the RBAC counters: %v", err)
+	}
+	stage.RBAC = newRBACResult(before, after, c.expectedDenyRatio)
+	return stage, nil
+}
+
+func printCanaryResult(result *CanaryResult) {
+	if result.HeldBack > 0 {
+		fmt.Printf("%d CUSTOM policies do not support dry-run, they were only applied by the enforced stage\n", result.HeldBack)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "stage\tapply (s)\tqps\tp50 (ms)\tp99 (ms)\tadded p99 (ms)\tdeny ratio\tshadow deny ratio\t")
+	for _, s := range result.Stages {
+		if s.Load == nil {
+			continue
+		}
+		added, deny := "", ""
+		if s.AddedLatency != nil {
+			added = fmt.Sprintf("%.3f", s.AddedLatency.P99)
+		}
+		if s.RBAC != nil {
+			deny = fmt.Sprintf("%.3f", s.RBAC.DenyRatio)
+		}
+		fmt.Fprintf(w, "%s\t%.1f\t%.1f\t%.3f\t%.3f\t%s\t%s\t%.3f\t\n", s.Name, s.ApplySeconds, s.Load.ActualQPS,
+			s.Load.Latency.P50, s.Load.Latency.P99, added, deny, s.ShadowDenyRatio)
+	}
+	_ = w.Flush()
+}
+
+func runCanary(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("canary", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the generated policies")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	policyFile := fs.String("policyFile", "", "A YAML file of policies to apply instead of the generated ones")
+	url := fs.String("url", "", "The base URL the paths of the traffic profile are appended to")
+	trafficFile := fs.String("trafficFile", "", "The traffic profile to send, as written by the traffic subcommand. Default: GET url")
+	qps := fs.Float64("qps", 100, "The requests per second, 0 sends as fast as possible")
+	conns := fs.Int("conns", 8, "The number of concurrent connections")
+	duration := fs.Duration("duration", 30*time.Second, "The duration of the load of each stage")
+	warmup := fs.Duration("warmup", 0, "The duration of a warmup phase excluded from the load of each stage")
+	warmupRequests := fs.Int("warmupRequests", 0, "The number of requests of a warmup phase excluded from the load of each stage")
+	settle := fs.Duration("settle", 30*time.Second, "The time to wait for the policies of a stage to take effect")
+	batchSize := fs.Int("batchSize", 100, "The number of policies applied per kubectl invocation")
+	proxyNamespace := fs.String("proxyNamespace", generatepolicies.DefaultNamespace, "The namespace of the proxies whose RBAC counters are scraped")
+	proxySelector := fs.String("proxySelector", "app=fortioserver", "The label selector of the pods whose RBAC counters are scraped")
+	keep := fs.Bool("keep", false, "Keep the enforced policies in the cluster at the end of the run")
+	outDir := fs.String("outDir", "run", "The directory the run report is written to")
+	_ = fs.Parse(args)
+
+	if *batchSize <= 0 {
+		return fmt.Errorf("invalid batchSize: %d", *batchSize)
+	}
+	run := &canaryRun{
+		opts: loadOptions{
+			url:            *url,
+			qps:            *qps,
+			conns:          *conns,
+			duration:       *duration,
+			warmup:         *warmup,
+			warmupRequests: *warmupRequests,
+		},
+		namespace: *proxyNamespace,
+		batchSize: *batchSize,
+		settle:    *settle,
+	}
+	if err := run.opts.validate(); err != nil {
+		return err
+	}
+	denyRate := 0.0
+	if *trafficFile != "" {
+		profile, err := readTrafficProfile(*trafficFile)
+		if err != nil {
+			return err
+		}
+		run.opts.requests = profile.Requests
+		denyRate = profile.DenyRate
+	}
+	run.expectedDenyRatio = expectedDenyRatio(run.opts.requests, denyRate)
+	docs, err := loadPolicyDocuments(ctx, *scenarioName, *configFile, *policyFile)
+	if err != nil {
+		return err
+	}
+	dryRunDocs, heldBack, err := canaryDocs(docs, true)
+	if err != nil {
+		return err
+	}
+	enforcedDocs, _, err := canaryDocs(docs, false)
+	if err != nil {
+		return err
+	}
+	if run.pods, err = proxyPods(ctx, *proxyNamespace, *proxySelector); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+
+	report := newRunReport("canary", *configFile, fs)
+	report.Canary = &CanaryResult{Policies: len(docs), HeldBack: heldBack}
+	if !*keep {
+		defer func() {
+			// Delete the policies even when interrupted, so that the cluster is left clean.
+			_, cleanupSpan := startSpan(ctx, "cleanup")
+			_, err := kubectl(context.Background(), strings.NewReader(strings.Join(enforcedDocs, "---\n")), "delete", "--ignore-not-found", "-f", "-")
+			cleanupSpan.end(err)
+			if err != nil {
+				log.Printf("failed to delete the policies: %v", err)
+			}
+		}()
+	}
+
+	stages := []struct {
+		name string
+		docs []string
+	}{{canaryBaseline, nil}, {canaryDryRun, dryRunDocs}, {canaryEnforced, enforcedDocs}}
+	for _, s := range stages {
+		stage, stageErr := run.runStage(ctx, s.name, s.docs)
+		report.Canary.Stages = append(report.Canary.Stages, *stage)
+		if stageErr != nil {
+			err = fmt.Errorf("%s stage: %v", s.name, stageErr)
+			break
+		}
+		report.PoliciesApplied = len(s.docs)
+	}
+	report.Canary.compare()
+
+	if ctx.Err() != nil {
+		report.Interrupted = true
+		err = fmt.Errorf("interrupted during the %s stage, see %s", report.Canary.Stages[len(report.Canary.Stages)-1].Name,
+			filepath.Join(*outDir, "report.json"))
+	}
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	report.EndTime = time.Now()
+	if writeErr := writeRunReport(*outDir, report); writeErr != nil {
+		return writeErr
+	}
+	printCanaryResult(report.Canary)
+	return err
+}
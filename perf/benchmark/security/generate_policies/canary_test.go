@@ -0,0 +1,120 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCanaryDocs(t *testing.T) {
+	docs := []string{`apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: deny-path
+  namespace: twopods-istio
+spec:
+  action: DENY
+  rules:
+  - to:
+    - operation:
+        paths: ["/admin"]
+`, `apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: ext-authz
+  namespace: twopods-istio
+spec:
+  action: CUSTOM
+  provider:
+    name: mock-ext-authz
+  rules:
+  - {}
+`, `apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: strict
+  namespace: twopods-istio
+spec:
+  mtls:
+    mode: STRICT
+`}
+
+	dryRun, heldBack, err := canaryDocs(docs, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if heldBack != 1 || len(dryRun) != 2 {
+		t.Fatalf("got %d docs, %d held back, want 2 docs and the CUSTOM policy held back", len(dryRun), heldBack)
+	}
+	if !strings.Contains(dryRun[0], `istio.io/dry-run: "true"`) || !strings.Contains(dryRun[0], "/admin") {
+		t.Errorf("the DENY policy is not in dry-run mode:\n%s", dryRun[0])
+	}
+	if dryRun[1] != docs[2] {
+		t.Errorf("the PeerAuthentication changed:\n%s", dryRun[1])
+	}
+
+	enforced, heldBack, err := canaryDocs(docs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if heldBack != 0 || len(enforced) != 3 {
+		t.Fatalf("got %d docs, %d held back, want all 3 docs", len(enforced), heldBack)
+	}
+	for _, doc := range enforced[:2] {
+		if !strings.Contains(doc, `istio.io/dry-run: "false"`) {
+			t.Errorf("the policy is not enforced:\n%s", doc)
+		}
+	}
+}
+
+func TestCanaryCompare(t *testing.T) {
+	result := &CanaryResult{Stages: []CanaryStage{
+		{Name: canaryBaseline, Load: &LoadResult{Latency: LatencySummary{P50: 1, P99: 2}}, RBAC: &RBACResult{}},
+		{
+			Name: canaryDryRun,
+			Load: &LoadResult{Latency: LatencySummary{P50: 1.5, P99: 3}},
+			RBAC: &RBACResult{Total: RBACCounts{Allowed: 100, ShadowAllowed: 75, ShadowDenied: 25}},
+		},
+		{
+			Name: canaryEnforced,
+			Load: &LoadResult{Latency: LatencySummary{P50: 1.25, P99: 2.5}},
+			RBAC: &RBACResult{Total: RBACCounts{Allowed: 75, Denied: 25}, DenyRatio: 0.25},
+		},
+	}}
+	result.compare()
+
+	if s := result.stage(canaryBaseline); s.AddedLatency != nil || s.ShadowDenyRatio != 0 {
+		t.Errorf("got baseline %+v", s)
+	}
+	dryRun := result.stage(canaryDryRun)
+	if dryRun.ShadowDenyRatio != 0.25 {
+		t.Errorf("got shadow deny ratio %v, want 0.25", dryRun.ShadowDenyRatio)
+	}
+	if dryRun.AddedLatency == nil || dryRun.AddedLatency.P50 != 0.5 || dryRun.AddedLatency.P99 != 1 {
+		t.Errorf("got dry-run added latency %+v", dryRun.AddedLatency)
+	}
+	if enforced := result.stage(canaryEnforced); enforced.AddedLatency == nil || enforced.AddedLatency.P99 != 0.5 {
+		t.Errorf("got enforced added latency %+v", enforced.AddedLatency)
+	}
+
+	row, err := resultRow(&RunReport{Command: "canary", Canary: result}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row["canary_dry_run_added_p99_ms"] != 1.0 || row["canary_enforced_added_p99_ms"] != 0.5 || row["canary_shadow_deny_ratio"] != 0.25 {
+		t.Errorf("got row %v", row)
+	}
+}
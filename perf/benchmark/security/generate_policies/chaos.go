@@ -0,0 +1,327 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The operations of a chaos run.
+const (
+	chaosApply   = "apply"
+	chaosInvalid = "invalid"
+	chaosDelete  = "delete"
+)
+
+// chaosOp applies or deletes the valid policy index, or applies the invalid policy index.
+type chaosOp struct {
+	kind  string
+	index int
+}
+
+// ChaosResult records how istiod handled a stream of valid applies interleaved with applies
+// rejected by the admission webhook and deletes.
+type ChaosResult struct {
+	Ops     int `json:"ops"`
+	Applied int `json:"applied"`
+	Deleted int `json:"deleted"`
+	// Rejected and Admitted are the invalid policies the admission webhook rejected and admitted.
+	Rejected int `json:"rejected"`
+	Admitted int `json:"admitted"`
+	// ApplyErrors are the valid applies and deletes which failed.
+	ApplyErrors int `json:"applyErrors"`
+	// IstiodRestarts counts the restarts of the containers of istiod and its replaced pods.
+	IstiodRestarts int `json:"istiodRestarts"`
+	// XDSRejects is pilot_total_xds_rejects, the xDS pushes the proxies rejected.
+	XDSRejects float64 `json:"xdsRejects"`
+	// ConvergenceSeconds is the time from the last operation to the last push.
+	ConvergenceSeconds float64 `json:"convergenceSeconds"`
+	Converged          bool    `json:"converged"`
+	// Missing, Extra and Modified compare the policies of the cluster with the valid policies
+	// expected after the operations.
+	Missing  int `json:"missing"`
+	Extra    int `json:"extra"`
+	Modified int `json:"modified"`
+}
+
+// Stable is whether istiod survived the operations and converged to the expected policies.
+func (r *ChaosResult) Stable() bool {
+	return r.Admitted == 0 && r.ApplyErrors == 0 && r.IstiodRestarts == 0 && r.XDSRejects == 0 && r.Converged &&
+		r.Missing == 0 && r.Extra == 0 && r.Modified == 0
+}
+
+// chaosPlan returns the operations applying every of numValid policies once, interleaved with
+// applies of the numInvalid invalid policies at invalidRate and deletes of random applied
+// policies at deleteRate, and the valid policies left applied.
+func chaosPlan(r *rand.Rand, numValid, numInvalid int, invalidRate, deleteRate float64) ([]chaosOp, []int) {
+	var ops []chaosOp
+	applied := []int{}
+	next, invalid := 0, 0
+	for next < numValid {
+		x := r.Float64()
+		switch {
+		case x < invalidRate && numInvalid > 0:
+			ops = append(ops, chaosOp{chaosInvalid, invalid % numInvalid})
+			invalid++
+		case x >= invalidRate && x < invalidRate+deleteRate && len(applied) > 0:
+			i := r.Intn(len(applied))
+			ops = append(ops, chaosOp{chaosDelete, applied[i]})
+			applied = append(applied[:i], applied[i+1:]...)
+		default:
+			ops = append(ops, chaosOp{chaosApply, next})
+			applied = append(applied, next)
+			next++
+		}
+	}
+	sort.Ints(applied)
+	return ops, applied
+}
+
+// istiodRestarts returns the restart counts of the containers of the istiod pods by pod.
+func istiodRestarts(ctx context.Context, namespace string) (map[string]int, error) {
+	out, err := kubectl(ctx, nil, "-n", namespace, "get", "pods", "-l", "app=istiod", "-o",
+		`jsonpath={range .items[*]}{.metadata.name}{"\t"}{.status.containerStatuses[*].restartCount}{"\n"}{end}`)
+	if err != nil {
+		return nil, err
+	}
+	restarts := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		restarts[fields[0]] = 0
+		for _, f := range fields[1:] {
+			n, err := strconv.Atoi(f)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected restart count %q of %s", f, fields[0])
+			}
+			restarts[fields[0]] += n
+		}
+	}
+	return restarts, nil
+}
+
+// restartsBetween returns the container restarts of the pods between two restart counts, a pod
+// replacing another one counting as a restart.
+func restartsBetween(before, after map[string]int) int {
+	restarts := 0
+	for pod, n := range after {
+		if b, ok := before[pod]; ok {
+			restarts += n - b
+		} else {
+			restarts += n + 1
+		}
+	}
+	return restarts
+}
+
+func (r *ChaosResult) print(w io.Writer) {
+	fmt.Fprintf(w, "%d operations: %d applied, %d deleted, %d invalid rejected, %d invalid admitted, %d failed\n",
+		r.Ops, r.Applied, r.Deleted, r.Rejected, r.Admitted, r.ApplyErrors)
+	convergence := fmt.Sprintf("%.1fs", r.ConvergenceSeconds)
+	if !r.Converged {
+		convergence = ">" + convergence
+	}
+	fmt.Fprintf(w, "istiod: %d restarts, %.0f xDS rejects, converged after %s\n", r.IstiodRestarts, r.XDSRejects, convergence)
+	fmt.Fprintf(w, "cluster: %d policies missing, %d extra, %d modified\n", r.Missing, r.Extra, r.Modified)
+	if r.Stable() {
+		fmt.Fprintln(w, "stable")
+	} else {
+		fmt.Fprintln(w, "NOT stable")
+	}
+}
+
+func runChaos(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("chaos", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the generated policies")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	policyFile := fs.String("policyFile", "", "A YAML file of policies to apply instead of the generated ones")
+	invalidRate := fs.Float64("invalidRate", 0.2, "The share of the operations applying a policy the admission webhook must reject")
+	deleteRate := fs.Float64("deleteRate", 0.1, "The share of the operations deleting a random applied policy")
+	seed := fs.Int64("seed", 1, "The seed of the operations, the same seed runs the same operations")
+	interval := fs.Duration("interval", 0, "The time waited between two operations")
+	istioNamespace := fs.String("istioNamespace", "istio-system", "The namespace istiod runs in")
+	pollInterval := fs.Duration("pollInterval", time.Second, "The interval between scrapes of the istiod metrics")
+	quietPeriod := fs.Duration("quietPeriod", 10*time.Second, "The time without pushes after which istiod has converged")
+	timeout := fs.Duration("timeout", 10*time.Minute, "The maximum time waited for istiod to converge")
+	keep := fs.Bool("keep", false, "Keep the policies in the cluster at the end of the run")
+	outDir := fs.String("outDir", "run", "The directory the run report is written to")
+	_ = fs.Parse(args)
+
+	if *invalidRate < 0 || *deleteRate < 0 || *invalidRate+*deleteRate >= 1 {
+		return fmt.Errorf("invalid rates: invalidRate %v and deleteRate %v must not be negative and sum to less than 1", *invalidRate, *deleteRate)
+	}
+	docs, err := loadPolicyDocuments(ctx, *scenarioName, *configFile, *policyFile)
+	if err != nil {
+		return err
+	}
+	policies, err := parsePolicyObjects(docs)
+	if err != nil {
+		return err
+	}
+	if len(policies) == 0 {
+		return fmt.Errorf("no policies to apply")
+	}
+	invalid, err := generateNegativePolicies(policies[0].Namespace, 1)
+	if err != nil {
+		return err
+	}
+	ops, expected := chaosPlan(rand.New(rand.NewSource(*seed)), len(docs), len(invalid), *invalidRate, *deleteRate)
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+
+	m, err := newIstiodMetrics(ctx, *istioNamespace, "app=istiod")
+	if err != nil {
+		return err
+	}
+	defer m.close()
+	before, err := m.scrape(ctx)
+	if err != nil {
+		return err
+	}
+	restartsBefore, err := istiodRestarts(ctx, *istioNamespace)
+	if err != nil {
+		return err
+	}
+
+	report := newRunReport("chaos", *configFile, fs)
+	result := &ChaosResult{}
+	report.Chaos = result
+	if !*keep {
+		defer func() {
+			// Delete the policies even when interrupted, so that the cluster is left clean.
+			all := append([]string{}, docs...)
+			for _, p := range invalid {
+				all = append(all, p.doc)
+			}
+			_, cleanupSpan := startSpan(ctx, "cleanup")
+			_, err := kubectl(context.Background(), strings.NewReader(strings.Join(all, "---\n")), "delete", "--ignore-not-found", "-f", "-")
+			cleanupSpan.end(err)
+			if err != nil {
+				log.Printf("failed to delete the policies: %v", err)
+			}
+		}()
+	}
+
+	_, applySpan := startSpan(ctx, "apply")
+	applySpan.setAttribute("ops", len(ops))
+	for i, op := range ops {
+		if ctx.Err() != nil {
+			break
+		}
+		if i > 0 && *interval > 0 {
+			select {
+			case <-time.After(*interval):
+			case <-ctx.Done():
+			}
+		}
+		var err error
+		switch op.kind {
+		case chaosApply:
+			if err = kubectlApply(ctx, []string{docs[op.index]}); err == nil {
+				result.Applied++
+				report.PoliciesApplied++
+			}
+		case chaosDelete:
+			if _, err = kubectl(ctx, strings.NewReader(docs[op.index]), "delete", "-f", "-"); err == nil {
+				result.Deleted++
+			}
+		case chaosInvalid:
+			p := invalid[op.index]
+			if kubectlApply(ctx, []string{p.doc}) == nil {
+				result.Admitted++
+				report.Errors = append(report.Errors, fmt.Sprintf("invalid policy %s/%s admitted, expected: %s", p.Namespace, p.Name, p.Error))
+			} else {
+				result.Rejected++
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		result.Ops++
+		if err != nil {
+			result.ApplyErrors++
+			report.Errors = append(report.Errors, fmt.Sprintf("%s of policy %d: %v", op.kind, op.index, err))
+		}
+	}
+	applySpan.end(nil)
+	last := time.Now()
+
+	if ctx.Err() == nil {
+		err = inSpan(ctx, "wait", func(ctx context.Context) error {
+			r := &abRevision{metrics: m, before: before}
+			if err := waitConvergence(ctx, []*abRevision{r}, last, *pollInterval, *quietPeriod, *timeout); err != nil {
+				return err
+			}
+			result.ConvergenceSeconds, result.Converged = r.result.ConvergenceSeconds, r.result.Converged
+			after, err := m.scrape(ctx)
+			if err != nil {
+				return err
+			}
+			result.XDSRejects = after.counter("pilot_total_xds_rejects") - before.counter("pilot_total_xds_rejects")
+			restartsAfter, err := istiodRestarts(ctx, *istioNamespace)
+			if err != nil {
+				return err
+			}
+			result.IstiodRestarts = restartsBetween(restartsBefore, restartsAfter)
+
+			var expectedDocs []string
+			for _, i := range expected {
+				expectedDocs = append(expectedDocs, docs[i])
+			}
+			manifest, err := parsePolicyObjects(expectedDocs)
+			if err != nil {
+				return err
+			}
+			live, err := importPolicies(ctx, "")
+			if err != nil {
+				return err
+			}
+			d := detectDrift(manifest, live, false)
+			result.Missing, result.Extra, result.Modified = len(d.missing), len(d.extra), len(d.modified)
+			return nil
+		})
+		if err != nil && ctx.Err() == nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+	if ctx.Err() != nil {
+		report.Interrupted = true
+		report.Errors = append(report.Errors, fmt.Sprintf("interrupted after %d of %d operations", result.Ops, len(ops)))
+	} else {
+		result.print(os.Stdout)
+		if !result.Stable() {
+			err = fmt.Errorf("istiod is not stable under the chaos of %d operations", result.Ops)
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+	report.EndTime = time.Now()
+	if writeErr := writeRunReport(*outDir, report); writeErr != nil {
+		return writeErr
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestChaosPlan(t *testing.T) {
+	ops, expected := chaosPlan(rand.New(rand.NewSource(1)), 200, 13, 0.2, 0.1)
+	applied := map[int]bool{}
+	counts := map[string]int{}
+	for _, op := range ops {
+		counts[op.kind]++
+		switch op.kind {
+		case chaosApply:
+			if applied[op.index] {
+				t.Fatalf("policy %d applied twice", op.index)
+			}
+			applied[op.index] = true
+		case chaosDelete:
+			if !applied[op.index] {
+				t.Fatalf("policy %d deleted while not applied", op.index)
+			}
+			delete(applied, op.index)
+		case chaosInvalid:
+			if op.index >= 13 {
+				t.Fatalf("invalid policy %d out of range", op.index)
+			}
+		}
+	}
+	if counts[chaosApply] != 200 || counts[chaosInvalid] == 0 || counts[chaosDelete] == 0 {
+		t.Errorf("got operations %v, want 200 applies with invalid applies and deletes", counts)
+	}
+	if len(expected) != len(applied) {
+		t.Fatalf("got %d expected policies, %d applied", len(expected), len(applied))
+	}
+	for _, i := range expected {
+		if !applied[i] {
+			t.Errorf("policy %d expected but deleted", i)
+		}
+	}
+
+	again, _ := chaosPlan(rand.New(rand.NewSource(1)), 200, 13, 0.2, 0.1)
+	if !reflect.DeepEqual(ops, again) {
+		t.Error("the same seed planned other operations")
+	}
+	if ops, expected := chaosPlan(rand.New(rand.NewSource(1)), 5, 0, 0.5, 0); len(ops) != 5 || len(expected) != 5 {
+		t.Errorf("got %d operations, %d expected without invalid policies, want 5 applies", len(ops), len(expected))
+	}
+}
+
+func TestRestartsBetween(t *testing.T) {
+	before := map[string]int{"istiod-a": 1, "istiod-b": 0}
+	after := map[string]int{"istiod-a": 3, "istiod-c": 0}
+	// 2 restarts of istiod-a and istiod-b replaced by istiod-c.
+	if got := restartsBetween(before, after); got != 3 {
+		t.Errorf("got %d restarts, want 3", got)
+	}
+	if got := restartsBetween(before, before); got != 0 {
+		t.Errorf("got %d restarts of the same pods, want 0", got)
+	}
+
+	r := &ChaosResult{Ops: 10, Applied: 7, Rejected: 3, Converged: true}
+	if !r.Stable() {
+		t.Error("got a converged run without errors not stable")
+	}
+	r.Extra = 1
+	if r.Stable() {
+		t.Error("got a run with an extra policy stable")
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+// The labels Cilium sets on the identity of an endpoint to its namespace and service account.
+const (
+	ciliumNamespaceLabel      = "io.kubernetes.pod.namespace"
+	ciliumServiceAccountLabel = "io.cilium.k8s.policy.serviceaccount"
+)
+
+// ciliumPolicy is a cilium.io/v2 CiliumNetworkPolicy, or a CiliumClusterwideNetworkPolicy
+// without a namespace.
+type ciliumPolicy struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Metadata   ciliumPolicyMeta `json:"metadata"`
+	Spec       ciliumPolicySpec `json:"spec"`
+}
+
+type ciliumPolicyMeta struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type ciliumPolicySpec struct {
+	EndpointSelector labelSelector       `json:"endpointSelector"`
+	Ingress          []ciliumIngressRule `json:"ingress,omitempty"`
+	IngressDeny      []ciliumIngressRule `json:"ingressDeny,omitempty"`
+	// EnableDefaultDeny keeps the endpoints selected by DENY policies in their default allow
+	// mode, as in Istio.
+	EnableDefaultDeny *ciliumDefaultDeny `json:"enableDefaultDeny,omitempty"`
+}
+
+type ciliumDefaultDeny struct {
+	Ingress bool `json:"ingress"`
+}
+
+type ciliumIngressRule struct {
+	FromEndpoints []labelSelector  `json:"fromEndpoints,omitempty"`
+	FromCIDR      []string         `json:"fromCIDR,omitempty"`
+	FromEntities  []string         `json:"fromEntities,omitempty"`
+	ToPorts       []ciliumPortRule `json:"toPorts,omitempty"`
+}
+
+type ciliumPortRule struct {
+	Ports []ciliumPort   `json:"ports"`
+	Rules *ciliumL7Rules `json:"rules,omitempty"`
+}
+
+type ciliumPort struct {
+	Port     string `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+type ciliumL7Rules struct {
+	HTTP []ciliumHTTPRule `json:"http"`
+}
+
+type ciliumHTTPRule struct {
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Host   string `json:"host,omitempty"`
+}
+
+// ciliumConversion counts what toCiliumPolicies could not convert exactly.
+type ciliumConversion struct {
+	// skipped are the AUDIT and CUSTOM policies, and the DENY policies left without rules.
+	skipped int
+	// approximated are the ALLOW rules whose Cilium rules allow more than them.
+	approximated int
+	// dropped are the DENY rules Cilium cannot express, which are not converted.
+	dropped int
+}
+
+// toCiliumPolicies returns the Cilium policies closest to the AuthorizationPolicies: a
+// CiliumNetworkPolicy for every ALLOW and DENY policy, a CiliumClusterwideNetworkPolicy for the
+// policies of the root namespace. Every clause of a rule, see ruleClauses, becomes an ingress rule
+// with the L7 HTTP rules of its methods, paths and hosts when it has ports. The constraints Cilium
+// cannot express are dropped from the ALLOW rules, which then allow more, and make Cilium skip
+// the DENY rules, which deny no L7 attribute.
+func toCiliumPolicies(policies []parsedAuthorizationPolicy, rootNamespace string) ([]ciliumPolicy, ciliumConversion) {
+	var conversion ciliumConversion
+	var out []ciliumPolicy
+	for _, p := range policies {
+		deny := p.Spec.Action == authzpb.AuthorizationPolicy_DENY
+		if !deny && p.Spec.Action != authzpb.AuthorizationPolicy_ALLOW {
+			conversion.skipped++
+			continue
+		}
+		cp := ciliumPolicy{
+			APIVersion: "cilium.io/v2",
+			Kind:       "CiliumNetworkPolicy",
+			Metadata:   ciliumPolicyMeta{Name: p.Name, Namespace: p.Namespace},
+			Spec:       ciliumPolicySpec{EndpointSelector: labelSelector{MatchLabels: p.Spec.GetSelector().GetMatchLabels()}},
+		}
+		if p.Namespace == rootNamespace {
+			cp.Kind = "CiliumClusterwideNetworkPolicy"
+			cp.Metadata.Namespace = ""
+		}
+		for _, rule := range p.Spec.Rules {
+			approximated := false
+			for _, c := range ruleClauses(rule) {
+				ingress, exact := ciliumIngressRuleOf(c, deny)
+				switch {
+				case !deny:
+					cp.Spec.Ingress = append(cp.Spec.Ingress, ingress)
+				case exact:
+					cp.Spec.IngressDeny = append(cp.Spec.IngressDeny, ingress)
+				}
+				approximated = approximated || !exact
+			}
+			switch {
+			case approximated && deny:
+				conversion.dropped++
+			case approximated:
+				conversion.approximated++
+			}
+		}
+		if deny {
+			if len(cp.Spec.IngressDeny) == 0 {
+				conversion.skipped++
+				continue
+			}
+			cp.Spec.EnableDefaultDeny = &ciliumDefaultDeny{}
+		} else if len(cp.Spec.Ingress) == 0 {
+			// An empty rule denies every request not allowed by another policy, like the
+			// allow-nothing AuthorizationPolicy.
+			cp.Spec.Ingress = []ciliumIngressRule{{}}
+		}
+		out = append(out, cp)
+	}
+	return out, conversion
+}
+
+// ciliumIngressRuleOf returns the ingress rule matching the requests of c, and whether it
+// matches exactly them. The rules of DENY policies cannot match L7 attributes.
+func ciliumIngressRuleOf(c clause, deny bool) (ciliumIngressRule, bool) {
+	var ingress ciliumIngressRule
+	exact := true
+	// The L3 selectors of a Cilium rule cannot be combined, so a single source attribute is
+	// converted, the most precise one.
+	first := map[string]int{}
+	for i := range c {
+		if _, ok := first[c[i].attribute]; !ok && !c[i].not {
+			first[c[i].attribute] = i
+		}
+	}
+	source := -1
+	for _, attribute := range []string{"source.ip", "source.principal", "source.namespace"} {
+		if i, ok := first[attribute]; ok && source < 0 {
+			source = i
+		}
+	}
+	var ports []ciliumPort
+	var methods, paths, hosts []string
+	for i := range c {
+		switch attribute := c[i].attribute; {
+		case i == source:
+			for _, value := range c[i].values {
+				exact = ingress.addSource(attribute, value) && exact
+			}
+		case c[i].not || i != first[attribute]:
+			exact = false
+		case attribute == "destination.port":
+			for _, value := range c[i].values {
+				if _, err := strconv.Atoi(value); err != nil {
+					ports, exact = nil, false
+					break
+				}
+				ports = append(ports, ciliumPort{Port: value, Protocol: "TCP"})
+			}
+		case attribute == "request.method":
+			methods = c[i].values
+		case attribute == "request.path":
+			paths = c[i].values
+		case attribute == "request.host":
+			hosts = c[i].values
+		default:
+			exact = false
+		}
+	}
+	if source < 0 {
+		ingress.FromEntities = []string{"all"}
+	}
+	http := len(methods) > 0 || len(paths) > 0 || len(hosts) > 0
+	if http && (deny || len(ports) == 0) {
+		// Cilium matches L7 attributes on the ports of the ALLOW rules only.
+		http, exact = false, false
+	}
+	if len(ports) > 0 {
+		portRule := ciliumPortRule{Ports: ports}
+		if http {
+			portRule.Rules = &ciliumL7Rules{HTTP: ciliumHTTPRules(methods, paths, hosts)}
+		}
+		ingress.ToPorts = []ciliumPortRule{portRule}
+	}
+	return ingress, exact
+}
+
+// addSource adds the endpoints of the value of a source attribute to the rule, and returns
+// whether they are exactly the sources of the value.
+func (r *ciliumIngressRule) addSource(attribute, value string) bool {
+	anyNamespace := labelSelector{MatchExpressions: []labelSelectorRequirement{{Key: ciliumNamespaceLabel, Operator: "Exists"}}}
+	switch attribute {
+	case "source.ip":
+		if network := parseIPBlock(value); network != nil {
+			r.FromCIDR = append(r.FromCIDR, network.String())
+			return true
+		}
+		r.FromEntities = []string{"all"}
+		return false
+	case "source.namespace":
+		if strings.Contains(value, "*") {
+			r.FromEndpoints = append(r.FromEndpoints, anyNamespace)
+			return value == "*"
+		}
+		r.FromEndpoints = append(r.FromEndpoints, labelSelector{MatchLabels: map[string]string{ciliumNamespaceLabel: value}})
+		return true
+	default:
+		// Principals are <trust domain>/ns/<namespace>/sa/<service account>, the labels of the
+		// identity of their endpoints.
+		parts := strings.Split(value, "/")
+		if len(parts) != 5 || parts[1] != "ns" || parts[3] != "sa" || strings.Contains(value, "*") {
+			r.FromEndpoints = append(r.FromEndpoints, anyNamespace)
+			return value == "*"
+		}
+		r.FromEndpoints = append(r.FromEndpoints, labelSelector{MatchLabels: map[string]string{
+			ciliumNamespaceLabel:      parts[2],
+			ciliumServiceAccountLabel: parts[4],
+		}})
+		return true
+	}
+}
+
+// ciliumHTTPRules returns the HTTP rules matching one of the methods, one of the paths and one
+// of the hosts. Every Cilium HTTP rule matches a single value of each.
+func ciliumHTTPRules(methods, paths, hosts []string) []ciliumHTTPRule {
+	if len(methods) == 0 {
+		methods = []string{""}
+	}
+	if len(paths) == 0 {
+		paths = []string{""}
+	}
+	if len(hosts) == 0 {
+		hosts = []string{""}
+	}
+	var rules []ciliumHTTPRule
+	for _, method := range methods {
+		for _, path := range paths {
+			for _, host := range hosts {
+				rules = append(rules, ciliumHTTPRule{Method: method, Path: ciliumRegexp(path), Host: ciliumRegexp(host)})
+			}
+		}
+	}
+	return rules
+}
+
+// ciliumRegexp returns the regular expression Cilium matches the paths and hosts with, for an
+// exact, prefix, suffix or presence pattern. A presence pattern matches every value and needs no
+// expression.
+func ciliumRegexp(pattern string) string {
+	switch {
+	case pattern == "*":
+		return ""
+	case strings.HasSuffix(pattern, "*"):
+		return regexp.QuoteMeta(strings.TrimSuffix(pattern, "*")) + ".*"
+	case strings.HasPrefix(pattern, "*"):
+		return ".*" + regexp.QuoteMeta(strings.TrimPrefix(pattern, "*"))
+	default:
+		return regexp.QuoteMeta(pattern)
+	}
+}
+
+// ciliumPoliciesYAML returns the YAML documents of the Cilium policies converted from the
+// AuthorizationPolicies of docs, and a summary of the conversion.
+func ciliumPoliciesYAML(docs []string, rootNamespace string) ([]string, string, error) {
+	policies, err := parseAuthorizationPolicies(docs)
+	if err != nil {
+		return nil, "", err
+	}
+	converted, conversion := toCiliumPolicies(policies, rootNamespace)
+	out := make([]string, len(converted))
+	for i, cp := range converted {
+		doc, err := yaml.Marshal(cp)
+		if err != nil {
+			return nil, "", err
+		}
+		out[i] = string(doc)
+	}
+	summary := fmt.Sprintf("converted %d of %d AuthorizationPolicies to Cilium policies, skipped %d without an equivalent, %d ALLOW rules allow more than the original ones, %d DENY rules are not converted",
+		len(converted), len(policies), conversion.skipped, conversion.approximated, conversion.dropped)
+	return out, summary, nil
+}
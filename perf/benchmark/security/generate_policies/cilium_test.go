@@ -0,0 +1,123 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCiliumPoliciesYAML(t *testing.T) {
+	docs := splitYAMLDocuments(`
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: allow
+  namespace: ns
+spec:
+  selector:
+    matchLabels:
+      app: a
+  rules:
+  - from:
+    - source:
+        principals: ["cluster.local/ns/other/sa/sleep"]
+    to:
+    - operation:
+        ports: ["8080"]
+        methods: ["GET", "POST"]
+        paths: ["/api/*"]
+  # Cilium matches L7 attributes only on ports.
+  - to:
+    - operation:
+        paths: ["/health"]
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: deny
+  namespace: istio-system
+spec:
+  action: DENY
+  rules:
+  - from:
+    - source:
+        ipBlocks: ["10.0.0.0/8"]
+  # Cilium denies no L7 attribute.
+  - to:
+    - operation:
+        paths: ["/admin"]
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: custom
+  namespace: ns
+spec:
+  action: CUSTOM
+  provider:
+    name: ext-authz
+  rules:
+  - {}
+`)
+	got, summary, err := ciliumPoliciesYAML(docs, "istio-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: allow
+  namespace: ns
+spec:
+  endpointSelector:
+    matchLabels:
+      app: a
+  ingress:
+  - fromEndpoints:
+    - matchLabels:
+        io.cilium.k8s.policy.serviceaccount: sleep
+        io.kubernetes.pod.namespace: other
+    toPorts:
+    - ports:
+      - port: "8080"
+        protocol: TCP
+      rules:
+        http:
+        - method: GET
+          path: /api/.*
+        - method: POST
+          path: /api/.*
+  - fromEntities:
+    - all
+`, `apiVersion: cilium.io/v2
+kind: CiliumClusterwideNetworkPolicy
+metadata:
+  name: deny
+spec:
+  enableDefaultDeny:
+    ingress: false
+  endpointSelector: {}
+  ingressDeny:
+  - fromCIDR:
+    - 10.0.0.0/8
+`}
+	if strings.Join(got, "---\n") != strings.Join(want, "---\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "---\n"), strings.Join(want, "---\n"))
+	}
+	if wantSummary := "converted 2 of 3 AuthorizationPolicies to Cilium policies, skipped 1 without an equivalent, 1 ALLOW rules allow more than the original ones, 1 DENY rules are not converted"; summary != wantSummary {
+		t.Errorf("got summary %q, want %q", summary, wantSummary)
+	}
+}
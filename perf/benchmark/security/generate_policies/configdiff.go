@@ -0,0 +1,544 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// rbacPolicyRegexp matches the names istiod gives the policies of the RBAC filters, one per rule
+// of an AuthorizationPolicy.
+var rbacPolicyRegexp = regexp.MustCompile(`^ns\[(.+)\]-policy\[(.+)\]-rule\[\d+\]$`)
+
+// ConfigDiffResult is the growth of the listeners and routes of a proxy with a corpus applied.
+type ConfigDiffResult struct {
+	Pod             string `json:"pod"`
+	PoliciesApplied int    `json:"policiesApplied"`
+	// BytesBefore and BytesAfter are the bytes of the listeners and routes of the config dump.
+	BytesBefore int `json:"bytesBefore"`
+	BytesAfter  int `json:"bytesAfter"`
+	// BytesPerPolicy is the growth of the listeners and routes divided by the policies applied.
+	BytesPerPolicy float64 `json:"bytesPerPolicy"`
+	// Listeners and Routes are the listeners and routes which changed, by decreasing growth.
+	Listeners []ListenerDiff `json:"listeners"`
+	Routes    []RouteDiff    `json:"routes,omitempty"`
+	// Policies are the AuthorizationPolicies found in the RBAC filters of the proxy after the
+	// apply, by decreasing bytes.
+	Policies []PolicyConfigCost `json:"policies,omitempty"`
+}
+
+// ListenerDiff is the change of a listener between the two config dumps.
+type ListenerDiff struct {
+	Name        string `json:"name"`
+	Added       bool   `json:"added,omitempty"`
+	Removed     bool   `json:"removed,omitempty"`
+	BytesBefore int    `json:"bytesBefore"`
+	BytesAfter  int    `json:"bytesAfter"`
+	BytesGrown  int    `json:"bytesGrown"`
+	// FiltersAdded and FiltersRemoved are the network and HTTP filters, by name, added to or
+	// removed from the filter chains of the listener.
+	FiltersAdded   map[string]int `json:"filtersAdded,omitempty"`
+	FiltersRemoved map[string]int `json:"filtersRemoved,omitempty"`
+	// RBACPoliciesAdded and RBACPoliciesRemoved are the policies of its RBAC filters.
+	RBACPoliciesAdded   []string `json:"rbacPoliciesAdded,omitempty"`
+	RBACPoliciesRemoved []string `json:"rbacPoliciesRemoved,omitempty"`
+}
+
+// RouteDiff is the change of a route configuration between the two config dumps.
+type RouteDiff struct {
+	Name        string `json:"name"`
+	BytesBefore int    `json:"bytesBefore"`
+	BytesAfter  int    `json:"bytesAfter"`
+	BytesGrown  int    `json:"bytesGrown"`
+}
+
+// PolicyConfigCost is the config an AuthorizationPolicy costs a proxy: the bytes of the RBAC
+// policies of its rules, summed over the filters of the listeners they are in.
+type PolicyConfigCost struct {
+	// Name is <namespace>/<name> of the AuthorizationPolicy.
+	Name      string `json:"name"`
+	Rules     int    `json:"rules"`
+	Listeners int    `json:"listeners"`
+	Bytes     int    `json:"bytes"`
+}
+
+// listenerConfig is the summary of a listener of a config dump.
+type listenerConfig struct {
+	bytes   int
+	filters map[string]int
+	// rbacPolicies are the bytes of the policies of the RBAC filters, by name.
+	rbacPolicies map[string]int
+}
+
+// configSummary is the summary of the listeners and routes of a config dump.
+type configSummary struct {
+	listeners map[string]listenerConfig
+	routes    map[string]int
+}
+
+func (s configSummary) bytes() int {
+	total := 0
+	for _, l := range s.listeners {
+		total += l.bytes
+	}
+	for _, r := range s.routes {
+		total += r
+	}
+	return total
+}
+
+// compactSize returns the size of the compact JSON of raw.
+func compactSize(raw json.RawMessage) int {
+	var b bytes.Buffer
+	if err := json.Compact(&b, raw); err != nil {
+		return len(raw)
+	}
+	return b.Len()
+}
+
+// summarizeConfigDump returns the summary of an Envoy /config_dump, of its static and dynamic
+// active listeners and route configurations.
+func summarizeConfigDump(data []byte) (configSummary, error) {
+	s := configSummary{listeners: map[string]listenerConfig{}, routes: map[string]int{}}
+	var dump struct {
+		Configs []struct {
+			StaticListeners []struct {
+				Listener json.RawMessage `json:"listener"`
+			} `json:"static_listeners"`
+			DynamicListeners []struct {
+				ActiveState *struct {
+					Listener json.RawMessage `json:"listener"`
+				} `json:"active_state"`
+			} `json:"dynamic_listeners"`
+			StaticRouteConfigs []struct {
+				RouteConfig json.RawMessage `json:"route_config"`
+			} `json:"static_route_configs"`
+			DynamicRouteConfigs []struct {
+				RouteConfig json.RawMessage `json:"route_config"`
+			} `json:"dynamic_route_configs"`
+		} `json:"configs"`
+	}
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return s, fmt.Errorf("invalid config dump: %v", err)
+	}
+	var listeners, routes []json.RawMessage
+	for _, c := range dump.Configs {
+		for _, l := range c.StaticListeners {
+			listeners = append(listeners, l.Listener)
+		}
+		for _, l := range c.DynamicListeners {
+			if l.ActiveState != nil {
+				listeners = append(listeners, l.ActiveState.Listener)
+			}
+		}
+		for _, r := range c.StaticRouteConfigs {
+			routes = append(routes, r.RouteConfig)
+		}
+		for _, r := range c.DynamicRouteConfigs {
+			routes = append(routes, r.RouteConfig)
+		}
+	}
+	for _, raw := range listeners {
+		name, l, err := summarizeListener(raw)
+		if err != nil {
+			return s, err
+		}
+		s.listeners[name] = l
+	}
+	for _, raw := range routes {
+		var route struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(raw, &route); err != nil {
+			return s, err
+		}
+		s.routes[route.Name] = compactSize(raw)
+	}
+	return s, nil
+}
+
+// envoyFilter is a network or HTTP filter of a listener.
+type envoyFilter struct {
+	Name        string `json:"name"`
+	TypedConfig struct {
+		HTTPFilters []envoyFilter `json:"http_filters"`
+		Rules       *struct {
+			Policies map[string]json.RawMessage `json:"policies"`
+		} `json:"rules"`
+		ShadowRules *struct {
+			Policies map[string]json.RawMessage `json:"policies"`
+		} `json:"shadow_rules"`
+	} `json:"typed_config"`
+}
+
+// summarizeListener returns the name and the summary of a listener of a config dump.
+func summarizeListener(raw json.RawMessage) (string, listenerConfig, error) {
+	l := listenerConfig{bytes: compactSize(raw), filters: map[string]int{}, rbacPolicies: map[string]int{}}
+	var listener struct {
+		Name         string `json:"name"`
+		FilterChains []struct {
+			Filters []envoyFilter `json:"filters"`
+		} `json:"filter_chains"`
+		DefaultFilterChain *struct {
+			Filters []envoyFilter `json:"filters"`
+		} `json:"default_filter_chain"`
+	}
+	if err := json.Unmarshal(raw, &listener); err != nil {
+		return "", l, err
+	}
+	var add func(f envoyFilter)
+	add = func(f envoyFilter) {
+		l.filters[f.Name]++
+		for _, rules := range []*struct {
+			Policies map[string]json.RawMessage `json:"policies"`
+		}{f.TypedConfig.Rules, f.TypedConfig.ShadowRules} {
+			if rules == nil {
+				continue
+			}
+			for name, policy := range rules.Policies {
+				l.rbacPolicies[name] += compactSize(policy)
+			}
+		}
+		for _, h := range f.TypedConfig.HTTPFilters {
+			add(h)
+		}
+	}
+	chains := listener.FilterChains
+	if listener.DefaultFilterChain != nil {
+		chains = append(chains, *listener.DefaultFilterChain)
+	}
+	for _, c := range chains {
+		for _, f := range c.Filters {
+			add(f)
+		}
+	}
+	return listener.Name, l, nil
+}
+
+// countDelta returns the positive and the negative differences of the counts of after and before.
+func countDelta(before, after map[string]int) (map[string]int, map[string]int) {
+	added, removed := map[string]int{}, map[string]int{}
+	for name, n := range after {
+		if d := n - before[name]; d > 0 {
+			added[name] = d
+		}
+	}
+	for name, n := range before {
+		if d := n - after[name]; d > 0 {
+			removed[name] = d
+		}
+	}
+	if len(added) == 0 {
+		added = nil
+	}
+	if len(removed) == 0 {
+		removed = nil
+	}
+	return added, removed
+}
+
+// keysDelta returns the sorted keys of after missing from before, and of before missing from after.
+func keysDelta(before, after map[string]int) ([]string, []string) {
+	var added, removed []string
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			added = append(added, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// diffConfigs returns the changes of the listeners and routes from before to after, and the config
+// cost of the AuthorizationPolicies of after.
+func diffConfigs(before, after configSummary, policiesApplied int) *ConfigDiffResult {
+	r := &ConfigDiffResult{PoliciesApplied: policiesApplied, BytesBefore: before.bytes(), BytesAfter: after.bytes()}
+	if policiesApplied > 0 {
+		r.BytesPerPolicy = float64(r.BytesAfter-r.BytesBefore) / float64(policiesApplied)
+	}
+	names := map[string]bool{}
+	for name := range before.listeners {
+		names[name] = true
+	}
+	for name := range after.listeners {
+		names[name] = true
+	}
+	for name := range names {
+		b, inBefore := before.listeners[name]
+		a, inAfter := after.listeners[name]
+		d := ListenerDiff{Name: name, Added: !inBefore, Removed: !inAfter, BytesBefore: b.bytes, BytesAfter: a.bytes, BytesGrown: a.bytes - b.bytes}
+		d.FiltersAdded, d.FiltersRemoved = countDelta(b.filters, a.filters)
+		d.RBACPoliciesAdded, d.RBACPoliciesRemoved = keysDelta(b.rbacPolicies, a.rbacPolicies)
+		if d.BytesGrown != 0 || d.Added || d.Removed || d.FiltersAdded != nil || d.FiltersRemoved != nil {
+			r.Listeners = append(r.Listeners, d)
+		}
+	}
+	sort.Slice(r.Listeners, func(i, j int) bool {
+		if r.Listeners[i].BytesGrown != r.Listeners[j].BytesGrown {
+			return r.Listeners[i].BytesGrown > r.Listeners[j].BytesGrown
+		}
+		return r.Listeners[i].Name < r.Listeners[j].Name
+	})
+
+	routes := map[string]bool{}
+	for name := range before.routes {
+		routes[name] = true
+	}
+	for name := range after.routes {
+		routes[name] = true
+	}
+	for name := range routes {
+		if d := (RouteDiff{Name: name, BytesBefore: before.routes[name], BytesAfter: after.routes[name]}); d.BytesBefore != d.BytesAfter {
+			d.BytesGrown = d.BytesAfter - d.BytesBefore
+			r.Routes = append(r.Routes, d)
+		}
+	}
+	sort.Slice(r.Routes, func(i, j int) bool {
+		if r.Routes[i].BytesGrown != r.Routes[j].BytesGrown {
+			return r.Routes[i].BytesGrown > r.Routes[j].BytesGrown
+		}
+		return r.Routes[i].Name < r.Routes[j].Name
+	})
+
+	costs := map[string]*PolicyConfigCost{}
+	rules := map[string]map[string]bool{}
+	for _, l := range after.listeners {
+		seen := map[string]bool{}
+		for rule, size := range l.rbacPolicies {
+			name := rule
+			if m := rbacPolicyRegexp.FindStringSubmatch(rule); m != nil {
+				name = m[1] + "/" + m[2]
+			}
+			c := costs[name]
+			if c == nil {
+				c = &PolicyConfigCost{Name: name}
+				costs[name] = c
+				rules[name] = map[string]bool{}
+			}
+			c.Bytes += size
+			rules[name][rule] = true
+			if !seen[name] {
+				seen[name] = true
+				c.Listeners++
+			}
+		}
+	}
+	for name, c := range costs {
+		c.Rules = len(rules[name])
+		r.Policies = append(r.Policies, *c)
+	}
+	sort.Slice(r.Policies, func(i, j int) bool {
+		if r.Policies[i].Bytes != r.Policies[j].Bytes {
+			return r.Policies[i].Bytes > r.Policies[j].Bytes
+		}
+		return r.Policies[i].Name < r.Policies[j].Name
+	})
+	return r
+}
+
+// print writes the growth of the config and the top listeners, routes and policies.
+func (r *ConfigDiffResult) print(w io.Writer, top int) error {
+	fmt.Fprintf(w, "%s: %d bytes of listeners and routes before, %d after, %+d (%.0f per policy applied)\n",
+		r.Pod, r.BytesBefore, r.BytesAfter, r.BytesAfter-r.BytesBefore, r.BytesPerPolicy)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "listener\tbytes before\tbytes after\tgrown\tfilters added\t")
+	for i, l := range r.Listeners {
+		if i == top {
+			break
+		}
+		var filters []string
+		for name, n := range l.FiltersAdded {
+			filters = append(filters, fmt.Sprintf("%s x%d", name, n))
+		}
+		sort.Strings(filters)
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%+d\t%s\t\n", l.Name, l.BytesBefore, l.BytesAfter, l.BytesGrown, strings.Join(filters, ", "))
+	}
+	fmt.Fprintln(tw, "route\tbytes before\tbytes after\tgrown\t\t")
+	for i, rt := range r.Routes {
+		if i == top {
+			break
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%+d\t\t\n", rt.Name, rt.BytesBefore, rt.BytesAfter, rt.BytesGrown)
+	}
+	fmt.Fprintln(tw, "policy\trules\tlisteners\tbytes\t\t")
+	for i, p := range r.Policies {
+		if i == top {
+			break
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t\t\n", p.Name, p.Rules, p.Listeners, p.Bytes)
+	}
+	return tw.Flush()
+}
+
+// configDump returns the config dump of the istio-proxy container of pod.
+func configDump(ctx context.Context, namespace, pod string) ([]byte, error) {
+	return kubectl(ctx, nil, "-n", namespace, "exec", pod, "-c", "istio-proxy", "--",
+		"pilot-agent", "request", "GET", "config_dump")
+}
+
+// waitConfigChange polls the config dump of pod until its summary differs from before and then
+// stays the same for quietPeriod, and returns the last dump. On timeout, e.g. when the corpus does
+// not apply to the proxy, it returns the last dump with an error.
+func waitConfigChange(ctx context.Context, namespace, pod string, before configSummary, pollInterval, quietPeriod, timeout time.Duration) ([]byte, configSummary, error) {
+	deadline := time.Now().Add(timeout)
+	var last []byte
+	summary := before
+	var changedAt time.Time
+	for {
+		data, err := configDump(ctx, namespace, pod)
+		if err != nil {
+			return last, summary, err
+		}
+		s, err := summarizeConfigDump(data)
+		if err != nil {
+			return last, summary, err
+		}
+		if !reflect.DeepEqual(s, summary) {
+			changedAt = time.Now()
+		} else if !changedAt.IsZero() && time.Since(changedAt) >= quietPeriod {
+			return data, s, nil
+		}
+		last, summary = data, s
+		if time.Now().After(deadline) {
+			return last, summary, fmt.Errorf("the config of %s did not settle within %v", pod, timeout)
+		}
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			return last, summary, ctx.Err()
+		}
+	}
+}
+
+func runConfigDiff(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("config-diff", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the generated policies")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	policyFile := fs.String("policyFile", "", "A YAML file of policies to apply instead of the generated ones")
+	namespace := fs.String("namespace", "twopods-istio", "The namespace of the proxy")
+	selector := fs.String("selector", "app=fortioserver", "The label selector of the pod of the proxy, its first pod is used")
+	beforeFile := fs.String("before", "", "A config dump saved before the apply, diffed with -after without a cluster")
+	afterFile := fs.String("after", "", "A config dump saved after the apply, diffed with -before without a cluster")
+	pollInterval := fs.Duration("pollInterval", 2*time.Second, "The interval between two config dumps while waiting for the proxy to receive the corpus")
+	quietPeriod := fs.Duration("quietPeriod", 10*time.Second, "The time without config change after which the proxy has received the corpus")
+	timeout := fs.Duration("timeout", 5*time.Minute, "The maximum time waited for the proxy to receive the corpus")
+	top := fs.Int("top", 10, "The number of listeners, routes and policies printed")
+	keep := fs.Bool("keep", false, "Keep the policies in the cluster at the end of the run")
+	outDir := fs.String("outDir", "run", "The directory the config dumps and the run report are written to")
+	_ = fs.Parse(args)
+
+	if (*beforeFile == "") != (*afterFile == "") {
+		return fmt.Errorf("-before and -after must be set together")
+	}
+	if *beforeFile != "" {
+		var summaries []configSummary
+		for _, file := range []string{*beforeFile, *afterFile} {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			s, err := summarizeConfigDump(data)
+			if err != nil {
+				return fmt.Errorf("%s: %v", file, err)
+			}
+			summaries = append(summaries, s)
+		}
+		result := diffConfigs(summaries[0], summaries[1], 0)
+		result.Pod = *afterFile
+		return result.print(os.Stdout, *top)
+	}
+
+	docs, err := loadPolicyDocuments(ctx, *scenarioName, *configFile, *policyFile)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+	pod, err := firstPod(ctx, *namespace, *selector)
+	if err != nil {
+		return err
+	}
+	beforeDump, err := configDump(ctx, *namespace, pod)
+	if err != nil {
+		return err
+	}
+	before, err := summarizeConfigDump(beforeDump)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(*outDir, "config_dump.before.json"), beforeDump, 0644); err != nil {
+		return err
+	}
+
+	report := newRunReport("config-diff", *configFile, fs)
+	if !*keep {
+		defer func() {
+			// Delete the policies even when interrupted, so that the cluster is left clean.
+			if _, err := kubectl(context.Background(), strings.NewReader(strings.Join(docs, "---\n")), "delete", "--ignore-not-found", "-f", "-"); err != nil {
+				log.Printf("failed to delete the policies: %v", err)
+			}
+		}()
+	}
+	if err := inSpan(ctx, "apply", func(ctx context.Context) error { return kubectlApply(ctx, docs) }); err != nil {
+		return err
+	}
+	report.PoliciesApplied = len(docs)
+
+	afterDump, after, err := waitConfigChange(ctx, *namespace, pod, before, *pollInterval, *quietPeriod, *timeout)
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	if afterDump != nil {
+		if writeErr := ioutil.WriteFile(filepath.Join(*outDir, "config_dump.after.json"), afterDump, 0644); writeErr != nil {
+			return writeErr
+		}
+		result := diffConfigs(before, after, len(docs))
+		result.Pod = pod
+		report.ConfigDiff = result
+		if printErr := result.print(os.Stdout, *top); printErr != nil {
+			return printErr
+		}
+	}
+	if ctx.Err() == context.Canceled {
+		report.Interrupted = true
+	}
+	report.EndTime = time.Now()
+	if writeErr := writeRunReport(*outDir, report); writeErr != nil {
+		return writeErr
+	}
+	return err
+}
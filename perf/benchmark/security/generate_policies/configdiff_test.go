@@ -0,0 +1,89 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testConfigDump returns a config dump with a virtualInbound listener whose HTTP connection
+// manager has an RBAC filter with rbac, and a route configuration inbound|8080.
+func testConfigDump(rbac string) string {
+	filters := `{"name": "envoy.filters.http.router"}`
+	if rbac != "" {
+		filters = `{"name": "envoy.filters.http.rbac", "typed_config": {"rules": {"policies": {` + rbac + `}}}}, ` + filters
+	}
+	return `{"configs": [
+  {"@type": "type.googleapis.com/envoy.admin.v3.ListenersConfigDump",
+   "static_listeners": [{"listener": {"name": "prometheus"}}],
+   "dynamic_listeners": [{"name": "virtualInbound", "active_state": {"listener": {"name": "virtualInbound",
+     "filter_chains": [{"filters": [{"name": "envoy.filters.network.http_connection_manager",
+       "typed_config": {"http_filters": [` + filters + `]}}]}]}}}]},
+  {"@type": "type.googleapis.com/envoy.admin.v3.RoutesConfigDump",
+   "dynamic_route_configs": [{"route_config": {"name": "inbound|8080", "virtual_hosts": []}}]}
+]}`
+}
+
+func TestDiffConfigs(t *testing.T) {
+	before, err := summarizeConfigDump([]byte(testConfigDump("")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(before.listeners) != 2 || len(before.routes) != 1 {
+		t.Fatalf("got %d listeners and %d routes, want 2 and 1", len(before.listeners), len(before.routes))
+	}
+	rule := `{"permissions": [{"any": true}], "principals": [{"any": true}]}`
+	after, err := summarizeConfigDump([]byte(testConfigDump(
+		`"ns[ns-1]-policy[a]-rule[0]": ` + rule + `, "ns[ns-1]-policy[a]-rule[1]": ` + rule + `, "ns[ns-1]-policy[b]-rule[0]": ` + rule)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := diffConfigs(before, after, 2)
+	if len(r.Listeners) != 1 || len(r.Routes) != 0 {
+		t.Fatalf("got %+v, want only virtualInbound changed", r)
+	}
+	l := r.Listeners[0]
+	if l.Name != "virtualInbound" || l.BytesGrown <= 0 || l.BytesGrown != r.BytesAfter-r.BytesBefore {
+		t.Errorf("got listener %+v, want virtualInbound grown by the growth of the config", l)
+	}
+	if !reflect.DeepEqual(l.FiltersAdded, map[string]int{"envoy.filters.http.rbac": 1}) || l.FiltersRemoved != nil {
+		t.Errorf("got filters added %v and removed %v, want the RBAC filter added", l.FiltersAdded, l.FiltersRemoved)
+	}
+	if len(l.RBACPoliciesAdded) != 3 {
+		t.Errorf("got RBAC policies added %v, want the 3 rules", l.RBACPoliciesAdded)
+	}
+	if r.BytesPerPolicy != float64(l.BytesGrown)/2 {
+		t.Errorf("got %v bytes per policy, want %v", r.BytesPerPolicy, float64(l.BytesGrown)/2)
+	}
+	want := []PolicyConfigCost{
+		{Name: "ns-1/a", Rules: 2, Listeners: 1, Bytes: 2 * len(`{"permissions":[{"any":true}],"principals":[{"any":true}]}`)},
+		{Name: "ns-1/b", Rules: 1, Listeners: 1, Bytes: len(`{"permissions":[{"any":true}],"principals":[{"any":true}]}`)},
+	}
+	if !reflect.DeepEqual(r.Policies, want) {
+		t.Errorf("got policies %+v, want %+v", r.Policies, want)
+	}
+
+	var out bytes.Buffer
+	if err := r.print(&out, 10); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "envoy.filters.http.rbac x1") {
+		t.Errorf("the diff does not print the filters added:\n%s", out.String())
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+// policyRule is a rule of a parsed AuthorizationPolicy.
+type policyRule struct {
+	policy  parsedAuthorizationPolicy
+	index   int
+	clauses []clause
+}
+
+func (r policyRule) String() string {
+	return fmt.Sprintf("%s rules[%d]", r.policy, r.index)
+}
+
+// overlapsWorkloads reports whether the policies of r and other may apply to the same workload.
+func (r policyRule) overlapsWorkloads(other policyRule, rootNamespace string) bool {
+	if r.policy.Namespace != other.policy.Namespace && r.policy.Namespace != rootNamespace && other.policy.Namespace != rootNamespace {
+		return false
+	}
+	return selectorsOverlap(r.policy.Spec.GetSelector().GetMatchLabels(), other.policy.Spec.GetSelector().GetMatchLabels())
+}
+
+// coversWorkloads reports whether the policy of r applies to every workload the policy of other
+// applies to.
+func (r policyRule) coversWorkloads(other policyRule, rootNamespace string) bool {
+	if r.policy.Namespace != other.policy.Namespace && r.policy.Namespace != rootNamespace {
+		return false
+	}
+	return selectorCovers(r.policy.Spec.GetSelector().GetMatchLabels(), other.policy.Spec.GetSelector().GetMatchLabels())
+}
+
+// overlaps reports whether a request may match both rules.
+func (r policyRule) overlaps(other policyRule) bool {
+	for _, a := range r.clauses {
+		for _, b := range other.clauses {
+			if clausesIntersect(a, b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// covers reports whether every request matching other matches r.
+func (r policyRule) covers(other policyRule) bool {
+	for _, inner := range other.clauses {
+		covered := false
+		for _, outer := range r.clauses {
+			if clauseCovers(outer, inner) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+func policyRules(policies []parsedAuthorizationPolicy, action authzpb.AuthorizationPolicy_Action) []policyRule {
+	var rules []policyRule
+	for _, policy := range policies {
+		if policy.Spec.Action != action {
+			continue
+		}
+		for i, rule := range policy.Spec.Rules {
+			rules = append(rules, policyRule{policy: policy, index: i, clauses: ruleClauses(rule)})
+		}
+	}
+	return rules
+}
+
+// conflict is an ALLOW rule overlapping DENY rules of policies applying to the same workloads.
+type conflict struct {
+	allow policyRule
+	deny  []policyRule
+	// shadowedBy is a DENY rule matching every request the ALLOW rule matches, which makes the
+	// ALLOW rule unreachable.
+	shadowedBy *policyRule
+}
+
+func findConflicts(policies []parsedAuthorizationPolicy, rootNamespace string) []conflict {
+	denyRules := policyRules(policies, authzpb.AuthorizationPolicy_DENY)
+	var conflicts []conflict
+	for _, allow := range policyRules(policies, authzpb.AuthorizationPolicy_ALLOW) {
+		c := conflict{allow: allow}
+		for i, deny := range denyRules {
+			if !deny.overlapsWorkloads(allow, rootNamespace) || !deny.overlaps(allow) {
+				continue
+			}
+			c.deny = append(c.deny, deny)
+			if c.shadowedBy == nil && deny.coversWorkloads(allow, rootNamespace) && deny.covers(allow) {
+				c.shadowedBy = &denyRules[i]
+			}
+		}
+		if len(c.deny) > 0 {
+			conflicts = append(conflicts, c)
+		}
+	}
+	return conflicts
+}
+
+func runAnalyzeConflicts(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("analyze-conflicts", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the generated policies")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	policyFile := fs.String("policyFile", "", "A YAML file of policies to analyze instead of the generated ones")
+	rootNamespace := fs.String("rootNamespace", "istio-system", "The root namespace, its policies apply to every namespace")
+	_ = fs.Parse(args)
+
+	policies, err := loadAuthorizationPolicies(ctx, *scenarioName, *configFile, *policyFile)
+	if err != nil {
+		return err
+	}
+
+	numAllow := len(policyRules(policies, authzpb.AuthorizationPolicy_ALLOW))
+	shadowed := 0
+	conflicts := findConflicts(policies, *rootNamespace)
+	for _, c := range conflicts {
+		fmt.Printf("ALLOW %s overlaps %d DENY rules, e.g. %s\n", c.allow, len(c.deny), c.deny[0])
+		if c.shadowedBy != nil {
+			shadowed++
+			fmt.Printf("  unreachable: every request it matches is denied by %s\n", *c.shadowedBy)
+		}
+	}
+	fmt.Printf("%d of %d ALLOW rules overlap DENY rules, %d of them are unreachable\n", len(conflicts), numAllow, shadowed)
+	return nil
+}
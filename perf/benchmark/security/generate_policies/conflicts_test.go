@@ -0,0 +1,127 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "testing"
+
+func TestPatternsIntersect(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"/a", "/a", true},
+		{"/a", "/b", false},
+		// Exact and prefix matches.
+		{"/api/v1", "/api/*", true},
+		{"/api/*", "/apis", false},
+		{"/api/*", "/api/v1/*", true},
+		{"/api/*", "/web/*", false},
+		// Prefix and suffix matches always share their concatenation.
+		{"/api/*", "*.json", true},
+		{"*.json", "*.xml", false},
+		{"*.json", "*a.json", true},
+		// The presence match intersects every pattern.
+		{"*", "/a", true},
+		{"/api/*", "*", true},
+	}
+	for _, c := range cases {
+		if got := patternsIntersect("request.path", c.a, c.b); got != c.want {
+			t.Errorf("patternsIntersect(%q, %q) = %v, want %v", c.a, c.b, got, c.want)
+		}
+		if got := patternsIntersect("request.path", c.b, c.a); got != c.want {
+			t.Errorf("patternsIntersect(%q, %q) = %v, want %v", c.b, c.a, got, c.want)
+		}
+	}
+	if !patternsIntersect("source.ip", "10.0.0.0/8", "10.1.0.0/16") || patternsIntersect("source.ip", "10.0.0.0/8", "192.168.0.1") {
+		t.Error("patternsIntersect does not compare the networks of IP attributes")
+	}
+}
+
+func TestPatternCovers(t *testing.T) {
+	cases := []struct {
+		outer, inner string
+		want         bool
+	}{
+		{"/a", "/a", true},
+		{"/a", "/b", false},
+		// An exact match covers no pattern, a prefix match covers the values and the longer
+		// prefixes it matches.
+		{"/a", "/a*", false},
+		{"/api/*", "/api/v1", true},
+		{"/api/*", "/api/v1/*", true},
+		{"/api/v1/*", "/api/*", false},
+		{"/api/*", "*.json", false},
+		{"*.json", "*a.json", true},
+		{"*.json", "/a.json", true},
+		{"*.json", "/api/*", false},
+		// The presence match covers every pattern, and is covered by none but itself.
+		{"*", "/a", true},
+		{"*", "*.json", true},
+		{"/*", "*", false},
+	}
+	for _, c := range cases {
+		if got := patternCovers("request.path", c.outer, c.inner); got != c.want {
+			t.Errorf("patternCovers(%q, %q) = %v, want %v", c.outer, c.inner, got, c.want)
+		}
+	}
+	if !patternCovers("source.ip", "10.0.0.0/8", "10.1.0.0/16") || patternCovers("source.ip", "10.1.0.0/16", "10.0.0.0/8") {
+		t.Error("patternCovers does not compare the networks of IP attributes")
+	}
+}
+
+func TestFindConflicts(t *testing.T) {
+	const allowAPI = "  - to:\n    - operation:\n        paths: [\"/api/*\"]\n        methods: [\"GET\"]\n"
+	cases := []struct {
+		name         string
+		deny         string
+		wantConflict bool
+		wantShadowed bool
+	}{
+		{"disjoint", "  - to:\n    - operation:\n        paths: [\"/web/*\"]\n", false, false},
+		{"disjoint methods", "  - to:\n    - operation:\n        methods: [\"POST\"]\n", false, false},
+		{"overlapping", "  - to:\n    - operation:\n        paths: [\"/api/admin\"]\n", true, false},
+		{"overlapping suffix", "  - to:\n    - operation:\n        paths: [\"*.json\"]\n", true, false},
+		{"overlapping condition", "  - when:\n    - key: request.headers[x-token]\n      values: [\"guest\"]\n", true, false},
+		{"shadowing prefix", "  - to:\n    - operation:\n        paths: [\"/api*\"]\n", true, true},
+		{"shadowing presence", "  - to:\n    - operation:\n        paths: [\"*\"]\n", true, true},
+		{"shadowing any", "  - {}\n", true, true},
+		// Negative constraints are never known to cover a rule.
+		{"negative", "  - to:\n    - operation:\n        notPaths: [\"/web/*\"]\n", true, false},
+	}
+	for _, c := range cases {
+		policies, err := parseAuthorizationPolicies([]string{testPolicy("a", "ALLOW", allowAPI), testPolicy("d", "DENY", c.deny)})
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		conflicts := findConflicts(policies, "istio-system")
+		if (len(conflicts) == 1) != c.wantConflict {
+			t.Errorf("%s: got %d conflicts, want conflict %v", c.name, len(conflicts), c.wantConflict)
+			continue
+		}
+		if c.wantConflict && (conflicts[0].shadowedBy != nil) != c.wantShadowed {
+			t.Errorf("%s: got shadowed by %v, want shadowed %v", c.name, conflicts[0].shadowedBy, c.wantShadowed)
+		}
+	}
+
+	// A DENY policy of another namespace applies to none of the workloads of the ALLOW policy.
+	other := "apiVersion: security.istio.io/v1beta1\nkind: AuthorizationPolicy\nmetadata:\n  name: d\n  namespace: ns-2\nspec:\n  action: DENY\n  rules:\n  - {}\n"
+	policies, err := parseAuthorizationPolicies([]string{testPolicy("a", "ALLOW", allowAPI), other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conflicts := findConflicts(policies, "istio-system"); len(conflicts) != 0 {
+		t.Errorf("got %d conflicts with a DENY policy of another namespace", len(conflicts))
+	}
+}
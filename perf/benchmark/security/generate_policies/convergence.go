@@ -0,0 +1,174 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ConvergenceResult correlates the convergence of istiod with the number of policies applied,
+// the earliest signal of authorization scale problems.
+type ConvergenceResult struct {
+	Batches []BatchConvergence `json:"batches"`
+	// Correlation is the Pearson correlation coefficient of the mean push latency of the batches
+	// with the number of policies applied, close to 1 when the latency grows with the corpus.
+	Correlation float64 `json:"correlation"`
+}
+
+// BatchConvergence records the pushes of istiod between the apply of a batch and the end of the
+// quiet period following it.
+type BatchConvergence struct {
+	Index           int `json:"index"`
+	PoliciesApplied int `json:"policiesApplied"`
+	// ConvergenceSeconds is the time from the apply of the batch to its last push.
+	ConvergenceSeconds float64 `json:"convergenceSeconds"`
+	Converged          bool    `json:"converged"`
+	// PushLatency is pilot_proxy_convergence_time, the time from a config change to its push to a
+	// proxy, in seconds.
+	PushLatency HistogramSummary `json:"pushLatency"`
+	// FullPushes and PartialPushes are the pilot_xds_pushes of the cds, lds and rds types, pushed
+	// by a full push, and of the eds type, pushed by an incremental endpoint push.
+	FullPushes    float64 `json:"fullPushes"`
+	PartialPushes float64 `json:"partialPushes"`
+}
+
+// convergenceTracker measures the convergence of istiod after every batch.
+type convergenceTracker struct {
+	metrics      *istiodMetrics
+	before       metricFamilies
+	pollInterval time.Duration
+	quietPeriod  time.Duration
+	timeout      time.Duration
+	result       ConvergenceResult
+}
+
+// newConvergenceTracker scrapes the metrics of the first istiod pod of namespace.
+func newConvergenceTracker(ctx context.Context, namespace string, pollInterval, quietPeriod, timeout time.Duration) (*convergenceTracker, error) {
+	m, err := newIstiodMetrics(ctx, namespace, "app=istiod")
+	if err != nil {
+		return nil, err
+	}
+	before, err := m.scrape(ctx)
+	if err != nil {
+		m.close()
+		return nil, err
+	}
+	return &convergenceTracker{metrics: m, before: before, pollInterval: pollInterval, quietPeriod: quietPeriod, timeout: timeout}, nil
+}
+
+func (t *convergenceTracker) close() {
+	t.metrics.close()
+}
+
+// batchApplied waits for istiod to push nothing for the quiet period after a batch applied at start,
+// and records the pushes since the previous batch.
+func (t *convergenceTracker) batchApplied(ctx context.Context, index, applied int, start time.Time) error {
+	r := &abRevision{metrics: t.metrics, before: t.before}
+	if err := waitConvergence(ctx, []*abRevision{r}, start, t.pollInterval, t.quietPeriod, t.timeout); err != nil {
+		return err
+	}
+	after, err := t.metrics.scrape(ctx)
+	if err != nil {
+		return err
+	}
+	t.result.Batches = append(t.result.Batches, batchConvergence(index, applied, r.result, t.before, after))
+	t.before = after
+	t.result.Correlation = convergenceCorrelation(t.result.Batches)
+	return nil
+}
+
+// batchConvergence returns the convergence of a batch from the scrapes before and after it.
+func batchConvergence(index, applied int, revision RevisionResult, before, after metricFamilies) BatchConvergence {
+	b := BatchConvergence{
+		Index:              index,
+		PoliciesApplied:    applied,
+		ConvergenceSeconds: revision.ConvergenceSeconds,
+		Converged:          revision.Converged,
+		PushLatency:        after.histogram("pilot_proxy_convergence_time").sub(before.histogram("pilot_proxy_convergence_time")).summary(),
+	}
+	b.FullPushes, b.PartialPushes = pushesBetween(before, after)
+	return b
+}
+
+// pushesBetween returns the full and partial pushes between the before and after scrapes: the
+// pilot_xds_pushes of the cds, lds and rds types, pushed by a full push, and of the eds type,
+// pushed by an incremental endpoint push.
+func pushesBetween(before, after metricFamilies) (float64, float64) {
+	var full, partial float64
+	pushesBefore := before.counterBy("pilot_xds_pushes", "type")
+	for typ, pushes := range after.counterBy("pilot_xds_pushes", "type") {
+		switch typ {
+		case "cds", "lds", "rds":
+			full += pushes - pushesBefore[typ]
+		case "eds":
+			partial += pushes - pushesBefore[typ]
+		}
+	}
+	return full, partial
+}
+
+// convergenceCorrelation returns the Pearson correlation coefficient of the mean push latency of
+// the batches which pushed with their number of policies applied, 0 when undefined.
+func convergenceCorrelation(batches []BatchConvergence) float64 {
+	var xs, ys []float64
+	for _, b := range batches {
+		if b.PushLatency.Count > 0 {
+			xs = append(xs, float64(b.PoliciesApplied))
+			ys = append(ys, b.PushLatency.Mean)
+		}
+	}
+	if len(xs) < 2 {
+		return 0
+	}
+	n := float64(len(xs))
+	var sx, sy, sxx, syy, sxy float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+		sxx += xs[i] * xs[i]
+		syy += ys[i] * ys[i]
+		sxy += xs[i] * ys[i]
+	}
+	d := math.Sqrt(n*sxx-sx*sx) * math.Sqrt(n*syy-sy*sy)
+	if d == 0 {
+		return 0
+	}
+	return (n*sxy - sx*sy) / d
+}
+
+// print writes the correlation table of the batches to w.
+func (r *ConvergenceResult) print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, strings.Join([]string{"batch", "policies", "convergence (s)", "push latency mean (s)", "push latency p99 (s)", "full pushes", "partial pushes"}, "\t")+"\t")
+	for _, b := range r.Batches {
+		convergence := fmt.Sprintf("%.1f", b.ConvergenceSeconds)
+		if !b.Converged {
+			convergence = ">" + convergence
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%.3f\t%.3f\t%.0f\t%.0f\t\n", b.Index, b.PoliciesApplied, convergence,
+			b.PushLatency.Mean, b.PushLatency.P99, b.FullPushes, b.PartialPushes)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "correlation of the mean push latency with the policies applied: %.3f\n", r.Correlation)
+	return err
+}
@@ -0,0 +1,79 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestBatchConvergence(t *testing.T) {
+	before := parseMetrics(t, `# TYPE pilot_xds_pushes counter
+pilot_xds_pushes{type="cds"} 10
+pilot_xds_pushes{type="eds"} 4
+pilot_xds_pushes{type="lds"} 10
+# TYPE pilot_proxy_convergence_time histogram
+pilot_proxy_convergence_time_bucket{le="1"} 10
+pilot_proxy_convergence_time_bucket{le="+Inf"} 10
+pilot_proxy_convergence_time_sum 2
+pilot_proxy_convergence_time_count 10
+`)
+	after := parseMetrics(t, `# TYPE pilot_xds_pushes counter
+pilot_xds_pushes{type="cds"} 12
+pilot_xds_pushes{type="eds"} 7
+pilot_xds_pushes{type="lds"} 12
+pilot_xds_pushes{type="rds"} 2
+pilot_xds_pushes{type="cds_senderr"} 1
+# TYPE pilot_proxy_convergence_time histogram
+pilot_proxy_convergence_time_bucket{le="1"} 14
+pilot_proxy_convergence_time_bucket{le="+Inf"} 14
+pilot_proxy_convergence_time_sum 4
+pilot_proxy_convergence_time_count 14
+`)
+	b := batchConvergence(1, 200, RevisionResult{ConvergenceSeconds: 3, Converged: true}, before, after)
+	if b.FullPushes != 6 || b.PartialPushes != 3 {
+		t.Errorf("got %v full and %v partial pushes, want 6 and 3", b.FullPushes, b.PartialPushes)
+	}
+	if b.PushLatency.Count != 4 || b.PushLatency.Mean != 0.5 {
+		t.Errorf("got push latency %+v, want 4 pushes of 0.5s", b.PushLatency)
+	}
+}
+
+func TestConvergenceCorrelation(t *testing.T) {
+	batches := []BatchConvergence{
+		{PoliciesApplied: 100, PushLatency: HistogramSummary{Count: 1, Mean: 0.1}},
+		{PoliciesApplied: 200, PushLatency: HistogramSummary{Count: 1, Mean: 0.2}},
+		// A batch without pushes is not correlated.
+		{PoliciesApplied: 300},
+		{PoliciesApplied: 400, PushLatency: HistogramSummary{Count: 1, Mean: 0.4}},
+	}
+	if got := convergenceCorrelation(batches); math.Abs(got-1) > 1e-9 {
+		t.Errorf("got correlation %v, want 1", got)
+	}
+	if got := convergenceCorrelation(batches[:1]); got != 0 {
+		t.Errorf("got correlation %v of a single batch, want 0", got)
+	}
+
+	result := &ConvergenceResult{Batches: batches, Correlation: 1}
+	var out bytes.Buffer
+	if err := result.print(&out); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 6 || !strings.Contains(lines[3], ">0.0") {
+		t.Errorf("unexpected table:\n%s", out.String())
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// securityGroup is the API group of the security resources, served as v1beta1 by every Istio
+// release and as v1 from Istio 1.22 on, with the same schemas.
+const securityGroup = "security.istio.io"
+
+// convertPolicies returns the policies with the apiVersion of the security resources set to
+// the version, and the number of converted policies. Other resources are kept as is.
+func convertPolicies(policies []policyObject, version string) ([]policyObject, int) {
+	converted := 0
+	out := make([]policyObject, len(policies))
+	for i, p := range policies {
+		if group := strings.SplitN(p.APIVersion, "/", 2)[0]; group == securityGroup && p.APIVersion != securityGroup+"/"+version {
+			p.APIVersion = securityGroup + "/" + version
+			converted++
+		}
+		out[i] = p
+	}
+	return out, converted
+}
+
+// policyObjectsYAML returns the YAML documents of policies.
+func policyObjectsYAML(policies []policyObject) ([]string, error) {
+	docs := make([]string, len(policies))
+	for i, p := range policies {
+		doc, err := policyObjectYAML(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", p, err)
+		}
+		docs[i] = doc
+	}
+	return docs, nil
+}
+
+// exporters convert the AuthorizationPolicies of a corpus, as YAML documents, to the documents of
+// another policy engine, and return a summary of the conversion.
+var exporters = map[string]func(docs []string, rootNamespace string) ([]string, string, error){
+	"cilium":        ciliumPoliciesYAML,
+	"networkpolicy": networkPoliciesYAML,
+}
+
+func runConvert(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	to := fs.String("to", "v1", "The API version of the converted security resources, v1 or v1beta1, or the engine to export the AuthorizationPolicies to: networkpolicy or cilium")
+	configFile := fs.String("configFile", "", "The config json file of the generated policies to convert")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	policyFile := fs.String("policyFile", "", "A YAML file or a directory of YAML files of policies to convert instead of the policies of the cluster")
+	validateSchema := fs.Bool("validateSchema", false, "Validate the converted policies against the OpenAPI schemas of their CRDs")
+	schemaFile := fs.String("schemaFile", "", "A path or URL of the CRDs of the target control plane, defaults to the bundled security.istio.io CRDs")
+	rootNamespace := fs.String("rootNamespace", "istio-system", "The root namespace, its policies apply to every namespace")
+	_ = fs.Parse(args)
+
+	export, exporting := exporters[*to]
+	if *to != "v1" && *to != "v1beta1" && !exporting {
+		return fmt.Errorf("-to must be v1, v1beta1, networkpolicy or cilium, got %s", *to)
+	}
+	if exporting && *validateSchema {
+		return fmt.Errorf("-validateSchema validates security.istio.io resources, not the exported ones")
+	}
+	var policies []policyObject
+	if *configFile != "" || *scenarioName != "" {
+		docs, err := loadPolicyDocuments(ctx, *scenarioName, *configFile, "")
+		if err != nil {
+			return err
+		}
+		if policies, err = parsePolicyObjects(docs); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if policies, err = importPolicies(ctx, *policyFile); err != nil {
+			return err
+		}
+	}
+
+	var summary string
+	if !exporting {
+		var n int
+		policies, n = convertPolicies(policies, *to)
+		summary = fmt.Sprintf("converted %d of %d policies to %s/%s", n, len(policies), securityGroup, *to)
+	}
+	docs, err := policyObjectsYAML(policies)
+	if err != nil {
+		return err
+	}
+	if exporting {
+		if docs, summary, err = export(docs, *rootNamespace); err != nil {
+			return err
+		}
+	}
+	if *validateSchema {
+		if err := validateSchemas(docs, *schemaFile); err != nil {
+			return err
+		}
+	}
+	for _, doc := range docs {
+		fmt.Println(doc + "---")
+	}
+	fmt.Fprintln(os.Stderr, summary)
+	return nil
+}
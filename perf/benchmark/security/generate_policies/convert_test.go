@@ -0,0 +1,80 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConvertPolicies(t *testing.T) {
+	authz := policyObject{APIVersion: "security.istio.io/v1beta1", Kind: "AuthorizationPolicy", Namespace: "ns", Name: "a"}
+	peer := policyObject{APIVersion: "security.istio.io/v1", Kind: "PeerAuthentication", Namespace: "ns", Name: "b"}
+	other := policyObject{APIVersion: "networking.istio.io/v1beta1", Kind: "Sidecar", Namespace: "ns", Name: "c"}
+	with := func(p policyObject, apiVersion string) policyObject {
+		p.APIVersion = apiVersion
+		return p
+	}
+
+	cases := []struct {
+		name      string
+		version   string
+		policies  []policyObject
+		want      []policyObject
+		converted int
+	}{
+		{
+			name:      "v1beta1 to v1",
+			version:   "v1",
+			policies:  []policyObject{authz, peer},
+			want:      []policyObject{with(authz, "security.istio.io/v1"), peer},
+			converted: 1,
+		},
+		{
+			name:      "v1 to v1beta1",
+			version:   "v1beta1",
+			policies:  []policyObject{authz, peer},
+			want:      []policyObject{authz, with(peer, "security.istio.io/v1beta1")},
+			converted: 1,
+		},
+		{
+			name:      "other groups unchanged",
+			version:   "v1",
+			policies:  []policyObject{other, with(other, "v1")},
+			want:      []policyObject{other, with(other, "v1")},
+			converted: 0,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, converted := convertPolicies(c.policies, c.version)
+			if converted != c.converted {
+				t.Errorf("converted %d policies, want %d", converted, c.converted)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestConvertInvalidVersion(t *testing.T) {
+	err := runConvert(context.Background(), []string{"-to=v2"})
+	if err == nil || !strings.Contains(err.Error(), "-to must be v1, v1beta1, networkpolicy or cilium, got v2") {
+		t.Errorf("got %v, want an invalid -to error", err)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// corpusVersion is the version of the reference corpora. Any change of the generated policies of a
+// size, from its definition or from the generators, must bump it so that a published version
+// always names the same policies.
+const corpusVersion = "v1"
+
+// corpusSize is the definition of a reference corpus.
+type corpusSize struct {
+	name        string
+	numPolicies int
+	counts      generatepolicies.Counts
+}
+
+// corpusSizes are the published corpora, with 1, 2 and 10 policies per workload.
+var corpusSizes = []corpusSize{
+	{"small", 10, generatepolicies.Counts{Paths: 10, Principals: 5, SourceIPs: 5, Selectors: 10}},
+	{"medium", 100, generatepolicies.Counts{Namespaces: 5, Paths: 20, Principals: 10, SourceIPs: 10, Selectors: 50}},
+	{"large", 1000, generatepolicies.Counts{Namespaces: 10, Paths: 50, Principals: 20, SourceIPs: 20, Selectors: 100}},
+}
+
+// CorpusManifest describes the published corpora of a version.
+type CorpusManifest struct {
+	Version  string          `json:"version"`
+	Seed     int64           `json:"seed"`
+	Metadata *RunMetadata    `json:"metadata,omitempty"`
+	Corpora  []CorpusSummary `json:"corpora"`
+}
+
+// CorpusSummary describes one published corpus.
+type CorpusSummary struct {
+	Name        string                  `json:"name"`
+	File        string                  `json:"file"`
+	NumPolicies int                     `json:"numPolicies"`
+	Counts      generatepolicies.Counts `json:"counts"`
+	SHA256      string                  `json:"sha256"`
+	Stats       *GenerationStats        `json:"stats"`
+}
+
+// generateCorpus returns the YAML documents of the reference corpus of size, drawn from seed.
+func generateCorpus(size corpusSize, seed int64) ([]string, error) {
+	g, err := generatepolicies.NewGenerator(
+		generatepolicies.WithKind("AuthorizationPolicy", size.numPolicies),
+		generatepolicies.WithAction("ALLOW"),
+		generatepolicies.WithCounts(size.counts),
+		generatepolicies.WithSeed(seed),
+	)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := g.Generate()
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]string, 0, len(resources))
+	for _, r := range resources {
+		doc, err := r.YAML()
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// publishCorpora generates the corpora of names and returns their manifest and contents by file.
+func publishCorpora(names []string, seed int64) (*CorpusManifest, map[string][]byte, error) {
+	manifest := &CorpusManifest{Version: corpusVersion, Seed: seed}
+	files := map[string][]byte{}
+	for _, name := range names {
+		var size *corpusSize
+		for i := range corpusSizes {
+			if corpusSizes[i].name == name {
+				size = &corpusSizes[i]
+			}
+		}
+		if size == nil {
+			return nil, nil, fmt.Errorf("unknown corpus size %q", name)
+		}
+		docs, err := generateCorpus(*size, seed)
+		if err != nil {
+			return nil, nil, fmt.Errorf("corpus %s: %v", name, err)
+		}
+		stats, err := generationStats(docs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("corpus %s: %v", name, err)
+		}
+		data := []byte(strings.Join(docs, "---\n") + "---\n")
+		sum := sha256.Sum256(data)
+		file := fmt.Sprintf("%s-%s.yaml", name, corpusVersion)
+		files[file] = data
+		manifest.Corpora = append(manifest.Corpora, CorpusSummary{
+			Name: name, File: file, NumPolicies: size.numPolicies, Counts: size.counts, SHA256: hex.EncodeToString(sum[:]), Stats: stats,
+		})
+	}
+	return manifest, files, nil
+}
+
+// checksums returns the checksums of the corpora of manifest in the format of sha256sum.
+func (m *CorpusManifest) checksums() []byte {
+	var buf bytes.Buffer
+	for _, c := range m.Corpora {
+		fmt.Fprintf(&buf, "%s  %s\n", c.SHA256, c.File)
+	}
+	return buf.Bytes()
+}
+
+func runPublishCorpus(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("publish-corpus", flag.ExitOnError)
+	outDir := fs.String("outDir", "corpus", "The directory the corpora are written to, in a subdirectory named by the corpus version")
+	sizes := fs.String("sizes", "small,medium,large", "Comma separated sizes of the corpora to publish")
+	seed := fs.Int64("seed", 1, "The seed of the values of the rules, published corpora should keep the default")
+	verify := fs.Bool("verify", false, "Check that the corpora in outDir are the ones this version generates instead of writing them")
+	_ = fs.Parse(args)
+
+	manifest, files, err := publishCorpora(strings.Split(*sizes, ","), *seed)
+	if err != nil {
+		return err
+	}
+	// The corpora are not stamped, so that they are the same whatever build publishes them.
+	manifest.Metadata = newRunMetadata(fs, seed)
+	dir := filepath.Join(*outDir, corpusVersion)
+	if *verify {
+		for _, c := range manifest.Corpora {
+			data, err := ioutil.ReadFile(filepath.Join(dir, c.File))
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(data, files[c.File]) {
+				sum := sha256.Sum256(data)
+				return fmt.Errorf("%s has checksum %s, version %s generates %s", c.File, hex.EncodeToString(sum[:]), corpusVersion, c.SHA256)
+			}
+		}
+		fmt.Printf("%d corpora of version %s verified\n", len(manifest.Corpora), corpusVersion)
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, c := range manifest.Corpora {
+		if err := ioutil.WriteFile(filepath.Join(dir, c.File), files[c.File], 0644); err != nil {
+			return err
+		}
+	}
+	js, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "manifest.json"), js, 0644); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "SHA256SUMS"), manifest.checksums(), 0644); err != nil {
+		return err
+	}
+	for _, c := range manifest.Corpora {
+		fmt.Printf("%s  %d policies  %s\n", filepath.Join(dir, c.File), c.NumPolicies, c.SHA256)
+	}
+	return nil
+}
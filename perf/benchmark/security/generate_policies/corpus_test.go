@@ -0,0 +1,52 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+// TestCorpusChecksums pins the corpora of corpusVersion: a change of the generated policies must
+// bump corpusVersion and update the checksums.
+func TestCorpusChecksums(t *testing.T) {
+	want := map[string]string{
+		"small-v1.yaml":  "99fee285c40352841325ecb3bb2487f95620b978ea1443de4b7150c340271f8f",
+		"medium-v1.yaml": "fbf549275bb8775381cd4d1d2cab6af27d3f6ce170773683b14c1d82b67c5eba",
+		"large-v1.yaml":  "338692a91493dab35c9331b28b807a1ff83ced509c2467dc58fc360b28980218",
+	}
+	manifest, files, err := publishCorpora([]string{"small", "medium", "large"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range manifest.Corpora {
+		if c.SHA256 != want[c.File] {
+			t.Errorf("%s has checksum %s, want %s", c.File, c.SHA256, want[c.File])
+		}
+		if len(files[c.File]) == 0 {
+			t.Errorf("%s is empty", c.File)
+		}
+	}
+
+	other, _, err := publishCorpora([]string{"small"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Corpora[0].SHA256 == manifest.Corpora[0].SHA256 {
+		t.Error("the corpora of seeds 1 and 2 are the same")
+	}
+	if _, _, err := publishCorpora([]string{"huge"}, 1); err == nil {
+		t.Error("publishCorpora(huge) succeeded")
+	}
+}
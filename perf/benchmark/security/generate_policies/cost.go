@@ -0,0 +1,227 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+// The weights of the heuristic model of Envoy RBAC evaluation. A request matching no rule, the
+// worst case, is checked against every matcher of every policy of its workload: the cost of a
+// matcher is the weight of its type times the weight of the attribute it reads.
+const (
+	presenceCost = 0.5
+	exactCost    = 1
+	wildcardCost = 1.5
+	cidrCost     = 2
+	// headerCost and metadataCost weigh the attributes read from the request headers and from the
+	// dynamic metadata of the JWT filter.
+	headerCost   = 2
+	metadataCost = 3
+	// customCost is the cost of the ext_authz check of a CUSTOM policy, which dwarfs its
+	// matchers.
+	customCost = 50
+)
+
+// workloadCost is the estimated cost of evaluating the AuthorizationPolicies of a workload.
+type workloadCost struct {
+	namespace string
+	selector  map[string]string
+	policies  int
+	rules     int
+	matchers  int
+	wildcards int
+	score     float64
+}
+
+func (w workloadCost) String() string {
+	if len(w.selector) == 0 {
+		return w.namespace + "/*"
+	}
+	var labels []string
+	for _, k := range getSortedLabelKeys(w.selector) {
+		labels = append(labels, k+"="+w.selector[k])
+	}
+	return w.namespace + "/" + strings.Join(labels, ",")
+}
+
+// wildcardDensity returns the share of the matchers of the workload using a wildcard.
+func (w workloadCost) wildcardDensity() float64 {
+	if w.matchers == 0 {
+		return 0
+	}
+	return float64(w.wildcards) / float64(w.matchers)
+}
+
+func getSortedLabelKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// matcherCost returns the cost of matching attribute against value, and whether value uses a
+// wildcard.
+func matcherCost(attribute, value string) (float64, bool) {
+	cost, wildcard := float64(exactCost), false
+	switch {
+	case value == "*":
+		cost, wildcard = presenceCost, true
+	case isIPAttribute(attribute):
+		cost = cidrCost
+	case strings.HasPrefix(value, "*") || strings.HasSuffix(value, "*"):
+		cost, wildcard = wildcardCost, true
+	}
+	switch {
+	case headerKeyRegexp.MatchString(attribute):
+		cost *= headerCost
+	case strings.HasPrefix(attribute, "request.auth."):
+		cost *= metadataCost
+	}
+	return cost, wildcard
+}
+
+// addRule adds the matchers of rule to the cost of w. Envoy evaluates the from and to entries
+// of a rule and its conditions as they are, without expanding them into clauses.
+func (w *workloadCost) addRule(rule *authzpb.Rule) {
+	var constraints clause
+	for _, from := range rule.From {
+		constraints = append(constraints, sourceConstraints(from.GetSource())...)
+	}
+	for _, to := range rule.To {
+		constraints = append(constraints, operationConstraints(to.GetOperation())...)
+	}
+	for _, condition := range rule.When {
+		constraints = appendConstraint(constraints, condition.Key, condition.Values, false)
+		constraints = appendConstraint(constraints, condition.Key, condition.NotValues, true)
+	}
+	w.rules++
+	for _, c := range constraints {
+		for _, value := range c.values {
+			cost, wildcard := matcherCost(c.attribute, value)
+			w.matchers++
+			if wildcard {
+				w.wildcards++
+			}
+			w.score += cost
+		}
+	}
+}
+
+// estimateCosts returns the estimated costs of the workloads of policies, the most expensive
+// first. The workloads are the ones selected by the selectors of the policies, and the other
+// workloads of each namespace.
+func estimateCosts(policies []parsedAuthorizationPolicy, rootNamespace string) []workloadCost {
+	var workloads []workloadCost
+	seen := map[string]bool{}
+	addWorkload := func(namespace string, selector map[string]string) {
+		w := workloadCost{namespace: namespace, selector: selector}
+		if !seen[w.String()] {
+			seen[w.String()] = true
+			workloads = append(workloads, w)
+		}
+	}
+	for _, p := range policies {
+		if p.Namespace != rootNamespace {
+			addWorkload(p.Namespace, nil)
+		}
+		addWorkload(p.Namespace, p.Spec.GetSelector().GetMatchLabels())
+	}
+
+	for i := range workloads {
+		w := &workloads[i]
+		for _, p := range policies {
+			if p.Namespace != w.namespace && p.Namespace != rootNamespace {
+				continue
+			}
+			if !selectorCovers(p.Spec.GetSelector().GetMatchLabels(), w.selector) {
+				continue
+			}
+			w.policies++
+			if p.Spec.Action == authzpb.AuthorizationPolicy_CUSTOM {
+				w.score += customCost
+			}
+			for _, rule := range p.Spec.Rules {
+				w.addRule(rule)
+			}
+		}
+	}
+	sort.SliceStable(workloads, func(i, j int) bool {
+		if workloads[i].score != workloads[j].score {
+			return workloads[i].score > workloads[j].score
+		}
+		return workloads[i].String() < workloads[j].String()
+	})
+	return workloads
+}
+
+// printWorkloadCosts prints the top most expensive workloads, flagging the ones costing more
+// than maxCost when it is positive.
+func printWorkloadCosts(workloads []workloadCost, top int, maxCost float64) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WORKLOAD\tPOLICIES\tRULES\tMATCHERS\tWILDCARDS\tSCORE\t")
+	for i, workload := range workloads {
+		if top > 0 && i >= top {
+			break
+		}
+		flag := ""
+		if maxCost > 0 && workload.score > maxCost {
+			flag = "  over maxCost"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.0f%%\t%.1f\t%s\n", workload, workload.policies, workload.rules,
+			workload.matchers, 100*workload.wildcardDensity(), workload.score, flag)
+	}
+	w.Flush()
+}
+
+func runEstimateCost(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("estimate-cost", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the generated policies")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	policyFile := fs.String("policyFile", "", "A YAML file of policies to score instead of the generated ones")
+	rootNamespace := fs.String("rootNamespace", "istio-system", "The root namespace, its policies apply to every namespace")
+	top := fs.Int("top", 10, "The number of most expensive workloads to print, 0 prints every workload")
+	maxCost := fs.Float64("maxCost", 0, "Flag the workloads costing more and fail, 0 disables the check")
+	_ = fs.Parse(args)
+
+	policies, err := loadAuthorizationPolicies(ctx, *scenarioName, *configFile, *policyFile)
+	if err != nil {
+		return err
+	}
+	workloads := estimateCosts(policies, *rootNamespace)
+	printWorkloadCosts(workloads, *top, *maxCost)
+
+	over := 0
+	for _, w := range workloads {
+		if *maxCost > 0 && w.score > *maxCost {
+			over++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "scored %d workloads of %d policies\n", len(workloads), len(policies))
+	if over > 0 {
+		return fmt.Errorf("%d workloads cost more than %g", over, *maxCost)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestEstimateCosts(t *testing.T) {
+	policies, err := parseAuthorizationPolicies(splitYAMLDocuments(`
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: mesh
+  namespace: istio-system
+spec:
+  action: DENY
+  rules:
+  - from:
+    - source:
+        ipBlocks: ["10.0.0.0/8"]
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: namespace
+  namespace: ns
+spec:
+  rules:
+  - to:
+    - operation:
+        paths: ["/a", "/b*"]
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: workload
+  namespace: ns
+spec:
+  selector:
+    matchLabels:
+      app: a
+  rules:
+  - when:
+    - key: request.headers[x-token]
+      values: ["*"]
+    - key: request.auth.claims[group]
+      values: ["admin"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := estimateCosts(policies, "istio-system")
+	want := []struct {
+		workload  string
+		policies  int
+		matchers  int
+		wildcards int
+		score     float64
+	}{
+		// 2 (CIDR) + 1 (exact) + 1.5 (prefix) + 0.5*2 (header presence) + 1*3 (claim).
+		{"ns/app=a", 3, 5, 2, 8.5},
+		{"ns/*", 2, 3, 1, 4.5},
+		{"istio-system/*", 1, 1, 0, 2},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d workloads %v, want %d", len(got), got, len(want))
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.String() != w.workload || g.policies != w.policies || g.matchers != w.matchers ||
+			g.wildcards != w.wildcards || g.score != w.score {
+			t.Errorf("workload %d: got %s with %d policies, %d matchers, %d wildcards, score %v, want %+v",
+				i, g, g.policies, g.matchers, g.wildcards, g.score, w)
+		}
+	}
+}
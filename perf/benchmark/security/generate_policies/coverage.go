@@ -0,0 +1,273 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"sigs.k8s.io/yaml"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+// coverageKinds are the kinds whose field coverage is reported, with the type of their spec.
+var coverageKinds = []struct {
+	kind string
+	spec reflect.Type
+}{
+	{"AuthorizationPolicy", reflect.TypeOf(authzpb.AuthorizationPolicy{})},
+	{"RequestAuthentication", reflect.TypeOf(authzpb.RequestAuthentication{})},
+}
+
+// fieldCoverage counts the uses of a spec field.
+type fieldCoverage struct {
+	Policies int `json:"policies"`
+	Values   int `json:"values"`
+}
+
+// kindCoverage is the coverage of the spec fields of a kind.
+type kindCoverage struct {
+	Policies int                      `json:"policies"`
+	Fields   map[string]fieldCoverage `json:"fields"`
+	// ConditionKeys counts the uses of the condition keys of AuthorizationPolicies.
+	ConditionKeys map[string]fieldCoverage `json:"conditionKeys,omitempty"`
+
+	messages map[string]bool
+}
+
+// protoFields returns the JSON paths of the fields of the proto message t, and whether they are
+// messages. Maps and repeated scalars are leaves.
+func protoFields(t reflect.Type, prefix string, fields map[string]bool) {
+	visit := func(f reflect.StructField) {
+		tag := f.Tag.Get("protobuf")
+		name := ""
+		for _, part := range strings.Split(tag, ",") {
+			if strings.HasPrefix(part, "name=") && name == "" {
+				name = strings.TrimPrefix(part, "name=")
+			}
+			if strings.HasPrefix(part, "json=") {
+				name = strings.TrimPrefix(part, "json=")
+			}
+		}
+		path := prefix + name
+		elem := f.Type
+		if elem.Kind() == reflect.Slice && elem.Elem().Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() == reflect.Ptr && elem.Elem().Kind() == reflect.Struct {
+			fields[path] = true
+			protoFields(elem.Elem(), path+".", fields)
+			return
+		}
+		fields[path] = false
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("protobuf") != "" {
+			visit(f)
+			continue
+		}
+		if f.Tag.Get("protobuf_oneof") == "" {
+			continue
+		}
+		oneof, ok := reflect.New(t).Interface().(interface{ XXX_OneofWrappers() []interface{} })
+		if !ok {
+			continue
+		}
+		for _, wrapper := range oneof.XXX_OneofWrappers() {
+			wt := reflect.TypeOf(wrapper).Elem()
+			if wt.Implements(f.Type) || reflect.PtrTo(wt).Implements(f.Type) {
+				visit(wt.Field(0))
+			}
+		}
+	}
+}
+
+func newKindCoverage(spec reflect.Type) *kindCoverage {
+	c := &kindCoverage{messages: map[string]bool{}, Fields: map[string]fieldCoverage{}}
+	protoFields(spec, "", c.messages)
+	for path := range c.messages {
+		c.Fields[path] = fieldCoverage{}
+	}
+	return c
+}
+
+// add records the fields set in spec, the JSON of a policy spec.
+func (c *kindCoverage) add(spec interface{}) {
+	c.Policies++
+	used := map[string]int{}
+	conditions := map[string]int{}
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for key, value := range v {
+				path := prefix + key
+				isMessage, known := c.messages[path]
+				if !known {
+					continue
+				}
+				if !isMessage {
+					used[path] += countValues(value)
+					continue
+				}
+				used[path]++
+				walk(path+".", value)
+			}
+			if prefix == "rules.when." {
+				if key, ok := v["key"].(string); ok {
+					conditions[key] += countValues(v["values"]) + countValues(v["notValues"])
+				}
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(prefix, item)
+			}
+		}
+	}
+	walk("", spec)
+	for path, n := range used {
+		f := c.Fields[path]
+		c.Fields[path] = fieldCoverage{Policies: f.Policies + 1, Values: f.Values + n}
+	}
+	for key, n := range conditions {
+		if c.ConditionKeys == nil {
+			c.ConditionKeys = map[string]fieldCoverage{}
+		}
+		f := c.ConditionKeys[key]
+		c.ConditionKeys[key] = fieldCoverage{Policies: f.Policies + 1, Values: f.Values + n}
+	}
+}
+
+func countValues(v interface{}) int {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case []interface{}:
+		return len(v)
+	case map[string]interface{}:
+		return len(v)
+	default:
+		return 1
+	}
+}
+
+func (c *kindCoverage) covered() int {
+	n := 0
+	for _, f := range c.Fields {
+		if f.Policies > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// policyCoverage returns the field coverage of the policies of docs, keyed by kind.
+func policyCoverage(docs []string) (map[string]*kindCoverage, error) {
+	coverage := map[string]*kindCoverage{}
+	for _, k := range coverageKinds {
+		coverage[k.kind] = newKindCoverage(k.spec)
+	}
+	for _, doc := range docs {
+		js, err := yaml.YAMLToJSON([]byte(doc))
+		if err != nil {
+			return nil, err
+		}
+		var resource struct {
+			Kind string      `json:"kind"`
+			Spec interface{} `json:"spec"`
+		}
+		if err := json.Unmarshal(js, &resource); err != nil {
+			return nil, err
+		}
+		if c, ok := coverage[resource.Kind]; ok {
+			c.add(resource.Spec)
+		}
+	}
+	return coverage, nil
+}
+
+func sortedKeys(m map[string]fieldCoverage) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func runCoverage(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("coverage", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the generated policies")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	policyFile := fs.String("policyFile", "", "A YAML file of policies to report on instead of the generated ones")
+	format := fs.String("format", "text", "The output format: text or json")
+	_ = fs.Parse(args)
+
+	docs, err := loadPolicyDocuments(ctx, *scenarioName, *configFile, *policyFile)
+	if err != nil {
+		return err
+	}
+	coverage, err := policyCoverage(docs)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "json":
+		out, err := json.MarshalIndent(coverage, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	case "text":
+	default:
+		return fmt.Errorf("unknown format %q, must be text or json", *format)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, k := range coverageKinds {
+		c := coverage[k.kind]
+		fmt.Fprintf(w, "%s: %d policies, %d of %d fields covered\n", k.kind, c.Policies, c.covered(), len(c.Fields))
+		fmt.Fprintln(w, "  FIELD\tPOLICIES\tVALUES\t")
+		for _, path := range sortedKeys(c.Fields) {
+			f := c.Fields[path]
+			mark := ""
+			if f.Policies == 0 {
+				mark = "not covered"
+			}
+			fmt.Fprintf(w, "  %s\t%d\t%d\t%s\n", path, f.Policies, f.Values, mark)
+		}
+		if len(c.ConditionKeys) > 0 {
+			fmt.Fprintln(w, "  CONDITION KEY\tPOLICIES\tVALUES\t")
+			for _, key := range sortedKeys(c.ConditionKeys) {
+				f := c.ConditionKeys[key]
+				fmt.Fprintf(w, "  %s\t%d\t%d\t\n", key, f.Policies, f.Values)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,217 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// policyChange is a policy present in both sets with a different spec.
+type policyChange struct {
+	policy policyObject
+	// fields are the changed fields of the spec which are not lists of rules.
+	fields []string
+	// added and removed are the rules, the items of the lists of the spec such as rules and
+	// jwtRules, only in the new or the old policy, as JSON.
+	added, removed []string
+}
+
+type policySetDiff struct {
+	added, removed []policyObject
+	changed        []policyChange
+	unchanged      int
+}
+
+// diffPolicySets compares the policies of oldSet and newSet by kind, namespace and name.
+func diffPolicySets(oldSet, newSet []policyObject) policySetDiff {
+	var d policySetDiff
+	oldPolicies := make(map[string]policyObject, len(oldSet))
+	for _, p := range oldSet {
+		oldPolicies[p.String()] = p
+	}
+	seen := make(map[string]bool, len(newSet))
+	for _, p := range newSet {
+		seen[p.String()] = true
+		old, ok := oldPolicies[p.String()]
+		switch {
+		case !ok:
+			d.added = append(d.added, p)
+		case reflect.DeepEqual(old.Spec, p.Spec):
+			d.unchanged++
+		default:
+			d.changed = append(d.changed, diffSpecs(old, p))
+		}
+	}
+	for _, p := range oldSet {
+		if !seen[p.String()] {
+			d.removed = append(d.removed, p)
+		}
+	}
+	return d
+}
+
+// diffSpecs compares the specs of a policy field by field, and its lists of rules rule by rule.
+func diffSpecs(oldPolicy, newPolicy policyObject) policyChange {
+	c := policyChange{policy: newPolicy}
+	var fields []string
+	for field := range oldPolicy.Spec {
+		fields = append(fields, field)
+	}
+	for field := range newPolicy.Spec {
+		if _, ok := oldPolicy.Spec[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		oldValue, newValue := oldPolicy.Spec[field], newPolicy.Spec[field]
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		oldRules, oldIsList := oldValue.([]interface{})
+		newRules, newIsList := newValue.([]interface{})
+		if (oldValue != nil && !oldIsList) || (newValue != nil && !newIsList) {
+			c.fields = append(c.fields, field)
+			continue
+		}
+		added, removed := diffRules(oldRules, newRules)
+		for _, rule := range added {
+			c.added = append(c.added, field+": "+rule)
+		}
+		for _, rule := range removed {
+			c.removed = append(c.removed, field+": "+rule)
+		}
+		if len(added) == 0 && len(removed) == 0 {
+			// Only the order of the rules changed.
+			c.fields = append(c.fields, field)
+		}
+	}
+	return c
+}
+
+// diffRules returns the JSON of the rules of newRules missing from oldRules and of the rules of
+// oldRules missing from newRules, counting duplicated rules.
+func diffRules(oldRules, newRules []interface{}) (added, removed []string) {
+	counts := make(map[string]int)
+	for _, rule := range oldRules {
+		counts[ruleJSON(rule)]++
+	}
+	for _, rule := range newRules {
+		js := ruleJSON(rule)
+		if counts[js] > 0 {
+			counts[js]--
+			continue
+		}
+		added = append(added, js)
+	}
+	for _, rule := range oldRules {
+		js := ruleJSON(rule)
+		if counts[js] > 0 {
+			counts[js]--
+			removed = append(removed, js)
+		}
+	}
+	return added, removed
+}
+
+// ruleJSON returns the JSON of a rule, with its keys sorted by encoding/json.
+func ruleJSON(rule interface{}) string {
+	js, _ := json.Marshal(rule)
+	return string(js)
+}
+
+func (d policySetDiff) print(w io.Writer, verbose bool) {
+	for _, p := range d.added {
+		fmt.Fprintf(w, "+ %s\n", p)
+	}
+	for _, p := range d.removed {
+		fmt.Fprintf(w, "- %s\n", p)
+	}
+	addedRules, removedRules := 0, 0
+	for _, c := range d.changed {
+		var changes []string
+		if len(c.fields) > 0 {
+			changes = append(changes, strings.Join(c.fields, ", "))
+		}
+		if len(c.added) > 0 || len(c.removed) > 0 {
+			changes = append(changes, fmt.Sprintf("%d rules added, %d removed", len(c.added), len(c.removed)))
+		}
+		fmt.Fprintf(w, "~ %s: %s\n", c.policy, strings.Join(changes, "; "))
+		if verbose {
+			for _, rule := range c.added {
+				fmt.Fprintf(w, "    + %s\n", rule)
+			}
+			for _, rule := range c.removed {
+				fmt.Fprintf(w, "    - %s\n", rule)
+			}
+		}
+		addedRules += len(c.added)
+		removedRules += len(c.removed)
+	}
+	fmt.Fprintf(w, "%d policies added, %d removed, %d changed, %d unchanged; %d rules added, %d removed\n",
+		len(d.added), len(d.removed), len(d.changed), d.unchanged, addedRules, removedRules)
+}
+
+func (d policySetDiff) empty() bool {
+	return len(d.added) == 0 && len(d.removed) == 0 && len(d.changed) == 0
+}
+
+func runDiff(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	oldFile := fs.String("old", "", "A YAML file of the old policies, generated or exported with kubectl get -o yaml")
+	newFile := fs.String("new", "", "A YAML file of the new policies")
+	oldConfig := fs.String("oldConfig", "", "The config json file generating the old policies, instead of -old")
+	newConfig := fs.String("newConfig", "", "The config json file generating the new policies, instead of -new")
+	oldScenario := fs.String("oldScenario", "", "The preset scenario generating the old policies, overlaid by oldConfig")
+	newScenario := fs.String("newScenario", "", "The preset scenario generating the new policies, overlaid by newConfig")
+	verbose := fs.Bool("verbose", false, "Print the added and removed rules of the changed policies")
+	exitCode := fs.Bool("exitCode", false, "Exit with an error when the policy sets differ")
+	_ = fs.Parse(args)
+
+	load := func(scenarioName, configFile, policyFile string) ([]policyObject, error) {
+		if scenarioName == "" && configFile == "" && policyFile == "" {
+			return nil, fmt.Errorf("a policy file, a config file or a scenario is required for both sets")
+		}
+		docs, err := loadPolicyDocuments(ctx, scenarioName, configFile, policyFile)
+		if err != nil {
+			return nil, err
+		}
+		return parsePolicyObjects(docs)
+	}
+	oldSet, err := load(*oldScenario, *oldConfig, *oldFile)
+	if err != nil {
+		return fmt.Errorf("old policies: %v", err)
+	}
+	newSet, err := load(*newScenario, *newConfig, *newFile)
+	if err != nil {
+		return fmt.Errorf("new policies: %v", err)
+	}
+
+	d := diffPolicySets(oldSet, newSet)
+	d.print(os.Stdout, *verbose)
+	if *exitCode && !d.empty() {
+		return fmt.Errorf("the policy sets differ")
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDiffPolicySets(t *testing.T) {
+	oldSet, err := parsePolicyObjects(splitYAMLDocuments(`
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: a
+  namespace: ns
+spec:
+  action: DENY
+  rules:
+  - to:
+    - operation:
+        paths: ["/a"]
+  - to:
+    - operation:
+        paths: ["/b"]
+---
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: b
+  namespace: ns
+spec:
+  mtls:
+    mode: STRICT
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: c
+  namespace: ns
+spec: {}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The new set is exported from a cluster, with the server side metadata.
+	newSet, err := parsePolicyObjects(splitYAMLDocuments(`
+apiVersion: v1
+kind: List
+items:
+- apiVersion: security.istio.io/v1beta1
+  kind: AuthorizationPolicy
+  metadata:
+    name: a
+    namespace: ns
+    resourceVersion: "42"
+  spec:
+    action: ALLOW
+    rules:
+    - to:
+      - operation:
+          paths: ["/b"]
+    - to:
+      - operation:
+          paths: ["/c"]
+- apiVersion: security.istio.io/v1beta1
+  kind: AuthorizationPolicy
+  metadata:
+    name: c
+    namespace: ns
+    uid: 7d3c
+  spec: {}
+- apiVersion: security.istio.io/v1beta1
+  kind: AuthorizationPolicy
+  metadata:
+    name: d
+    namespace: ns
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	diffPolicySets(oldSet, newSet).print(&out, true)
+	want := strings.TrimLeft(`
++ AuthorizationPolicy ns/d
+- PeerAuthentication ns/b
+~ AuthorizationPolicy ns/a: action; 1 rules added, 1 removed
+    + rules: {"to":[{"operation":{"paths":["/c"]}}]}
+    - rules: {"to":[{"operation":{"paths":["/a"]}}]}
+1 policies added, 1 removed, 1 changed, 1 unchanged; 1 rules added, 1 removed
+`, "\n")
+	if got := out.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// drift is the difference between the policies of a manifest and the live policies of a cluster.
+type drift struct {
+	// missing are the policies of the manifest absent from the cluster.
+	missing []policyObject
+	// extra are the policies of the cluster absent from the manifest.
+	extra []policyObject
+	// modified are the policies of the cluster whose spec differs from the manifest.
+	modified []policyChange
+	inSync   int
+}
+
+// detectDrift compares the security policies of manifest with the live ones. Unless
+// allNamespaces is set, the live policies of the namespaces without policies in the manifest
+// are ignored, so that the policies of the rest of the cluster are not reported as extra.
+func detectDrift(manifest, live []policyObject, allNamespaces bool) drift {
+	var expected []policyObject
+	namespaces := map[string]bool{}
+	for _, p := range manifest {
+		if importedKinds[p.Kind] {
+			expected = append(expected, p)
+			namespaces[p.Namespace] = true
+		}
+	}
+	var actual []policyObject
+	for _, p := range live {
+		if allNamespaces || namespaces[p.Namespace] {
+			actual = append(actual, p)
+		}
+	}
+	d := diffPolicySets(expected, actual)
+	return drift{missing: d.removed, extra: d.added, modified: d.changed, inSync: d.unchanged}
+}
+
+func (d drift) empty() bool {
+	return len(d.missing) == 0 && len(d.extra) == 0 && len(d.modified) == 0
+}
+
+func (d drift) print(w io.Writer, verbose bool) {
+	for _, p := range d.missing {
+		fmt.Fprintf(w, "missing  %s\n", p)
+	}
+	for _, p := range d.extra {
+		fmt.Fprintf(w, "extra    %s\n", p)
+	}
+	for _, c := range d.modified {
+		var changes []string
+		if len(c.fields) > 0 {
+			changes = append(changes, strings.Join(c.fields, ", "))
+		}
+		if len(c.added) > 0 || len(c.removed) > 0 {
+			changes = append(changes, fmt.Sprintf("%d rules added, %d removed", len(c.added), len(c.removed)))
+		}
+		fmt.Fprintf(w, "modified %s: %s\n", c.policy, strings.Join(changes, "; "))
+		if verbose {
+			for _, rule := range c.added {
+				fmt.Fprintf(w, "    + %s\n", rule)
+			}
+			for _, rule := range c.removed {
+				fmt.Fprintf(w, "    - %s\n", rule)
+			}
+		}
+	}
+	fmt.Fprintf(w, "%d policies missing, %d extra, %d modified, %d in sync\n",
+		len(d.missing), len(d.extra), len(d.modified), d.inSync)
+}
+
+func runDrift(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("drift", flag.ExitOnError)
+	manifestFile := fs.String("manifest", "", "A YAML file of the previously generated policies")
+	configFile := fs.String("configFile", "", "The config json file generating the policies, instead of -manifest")
+	scenarioName := fs.String("scenario", "", "The preset scenario generating the policies, overlaid by -configFile")
+	liveDir := fs.String("live", "", "A YAML file or a directory of YAML files, e.g. the output of kubectl get -o yaml, to compare instead of the policies of the cluster")
+	allNamespaces := fs.Bool("allNamespaces", false, "Report the policies of all namespaces absent from the manifest, not only of the namespaces of the manifest")
+	verbose := fs.Bool("verbose", false, "Print the added and removed rules of the modified policies")
+	exitCode := fs.Bool("exitCode", true, "Exit with an error when the cluster drifted from the manifest")
+	_ = fs.Parse(args)
+
+	if *manifestFile == "" && *configFile == "" && *scenarioName == "" {
+		return fmt.Errorf("a manifest, a config file or a scenario is required")
+	}
+	docs, err := loadPolicyDocuments(ctx, *scenarioName, *configFile, *manifestFile)
+	if err != nil {
+		return err
+	}
+	manifest, err := parsePolicyObjects(docs)
+	if err != nil {
+		return err
+	}
+	live, err := importPolicies(ctx, *liveDir)
+	if err != nil {
+		return fmt.Errorf("live policies: %v", err)
+	}
+
+	d := detectDrift(manifest, live, *allNamespaces)
+	d.print(os.Stdout, *verbose)
+	if *exitCode && !d.empty() {
+		return fmt.Errorf("the cluster drifted from the manifest")
+	}
+	return nil
+}
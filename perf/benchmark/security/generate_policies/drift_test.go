@@ -0,0 +1,117 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDetectDrift(t *testing.T) {
+	manifest, err := parsePolicyObjects(splitYAMLDocuments(`
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: ns
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: a
+  namespace: ns
+spec:
+  rules:
+  - to:
+    - operation:
+        paths: ["/a"]
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: b
+  namespace: ns
+spec: {}
+---
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: c
+  namespace: ns
+spec:
+  mtls:
+    mode: STRICT
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, err := parsePolicyObjects(splitYAMLDocuments(`
+apiVersion: v1
+kind: List
+items:
+- apiVersion: security.istio.io/v1beta1
+  kind: AuthorizationPolicy
+  metadata:
+    name: a
+    namespace: ns
+    resourceVersion: "42"
+  spec:
+    rules:
+    - to:
+      - operation:
+          paths: ["/b"]
+- apiVersion: security.istio.io/v1beta1
+  kind: PeerAuthentication
+  metadata:
+    name: c
+    namespace: ns
+  spec:
+    mtls:
+      mode: STRICT
+- apiVersion: security.istio.io/v1beta1
+  kind: AuthorizationPolicy
+  metadata:
+    name: d
+    namespace: ns
+  spec: {}
+- apiVersion: security.istio.io/v1beta1
+  kind: AuthorizationPolicy
+  metadata:
+    name: e
+    namespace: other
+  spec: {}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := detectDrift(manifest, live, false)
+	var out bytes.Buffer
+	d.print(&out, false)
+	want := `missing  AuthorizationPolicy ns/b
+extra    AuthorizationPolicy ns/d
+modified AuthorizationPolicy ns/a: 1 rules added, 1 removed
+1 policies missing, 1 extra, 1 modified, 1 in sync
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+
+	if d := detectDrift(manifest, live, true); len(d.extra) != 2 {
+		t.Errorf("got %d extra policies in all namespaces, want 2", len(d.extra))
+	}
+	if d := detectDrift(live, live, false); !d.empty() {
+		t.Errorf("got drift %+v between identical sets", d)
+	}
+}
@@ -0,0 +1,466 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// e2eManifestTemplate deploys the workload the policies are enforced on, fortioserver, and the
+// client sending the probes, both in the mesh.
+var e2eManifestTemplate = template.Must(template.New("e2e").Parse(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{.Namespace}}
+  labels:
+    istio-injection: enabled
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: fortioserver
+  namespace: {{.Namespace}}
+spec:
+  selector:
+    app: fortioserver
+  ports:
+  - name: http
+    port: 8080
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: fortioserver
+  namespace: {{.Namespace}}
+spec:
+  selector:
+    matchLabels:
+      app: fortioserver
+  template:
+    metadata:
+      labels:
+        app: fortioserver
+      annotations:
+        # Creates the stats of the RBAC filters, scraped by bench -rbacStats.
+        proxy.istio.io/config: '{"proxyStatsMatcher":{"inclusionRegexps":[".*rbac.*"]}}'
+    spec:
+      containers:
+      - name: app
+        image: {{.ServerImage}}
+        args: ["server"]
+        ports:
+        - containerPort: 8080
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: client
+  namespace: {{.Namespace}}
+spec:
+  selector:
+    matchLabels:
+      app: client
+  template:
+    metadata:
+      labels:
+        app: client
+    spec:
+      containers:
+      - name: client
+        image: {{.ClientImage}}
+        command: ["sh", "-c", "while true; do sleep 3600; done"]
+`))
+
+// E2EResult records an end-to-end enforcement test: the outcome of every probe in the last
+// attempt.
+type E2EResult struct {
+	Cluster      string        `json:"cluster,omitempty"`
+	IstioVersion string        `json:"istioVersion,omitempty"`
+	Attempts     int           `json:"attempts"`
+	Probes       []ProbeResult `json:"probes"`
+	Passed       bool          `json:"passed"`
+}
+
+// ProbeResult is the response to one request of the traffic profile.
+type ProbeResult struct {
+	TrafficRequest
+	Status  int    `json:"status"`
+	Outcome string `json:"outcome"`
+	Matched bool   `json:"matched"`
+}
+
+// FailedProbes returns the number of probes not decided as expected.
+func (r *E2EResult) FailedProbes() int {
+	failed := 0
+	for _, p := range r.Probes {
+		if !p.Matched {
+			failed++
+		}
+	}
+	return failed
+}
+
+// ensureKindCluster creates the kind cluster name unless it exists, and points kubectl at it. It
+// returns whether the cluster was created.
+func ensureKindCluster(ctx context.Context, name string) (bool, error) {
+	out, err := command(ctx, nil, "kind", "get", "clusters")
+	if err != nil {
+		return false, err
+	}
+	for _, cluster := range strings.Fields(string(out)) {
+		if cluster == name {
+			_, err := command(ctx, nil, "kind", "export", "kubeconfig", "--name", name)
+			return false, err
+		}
+	}
+	log.Printf("creating kind cluster %s", name)
+	_, err = command(ctx, nil, "kind", "create", "cluster", "--name", name, "--wait", "5m")
+	return err == nil, err
+}
+
+// istioctlURL returns the URL of the istioctl release archive of version for this platform.
+func istioctlURL(version string) string {
+	goos := runtime.GOOS
+	if goos == "darwin" {
+		goos = "osx"
+	}
+	return fmt.Sprintf("https://github.com/istio/istio/releases/download/%s/istioctl-%s-%s-%s.tar.gz",
+		version, version, goos, runtime.GOARCH)
+}
+
+// downloadIstioctl returns the path of the istioctl binary of version in dir, downloading it
+// from the Istio releases unless it is already there.
+func downloadIstioctl(ctx context.Context, version, dir string) (string, error) {
+	path := filepath.Join(dir, "istioctl-"+version)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	req, err := http.NewRequest("GET", istioctlURL(version), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("downloading istioctl %s: %s", version, resp.Status)
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("downloading istioctl %s: %v", version, err)
+	}
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return "", fmt.Errorf("the istioctl %s archive has no istioctl binary", version)
+		}
+		if err != nil {
+			return "", fmt.Errorf("downloading istioctl %s: %v", version, err)
+		}
+		if filepath.Base(header.Name) != "istioctl" || header.Typeflag != tar.TypeReg {
+			continue
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(f, archive); err != nil {
+			f.Close()
+			return "", err
+		}
+		return path, f.Close()
+	}
+}
+
+// probeClient is the pod sending the probe requests with curl, e.g. deploy/client.
+type probeClient struct {
+	namespace string
+	target    string
+	container string
+}
+
+// probeArgs returns the kubectl arguments sending r from client to url with curl, which prints
+// the status code of the response.
+func probeArgs(client probeClient, url string, r TrafficRequest) []string {
+	method := r.Method
+	if method == "" {
+		method = "GET"
+	}
+	args := []string{"-n", client.namespace, "exec", client.target}
+	if client.container != "" {
+		args = append(args, "-c", client.container)
+	}
+	args = append(args, "--", "curl", "-s", "-o", "/dev/null", "-w", "%{http_code}", "-X", method)
+	names := make([]string, 0, len(r.Headers))
+	for name := range r.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "-H", name+": "+r.Headers[name])
+	}
+	for _, name := range sortedHeaderNames(r.HeaderValues) {
+		for _, value := range r.HeaderValues[name] {
+			args = append(args, "-H", name+": "+value)
+		}
+	}
+	if r.Host != "" {
+		args = append(args, "-H", "Host: "+r.Host)
+	}
+	return append(args, url+r.Path)
+}
+
+// probe sends every request of profile once from client and returns their outcomes.
+func probe(ctx context.Context, client probeClient, url string, profile *TrafficProfile) ([]ProbeResult, error) {
+	var results []ProbeResult
+	for _, r := range profile.Requests {
+		out, err := kubectl(ctx, nil, probeArgs(client, url, r)...)
+		if err != nil {
+			return nil, err
+		}
+		status, err := strconv.Atoi(strings.TrimSpace(string(out)))
+		if err != nil {
+			return nil, fmt.Errorf("unexpected curl output %q: %v", out, err)
+		}
+		outcome := statusOutcome(status)
+		results = append(results, ProbeResult{TrafficRequest: r, Status: status, Outcome: outcome, Matched: matchesExpectation(r.Expect, outcome)})
+	}
+	return results, nil
+}
+
+func runE2E(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("e2e", flag.ExitOnError)
+	kindCluster := fs.String("kindCluster", "authz-e2e", "The kind cluster to create or reuse, empty uses the cluster of the current kubectl context")
+	keepCluster := fs.Bool("keepCluster", false, "Keep the kind cluster created by the run")
+	istioVersion := fs.String("istioVersion", "", "The Istio version installed with its istioctl, empty uses the Istio already installed in the cluster")
+	istioProfile := fs.String("istioProfile", "minimal", "The istioctl installation profile")
+	configFile := fs.String("configFile", "", "The name of the config json file")
+	scenarioName := fs.String("scenario", "path-matrix", "The name of a preset scenario, overlaid by the fields set in configFile")
+	numProbes := fs.Int("probes", 20, "The number of probe requests sampled from the policies")
+	denyRate := fs.Float64("denyRate", 0.5, "The share of probe requests expected to be denied")
+	serverImage := fs.String("serverImage", "fortio/fortio:latest_release", "The image of the server the policies are enforced on")
+	clientImage := fs.String("clientImage", "curlimages/curl:latest", "The image of the client sending the probes, which must have curl")
+	timeout := fs.Duration("timeout", 5*time.Minute, "The maximum time waited for the probes to get their expected decisions")
+	interval := fs.Duration("interval", 5*time.Second, "The interval between two probe attempts")
+	cleanup := fs.Bool("cleanup", true, "Delete the policies and the workloads at the end of the run")
+	outDir := fs.String("outDir", "run", "The directory the run report and the downloaded istioctl are written to")
+	stamp := fs.Bool("stamp", false, "Annotate every generated object with the tool version, git SHA and flags of the run")
+	_ = fs.Parse(args)
+
+	policyData, err := loadSecurityPolicy(*scenarioName, *configFile)
+	if err != nil {
+		return err
+	}
+	profile, err := sampleTraffic(policyData, *numProbes, *denyRate)
+	if err != nil {
+		return err
+	}
+	if profile.External {
+		return fmt.Errorf("the traffic of scenario %s is sent from outside the mesh, e2e probes from a client in the mesh", *scenarioName)
+	}
+	policies, err := generatePolicies(ctx, policyData)
+	if err != nil {
+		return err
+	}
+	if *stamp {
+		if policies, err = stampDocs(policies, newRunMetadata(fs, nil)); err != nil {
+			return err
+		}
+	}
+	namespace := policyData.Namespace
+	if namespace == "" {
+		namespace = "twopods-istio"
+	}
+	var manifest bytes.Buffer
+	if err := e2eManifestTemplate.Execute(&manifest, map[string]string{
+		"Namespace": namespace, "ServerImage": *serverImage, "ClientImage": *clientImage,
+	}); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+
+	report := newRunReport("e2e", *configFile, fs)
+	result := &E2EResult{Cluster: *kindCluster, IstioVersion: *istioVersion}
+	report.E2E = result
+	err = runE2ESteps(ctx, e2eSteps{
+		kindCluster:  *kindCluster,
+		keepCluster:  *keepCluster,
+		istioVersion: *istioVersion,
+		istioProfile: *istioProfile,
+		outDir:       *outDir,
+		manifest:     manifest.String(),
+		namespace:    namespace,
+		policies:     policies,
+		profile:      profile,
+		timeout:      *timeout,
+		interval:     *interval,
+		cleanup:      *cleanup,
+	}, report)
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	if ctx.Err() != nil {
+		report.Interrupted = true
+	}
+	report.EndTime = time.Now()
+	if writeErr := writeRunReport(*outDir, report); writeErr != nil {
+		return writeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d of %d probes decided as expected after %d attempts\n", len(result.Probes)-result.FailedProbes(), len(result.Probes), result.Attempts)
+	if !result.Passed {
+		for _, p := range result.Probes {
+			if !p.Matched {
+				fmt.Printf("FAILED %s %s%s: expected %s, got %d (%s)\n", p.Method, p.Host, p.Path, p.Expect, p.Status, p.Outcome)
+			}
+		}
+		return fmt.Errorf("%d probes were not decided as expected", result.FailedProbes())
+	}
+	return nil
+}
+
+type e2eSteps struct {
+	kindCluster  string
+	keepCluster  bool
+	istioVersion string
+	istioProfile string
+	outDir       string
+	manifest     string
+	namespace    string
+	policies     []string
+	profile      *TrafficProfile
+	timeout      time.Duration
+	interval     time.Duration
+	cleanup      bool
+}
+
+// runE2ESteps sets up the cluster, applies the policies and probes until every probe gets its
+// expected decision or the timeout expires, recording the probes of the last attempt in report.
+func runE2ESteps(ctx context.Context, s e2eSteps, report *RunReport) error {
+	result := report.E2E
+	if s.kindCluster != "" {
+		created, err := ensureKindCluster(ctx, s.kindCluster)
+		if err != nil {
+			return err
+		}
+		if created && !s.keepCluster {
+			defer func() {
+				if _, err := command(context.Background(), nil, "kind", "delete", "cluster", "--name", s.kindCluster); err != nil {
+					log.Printf("failed to delete the kind cluster: %v", err)
+				}
+			}()
+		}
+	}
+	if s.istioVersion != "" {
+		err := inSpan(ctx, "install", func(ctx context.Context) error {
+			istioctl, err := downloadIstioctl(ctx, s.istioVersion, s.outDir)
+			if err != nil {
+				return err
+			}
+			log.Printf("installing Istio %s", s.istioVersion)
+			_, err = command(ctx, nil, istioctl, "install", "-y", "--set", "profile="+s.istioProfile)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := inSpan(ctx, "deploy", func(ctx context.Context) error { return kubectlApply(ctx, []string{s.manifest}) }); err != nil {
+		return err
+	}
+	if s.cleanup {
+		defer func() {
+			_, cleanupSpan := startSpan(ctx, "cleanup")
+			_, err := kubectl(context.Background(), strings.NewReader(s.manifest), "delete", "--ignore-not-found", "-f", "-")
+			cleanupSpan.end(err)
+			if err != nil {
+				log.Printf("failed to delete the workloads: %v", err)
+			}
+		}()
+	}
+	err := inSpan(ctx, "wait", func(ctx context.Context) error {
+		_, err := kubectl(ctx, nil, "-n", s.namespace, "rollout", "status", "deploy/fortioserver", "deploy/client",
+			"--timeout", s.timeout.String())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := inSpan(ctx, "apply", func(ctx context.Context) error { return kubectlApply(ctx, s.policies) }); err != nil {
+		return err
+	}
+	report.PoliciesApplied = len(s.policies)
+	if s.cleanup {
+		defer func() {
+			all := strings.Join(s.policies, "---\n")
+			_, cleanupSpan := startSpan(ctx, "cleanup")
+			_, err := kubectl(context.Background(), strings.NewReader(all), "delete", "--ignore-not-found", "-f", "-")
+			cleanupSpan.end(err)
+			if err != nil {
+				log.Printf("failed to delete the policies: %v", err)
+			}
+		}()
+	}
+
+	// The policies reach the proxies eventually, probe until the decisions converge.
+	_, probeSpan := startSpan(ctx, "probe")
+	defer func() {
+		probeSpan.setAttribute("attempts", result.Attempts)
+		probeSpan.setAttribute("passed", result.Passed)
+		probeSpan.end(nil)
+	}()
+	deadline := time.Now().Add(s.timeout)
+	for {
+		probes, err := probe(ctx, probeClient{namespace: s.namespace, target: "deploy/client", container: "client"}, "http://fortioserver:8080", s.profile)
+		if err != nil {
+			return err
+		}
+		result.Attempts++
+		result.Probes = probes
+		result.Passed = result.FailedProbes() == 0
+		if result.Passed || time.Now().After(deadline) {
+			return nil
+		}
+		select {
+		case <-time.After(s.interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
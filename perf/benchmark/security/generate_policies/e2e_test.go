@@ -0,0 +1,49 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIstioctlURL(t *testing.T) {
+	url := istioctlURL("1.22.0")
+	if !strings.HasPrefix(url, "https://github.com/istio/istio/releases/download/1.22.0/istioctl-1.22.0-") ||
+		!strings.HasSuffix(url, ".tar.gz") || strings.Contains(url, "darwin") {
+		t.Errorf("istioctlURL(1.22.0) = %s", url)
+	}
+}
+
+func TestProbeArgs(t *testing.T) {
+	r := TrafficRequest{
+		Method:       "POST",
+		Host:         "www.example.com",
+		Path:         "/route-1",
+		Headers:      map[string]string{"x-b": "2", "x-a": "1"},
+		HeaderValues: map[string][]string{"x_c": {"3", "4"}},
+	}
+	want := []string{"-n", "twopods-istio", "exec", "deploy/client", "-c", "client", "--",
+		"curl", "-s", "-o", "/dev/null", "-w", "%{http_code}", "-X", "POST",
+		"-H", "x-a: 1", "-H", "x-b: 2", "-H", "x_c: 3", "-H", "x_c: 4", "-H", "Host: www.example.com",
+		"http://fortioserver:8080/route-1"}
+	if got := probeArgs(probeClient{namespace: "twopods-istio", target: "deploy/client", container: "client"}, "http://fortioserver:8080", r); !reflect.DeepEqual(got, want) {
+		t.Errorf("probeArgs() = %q, want %q", got, want)
+	}
+	if got := probeArgs(probeClient{namespace: "ns", target: "pod/sleep"}, "http://s", TrafficRequest{Path: "/"}); got[12] != "GET" {
+		t.Errorf("probeArgs() sends %s without a method, want GET", got[12])
+	}
+}
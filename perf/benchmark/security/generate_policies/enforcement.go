@@ -0,0 +1,189 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	authzpb "istio.io/api/security/v1beta1"
+	typepb "istio.io/api/type/v1beta1"
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// enforcementPolicyName is the name of the DENY policy whose enforcement is measured.
+const enforcementPolicyName = "generate-policies-enforcement"
+
+// EnforcementResult records the time the proxies took to enforce a DENY policy applied after
+// every batch while probes were flowing, the propagation delay operators care about.
+type EnforcementResult struct {
+	// Request is the probe, allowed by the corpus and denied by the DENY policy.
+	Request TrafficRequest     `json:"request"`
+	Batches []BatchEnforcement `json:"batches"`
+}
+
+// BatchEnforcement is the enforcement of the DENY policy applied after a batch.
+type BatchEnforcement struct {
+	Index           int `json:"index"`
+	PoliciesApplied int `json:"policiesApplied"`
+	// SecondsToEnforcement is the time from the apply of the DENY policy to the response of the
+	// first probe it denied.
+	SecondsToEnforcement float64 `json:"secondsToEnforcement"`
+	Enforced             bool    `json:"enforced"`
+	// SecondsToLift is the time from the delete of the DENY policy to the response of the first
+	// probe allowed again.
+	SecondsToLift float64 `json:"secondsToLift"`
+	Lifted        bool    `json:"lifted"`
+	Probes        int     `json:"probes"`
+}
+
+// enforcementOptions configure the measure of the enforcement of the DENY policy.
+type enforcementOptions struct {
+	namespace string
+	selector  map[string]string
+	client    probeClient
+	url       string
+	request   TrafficRequest
+	interval  time.Duration
+	timeout   time.Duration
+}
+
+// enforcementPolicy returns the DENY policy matching the method and path of r.
+func enforcementPolicy(namespace string, selector map[string]string, r TrafficRequest) (string, error) {
+	method := r.Method
+	if method == "" {
+		method = "GET"
+	}
+	spec := &authzpb.AuthorizationPolicy{
+		Action: authzpb.AuthorizationPolicy_DENY,
+		Rules: []*authzpb.Rule{{To: []*authzpb.Rule_To{{Operation: &authzpb.Operation{
+			Methods: []string{method},
+			Paths:   []string{r.Path},
+		}}}}},
+	}
+	if len(selector) > 0 {
+		spec.Selector = &typepb.WorkloadSelector{MatchLabels: selector}
+	}
+	header := &generatepolicies.MyPolicy{
+		APIVersion: "security.istio.io/v1beta1",
+		Kind:       "AuthorizationPolicy",
+		Metadata:   generatepolicies.MetadataStruct{Namespace: namespace, Name: enforcementPolicyName},
+	}
+	return generatepolicies.PolicyToYAML(header, spec)
+}
+
+// waitOutcome sends probes every interval until one gets outcome or the timeout expires, and
+// returns the time from start to the response of that probe and the number of probes sent.
+func waitOutcome(ctx context.Context, send func(context.Context) (string, error), outcome string, start time.Time,
+	interval, timeout time.Duration) (seconds float64, probes int, reached bool, err error) {
+	deadline := start.Add(timeout)
+	for {
+		got, err := send(ctx)
+		if err != nil {
+			return time.Since(start).Seconds(), probes, false, err
+		}
+		probes++
+		if got == outcome {
+			return time.Since(start).Seconds(), probes, true, nil
+		}
+		if time.Now().After(deadline) {
+			return time.Since(start).Seconds(), probes, false, nil
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return time.Since(start).Seconds(), probes, false, ctx.Err()
+		}
+	}
+}
+
+// measureEnforcement applies the DENY policy of opts, probes until its request is denied, then
+// deletes it and probes until its request is allowed again.
+func measureEnforcement(ctx context.Context, opts enforcementOptions, index, applied int) (BatchEnforcement, error) {
+	b := BatchEnforcement{Index: index, PoliciesApplied: applied}
+	doc, err := enforcementPolicy(opts.namespace, opts.selector, opts.request)
+	if err != nil {
+		return b, err
+	}
+	profile := &TrafficProfile{Requests: []TrafficRequest{opts.request}}
+	send := func(ctx context.Context) (string, error) {
+		results, err := probe(ctx, opts.client, opts.url, profile)
+		if err != nil {
+			return "", err
+		}
+		return results[0].Outcome, nil
+	}
+	// The time to a denial only measures the DENY policy when the corpus allows the request.
+	outcome, err := send(ctx)
+	if err != nil {
+		return b, err
+	}
+	b.Probes++
+	if outcome != outcomeAllowed {
+		return b, fmt.Errorf("the enforcement probe of %s is %s before the DENY policy is applied", opts.request.Path, outcome)
+	}
+
+	start := time.Now()
+	if err := kubectlApply(ctx, []string{doc}); err != nil {
+		return b, err
+	}
+	deleted := false
+	defer func() {
+		if !deleted {
+			// Interrupted, do not leave the probe denied for the next run.
+			_, _ = kubectl(context.Background(), strings.NewReader(doc), "delete", "--ignore-not-found", "-f", "-")
+		}
+	}()
+	var n int
+	b.SecondsToEnforcement, n, b.Enforced, err = waitOutcome(ctx, send, outcomeDenied, start, opts.interval, opts.timeout)
+	b.Probes += n
+	if err != nil {
+		return b, err
+	}
+
+	start = time.Now()
+	if _, err := kubectl(ctx, strings.NewReader(doc), "delete", "--ignore-not-found", "-f", "-"); err != nil {
+		return b, err
+	}
+	deleted = true
+	b.SecondsToLift, n, b.Lifted, err = waitOutcome(ctx, send, outcomeAllowed, start, opts.interval, opts.timeout)
+	b.Probes += n
+	if err == nil && !b.Lifted {
+		err = fmt.Errorf("the enforcement probe is still not allowed %v after deleting the DENY policy", opts.timeout)
+	}
+	return b, err
+}
+
+// print writes the enforcement table of the batches to w.
+func (r *EnforcementResult) print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, strings.Join([]string{"batch", "policies", "time to enforcement (s)", "time to lift (s)", "probes"}, "\t")+"\t")
+	for _, b := range r.Batches {
+		enforcement := fmt.Sprintf("%.1f", b.SecondsToEnforcement)
+		if !b.Enforced {
+			enforcement = ">" + enforcement
+		}
+		lift := fmt.Sprintf("%.1f", b.SecondsToLift)
+		if !b.Lifted {
+			lift = ">" + lift
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%d\t\n", b.Index, b.PoliciesApplied, enforcement, lift, b.Probes)
+	}
+	return tw.Flush()
+}
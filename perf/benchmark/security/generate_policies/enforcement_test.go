@@ -0,0 +1,83 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnforcementPolicy(t *testing.T) {
+	doc, err := enforcementPolicy("twopods-istio", map[string]string{"app": "fortioserver"}, TrafficRequest{Path: "/api/v1/items"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects, err := parsePolicyObjects([]string{doc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Name != enforcementPolicyName || objects[0].Namespace != "twopods-istio" {
+		t.Fatalf("unexpected policy:\n%s", doc)
+	}
+	for _, want := range []string{"action: DENY", "app: fortioserver", "- GET", "- /api/v1/items"} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("policy has no %q:\n%s", want, doc)
+		}
+	}
+}
+
+func TestWaitOutcome(t *testing.T) {
+	outcomes := []string{outcomeAllowed, outcomeAllowed, outcomeDenied}
+	send := func(context.Context) (string, error) {
+		o := outcomes[0]
+		if len(outcomes) > 1 {
+			outcomes = outcomes[1:]
+		}
+		return o, nil
+	}
+	_, probes, reached, err := waitOutcome(context.Background(), send, outcomeDenied, time.Now(), time.Millisecond, time.Minute)
+	if err != nil || !reached || probes != 3 {
+		t.Errorf("got %d probes, reached %v, err %v, want 3 probes reaching the denial", probes, reached, err)
+	}
+
+	outcomes = []string{outcomeAllowed}
+	_, _, reached, err = waitOutcome(context.Background(), send, outcomeDenied, time.Now(), time.Millisecond, 5*time.Millisecond)
+	if err != nil || reached {
+		t.Errorf("got reached %v, err %v, want a timeout", reached, err)
+	}
+
+	failing := func(context.Context) (string, error) { return "", errors.New("exec failed") }
+	if _, _, _, err := waitOutcome(context.Background(), failing, outcomeDenied, time.Now(), time.Millisecond, time.Minute); err == nil {
+		t.Error("got no error from a failing probe")
+	}
+}
+
+func TestEnforcementPrint(t *testing.T) {
+	result := &EnforcementResult{Batches: []BatchEnforcement{
+		{Index: 0, PoliciesApplied: 100, SecondsToEnforcement: 1.5, Enforced: true, SecondsToLift: 1, Lifted: true, Probes: 20},
+		{Index: 1, PoliciesApplied: 200, SecondsToEnforcement: 120, SecondsToLift: 0.1, Lifted: true, Probes: 900},
+	}}
+	var out bytes.Buffer
+	if err := result.print(&out); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 3 || !strings.Contains(lines[2], ">120.0") {
+		t.Errorf("unexpected table:\n%s", out.String())
+	}
+}
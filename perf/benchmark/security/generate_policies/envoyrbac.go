@@ -0,0 +1,404 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+// envoyMatcher is a permission or a principal of an Envoy RBAC policy, in the YAML of the
+// envoy.extensions.filters.http.rbac.v3.RBAC filter.
+type envoyMatcher map[string]interface{}
+
+// envoyRBACSide holds the field names of the permissions or of the principals of a policy.
+type envoyRBACSide struct {
+	and, or, not, list string
+}
+
+var (
+	permissionSide = envoyRBACSide{and: "and_rules", or: "or_rules", not: "not_rule", list: "rules"}
+	principalSide  = envoyRBACSide{and: "and_ids", or: "or_ids", not: "not_id", list: "ids"}
+)
+
+// all returns the matcher matching every one of matchers, any request without matchers.
+func (s envoyRBACSide) all(matchers []envoyMatcher) envoyMatcher {
+	if len(matchers) == 0 {
+		return envoyMatcher{"any": true}
+	}
+	return envoyMatcher{s.and: map[string]interface{}{s.list: matchers}}
+}
+
+// constraint returns the matcher of c, matching one of its values or none of them.
+func (s envoyRBACSide) constraint(c constraint) (envoyMatcher, error) {
+	var matchers []envoyMatcher
+	for _, value := range c.values {
+		m, err := envoyValueMatcher(c.attribute, value)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	m := envoyMatcher{s.or: map[string]interface{}{s.list: matchers}}
+	if c.not {
+		m = envoyMatcher{s.not: m}
+	}
+	return m, nil
+}
+
+// matcher returns the matcher of the constraints.
+func (s envoyRBACSide) matcher(c clause) (envoyMatcher, error) {
+	var matchers []envoyMatcher
+	for _, constraint := range c {
+		m, err := s.constraint(constraint)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	return s.all(matchers), nil
+}
+
+// isPrincipalAttribute reports whether attribute is matched by the principals of a policy, the
+// other ones by its permissions.
+func isPrincipalAttribute(attribute string) bool {
+	return strings.HasPrefix(attribute, "source.") || attribute == "remote.ip" || strings.HasPrefix(attribute, "request.auth.")
+}
+
+// envoyStringMatch returns the string matcher of an exact, prefix, suffix or presence pattern.
+func envoyStringMatch(pattern string) map[string]interface{} {
+	switch {
+	case pattern == "*":
+		return map[string]interface{}{"safe_regex": map[string]interface{}{"regex": ".+"}}
+	case strings.HasSuffix(pattern, "*"):
+		return map[string]interface{}{"prefix": strings.TrimSuffix(pattern, "*")}
+	case strings.HasPrefix(pattern, "*"):
+		return map[string]interface{}{"suffix": strings.TrimPrefix(pattern, "*")}
+	default:
+		return map[string]interface{}{"exact": pattern}
+	}
+}
+
+// envoyPatternRegexp returns the regular expression of an exact, prefix, suffix or presence
+// pattern.
+func envoyPatternRegexp(pattern string) string {
+	if pattern == "*" {
+		return ".+"
+	}
+	return strings.Replace(regexp.QuoteMeta(pattern), `\*`, ".*", -1)
+}
+
+func envoyCIDR(value string) (map[string]interface{}, error) {
+	network := parseIPBlock(value)
+	if network == nil {
+		return nil, fmt.Errorf("invalid IP block %q", value)
+	}
+	prefixLen, _ := network.Mask.Size()
+	return map[string]interface{}{"address_prefix": network.IP.String(), "prefix_len": prefixLen}, nil
+}
+
+func envoyHeader(name string, match map[string]interface{}) envoyMatcher {
+	return envoyMatcher{"header": map[string]interface{}{"name": name, "string_match": match}}
+}
+
+// envoyMetadata returns the matcher of the request.auth attributes, set by Istio in the
+// istio_authn filter metadata.
+func envoyMetadata(path []string, value map[string]interface{}) envoyMatcher {
+	var keys []interface{}
+	for _, key := range path {
+		keys = append(keys, map[string]interface{}{"key": key})
+	}
+	return envoyMatcher{"metadata": map[string]interface{}{"filter": "istio_authn", "path": keys, "value": value}}
+}
+
+// envoyValueMatcher returns the matcher of value for attribute, the way istiod translates it.
+func envoyValueMatcher(attribute, value string) (envoyMatcher, error) {
+	switch attribute {
+	case "request.host":
+		match := envoyStringMatch(value)
+		match["ignore_case"] = true
+		return envoyHeader(":authority", match), nil
+	case "request.method":
+		return envoyHeader(":method", map[string]interface{}{"exact": value}), nil
+	case "request.path":
+		return envoyMatcher{"url_path": map[string]interface{}{"path": envoyStringMatch(value)}}, nil
+	case "destination.port":
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", value)
+		}
+		return envoyMatcher{"destination_port": port}, nil
+	case "connection.sni":
+		return envoyMatcher{"requested_server_name": envoyStringMatch(value)}, nil
+	case "source.principal":
+		match := envoyStringMatch(value)
+		if _, ok := match["suffix"]; !ok && value != "*" {
+			match = envoyStringMatch("spiffe://" + value)
+		}
+		return envoyMatcher{"authenticated": map[string]interface{}{"principal_name": match}}, nil
+	case "source.namespace":
+		regex := fmt.Sprintf(".*/ns/%s/.*", envoyPatternRegexp(value))
+		return envoyMatcher{"authenticated": map[string]interface{}{"principal_name": map[string]interface{}{
+			"safe_regex": map[string]interface{}{"regex": regex},
+		}}}, nil
+	case "source.ip", "remote.ip", "destination.ip":
+		cidr, err := envoyCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		field := map[string]string{"source.ip": "direct_remote_ip", "remote.ip": "remote_ip", "destination.ip": "destination_ip"}[attribute]
+		return envoyMatcher{field: cidr}, nil
+	}
+	if m := headerKeyRegexp.FindStringSubmatch(attribute); m != nil {
+		if value == "*" {
+			return envoyMatcher{"header": map[string]interface{}{"name": m[1], "present_match": true}}, nil
+		}
+		return envoyHeader(m[1], envoyStringMatch(value)), nil
+	}
+	if m := claimKeyRegexp.FindStringSubmatch(attribute); m != nil {
+		return envoyMetadata([]string{"request.auth.claims", m[1]}, map[string]interface{}{
+			"list_match": map[string]interface{}{"one_of": map[string]interface{}{"string_match": envoyStringMatch(value)}},
+		}), nil
+	}
+	if strings.HasPrefix(attribute, "request.auth.") {
+		return envoyMetadata([]string{attribute}, map[string]interface{}{"string_match": envoyStringMatch(value)}), nil
+	}
+	return nil, fmt.Errorf("unsupported attribute %s", attribute)
+}
+
+// envoyRBACPolicy returns the Envoy RBAC policy of rule: its permissions match one of its to
+// entries and its conditions on the request, its principals one of its from entries and its
+// conditions on the source.
+func envoyRBACPolicy(rule *authzpb.Rule) (map[string]interface{}, error) {
+	var permissionConditions, principalConditions clause
+	for _, condition := range rule.When {
+		conditions := &permissionConditions
+		if isPrincipalAttribute(condition.Key) {
+			conditions = &principalConditions
+		}
+		*conditions = appendConstraint(*conditions, condition.Key, condition.Values, false)
+		*conditions = appendConstraint(*conditions, condition.Key, condition.NotValues, true)
+	}
+
+	operations := []clause{nil}
+	if len(rule.To) > 0 {
+		operations = nil
+		for _, to := range rule.To {
+			operations = append(operations, operationConstraints(to.GetOperation()))
+		}
+	}
+	sources := []clause{nil}
+	if len(rule.From) > 0 {
+		sources = nil
+		for _, from := range rule.From {
+			sources = append(sources, sourceConstraints(from.GetSource()))
+		}
+	}
+	var permissions, principals []envoyMatcher
+	for _, operation := range operations {
+		m, err := permissionSide.matcher(append(operation, permissionConditions...))
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, m)
+	}
+	for _, source := range sources {
+		m, err := principalSide.matcher(append(source, principalConditions...))
+		if err != nil {
+			return nil, err
+		}
+		principals = append(principals, m)
+	}
+	return map[string]interface{}{"permissions": permissions, "principals": principals}, nil
+}
+
+// envoyRBACFilter returns the RBAC HTTP filter of the rules of policies with action.
+func envoyRBACFilter(policies []parsedAuthorizationPolicy, action authzpb.AuthorizationPolicy_Action) (map[string]interface{}, error) {
+	rbacPolicies := map[string]interface{}{}
+	for _, p := range policies {
+		if p.Spec.Action != action {
+			continue
+		}
+		for i, rule := range p.Spec.Rules {
+			policy, err := envoyRBACPolicy(rule)
+			if err != nil {
+				return nil, fmt.Errorf("%s/%s rule %d: %v", p.Namespace, p.Name, i, err)
+			}
+			rbacPolicies[fmt.Sprintf("ns[%s]-policy[%s]-rule[%d]", p.Namespace, p.Name, i)] = policy
+		}
+	}
+	return map[string]interface{}{
+		"name": "envoy.filters.http.rbac",
+		"typed_config": map[string]interface{}{
+			"@type": "type.googleapis.com/envoy.extensions.filters.http.rbac.v3.RBAC",
+			"rules": map[string]interface{}{"action": action.String(), "policies": rbacPolicies},
+		},
+	}, nil
+}
+
+// enforcedPolicies returns the ALLOW and DENY policies applying to w, and the number of CUSTOM
+// and AUDIT policies applying to it.
+func enforcedPolicies(policies []parsedAuthorizationPolicy, w workload, rootNamespace string) ([]parsedAuthorizationPolicy, int) {
+	var applying []parsedAuthorizationPolicy
+	skipped := 0
+	for _, p := range policies {
+		if !w.appliesTo(p, rootNamespace) {
+			continue
+		}
+		if p.Spec.Action != authzpb.AuthorizationPolicy_ALLOW && p.Spec.Action != authzpb.AuthorizationPolicy_DENY {
+			skipped++
+			continue
+		}
+		applying = append(applying, p)
+	}
+	return applying, skipped
+}
+
+// envoyBootstrap returns the bootstrap of a standalone Envoy enforcing the DENY and ALLOW
+// AuthorizationPolicies of policies applying to w, as istiod configures its sidecar: a DENY RBAC
+// filter followed by an ALLOW one, for the actions of the applying policies, in front of upstream, or of a direct 200
+// response without upstream. It also returns the number of policies applying to w and of
+// CUSTOM and AUDIT policies, which are not enforced.
+func envoyBootstrap(policies []parsedAuthorizationPolicy, w workload, rootNamespace string, port, adminPort int, upstream string) (string, int, int, error) {
+	applying, skipped := enforcedPolicies(policies, w, rootNamespace)
+	actions := map[authzpb.AuthorizationPolicy_Action]bool{}
+	for _, p := range applying {
+		actions[p.Spec.Action] = true
+	}
+
+	var filters []interface{}
+	for _, action := range []authzpb.AuthorizationPolicy_Action{authzpb.AuthorizationPolicy_DENY, authzpb.AuthorizationPolicy_ALLOW} {
+		if !actions[action] {
+			continue
+		}
+		filter, err := envoyRBACFilter(applying, action)
+		if err != nil {
+			return "", 0, 0, err
+		}
+		filters = append(filters, filter)
+	}
+	filters = append(filters, map[string]interface{}{
+		"name":         "envoy.filters.http.router",
+		"typed_config": map[string]interface{}{"@type": "type.googleapis.com/envoy.extensions.filters.http.router.v3.Router"},
+	})
+
+	route := map[string]interface{}{
+		"match":           map[string]interface{}{"prefix": "/"},
+		"direct_response": map[string]interface{}{"status": 200, "body": map[string]interface{}{"inline_string": "allowed\n"}},
+	}
+	var clusters []interface{}
+	if upstream != "" {
+		host, upstreamPort, err := net.SplitHostPort(upstream)
+		if err != nil {
+			return "", 0, 0, fmt.Errorf("invalid upstream %q: %v", upstream, err)
+		}
+		portValue, err := strconv.Atoi(upstreamPort)
+		if err != nil {
+			return "", 0, 0, fmt.Errorf("invalid upstream %q: %v", upstream, err)
+		}
+		route = map[string]interface{}{
+			"match": map[string]interface{}{"prefix": "/"},
+			"route": map[string]interface{}{"cluster": "upstream"},
+		}
+		clusters = append(clusters, map[string]interface{}{
+			"name":            "upstream",
+			"type":            "STRICT_DNS",
+			"connect_timeout": "1s",
+			"load_assignment": map[string]interface{}{
+				"cluster_name": "upstream",
+				"endpoints": []interface{}{map[string]interface{}{"lb_endpoints": []interface{}{map[string]interface{}{
+					"endpoint": map[string]interface{}{"address": envoySocketAddress(host, portValue)},
+				}}}},
+			},
+		})
+	}
+
+	bootstrap := map[string]interface{}{
+		"admin": map[string]interface{}{"address": envoySocketAddress("127.0.0.1", adminPort)},
+		"static_resources": map[string]interface{}{
+			"listeners": []interface{}{map[string]interface{}{
+				"name":    "rbac",
+				"address": envoySocketAddress("0.0.0.0", port),
+				"filter_chains": []interface{}{map[string]interface{}{"filters": []interface{}{map[string]interface{}{
+					"name": "envoy.filters.network.http_connection_manager",
+					"typed_config": map[string]interface{}{
+						"@type":       "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager",
+						"stat_prefix": "rbac",
+						"route_config": map[string]interface{}{"virtual_hosts": []interface{}{map[string]interface{}{
+							"name":    "workload",
+							"domains": []string{"*"},
+							"routes":  []interface{}{route},
+						}}},
+						"http_filters": filters,
+					},
+				}}}},
+			}},
+		},
+	}
+	if clusters != nil {
+		bootstrap["static_resources"].(map[string]interface{})["clusters"] = clusters
+	}
+	doc, err := yaml.Marshal(bootstrap)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return string(doc), len(applying), skipped, nil
+}
+
+func envoySocketAddress(address string, port int) map[string]interface{} {
+	return map[string]interface{}{"socket_address": map[string]interface{}{"address": address, "port_value": port}}
+}
+
+func runEnvoyRBAC(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("envoy-rbac", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the generated policies")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	policyFile := fs.String("policyFile", "", "A YAML file of policies to render instead of the generated ones")
+	rootNamespace := fs.String("rootNamespace", "istio-system", "The root namespace, its policies apply to every namespace")
+	namespace := fs.String("namespace", "twopods-istio", "The namespace of the workload whose policies are rendered")
+	labels := fs.String("labels", "app=fortioserver", "The labels of the workload whose policies are rendered, as key=value,...")
+	port := fs.Int("port", 8080, "The port of the listener enforcing the policies")
+	adminPort := fs.Int("adminPort", 9901, "The port of the Envoy admin interface, on localhost")
+	upstream := fs.String("upstream", "", "The host:port the allowed requests are forwarded to, by default they get a direct 200 response")
+	_ = fs.Parse(args)
+
+	policies, err := loadAuthorizationPolicies(ctx, *scenarioName, *configFile, *policyFile)
+	if err != nil {
+		return err
+	}
+	workloadLabels, err := parseLabels(*labels)
+	if err != nil {
+		return err
+	}
+	bootstrap, applying, skipped, err := envoyBootstrap(policies, workload{namespace: *namespace, labels: workloadLabels},
+		*rootNamespace, *port, *adminPort, *upstream)
+	if err != nil {
+		return err
+	}
+	fmt.Print(bootstrap)
+	fmt.Fprintf(os.Stderr, "rendered %d of %d policies applying to the workload, skipped %d CUSTOM and AUDIT policies\n",
+		applying, len(policies), skipped)
+	return nil
+}
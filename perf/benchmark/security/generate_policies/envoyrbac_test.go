@@ -0,0 +1,160 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestEnvoyRBACPolicy(t *testing.T) {
+	policies, err := parseAuthorizationPolicies(splitYAMLDocuments(`
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: allow
+  namespace: ns
+spec:
+  rules:
+  - from:
+    - source:
+        principals: ["cluster.local/ns/other/sa/sleep"]
+        notNamespaces: ["blocked"]
+    to:
+    - operation:
+        methods: ["GET"]
+        paths: ["/api/*"]
+    when:
+    - key: request.headers[x-token]
+      values: ["*"]
+    - key: source.ip
+      values: ["10.0.0.0/8"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := envoyRBACPolicy(policies[0].Spec.Rules[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := yaml.Marshal(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The header condition is a permission, the source IP condition a principal.
+	want := `permissions:
+- and_rules:
+    rules:
+    - or_rules:
+        rules:
+        - header:
+            name: :method
+            string_match:
+              exact: GET
+    - or_rules:
+        rules:
+        - url_path:
+            path:
+              prefix: /api/
+    - or_rules:
+        rules:
+        - header:
+            name: x-token
+            present_match: true
+principals:
+- and_ids:
+    ids:
+    - or_ids:
+        ids:
+        - authenticated:
+            principal_name:
+              exact: spiffe://cluster.local/ns/other/sa/sleep
+    - not_id:
+        or_ids:
+          ids:
+          - authenticated:
+              principal_name:
+                safe_regex:
+                  regex: .*/ns/blocked/.*
+    - or_ids:
+        ids:
+        - direct_remote_ip:
+            address_prefix: 10.0.0.0
+            prefix_len: 8
+`
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEnvoyBootstrap(t *testing.T) {
+	policies, err := parseAuthorizationPolicies(splitYAMLDocuments(`
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: deny
+  namespace: istio-system
+spec:
+  action: DENY
+  rules:
+  - to:
+    - operation:
+        ports: ["9090"]
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: other-workload
+  namespace: ns
+spec:
+  selector:
+    matchLabels:
+      app: b
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: custom
+  namespace: ns
+spec:
+  action: CUSTOM
+  provider:
+    name: ext-authz
+  rules:
+  - {}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bootstrap, applying, skipped, err := envoyBootstrap(policies, workload{namespace: "ns", labels: map[string]string{"app": "a"}},
+		"istio-system", 8080, 9901, "backend:8000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applying != 1 || skipped != 1 {
+		t.Errorf("got %d applying and %d skipped policies, want 1 and 1", applying, skipped)
+	}
+	// Without ALLOW policies there is no ALLOW filter, which would deny every request.
+	if got := strings.Count(bootstrap, "envoy.filters.http.rbac\n"); got != 1 {
+		t.Errorf("got %d RBAC filters, want 1:\n%s", got, bootstrap)
+	}
+	for _, want := range []string{"action: DENY", "ns[istio-system]-policy[deny]-rule[0]:", "destination_port: 9090", "cluster: upstream", "address: backend"} {
+		if !strings.Contains(bootstrap, want) {
+			t.Errorf("the bootstrap does not contain %q:\n%s", want, bootstrap)
+		}
+	}
+}
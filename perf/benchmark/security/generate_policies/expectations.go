@@ -0,0 +1,150 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// ExpectationsFile lists requests with the decision the generated policies are expected to take
+// on them, for test frameworks verifying the enforcement of a deployed corpus.
+type ExpectationsFile struct {
+	Scenario string `json:"scenario,omitempty"`
+	// Namespace and Labels identify the workload receiving the requests.
+	Namespace    string            `json:"namespace"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Expectations []Expectation     `json:"expectations"`
+}
+
+// Expectation is the decision expected on a request and the policy taking it.
+type Expectation struct {
+	Request TrafficRequest `json:"request"`
+	// Attributes are the attributes of the request the policies match on, e.g. request.path or
+	// request.auth.claims[iss].
+	Attributes map[string][]string `json:"attributes"`
+	Decision   string              `json:"decision"`
+	// Policy and Rule are the policy and the rule taking the decision, empty when none matches.
+	Policy string `json:"policy,omitempty"`
+	Rule   string `json:"rule,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// requestAttributes returns the attributes of r as seen by the RBAC filter, including the claims
+// of the bearer token of its Authorization header.
+func requestAttributes(r TrafficRequest) (simulatedRequest, error) {
+	request := simulatedRequest{}
+	method := r.Method
+	if method == "" {
+		method = "GET"
+	}
+	request.set("request.method", method)
+	request.set("request.path", strings.SplitN(r.Path, "?", 2)[0])
+	request.set("request.host", r.Host)
+	for name, value := range r.Headers {
+		request.set(fmt.Sprintf("request.headers[%s]", name), value)
+		if strings.EqualFold(name, "Authorization") && strings.HasPrefix(value, "Bearer ") {
+			claims, err := tokenClaims(strings.TrimPrefix(value, "Bearer "))
+			if err != nil {
+				return nil, err
+			}
+			setToken(request, claims)
+		}
+	}
+	for name, values := range r.HeaderValues {
+		request.set(fmt.Sprintf("request.headers[%s]", name), values...)
+	}
+	return request, nil
+}
+
+// tokenClaims returns the claims of a JWT without verifying its signature.
+func tokenClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid token: %d segments", len(parts))
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token payload: %v", err)
+	}
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("invalid token payload: %v", err)
+	}
+	return claims, nil
+}
+
+// buildExpectations returns the decisions the policies generated from policyData take on the
+// requests sampled from their rules, as decided by the simulator.
+func buildExpectations(policyData generatepolicies.SecurityPolicy, docs []string) (*ExpectationsFile, error) {
+	policies, err := parseAuthorizationPolicies(docs)
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		return nil, fmt.Errorf("no AuthorizationPolicies to build expectations from")
+	}
+	allowed, denied, err := trafficCandidates(policyData)
+	if err != nil {
+		return nil, err
+	}
+	// The requests are sent to the workload of the first policy, the only one when the policies
+	// are spread over several selectors.
+	expectations := &ExpectationsFile{
+		Namespace: policies[0].Namespace,
+		Labels:    policies[0].Spec.GetSelector().GetMatchLabels(),
+	}
+	w := workload{namespace: expectations.Namespace, labels: expectations.Labels}
+	for _, r := range append(allowed, denied...) {
+		request, err := requestAttributes(r)
+		if err != nil {
+			return nil, err
+		}
+		d := evaluate(policies, w, "", request)
+		e := Expectation{Request: r, Attributes: request, Decision: expectDeny, Reason: d.Reason}
+		if d.Allowed {
+			e.Decision = expectAllow
+		}
+		if d.Rule != nil {
+			e.Policy, e.Rule = d.Rule.policy.String(), d.Rule.String()
+		}
+		e.Request.Expect = e.Decision
+		expectations.Expectations = append(expectations.Expectations, e)
+	}
+	return expectations, nil
+}
+
+// writeExpectations writes the expectations of the policies generated from policyData to
+// expectationsFile. It is a no-op when expectationsFile is empty.
+func writeExpectations(scenarioName string, policyData generatepolicies.SecurityPolicy, docs []string, expectationsFile string) error {
+	if expectationsFile == "" {
+		return nil
+	}
+	expectations, err := buildExpectations(policyData, docs)
+	if err != nil {
+		return err
+	}
+	expectations.Scenario = scenarioName
+	data, err := json.MarshalIndent(expectations, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(expectationsFile, data, 0644)
+}
@@ -0,0 +1,76 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+func TestBuildExpectations(t *testing.T) {
+	inTempDir(t)
+	for _, scenario := range []string{"path-matrix", "jwt-heavy"} {
+		policyData, err := loadSecurityPolicy(scenario, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs, err := generatePolicies(context.Background(), policyData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectations, err := buildExpectations(policyData, docs)
+		if err != nil {
+			t.Fatalf("%s: %v", scenario, err)
+		}
+		decisions := map[string]int{}
+		for _, e := range expectations.Expectations {
+			decisions[e.Decision]++
+			if e.Request.Expect != e.Decision {
+				t.Errorf("%s: the request of %+v expects %s", scenario, e, e.Request.Expect)
+			}
+			if (e.Decision == expectAllow) != (e.Policy != "") {
+				t.Errorf("%s: %s decision taken by policy %q: %s", scenario, e.Decision, e.Policy, e.Reason)
+			}
+		}
+		if decisions[expectAllow] == 0 || decisions[expectDeny] == 0 {
+			t.Errorf("%s: expected both allowed and denied requests, got %v", scenario, decisions)
+		}
+	}
+}
+
+func TestRequestAttributesClaims(t *testing.T) {
+	inTempDir(t)
+	policyData, err := loadSecurityPolicy("jwt-heavy", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, err := tokenTraffic(policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := requestAttributes(profile.Requests[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := generatepolicies.TokenClaims(policyData)["iss"]
+	if got := request.values("request.auth.claims[iss]"); len(got) != 1 || got[0] != iss {
+		t.Errorf("request.auth.claims[iss] = %v, want [%v]", got, iss)
+	}
+	if got := request.values("request.method"); len(got) != 1 || got[0] != "GET" {
+		t.Errorf("request.method = %v, want [GET]", got)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+// explainNouns are the nouns naming the values of the attributes of sources and operations.
+var explainNouns = map[string]string{
+	"source.principal":       "principals",
+	"request.auth.principal": "request principals",
+	"source.namespace":       "namespaces",
+	"source.ip":              "IP blocks",
+	"remote.ip":              "remote IP blocks",
+	"request.host":           "hosts",
+	"destination.port":       "ports",
+	"request.method":         "methods",
+	"request.path":           "paths",
+}
+
+// explainValues returns the values joined by commas, the ones beyond max summarized by their count.
+func explainValues(values []string, max int) string {
+	if max > 0 && len(values) > max {
+		return fmt.Sprintf("%s (+%d more)", strings.Join(values[:max], ","), len(values)-max)
+	}
+	return strings.Join(values, ",")
+}
+
+// explainConstraint returns c in English, e.g. "paths /a,/b" or "namespace other than x".
+func explainConstraint(c constraint, max int) string {
+	noun := explainNouns[c.attribute]
+	if len(c.values) == 1 {
+		noun = strings.TrimSuffix(noun, "s")
+	}
+	if c.not {
+		return fmt.Sprintf("%s other than %s", noun, explainValues(c.values, max))
+	}
+	return fmt.Sprintf("%s %s", noun, explainValues(c.values, max))
+}
+
+// explainKey returns the condition key in English, e.g. "claim groups" for
+// request.auth.claims[groups] and "header x-token" for request.headers[x-token].
+func explainKey(key string) string {
+	if m := claimKeyRegexp.FindStringSubmatch(key); m != nil {
+		return "claim " + strings.Join(strings.Split(m[1], "]["), ".")
+	}
+	if m := headerKeyRegexp.FindStringSubmatch(key); m != nil {
+		return "header " + m[1]
+	}
+	return key
+}
+
+// explainCondition returns the match of a condition key by values, e.g. "claim y=z".
+func explainCondition(key string, values []string, max int) string {
+	if len(values) == 1 {
+		return explainKey(key) + "=" + values[0]
+	}
+	return fmt.Sprintf("%s in %s", explainKey(key), explainValues(values, max))
+}
+
+// explainClause returns the constraints of a source or an operation ANDed, or "" without any.
+func explainClause(c clause, max int) string {
+	parts := make([]string, len(c))
+	for i, constraint := range c {
+		parts[i] = explainConstraint(constraint, max)
+	}
+	return strings.Join(parts, " and ")
+}
+
+// explainRule returns the requests matched by rule in English, e.g. "requests to paths /a,/b
+// from namespace x unless claim y=z". The from and to entries are ORed, the positive conditions
+// are ANDed after "when", and since a rule does not match a request with a value excluded by any
+// condition, the negative ones are ORed after "unless".
+func explainRule(rule *authzpb.Rule, max int) string {
+	var b strings.Builder
+	b.WriteString("requests")
+	var operations []string
+	for _, to := range rule.To {
+		if op := explainClause(operationConstraints(to.GetOperation()), max); op != "" {
+			operations = append(operations, op)
+		}
+	}
+	if len(operations) > 0 {
+		b.WriteString(" to " + strings.Join(operations, " or "))
+	}
+	var sources []string
+	for _, from := range rule.From {
+		if source := explainClause(sourceConstraints(from.GetSource()), max); source != "" {
+			sources = append(sources, source)
+		}
+	}
+	if len(sources) > 0 {
+		b.WriteString(" from " + strings.Join(sources, " or "))
+	}
+	var when, unless []string
+	for _, condition := range rule.When {
+		if len(condition.Values) > 0 {
+			when = append(when, explainCondition(condition.Key, condition.Values, max))
+		}
+		if len(condition.NotValues) > 0 {
+			unless = append(unless, explainCondition(condition.Key, condition.NotValues, max))
+		}
+	}
+	if len(when) > 0 {
+		b.WriteString(" when " + strings.Join(when, " and "))
+	}
+	if len(unless) > 0 {
+		b.WriteString(" unless " + strings.Join(unless, " or "))
+	}
+	if b.Len() == len("requests") {
+		return "all requests"
+	}
+	return b.String()
+}
+
+// explainWorkloads returns the workloads policy applies to in English.
+func explainWorkloads(policy parsedAuthorizationPolicy, rootNamespace string) string {
+	labels := policy.Spec.GetSelector().GetMatchLabels()
+	scope := "every workload of namespace " + policy.Namespace
+	if policy.Namespace == rootNamespace {
+		scope = "every workload of the mesh"
+	}
+	if len(labels) == 0 {
+		return scope
+	}
+	var matches []string
+	for _, k := range getSortedLabelKeys(labels) {
+		matches = append(matches, k+"="+labels[k])
+	}
+	return scope + " labeled " + strings.Join(matches, ",")
+}
+
+// explainPolicy returns policy in English: the workloads it applies to, followed by a line per
+// rule, each starting with the action.
+func explainPolicy(policy parsedAuthorizationPolicy, rootNamespace string, max int) []string {
+	action := policy.Spec.Action.String()
+	if policy.Spec.Action == authzpb.AuthorizationPolicy_CUSTOM {
+		action = fmt.Sprintf("CUSTOM (provider %s)", policy.Spec.GetProvider().GetName())
+	}
+	lines := []string{fmt.Sprintf("%s applies to %s:", policy, explainWorkloads(policy, rootNamespace))}
+	if len(policy.Spec.Rules) == 0 {
+		if policy.Spec.Action == authzpb.AuthorizationPolicy_ALLOW {
+			return append(lines, "  ALLOW nothing, every request is denied unless another ALLOW policy matches it")
+		}
+		return append(lines, fmt.Sprintf("  %s nothing", action))
+	}
+	for _, rule := range policy.Spec.Rules {
+		lines = append(lines, fmt.Sprintf("  %s %s", action, explainRule(rule, max)))
+	}
+	return lines
+}
+
+// explain writes the English summary of every policy to w.
+func explain(w io.Writer, policies []parsedAuthorizationPolicy, rootNamespace string, max int) {
+	for i, policy := range policies {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		for _, line := range explainPolicy(policy, rootNamespace, max) {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+func runExplain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the generated policies")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	policyFile := fs.String("policyFile", "", "A YAML file of policies to explain instead of the generated ones")
+	rootNamespace := fs.String("rootNamespace", "istio-system", "The root namespace, its policies apply to every namespace")
+	maxValues := fs.Int("maxValues", 5, "The number of values of a field to list, the others are counted, 0 lists them all")
+	_ = fs.Parse(args)
+
+	policies, err := loadAuthorizationPolicies(ctx, *scenarioName, *configFile, *policyFile)
+	if err != nil {
+		return err
+	}
+	explain(os.Stdout, policies, *rootNamespace, *maxValues)
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	policies, err := parseAuthorizationPolicies(splitYAMLDocuments(`
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: deny
+  namespace: ns
+spec:
+  action: DENY
+  selector:
+    matchLabels:
+      app: web
+  rules:
+  - to:
+    - operation:
+        paths: ["/a", "/b"]
+    from:
+    - source:
+        namespaces: ["x"]
+    when:
+    - key: request.auth.claims[y]
+      notValues: ["z"]
+  - {}
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: allow-nothing
+  namespace: istio-system
+spec: {}
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: allow
+  namespace: ns
+spec:
+  rules:
+  - from:
+    - source:
+        principals: ["a", "b", "c"]
+        notIpBlocks: ["10.0.0.0/8"]
+    - source:
+        requestPrincipals: ["iss/sub"]
+    to:
+    - operation:
+        methods: ["GET"]
+    when:
+    - key: request.headers[x-token]
+      values: ["t1", "t2"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	explain(&b, policies, "istio-system", 2)
+	want := `ns/deny applies to every workload of namespace ns labeled app=web:
+  DENY requests to paths /a,/b from namespace x unless claim y=z
+  DENY all requests
+
+istio-system/allow-nothing applies to every workload of the mesh:
+  ALLOW nothing, every request is denied unless another ALLOW policy matches it
+
+ns/allow applies to every workload of namespace ns:
+  ALLOW requests to method GET from principals a,b (+1 more) and IP block other than 10.0.0.0/8 or request principal iss/sub when header x-token in t1,t2
+`
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
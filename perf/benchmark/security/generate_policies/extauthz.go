@@ -0,0 +1,314 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// extAuthzDenyHeader makes the mock ext_authz server deny a request when set to "deny".
+const extAuthzDenyHeader = "x-ext-authz"
+
+// ExtAuthzResult compares load with and without the CUSTOM policies applied.
+type ExtAuthzResult struct {
+	Baseline     *LoadResult    `json:"baseline"`
+	ExtAuthz     *LoadResult    `json:"extAuthz"`
+	AddedLatency LatencySummary `json:"addedLatency"`
+}
+
+var extAuthzMockTemplate = template.Must(template.New("mock").Parse(`apiVersion: v1
+kind: Service
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+spec:
+  selector:
+    app: {{.Name}}
+  ports:
+  - name: http
+    port: {{.Port}}
+  - name: grpc
+    port: {{.GRPCPort}}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: {{.Name}}
+  template:
+    metadata:
+      labels:
+        app: {{.Name}}
+      annotations:
+        sidecar.istio.io/inject: "false"
+    spec:
+      containers:
+      - name: ext-authz
+        image: {{.Image}}
+        args: ["ext-authz", "serve", "-port={{.Port}}", "-grpcPort={{.GRPCPort}}", "-latency={{.Latency}}"]
+        ports:
+        - containerPort: {{.Port}}
+        - containerPort: {{.GRPCPort}}
+`))
+
+type extAuthzMock struct {
+	Name      string
+	Namespace string
+	Image     string
+	Port      int
+	GRPCPort  int
+	Latency   time.Duration
+}
+
+func runExtAuthz(ctx context.Context, args []string) error {
+	commands := map[string]func(ctx context.Context, args []string) error{
+		"serve":    runExtAuthzServe,
+		"generate": runExtAuthzGenerate,
+		"measure":  runExtAuthzMeasure,
+	}
+	if len(args) == 0 || commands[args[0]] == nil {
+		return fmt.Errorf("usage: ext-authz <serve|generate|measure> [flags]")
+	}
+	return commands[args[0]](ctx, args[1:])
+}
+
+// runExtAuthzServe serves the HTTP check API of envoyExtAuthzHttp providers and the gRPC
+// envoy.service.auth.v3.Authorization service of envoyExtAuthzGrpc providers.
+func runExtAuthzServe(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("ext-authz serve", flag.ExitOnError)
+	port := fs.Int("port", 8000, "The port to serve HTTP ext_authz check requests on")
+	grpcPort := fs.Int("grpcPort", 9000, "The port to serve gRPC ext_authz check requests on, 0 to serve only HTTP")
+	latency := fs.Duration("latency", 0, "The time each check request takes")
+	_ = fs.Parse(args)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(*latency)
+		if r.Header.Get(extAuthzDenyHeader) == "deny" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	if *grpcPort == 0 {
+		log.Printf("serving ext_authz checks on :%d with %v latency", *port, *latency)
+		return serveHTTP(ctx, fmt.Sprintf(":%d", *port), handler)
+	}
+	log.Printf("serving ext_authz checks on :%d and gRPC checks on :%d with %v latency", *port, *grpcPort, *latency)
+	// Both servers stop when the first of them fails.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serveGRPCExtAuthz(ctx, fmt.Sprintf(":%d", *grpcPort), mockGRPCCheck{latency: *latency})
+		cancel()
+	}()
+	err := serveHTTP(ctx, fmt.Sprintf(":%d", *port), handler)
+	cancel()
+	if grpcErr := <-errc; err == nil {
+		err = grpcErr
+	}
+	return err
+}
+
+func runExtAuthzGenerate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("ext-authz generate", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "Optional config json file with the rules of the CUSTOM policies")
+	namespace := fs.String("namespace", "twopods-istio", "The namespace of the mock server and the policies")
+	provider := fs.String("provider", "mock-ext-authz", "The name of the mock server and its extension provider")
+	image := fs.String("image", "generate-policies:latest", "The image of this tool, used to run the mock server")
+	port := fs.Int("port", 8000, "The HTTP port of the mock server")
+	grpcPort := fs.Int("grpcPort", 9000, "The gRPC port of the mock server")
+	providerType := fs.String("providerType", "http", "The check API of the extension provider: http for envoyExtAuthzHttp or grpc for envoyExtAuthzGrpc")
+	latency := fs.Duration("latency", 5*time.Millisecond, "The time the mock server takes for each check request")
+	numPolicies := fs.Int("numPolicies", 1, "The number of CUSTOM policies")
+	selector := fs.String("selector", "app=fortioserver", "Comma separated key=value labels of the workloads the policies apply to")
+	mockFile := fs.String("mockFile", "ext-authz-mock.yaml", "The file the mock server Deployment and Service are written to")
+	meshConfigFile := fs.String("meshConfigFile", "meshconfig.yaml", "The file the IstioOperator overlay with the extension provider of the mock is written to")
+	_ = fs.Parse(args)
+
+	if *providerType != "http" && *providerType != "grpc" {
+		return fmt.Errorf("invalid providerType %q: must be http or grpc", *providerType)
+	}
+	policyData, err := loadSecurityPolicy("", *configFile)
+	if err != nil {
+		return err
+	}
+	labels, err := parseLabels(*selector)
+	if err != nil {
+		return err
+	}
+	policyData.Namespace = *namespace
+	policyData.AuthZ.Action = "CUSTOM"
+	policyData.AuthZ.Provider = *provider
+	policyData.AuthZ.NumPolicies = *numPolicies
+	policyData.AuthZ.Selector = labels
+	policyData.PeerAuthN.NumPolicies = 0
+	policyData.RequestAuthN.NumPolicies = 0
+
+	mock := extAuthzMock{Name: *provider, Namespace: *namespace, Image: *image, Port: *port, GRPCPort: *grpcPort, Latency: *latency}
+	var manifest bytes.Buffer
+	if err := extAuthzMockTemplate.Execute(&manifest, mock); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(*mockFile, manifest.Bytes(), 0644); err != nil {
+		return err
+	}
+	extensionProvider := generatepolicies.ExtensionProvider{
+		Name:                  mock.Name,
+		Type:                  generatepolicies.ExtAuthzHTTPProvider,
+		Service:               fmt.Sprintf("%s.%s.svc.cluster.local", mock.Name, mock.Namespace),
+		Port:                  mock.Port,
+		IncludeHeadersInCheck: []string{extAuthzDenyHeader},
+	}
+	if *providerType == "grpc" {
+		// A gRPC provider is sent all the headers of the request.
+		extensionProvider.Type, extensionProvider.Port, extensionProvider.IncludeHeadersInCheck =
+			generatepolicies.ExtAuthzGRPCProvider, mock.GRPCPort, nil
+	}
+	policyData.ExtensionProviders = append(policyData.ExtensionProviders, extensionProvider)
+	meshConfig, err := generatepolicies.MeshConfig(policyData)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(*meshConfigFile, []byte(meshConfig), 0644); err != nil {
+		return err
+	}
+
+	policies, err := generatePolicies(ctx, policyData)
+	if err != nil {
+		return err
+	}
+	for _, policy := range policies {
+		fmt.Println(policy + "---")
+	}
+	return nil
+}
+
+func runExtAuthzMeasure(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("ext-authz measure", flag.ExitOnError)
+	url := fs.String("url", "", "The URL of the workload protected by the CUSTOM policies")
+	policyFile := fs.String("policyFile", "", "The file with the CUSTOM policies, as written by ext-authz generate")
+	qps := fs.Float64("qps", 100, "The requests per second, 0 sends as fast as possible")
+	conns := fs.Int("conns", 8, "The number of concurrent connections")
+	duration := fs.Duration("duration", 30*time.Second, "The duration of each load run")
+	settle := fs.Duration("settle", 30*time.Second, "The time to wait for the policies to take effect")
+	warmup := fs.Duration("warmup", 0, "The duration of a warmup phase excluded from each load run")
+	warmupRequests := fs.Int("warmupRequests", 0, "The number of requests of a warmup phase excluded from each load run")
+	outDir := fs.String("outDir", "run", "The directory the run report is written to")
+	_ = fs.Parse(args)
+
+	if *policyFile == "" {
+		return fmt.Errorf("policyFile is required")
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+	opts := loadOptions{
+		url:            *url,
+		qps:            *qps,
+		conns:          *conns,
+		duration:       *duration,
+		warmup:         *warmup,
+		warmupRequests: *warmupRequests,
+	}
+	report := newRunReport("ext-authz measure", "", fs)
+
+	result, err := measureExtAuthz(ctx, opts, *policyFile, *settle)
+	report.ExtAuthz = result
+	report.Interrupted = ctx.Err() != nil
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	report.EndTime = time.Now()
+	if writeErr := writeRunReport(*outDir, report); writeErr != nil {
+		return writeErr
+	}
+	if result != nil && result.ExtAuthz != nil {
+		fmt.Printf("added latency p50=%.3fms p90=%.3fms p99=%.3fms\n",
+			result.AddedLatency.P50, result.AddedLatency.P90, result.AddedLatency.P99)
+	}
+	return err
+}
+
+func measureExtAuthz(ctx context.Context, opts loadOptions, policyFile string, settle time.Duration) (*ExtAuthzResult, error) {
+	result := &ExtAuthzResult{}
+	baseline, err := runLoad(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	result.Baseline = baseline
+	if ctx.Err() != nil {
+		return result, fmt.Errorf("interrupted during the baseline run")
+	}
+
+	if _, err := kubectl(ctx, nil, "apply", "-f", policyFile); err != nil {
+		return result, err
+	}
+	defer func() {
+		// Delete the policies even when interrupted, so that the cluster is left clean.
+		if _, err := kubectl(context.Background(), nil, "delete", "-f", policyFile); err != nil {
+			log.Printf("failed to delete %s: %v", policyFile, err)
+		}
+	}()
+	select {
+	case <-time.After(settle):
+	case <-ctx.Done():
+		return result, fmt.Errorf("interrupted while waiting for the policies to take effect")
+	}
+
+	withExtAuthz, err := runLoad(ctx, opts)
+	if err != nil {
+		return result, err
+	}
+	if ctx.Err() != nil {
+		return result, fmt.Errorf("interrupted during the ext_authz run")
+	}
+	result.ExtAuthz = withExtAuthz
+	result.AddedLatency = withExtAuthz.Latency.sub(baseline.Latency)
+	return result, nil
+}
+
+// parseLabels parses comma separated key=value pairs.
+func parseLabels(s string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		if kv == "" {
+			continue
+		}
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid label %q, must be key=value", kv)
+		}
+		labels[parts[0]] = parts[1]
+	}
+	return labels, nil
+}
@@ -0,0 +1,269 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The fields of the envoy.service.auth.v3 messages read and written by the gRPC mock, which
+// decodes them by hand since the generated Envoy API stubs are not dependencies of this module.
+const (
+	// CheckRequest.attributes, AttributeContext.request, AttributeContext.Request.http.
+	checkRequestAttributes  protowire.Number = 1
+	attributeContextRequest protowire.Number = 4
+	requestHTTP             protowire.Number = 2
+	// HttpRequest.headers, a map of entries with a key and a value, and HttpRequest.header_map.
+	httpRequestHeaders   protowire.Number = 3
+	httpRequestHeaderMap protowire.Number = 13
+	headerMapHeaders     protowire.Number = 1
+	headerRawValue       protowire.Number = 3
+	// CheckResponse.status, a google.rpc.Status, and the CheckResponse.http_response oneof.
+	checkResponseStatus         protowire.Number = 1
+	checkResponseDeniedResponse protowire.Number = 2
+	checkResponseOkResponse     protowire.Number = 3
+)
+
+// The google.rpc.Code of the CheckResponse status.
+const (
+	rpcCodeOK               = 0
+	rpcCodePermissionDenied = 7
+)
+
+// extAuthzCheck serves the Check method of the envoy.service.auth.v3.Authorization service.
+type extAuthzCheck interface {
+	Check(ctx context.Context, request []byte) ([]byte, error)
+}
+
+var extAuthzServiceDesc = grpc.ServiceDesc{
+	ServiceName: "envoy.service.auth.v3.Authorization",
+	HandlerType: (*extAuthzCheck)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Check",
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			var request []byte
+			if err := dec(&request); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return srv.(extAuthzCheck).Check(ctx, request)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/envoy.service.auth.v3.Authorization/Check"}
+			return interceptor(ctx, request, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(extAuthzCheck).Check(ctx, req.([]byte))
+			})
+		},
+	}},
+	Metadata: "envoy/service/auth/v3/external_auth.proto",
+}
+
+// rawCodec passes the encoded messages through, as []byte values.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	switch m := v.(type) {
+	case []byte:
+		return m, nil
+	case *[]byte:
+		return *m, nil
+	default:
+		return nil, fmt.Errorf("cannot marshal %T", v)
+	}
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal into %T", v)
+	}
+	*m = append([]byte(nil), data...)
+	return nil
+}
+
+func (rawCodec) Name() string   { return "proto" }
+func (rawCodec) String() string { return "proto" }
+
+// mockGRPCCheck denies the requests with the header extAuthzDenyHeader set to deny, after
+// latency.
+type mockGRPCCheck struct {
+	latency time.Duration
+}
+
+func (c mockGRPCCheck) Check(ctx context.Context, request []byte) ([]byte, error) {
+	headers, err := checkRequestHeaders(request)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-time.After(c.latency):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return checkResponse(headers[extAuthzDenyHeader] != "deny"), nil
+}
+
+// serveGRPCExtAuthz serves the envoy.service.auth.v3.Authorization service of
+// envoyExtAuthzGrpc providers on addr until ctx is done.
+func serveGRPCExtAuthz(ctx context.Context, addr string, check extAuthzCheck) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := newGRPCExtAuthzServer(check)
+	errc := make(chan error, 1)
+	go func() { errc <- server.Serve(listener) }()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		server.GracefulStop()
+		return nil
+	}
+}
+
+// newGRPCExtAuthzServer returns a server of the envoy.service.auth.v3.Authorization service.
+func newGRPCExtAuthzServer(check extAuthzCheck) *grpc.Server {
+	server := grpc.NewServer(grpc.CustomCodec(rawCodec{}))
+	server.RegisterService(&extAuthzServiceDesc, check)
+	return server
+}
+
+// checkRequestHeaders returns the HTTP headers of an encoded CheckRequest by lowercase name.
+func checkRequestHeaders(request []byte) (map[string]string, error) {
+	headers := map[string]string{}
+	attributes, err := protoMessages(request, checkRequestAttributes)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range attributes {
+		requests, err := protoMessages(a, attributeContextRequest)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range requests {
+			httpRequests, err := protoMessages(r, requestHTTP)
+			if err != nil {
+				return nil, err
+			}
+			for _, h := range httpRequests {
+				if err := httpRequestHeadersInto(headers, h); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return headers, nil
+}
+
+// httpRequestHeadersInto adds the headers and the header_map of an encoded HttpRequest to
+// headers.
+func httpRequestHeadersInto(headers map[string]string, httpRequest []byte) error {
+	entries, err := protoMessages(httpRequest, httpRequestHeaders)
+	if err != nil {
+		return err
+	}
+	headerMaps, err := protoMessages(httpRequest, httpRequestHeaderMap)
+	if err != nil {
+		return err
+	}
+	for _, m := range headerMaps {
+		values, err := protoMessages(m, headerMapHeaders)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, values...)
+	}
+	for _, entry := range entries {
+		// A map entry and a HeaderValue both have the key as field 1 and the value as field 2,
+		// a HeaderValue may have its value as raw_value instead.
+		keys, err := protoMessages(entry, 1)
+		if err != nil {
+			return err
+		}
+		values, err := protoMessages(entry, 2)
+		if err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			if values, err = protoMessages(entry, headerRawValue); err != nil {
+				return err
+			}
+		}
+		if len(keys) > 0 && len(values) > 0 {
+			headers[strings.ToLower(string(keys[len(keys)-1]))] = string(values[len(values)-1])
+		}
+	}
+	return nil
+}
+
+// protoMessages returns the values of the length delimited fields num of an encoded message.
+func protoMessages(message []byte, num protowire.Number) ([][]byte, error) {
+	var values [][]byte
+	for len(message) > 0 {
+		n, typ, length := protowire.ConsumeTag(message)
+		if length < 0 {
+			return nil, protowire.ParseError(length)
+		}
+		message = message[length:]
+		if n == num && typ == protowire.BytesType {
+			value, length := protowire.ConsumeBytes(message)
+			if length < 0 {
+				return nil, protowire.ParseError(length)
+			}
+			values = append(values, value)
+			message = message[length:]
+			continue
+		}
+		length = protowire.ConsumeFieldValue(n, typ, message)
+		if length < 0 {
+			return nil, protowire.ParseError(length)
+		}
+		message = message[length:]
+	}
+	return values, nil
+}
+
+// checkResponse returns an encoded CheckResponse allowing the request, or denying it with a 403.
+func checkResponse(allowed bool) []byte {
+	code, httpResponse := rpcCodeOK, checkResponseOkResponse
+	var httpBody []byte
+	if !allowed {
+		code, httpResponse = rpcCodePermissionDenied, checkResponseDeniedResponse
+		// DeniedHttpResponse.status, an HttpStatus with the code 403.
+		var status []byte
+		status = protowire.AppendTag(status, 1, protowire.VarintType)
+		status = protowire.AppendVarint(status, 403)
+		httpBody = protowire.AppendTag(httpBody, 1, protowire.BytesType)
+		httpBody = protowire.AppendBytes(httpBody, status)
+	}
+	var rpcStatus []byte
+	if code != rpcCodeOK {
+		rpcStatus = protowire.AppendTag(rpcStatus, 1, protowire.VarintType)
+		rpcStatus = protowire.AppendVarint(rpcStatus, uint64(code))
+	}
+	var response []byte
+	response = protowire.AppendTag(response, checkResponseStatus, protowire.BytesType)
+	response = protowire.AppendBytes(response, rpcStatus)
+	response = protowire.AppendTag(response, httpResponse, protowire.BytesType)
+	response = protowire.AppendBytes(response, httpBody)
+	return response
+}
@@ -0,0 +1,113 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func appendMessage(b []byte, num protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+// encodeCheckRequest returns a CheckRequest with headers, as a map when headerMap is false and
+// as a header_map otherwise.
+func encodeCheckRequest(headers map[string]string, headerMap bool) []byte {
+	var httpRequest, entries []byte
+	for key, value := range headers {
+		var entry []byte
+		entry = appendMessage(entry, 1, []byte(key))
+		entry = appendMessage(entry, 2, []byte(value))
+		if headerMap {
+			entries = appendMessage(entries, headerMapHeaders, entry)
+		} else {
+			httpRequest = appendMessage(httpRequest, httpRequestHeaders, entry)
+		}
+	}
+	if headerMap {
+		httpRequest = appendMessage(httpRequest, httpRequestHeaderMap, entries)
+	}
+	httpRequest = appendMessage(httpRequest, 4, []byte("/"))
+	request := appendMessage(nil, requestHTTP, httpRequest)
+	attributes := appendMessage(nil, attributeContextRequest, request)
+	return appendMessage(nil, checkRequestAttributes, attributes)
+}
+
+func TestGRPCExtAuthz(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newGRPCExtAuthzServer(mockGRPCCheck{})
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure(), grpc.WithDefaultCallOptions(grpc.ForceCodec(rawCodec{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	cases := []struct {
+		headers     map[string]string
+		headerMap   bool
+		wantAllowed bool
+	}{
+		{map[string]string{"x-other": "deny"}, false, true},
+		{map[string]string{extAuthzDenyHeader: "deny"}, false, false},
+		{map[string]string{"X-Ext-Authz": "deny"}, true, false},
+		{map[string]string{extAuthzDenyHeader: "allow"}, true, true},
+	}
+	for _, c := range cases {
+		request := encodeCheckRequest(c.headers, c.headerMap)
+		var response []byte
+		if err := conn.Invoke(context.Background(), "/envoy.service.auth.v3.Authorization/Check", &request, &response); err != nil {
+			t.Fatal(err)
+		}
+		statuses, err := protoMessages(response, checkResponseStatus)
+		if err != nil || len(statuses) != 1 {
+			t.Fatalf("got statuses %v, error %v, want one status", statuses, err)
+		}
+		code, n := uint64(rpcCodeOK), 0
+		if len(statuses[0]) > 0 {
+			_, _, n = protowire.ConsumeTag(statuses[0])
+			code, _ = protowire.ConsumeVarint(statuses[0][n:])
+		}
+		denied, err := protoMessages(response, checkResponseDeniedResponse)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok, err := protoMessages(response, checkResponseOkResponse)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.wantAllowed && (code != rpcCodeOK || len(ok) != 1 || len(denied) != 0) {
+			t.Errorf("%v: got code %d, %d ok and %d denied responses, want allowed", c.headers, code, len(ok), len(denied))
+		}
+		if !c.wantAllowed && (code != rpcCodePermissionDenied || len(denied) != 1 || len(ok) != 0) {
+			t.Errorf("%v: got code %d, %d ok and %d denied responses, want denied", c.headers, code, len(ok), len(denied))
+		}
+	}
+
+	if _, err := checkRequestHeaders([]byte{0xff}); err == nil {
+		t.Error("got no error for an invalid CheckRequest")
+	}
+}
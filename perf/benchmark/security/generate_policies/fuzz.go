@@ -0,0 +1,286 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+
+	authzpb "istio.io/api/security/v1beta1"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// specSite is a value of a spec, with the function replacing it.
+type specSite struct {
+	// path is the path of the value, e.g. spec.rules[0].to[0].operation.paths.
+	path string
+	// field is the name of the field holding the value, or of the list holding it.
+	field string
+	value interface{}
+	set   func(interface{})
+}
+
+// specSites returns the sites of the values under v, walking the maps in key order.
+func specSites(v interface{}, path, field string, set func(interface{})) []specSite {
+	sites := []specSite{{path: path, field: field, value: v, set: set}}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, key := range specKeys(v) {
+			key := key
+			sites = append(sites, specSites(v[key], path+"."+key, key, func(value interface{}) { v[key] = value })...)
+		}
+	case []interface{}:
+		for i := range v {
+			i := i
+			sites = append(sites, specSites(v[i], fmt.Sprintf("%s[%d]", path, i), field, func(value interface{}) { v[i] = value })...)
+		}
+	}
+	return sites
+}
+
+// negatedFields maps the fields of sources and operations to their negation.
+var negatedFields = map[string]string{
+	"principals":        "notPrincipals",
+	"requestPrincipals": "notRequestPrincipals",
+	"namespaces":        "notNamespaces",
+	"ipBlocks":          "notIpBlocks",
+	"remoteIpBlocks":    "notRemoteIpBlocks",
+	"hosts":             "notHosts",
+	"ports":             "notPorts",
+	"methods":           "notMethods",
+	"paths":             "notPaths",
+	"values":            "notValues",
+}
+
+// typedFields hold IP blocks and ports, which the webhook parses, so the string mutations leave
+// their values alone.
+var typedFields = map[string]bool{
+	"ipBlocks":          true,
+	"notIpBlocks":       true,
+	"remoteIpBlocks":    true,
+	"notRemoteIpBlocks": true,
+	"ports":             true,
+	"notPorts":          true,
+}
+
+// stringSite reports whether the string mutations apply to site, a string value which is neither
+// typed, a keyword of the spec nor a label of the selector, whose length the webhook limits.
+func stringSite(site specSite) bool {
+	if _, ok := site.value.(string); !ok || typedFields[site.field] || strings.HasPrefix(site.path, "spec.selector.") {
+		return false
+	}
+	return site.field != "key" && site.field != "action" && site.field != "mode"
+}
+
+// unusualWildcards replace strings by the wildcard mutation.
+var unusualWildcards = []string{"*", "**", "/*", "*/", "*/*", "*.*", "/a*/*", "*-*"}
+
+// mutation changes a site of a spec, it returns false when the site does not apply.
+type mutation struct {
+	name   string
+	mutate func(site specSite, r *rand.Rand, hugeSize int) bool
+}
+
+var mutations = []mutation{
+	{"empty-list", func(site specSite, _ *rand.Rand, _ int) bool {
+		list, ok := site.value.([]interface{})
+		if !ok || len(list) == 0 {
+			return false
+		}
+		site.set([]interface{}{})
+		return true
+	}},
+	{"huge-value", func(site specSite, _ *rand.Rand, hugeSize int) bool {
+		if !stringSite(site) {
+			return false
+		}
+		site.set(site.value.(string) + strings.Repeat("x", hugeSize))
+		return true
+	}},
+	{"unusual-wildcard", func(site specSite, r *rand.Rand, _ int) bool {
+		if !stringSite(site) || negatedFields[site.field] == "" && !strings.HasPrefix(site.field, "not") {
+			return false
+		}
+		site.set(unusualWildcards[r.Intn(len(unusualWildcards))])
+		return true
+	}},
+	{"conflicting-fields", func(site specSite, _ *rand.Rand, _ int) bool {
+		// A source, an operation or a condition matching the values its negation excludes.
+		m, ok := site.value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for _, field := range specKeys(m) {
+			negated, ok := negatedFields[field]
+			if _, exists := m[negated]; !ok || exists {
+				continue
+			}
+			m[negated] = m[field]
+			return true
+		}
+		return false
+	}},
+	{"duplicate-values", func(site specSite, _ *rand.Rand, _ int) bool {
+		list, ok := site.value.([]interface{})
+		if !ok || len(list) == 0 {
+			return false
+		}
+		site.set(append(list, list...))
+		return true
+	}},
+}
+
+// specKeys returns the keys of a map of a spec in order.
+func specKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// siteAttempts is the number of random sites a mutation is tried at before the next one is.
+const siteAttempts = 8
+
+// mutatePolicy applies n random mutations to the spec of p and returns their descriptions. A
+// mutation of an AuthorizationPolicy is only kept when the webhook would still admit the policy,
+// so that the mutated configs reach istiod and Envoy instead of being rejected by kubectl apply.
+func mutatePolicy(p policyObject, n int, r *rand.Rand, hugeSize int) []string {
+	var applied []string
+	for len(applied) < n {
+		// Some mutations apply to few sites, try each of them at random sites before giving up.
+		done := false
+		for _, i := range r.Perm(len(mutations)) {
+			for attempt := 0; attempt < siteAttempts && !done; attempt++ {
+				spec := copySpec(p.Spec).(map[string]interface{})
+				sites := specSites(spec, "spec", "spec", nil)[1:]
+				if len(sites) == 0 {
+					return applied
+				}
+				site := sites[r.Intn(len(sites))]
+				if !mutations[i].mutate(site, r, hugeSize) || !admitted(p.Kind, spec) {
+					continue
+				}
+				for key := range p.Spec {
+					delete(p.Spec, key)
+				}
+				for key, value := range spec {
+					p.Spec[key] = value
+				}
+				applied = append(applied, mutations[i].name+" "+site.path)
+				done = true
+			}
+			if done {
+				break
+			}
+		}
+		if !done {
+			break
+		}
+	}
+	return applied
+}
+
+// copySpec returns a deep copy of a value of a spec decoded into generic JSON values.
+func copySpec(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			out[key] = copySpec(value)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, value := range v {
+			out[i] = copySpec(value)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// admitted reports whether a spec of kind passes the validation of the webhook. Only
+// AuthorizationPolicies are validated, the specs of the other kinds are always admitted.
+func admitted(kind string, spec map[string]interface{}) bool {
+	if kind != "AuthorizationPolicy" {
+		return true
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return false
+	}
+	parsed := &authzpb.AuthorizationPolicy{}
+	if err := parsed.UnmarshalJSON(data); err != nil {
+		return false
+	}
+	return generatepolicies.ValidateAuthorizationPolicy(parsed) == nil
+}
+
+func runFuzz(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("fuzz", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the generated policies")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	policyFile := fs.String("policyFile", "", "A YAML file of policies to mutate instead of the generated ones")
+	rate := fs.Float64("rate", 0.1, "The share of the policies which are mutated")
+	numMutations := fs.Int("mutations", 1, "The number of mutations of a mutated policy")
+	hugeSize := fs.Int("hugeSize", 64*1024, "The number of bytes the huge-value mutation adds to a value")
+	seed := fs.Int64("seed", 1, "The seed of the random mutations, the same seed mutates the same policies the same way")
+	_ = fs.Parse(args)
+
+	if *rate < 0 || *rate > 1 {
+		return fmt.Errorf("-rate must be between 0 and 1, got %v", *rate)
+	}
+	docs, err := loadPolicyDocuments(ctx, *scenarioName, *configFile, *policyFile)
+	if err != nil {
+		return err
+	}
+	policies, err := parsePolicyObjects(docs)
+	if err != nil {
+		return err
+	}
+
+	r := rand.New(rand.NewSource(*seed))
+	mutated := 0
+	for _, p := range policies {
+		var applied []string
+		if p.Spec != nil && r.Float64() < *rate {
+			applied = mutatePolicy(p, *numMutations, r, *hugeSize)
+		}
+		doc, err := policyObjectYAML(p)
+		if err != nil {
+			return fmt.Errorf("%s: %v", p, err)
+		}
+		// The mutations are recorded as comments of the document, which kubectl ignores.
+		for _, m := range applied {
+			doc = "# fuzz: " + m + "\n" + doc
+		}
+		if len(applied) > 0 {
+			mutated++
+		}
+		fmt.Println(doc + "---")
+	}
+	fmt.Fprintf(os.Stderr, "mutated %d of %d policies\n", mutated, len(policies))
+	return nil
+}
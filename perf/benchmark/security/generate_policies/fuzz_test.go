@@ -0,0 +1,97 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+const fuzzPolicy = `apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: fuzzed
+  namespace: twopods-istio
+spec:
+  action: ALLOW
+  selector:
+    matchLabels:
+      app: fortioserver
+  rules:
+  - from:
+    - source:
+        principals: ["cluster.local/ns/twopods-istio/sa/invalid-0"]
+        ipBlocks: ["10.0.0.0/16"]
+    to:
+    - operation:
+        ports: ["8080"]
+    - operation:
+        paths: ["/admin", "/status*"]
+        methods: ["GET"]
+    when:
+    - key: request.headers[x-token]
+      values: ["token-0"]
+    - key: source.ip
+      values: ["10.1.0.0/16"]
+`
+
+func TestMutatePolicyAdmitted(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		policies, err := parsePolicyObjects([]string{fuzzPolicy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := policies[0]
+		applied := mutatePolicy(p, 3, r, 16)
+		// Emptying the rules can leave no site for the next mutations.
+		if len(applied) == 0 || len(applied) > 3 {
+			t.Fatalf("applied %v, want 1 to 3 mutations", applied)
+		}
+		for _, m := range applied {
+			seen[strings.Fields(m)[0]] = true
+		}
+		doc, err := policyObjectYAML(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := parseAuthorizationPolicies([]string{doc})
+		if err != nil {
+			t.Fatalf("%v: %v", applied, err)
+		}
+		if err := generatepolicies.ValidateAuthorizationPolicy(parsed[0].Spec); err != nil {
+			t.Errorf("mutations %v are not admitted: %v\n%s", applied, err, doc)
+		}
+		// The webhook parses the ports, which validateAuthorizationPolicy does not check.
+		for _, rule := range parsed[0].Spec.Rules {
+			for _, to := range rule.To {
+				for _, port := range append(to.GetOperation().GetPorts(), to.GetOperation().GetNotPorts()...) {
+					if port != "8080" {
+						t.Errorf("mutations %v changed the port to %q", applied, port)
+					}
+				}
+			}
+		}
+	}
+	for _, m := range mutations {
+		if !seen[m.name] {
+			t.Errorf("mutation %s was never applied", m.name)
+		}
+	}
+}
@@ -15,320 +15,367 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"crypto/rand"
-	"crypto/rsa"
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
-	"github.com/ghodss/yaml"
-	"github.com/golang/protobuf/jsonpb"
-	"github.com/golang/protobuf/proto"
-
-	authzpb "istio.io/api/security/v1beta1"
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
 )
 
-type ruleGenerator struct {
-	gen generator
-}
-
-type SecurityPolicy struct {
-	AuthZ        AuthorizationPolicy   `json:"authZ"`
-	Namespace    string                `json:"namespace"`
-	PeerAuthN    PeerAuthentication    `json:"peerAuthN"`
-	RequestAuthN RequestAuthentication `json:"requestAuthN"`
-}
-
-type AuthorizationPolicy struct {
-	Action        string `json:"action"`
-	NumNamespaces int    `json:"numNamespaces"`
-	NumPaths      int    `json:"numPaths"`
-	NumPolicies   int    `json:"numPolicies"`
-	NumPrincipals int    `json:"numPrincipals"`
-	NumSourceIP   int    `json:"numSourceIP"`
-	NumValues     int    `json:"numValues"`
-	// The request_principal in the generated authorization policy will match the
-	// RequestAuthentication policies generated from the requestAuthN. This allows
-	// to test RequestAuthentication and AuthorizationPolicy together to verify that
-	// a request with a valid JWT token is allowed.
-	NumRequestPrincipals int `json:"numRequestPrincipals"`
-}
-
-type PeerAuthentication struct {
-	MtlsMode    string `json:"mtlsMode"`
-	NumPolicies int    `json:"numPolicies"`
-}
-
-type RequestAuthentication struct {
-	// Setting InvalidToken to true will create a token which will be signed by it's own
-	// privateKey creating a token which will never match with a jwks
-	InvalidToken bool   `json:"invalidToken"`
-	NumPolicies  int    `json:"numPolicies"`
-	NumJwks      int    `json:"numJwks"`
-	TokenIssuer  string `json:"tokenIssuer"`
-}
-
-type MyPolicy struct {
-	APIVersion string         `json:"apiVersion"`
-	Kind       string         `json:"kind"`
-	Metadata   MetadataStruct `json:"metadata"`
-}
-
-type MetadataStruct struct {
-	Name      string `json:"name"`
-	Namespace string `json:"namespace"`
-}
-
-func ToJSON(msg proto.Message) (string, error) {
-	return ToJSONWithIndent(msg, "")
-}
-
-func ToJSONWithIndent(msg proto.Message, indent string) (string, error) {
-	if msg == nil {
-		return "", fmt.Errorf("unexpected nil message")
-	}
-
-	m := jsonpb.Marshaler{Indent: indent}
-	return m.MarshalToString(msg)
-}
-
-func ToYAML(msg proto.Message) (string, error) {
-	js, err := ToJSON(msg)
-	if err != nil {
-		return "", err
-	}
-	yml, err := yaml.JSONToYAML([]byte(js))
-	return string(yml), err
-}
-
-func PolicyToYAML(policy *MyPolicy, spec proto.Message) (string, error) {
-	header, err := json.Marshal(policy)
-	if err != nil {
-		return "", err
-	}
-
-	headerYaml, err := yaml.JSONToYAML(header)
+// generatePolicies returns every policy described by policyData as a separate YAML document,
+// and writes the token accepted by its RequestAuthentications to token.txt.
+func generatePolicies(ctx context.Context, policyData generatepolicies.SecurityPolicy) ([]string, error) {
+	policies, err := generateDocuments(ctx, policyData)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-
-	createdPolicy, err := ToYAML(spec)
-	if err != nil {
-		return "", err
-	}
-
-	rulesYaml := bytes.Buffer{}
-	rulesYaml.WriteString("spec:\n")
-	scanner := bufio.NewScanner(strings.NewReader(createdPolicy))
-	for scanner.Scan() {
-		rulesYaml.WriteString(" " + scanner.Text() + "\n")
-	}
-	return string(headerYaml) + rulesYaml.String(), nil
-}
-
-func createRuleGeneratorMap(authZData AuthorizationPolicy) map[string]*ruleGenerator {
-	ruleGeneratorMap := make(map[string]*ruleGenerator)
-
-	if authZData.NumSourceIP > 0 || authZData.NumNamespaces > 0 ||
-		authZData.NumPrincipals > 0 || authZData.NumRequestPrincipals > 0 {
-		ruleGeneratorMap["from"] = &ruleGenerator{
-			gen: sourceGenerator{},
+	if policyData.RequestAuthN.NumPolicies > 0 {
+		privateKey, err := generatepolicies.SigningKey(policyData.RequestAuthN.KeyFile)
+		if err != nil {
+			return nil, err
 		}
-	}
-
-	if authZData.NumPaths > 0 {
-		ruleGeneratorMap["to"] = &ruleGenerator{
-			gen: operationGenerator{},
+		token, err := generatepolicies.GenerateToken(policyData, privateKey)
+		if err != nil {
+			return nil, err
 		}
-	}
-
-	if authZData.NumValues > 0 {
-		ruleGeneratorMap["when"] = &ruleGenerator{
-			gen: conditionGenerator{},
+		if err := writeTokenIntoFile(token, "token.txt"); err != nil {
+			return nil, err
 		}
 	}
-	return ruleGeneratorMap
+	return policies, nil
 }
 
-func generateAuthorizationPolicy(policyData SecurityPolicy, policyHeader *MyPolicy) (string, error) {
-	spec := &authzpb.AuthorizationPolicy{}
-	switch policyData.AuthZ.Action {
-	case "ALLOW":
-		spec.Action = authzpb.AuthorizationPolicy_ALLOW
-	case "DENY", "":
-		spec.Action = authzpb.AuthorizationPolicy_DENY
-	default:
-		return "", fmt.Errorf("action %s not supported", policyData.AuthZ.Action)
-	}
-
-	ruleToGenerator := createRuleGeneratorMap(policyData.AuthZ)
-	var ruleList []*authzpb.Rule
-	for name := range ruleToGenerator {
-		rule := ruleToGenerator[name].gen.generate(policyData)
-		ruleList = append(ruleList, rule)
+// generateDocuments returns every policy described by policyData as a separate YAML document,
+// without writing anything.
+func generateDocuments(ctx context.Context, policyData generatepolicies.SecurityPolicy) ([]string, error) {
+	resources, err := generatepolicies.GenerateContext(ctx, policyData)
+	if err != nil {
+		return nil, err
 	}
-	spec.Rules = ruleList
-
-	yaml, err := PolicyToYAML(policyHeader, spec)
+	// The namespaces, the identities, the waypoints, the access logs, the egress routing and the Sidecars come
+	// first, so that they exist when the policies bound to them are applied.
+	policies, err := generatepolicies.IsolatedNamespaces(policyData)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return yaml, nil
-}
-
-func generatePeerAuthentication(policyData SecurityPolicy, policyHeader *MyPolicy) (string, error) {
-	spec := &authzpb.PeerAuthentication{
-		Mtls: &authzpb.PeerAuthentication_MutualTLS{},
-	}
-	switch policyData.PeerAuthN.MtlsMode {
-	case "STRICT", "":
-		spec.Mtls.Mode = authzpb.PeerAuthentication_MutualTLS_STRICT
-	case "DISABLE":
-		spec.Mtls.Mode = authzpb.PeerAuthentication_MutualTLS_DISABLE
-	case "PERMISSIVE":
-		spec.Mtls.Mode = authzpb.PeerAuthentication_MutualTLS_PERMISSIVE
-	default:
-		return "", fmt.Errorf("invalid mtlsMode: %s", policyData.PeerAuthN.MtlsMode)
+	tenants, err := generatepolicies.TenantObjects(policyData)
+	if err != nil {
+		return nil, err
 	}
-
-	yaml, err := PolicyToYAML(policyHeader, spec)
+	policies = append(policies, tenants...)
+	gateways, err := generatepolicies.WaypointGateways(policyData)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return yaml, nil
-}
-
-func generateRequestAuthentication(policyData SecurityPolicy, policyHeader *MyPolicy) (string, error) {
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	policies = append(policies, gateways...)
+	telemetry, err := generatepolicies.AccessLogTelemetry(policyData)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if telemetry != "" {
+		policies = append(policies, telemetry)
 	}
-	token, err := generateToken(policyData, privateKey)
+	routing, err := generatepolicies.EgressRouting(policyData)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	err = writeTokenIntoFile(token, "token.txt")
+	egressDeny, err := generatepolicies.EgressDenyPolicy(policyData)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	jwks, err := generateJwks(privateKey)
+	sidecars, err := generatepolicies.SidecarResources(policyData, resources)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-
-	var listJWTRules []*authzpb.JWTRule
-	if numJwks := policyData.RequestAuthN.NumJwks; numJwks > 0 {
-		for i := 1; i <= numJwks; i++ {
-			jwkRule := &authzpb.JWTRule{
-				Issuer: fmt.Sprintf("issuer-%d", i),
-				Jwks:   jwks,
-			}
-			listJWTRules = append(listJWTRules, jwkRule)
+	routing = append(append(routing, sidecars...), egressDeny...)
+	for _, r := range append(routing, resources...) {
+		policy, err := r.YAML()
+		if err != nil {
+			return nil, err
 		}
+		policies = append(policies, policy)
 	}
+	return policies, nil
+}
 
-	spec := &authzpb.RequestAuthentication{
-		JwtRules: listJWTRules,
+func writeTokenIntoFile(token string, fileName string) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
 	}
-	yaml, err := PolicyToYAML(policyHeader, spec)
+	_, err = file.WriteString(fmt.Sprintf(`"Authorization":"Bearer %s"`, token))
 	if err != nil {
-		return "", err
+		file.Close()
+		return err
 	}
-	return yaml, nil
-}
-
-func generateRules(policyData SecurityPolicy, policyHeader *MyPolicy) (string, error) {
-	switch policyHeader.Kind {
-	case "AuthorizationPolicy":
-		return generateAuthorizationPolicy(policyData, policyHeader)
-	case "PeerAuthentication":
-		return generatePeerAuthentication(policyData, policyHeader)
-	case "RequestAuthentication":
-		return generateRequestAuthentication(policyData, policyHeader)
-	default:
-		return "", fmt.Errorf("unknown policy kind: %s", policyHeader.Kind)
+	err = file.Close()
+	if err != nil {
+		return err
 	}
+	return nil
 }
 
-func createPolicyHeader(namespace string, name string, kind string) *MyPolicy {
-	if namespace == "" {
-		namespace = "twopods-istio"
+// writeMeshConfig writes the IstioOperator overlay configuring istiod for the policies of
+// policyData to fileName, when they need one.
+func writeMeshConfig(policyData generatepolicies.SecurityPolicy, fileName string) error {
+	meshConfig, err := generatepolicies.MeshConfig(policyData)
+	if err != nil || meshConfig == "" {
+		return err
 	}
-	return &MyPolicy{
-		APIVersion: "security.istio.io/v1beta1",
-		Kind:       kind,
-		Metadata:   MetadataStruct{Namespace: namespace, Name: name},
+	if err := ioutil.WriteFile(fileName, []byte(meshConfig), 0644); err != nil {
+		return err
 	}
+	fmt.Fprintf(os.Stderr, "wrote the extension providers to %s, install them with istioctl install -f %s\n", fileName, fileName)
+	return nil
 }
 
-func generatePolicy(policyData SecurityPolicy, kind string, numPolicy int) error {
-	for i := 1; i <= numPolicy; i++ {
-		testName := fmt.Sprintf("test-%s-%d", strings.ToLower(kind), i)
-		policyHeader := createPolicyHeader(policyData.Namespace, testName, kind)
+// subcommands maps the first command line argument to the command it runs. Without a known
+// subcommand the tool keeps its original behavior of printing the policies from -configFile.
+var subcommands = map[string]func(ctx context.Context, args []string) error{
+	"ab":                     runAB,
+	"alerts":                 runAlerts,
+	"analyze-conflicts":      runAnalyzeConflicts,
+	"anonymize":              runAnonymize,
+	"apply":                  runApply,
+	"bench":                  runBench,
+	"canary":                 runCanary,
+	"chaos":                  runChaos,
+	"config-diff":            runConfigDiff,
+	"convert":                runConvert,
+	"coverage":               runCoverage,
+	"diff":                   runDiff,
+	"drift":                  runDrift,
+	"e2e":                    runE2E,
+	"envoy-rbac":             runEnvoyRBAC,
+	"estimate-cost":          runEstimateCost,
+	"explain":                runExplain,
+	"export-results":         runExportResults,
+	"export-rules":           runExportRules,
+	"ext-authz":              runExtAuthz,
+	"fuzz":                   runFuzz,
+	"header-normalization":   runHeaderNormalization,
+	"import":                 runImport,
+	"import-networkpolicies": runImportNetworkPolicies,
+	"inventory":              runInventory,
+	"isotope":                runIsotope,
+	"jwks":                   runJwks,
+	"minimize":               runMinimize,
+	"mint-cert":              runMintCert,
+	"mint-jwt":               runMintJwt,
+	"negative":               runNegative,
+	"path-normalization":     runPathNormalization,
+	"publish-corpus":         runPublishCorpus,
+	"rego":                   runRego,
+	"report":                 runReport,
+	"reproduce":              runReproduce,
+	"simulate":               runSimulate,
+	"soak":                   runSoak,
+	"status":                 runStatus,
+	"synthesize":             runSynthesize,
+	"topology":               runTopology,
+	"traffic":                runTraffic,
+	"visualize":              runVisualize,
+}
 
-		rules, err := generateRules(policyData, policyHeader)
-		if err != nil {
-			return err
+// signalContext returns a context cancelled on the first SIGINT or SIGTERM, so that long running
+// subcommands stop cleanly and report their partial progress. A second signal kills the process.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			fmt.Fprintf(os.Stderr, "received %v, stopping\n", sig)
+			cancel()
+		case <-ctx.Done():
 		}
-		yaml := bytes.Buffer{}
-		yaml.WriteString(rules)
-		yaml.WriteString("---")
-		fmt.Println(yaml.String())
+		signal.Stop(signals)
+	}()
+	return ctx, cancel
+}
+
+// serveHTTP serves handler on addr until ctx is cancelled.
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) error {
+	server := &http.Server{Addr: addr, Handler: handler}
+	errc := make(chan error, 1)
+	go func() { errc <- server.ListenAndServe() }()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return server.Shutdown(context.Background())
 	}
-	return nil
 }
 
 func main() {
+	ctx, cancel := signalContext()
+	defer cancel()
+	tracer := newTracerFromEnv()
+	ctx = withTracer(ctx, tracer)
+	defer tracer.flush()
+
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			if err := inSpan(ctx, os.Args[1], func(ctx context.Context) error { return cmd(ctx, os.Args[2:]) }); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				tracer.flush()
+				cancel()
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	configFilePtr := flag.String("configFile", "", "The name of the config json file")
+	scenarioPtr := flag.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	meshConfigFilePtr := flag.String("meshConfigFile", "meshconfig.yaml", "The file the IstioOperator overlay with the extension providers of the policies is written to, when they need one")
+	trafficFilePtr := flag.String("trafficFile", "traffic.json", "The file the traffic profile of the scenario is written to")
+	denyRatePtr := flag.Float64("denyRate", 0, "The share of requests of the scenario traffic profile expected to be denied")
+	expectationsFilePtr := flag.String("expectationsFile", "", "A JSON file the expected decision and matching policy of requests sampled from the policies are written to")
+	goldenDirPtr := flag.String("goldenDir", "", "Compare the policies generated from every <name>.json config of the directory with <name>.golden.yaml")
+	updateGoldenPtr := flag.Bool("updateGolden", false, "Rewrite the golden files of goldenDir instead of comparing them")
+	validateSchemaPtr := flag.Bool("validateSchema", false, "Validate the policies against the OpenAPI schemas of their CRDs")
+	roundTripCheckPtr := flag.Bool("roundTripCheck", false, "Parse every generated document back and fail when it differs from its spec")
+	tenantsPtr := flag.Int("tenants", 0, "Also generate the namespaces, identities and cross-tenant deny policies of this many tenants")
+	nameByHashPtr := flag.Bool("nameByHash", false, "Append a short hash of its spec to the name of every policy, so that regenerating the same policies is idempotent")
+	ambientPtr := flag.Bool("ambient", false, "Restrict the AuthorizationPolicies to the fields ztunnel enforces without a waypoint")
+	formatPtr := flag.String("format", "yaml", "The output format of the policies: yaml, proto for a length-delimited stream of istio.mcp.v1alpha1.Resource, kubectl-stream for batches to pipe into kubectl apply --server-side, or go for Go source applying them with the Istio test framework")
+	batchSizePtr := flag.Int("batchSize", 100, "The number of objects per batch of -format=kubectl-stream")
+	fieldManagerPtr := flag.String("fieldManager", "generate-policies", "The field manager of the kubectl command of -format=kubectl-stream")
+	goPackagePtr := flag.String("goPackage", "policies", "The package of the Go source of -format=go")
+	goVarPtr := flag.String("goVar", "Policies", "The variable of the documents in the Go source of -format=go")
+	seedPtr := flag.Int64("seed", 0, "Draw the values of the rules from a random source seeded with seed instead of the default sequences of invalid values")
+	lockFilePtr := flag.String("lockFile", "", "A JSON file the seed, flags, tool version and content hashes of the generated policies are written to, to regenerate them with reproduce")
+	stampPtr := flag.Bool("stamp", false, "Annotate every generated object with the tool version, git SHA and flags of the run")
+	statsPtr := flag.Bool("stats", false, "Print the statistics of the generated policies to stderr")
+	schemaFilePtr := flag.String("schemaFile", "", "A path or URL of the CRDs to validate against, defaults to the bundled security.istio.io CRDs")
 	flag.Parse()
 
-	jsonBytes := make([]byte, 0)
-	if *configFilePtr != "" {
-		jsonFile, err := os.Open(*configFilePtr)
-		if err != nil {
-			fmt.Println(err)
-		}
-
-		jsonBytes, err = ioutil.ReadAll(jsonFile)
-		if err != nil {
-			fmt.Println(err)
+	if *goldenDirPtr != "" {
+		if err := checkGoldenDir(*goldenDirPtr, *updateGoldenPtr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
+		return
 	}
 
-	policyData := SecurityPolicy{}
-	err := json.Unmarshal(jsonBytes, &policyData)
+	policyData, err := loadSecurityPolicy(*scenarioPtr, *configFilePtr)
 	if err != nil {
 		fmt.Println(err)
 	}
 
-	totalPolicies := policyData.AuthZ.NumPolicies + policyData.PeerAuthN.NumPolicies + policyData.RequestAuthN.NumPolicies
-	if totalPolicies <= 0 {
-		fmt.Println(fmt.Errorf("invalid number of policies: %d", totalPolicies))
+	policyData.RoundTripCheck = policyData.RoundTripCheck || *roundTripCheckPtr
+	policyData.Ambient = policyData.Ambient || *ambientPtr
+	policyData.NameByHash = policyData.NameByHash || *nameByHashPtr
+	if *tenantsPtr > 0 {
+		if policyData.Tenants == nil {
+			policyData.Tenants = &generatepolicies.Tenants{Objects: true}
+		}
+		policyData.Tenants.NumTenants = *tenantsPtr
 	}
-
-	if policyData.AuthZ.NumPolicies > 0 {
-		err := generatePolicy(policyData, "AuthorizationPolicy", policyData.AuthZ.NumPolicies)
+	var seed *int64
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			seed = seedPtr
+		}
+	})
+	seededPolicyData, err := seededPolicy(policyData, seed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *lockFilePtr != "" {
+		if err := lockable(policyData); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	genCtx, genSpan := startSpan(ctx, "generate")
+	policies, err := generatePolicies(genCtx, seededPolicyData)
+	genSpan.setAttribute("documents", len(policies))
+	genSpan.end(err)
+	if err != nil {
+		fmt.Println(err)
+	}
+	metadata := newRunMetadata(flag.CommandLine, seed)
+	if *lockFilePtr != "" {
+		lock, err := newScenarioLock(*scenarioPtr, *configFilePtr, policyData, metadata, *stampPtr, policies)
+		if err == nil {
+			err = writeScenarioLock(*lockFilePtr, lock)
+		}
 		if err != nil {
-			fmt.Println(err)
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
 	}
-
-	if policyData.PeerAuthN.NumPolicies > 0 {
-		err := generatePolicy(policyData, "PeerAuthentication", policyData.PeerAuthN.NumPolicies)
+	if *stampPtr {
+		if policies, err = stampDocs(policies, metadata); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if *validateSchemaPtr {
+		if err := validateSchemas(policies, *schemaFilePtr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if *statsPtr {
+		stats, err := generationStats(policies)
+		if err == nil {
+			err = stats.print(os.Stderr)
+		}
 		if err != nil {
-			fmt.Println(err)
+			fmt.Fprintln(os.Stderr, err)
 		}
 	}
-
-	if policyData.RequestAuthN.NumPolicies > 0 {
-		err := generatePolicy(policyData, "RequestAuthentication", policyData.RequestAuthN.NumPolicies)
+	switch *formatPtr {
+	case "yaml":
+		for _, policy := range policies {
+			fmt.Println(policy + "---")
+		}
+	case "proto":
+		resources, skipped, err := protoResources(policies)
+		if err == nil {
+			err = writeProtoStream(os.Stdout, resources)
+		}
 		if err != nil {
-			fmt.Println(err)
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if skipped > 0 {
+			fmt.Fprintf(os.Stderr, "skipped %d objects without a security.istio.io spec\n", skipped)
 		}
+	case "kubectl-stream":
+		if err := writeKubectlStream(os.Stdout, policies, *batchSizePtr, *fieldManagerPtr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "go":
+		source := "generate_policies " + strings.Join(os.Args[1:], " ")
+		if err := writeGoSource(os.Stdout, policies, *goPackagePtr, *goVarPtr, source); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format %q, must be yaml, proto, kubectl-stream or go\n", *formatPtr)
+		os.Exit(1)
+	}
+
+	if err := writeMeshConfig(policyData, *meshConfigFilePtr); err != nil {
+		fmt.Println(err)
+	}
+	if err := writeScenarioTraffic(*scenarioPtr, policyData, *trafficFilePtr, *denyRatePtr); err != nil {
+		fmt.Println(err)
+	}
+	if err := writeExpectations(*scenarioPtr, policyData, policies, *expectationsFilePtr); err != nil {
+		fmt.Println(err)
 	}
 }
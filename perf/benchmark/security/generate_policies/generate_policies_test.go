@@ -0,0 +1,144 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files of testdata")
+
+// inTempDir runs the rest of the test in a temporary working directory, generating
+// RequestAuthentications writes token.txt to the working directory.
+func inTempDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestGolden(t *testing.T) {
+	dir, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configs, err := goldenConfigs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inTempDir(t)
+
+	for _, config := range configs {
+		config := config
+		t.Run(filepath.Base(config), func(t *testing.T) {
+			if err := checkGolden(config, *update); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestDeterministicGeneration(t *testing.T) {
+	dir, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configs, err := goldenConfigs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inTempDir(t)
+
+	inputs := map[string]func() (generatepolicies.SecurityPolicy, error){}
+	for _, config := range configs {
+		config := config
+		inputs[filepath.Base(config)] = func() (generatepolicies.SecurityPolicy, error) {
+			policyData, err := loadSecurityPolicy("", config)
+			policyData.RequestAuthN.KeyFile = ""
+			return policyData, err
+		}
+	}
+	for name := range scenarios {
+		name := name
+		inputs[name] = func() (generatepolicies.SecurityPolicy, error) { return loadSecurityPolicy(name, "") }
+	}
+	inputs["selector"] = func() (generatepolicies.SecurityPolicy, error) {
+		return generatepolicies.SecurityPolicy{AuthZ: generatepolicies.AuthorizationPolicy{
+			NumPolicies: 1, NumPaths: 2, NumValues: 2, NumSourceIP: 2,
+			Selector: map[string]string{"z": "1", "a": "2", "m": "3", "b": "4", "y": "5"},
+		}}, nil
+	}
+
+	for name, input := range inputs {
+		input := input
+		t.Run(name, func(t *testing.T) {
+			var first []string
+			for i := 0; i < 5; i++ {
+				policyData, err := input()
+				if err != nil {
+					t.Fatal(err)
+				}
+				policies, err := generatePolicies(context.Background(), policyData)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if i == 0 {
+					first = policies
+					continue
+				}
+				if strings.Join(policies, "---\n") != strings.Join(first, "---\n") {
+					t.Fatalf("run %d generated different policies", i)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadSecurityPolicyCopiesPreset(t *testing.T) {
+	for name, s := range scenarios {
+		policyData, err := loadSecurityPolicy(name, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(policyData, s.policy) {
+			t.Errorf("%s: got %+v, want the preset %+v", name, policyData, s.policy)
+		}
+	}
+
+	policyData, err := loadSecurityPolicy("tiered-org", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policyData.Tiers.NumPolicies++
+	if again, _ := loadSecurityPolicy("tiered-org", ""); again.Tiers.NumPolicies == policyData.Tiers.NumPolicies {
+		t.Errorf("changing the loaded policy changed the preset, got %d policies", again.Tiers.NumPolicies)
+	}
+}
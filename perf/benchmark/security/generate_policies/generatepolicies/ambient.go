@@ -0,0 +1,66 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"fmt"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+// ambientConditionKeys are the condition keys ztunnel enforces.
+var ambientConditionKeys = map[string]bool{
+	"source.ip":        true,
+	"source.namespace": true,
+	"source.principal": true,
+	"destination.ip":   true,
+	"destination.port": true,
+}
+
+// validateAmbient checks that ztunnel enforces every field of spec, without a waypoint: the
+// principals, namespaces and ipBlocks of the sources, the ports of the operations and the L4
+// conditions. It returns a *PolicyError of class ErrInvalidConfig.
+func validateAmbient(spec *authzpb.AuthorizationPolicy) error {
+	invalid := func(rule int, format string, args ...interface{}) error {
+		return newPolicyError(ErrInvalidConfig, "AuthorizationPolicy", nil, rule, fmt.Errorf("ambient: "+format, args...))
+	}
+	if spec.Action == authzpb.AuthorizationPolicy_CUSTOM {
+		return invalid(-1, "action CUSTOM is not enforced by ztunnel")
+	}
+	for i, rule := range spec.Rules {
+		for j, from := range rule.From {
+			s := from.GetSource()
+			if len(s.RemoteIpBlocks) > 0 || len(s.NotRemoteIpBlocks) > 0 {
+				return invalid(i, "from[%d]: remoteIpBlocks are not enforced by ztunnel", j)
+			}
+			if len(s.RequestPrincipals) > 0 || len(s.NotRequestPrincipals) > 0 {
+				return invalid(i, "from[%d]: requestPrincipals are not enforced by ztunnel", j)
+			}
+		}
+		for j, to := range rule.To {
+			o := to.GetOperation()
+			if len(o.Hosts) > 0 || len(o.NotHosts) > 0 || len(o.Methods) > 0 || len(o.NotMethods) > 0 ||
+				len(o.Paths) > 0 || len(o.NotPaths) > 0 {
+				return invalid(i, "to[%d]: only the ports of an operation are enforced by ztunnel", j)
+			}
+		}
+		for j, condition := range rule.When {
+			if !ambientConditionKeys[condition.Key] {
+				return invalid(i, "when[%d]: condition %s is not enforced by ztunnel", j, condition.Key)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"fmt"
+	"strings"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+// ClaimNesting describes conditions on the claims of objects nested in the generated token, to
+// stress the extraction of nested JWT claims. The token carries the objects level-1 to
+// level-<depth>, each nested in the previous one and holding fanOut claims, and a rule has one
+// request.auth.claims[level-1]...[level-<n>][claim-<j>] condition for every one of them.
+type ClaimNesting struct {
+	// Depth is the number of nested objects, the deepest condition has a key of depth+1 claim
+	// names.
+	Depth int `json:"depth"`
+	// FanOut is the number of claims of every nested object.
+	FanOut int `json:"fanOut"`
+}
+
+func init() {
+	RegisterGenerator("nested-claims", nestedClaimsGenerator{})
+}
+
+func (n *ClaimNesting) validate() error {
+	if n.Depth < 1 || n.FanOut < 1 {
+		return newPolicyError(ErrInvalidConfig, "AuthorizationPolicy", nil, -1,
+			fmt.Errorf("claimNesting: depth and fanOut must be positive, got %d and %d", n.Depth, n.FanOut))
+	}
+	return nil
+}
+
+// nestedClaimNames returns the names of the objects down to the n-th level.
+func nestedClaimNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("level-%d", i+1)
+	}
+	return names
+}
+
+// nestedClaimValue returns the value of the j-th claim of the n-th level in the generated token.
+func nestedClaimValue(n, j int) string {
+	return fmt.Sprintf("value-%d-%d", n, j)
+}
+
+// claims returns the nested objects carried by the generated token, keyed by the name of the
+// first level.
+func (n *ClaimNesting) claims() map[string]interface{} {
+	var nested map[string]interface{}
+	for level := n.Depth; level >= 1; level-- {
+		object := map[string]interface{}{}
+		for j := 0; j < n.FanOut; j++ {
+			object[fmt.Sprintf("claim-%d", j)] = nestedClaimValue(level, j)
+		}
+		if nested != nil {
+			object[fmt.Sprintf("level-%d", level+1)] = nested
+		}
+		nested = object
+	}
+	return map[string]interface{}{"level-1": nested}
+}
+
+type nestedClaimsGenerator struct{}
+
+func (nestedClaimsGenerator) Enabled(policyData SecurityPolicy) bool {
+	return policyData.AuthZ.ClaimNesting != nil
+}
+
+func (nestedClaimsGenerator) Generate(policyData SecurityPolicy) *authzpb.Rule {
+	n := policyData.AuthZ.ClaimNesting
+	rule := &authzpb.Rule{}
+	for level := 1; level <= n.Depth; level++ {
+		prefix := "request.auth.claims[" + strings.Join(nestedClaimNames(level), "][")
+		for j := 0; j < n.FanOut; j++ {
+			// ALLOW policies match the generated token, the others must not deny it.
+			value := nestedClaimValue(level, j)
+			if policyData.AuthZ.Action != "ALLOW" {
+				value = "invalid-" + value
+			}
+			rule.When = append(rule.When, &authzpb.Condition{
+				Key:    fmt.Sprintf("%s][claim-%d]", prefix, j),
+				Values: []string{value},
+			})
+		}
+	}
+	return rule
+}
@@ -0,0 +1,72 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+func TestClaimNesting(t *testing.T) {
+	policyData := SecurityPolicy{AuthZ: AuthorizationPolicy{
+		Action:       "ALLOW",
+		NumPolicies:  1,
+		ClaimNesting: &ClaimNesting{Depth: 3, FanOut: 2},
+	}}
+	resources, err := Generate(policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := resources[0].Spec.(*authzpb.AuthorizationPolicy).Rules
+	if len(rules) != 1 || len(rules[0].When) != 6 {
+		t.Fatalf("got rules %v, want one rule with 6 conditions", rules)
+	}
+	if got, want := rules[0].When[5].Key, "request.auth.claims[level-1][level-2][level-3][claim-1]"; got != want {
+		t.Errorf("got deepest key %s, want %s", got, want)
+	}
+
+	// Every condition matches the claims of the generated token.
+	claims := map[string]interface{}(TokenClaims(policyData))
+	for _, condition := range rules[0].When {
+		var value interface{} = claims
+		for _, name := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(condition.Key, "request.auth.claims["), "]"), "][") {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				t.Fatalf("%s: the token has no object holding %s", condition.Key, name)
+			}
+			value = object[name]
+		}
+		if value != condition.Values[0] {
+			t.Errorf("%s: the token carries %v, want %s", condition.Key, value, condition.Values[0])
+		}
+	}
+
+	policyData.AuthZ.Action = "DENY"
+	resources, err = Generate(policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := resources[0].Spec.(*authzpb.AuthorizationPolicy).Rules[0].When[0].Values[0]; !strings.HasPrefix(v, "invalid-") {
+		t.Errorf("DENY policies match the generated token with %s", v)
+	}
+
+	policyData.AuthZ.ClaimNesting = &ClaimNesting{Depth: 0, FanOut: 2}
+	if _, err := Generate(policyData); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("got error %v for depth 0, want class %v", err, ErrInvalidConfig)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+// ruleDeduplicator finds the rules of AuthorizationPolicies identical to a rule seen before in
+// a policy of the same scope. Such rules never change a decision, they only inflate the
+// cardinality of the corpus. The policies of numPolicies have the same rules by design, so only
+// the rules repeated within a policy are warned about, the ones repeated across policies are
+// only removed and reported with dedupRules.
+type ruleDeduplicator struct {
+	remove bool
+	// seen maps the rules seen to the name of the first policy they were seen in.
+	seen map[string]string
+	// duplicates counts the rules repeated within their policy, replicated the ones repeated
+	// across policies. policies and within are the names of the policies with such rules.
+	duplicates int
+	replicated int
+	policies   map[string]bool
+	within     map[string]bool
+	removed    int
+}
+
+func newRuleDeduplicator(remove bool) *ruleDeduplicator {
+	return &ruleDeduplicator{remove: remove, seen: map[string]string{}, policies: map[string]bool{}, within: map[string]bool{}}
+}
+
+// dedup records the rules of spec, bound to targetRefs, and returns it, without its duplicate
+// rules when removing them. It returns nil when every rule of spec is removed.
+func (d *ruleDeduplicator) dedup(header *MyPolicy, targetRefs []PolicyTargetReference, spec *authzpb.AuthorizationPolicy) (*authzpb.AuthorizationPolicy, error) {
+	scope, err := ToJSON(&authzpb.AuthorizationPolicy{Selector: spec.Selector, Action: spec.Action, ActionDetail: spec.ActionDetail})
+	if err != nil {
+		return nil, newPolicyError(ErrMarshal, "", header, -1, err)
+	}
+	refs, err := json.Marshal(targetRefs)
+	if err != nil {
+		return nil, newPolicyError(ErrMarshal, "", header, -1, err)
+	}
+	scope = header.Metadata.Namespace + "/" + scope + string(refs)
+
+	var rules []*authzpb.Rule
+	for i, rule := range spec.Rules {
+		key, err := ToJSON(rule)
+		if err != nil {
+			return nil, newPolicyError(ErrMarshal, "", header, i, err)
+		}
+		key = scope + "/" + key
+		if first, ok := d.seen[key]; ok {
+			if first == header.Metadata.Name {
+				d.duplicates++
+				d.within[first] = true
+			} else {
+				d.replicated++
+			}
+			d.policies[header.Metadata.Name] = true
+			if d.remove {
+				continue
+			}
+		} else {
+			d.seen[key] = header.Metadata.Name
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == len(spec.Rules) {
+		return spec, nil
+	}
+	if len(rules) == 0 {
+		d.removed++
+		return nil, nil
+	}
+	deduped := spec.DeepCopy()
+	deduped.Rules = rules
+	return deduped, nil
+}
+
+// report prints the number of duplicate rules removed, or else warns about the rules repeated
+// within a policy.
+func (d *ruleDeduplicator) report() {
+	if d.remove {
+		if d.duplicates+d.replicated > 0 {
+			fmt.Fprintf(Warnings, "removed %s from %s, %s left without rules dropped\n",
+				plural(d.duplicates+d.replicated, "duplicate rule"), plural(len(d.policies), "policy"), plural(d.removed, "policy"))
+		}
+		return
+	}
+	if d.duplicates > 0 {
+		fmt.Fprintf(Warnings, "warning: found %s repeating a rule of the same policy in %s, set dedupRules to remove them\n",
+			plural(d.duplicates, "rule"), plural(len(d.within), "policy"))
+	}
+}
+
+// plural returns n followed by noun, in the plural unless n is 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	if strings.HasSuffix(noun, "y") {
+		return fmt.Sprintf("%d %sies", n, strings.TrimSuffix(noun, "y"))
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
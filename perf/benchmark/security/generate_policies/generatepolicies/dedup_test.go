@@ -0,0 +1,61 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+func TestDedupRules(t *testing.T) {
+	var warnings bytes.Buffer
+	defer func(w io.Writer) { Warnings = w }(Warnings)
+	Warnings = &warnings
+
+	// The policies of numPolicies have the same rules by design, they are not warned about.
+	policyData := SecurityPolicy{AuthZ: AuthorizationPolicy{NumPolicies: 2, NumPaths: 1}}
+	policies, err := Generate(policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 2 || warnings.Len() != 0 {
+		t.Errorf("got %d policies and warnings %q, want 2 policies and no warning", len(policies), warnings.String())
+	}
+
+	warnings.Reset()
+	policyData.DedupRules = true
+	if policies, err = Generate(policyData); err != nil {
+		t.Fatal(err)
+	}
+	if want := "removed 1 duplicate rule from 1 policy, 1 policy left without rules dropped\n"; len(policies) != 1 || warnings.String() != want {
+		t.Errorf("got %d policies and warnings %q, want 1 policy and %q", len(policies), warnings.String(), want)
+	}
+
+	warnings.Reset()
+	rule := &authzpb.Rule{To: []*authzpb.Rule_To{{Operation: &authzpb.Operation{Paths: []string{"/a"}}}}}
+	header := &MyPolicy{Metadata: MetadataStruct{Name: "repeated", Namespace: "ns"}}
+	d := newRuleDeduplicator(false)
+	spec, err := d.dedup(header, nil, &authzpb.AuthorizationPolicy{Rules: []*authzpb.Rule{rule, rule.DeepCopy()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.report()
+	if want := "warning: found 1 rule repeating a rule of the same policy in 1 policy, set dedupRules to remove them\n"; len(spec.Rules) != 2 || warnings.String() != want {
+		t.Errorf("got %d rules and warnings %q, want 2 rules and %q", len(spec.Rules), warnings.String(), want)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/runtime/protoiface"
+
+	networkingpb "istio.io/api/networking/v1alpha3"
+	authzpb "istio.io/api/security/v1beta1"
+	typepb "istio.io/api/type/v1beta1"
+)
+
+const (
+	// egressGatewayName is the name of the Gateway of the generated egress routing.
+	egressGatewayName = "egress-gateway"
+	// egressGatewayService is the service of the egress gateway of the default Istio profiles.
+	egressGatewayService = "istio-egressgateway"
+	// egressPort is the port of the external hosts and of the egress gateway server.
+	egressPort = 80
+	// egressDenyName is the name of the DENY AuthorizationPolicy of the blocked hosts.
+	egressDenyName = "egress-deny"
+)
+
+// blockedHosts returns the egressBlockedHosts external hosts of policyData.
+func blockedHosts(policyData SecurityPolicy) []string {
+	hosts := make([]string, policyData.EgressBlockedHosts)
+	for i := range hosts {
+		hosts[i] = fmt.Sprintf("blocked-host-%d.example.com", i)
+	}
+	return hosts
+}
+
+// EgressRouting returns the resources routing the traffic to the external hosts of the
+// AuthorizationPolicies through the egress gateway selected by authZ.selector, so that the
+// policies control the outbound traffic: a Gateway, and a ServiceEntry and a VirtualService per
+// host. The hosts are the numHosts values of the "hosts" field and the egressBlockedHosts blocked
+// hosts, and the resources are generated in the namespace of the policies, which must be the one
+// of the egress gateway. It returns nil unless policyData.Egress is set.
+func EgressRouting(policyData SecurityPolicy) ([]Resource, error) {
+	if !policyData.Egress {
+		return nil, nil
+	}
+	authZ := policyData.AuthZ
+	if len(authZ.Selector) == 0 {
+		return nil, newPolicyError(ErrInvalidConfig, "Gateway", nil, -1, fmt.Errorf("egress requires the selector of the egress gateway"))
+	}
+	if authZ.NumHosts <= 0 {
+		return nil, newPolicyError(ErrInvalidConfig, "ServiceEntry", nil, -1, fmt.Errorf("egress requires numHosts external hosts"))
+	}
+	if policyData.EgressBlockedHosts < 0 {
+		return nil, newPolicyError(ErrInvalidConfig, "ServiceEntry", nil, -1, fmt.Errorf("invalid egressBlockedHosts %d", policyData.EgressBlockedHosts))
+	}
+	hosts := make([]string, authZ.NumHosts)
+	for i := range hosts {
+		hosts[i] = policyData.Value("hosts", i)
+	}
+	hosts = append(hosts, blockedHosts(policyData)...)
+	namespace := policyData.Namespace
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	gatewayHost := fmt.Sprintf("%s.%s.svc.cluster.local", egressGatewayService, namespace)
+
+	var resources []Resource
+	add := func(kind, name string, spec protoiface.MessageV1) error {
+		header := createPolicyHeader(namespace, name, kind)
+		header.APIVersion = "networking.istio.io/v1alpha3"
+		resource, err := newResource(policyData.RoundTripCheck, header, spec)
+		resources = append(resources, resource)
+		return err
+	}
+	err := add("Gateway", egressGatewayName, &networkingpb.Gateway{
+		Selector: authZ.Selector,
+		Servers: []*networkingpb.Server{{
+			Port:  &networkingpb.Port{Number: egressPort, Name: "http", Protocol: "HTTP"},
+			Hosts: hosts,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, host := range hosts {
+		err := add("ServiceEntry", fmt.Sprintf("egress-%d", i), &networkingpb.ServiceEntry{
+			Hosts:      []string{host},
+			Ports:      []*networkingpb.Port{{Number: egressPort, Name: "http", Protocol: "HTTP"}},
+			Location:   networkingpb.ServiceEntry_MESH_EXTERNAL,
+			Resolution: networkingpb.ServiceEntry_DNS,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, host := range hosts {
+		err := add("VirtualService", fmt.Sprintf("egress-%d", i), &networkingpb.VirtualService{
+			Hosts:    []string{host},
+			Gateways: []string{"mesh", egressGatewayName},
+			Http: []*networkingpb.HTTPRoute{
+				egressRoute("mesh", gatewayHost),
+				egressRoute(egressGatewayName, host),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resources, nil
+}
+
+// EgressDenyPolicy returns the DENY AuthorizationPolicy of the egress gateway selected by
+// authZ.selector denying the egressBlockedHosts hosts routed by EgressRouting, in the namespace of
+// the policies. It returns nil unless policyData.Egress is set with blocked hosts.
+func EgressDenyPolicy(policyData SecurityPolicy) ([]Resource, error) {
+	if !policyData.Egress || policyData.EgressBlockedHosts <= 0 {
+		return nil, nil
+	}
+	if len(policyData.AuthZ.Selector) == 0 {
+		return nil, newPolicyError(ErrInvalidConfig, "AuthorizationPolicy", nil, -1, fmt.Errorf("egress requires the selector of the egress gateway"))
+	}
+	header := createPolicyHeader(policyData.Namespace, egressDenyName, "AuthorizationPolicy")
+	resource, err := newResource(policyData.RoundTripCheck, header, &authzpb.AuthorizationPolicy{
+		Selector: &typepb.WorkloadSelector{MatchLabels: policyData.AuthZ.Selector},
+		Action:   authzpb.AuthorizationPolicy_DENY,
+		Rules: []*authzpb.Rule{{
+			To: []*authzpb.Rule_To{{Operation: &authzpb.Operation{Hosts: blockedHosts(policyData)}}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []Resource{resource}, nil
+}
+
+// egressRoute returns the route of the traffic of gateway to host.
+func egressRoute(gateway, host string) *networkingpb.HTTPRoute {
+	return &networkingpb.HTTPRoute{
+		Match: []*networkingpb.HTTPMatchRequest{{Gateways: []string{gateway}, Port: egressPort}},
+		Route: []*networkingpb.HTTPRouteDestination{{
+			Destination: &networkingpb.Destination{Host: host, Port: &networkingpb.PortSelector{Number: egressPort}},
+		}},
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEgressRouting(t *testing.T) {
+	policyData := SecurityPolicy{
+		Namespace:      "istio-system",
+		Egress:         true,
+		RoundTripCheck: true,
+		AuthZ: AuthorizationPolicy{
+			Selector:    map[string]string{"istio": "egressgateway"},
+			NumPolicies: 1,
+			NumHosts:    3,
+		},
+	}
+	resources, err := EgressRouting(policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	for _, r := range resources {
+		kinds = append(kinds, r.Kind)
+	}
+	if got, want := strings.Join(kinds, ","), "Gateway,ServiceEntry,ServiceEntry,ServiceEntry,VirtualService,VirtualService,VirtualService"; got != want {
+		t.Fatalf("got kinds %s, want %s", got, want)
+	}
+	doc, err := resources[len(resources)-1].YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"host: istio-egressgateway.istio-system.svc.cluster.local", "host: invalid-host-2.example.com"} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("the VirtualService does not route to %s:\n%s", want, doc)
+		}
+	}
+
+	policyData.AuthZ.Selector = nil
+	if _, err := EgressRouting(policyData); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("got error %v without a selector, want class %v", err, ErrInvalidConfig)
+	}
+	policyData.Egress = false
+	if resources, err := EgressRouting(policyData); err != nil || resources != nil {
+		t.Errorf("got %d resources, %v without egress", len(resources), err)
+	}
+}
+
+func TestEgressDenyPolicy(t *testing.T) {
+	policyData := SecurityPolicy{
+		Namespace:          "istio-system",
+		Egress:             true,
+		EgressBlockedHosts: 2,
+		RoundTripCheck:     true,
+		AuthZ: AuthorizationPolicy{
+			Action:      "ALLOW",
+			Selector:    map[string]string{"istio": "egressgateway"},
+			NumPolicies: 1,
+			NumHosts:    3,
+		},
+	}
+	// The blocked hosts are routed through the egress gateway with the allowed ones.
+	routing, err := EgressRouting(policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routing) != 1+2*5 {
+		t.Errorf("got %d routing resources, want a Gateway and a ServiceEntry and a VirtualService per host", len(routing))
+	}
+	resources, err := EgressDenyPolicy(policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 1 {
+		t.Fatalf("got %d resources, want the DENY policy", len(resources))
+	}
+	doc, err := resources[0].YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"name: egress-deny", "action: DENY", "istio: egressgateway", "blocked-host-1.example.com"} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("the DENY policy does not contain %s:\n%s", want, doc)
+		}
+	}
+	if strings.Contains(doc, "invalid-host-0.example.com") {
+		t.Errorf("the DENY policy matches an allowed host:\n%s", doc)
+	}
+
+	policyData.EgressBlockedHosts = 0
+	if resources, err := EgressDenyPolicy(policyData); err != nil || resources != nil {
+		t.Errorf("got %d resources, %v without blocked hosts", len(resources), err)
+	}
+}
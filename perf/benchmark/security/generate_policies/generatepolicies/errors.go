@@ -0,0 +1,101 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The classes of the errors returned by Generate, matched with errors.Is. Errors about a policy
+// are *PolicyError values, errors.As returns the policy and rule they are about.
+var (
+	// ErrInvalidConfig reports a config the policies cannot be generated from, e.g. an unknown
+	// action or mtlsMode.
+	ErrInvalidConfig = errors.New("invalid config")
+	// ErrInvalidPolicy reports a generated spec the Istio admission webhook would reject.
+	ErrInvalidPolicy = errors.New("invalid policy")
+	// ErrSigningKey reports a signing key of the RequestAuthentications that cannot be loaded or
+	// created.
+	ErrSigningKey = errors.New("signing key unavailable")
+	// ErrMarshal reports a policy that cannot be marshaled.
+	ErrMarshal = errors.New("marshaling failed")
+	// ErrRoundTrip reports a marshaled policy parsing back into a different policy.
+	ErrRoundTrip = errors.New("round trip check failed")
+	// ErrTooLarge reports a policy over maxPolicyBytes that cannot be split further.
+	ErrTooLarge = errors.New("policy too large")
+)
+
+// PolicyError is an error generating a policy.
+type PolicyError struct {
+	// Class is one of the Err* classes of the package.
+	Class error
+	// Kind, Namespace and Name identify the policy, the name is empty for errors raised before a
+	// policy is named, e.g. by BuildAuthorizationPolicy.
+	Kind      string
+	Namespace string
+	Name      string
+	// Rule is the index of the rule of the error, -1 for errors about the whole policy.
+	Rule int
+	// Err is the cause of the error.
+	Err error
+}
+
+func (e *PolicyError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Class.Error())
+	if e.Kind != "" {
+		b.WriteString(" in " + e.Kind)
+	}
+	if e.Name != "" {
+		fmt.Fprintf(&b, " %s/%s", e.Namespace, e.Name)
+	}
+	if e.Rule >= 0 {
+		fmt.Fprintf(&b, " rules[%d]", e.Rule)
+	}
+	if e.Err != nil {
+		b.WriteString(": " + e.Err.Error())
+	}
+	return b.String()
+}
+
+func (e *PolicyError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the class of the error.
+func (e *PolicyError) Is(target error) bool {
+	return target == e.Class
+}
+
+// newPolicyError returns an error of class about the policy of header, or about kind when header
+// is nil.
+func newPolicyError(class error, kind string, header *MyPolicy, rule int, err error) *PolicyError {
+	e := &PolicyError{Class: class, Kind: kind, Rule: rule, Err: err}
+	if header != nil {
+		e.Kind, e.Namespace, e.Name = header.Kind, header.Metadata.Namespace, header.Metadata.Name
+	}
+	return e
+}
+
+// withPolicy sets the policy of header on a PolicyError not naming its policy yet.
+func withPolicy(err error, header *MyPolicy) error {
+	var e *PolicyError
+	if errors.As(err, &e) && e.Name == "" {
+		e.Kind, e.Namespace, e.Name = header.Kind, header.Metadata.Namespace, header.Metadata.Name
+	}
+	return err
+}
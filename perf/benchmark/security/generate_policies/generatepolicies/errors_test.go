@@ -0,0 +1,106 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPolicyErrors(t *testing.T) {
+	badIP := WithValueSource(func(field string, i int) string {
+		if field == "sourceIPs" && i == 1 {
+			return "10.0.0.256"
+		}
+		return ""
+	})
+	cases := []struct {
+		name  string
+		opts  []Option
+		class error
+		kind  string
+		rule  int
+	}{
+		{
+			name:  "invalid value",
+			opts:  []Option{WithKind("AuthorizationPolicy", 1), WithCounts(Counts{Paths: 1, SourceIPs: 2}), badIP},
+			class: ErrInvalidPolicy,
+			kind:  "AuthorizationPolicy",
+			rule:  0,
+		},
+		{
+			name:  "custom without provider",
+			opts:  []Option{WithKind("AuthorizationPolicy", 1), WithAction("CUSTOM")},
+			class: ErrInvalidConfig,
+			kind:  "AuthorizationPolicy",
+			rule:  -1,
+		},
+		{
+			name:  "ambient paths",
+			opts:  []Option{WithKind("AuthorizationPolicy", 1), WithAmbient(), WithCounts(Counts{Principals: 1, Paths: 1})},
+			class: ErrInvalidConfig,
+			kind:  "AuthorizationPolicy",
+			rule:  1,
+		},
+		{
+			name:  "ambient request authentication",
+			opts:  []Option{WithKind("RequestAuthentication", 1), WithAmbient()},
+			class: ErrInvalidConfig,
+			kind:  "RequestAuthentication",
+			rule:  -1,
+		},
+		{
+			name:  "no policies",
+			class: ErrInvalidConfig,
+			rule:  -1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g, err := NewGenerator(c.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = g.Generate()
+			if !errors.Is(err, c.class) {
+				t.Fatalf("got error %v, want class %v", err, c.class)
+			}
+			var policyErr *PolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("got error %T, want a *PolicyError", err)
+			}
+			if policyErr.Kind != c.kind || policyErr.Rule != c.rule {
+				t.Errorf("got kind %q and rule %d, want %q and %d", policyErr.Kind, policyErr.Rule, c.kind, c.rule)
+			}
+			if c.kind == "AuthorizationPolicy" && policyErr.Name != "test-authorizationpolicy-1" {
+				t.Errorf("got policy name %q", policyErr.Name)
+			}
+		})
+	}
+
+	ambient, err := NewGenerator(WithKind("AuthorizationPolicy", 1), WithAmbient(),
+		WithCounts(Counts{Principals: 2, Namespaces: 2, SourceIPs: 2, Ports: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ambient.Generate(); err != nil {
+		t.Errorf("got error %v generating ambient policies", err)
+	}
+
+	_, err = Generate(SecurityPolicy{MaxPolicyBytes: 10, AuthZ: AuthorizationPolicy{NumPolicies: 1, NumPaths: 1}})
+	if !errors.Is(err, ErrTooLarge) || errors.Is(err, ErrMarshal) {
+		t.Errorf("got error %v, want class %v", err, ErrTooLarge)
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+// RuleGenerator generates one of the rules of the AuthorizationPolicies. Rule generators are
+// registered by name with RegisterGenerator, and the rules of the enabled generators are added to
+// every policy in the order of their names.
+type RuleGenerator interface {
+	// Enabled reports whether policyData asks for the rule of the generator.
+	Enabled(policyData SecurityPolicy) bool
+	// Generate returns the rule described by policyData.
+	Generate(policyData SecurityPolicy) *authzpb.Rule
+}
+
+var (
+	generatorsMutex sync.RWMutex
+	generators      = map[string]RuleGenerator{}
+)
+
+func init() {
+	RegisterGenerator("from", sourceGenerator{})
+	RegisterGenerator("to", operationGenerator{})
+	RegisterGenerator("when", conditionGenerator{})
+}
+
+// RegisterGenerator makes a rule generator available under name, so that organization specific
+// rule shapes can be generated without changing this package. Its parameters can be passed in
+// authZ.extensions[name] of the config. It panics if the name is already registered, like the
+// registries of the standard library, as it is meant to be called from init functions.
+func RegisterGenerator(name string, gen RuleGenerator) {
+	generatorsMutex.Lock()
+	defer generatorsMutex.Unlock()
+	if gen == nil {
+		panic("generatepolicies: RegisterGenerator of a nil generator " + name)
+	}
+	if _, ok := generators[name]; ok {
+		panic("generatepolicies: RegisterGenerator called twice for generator " + name)
+	}
+	generators[name] = gen
+}
+
+// Generators returns the names of the registered rule generators, sorted.
+func Generators() []string {
+	generatorsMutex.RLock()
+	defer generatorsMutex.RUnlock()
+	names := make([]string, 0, len(generators))
+	for name := range generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// httpMethods are the methods used, in order, by the path x method matrix.
+var httpMethods = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS", "CONNECT", "TRACE"}
+
+// PathMatrixPaths returns the paths of the path x method matrix.
+func PathMatrixPaths(numPaths int) []string {
+	paths := make([]string, numPaths)
+	for i := 0; i < numPaths; i++ {
+		paths[i] = fmt.Sprintf("/route-%d", i)
+	}
+	return paths
+}
+
+// PathMatrixHosts returns the hosts of the host x path x method matrix.
+func PathMatrixHosts(numHosts int) []string {
+	hosts := make([]string, numHosts)
+	for i := 0; i < numHosts; i++ {
+		hosts[i] = fmt.Sprintf("route-%d.example.com", i)
+	}
+	return hosts
+}
+
+// PathMatrixMethods returns the methods of the path x method matrix.
+func PathMatrixMethods(numMethods int) []string {
+	if numMethods > len(httpMethods) {
+		numMethods = len(httpMethods)
+	}
+	return httpMethods[:numMethods]
+}
+
+// PrincipalNamespace is the namespace of the service accounts of the generated principals.
+const PrincipalNamespace = "twopods-istio"
+
+// NamespaceName returns the i-th namespace of the generated source namespaces.
+func NamespaceName(i int) string {
+	return fmt.Sprintf("invalid-namespace-%d", i)
+}
+
+// ServiceAccountName returns the service account of the i-th generated source principal.
+func ServiceAccountName(i int) string {
+	return fmt.Sprintf("invalid-%d", i)
+}
+
+// PrincipalName returns the i-th principal of the generated source principals.
+func PrincipalName(i int) string {
+	return fmt.Sprintf("cluster.local/ns/%s/sa/%s", PrincipalNamespace, ServiceAccountName(i))
+}
+
+type operationGenerator struct{}
+
+func (operationGenerator) Enabled(policyData SecurityPolicy) bool {
+	authZ := policyData.AuthZ
+	return authZ.NumPaths > 0 || authZ.NumPorts > 0 || authZ.NumHosts > 0
+}
+
+func (operationGenerator) Generate(policyData SecurityPolicy) *authzpb.Rule {
+	rule := &authzpb.Rule{}
+	var listOperation []*authzpb.Rule_To
+
+	numPaths, numHosts := policyData.AuthZ.NumPaths, policyData.AuthZ.NumHosts
+	matrix := numPaths > 0 && policyData.AuthZ.NumMethods > 0
+	if matrix {
+		// Generate a [host x] path x method matrix with one operation per route.
+		hosts := [][]string{nil}
+		if numHosts > 0 {
+			hosts = nil
+			for _, host := range PathMatrixHosts(numHosts) {
+				hosts = append(hosts, []string{host})
+			}
+		}
+		for _, host := range hosts {
+			for _, path := range PathMatrixPaths(numPaths) {
+				for _, method := range PathMatrixMethods(policyData.AuthZ.NumMethods) {
+					operation := &authzpb.Rule_To{
+						Operation: &authzpb.Operation{
+							Hosts:   host,
+							Paths:   []string{path},
+							Methods: []string{method},
+						},
+					}
+					listOperation = append(listOperation, operation)
+				}
+			}
+		}
+	} else if numPaths > 0 {
+		paths := make([]string, numPaths)
+		for i := 0; i < numPaths; i++ {
+			paths[i] = policyData.Value("paths", i)
+		}
+		operation := &authzpb.Rule_To{
+			Operation: &authzpb.Operation{
+				Paths: paths,
+			},
+		}
+		listOperation = append(listOperation, operation)
+	}
+
+	if numHosts > 0 && !matrix {
+		hosts := make([]string, numHosts)
+		for i := 0; i < numHosts; i++ {
+			hosts[i] = policyData.Value("hosts", i)
+		}
+		operation := &authzpb.Rule_To{
+			Operation: &authzpb.Operation{
+				Hosts: hosts,
+			},
+		}
+		listOperation = append(listOperation, operation)
+	}
+
+	if numPorts := policyData.AuthZ.NumPorts; numPorts > 0 {
+		ports := make([]string, numPorts)
+		for i := 0; i < numPorts; i++ {
+			ports[i] = policyData.Value("ports", i)
+		}
+		operation := &authzpb.Rule_To{
+			Operation: &authzpb.Operation{
+				Ports: ports,
+			},
+		}
+		listOperation = append(listOperation, operation)
+	}
+	rule.To = listOperation
+	return rule
+}
+
+type conditionGenerator struct{}
+
+func (conditionGenerator) Enabled(policyData SecurityPolicy) bool {
+	authZ := policyData.AuthZ
+	return authZ.NumValues > 0 || authZ.NumClaims > 0 || authZ.NumSNIs > 0
+}
+
+func (conditionGenerator) Generate(policyData SecurityPolicy) *authzpb.Rule {
+	rule := &authzpb.Rule{}
+	var listCondition []*authzpb.Condition
+
+	if numValues := policyData.AuthZ.NumValues; numValues > 0 {
+		values := make([]string, numValues)
+		for i := 0; i < numValues; i++ {
+			if i == numValues-1 && policyData.AuthZ.Action == "ALLOW" {
+				values[i] = "admin"
+			} else {
+				values[i] = "guest"
+			}
+		}
+		condition := &authzpb.Condition{
+			Key:    "request.headers[x-token]",
+			Values: values,
+		}
+		listCondition = append(listCondition, condition)
+	}
+
+	if numClaims := policyData.AuthZ.NumClaims; numClaims > 0 {
+		values := make([]string, numClaims)
+		for i := 0; i < numClaims; i++ {
+			if i == numClaims-1 && policyData.AuthZ.Action == "ALLOW" {
+				values[i] = tokenGroup
+			} else {
+				values[i] = fmt.Sprintf("invalid-group-%d", i)
+				if policyData.AuthZ.Unicode {
+					values[i] = unicodeValue("claims", i, values[i])
+				}
+			}
+		}
+		condition := &authzpb.Condition{
+			Key:    fmt.Sprintf("request.auth.claims[%s]", tokenGroupsClaim),
+			Values: values,
+		}
+		listCondition = append(listCondition, condition)
+	}
+
+	if numSNIs := policyData.AuthZ.NumSNIs; numSNIs > 0 {
+		values := make([]string, numSNIs)
+		for i := 0; i < numSNIs; i++ {
+			values[i] = policyData.Value("snis", i)
+		}
+		condition := &authzpb.Condition{
+			Key:    "connection.sni",
+			Values: values,
+		}
+		listCondition = append(listCondition, condition)
+	}
+	rule.When = listCondition
+	return rule
+}
+
+type sourceGenerator struct{}
+
+func (sourceGenerator) Enabled(policyData SecurityPolicy) bool {
+	authZ := policyData.AuthZ
+	return authZ.NumSourceIP > 0 || authZ.NumRemoteIP > 0 || authZ.NumNamespaces > 0 ||
+		authZ.NumPrincipals > 0 || authZ.NumRequestPrincipals > 0
+}
+
+func (sourceGenerator) Generate(policyData SecurityPolicy) *authzpb.Rule {
+	rule := &authzpb.Rule{}
+	var listSource []*authzpb.Rule_From
+
+	if numSourceIP := policyData.AuthZ.NumSourceIP; numSourceIP > 0 {
+		sourceIPList := make([]string, numSourceIP)
+		for i := 0; i < numSourceIP; i++ {
+			sourceIPList[i] = policyData.Value("sourceIPs", i)
+		}
+		source := &authzpb.Rule_From{
+			Source: &authzpb.Source{
+				IpBlocks: sourceIPList,
+			},
+		}
+		listSource = append(listSource, source)
+	}
+
+	if numRemoteIP := policyData.AuthZ.NumRemoteIP; numRemoteIP > 0 {
+		remoteIPList := make([]string, numRemoteIP)
+		for i := 0; i < numRemoteIP; i++ {
+			remoteIPList[i] = policyData.Value("remoteIPs", i)
+		}
+		source := &authzpb.Rule_From{
+			Source: &authzpb.Source{
+				RemoteIpBlocks: remoteIPList,
+			},
+		}
+		listSource = append(listSource, source)
+	}
+
+	if numNamepaces := policyData.AuthZ.NumNamespaces; numNamepaces > 0 {
+		namespaces := make([]string, numNamepaces)
+		for i := 0; i < numNamepaces; i++ {
+			namespaces[i] = policyData.Value("namespaces", i)
+		}
+		source := &authzpb.Rule_From{
+			Source: &authzpb.Source{
+				Namespaces: namespaces,
+			},
+		}
+		listSource = append(listSource, source)
+	}
+
+	if numPrincipals := policyData.AuthZ.NumPrincipals; numPrincipals > 0 {
+		principals := make([]string, numPrincipals)
+		for i := 0; i < numPrincipals; i++ {
+			principals[i] = policyData.Value("principals", i)
+		}
+		source := &authzpb.Rule_From{
+			Source: &authzpb.Source{
+				Principals: principals,
+			},
+		}
+		listSource = append(listSource, source)
+	}
+
+	if numRequestPrincipals := policyData.AuthZ.NumRequestPrincipals; numRequestPrincipals > 0 {
+		requestPrincipals := make([]string, numRequestPrincipals)
+		for i := 0; i < numRequestPrincipals; i++ {
+			principalValue := "invalid-issuer/subject"
+			if i == numRequestPrincipals-1 {
+				principalValue = fmt.Sprintf("issuer-%d/subject", policyData.RequestAuthN.NumJwks)
+			}
+			requestPrincipals[i] = principalValue
+		}
+		source := &authzpb.Rule_From{
+			Source: &authzpb.Source{
+				RequestPrincipals: requestPrincipals,
+			},
+		}
+		listSource = append(listSource, source)
+	}
+	rule.From = listSource
+	return rule
+}
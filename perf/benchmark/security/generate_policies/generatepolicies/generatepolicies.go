@@ -0,0 +1,577 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package generatepolicies generates large sets of Istio security policies for performance tests.
+package generatepolicies
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/runtime/protoimpl"
+	"sigs.k8s.io/yaml"
+
+	authzpb "istio.io/api/security/v1beta1"
+	typepb "istio.io/api/type/v1beta1"
+)
+
+// Warnings is where warnings about the generated policies, such as split policies or duplicate
+// rules, are written.
+var Warnings io.Writer = os.Stderr
+
+type SecurityPolicy struct {
+	AuthZ        AuthorizationPolicy   `json:"authZ"`
+	Namespace    string                `json:"namespace"`
+	PeerAuthN    PeerAuthentication    `json:"peerAuthN"`
+	RequestAuthN RequestAuthentication `json:"requestAuthN"`
+	// MaxPolicyBytes caps the size of a generated AuthorizationPolicy, larger policies are split
+	// into several policies matching the same requests. Defaults to 1MiB.
+	MaxPolicyBytes int `json:"maxPolicyBytes"`
+	// MaxRulesPerPolicy caps the number of rules of a generated AuthorizationPolicy, policies with
+	// more rules are split into several policies matching the same requests. No cap by default.
+	MaxRulesPerPolicy int `json:"maxRulesPerPolicy"`
+	// DedupRules removes the rules identical to a rule of a previous AuthorizationPolicy with the
+	// same namespace, selector and action, which are otherwise only reported.
+	DedupRules bool `json:"dedupRules"`
+	// RoundTripCheck parses every generated document back and fails when it differs from the
+	// spec it was marshaled from.
+	RoundTripCheck bool `json:"roundTripCheck"`
+	// Ambient restricts the AuthorizationPolicies to the fields ztunnel enforces without a
+	// waypoint, generation fails on a config relying on HTTP fields.
+	Ambient bool `json:"ambient"`
+	// Egress also generates the routing of the external hosts of the AuthorizationPolicies
+	// through an egress gateway, see EgressRouting.
+	Egress bool `json:"egress"`
+	// EgressBlockedHosts also routes this many external hosts through the egress gateway, denied
+	// there by a DENY AuthorizationPolicy, see EgressDenyPolicy.
+	EgressBlockedHosts int `json:"egressBlockedHosts"`
+	// NamespaceIsolation also generates the AuthorizationPolicies isolating many namespaces.
+	NamespaceIsolation *NamespaceIsolation `json:"namespaceIsolation"`
+	// Tiers also generates AuthorizationPolicies layered in mesh, namespace and workload tiers.
+	Tiers *Tiers `json:"tiers"`
+	// Tenants also generates the AuthorizationPolicies isolating many tenants.
+	Tenants *Tenants `json:"tenants"`
+	// NameByHash appends a short hash of its spec to the name of every policy, so that
+	// generating the same policies again is idempotent under kubectl apply and changed
+	// policies get new names.
+	NameByHash bool `json:"nameByHash"`
+	// ExtensionProviders are the extension providers of the MeshConfig returned by MeshConfig,
+	// e.g. the ext_authz services of CUSTOM policies or the tracing backends of Telemetry
+	// resources.
+	ExtensionProviders []ExtensionProvider `json:"extensionProviders"`
+	// SidecarScope also generates Sidecar resources narrowing the egress of the proxies of the
+	// namespaces of the policies, see SidecarResources.
+	SidecarScope *SidecarScope `json:"sidecarScope"`
+	// AccessLogs also generates a Telemetry resource enabling the access logs of the targeted
+	// workloads with the decisions of the RBAC filters, see AccessLogTelemetry.
+	AccessLogs *AccessLogs `json:"accessLogs"`
+
+	// values overrides the default values of the generated rules, see WithValueSource.
+	values ValueSource
+	// rand and clock are the random source and the clock of the generators, see WithRandom and
+	// WithClock.
+	rand  *rand.Rand
+	clock Clock
+}
+
+type AuthorizationPolicy struct {
+	Action string `json:"action"`
+	// Provider is the extension provider of CUSTOM policies.
+	Provider string `json:"provider"`
+	// Selector restricts the policies to the workloads with these labels.
+	Selector map[string]string `json:"selector"`
+	// NumSelectors spreads the policies round robin over the selectors app: workload-1 to
+	// app: workload-<numSelectors>, added to the labels of selector. With numPolicies selectors
+	// every policy selects its own workloads.
+	NumSelectors int `json:"numSelectors"`
+	// Waypoint binds the policies to waypoint proxies instead of the workloads of a selector.
+	Waypoint      *Waypoint `json:"waypoint"`
+	NumNamespaces int       `json:"numNamespaces"`
+	NumPaths      int       `json:"numPaths"`
+	// NumMethods turns the paths into a numPaths x numMethods matrix with one operation
+	// per path and method.
+	NumMethods int `json:"numMethods"`
+	// NumHosts adds an operation matching this many hosts, or with numMethods turns the
+	// matrix into a numHosts x numPaths x numMethods matrix.
+	NumHosts      int `json:"numHosts"`
+	NumPolicies   int `json:"numPolicies"`
+	NumPrincipals int `json:"numPrincipals"`
+	NumSourceIP   int `json:"numSourceIP"`
+	NumRemoteIP   int `json:"numRemoteIP"`
+	// NumPorts adds an operation matching this many destination ports.
+	NumPorts  int `json:"numPorts"`
+	NumValues int `json:"numValues"`
+	// NumSNIs adds a connection.sni condition with this many values.
+	NumSNIs int `json:"numSNIs"`
+	// The request_principal in the generated authorization policy will match the
+	// RequestAuthentication policies generated from the requestAuthN. This allows
+	// to test RequestAuthentication and AuthorizationPolicy together to verify that
+	// a request with a valid JWT token is allowed.
+	NumRequestPrincipals int `json:"numRequestPrincipals"`
+	// NumClaims adds a request.auth.claims[groups] condition. For ALLOW policies the last
+	// value matches the groups claim of the generated token.
+	NumClaims int `json:"numClaims"`
+	// Unicode adds multi-byte UTF-8, percent-encoded sequences and mixed scripts to the
+	// generated paths, hosts, SNIs and claim values that are not meant to match, to measure the
+	// matchers with non-ASCII values. The paths and hosts of the path matrix stay ASCII.
+	Unicode bool `json:"unicode"`
+	// ClaimNesting adds a rule with conditions on nested claims of the generated token.
+	ClaimNesting *ClaimNesting `json:"claimNesting"`
+	// Extensions holds the parameters of the generators registered with RegisterGenerator,
+	// keyed by generator name.
+	Extensions map[string]json.RawMessage `json:"extensions"`
+}
+
+type PeerAuthentication struct {
+	MtlsMode    string `json:"mtlsMode"`
+	NumPolicies int    `json:"numPolicies"`
+}
+
+type RequestAuthentication struct {
+	// Setting InvalidToken to true will create a token which will be signed by it's own
+	// privateKey creating a token which will never match with a jwks
+	InvalidToken bool   `json:"invalidToken"`
+	NumPolicies  int    `json:"numPolicies"`
+	NumJwks      int    `json:"numJwks"`
+	TokenIssuer  string `json:"tokenIssuer"`
+	// KeyFile is the PEM file of the RSA key signing the token, created if it does not exist.
+	// Setting it allows the jwks subcommand to serve the key of the generated policies.
+	KeyFile string `json:"keyFile"`
+	// JwksURI makes the jwtRules reference the JWKS served at this URI instead of inlining it.
+	JwksURI string `json:"jwksUri"`
+	// RemoteJwks makes the proxies fetch the JWKS at jwksUri instead of istiod, and
+	// JwksInsecureSkipVerify makes istiod skip the verification of its certificate. Both are
+	// istiod settings of the MeshConfig overlay.
+	RemoteJwks             bool `json:"remoteJwks"`
+	JwksInsecureSkipVerify bool `json:"jwksInsecureSkipVerify"`
+	// TokenExpirySeconds adds iat and exp claims to the generated token, which expires this many
+	// seconds after it was generated.
+	TokenExpirySeconds int `json:"tokenExpirySeconds"`
+}
+
+// MyPolicy is the header of a generated policy.
+type MyPolicy struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Metadata   MetadataStruct `json:"metadata"`
+}
+
+type MetadataStruct struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// Resource is a generated policy.
+type Resource struct {
+	MyPolicy
+	Spec protoiface.MessageV1
+	// TargetRefs are the targetRefs of an AuthorizationPolicy bound to waypoints.
+	TargetRefs []PolicyTargetReference
+
+	// yaml is the YAML document of the resource, when it is already marshaled.
+	yaml string
+}
+
+// YAML returns the YAML document of the resource.
+func (r Resource) YAML() (string, error) {
+	if r.yaml != "" {
+		return r.yaml, nil
+	}
+	doc, err := PolicyToYAML(&r.MyPolicy, r.Spec)
+	if err != nil {
+		return "", err
+	}
+	return appendTargetRefs(doc, r.TargetRefs)
+}
+
+// ToJSON returns the JSON of msg, marshaled with protojson.
+func ToJSON(msg protoiface.MessageV1) (string, error) {
+	return ToJSONWithIndent(msg, "")
+}
+
+func ToJSONWithIndent(msg protoiface.MessageV1, indent string) (string, error) {
+	if msg == nil {
+		return "", fmt.Errorf("unexpected nil message")
+	}
+
+	// The istio.io/api types are gogo messages, wrapped into a protoreflect view for protojson.
+	js, err := protojson.MarshalOptions{Indent: indent}.Marshal(protoimpl.X.ProtoMessageV2Of(msg))
+	if err != nil {
+		return "", err
+	}
+	return string(js), nil
+}
+
+func ToYAML(msg protoiface.MessageV1) (string, error) {
+	if msg != nil {
+		if yml, ok := writeYAML(msg); ok {
+			return yml, nil
+		}
+	}
+	return toYAMLSlow(msg)
+}
+
+// toYAMLSlow marshals msg through protojson and a JSON to YAML conversion, for what the direct
+// writer cannot marshal.
+func toYAMLSlow(msg protoiface.MessageV1) (string, error) {
+	js, err := ToJSON(msg)
+	if err != nil {
+		return "", err
+	}
+	yml, err := yaml.JSONToYAML([]byte(js))
+	return string(yml), err
+}
+
+// PolicyToYAML returns the YAML document of the policy, marshaled as a single object of its
+// header and spec.
+func PolicyToYAML(policy *MyPolicy, spec protoiface.MessageV1) (string, error) {
+	if spec != nil {
+		if yml, ok := writePolicyYAML(policy, spec); ok {
+			return yml, nil
+		}
+	}
+	return policyToYAMLSlow(policy, spec)
+}
+
+// policyToYAMLSlow marshals the policy through protojson, encoding/json and a JSON to YAML
+// conversion, for what the direct writer cannot marshal.
+func policyToYAMLSlow(policy *MyPolicy, spec protoiface.MessageV1) (string, error) {
+	js, err := ToJSON(spec)
+	if err != nil {
+		return "", err
+	}
+	resource, err := json.Marshal(struct {
+		*MyPolicy
+		Spec json.RawMessage `json:"spec"`
+	}{policy, json.RawMessage(js)})
+	if err != nil {
+		return "", err
+	}
+	yml, err := yaml.JSONToYAML(resource)
+	return string(yml), err
+}
+
+// createRuleGeneratorMap returns the registered generators enabled by policyData.
+func createRuleGeneratorMap(policyData SecurityPolicy) map[string]RuleGenerator {
+	generatorsMutex.RLock()
+	defer generatorsMutex.RUnlock()
+	ruleGeneratorMap := make(map[string]RuleGenerator)
+	for name, gen := range generators {
+		if gen.Enabled(policyData) {
+			ruleGeneratorMap[name] = gen
+		}
+	}
+	return ruleGeneratorMap
+}
+
+// getOrderedKeySlice returns the rule kinds of ruleToGenerator sorted, so that the rules are
+// generated in the same order on every run.
+func getOrderedKeySlice(ruleToGenerator map[string]RuleGenerator) []string {
+	keys := make([]string, 0, len(ruleToGenerator))
+	for name := range ruleToGenerator {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// generateAuthorizationPolicy returns the AuthorizationPolicy described by policyData, split into
+// several policies when it is larger than policyData.MaxPolicyBytes or has more rules than the cap
+// of splits. Rules already seen by dedup are reported or removed, no policy is returned when every
+// rule is removed.
+func generateAuthorizationPolicy(policyData SecurityPolicy, policyHeader *MyPolicy, targetRefs []PolicyTargetReference, dedup *ruleDeduplicator, splits *ruleSplits) ([]Resource, error) {
+	spec, err := BuildAuthorizationPolicy(policyData)
+	if err != nil {
+		return nil, err
+	}
+	if spec, err = dedup.dedup(policyHeader, targetRefs, spec); err != nil || spec == nil {
+		return nil, err
+	}
+	maxBytes := policyData.MaxPolicyBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxPolicyBytes
+	}
+	policies, err := splitAuthorizationPolicy(policyHeader, spec, maxBytes, splits, policyData.RoundTripCheck)
+	if err != nil || targetRefs == nil {
+		return policies, err
+	}
+	for i := range policies {
+		policies[i].TargetRefs = targetRefs
+		if policies[i].yaml, err = appendTargetRefs(policies[i].yaml, targetRefs); err != nil {
+			return nil, newPolicyError(ErrMarshal, "", &policies[i].MyPolicy, -1, err)
+		}
+	}
+	return policies, nil
+}
+
+// BuildAuthorizationPolicy returns the validated spec of the AuthorizationPolicies described by
+// policyData.
+func BuildAuthorizationPolicy(policyData SecurityPolicy) (*authzpb.AuthorizationPolicy, error) {
+	spec := &authzpb.AuthorizationPolicy{}
+	switch policyData.AuthZ.Action {
+	case "ALLOW":
+		spec.Action = authzpb.AuthorizationPolicy_ALLOW
+	case "DENY", "":
+		spec.Action = authzpb.AuthorizationPolicy_DENY
+	case "CUSTOM":
+		if policyData.AuthZ.Provider == "" {
+			return nil, newPolicyError(ErrInvalidConfig, "AuthorizationPolicy", nil, -1, fmt.Errorf("action CUSTOM requires a provider"))
+		}
+		spec.Action = authzpb.AuthorizationPolicy_CUSTOM
+		spec.ActionDetail = &authzpb.AuthorizationPolicy_Provider{
+			Provider: &authzpb.AuthorizationPolicy_ExtensionProvider{Name: policyData.AuthZ.Provider},
+		}
+	default:
+		return nil, newPolicyError(ErrInvalidConfig, "AuthorizationPolicy", nil, -1, fmt.Errorf("action %s not supported", policyData.AuthZ.Action))
+	}
+
+	if len(policyData.AuthZ.Selector) > 0 && policyData.AuthZ.Waypoint != nil {
+		return nil, newPolicyError(ErrInvalidConfig, "AuthorizationPolicy", nil, -1, fmt.Errorf("selector and waypoint are mutually exclusive"))
+	}
+	if n := policyData.AuthZ.ClaimNesting; n != nil {
+		if err := n.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if len(policyData.AuthZ.Selector) > 0 {
+		spec.Selector = &typepb.WorkloadSelector{MatchLabels: policyData.AuthZ.Selector}
+	}
+
+	ruleToGenerator := createRuleGeneratorMap(policyData)
+	var ruleList []*authzpb.Rule
+	for _, name := range getOrderedKeySlice(ruleToGenerator) {
+		rule := ruleToGenerator[name].Generate(policyData)
+		ruleList = append(ruleList, rule)
+	}
+	if len(ruleList) == 0 && spec.Action == authzpb.AuthorizationPolicy_CUSTOM {
+		// A CUSTOM policy without rules never calls the provider, match every request instead.
+		ruleList = []*authzpb.Rule{{}}
+	}
+	spec.Rules = ruleList
+	if err := validateAuthorizationPolicy(spec); err != nil {
+		return nil, err
+	}
+	if policyData.Ambient && policyData.AuthZ.Waypoint == nil {
+		if err := validateAmbient(spec); err != nil {
+			return nil, err
+		}
+	}
+	return spec, nil
+}
+
+func generatePeerAuthentication(policyData SecurityPolicy, policyHeader *MyPolicy) (Resource, error) {
+	spec := &authzpb.PeerAuthentication{
+		Mtls: &authzpb.PeerAuthentication_MutualTLS{},
+	}
+	switch policyData.PeerAuthN.MtlsMode {
+	case "STRICT", "":
+		spec.Mtls.Mode = authzpb.PeerAuthentication_MutualTLS_STRICT
+	case "DISABLE":
+		spec.Mtls.Mode = authzpb.PeerAuthentication_MutualTLS_DISABLE
+	case "PERMISSIVE":
+		spec.Mtls.Mode = authzpb.PeerAuthentication_MutualTLS_PERMISSIVE
+	default:
+		return Resource{}, newPolicyError(ErrInvalidConfig, "", policyHeader, -1, fmt.Errorf("invalid mtlsMode: %s", policyData.PeerAuthN.MtlsMode))
+	}
+
+	return newResource(policyData.RoundTripCheck, policyHeader, spec)
+}
+
+func generateRequestAuthentication(policyData SecurityPolicy, policyHeader *MyPolicy) (Resource, error) {
+	privateKey, err := SigningKey(policyData.RequestAuthN.KeyFile)
+	if err != nil {
+		return Resource{}, newPolicyError(ErrSigningKey, "", policyHeader, -1, err)
+	}
+	jwks, err := GenerateJwks(privateKey)
+	if err != nil {
+		return Resource{}, newPolicyError(ErrMarshal, "", policyHeader, -1, err)
+	}
+
+	var listJWTRules []*authzpb.JWTRule
+	if numJwks := policyData.RequestAuthN.NumJwks; numJwks > 0 {
+		for i := 1; i <= numJwks; i++ {
+			jwkRule := &authzpb.JWTRule{
+				Issuer: fmt.Sprintf("issuer-%d", i),
+			}
+			if jwksURI := policyData.RequestAuthN.JwksURI; jwksURI != "" {
+				jwkRule.JwksUri = jwksURI
+			} else {
+				jwkRule.Jwks = jwks
+			}
+			listJWTRules = append(listJWTRules, jwkRule)
+		}
+	}
+
+	spec := &authzpb.RequestAuthentication{
+		JwtRules: listJWTRules,
+	}
+	return newResource(policyData.RoundTripCheck, policyHeader, spec)
+}
+
+// generateRules returns the i-th policy of the kind of policyHeader, starting from 1.
+func generateRules(policyData SecurityPolicy, policyHeader *MyPolicy, i int, dedup *ruleDeduplicator, splits *ruleSplits) ([]Resource, error) {
+	switch policyHeader.Kind {
+	case "AuthorizationPolicy":
+		if numSelectors := policyData.AuthZ.NumSelectors; numSelectors > 0 {
+			policyData.AuthZ.Selector = workloadSelector(policyData.AuthZ.Selector, (i-1)%numSelectors+1)
+		}
+		policies, err := generateAuthorizationPolicy(policyData, policyHeader, policyData.AuthZ.Waypoint.targetRefs(i), dedup, splits)
+		return policies, withPolicy(err, policyHeader)
+	case "PeerAuthentication":
+		policy, err := generatePeerAuthentication(policyData, policyHeader)
+		return []Resource{policy}, err
+	case "RequestAuthentication":
+		policy, err := generateRequestAuthentication(policyData, policyHeader)
+		return []Resource{policy}, err
+	default:
+		return nil, newPolicyError(ErrInvalidConfig, "", policyHeader, -1, fmt.Errorf("unknown policy kind: %s", policyHeader.Kind))
+	}
+}
+
+// workloadSelector returns the labels of selector with app: workload-<i>.
+func workloadSelector(selector map[string]string, i int) map[string]string {
+	labels := make(map[string]string, len(selector)+1)
+	for k, v := range selector {
+		labels[k] = v
+	}
+	labels["app"] = fmt.Sprintf("workload-%d", i)
+	return labels
+}
+
+// DefaultNamespace is the namespace of the policies of configs without a namespace.
+const DefaultNamespace = "twopods-istio"
+
+func createPolicyHeader(namespace string, name string, kind string) *MyPolicy {
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	return &MyPolicy{
+		APIVersion: "security.istio.io/v1beta1",
+		Kind:       kind,
+		Metadata:   MetadataStruct{Namespace: namespace, Name: name},
+	}
+}
+
+// generatePolicy returns the numPolicy policies of kind, it stops with the policies generated so
+// far when ctx is cancelled.
+func generatePolicy(ctx context.Context, policyData SecurityPolicy, kind string, numPolicy int) ([]Resource, error) {
+	var policies []Resource
+	dedup := newRuleDeduplicator(policyData.DedupRules)
+	splits := newRuleSplits(policyData.MaxRulesPerPolicy)
+	for i := 1; i <= numPolicy; i++ {
+		if err := ctx.Err(); err != nil {
+			return policies, err
+		}
+		testName := fmt.Sprintf("test-%s-%d", strings.ToLower(kind), i)
+		policyHeader := createPolicyHeader(policyData.Namespace, testName, kind)
+
+		rules, err := generateRules(policyData, policyHeader, i, dedup, splits)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, rules...)
+	}
+	dedup.report()
+	splits.report()
+	return policies, nil
+}
+
+// Generate returns every policy described by policyData, in the order AuthorizationPolicy,
+// PeerAuthentication, RequestAuthentication.
+func Generate(policyData SecurityPolicy) ([]Resource, error) {
+	return GenerateContext(context.Background(), policyData)
+}
+
+// GenerateContext is Generate, stopping with an error when ctx is cancelled.
+func GenerateContext(ctx context.Context, policyData SecurityPolicy) ([]Resource, error) {
+	totalPolicies := policyData.AuthZ.NumPolicies + policyData.PeerAuthN.NumPolicies + policyData.RequestAuthN.NumPolicies
+	if isolation := policyData.NamespaceIsolation; isolation != nil && isolation.NumNamespaces > 0 {
+		totalPolicies += 2 * isolation.NumNamespaces
+	}
+	if policyData.Tiers != nil && policyData.Tiers.NumPolicies > 0 {
+		totalPolicies += policyData.Tiers.NumPolicies
+	}
+	if policyData.Tenants != nil {
+		totalPolicies += policyData.Tenants.numPolicies()
+	}
+	if totalPolicies <= 0 {
+		return nil, newPolicyError(ErrInvalidConfig, "", nil, -1, fmt.Errorf("invalid number of policies: %d", totalPolicies))
+	}
+	if policyData.Ambient && policyData.RequestAuthN.NumPolicies > 0 {
+		return nil, newPolicyError(ErrInvalidConfig, "RequestAuthentication", nil, -1,
+			fmt.Errorf("ambient: RequestAuthentications are not enforced by ztunnel"))
+	}
+
+	var policies []Resource
+	for _, kind := range []struct {
+		name        string
+		numPolicies int
+	}{
+		{"AuthorizationPolicy", policyData.AuthZ.NumPolicies},
+		{"PeerAuthentication", policyData.PeerAuthN.NumPolicies},
+		{"RequestAuthentication", policyData.RequestAuthN.NumPolicies},
+	} {
+		if kind.numPolicies <= 0 {
+			continue
+		}
+		generated, err := generatePolicy(ctx, policyData, kind.name, kind.numPolicies)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("generation interrupted after %d of %d policies: %w",
+				len(policies)+len(generated), totalPolicies, ctx.Err())
+		}
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, generated...)
+	}
+	for _, generate := range []struct {
+		enabled bool
+		f       func(ctx context.Context, policyData SecurityPolicy) ([]Resource, error)
+	}{
+		{policyData.NamespaceIsolation != nil, generateNamespaceIsolation},
+		{policyData.Tiers != nil, generateTiers},
+		{policyData.Tenants != nil, generateTenants},
+	} {
+		if !generate.enabled {
+			continue
+		}
+		generated, err := generate.f(ctx, policyData)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("generation interrupted after %d of %d policies: %w",
+				len(policies)+len(generated), totalPolicies, ctx.Err())
+		}
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, generated...)
+	}
+	if policyData.NameByHash {
+		for i := range policies {
+			renamed, err := withHashedName(policies[i])
+			if err != nil {
+				return nil, err
+			}
+			policies[i] = renamed
+		}
+	}
+	return policies, nil
+}
@@ -0,0 +1,199 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+func TestGetOrderedKeySlice(t *testing.T) {
+	policyData := SecurityPolicy{AuthZ: AuthorizationPolicy{NumPaths: 1, NumValues: 1, NumSourceIP: 1}}
+	for i := 0; i < 10; i++ {
+		got := strings.Join(getOrderedKeySlice(createRuleGeneratorMap(policyData)), ",")
+		if want := "from,to,when"; got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+	}
+}
+
+func TestCheckRoundTrip(t *testing.T) {
+	header := createPolicyHeader("", "round-trip", "AuthorizationPolicy")
+	spec := &authzpb.AuthorizationPolicy{
+		Action: authzpb.AuthorizationPolicy_DENY,
+		Rules: []*authzpb.Rule{{
+			To: []*authzpb.Rule_To{{Operation: &authzpb.Operation{Paths: []string{"/a", "/b"}}}},
+		}},
+	}
+	doc, err := PolicyToYAML(header, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkRoundTrip(doc, header, spec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := checkRoundTrip(strings.Replace(doc, "/b", "/c", 1), header, spec); err == nil {
+		t.Fatal("expected an error for a changed spec")
+	}
+	if err := checkRoundTrip(strings.Replace(doc, "round-trip", "other", 1), header, spec); err == nil {
+		t.Fatal("expected an error for a changed header")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	resources, err := Generate(SecurityPolicy{
+		AuthZ:     AuthorizationPolicy{NumPolicies: 2, NumPaths: 1},
+		PeerAuthN: PeerAuthentication{NumPolicies: 1, MtlsMode: "STRICT"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range resources {
+		got = append(got, r.Kind+"/"+r.Metadata.Name)
+		doc, err := r.YAML()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := checkRoundTrip(doc, &r.MyPolicy, r.Spec); err != nil {
+			t.Error(err)
+		}
+	}
+	want := "AuthorizationPolicy/test-authorizationpolicy-1,AuthorizationPolicy/test-authorizationpolicy-2,PeerAuthentication/test-peerauthentication-1"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("got %s, want %s", strings.Join(got, ","), want)
+	}
+}
+
+// hostGenerator is a generator registered by TestRegisterGenerator, adding a rule for the hosts
+// of its extension config.
+type hostGenerator struct{}
+
+func (hostGenerator) Enabled(policyData SecurityPolicy) bool {
+	_, ok := policyData.AuthZ.Extensions["test-hosts"]
+	return ok
+}
+
+func (hostGenerator) Generate(policyData SecurityPolicy) *authzpb.Rule {
+	var hosts []string
+	if err := json.Unmarshal(policyData.AuthZ.Extensions["test-hosts"], &hosts); err != nil {
+		return &authzpb.Rule{}
+	}
+	return &authzpb.Rule{To: []*authzpb.Rule_To{{Operation: &authzpb.Operation{Hosts: hosts}}}}
+}
+
+func TestRegisterGenerator(t *testing.T) {
+	RegisterGenerator("test-hosts", hostGenerator{})
+
+	spec, err := BuildAuthorizationPolicy(SecurityPolicy{AuthZ: AuthorizationPolicy{NumPaths: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Rules) != 1 {
+		t.Fatalf("got %d rules without the extension config, want 1", len(spec.Rules))
+	}
+
+	var policyData SecurityPolicy
+	if err := json.Unmarshal([]byte(`{"authZ": {"numPaths": 1, "extensions": {"test-hosts": ["a.example.com", "b.example.com"]}}}`), &policyData); err != nil {
+		t.Fatal(err)
+	}
+	spec, err = BuildAuthorizationPolicy(policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Rules) != 2 {
+		t.Fatalf("got %d rules, want 2", len(spec.Rules))
+	}
+	if got := strings.Join(spec.Rules[0].To[0].Operation.Hosts, ","); got != "a.example.com,b.example.com" {
+		t.Errorf("got hosts %s in the first rule", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic registering a generator twice")
+		}
+	}()
+	RegisterGenerator("to", operationGenerator{})
+}
+
+func TestGenerateContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := GenerateContext(ctx, SecurityPolicy{AuthZ: AuthorizationPolicy{NumPolicies: 10, NumPaths: 1}})
+	if err == nil || !strings.Contains(err.Error(), "interrupted after 0 of 10 policies") {
+		t.Fatalf("got error %v, want an interruption after 0 of 10 policies", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want it to wrap context.Canceled", err)
+	}
+}
+
+func TestNumSelectors(t *testing.T) {
+	resources, err := Generate(SecurityPolicy{AuthZ: AuthorizationPolicy{
+		NumPolicies: 5, NumSelectors: 2, NumPaths: 1, Selector: map[string]string{"version": "v1"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"workload-1", "workload-2", "workload-1", "workload-2", "workload-1"}
+	for i, r := range resources {
+		labels := r.Spec.(*authzpb.AuthorizationPolicy).GetSelector().GetMatchLabels()
+		if labels["app"] != want[i] || labels["version"] != "v1" {
+			t.Errorf("policy %d: got selector %v, want app %s and version v1", i, labels, want[i])
+		}
+	}
+}
+
+func TestNameByHash(t *testing.T) {
+	policyData := SecurityPolicy{NameByHash: true, AuthZ: AuthorizationPolicy{NumPolicies: 2, NumSelectors: 2, NumPaths: 1}}
+	names := func() []string {
+		resources, err := Generate(policyData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, r := range resources {
+			doc, err := r.YAML()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(doc, "name: "+r.Metadata.Name+"\n") {
+				t.Errorf("the YAML of %s has another name:\n%s", r.Metadata.Name, doc)
+			}
+			names = append(names, r.Metadata.Name)
+		}
+		return names
+	}
+	first := names()
+	if len(first) != 2 || !strings.HasPrefix(first[0], "test-authorizationpolicy-1-") || len(first[0]) != len("test-authorizationpolicy-1-")+nameHashLength {
+		t.Fatalf("got names %v, want test-authorizationpolicy-<i>-<hash>", first)
+	}
+	if first[0] == first[1] {
+		t.Errorf("policies with different selectors got the same hash: %v", first)
+	}
+	if again := names(); !reflect.DeepEqual(again, first) {
+		t.Errorf("got names %v generating again, want %v", again, first)
+	}
+	policyData.AuthZ.Action = "ALLOW"
+	if changed := names(); changed[0] == first[0] {
+		t.Errorf("a changed policy kept its name %s", changed[0])
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/yaml"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+// NamespaceIsolation generates, for each of numNamespaces namespaces, the pair of
+// AuthorizationPolicies isolating it: an allow-nothing policy, which denies the requests no other
+// policy allows, and an ALLOW policy for the requests from the namespace itself and from the
+// ingress gateway.
+type NamespaceIsolation struct {
+	NumNamespaces int `json:"numNamespaces"`
+	// Prefix is the prefix of the namespaces <prefix>-1 to <prefix>-<numNamespaces>, "isolated"
+	// by default.
+	Prefix string `json:"prefix"`
+	// IngressNamespace is the namespace of the ingress gateway, "istio-system" by default.
+	IngressNamespace string `json:"ingressNamespace"`
+	// Namespaces also generates the namespaces, labeled for sidecar injection.
+	Namespaces bool `json:"namespaces"`
+}
+
+// names returns the isolated namespaces.
+func (n *NamespaceIsolation) names() []string {
+	prefix := n.Prefix
+	if prefix == "" {
+		prefix = "isolated"
+	}
+	names := make([]string, n.NumNamespaces)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s-%d", prefix, i+1)
+	}
+	return names
+}
+
+// ingressPrincipal returns the principal of the ingress gateway of the default Istio profiles.
+func (n *NamespaceIsolation) ingressPrincipal() string {
+	namespace := n.IngressNamespace
+	if namespace == "" {
+		namespace = "istio-system"
+	}
+	return fmt.Sprintf("cluster.local/ns/%s/sa/istio-ingressgateway-service-account", namespace)
+}
+
+// generateNamespaceIsolation returns the policy pairs of policyData.NamespaceIsolation, it stops
+// with an error when ctx is cancelled.
+func generateNamespaceIsolation(ctx context.Context, policyData SecurityPolicy) ([]Resource, error) {
+	isolation := policyData.NamespaceIsolation
+	var policies []Resource
+	for _, namespace := range isolation.names() {
+		if err := ctx.Err(); err != nil {
+			return policies, err
+		}
+		for _, policy := range []struct {
+			name string
+			spec *authzpb.AuthorizationPolicy
+		}{
+			{"allow-nothing", &authzpb.AuthorizationPolicy{}},
+			{"allow-same-namespace", &authzpb.AuthorizationPolicy{
+				Rules: []*authzpb.Rule{{
+					From: []*authzpb.Rule_From{
+						{Source: &authzpb.Source{Namespaces: []string{namespace}}},
+						{Source: &authzpb.Source{Principals: []string{isolation.ingressPrincipal()}}},
+					},
+				}},
+			}},
+		} {
+			header := createPolicyHeader(namespace, policy.name, "AuthorizationPolicy")
+			resource, err := newResource(policyData.RoundTripCheck, header, policy.spec)
+			if err != nil {
+				return nil, err
+			}
+			policies = append(policies, resource)
+		}
+	}
+	return policies, nil
+}
+
+// IsolatedNamespaces returns the YAML documents of the namespaces of policyData.NamespaceIsolation,
+// or nil when they are not generated.
+func IsolatedNamespaces(policyData SecurityPolicy) ([]string, error) {
+	isolation := policyData.NamespaceIsolation
+	if isolation == nil || !isolation.Namespaces {
+		return nil, nil
+	}
+	var docs []string
+	for _, name := range isolation.names() {
+		doc, err := namespaceYAML(name, map[string]string{"istio-injection": "enabled"})
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// kubeObject is a Kubernetes object without spec, such as a Namespace or a ServiceAccount.
+type kubeObject struct {
+	APIVersion string       `json:"apiVersion"`
+	Kind       string       `json:"kind"`
+	Metadata   kubeMetadata `json:"metadata"`
+}
+
+type kubeMetadata struct {
+	Labels    map[string]string `json:"labels,omitempty"`
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace,omitempty"`
+}
+
+// namespaceYAML returns the YAML document of the namespace name with labels.
+func namespaceYAML(name string, labels map[string]string) (string, error) {
+	doc, err := yaml.Marshal(kubeObject{APIVersion: "v1", Kind: "Namespace", Metadata: kubeMetadata{Labels: labels, Name: name}})
+	return string(doc), err
+}
@@ -0,0 +1,58 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"strings"
+	"testing"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+func TestNamespaceIsolation(t *testing.T) {
+	policyData := SecurityPolicy{
+		RoundTripCheck:     true,
+		NamespaceIsolation: &NamespaceIsolation{NumNamespaces: 3, Prefix: "team", IngressNamespace: "ingress", Namespaces: true},
+	}
+	resources, err := Generate(policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 6 {
+		t.Fatalf("got %d policies, want 6", len(resources))
+	}
+	for i, r := range resources {
+		namespace := []string{"team-1", "team-2", "team-3"}[i/2]
+		spec := r.Spec.(*authzpb.AuthorizationPolicy)
+		if r.Metadata.Namespace != namespace {
+			t.Errorf("policy %d: got namespace %s, want %s", i, r.Metadata.Namespace, namespace)
+		}
+		if i%2 == 0 {
+			if r.Metadata.Name != "allow-nothing" || len(spec.Rules) != 0 {
+				t.Errorf("policy %d: got %s with %d rules, want allow-nothing without rules", i, r.Metadata.Name, len(spec.Rules))
+			}
+			continue
+		}
+		from := spec.Rules[0].From
+		if got := from[0].Source.Namespaces[0] + " " + from[1].Source.Principals[0]; got != namespace+" cluster.local/ns/ingress/sa/istio-ingressgateway-service-account" {
+			t.Errorf("policy %d: got sources %s", i, got)
+		}
+	}
+
+	namespaces, err := IsolatedNamespaces(policyData)
+	if err != nil || len(namespaces) != 3 || !strings.Contains(namespaces[2], "name: team-3") {
+		t.Errorf("got namespaces %q, %v", namespaces, err)
+	}
+}
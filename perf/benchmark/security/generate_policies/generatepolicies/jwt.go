@@ -0,0 +1,170 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type Jwks struct {
+	Keys []*Jwk `json:"keys"`
+}
+
+type Jwk struct {
+	Kty string `json:"kty"`
+	E   string `json:"e"`
+	N   string `json:"n"`
+}
+
+const (
+	// tokenGroupsClaim is the claim matched by the conditions generated from authZ.numClaims.
+	tokenGroupsClaim = "groups"
+	// tokenGroup is the group carried by the generated token.
+	tokenGroup = "member"
+)
+
+var (
+	signingKeysMutex sync.Mutex
+	signingKeys      = map[string]*rsa.PrivateKey{}
+)
+
+// SigningKey returns the key used for every RequestAuthentication of a run, so that the
+// generated token is accepted by all of them. If keyFile is set the key is loaded from it, or
+// generated and saved to it if the file does not exist yet, so that separate runs and the JWKS
+// server share the same key.
+func SigningKey(keyFile string) (*rsa.PrivateKey, error) {
+	signingKeysMutex.Lock()
+	defer signingKeysMutex.Unlock()
+	if key, ok := signingKeys[keyFile]; ok {
+		return key, nil
+	}
+	var key *rsa.PrivateKey
+	var err error
+	if keyFile == "" {
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	} else {
+		key, err = LoadOrCreateKey(keyFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signingKeys[keyFile] = key
+	return key, nil
+}
+
+// LoadOrCreateKey returns the key saved in keyFile, generating and saving it if the file does not exist.
+func LoadOrCreateKey(keyFile string) (*rsa.PrivateKey, error) {
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	if err == nil {
+		block, _ := pem.Decode(keyPEM)
+		if block == nil || block.Type != "RSA PRIVATE KEY" {
+			return nil, fmt.Errorf("%s does not contain a PEM encoded RSA private key", keyFile)
+		}
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return nil, err
+	}
+	return privateKey, nil
+}
+
+// TokenClaims returns the claims of the token accepted by the generated policies.
+func TokenClaims(policyData SecurityPolicy) jwt.MapClaims {
+	issuer := fmt.Sprintf("issuer-%d", policyData.RequestAuthN.NumJwks)
+	if policyData.RequestAuthN.TokenIssuer != "" {
+		issuer = policyData.RequestAuthN.TokenIssuer
+	}
+	claims := jwt.MapClaims{
+		"iss": issuer,
+		"sub": "subject",
+	}
+	if policyData.AuthZ.NumClaims > 0 {
+		claims[tokenGroupsClaim] = []string{tokenGroup}
+	}
+	if n := policyData.AuthZ.ClaimNesting; n != nil {
+		for name, value := range n.claims() {
+			claims[name] = value
+		}
+	}
+	if expiry := policyData.RequestAuthN.TokenExpirySeconds; expiry > 0 {
+		now := policyData.Now()
+		claims["iat"] = now.Unix()
+		claims["exp"] = now.Add(time.Duration(expiry) * time.Second).Unix()
+	}
+	return claims
+}
+
+// GenerateToken returns the token accepted by the RequestAuthentications of policyData.
+func GenerateToken(policyData SecurityPolicy, privateKey *rsa.PrivateKey) (string, error) {
+	if policyData.RequestAuthN.InvalidToken {
+		newPrivateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return "", err
+		}
+		privateKey = newPrivateKey
+	}
+	return SignToken(TokenClaims(policyData), privateKey)
+}
+
+// SignToken returns claims signed with privateKey.
+func SignToken(claims jwt.MapClaims, privateKey *rsa.PrivateKey) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tokenString, err := token.SignedString(privateKey)
+	if err != nil {
+		return "", err
+	}
+	return tokenString, nil
+}
+
+// GenerateJwks returns the JWKS holding the public key of privateKey.
+func GenerateJwks(privateKey *rsa.PrivateKey) (string, error) {
+	jwks := &Jwks{
+		Keys: []*Jwk{
+			{
+				E:   base64.URLEncoding.EncodeToString(big.NewInt(int64(privateKey.PublicKey.E)).Bytes()),
+				N:   base64.URLEncoding.EncodeToString((*privateKey.PublicKey.N).Bytes()),
+				Kty: "RSA",
+			},
+		},
+	}
+
+	jwksBytes, err := json.Marshal(jwks)
+	if err != nil {
+		return "", err
+	}
+	return string(jwksBytes), nil
+}
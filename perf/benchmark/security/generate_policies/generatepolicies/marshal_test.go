@@ -0,0 +1,131 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/runtime/protoiface"
+
+	authzpb "istio.io/api/security/v1beta1"
+	typepb "istio.io/api/type/v1beta1"
+)
+
+func TestPolicyToYAML(t *testing.T) {
+	header := createPolicyHeader("", "marshal", "AuthorizationPolicy")
+	when := func(values ...string) protoiface.MessageV1 {
+		return &authzpb.AuthorizationPolicy{Rules: []*authzpb.Rule{{
+			When: []*authzpb.Condition{{Key: "request.headers[x-token]", Values: values}},
+		}}}
+	}
+	resources, err := Generate(SecurityPolicy{
+		AuthZ:        AuthorizationPolicy{NumPolicies: 1, NumPaths: 3, NumSourceIP: 3, NumRemoteIP: 2, NumValues: 2, NumPrincipals: 2},
+		PeerAuthN:    PeerAuthentication{NumPolicies: 1, MtlsMode: "STRICT"},
+		RequestAuthN: RequestAuthentication{NumPolicies: 1, NumJwks: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		spec   protoiface.MessageV1
+		direct bool
+	}{
+		{name: "empty", spec: &authzpb.AuthorizationPolicy{}, direct: true},
+		{name: "empty rule", spec: &authzpb.AuthorizationPolicy{Rules: []*authzpb.Rule{{}}}, direct: true},
+		{name: "selector", spec: &authzpb.AuthorizationPolicy{Selector: &typepb.WorkloadSelector{
+			MatchLabels: map[string]string{"app10": "a", "app9": "b", "version": "v1"},
+		}}, direct: true},
+		{name: "quoted key", spec: &authzpb.AuthorizationPolicy{Selector: &typepb.WorkloadSelector{
+			MatchLabels: map[string]string{"yes": "no"},
+		}}},
+		{name: "custom", spec: &authzpb.AuthorizationPolicy{
+			Action:       authzpb.AuthorizationPolicy_CUSTOM,
+			ActionDetail: &authzpb.AuthorizationPolicy_Provider{Provider: &authzpb.AuthorizationPolicy_ExtensionProvider{Name: "ext-authz"}},
+		}, direct: true},
+		{name: "quoted values", spec: when("", "true", "Off", "null", "~", "1", "1.5", "-1", ".inf", "0x1f", "1_0",
+			"2001-12-14", "12:30", "10.0.0.1", "10.0.0.0/24", "::1", "-x", "a:b", "a#b", "*", "é", `"q"`, "{}"), direct: true},
+		{name: "spaced value", spec: when("a b")},
+		{name: "multi-line value", spec: when("a\nb")},
+	}
+	for _, r := range resources {
+		cases = append(cases, struct {
+			name   string
+			spec   protoiface.MessageV1
+			direct bool
+		}{name: r.Kind, spec: r.Spec, direct: true})
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			want, err := policyToYAMLSlow(header, c.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := PolicyToYAML(header, c.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+			if _, ok := writePolicyYAML(header, c.spec); ok != c.direct {
+				t.Errorf("got direct %v, want %v", ok, c.direct)
+			}
+
+			want, err = toYAMLSlow(c.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := ToYAML(c.spec); err != nil || got != want {
+				t.Errorf("ToYAML got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+// benchmarkPolicy returns a large AuthorizationPolicy exercising every built-in generator.
+func benchmarkPolicy(b *testing.B) (*MyPolicy, protoiface.MessageV1) {
+	spec, err := BuildAuthorizationPolicy(SecurityPolicy{AuthZ: AuthorizationPolicy{
+		Action: "ALLOW", NumPaths: 50, NumMethods: 4, NumSourceIP: 100, NumRemoteIP: 50, NumNamespaces: 20,
+		NumPrincipals: 100, NumRequestPrincipals: 10, NumValues: 20, NumClaims: 10,
+		Selector: map[string]string{"app": "fortioserver", "version": "v1"},
+	}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return createPolicyHeader("", "benchmark", "AuthorizationPolicy"), spec
+}
+
+func BenchmarkPolicyToYAML(b *testing.B) {
+	header, spec := benchmarkPolicy(b)
+	for _, bench := range []struct {
+		name    string
+		marshal func(*MyPolicy, protoiface.MessageV1) (string, error)
+	}{
+		{"slow", policyToYAMLSlow},
+		{"direct", PolicyToYAML},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := bench.marshal(header, spec); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/yaml"
+)
+
+// The types of the extension providers of the MeshConfig.
+const (
+	ExtAuthzHTTPProvider  = "envoyExtAuthzHttp"
+	ExtAuthzGRPCProvider  = "envoyExtAuthzGrpc"
+	OpenTelemetryProvider = "opentelemetry"
+)
+
+// defaultExtAuthzPort is the port of the ext_authz service of a CUSTOM provider missing from
+// extensionProviders, the one of the mock server of the ext-authz subcommand.
+const defaultExtAuthzPort = 8000
+
+// ExtensionProvider is an entry of meshConfig.extensionProviders, referenced by name by the
+// CUSTOM AuthorizationPolicies and the Telemetry resources.
+type ExtensionProvider struct {
+	Name string `json:"name"`
+	// Type is envoyExtAuthzHttp, envoyExtAuthzGrpc or opentelemetry.
+	Type string `json:"type"`
+	// Service is the fully qualified host of the provider, e.g.
+	// ext-authz.twopods-istio.svc.cluster.local.
+	Service string `json:"service"`
+	Port    int    `json:"port"`
+	// IncludeHeadersInCheck are the request headers sent to an envoyExtAuthzHttp provider.
+	IncludeHeadersInCheck []string `json:"includeHeadersInCheck"`
+}
+
+// extensionProviders returns the extensionProviders of policyData, with a default
+// envoyExtAuthzHttp provider at <provider>.<namespace>.svc.cluster.local:8000 for a CUSTOM
+// provider missing from them.
+func (policyData SecurityPolicy) extensionProviders() ([]ExtensionProvider, error) {
+	providers := policyData.ExtensionProviders
+	names := map[string]bool{}
+	for _, p := range providers {
+		switch p.Type {
+		case ExtAuthzHTTPProvider, ExtAuthzGRPCProvider, OpenTelemetryProvider:
+		default:
+			return nil, newPolicyError(ErrInvalidConfig, "", nil, -1, fmt.Errorf("extension provider %q: invalid type %q", p.Name, p.Type))
+		}
+		if p.Name == "" || p.Service == "" || p.Port <= 0 {
+			return nil, newPolicyError(ErrInvalidConfig, "", nil, -1,
+				fmt.Errorf("extension provider %q: name, service and port are required", p.Name))
+		}
+		if names[p.Name] {
+			return nil, newPolicyError(ErrInvalidConfig, "", nil, -1, fmt.Errorf("duplicate extension provider %q", p.Name))
+		}
+		names[p.Name] = true
+	}
+	if provider := policyData.AuthZ.Provider; policyData.AuthZ.Action == "CUSTOM" && provider != "" && !names[provider] {
+		namespace := policyData.Namespace
+		if namespace == "" {
+			namespace = DefaultNamespace
+		}
+		providers = append(providers, ExtensionProvider{
+			Name:    provider,
+			Type:    ExtAuthzHTTPProvider,
+			Service: fmt.Sprintf("%s.%s.svc.cluster.local", provider, namespace),
+			Port:    defaultExtAuthzPort,
+		})
+	}
+	return providers, nil
+}
+
+// MeshConfig returns the IstioOperator overlay configuring istiod for the generated resources,
+// to be installed with istioctl install -f, or "" when they need no configuration:
+//   - the meshConfig.extensionProviders of the CUSTOM policies and the extensionProviders,
+//   - the envoyFileAccessLog provider of accessLogs,
+//   - the environment of the JWKS resolver of istiod set by requestAuthN.remoteJwks and
+//     requestAuthN.jwksInsecureSkipVerify.
+func MeshConfig(policyData SecurityPolicy) (string, error) {
+	providers, err := policyData.extensionProviders()
+	if err != nil {
+		return "", err
+	}
+	spec := map[string]interface{}{}
+	if len(providers) > 0 || policyData.AccessLogs != nil {
+		var entries []interface{}
+		for _, p := range providers {
+			settings := map[string]interface{}{"service": p.Service, "port": p.Port}
+			if len(p.IncludeHeadersInCheck) > 0 {
+				settings["includeHeadersInCheck"] = p.IncludeHeadersInCheck
+			}
+			entries = append(entries, map[string]interface{}{"name": p.Name, p.Type: settings})
+		}
+		if policyData.AccessLogs != nil {
+			entries = append(entries, policyData.accessLogProvider())
+		}
+		spec["meshConfig"] = map[string]interface{}{"extensionProviders": entries}
+	}
+
+	env := map[string]string{}
+	if requestAuthN := policyData.RequestAuthN; requestAuthN.NumPolicies > 0 && requestAuthN.JwksURI != "" {
+		if requestAuthN.RemoteJwks {
+			env["PILOT_JWT_ENABLE_REMOTE_JWKS"] = "true"
+		}
+		if requestAuthN.JwksInsecureSkipVerify {
+			env["JWKS_RESOLVER_INSECURE_SKIP_VERIFY"] = "true"
+		}
+	}
+	if len(env) > 0 {
+		spec["values"] = map[string]interface{}{"pilot": map[string]interface{}{"env": env}}
+	}
+	if len(spec) == 0 {
+		return "", nil
+	}
+
+	doc, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": "install.istio.io/v1alpha1",
+		"kind":       "IstioOperator",
+		"spec":       spec,
+	})
+	if err != nil {
+		return "", newPolicyError(ErrMarshal, "IstioOperator", nil, -1, err)
+	}
+	return string(doc), nil
+}
@@ -0,0 +1,55 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMeshConfig(t *testing.T) {
+	policyData := SecurityPolicy{
+		Namespace: "ns",
+		AuthZ:     AuthorizationPolicy{Action: "CUSTOM", Provider: "opa", NumPolicies: 1},
+		ExtensionProviders: []ExtensionProvider{
+			{Name: "otel", Type: OpenTelemetryProvider, Service: "otel-collector.observability.svc.cluster.local", Port: 4317},
+		},
+		RequestAuthN: RequestAuthentication{NumPolicies: 1, JwksURI: "https://jwks.ns.svc.cluster.local/jwks", RemoteJwks: true},
+	}
+	doc, err := MeshConfig(policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"kind: IstioOperator",
+		"opentelemetry:\n        port: 4317",
+		// The CUSTOM provider missing from the extension providers gets a default ext_authz service.
+		"envoyExtAuthzHttp:\n        port: 8000\n        service: opa.ns.svc.cluster.local\n      name: opa",
+		`PILOT_JWT_ENABLE_REMOTE_JWKS: "true"`,
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("the overlay does not contain %q:\n%s", want, doc)
+		}
+	}
+
+	policyData.ExtensionProviders[0].Type = "zipkin"
+	if _, err := MeshConfig(policyData); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("got error %v with an invalid provider type, want class %v", err, ErrInvalidConfig)
+	}
+	if doc, err := MeshConfig(SecurityPolicy{AuthZ: AuthorizationPolicy{NumPolicies: 1}}); err != nil || doc != "" {
+		t.Errorf("got overlay %q, %v without providers", doc, err)
+	}
+}
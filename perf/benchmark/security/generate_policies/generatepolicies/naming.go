@@ -0,0 +1,47 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// nameHashLength is the number of hexadecimal digits of the hash suffix of a policy name.
+const nameHashLength = 10
+
+// withHashedName returns r named <name>-<hash>, where hash is a short hash of its kind, spec and
+// targetRefs. Generating the same policy again gives it the same name, and a changed policy a
+// new one.
+func withHashedName(r Resource) (Resource, error) {
+	spec, err := ToJSON(r.Spec)
+	if err != nil {
+		return Resource{}, newPolicyError(ErrMarshal, r.Kind, &r.MyPolicy, -1, err)
+	}
+	refs, err := json.Marshal(r.TargetRefs)
+	if err != nil {
+		return Resource{}, newPolicyError(ErrMarshal, r.Kind, &r.MyPolicy, -1, err)
+	}
+	h := sha256.New()
+	for _, part := range []string{r.Kind, spec, string(refs)} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	r.Metadata.Name += "-" + hex.EncodeToString(h.Sum(nil))[:nameHashLength]
+	// The YAML of the resource holds the previous name.
+	r.yaml = ""
+	return r, nil
+}
@@ -0,0 +1,299 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+)
+
+// Generator generates the policies configured by its options, so that library users do not have
+// to fill in a SecurityPolicy the way the config file of the command does.
+type Generator struct {
+	policyData SecurityPolicy
+}
+
+// Option configures a Generator.
+type Option func(*Generator) error
+
+// Counts are the numbers of values of the generated rules, the zero counts are not generated.
+type Counts struct {
+	Namespaces        int
+	Paths             int
+	Methods           int
+	Principals        int
+	SourceIPs         int
+	RemoteIPs         int
+	Ports             int
+	Hosts             int
+	Selectors         int
+	Values            int
+	SNIs              int
+	RequestPrincipals int
+	Claims            int
+	Jwks              int
+}
+
+// ValueSource returns the i-th value of a field of the generated rules: "paths", "sourceIPs",
+// "remoteIPs", "ports", "hosts", "snis", "namespaces" or "principals". Returning "" keeps the default value.
+type ValueSource func(field string, i int) string
+
+// NewGenerator returns a Generator configured by opts.
+func NewGenerator(opts ...Option) (*Generator, error) {
+	g := &Generator{}
+	for _, opt := range opts {
+		if err := opt(g); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// Generate returns the configured policies.
+func (g *Generator) Generate() ([]Resource, error) {
+	return Generate(g.policyData)
+}
+
+// GenerateContext returns the configured policies, stopping with an error when ctx is cancelled.
+func (g *Generator) GenerateContext(ctx context.Context) ([]Resource, error) {
+	return GenerateContext(ctx, g.policyData)
+}
+
+// SecurityPolicy returns the config the policies are generated from.
+func (g *Generator) SecurityPolicy() SecurityPolicy {
+	return g.policyData
+}
+
+// WithSecurityPolicy starts from policyData, e.g. a config file of the command, which the
+// following options modify.
+func WithSecurityPolicy(policyData SecurityPolicy) Option {
+	return func(g *Generator) error {
+		g.policyData = policyData
+		return nil
+	}
+}
+
+// WithNamespace sets the namespace of the policies, DefaultNamespace by default.
+func WithNamespace(namespace string) Option {
+	return func(g *Generator) error {
+		g.policyData.Namespace = namespace
+		return nil
+	}
+}
+
+// WithKind generates numPolicies policies of kind, one of AuthorizationPolicy,
+// PeerAuthentication and RequestAuthentication.
+func WithKind(kind string, numPolicies int) Option {
+	return func(g *Generator) error {
+		if numPolicies < 0 {
+			return fmt.Errorf("invalid number of %s policies: %d", kind, numPolicies)
+		}
+		switch kind {
+		case "AuthorizationPolicy":
+			g.policyData.AuthZ.NumPolicies = numPolicies
+		case "PeerAuthentication":
+			g.policyData.PeerAuthN.NumPolicies = numPolicies
+		case "RequestAuthentication":
+			g.policyData.RequestAuthN.NumPolicies = numPolicies
+		default:
+			return fmt.Errorf("unknown policy kind: %s", kind)
+		}
+		return nil
+	}
+}
+
+// WithAction sets the action of the AuthorizationPolicies, DENY by default.
+func WithAction(action string) Option {
+	return func(g *Generator) error {
+		switch action {
+		case "ALLOW", "DENY", "CUSTOM":
+		default:
+			return fmt.Errorf("action %s not supported", action)
+		}
+		g.policyData.AuthZ.Action = action
+		return nil
+	}
+}
+
+// WithAmbient restricts the AuthorizationPolicies to the fields ztunnel enforces, see
+// SecurityPolicy.Ambient.
+func WithAmbient() Option {
+	return func(g *Generator) error {
+		g.policyData.Ambient = true
+		return nil
+	}
+}
+
+// WithUnicode adds non-ASCII characters to the generated paths, hosts, SNIs and claim values,
+// see AuthorizationPolicy.Unicode.
+func WithUnicode() Option {
+	return func(g *Generator) error {
+		g.policyData.AuthZ.Unicode = true
+		return nil
+	}
+}
+
+// WithNameByHash appends a short hash of its spec to the name of every policy, see
+// SecurityPolicy.NameByHash.
+func WithNameByHash() Option {
+	return func(g *Generator) error {
+		g.policyData.NameByHash = true
+		return nil
+	}
+}
+
+// WithWaypoint binds the AuthorizationPolicies to the waypoints of waypoint instead of the
+// workloads of a selector.
+func WithWaypoint(waypoint Waypoint) Option {
+	return func(g *Generator) error {
+		g.policyData.AuthZ.Waypoint = &waypoint
+		return nil
+	}
+}
+
+// WithCounts sets the numbers of values of the generated rules.
+func WithCounts(counts Counts) Option {
+	return func(g *Generator) error {
+		authZ := &g.policyData.AuthZ
+		authZ.NumNamespaces = counts.Namespaces
+		authZ.NumPaths = counts.Paths
+		authZ.NumMethods = counts.Methods
+		authZ.NumPrincipals = counts.Principals
+		authZ.NumSourceIP = counts.SourceIPs
+		authZ.NumRemoteIP = counts.RemoteIPs
+		authZ.NumPorts = counts.Ports
+		authZ.NumHosts = counts.Hosts
+		authZ.NumSelectors = counts.Selectors
+		authZ.NumSNIs = counts.SNIs
+		authZ.NumValues = counts.Values
+		authZ.NumRequestPrincipals = counts.RequestPrincipals
+		authZ.NumClaims = counts.Claims
+		g.policyData.RequestAuthN.NumJwks = counts.Jwks
+		return nil
+	}
+}
+
+// WithSeed draws the values of the generated rules from a random source seeded with seed
+// instead of the default sequences of invalid values, see WithRandom.
+func WithSeed(seed int64) Option {
+	return WithRandom(rand.NewSource(seed))
+}
+
+// WithRandom injects the random source of the generators: the values of the generated rules are
+// drawn from RandomValues of the source, and rule generators draw from SecurityPolicy.Rand.
+func WithRandom(src rand.Source) Option {
+	return func(g *Generator) error {
+		g.policyData.rand = rand.New(src)
+		g.policyData.values = RandomValues(g.policyData.rand)
+		return nil
+	}
+}
+
+// WithClock injects the clock of the generators, used for the iat and exp claims of the tokens.
+func WithClock(clock Clock) Option {
+	return func(g *Generator) error {
+		g.policyData.clock = clock
+		return nil
+	}
+}
+
+// WithValueSource draws the values of the generated rules from values.
+func WithValueSource(values ValueSource) Option {
+	return func(g *Generator) error {
+		g.policyData.values = values
+		return nil
+	}
+}
+
+// Value returns the i-th value of field in the generated rules, from the value source of
+// WithValueSource if it has one, with non-ASCII characters added with AuthorizationPolicy.Unicode.
+func (p SecurityPolicy) Value(field string, i int) string {
+	value := p.value(field, i)
+	if p.AuthZ.Unicode {
+		value = unicodeValue(field, i, value)
+	}
+	return value
+}
+
+func (p SecurityPolicy) value(field string, i int) string {
+	if p.values != nil {
+		if value := p.values(field, i); value != "" {
+			return value
+		}
+	}
+	switch field {
+	case "paths":
+		return fmt.Sprintf("/invalid-path-%d", i)
+	case "sourceIPs":
+		return fmt.Sprintf("%d.%d.%d.%d", i>>24&255, i>>16&255, i>>8&255, i&255)
+	case "remoteIPs":
+		return fmt.Sprintf("10.%d.%d.0/24", i/256%256, i%256)
+	case "ports":
+		// Ports above the ones of the benchmark workloads.
+		return strconv.Itoa(10000 + i%55536)
+	case "hosts":
+		return fmt.Sprintf("invalid-host-%d.example.com", i)
+	case "snis":
+		return fmt.Sprintf("invalid-sni-%d.example.com", i)
+	case "namespaces":
+		return NamespaceName(i)
+	case "principals":
+		return PrincipalName(i)
+	default:
+		return fmt.Sprintf("invalid-%s-%d", field, i)
+	}
+}
+
+// RandomValues returns a ValueSource of values drawn from r. The i-th value of a field is drawn
+// once and then reused, so that every policy of a run uses the same values and a run generates
+// the same corpus from the same source.
+func RandomValues(r *rand.Rand) ValueSource {
+	var mu sync.Mutex
+	drawn := map[string]map[int]string{}
+	return func(field string, i int) string {
+		mu.Lock()
+		defer mu.Unlock()
+		if value, ok := drawn[field][i]; ok {
+			return value
+		}
+		var value string
+		switch field {
+		case "paths":
+			value = fmt.Sprintf("/%08x", r.Uint32())
+		case "sourceIPs":
+			value = fmt.Sprintf("10.%d.%d.%d", r.Intn(256), r.Intn(256), r.Intn(256))
+		case "remoteIPs":
+			value = fmt.Sprintf("172.%d.%d.0/24", 16+r.Intn(16), r.Intn(256))
+		case "ports":
+			value = strconv.Itoa(10000 + r.Intn(55536))
+		case "hosts", "snis":
+			value = fmt.Sprintf("h%08x.example.com", r.Uint32())
+		case "namespaces":
+			value = fmt.Sprintf("ns-%08x", r.Uint32())
+		case "principals":
+			value = fmt.Sprintf("cluster.local/ns/%s/sa/sa-%08x", PrincipalNamespace, r.Uint32())
+		default:
+			return ""
+		}
+		if drawn[field] == nil {
+			drawn[field] = map[int]string{}
+		}
+		drawn[field][i] = value
+		return value
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"strings"
+	"testing"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+func TestNewGenerator(t *testing.T) {
+	g, err := NewGenerator(
+		WithNamespace("options"),
+		WithKind("AuthorizationPolicy", 2),
+		WithAction("ALLOW"),
+		WithCounts(Counts{Paths: 2, SourceIPs: 1}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources, err := g.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 2 {
+		t.Fatalf("got %d policies, want 2", len(resources))
+	}
+	for _, r := range resources {
+		spec := r.Spec.(*authzpb.AuthorizationPolicy)
+		if r.Metadata.Namespace != "options" || spec.Action != authzpb.AuthorizationPolicy_ALLOW || len(spec.Rules) != 2 {
+			t.Errorf("unexpected policy %s/%s: %v", r.Metadata.Namespace, r.Metadata.Name, spec)
+		}
+	}
+
+	for _, opt := range []Option{WithKind("Gateway", 1), WithKind("PeerAuthentication", -1), WithAction("AUDIT")} {
+		if _, err := NewGenerator(opt); err == nil {
+			t.Error("expected an error for an invalid option")
+		}
+	}
+}
+
+func TestValueSources(t *testing.T) {
+	paths := func(opts ...Option) string {
+		g, err := NewGenerator(append(opts, WithKind("AuthorizationPolicy", 1), WithCounts(Counts{Paths: 3}))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resources, err := g.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(resources[0].Spec.(*authzpb.AuthorizationPolicy).Rules[0].To[0].Operation.Paths, ",")
+	}
+
+	if got, want := paths(), "/invalid-path-0,/invalid-path-1,/invalid-path-2"; got != want {
+		t.Errorf("got default paths %s, want %s", got, want)
+	}
+	if paths(WithSeed(1)) != paths(WithSeed(1)) {
+		t.Error("the same seed generated different paths")
+	}
+	if paths(WithSeed(1)) == paths(WithSeed(2)) {
+		t.Error("different seeds generated the same paths")
+	}
+	custom := WithValueSource(func(field string, i int) string {
+		if i == 1 {
+			return "/custom"
+		}
+		return ""
+	})
+	if got, want := paths(custom), "/invalid-path-0,/custom,/invalid-path-2"; got != want {
+		t.Errorf("got paths %s, want %s", got, want)
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	g, err := NewGenerator(WithKind("AuthorizationPolicy", 1), WithAction("ALLOW"), WithUnicode(),
+		WithCounts(Counts{Paths: 8, Hosts: 2, Claims: 3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources, err := g.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := resources[0].Spec.(*authzpb.AuthorizationPolicy)
+	var values []string
+	for _, rule := range spec.Rules {
+		for _, to := range rule.To {
+			values = append(values, to.Operation.Paths...)
+			values = append(values, to.Operation.Hosts...)
+		}
+		for _, condition := range rule.When {
+			values = append(values, condition.Values...)
+		}
+	}
+	seen := map[string]bool{}
+	decorated, nonASCII, percentEncoded := 0, 0, 0
+	for _, v := range values {
+		if seen[v] {
+			t.Errorf("duplicated value %q", v)
+		}
+		seen[v] = true
+		hasNonASCII := strings.IndexFunc(v, func(r rune) bool { return r > 127 }) >= 0
+		hasPercent := strings.Contains(v, "%")
+		if hasNonASCII {
+			nonASCII++
+		}
+		if hasPercent {
+			percentEncoded++
+		}
+		if hasNonASCII || hasPercent {
+			decorated++
+		}
+	}
+	// The second host is punycode and the last claim value, matching the generated token, stays
+	// ASCII.
+	if want := 8 + 1 + 2; decorated != want || nonASCII == 0 || percentEncoded == 0 {
+		t.Errorf("got %d values with non-ASCII characters or percent-encodings, want %d: %q", decorated, want, values)
+	}
+	if !seen[tokenGroup] {
+		t.Errorf("the matching claim value %q is missing from %q", tokenGroup, values)
+	}
+	if _, err := resources[0].YAML(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	gogoproto "github.com/gogo/protobuf/proto"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"sigs.k8s.io/yaml"
+)
+
+// newResource returns the policy with its YAML, checked by checkRoundTrip when roundTrip is set.
+func newResource(roundTrip bool, header *MyPolicy, spec protoiface.MessageV1) (Resource, error) {
+	doc, err := PolicyToYAML(header, spec)
+	if err != nil {
+		return Resource{}, newPolicyError(ErrMarshal, "", header, -1, err)
+	}
+	if roundTrip {
+		if err := checkRoundTrip(doc, header, spec); err != nil {
+			return Resource{}, newPolicyError(ErrRoundTrip, "", header, -1, err)
+		}
+	}
+	return Resource{MyPolicy: *header, Spec: spec, yaml: doc}, nil
+}
+
+// checkRoundTrip parses doc back into its header and spec and compares them with the ones it was
+// marshaled from, guarding the marshaling of PolicyToYAML.
+func checkRoundTrip(doc string, header *MyPolicy, spec protoiface.MessageV1) error {
+	js, err := yaml.YAMLToJSON([]byte(doc))
+	if err != nil {
+		return err
+	}
+	var resource struct {
+		MyPolicy
+		Spec json.RawMessage `json:"spec"`
+	}
+	if err := json.Unmarshal(js, &resource); err != nil {
+		return err
+	}
+	if resource.MyPolicy != *header {
+		return fmt.Errorf("changed the header: got %+v, want %+v", resource.MyPolicy, *header)
+	}
+
+	parsed := reflect.New(reflect.TypeOf(spec).Elem()).Interface().(protoiface.MessageV1)
+	unmarshaler, ok := parsed.(json.Unmarshaler)
+	if !ok {
+		return fmt.Errorf("%T cannot be parsed", spec)
+	}
+	if len(resource.Spec) > 0 {
+		if err := unmarshaler.UnmarshalJSON(resource.Spec); err != nil {
+			return err
+		}
+	}
+	if !gogoproto.Equal(parsed, spec) {
+		got, _ := ToJSON(parsed)
+		want, _ := ToJSON(spec)
+		return fmt.Errorf("changed the spec: got %s, want %s", got, want)
+	}
+	return nil
+}
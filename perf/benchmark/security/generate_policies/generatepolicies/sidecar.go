@@ -0,0 +1,76 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"sort"
+
+	networkingpb "istio.io/api/networking/v1alpha3"
+)
+
+// sidecarScopeName is the name of the generated Sidecar resources, so that they do not replace a
+// default Sidecar of the namespaces.
+const sidecarScopeName = "generate-policies-scope"
+
+// SidecarScope generates a Sidecar resource in every namespace of the AuthorizationPolicies
+// narrowing the egress of its proxies, the standard mitigation of the config size of large meshes.
+type SidecarScope struct {
+	// EgressHosts are the hosts of the egress listener, "./*" and "istio-system/*" by default:
+	// the proxies only receive the config of their own namespace and of the control plane.
+	EgressHosts []string `json:"egressHosts"`
+}
+
+// SidecarResources returns a Sidecar per namespace of resources other than the root namespace,
+// whose Sidecar would apply to the whole mesh, restricting the egress to the egressHosts of
+// policyData.SidecarScope. It returns nil unless SidecarScope is set.
+func SidecarResources(policyData SecurityPolicy, resources []Resource) ([]Resource, error) {
+	scope := policyData.SidecarScope
+	if scope == nil {
+		return nil, nil
+	}
+	hosts := scope.EgressHosts
+	if len(hosts) == 0 {
+		hosts = []string{"./*", "istio-system/*"}
+	}
+	rootNamespace := "istio-system"
+	if policyData.Tiers != nil && policyData.Tiers.RootNamespace != "" {
+		rootNamespace = policyData.Tiers.RootNamespace
+	}
+	seen := map[string]bool{}
+	for _, r := range resources {
+		if ns := r.Metadata.Namespace; ns != "" && ns != rootNamespace {
+			seen[ns] = true
+		}
+	}
+	namespaces := make([]string, 0, len(seen))
+	for ns := range seen {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	var sidecars []Resource
+	for _, ns := range namespaces {
+		header := createPolicyHeader(ns, sidecarScopeName, "Sidecar")
+		header.APIVersion = "networking.istio.io/v1alpha3"
+		sidecar, err := newResource(policyData.RoundTripCheck, header, &networkingpb.Sidecar{
+			Egress: []*networkingpb.IstioEgressListener{{Hosts: hosts}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		sidecars = append(sidecars, sidecar)
+	}
+	return sidecars, nil
+}
@@ -0,0 +1,56 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSidecarResources(t *testing.T) {
+	policyData := SecurityPolicy{
+		RoundTripCheck: true,
+		SidecarScope:   &SidecarScope{EgressHosts: []string{"./*"}},
+	}
+	resources := []Resource{
+		{MyPolicy: *createPolicyHeader("ns-2", "a", "AuthorizationPolicy")},
+		{MyPolicy: *createPolicyHeader("ns-1", "b", "AuthorizationPolicy")},
+		{MyPolicy: *createPolicyHeader("ns-2", "c", "AuthorizationPolicy")},
+		{MyPolicy: *createPolicyHeader("istio-system", "mesh", "AuthorizationPolicy")},
+	}
+	sidecars, err := SidecarResources(policyData, resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var namespaces []string
+	for _, s := range sidecars {
+		namespaces = append(namespaces, s.Metadata.Namespace)
+	}
+	// The root namespace gets no Sidecar, which would apply to the whole mesh.
+	if got := strings.Join(namespaces, ","); got != "ns-1,ns-2" {
+		t.Fatalf("got Sidecars in %s, want ns-1 and ns-2", got)
+	}
+	doc, err := sidecars[0].YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(doc, "kind: Sidecar") || !strings.Contains(doc, "egress:\n  - hosts:\n    - ./*\n") {
+		t.Errorf("unexpected Sidecar:\n%s", doc)
+	}
+
+	if sidecars, err := SidecarResources(SecurityPolicy{}, resources); err != nil || sidecars != nil {
+		t.Errorf("got Sidecars %v, %v without sidecarScope", sidecars, err)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Clock is the source of the current time of the generators.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// globalSource is a rand.Source drawing from the shared source of math/rand, safe for
+// concurrent use.
+type globalSource struct{}
+
+func (globalSource) Int63() int64 {
+	return rand.Int63()
+}
+
+func (globalSource) Seed(int64) {}
+
+// Now returns the current time of the clock of WithClock, or of the system clock.
+func (p SecurityPolicy) Now() time.Time {
+	if p.clock != nil {
+		return p.clock.Now()
+	}
+	return systemClock{}.Now()
+}
+
+// Rand returns the random source of WithRandom, or the shared source of math/rand. Rule
+// generators should draw their randomness from it, so that seeded corpora are reproducible.
+func (p SecurityPolicy) Rand() *rand.Rand {
+	if p.rand != nil {
+		return p.rand
+	}
+	return rand.New(globalSource{})
+}
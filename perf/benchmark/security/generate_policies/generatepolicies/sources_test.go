@@ -0,0 +1,73 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func TestInjectedRandom(t *testing.T) {
+	corpus := func(src rand.Source) string {
+		g, err := NewGenerator(WithKind("AuthorizationPolicy", 3), WithCounts(Counts{Paths: 4, SourceIPs: 4, Principals: 2}), WithRandom(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resources, err := g.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var docs string
+		for _, r := range resources {
+			doc, err := r.YAML()
+			if err != nil {
+				t.Fatal(err)
+			}
+			docs += doc
+		}
+		return docs
+	}
+	if corpus(rand.NewSource(7)) != corpus(rand.NewSource(7)) {
+		t.Error("the same random source generated different corpora")
+	}
+	if corpus(rand.NewSource(7)) == corpus(rand.NewSource(8)) {
+		t.Error("different random sources generated the same corpus")
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	g, err := NewGenerator(WithKind("RequestAuthentication", 1), WithClock(fixedClock(now)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policyData := g.SecurityPolicy()
+	if _, ok := TokenClaims(policyData)["exp"]; ok {
+		t.Error("got an exp claim without tokenExpirySeconds")
+	}
+
+	policyData.RequestAuthN.TokenExpirySeconds = 60
+	claims := TokenClaims(policyData)
+	if claims["iat"] != now.Unix() || claims["exp"] != now.Add(time.Minute).Unix() {
+		t.Errorf("got iat %v and exp %v, want %d and %d", claims["iat"], claims["exp"], now.Unix(), now.Add(time.Minute).Unix())
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"fmt"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+// defaultMaxPolicyBytes is the default size cap of a generated policy. etcd rejects objects
+// larger than ~1.5MiB, the cap leaves room for the fields added by the API server.
+const defaultMaxPolicyBytes = 1 << 20
+
+// sourceValueFields and operationValueFields are the fields of a rule whose values are ORed, a
+// rule can be split into two rules by splitting the values of one of them.
+var sourceValueFields = []func(*authzpb.Source) *[]string{
+	func(s *authzpb.Source) *[]string { return &s.Principals },
+	func(s *authzpb.Source) *[]string { return &s.RequestPrincipals },
+	func(s *authzpb.Source) *[]string { return &s.Namespaces },
+	func(s *authzpb.Source) *[]string { return &s.IpBlocks },
+	func(s *authzpb.Source) *[]string { return &s.RemoteIpBlocks },
+}
+
+var operationValueFields = []func(*authzpb.Operation) *[]string{
+	func(o *authzpb.Operation) *[]string { return &o.Hosts },
+	func(o *authzpb.Operation) *[]string { return &o.Ports },
+	func(o *authzpb.Operation) *[]string { return &o.Methods },
+	func(o *authzpb.Operation) *[]string { return &o.Paths },
+}
+
+// ruleSplits counts the AuthorizationPolicies split over the cap of rules per policy. They are
+// summarized once, a corpus over the cap would otherwise warn for every policy.
+type ruleSplits struct {
+	maxRules int
+	policies int
+	parts    int
+	// largest is the policy with the most rules split, with its number of rules and parts.
+	largest      string
+	largestRules int
+	largestParts int
+}
+
+func newRuleSplits(maxRules int) *ruleSplits {
+	return &ruleSplits{maxRules: maxRules}
+}
+
+// over reports whether spec has more rules than the cap.
+func (s *ruleSplits) over(spec *authzpb.AuthorizationPolicy) bool {
+	return s.maxRules > 0 && len(spec.Rules) > s.maxRules
+}
+
+// chunks returns the rules of spec in policies of at most the cap of rules.
+func (s *ruleSplits) chunks(spec *authzpb.AuthorizationPolicy) []*authzpb.AuthorizationPolicy {
+	var chunks []*authzpb.AuthorizationPolicy
+	for start := 0; start < len(spec.Rules); start += s.maxRules {
+		end := start + s.maxRules
+		if end > len(spec.Rules) {
+			end = len(spec.Rules)
+		}
+		chunk := spec.DeepCopy()
+		chunk.Rules = chunk.Rules[start:end]
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+func (s *ruleSplits) record(name string, rules, parts int) {
+	s.policies++
+	s.parts += parts
+	if rules > s.largestRules {
+		s.largest, s.largestRules, s.largestParts = name, rules, parts
+	}
+}
+
+// report prints the summary of the policies split.
+func (s *ruleSplits) report() {
+	if s.policies == 0 {
+		return
+	}
+	fmt.Fprintf(Warnings, "warning: %d policies over the limit of %d rules were split into %d policies, "+
+		"the largest, %s with %d rules, into %d\n", s.policies, s.maxRules, s.parts, s.largest, s.largestRules, s.largestParts)
+}
+
+// splitAuthorizationPolicy returns spec, split into several policies named
+// <name>-part-<n> when it is larger than maxBytes or has more rules than the cap of splits.
+// Rules and ORed values are distributed over the policies, which match the same requests as spec
+// together. Every document is round-trip checked when roundTrip is set.
+func splitAuthorizationPolicy(header *MyPolicy, spec *authzpb.AuthorizationPolicy, maxBytes int, splits *ruleSplits, roundTrip bool) ([]Resource, error) {
+	resource, err := newResource(roundTrip, header, spec)
+	if err != nil {
+		return nil, err
+	}
+	overRules := splits.over(spec)
+	if len(resource.yaml) <= maxBytes && !overRules {
+		return []Resource{resource}, nil
+	}
+
+	var parts []*authzpb.AuthorizationPolicy
+	var split func(spec *authzpb.AuthorizationPolicy, size int) error
+	split = func(spec *authzpb.AuthorizationPolicy, size int) error {
+		if size <= maxBytes {
+			parts = append(parts, spec)
+			return nil
+		}
+		left, right, ok := halveAuthorizationPolicy(spec)
+		if !ok {
+			return newPolicyError(ErrTooLarge, "", header, -1,
+				fmt.Errorf("%d bytes, over the limit of %d bytes, and cannot be split further", size, maxBytes))
+		}
+		for _, half := range []*authzpb.AuthorizationPolicy{left, right} {
+			doc, err := PolicyToYAML(header, half)
+			if err != nil {
+				return newPolicyError(ErrMarshal, "", header, -1, err)
+			}
+			if err := split(half, len(doc)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if !overRules {
+		if err := split(spec, len(resource.yaml)); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, chunk := range splits.chunks(spec) {
+			doc, err := PolicyToYAML(header, chunk)
+			if err != nil {
+				return nil, newPolicyError(ErrMarshal, "", header, -1, err)
+			}
+			if err := split(chunk, len(doc)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	resources := make([]Resource, 0, len(parts))
+	for i, part := range parts {
+		partHeader := *header
+		partHeader.Metadata.Name = fmt.Sprintf("%s-part-%d", header.Metadata.Name, i+1)
+		resource, err := newResource(roundTrip, &partHeader, part)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, resource)
+	}
+	if len(resource.yaml) > maxBytes {
+		fmt.Fprintf(Warnings, "warning: %s is over the limit of %d bytes, split into %d policies\n",
+			header.Metadata.Name, maxBytes, len(resources))
+	}
+	if overRules {
+		splits.record(header.Metadata.Name, len(spec.Rules), len(resources))
+	}
+	return resources, nil
+}
+
+// halveAuthorizationPolicy splits spec into two policies, by its rules or else by the largest
+// list of its only rule.
+func halveAuthorizationPolicy(spec *authzpb.AuthorizationPolicy) (*authzpb.AuthorizationPolicy, *authzpb.AuthorizationPolicy, bool) {
+	left, right := spec.DeepCopy(), spec.DeepCopy()
+	if n := len(spec.Rules); n > 1 {
+		left.Rules, right.Rules = left.Rules[:n/2], right.Rules[n/2:]
+		return left, right, true
+	}
+	if len(spec.Rules) == 0 || !halveRule(left.Rules[0], right.Rules[0]) {
+		return nil, nil, false
+	}
+	return left, right, true
+}
+
+// halveRule splits the from or to list of two copies of a rule, or else the largest list of values,
+// so that together they match the same requests as the rule. The from and to lists are ORed as
+// well as the values of the sources, operations and conditions. Splitting a list duplicates the
+// rest of the rule, the lists of entries are split first as their entries are not duplicated. The
+// when list is ANDed and the not-values cannot be split.
+func halveRule(left, right *authzpb.Rule) bool {
+	if n := len(left.From); n > 1 && n >= len(left.To) {
+		left.From, right.From = left.From[:n/2], right.From[n/2:]
+		return true
+	}
+	if n := len(left.To); n > 1 {
+		left.To, right.To = left.To[:n/2], right.To[n/2:]
+		return true
+	}
+
+	var leftValues, rightValues *[]string
+	consider := func(l, r *[]string) {
+		if len(*l) > 1 && (leftValues == nil || len(*l) > len(*leftValues)) {
+			leftValues, rightValues = l, r
+		}
+	}
+	for i := range left.From {
+		for _, field := range sourceValueFields {
+			consider(field(left.From[i].GetSource()), field(right.From[i].GetSource()))
+		}
+	}
+	for i := range left.To {
+		for _, field := range operationValueFields {
+			consider(field(left.To[i].GetOperation()), field(right.To[i].GetOperation()))
+		}
+	}
+	for i := range left.When {
+		consider(&left.When[i].Values, &right.When[i].Values)
+	}
+	if leftValues == nil {
+		return false
+	}
+	n := len(*leftValues)
+	*leftValues, *rightValues = (*leftValues)[:n/2], (*rightValues)[n/2:]
+	return true
+}
@@ -0,0 +1,73 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+func TestMaxRulesPerPolicy(t *testing.T) {
+	var warnings bytes.Buffer
+	defer func(w io.Writer) { Warnings = w }(Warnings)
+	Warnings = &warnings
+
+	policyData := SecurityPolicy{AuthZ: AuthorizationPolicy{NumPolicies: 2, NumPaths: 1, NumPrincipals: 1, NumValues: 1}}
+	whole, err := Generate(policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := whole[0].Spec.(*authzpb.AuthorizationPolicy).Rules
+	if len(rules) != 3 {
+		t.Fatalf("got %d rules, want 3", len(rules))
+	}
+
+	policyData.MaxRulesPerPolicy = 2
+	split, err := Generate(policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	var parts []*authzpb.Rule
+	for _, r := range split {
+		names = append(names, r.Metadata.Name)
+		spec := r.Spec.(*authzpb.AuthorizationPolicy)
+		if len(spec.Rules) > 2 {
+			t.Errorf("%s has %d rules, over the limit of 2", r.Metadata.Name, len(spec.Rules))
+		}
+		if strings.HasPrefix(r.Metadata.Name, "test-authorizationpolicy-1-") {
+			parts = append(parts, spec.Rules...)
+		}
+	}
+	want := []string{
+		"test-authorizationpolicy-1-part-1", "test-authorizationpolicy-1-part-2",
+		"test-authorizationpolicy-2-part-1", "test-authorizationpolicy-2-part-2",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got policies %v, want %v", names, want)
+	}
+	if fmt.Sprint(parts) != fmt.Sprint(rules) {
+		t.Errorf("the parts have the rules %v, want %v", parts, rules)
+	}
+	if want := "warning: 2 policies over the limit of 2 rules were split into 4 policies, the largest, test-authorizationpolicy-1 with 3 rules, into 2\n"; !strings.Contains(warnings.String(), want) {
+		t.Errorf("got warnings %q, want %q", warnings.String(), want)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// defaultAccessLogProvider is the name of the envoyFileAccessLog provider of AccessLogs.
+	defaultAccessLogProvider = "authz-access-log"
+	// accessLogTelemetryName is the name of the generated Telemetry resource.
+	accessLogTelemetryName = "authz-access-logs"
+)
+
+// AccessLogs enables the access logs of the workloads selected by authZ.selector, or of the
+// namespace of the policies without selector, with the decisions of the RBAC filters, so that
+// the enforcement of the policies can be verified from the logs.
+type AccessLogs struct {
+	// Provider is the name of the envoyFileAccessLog extension provider of the logs, declared
+	// by MeshConfig. Defaults to authz-access-log.
+	Provider string `json:"provider"`
+	// Path is the file the proxies write the logs to. Defaults to /dev/stdout.
+	Path string `json:"path"`
+}
+
+func (a AccessLogs) provider() string {
+	if a.Provider == "" {
+		return defaultAccessLogProvider
+	}
+	return a.Provider
+}
+
+// accessLogLabels is the JSON format of the access logs. Envoy records the denying policy of the
+// HTTP RBAC filter in the response code details, rbac_access_denied_matched_policy[<policy>], and
+// the one of the network RBAC filter in the connection termination details. The filters set their
+// dynamic metadata for the shadow rules of dry-run policies.
+var accessLogLabels = map[string]string{
+	"start_time":                     "%START_TIME%",
+	"method":                         "%REQ(:METHOD)%",
+	"path":                           "%REQ(X-ENVOY-ORIGINAL-PATH?:PATH)%",
+	"authority":                      "%REQ(:AUTHORITY)%",
+	"response_code":                  "%RESPONSE_CODE%",
+	"response_flags":                 "%RESPONSE_FLAGS%",
+	"response_code_details":          "%RESPONSE_CODE_DETAILS%",
+	"connection_termination_details": "%CONNECTION_TERMINATION_DETAILS%",
+	"rbac":                           "%DYNAMIC_METADATA(envoy.filters.http.rbac)%",
+	"network_rbac":                   "%DYNAMIC_METADATA(envoy.filters.network.rbac)%",
+	"downstream_peer_principal":      "%DOWNSTREAM_PEER_URI_SAN%",
+	"request_id":                     "%REQ(X-REQUEST-ID)%",
+}
+
+// accessLogProvider returns the entry of meshConfig.extensionProviders of policyData.AccessLogs.
+func (policyData SecurityPolicy) accessLogProvider() map[string]interface{} {
+	a := policyData.AccessLogs
+	path := a.Path
+	if path == "" {
+		path = "/dev/stdout"
+	}
+	return map[string]interface{}{
+		"name": a.provider(),
+		"envoyFileAccessLog": map[string]interface{}{
+			"path":      path,
+			"logFormat": map[string]interface{}{"labels": accessLogLabels},
+		},
+	}
+}
+
+// AccessLogTelemetry returns the YAML document of the Telemetry resource enabling the access logs
+// of policyData.AccessLogs, in the namespace of the policies, or "" unless they are enabled. The
+// logs are written by the provider declared by MeshConfig.
+func AccessLogTelemetry(policyData SecurityPolicy) (string, error) {
+	if policyData.AccessLogs == nil {
+		return "", nil
+	}
+	namespace := policyData.Namespace
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	spec := map[string]interface{}{
+		"accessLogging": []interface{}{
+			map[string]interface{}{"providers": []interface{}{map[string]string{"name": policyData.AccessLogs.provider()}}},
+		},
+	}
+	if len(policyData.AuthZ.Selector) > 0 {
+		spec["selector"] = map[string]interface{}{"matchLabels": policyData.AuthZ.Selector}
+	}
+	doc, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": "telemetry.istio.io/v1alpha1",
+		"kind":       "Telemetry",
+		"metadata":   kubeMetadata{Name: accessLogTelemetryName, Namespace: namespace},
+		"spec":       spec,
+	})
+	if err != nil {
+		return "", newPolicyError(ErrMarshal, "Telemetry", nil, -1, err)
+	}
+	return string(doc), nil
+}
@@ -0,0 +1,61 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAccessLogTelemetry(t *testing.T) {
+	policyData := SecurityPolicy{
+		Namespace:  "ns",
+		AccessLogs: &AccessLogs{},
+		AuthZ:      AuthorizationPolicy{Action: "ALLOW", NumPolicies: 1, Selector: map[string]string{"app": "server"}},
+	}
+	doc, err := AccessLogTelemetry(policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"kind: Telemetry",
+		"namespace: ns",
+		"- name: authz-access-log",
+		"matchLabels:\n      app: server",
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("the Telemetry does not contain %q:\n%s", want, doc)
+		}
+	}
+
+	meshConfig, err := MeshConfig(policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"envoyFileAccessLog:",
+		"path: /dev/stdout",
+		"response_code_details: '%RESPONSE_CODE_DETAILS%'",
+		"name: authz-access-log",
+	} {
+		if !strings.Contains(meshConfig, want) {
+			t.Errorf("the overlay does not contain %q:\n%s", want, meshConfig)
+		}
+	}
+
+	if doc, err := AccessLogTelemetry(SecurityPolicy{}); err != nil || doc != "" {
+		t.Errorf("got Telemetry %q, %v without accessLogs", doc, err)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/yaml"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+// Tenants generates the policies isolating the tenants of a SaaS style mesh. Every tenant owns a
+// group of namespaces and its service accounts, and every namespace of a tenant gets a DENY policy
+// for the requests from the namespaces of the other tenants and an ALLOW policy for the identities
+// of the tenant.
+type Tenants struct {
+	NumTenants int `json:"numTenants"`
+	// NumNamespaces is the number of namespaces tenant-<t>-1 to tenant-<t>-<numNamespaces> of a
+	// tenant, 1 by default.
+	NumNamespaces int `json:"numNamespaces"`
+	// NumServiceAccounts is the number of service accounts sa-1 to sa-<numServiceAccounts> of a
+	// namespace, 1 by default.
+	NumServiceAccounts int `json:"numServiceAccounts"`
+	// IngressNamespace is the namespace of the ingress gateway, whose requests are not denied,
+	// "istio-system" by default.
+	IngressNamespace string `json:"ingressNamespace"`
+	// Objects also generates the namespaces, labeled with their tenant, and the service accounts.
+	Objects bool `json:"objects"`
+}
+
+func (t *Tenants) numNamespaces() int {
+	if t.NumNamespaces <= 0 {
+		return 1
+	}
+	return t.NumNamespaces
+}
+
+func (t *Tenants) numServiceAccounts() int {
+	if t.NumServiceAccounts <= 0 {
+		return 1
+	}
+	return t.NumServiceAccounts
+}
+
+// namespaces returns the namespaces of the tenant-th tenant, starting from 1.
+func (t *Tenants) namespaces(tenant int) []string {
+	namespaces := make([]string, t.numNamespaces())
+	for i := range namespaces {
+		namespaces[i] = fmt.Sprintf("tenant-%d-%d", tenant, i+1)
+	}
+	return namespaces
+}
+
+// principals returns the identities of the tenant-th tenant.
+func (t *Tenants) principals(tenant int) []string {
+	var principals []string
+	for _, namespace := range t.namespaces(tenant) {
+		for i := 1; i <= t.numServiceAccounts(); i++ {
+			principals = append(principals, fmt.Sprintf("cluster.local/ns/%s/sa/sa-%d", namespace, i))
+		}
+	}
+	return principals
+}
+
+// numPolicies returns the number of policies of the tenants.
+func (t *Tenants) numPolicies() int {
+	if t.NumTenants <= 0 {
+		return 0
+	}
+	return 2 * t.NumTenants * t.numNamespaces()
+}
+
+// generateTenants returns the policies of policyData.Tenants, it stops with an error when ctx is
+// cancelled.
+func generateTenants(ctx context.Context, policyData SecurityPolicy) ([]Resource, error) {
+	tenants := policyData.Tenants
+	ingressNamespace := tenants.IngressNamespace
+	if ingressNamespace == "" {
+		ingressNamespace = "istio-system"
+	}
+	var policies []Resource
+	for tenant := 1; tenant <= tenants.NumTenants; tenant++ {
+		namespaces := tenants.namespaces(tenant)
+		// Matching the other tenants by the namespaces they are not in keeps the policies of a
+		// tenant the same size whatever the number of tenants.
+		specs := []struct {
+			name string
+			spec *authzpb.AuthorizationPolicy
+		}{
+			{"deny-other-tenants", &authzpb.AuthorizationPolicy{
+				Action: authzpb.AuthorizationPolicy_DENY,
+				Rules: []*authzpb.Rule{{
+					From: []*authzpb.Rule_From{{Source: &authzpb.Source{
+						NotNamespaces: append(append([]string(nil), namespaces...), ingressNamespace),
+					}}},
+				}},
+			}},
+			{"allow-tenant", &authzpb.AuthorizationPolicy{
+				Rules: []*authzpb.Rule{{
+					From: []*authzpb.Rule_From{
+						{Source: &authzpb.Source{Principals: tenants.principals(tenant)}},
+						{Source: &authzpb.Source{Namespaces: []string{ingressNamespace}}},
+					},
+				}},
+			}},
+		}
+		for _, namespace := range namespaces {
+			if err := ctx.Err(); err != nil {
+				return policies, err
+			}
+			for _, policy := range specs {
+				header := createPolicyHeader(namespace, policy.name, "AuthorizationPolicy")
+				resource, err := newResource(policyData.RoundTripCheck, header, policy.spec)
+				if err != nil {
+					return nil, err
+				}
+				policies = append(policies, resource)
+			}
+		}
+	}
+	return policies, nil
+}
+
+// TenantObjects returns the YAML documents of the namespaces and the service accounts of
+// policyData.Tenants, or nil when they are not generated.
+func TenantObjects(policyData SecurityPolicy) ([]string, error) {
+	tenants := policyData.Tenants
+	if tenants == nil || !tenants.Objects {
+		return nil, nil
+	}
+	var docs []string
+	for tenant := 1; tenant <= tenants.NumTenants; tenant++ {
+		for _, namespace := range tenants.namespaces(tenant) {
+			doc, err := namespaceYAML(namespace, map[string]string{
+				"istio-injection": "enabled",
+				"tenant":          fmt.Sprintf("tenant-%d", tenant),
+			})
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, doc)
+			for i := 1; i <= tenants.numServiceAccounts(); i++ {
+				sa, err := yaml.Marshal(kubeObject{
+					APIVersion: "v1",
+					Kind:       "ServiceAccount",
+					Metadata:   kubeMetadata{Name: fmt.Sprintf("sa-%d", i), Namespace: namespace},
+				})
+				if err != nil {
+					return nil, err
+				}
+				docs = append(docs, string(sa))
+			}
+		}
+	}
+	return docs, nil
+}
@@ -0,0 +1,50 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"strings"
+	"testing"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+func TestTenants(t *testing.T) {
+	policyData := SecurityPolicy{RoundTripCheck: true, Tenants: &Tenants{NumTenants: 3, NumNamespaces: 2, NumServiceAccounts: 2, Objects: true}}
+	resources, err := Generate(policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 12 {
+		t.Fatalf("got %d policies, want 12", len(resources))
+	}
+	deny := resources[6].Spec.(*authzpb.AuthorizationPolicy)
+	if got := strings.Join(deny.Rules[0].From[0].Source.NotNamespaces, ","); resources[6].Metadata.Namespace != "tenant-2-2" ||
+		deny.Action != authzpb.AuthorizationPolicy_DENY || got != "tenant-2-1,tenant-2-2,istio-system" {
+		t.Errorf("got %s denying the namespaces but %s", resources[6].Metadata.Namespace, got)
+	}
+	allow := resources[7].Spec.(*authzpb.AuthorizationPolicy)
+	if got := allow.Rules[0].From[0].Source.Principals; len(got) != 4 || got[3] != "cluster.local/ns/tenant-2-2/sa/sa-2" {
+		t.Errorf("got principals %v", got)
+	}
+
+	objects, err := TenantObjects(policyData)
+	if err != nil || len(objects) != 18 {
+		t.Fatalf("got %d objects, %v, want 18", len(objects), err)
+	}
+	if !strings.Contains(objects[0], "tenant: tenant-1") || !strings.Contains(objects[1], "kind: ServiceAccount") {
+		t.Errorf("got objects %q", objects[:2])
+	}
+}
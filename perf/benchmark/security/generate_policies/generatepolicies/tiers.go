@@ -0,0 +1,146 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"context"
+	"fmt"
+)
+
+// Tiers generates AuthorizationPolicies layered like the ones of an enterprise mesh: mesh-wide
+// policies in the root namespace, namespace-wide policies without selector and per-workload
+// policies with a selector. Their rules are the ones described by authZ.
+type Tiers struct {
+	NumPolicies int `json:"numPolicies"`
+	// Mesh, Namespace and Workload share the policies in the proportions of their weights.
+	Mesh      Tier `json:"mesh"`
+	Namespace Tier `json:"namespace"`
+	Workload  Tier `json:"workload"`
+	// RootNamespace is the root namespace of the mesh, "istio-system" by default.
+	RootNamespace string `json:"rootNamespace"`
+	// NumNamespaces spreads the namespace and workload policies round robin over the namespaces
+	// tiered-1 to tiered-<numNamespaces>, instead of the namespace of the config.
+	NumNamespaces int `json:"numNamespaces"`
+	// NumWorkloads spreads the workload policies of a namespace over the workloads app:
+	// workload-1 to workload-<numWorkloads>.
+	NumWorkloads int `json:"numWorkloads"`
+}
+
+// Tier is a layer of Tiers.
+type Tier struct {
+	Weight int `json:"weight"`
+	// Action is the action of the policies of the tier, authZ.action by default.
+	Action string `json:"action"`
+}
+
+// counts returns the numbers of policies of the mesh, namespace and workload tiers, the largest
+// remainders of their shares getting the policies left.
+func (t *Tiers) counts() ([3]int, error) {
+	var counts [3]int
+	weights := [3]int{t.Mesh.Weight, t.Namespace.Weight, t.Workload.Weight}
+	total := 0
+	for _, w := range weights {
+		if w < 0 {
+			return counts, fmt.Errorf("invalid tier weight: %d", w)
+		}
+		total += w
+	}
+	if total == 0 {
+		return counts, fmt.Errorf("tiers require a positive weight")
+	}
+	left := t.NumPolicies
+	var remainders [3]int
+	for i, w := range weights {
+		counts[i] = t.NumPolicies * w / total
+		remainders[i] = t.NumPolicies * w % total
+		left -= counts[i]
+	}
+	for ; left > 0; left-- {
+		largest := 0
+		for i := range remainders {
+			if remainders[i] > remainders[largest] {
+				largest = i
+			}
+		}
+		counts[largest]++
+		remainders[largest] = -1
+	}
+	return counts, nil
+}
+
+// generateTiers returns the policies of policyData.Tiers, it stops with an error when ctx is
+// cancelled.
+func generateTiers(ctx context.Context, policyData SecurityPolicy) ([]Resource, error) {
+	tiers := policyData.Tiers
+	counts, err := tiers.counts()
+	if err != nil {
+		return nil, newPolicyError(ErrInvalidConfig, "AuthorizationPolicy", nil, -1, err)
+	}
+	rootNamespace := tiers.RootNamespace
+	if rootNamespace == "" {
+		rootNamespace = "istio-system"
+	}
+	namespace := func(i int) string {
+		if tiers.NumNamespaces <= 0 {
+			return policyData.Namespace
+		}
+		return fmt.Sprintf("tiered-%d", i%tiers.NumNamespaces+1)
+	}
+	workload := func(i int) map[string]string {
+		numNamespaces, numWorkloads := tiers.NumNamespaces, tiers.NumWorkloads
+		if numNamespaces <= 0 {
+			numNamespaces = 1
+		}
+		if numWorkloads <= 0 {
+			numWorkloads = 1
+		}
+		return workloadSelector(nil, i/numNamespaces%numWorkloads+1)
+	}
+
+	var policies []Resource
+	dedup := newRuleDeduplicator(policyData.DedupRules)
+	splits := newRuleSplits(policyData.MaxRulesPerPolicy)
+	for t, tier := range []struct {
+		name      string
+		tier      Tier
+		namespace func(i int) string
+		selector  func(i int) map[string]string
+	}{
+		{"mesh", tiers.Mesh, func(int) string { return rootNamespace }, func(int) map[string]string { return nil }},
+		{"namespace", tiers.Namespace, namespace, func(int) map[string]string { return nil }},
+		{"workload", tiers.Workload, namespace, workload},
+	} {
+		tierData := policyData
+		tierData.AuthZ.Waypoint = nil
+		if tier.tier.Action != "" {
+			tierData.AuthZ.Action = tier.tier.Action
+		}
+		for i := 0; i < counts[t]; i++ {
+			if err := ctx.Err(); err != nil {
+				return policies, err
+			}
+			tierData.AuthZ.Selector = tier.selector(i)
+			header := createPolicyHeader(tier.namespace(i), fmt.Sprintf("%s-%d", tier.name, i+1), "AuthorizationPolicy")
+			generated, err := generateAuthorizationPolicy(tierData, header, nil, dedup, splits)
+			if err != nil {
+				return nil, withPolicy(err, header)
+			}
+			policies = append(policies, generated...)
+		}
+	}
+	dedup.report()
+	splits.report()
+	return policies, nil
+}
@@ -0,0 +1,81 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"errors"
+	"testing"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+func TestTiers(t *testing.T) {
+	for _, c := range []struct {
+		numPolicies int
+		weights     [3]int
+		want        [3]int
+	}{
+		{10, [3]int{1, 3, 6}, [3]int{1, 3, 6}},
+		{10, [3]int{1, 1, 1}, [3]int{4, 3, 3}},
+		{7, [3]int{0, 1, 2}, [3]int{0, 2, 5}},
+	} {
+		tiers := Tiers{NumPolicies: c.numPolicies, Mesh: Tier{Weight: c.weights[0]},
+			Namespace: Tier{Weight: c.weights[1]}, Workload: Tier{Weight: c.weights[2]}}
+		if got, err := tiers.counts(); err != nil || got != c.want {
+			t.Errorf("%d policies weighted %v: got %v, %v, want %v", c.numPolicies, c.weights, got, err, c.want)
+		}
+	}
+
+	resources, err := Generate(SecurityPolicy{
+		AuthZ: AuthorizationPolicy{Action: "ALLOW", NumPaths: 1},
+		Tiers: &Tiers{
+			NumPolicies:   6,
+			Mesh:          Tier{Weight: 1, Action: "DENY"},
+			Namespace:     Tier{Weight: 1},
+			Workload:      Tier{Weight: 4},
+			NumNamespaces: 2,
+			NumWorkloads:  2,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name, namespace, app string
+		action               authzpb.AuthorizationPolicy_Action
+	}{
+		{"mesh-1", "istio-system", "", authzpb.AuthorizationPolicy_DENY},
+		{"namespace-1", "tiered-1", "", authzpb.AuthorizationPolicy_ALLOW},
+		{"workload-1", "tiered-1", "workload-1", authzpb.AuthorizationPolicy_ALLOW},
+		{"workload-2", "tiered-2", "workload-1", authzpb.AuthorizationPolicy_ALLOW},
+		{"workload-3", "tiered-1", "workload-2", authzpb.AuthorizationPolicy_ALLOW},
+		{"workload-4", "tiered-2", "workload-2", authzpb.AuthorizationPolicy_ALLOW},
+	}
+	if len(resources) != len(want) {
+		t.Fatalf("got %d policies, want %d", len(resources), len(want))
+	}
+	for i, r := range resources {
+		spec := r.Spec.(*authzpb.AuthorizationPolicy)
+		app := spec.GetSelector().GetMatchLabels()["app"]
+		if r.Metadata.Name != want[i].name || r.Metadata.Namespace != want[i].namespace || app != want[i].app || spec.Action != want[i].action {
+			t.Errorf("policy %d: got %s/%s app %q %v, want %+v", i, r.Metadata.Namespace, r.Metadata.Name, app, spec.Action, want[i])
+		}
+	}
+
+	_, err = Generate(SecurityPolicy{Tiers: &Tiers{NumPolicies: 1}})
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("got error %v without weights, want class %v", err, ErrInvalidConfig)
+	}
+}
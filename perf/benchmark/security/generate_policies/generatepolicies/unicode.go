@@ -0,0 +1,70 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+// unicodePathSegments are the path segments appended to the generated paths with
+// AuthorizationPolicy.Unicode, raw and percent-encoded multi-byte UTF-8 of several scripts.
+var unicodePathSegments = []string{
+	"café",
+	// e followed by a combining acute accent, canonically equivalent to the é above.
+	"cafe\u0301",
+	"caf%C3%A9",
+	"привет",
+	"日本語",
+	"%E6%97%A5%E6%9C%AC%E8%AA%9E",
+	"🔒-%F0%9F%94%92",
+	// Latin with a Cyrillic а, a mixed script confusable of "paypal".
+	"p\u0430ypal",
+}
+
+// unicodeHostLabels are the labels prepended to the generated hosts and SNIs with
+// AuthorizationPolicy.Unicode, internationalized labels and their punycode.
+var unicodeHostLabels = []string{
+	"bücher",
+	"xn--bcher-kva",
+	"пример",
+	"例え",
+	"ελληνικά",
+	"p\u0430ypal",
+}
+
+// unicodeClaimSuffixes are appended to the generated claim values with
+// AuthorizationPolicy.Unicode.
+var unicodeClaimSuffixes = []string{
+	"grüppe",
+	"группа",
+	"グループ",
+	// Arabic, written right to left.
+	"مجموعة",
+	// The fi ligature, compatibility equivalent to "file".
+	"\ufb01le",
+	"%C3%BC",
+}
+
+// unicodeValue returns the value of the i-th field value with multi-byte UTF-8, percent-encoded
+// sequences or mixed scripts added, keeping it unique. Fields without non-ASCII forms are
+// returned unchanged.
+func unicodeValue(field string, i int, value string) string {
+	switch field {
+	case "paths":
+		return value + "/" + unicodePathSegments[i%len(unicodePathSegments)]
+	case "hosts", "snis":
+		return unicodeHostLabels[i%len(unicodeHostLabels)] + "." + value
+	case "claims":
+		return value + "-" + unicodeClaimSuffixes[i%len(unicodeClaimSuffixes)]
+	default:
+		return value
+	}
+}
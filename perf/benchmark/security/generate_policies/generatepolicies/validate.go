@@ -0,0 +1,208 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+// conditionKeys are the supported keys of AuthorizationPolicy conditions, keys ending with "["
+// take a name, e.g. request.headers[x-token].
+var conditionKeys = []string{
+	"request.headers[",
+	"request.auth.claims[",
+	"source.ip",
+	"remote.ip",
+	"source.namespace",
+	"source.principal",
+	"request.auth.principal",
+	"request.auth.audiences",
+	"request.auth.presenter",
+	"destination.ip",
+	"destination.port",
+	"connection.sni",
+	"experimental.envoy.filters.",
+}
+
+// validateAuthorizationPolicy checks spec against the constraints the Istio admission webhook
+// enforces, so that invalid specs are rejected before an apply run instead of halfway through it.
+// It returns a *PolicyError of class ErrInvalidPolicy.
+func validateAuthorizationPolicy(spec *authzpb.AuthorizationPolicy) error {
+	invalid := func(rule int, err error) error {
+		return newPolicyError(ErrInvalidPolicy, "AuthorizationPolicy", nil, rule, err)
+	}
+	if spec.Action == authzpb.AuthorizationPolicy_CUSTOM && spec.GetProvider().GetName() == "" {
+		return invalid(-1, fmt.Errorf("action CUSTOM requires a provider"))
+	}
+	if spec.Action != authzpb.AuthorizationPolicy_CUSTOM && spec.GetProvider() != nil {
+		return invalid(-1, fmt.Errorf("provider is only allowed with action CUSTOM"))
+	}
+	if _, ok := spec.GetSelector().GetMatchLabels()[""]; ok {
+		return invalid(-1, fmt.Errorf("selector has an empty label key"))
+	}
+	for i, rule := range spec.Rules {
+		if err := validateRule(rule); err != nil {
+			return invalid(i, err)
+		}
+	}
+	return nil
+}
+
+// ValidateAuthorizationPolicy checks spec against the constraints the Istio admission webhook
+// enforces, like the generated policies are. It returns a *PolicyError of class ErrInvalidPolicy.
+func ValidateAuthorizationPolicy(spec *authzpb.AuthorizationPolicy) error {
+	return validateAuthorizationPolicy(spec)
+}
+
+func validateRule(rule *authzpb.Rule) error {
+	if rule == nil {
+		return fmt.Errorf("rule must not be nil")
+	}
+	for i, from := range rule.From {
+		if err := validateSource(from.GetSource()); err != nil {
+			return fmt.Errorf("from[%d]: %v", i, err)
+		}
+	}
+	for i, to := range rule.To {
+		if err := validateOperation(to.GetOperation()); err != nil {
+			return fmt.Errorf("to[%d]: %v", i, err)
+		}
+	}
+	for i, condition := range rule.When {
+		if err := validateCondition(condition); err != nil {
+			return fmt.Errorf("when[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func validateSource(source *authzpb.Source) error {
+	if source == nil {
+		return fmt.Errorf("source must not be nil")
+	}
+	if len(source.Principals) == 0 && len(source.RequestPrincipals) == 0 && len(source.Namespaces) == 0 &&
+		len(source.IpBlocks) == 0 && len(source.RemoteIpBlocks) == 0 && len(source.NotPrincipals) == 0 &&
+		len(source.NotRequestPrincipals) == 0 && len(source.NotNamespaces) == 0 && len(source.NotIpBlocks) == 0 &&
+		len(source.NotRemoteIpBlocks) == 0 {
+		return fmt.Errorf("source must not be empty")
+	}
+	for _, values := range [][]string{source.Principals, source.RequestPrincipals, source.Namespaces,
+		source.NotPrincipals, source.NotRequestPrincipals, source.NotNamespaces} {
+		if err := validateValues(values); err != nil {
+			return err
+		}
+	}
+	for _, blocks := range [][]string{source.IpBlocks, source.RemoteIpBlocks, source.NotIpBlocks, source.NotRemoteIpBlocks} {
+		if err := validateIPBlocks(blocks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateOperation(operation *authzpb.Operation) error {
+	if operation == nil {
+		return fmt.Errorf("operation must not be nil")
+	}
+	if len(operation.Hosts) == 0 && len(operation.Ports) == 0 && len(operation.Methods) == 0 && len(operation.Paths) == 0 &&
+		len(operation.NotHosts) == 0 && len(operation.NotPorts) == 0 && len(operation.NotMethods) == 0 && len(operation.NotPaths) == 0 {
+		return fmt.Errorf("operation must not be empty")
+	}
+	for _, values := range [][]string{operation.Hosts, operation.NotHosts, operation.Paths, operation.NotPaths} {
+		if err := validateValues(values); err != nil {
+			return err
+		}
+	}
+	for _, methods := range [][]string{operation.Methods, operation.NotMethods} {
+		for _, method := range methods {
+			if !isHTTPMethod(method) {
+				return fmt.Errorf("invalid method %q", method)
+			}
+		}
+	}
+	return nil
+}
+
+func validateCondition(condition *authzpb.Condition) error {
+	if condition == nil {
+		return fmt.Errorf("condition must not be nil")
+	}
+	if !isConditionKey(condition.Key) {
+		return fmt.Errorf("unknown condition key %q", condition.Key)
+	}
+	if len(condition.Values) == 0 && len(condition.NotValues) == 0 {
+		return fmt.Errorf("condition %s must have values or notValues", condition.Key)
+	}
+	if condition.Key == "source.ip" || condition.Key == "remote.ip" || condition.Key == "destination.ip" {
+		if err := validateIPBlocks(condition.Values); err != nil {
+			return err
+		}
+		return validateIPBlocks(condition.NotValues)
+	}
+	return nil
+}
+
+func validateValues(values []string) error {
+	for _, value := range values {
+		if value == "" {
+			return fmt.Errorf("values must not be empty strings")
+		}
+	}
+	return nil
+}
+
+func validateIPBlocks(blocks []string) error {
+	for _, block := range blocks {
+		if strings.Contains(block, "/") {
+			if _, _, err := net.ParseCIDR(block); err != nil {
+				return fmt.Errorf("invalid CIDR %q", block)
+			}
+		} else if net.ParseIP(block) == nil {
+			return fmt.Errorf("invalid IP address %q", block)
+		}
+	}
+	return nil
+}
+
+func isHTTPMethod(method string) bool {
+	for _, m := range httpMethods {
+		if method == m {
+			return true
+		}
+	}
+	return false
+}
+
+func isConditionKey(key string) bool {
+	for _, k := range conditionKeys {
+		switch {
+		case strings.HasSuffix(k, "["):
+			if strings.HasPrefix(key, k) && strings.HasSuffix(key, "]") && len(key) > len(k)+1 {
+				return true
+			}
+		case strings.HasSuffix(k, "."):
+			if strings.HasPrefix(key, k) && len(key) > len(k) {
+				return true
+			}
+		case key == k:
+			return true
+		}
+	}
+	return false
+}
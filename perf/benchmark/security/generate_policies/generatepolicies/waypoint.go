@@ -0,0 +1,156 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Waypoint binds the AuthorizationPolicies to the waypoint proxies of an ambient mesh, which
+// enforce their L7 fields, through targetRefs to the Gateways of the waypoints instead of a
+// selector.
+type Waypoint struct {
+	// Name is the name of the waypoint Gateway, "waypoint" by default.
+	Name string `json:"name"`
+	// NumWaypoints spreads the policies round robin over the waypoints <name>-1 to
+	// <name>-<numWaypoints> when larger than 1.
+	NumWaypoints int `json:"numWaypoints"`
+	// Gateways also generates the Gateways of the waypoints.
+	Gateways bool `json:"gateways"`
+}
+
+// PolicyTargetReference is a resource a policy applies to. The AuthorizationPolicy spec of the
+// istio.io/api version this package is built with predates targetRefs, so they are carried by
+// Resource and marshaled after the spec.
+type PolicyTargetReference struct {
+	Group string `json:"group"`
+	Kind  string `json:"kind"`
+	Name  string `json:"name"`
+}
+
+// names returns the names of the waypoint Gateways.
+func (w *Waypoint) names() []string {
+	name := w.Name
+	if name == "" {
+		name = "waypoint"
+	}
+	if w.NumWaypoints <= 1 {
+		return []string{name}
+	}
+	names := make([]string, w.NumWaypoints)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s-%d", name, i+1)
+	}
+	return names
+}
+
+// targetRefs returns the targetRefs of the i-th policy, starting from 1, or nil without waypoint.
+func (w *Waypoint) targetRefs(i int) []PolicyTargetReference {
+	if w == nil {
+		return nil
+	}
+	names := w.names()
+	return []PolicyTargetReference{{Group: "gateway.networking.k8s.io", Kind: "Gateway", Name: names[(i-1)%len(names)]}}
+}
+
+// appendTargetRefs returns doc, the YAML of a policy, with targetRefs added to its spec. spec is
+// the last key of doc and targetRefs sorts after every key of an AuthorizationPolicy spec.
+func appendTargetRefs(doc string, targetRefs []PolicyTargetReference) (string, error) {
+	if len(targetRefs) == 0 {
+		return doc, nil
+	}
+	refs, err := yaml.Marshal(targetRefs)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if strings.HasSuffix(doc, "spec: {}\n") {
+		doc = strings.TrimSuffix(doc, " {}\n") + "\n"
+	}
+	b.WriteString(doc)
+	b.WriteString("  targetRefs:\n")
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(string(refs), "\n"), "\n") {
+		b.WriteString("  " + line)
+	}
+	b.WriteString("\n")
+	return b.String(), nil
+}
+
+// WaypointGateways returns the YAML documents of the Gateways of the waypoints the
+// AuthorizationPolicies of policyData are bound to, in the namespace of the policies. It returns
+// nil when the policies are not bound to waypoints or their Gateways are not generated.
+func WaypointGateways(policyData SecurityPolicy) ([]string, error) {
+	w := policyData.AuthZ.Waypoint
+	if w == nil || !w.Gateways || policyData.AuthZ.NumPolicies <= 0 {
+		return nil, nil
+	}
+	namespace := policyData.Namespace
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	var docs []string
+	for _, name := range w.names() {
+		doc, err := yaml.Marshal(waypointGateway(namespace, name))
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, string(doc))
+	}
+	return docs, nil
+}
+
+type gateway struct {
+	APIVersion string          `json:"apiVersion"`
+	Kind       string          `json:"kind"`
+	Metadata   gatewayMetadata `json:"metadata"`
+	Spec       gatewaySpec     `json:"spec"`
+}
+
+type gatewayMetadata struct {
+	Labels    map[string]string `json:"labels"`
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+}
+
+type gatewaySpec struct {
+	GatewayClassName string            `json:"gatewayClassName"`
+	Listeners        []gatewayListener `json:"listeners"`
+}
+
+type gatewayListener struct {
+	Name     string `json:"name"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+// waypointGateway returns the Gateway of the waypoint name, as istioctl waypoint generate does.
+func waypointGateway(namespace, name string) gateway {
+	return gateway{
+		APIVersion: "gateway.networking.k8s.io/v1",
+		Kind:       "Gateway",
+		Metadata: gatewayMetadata{
+			Labels:    map[string]string{"istio.io/waypoint-for": "service"},
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: gatewaySpec{
+			GatewayClassName: "istio-waypoint",
+			Listeners:        []gatewayListener{{Name: "mesh", Port: 15008, Protocol: "HBONE"}},
+		},
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestWaypoint(t *testing.T) {
+	g, err := NewGenerator(WithKind("AuthorizationPolicy", 3), WithAction("ALLOW"), WithAmbient(),
+		WithWaypoint(Waypoint{NumWaypoints: 2, Gateways: true}), WithCounts(Counts{Paths: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources, err := g.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"waypoint-1", "waypoint-2", "waypoint-1"}
+	if len(resources) != len(want) {
+		t.Fatalf("got %d policies, want %d", len(resources), len(want))
+	}
+	for i, r := range resources {
+		doc, err := r.YAML()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var parsed struct {
+			MyPolicy
+			Spec struct {
+				Rules      []interface{}           `json:"rules"`
+				TargetRefs []PolicyTargetReference `json:"targetRefs"`
+			} `json:"spec"`
+		}
+		if err := yaml.UnmarshalStrict([]byte(doc), &parsed); err != nil {
+			t.Fatalf("%s: %v", doc, err)
+		}
+		wantRefs := []PolicyTargetReference{{Group: "gateway.networking.k8s.io", Kind: "Gateway", Name: want[i]}}
+		if !reflect.DeepEqual(parsed.Spec.TargetRefs, wantRefs) || !reflect.DeepEqual(r.TargetRefs, wantRefs) {
+			t.Errorf("policy %d: got targetRefs %+v in %s, want %+v", i, parsed.Spec.TargetRefs, doc, wantRefs)
+		}
+		if len(parsed.Spec.Rules) != 1 {
+			t.Errorf("policy %d: got %d rules, want 1", i, len(parsed.Spec.Rules))
+		}
+
+		r.yaml = ""
+		if marshaled, err := r.YAML(); err != nil || marshaled != doc {
+			t.Errorf("policy %d: got %q, %v marshaling the resource, want %q", i, marshaled, err, doc)
+		}
+	}
+
+	empty, err := appendTargetRefs("spec: {}\n", []PolicyTargetReference{{Kind: "Gateway", Name: "w"}})
+	if err != nil || empty != "spec:\n  targetRefs:\n  - group: \"\"\n    kind: Gateway\n    name: w\n" {
+		t.Errorf("got %q, %v for an empty spec", empty, err)
+	}
+
+	gateways, err := WaypointGateways(g.policyData)
+	if err != nil || len(gateways) != 2 {
+		t.Fatalf("got %d gateways, %v, want 2", len(gateways), err)
+	}
+
+	_, err = Generate(SecurityPolicy{AuthZ: AuthorizationPolicy{
+		NumPolicies: 1, NumPaths: 1, Selector: map[string]string{"app": "a"}, Waypoint: &Waypoint{},
+	}})
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("got error %v for a selector and a waypoint, want class %v", err, ErrInvalidConfig)
+	}
+}
@@ -0,0 +1,387 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generatepolicies
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/runtime/protoimpl"
+	"sigs.k8s.io/yaml"
+)
+
+// The direct writer marshals the policies straight to YAML, walking the protoreflect view of the
+// spec instead of going through protojson, encoding/json and a generic YAML round trip. It writes
+// exactly what the slow pipeline writes: the keys sorted the way yaml.v2 sorts them, the block
+// style of yaml.v2 and the same quoting of the scalars. Whatever it cannot write byte for byte
+// (64-bit integers, floats, bytes, the well-known types, multi-line or spaced strings) makes it
+// give up on the document, which is then marshaled by the slow pipeline.
+
+var (
+	bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+	// sortedFields caches the fields of each message type in the order of their JSON names.
+	sortedFields sync.Map
+)
+
+type yamlWriter struct {
+	buf *bytes.Buffer
+}
+
+// writePolicyYAML returns the YAML document of the policy, or false if the direct writer cannot
+// marshal it.
+func writePolicyYAML(policy *MyPolicy, spec protoiface.MessageV1) (string, bool) {
+	w := yamlWriter{buf: bufferPool.Get().(*bytes.Buffer)}
+	defer func() {
+		w.buf.Reset()
+		bufferPool.Put(w.buf)
+	}()
+
+	ok := w.stringEntry("apiVersion", policy.APIVersion, 0) &&
+		w.stringEntry("kind", policy.Kind, 0) &&
+		w.field("metadata", 0) && w.newline() &&
+		w.stringEntry("name", policy.Metadata.Name, 2) &&
+		w.stringEntry("namespace", policy.Metadata.Namespace, 2) &&
+		w.field("spec", 0) && w.messageValue(protoimpl.X.ProtoMessageV2Of(spec).ProtoReflect(), 2)
+	if !ok {
+		return "", false
+	}
+	return w.buf.String(), true
+}
+
+// writeYAML returns the YAML of msg, or false if the direct writer cannot marshal it.
+func writeYAML(msg protoiface.MessageV1) (string, bool) {
+	w := yamlWriter{buf: bufferPool.Get().(*bytes.Buffer)}
+	defer func() {
+		w.buf.Reset()
+		bufferPool.Put(w.buf)
+	}()
+
+	m := protoimpl.X.ProtoMessageV2Of(msg).ProtoReflect()
+	var ok bool
+	if isEmpty(m) {
+		ok = w.raw("{}\n")
+	} else {
+		ok = w.message(m, 0, false)
+	}
+	if !ok {
+		return "", false
+	}
+	return w.buf.String(), true
+}
+
+func (w yamlWriter) raw(s string) bool {
+	w.buf.WriteString(s)
+	return true
+}
+
+func (w yamlWriter) newline() bool {
+	return w.raw("\n")
+}
+
+func (w yamlWriter) indent(n int) {
+	for i := 0; i < n; i++ {
+		w.buf.WriteByte(' ')
+	}
+}
+
+// field writes the key of a mapping entry at the given indentation.
+func (w yamlWriter) field(key string, indent int) bool {
+	w.indent(indent)
+	if !isPlain(key) {
+		return false
+	}
+	w.buf.WriteString(key)
+	w.buf.WriteByte(':')
+	return true
+}
+
+// stringEntry writes a mapping entry of a string value at the given indentation.
+func (w yamlWriter) stringEntry(key, value string, indent int) bool {
+	return w.field(key, indent) && w.raw(" ") && w.scalarString(value) && w.newline()
+}
+
+// messageValue writes m as the value of a mapping entry, its fields indented by indent.
+func (w yamlWriter) messageValue(m protoreflect.Message, indent int) bool {
+	if isEmpty(m) {
+		return w.raw(" {}\n")
+	}
+	return w.newline() && w.message(m, indent, false)
+}
+
+// message writes the fields of m at the given indentation. inline writes the first field right
+// after the "- " of a sequence item.
+func (w yamlWriter) message(m protoreflect.Message, indent int, inline bool) bool {
+	desc := m.Descriptor()
+	if strings.HasPrefix(string(desc.FullName()), "google.protobuf.") {
+		return false
+	}
+	for _, fd := range fieldsOf(desc) {
+		if !m.Has(fd) {
+			continue
+		}
+		keyIndent := indent
+		if inline {
+			keyIndent, inline = 0, false
+		}
+		if !w.field(fd.JSONName(), keyIndent) {
+			return false
+		}
+
+		v := m.Get(fd)
+		var ok bool
+		switch {
+		case fd.IsList():
+			ok = w.newline() && w.list(fd, v.List(), indent)
+		case fd.IsMap():
+			ok = w.newline() && w.mapEntries(fd, v.Map(), indent+2)
+		case fd.Message() != nil:
+			ok = w.messageValue(v.Message(), indent+2)
+		default:
+			ok = w.raw(" ") && w.scalar(fd, v) && w.newline()
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// list writes the items of a repeated field as a block sequence at the column of its key.
+func (w yamlWriter) list(fd protoreflect.FieldDescriptor, l protoreflect.List, indent int) bool {
+	for i := 0; i < l.Len(); i++ {
+		w.indent(indent)
+		w.buf.WriteString("- ")
+		var ok bool
+		if fd.Message() != nil {
+			if item := l.Get(i).Message(); isEmpty(item) {
+				ok = w.raw("{}\n")
+			} else {
+				ok = w.message(item, indent+2, true)
+			}
+		} else {
+			ok = w.scalar(fd, l.Get(i)) && w.newline()
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// mapEntries writes the entries of a map field, sorted by key.
+func (w yamlWriter) mapEntries(fd protoreflect.FieldDescriptor, m protoreflect.Map, indent int) bool {
+	if fd.MapKey().Kind() != protoreflect.StringKind {
+		return false
+	}
+	keys := make([]string, 0, m.Len())
+	m.Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+		keys = append(keys, k.String())
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool { return yamlKeyLess(keys[i], keys[j]) })
+
+	valueDesc := fd.MapValue()
+	for _, key := range keys {
+		if !w.field(key, indent) {
+			return false
+		}
+		v := m.Get(protoreflect.ValueOfString(key).MapKey())
+		var ok bool
+		if valueDesc.Message() != nil {
+			ok = w.messageValue(v.Message(), indent+2)
+		} else {
+			ok = w.raw(" ") && w.scalar(valueDesc, v) && w.newline()
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// scalar writes a singular value of fd the way protojson and yaml.v2 together write it.
+func (w yamlWriter) scalar(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return w.scalarString(v.String())
+	case protoreflect.BoolKind:
+		w.buf.WriteString(strconv.FormatBool(v.Bool()))
+	case protoreflect.EnumKind:
+		if fd.Enum().FullName() == "google.protobuf.NullValue" {
+			return false
+		}
+		value := fd.Enum().Values().ByNumber(v.Enum())
+		if value == nil {
+			return false
+		}
+		return w.scalarString(string(value.Name()))
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		w.buf.WriteString(strconv.FormatInt(v.Int(), 10))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		w.buf.WriteString(strconv.FormatUint(v.Uint(), 10))
+	default:
+		return false
+	}
+	return true
+}
+
+// scalarString writes s as a plain scalar when yaml.v2 would, and asks yaml.v2 for its quoting
+// otherwise.
+func (w yamlWriter) scalarString(s string) bool {
+	if isPlain(s) {
+		w.buf.WriteString(s)
+		return true
+	}
+	// yaml.v2 folds long scalars at their spaces depending on the column they start at, and the
+	// YAML of a single scalar does not know that column.
+	if !utf8.ValidString(s) || strings.ContainsAny(s, " \n") {
+		return false
+	}
+	quoted, err := yaml.Marshal(s)
+	if err != nil {
+		return false
+	}
+	quoted = bytes.TrimSuffix(quoted, []byte("\n"))
+	if bytes.IndexByte(quoted, '\n') >= 0 {
+		return false
+	}
+	w.buf.Write(quoted)
+	return true
+}
+
+// isPlain returns whether yaml.v2 writes s as a plain scalar. It accepts the identifiers, paths
+// and IP addresses of the generated policies and leaves everything else to yaml.v2.
+func isPlain(s string) bool {
+	if s == "" {
+		return false
+	}
+	switch c := s[0]; {
+	case c >= '0' && c <= '9':
+		// Not an integer, float or timestamp to yaml.v2: only digits, dots and slashes, with more
+		// than one dot or a slash.
+		dots := 0
+		for i := 0; i < len(s); i++ {
+			switch c := s[i]; {
+			case c == '.':
+				dots++
+			case c == '/':
+				dots = 2
+			case c < '0' || c > '9':
+				return false
+			}
+		}
+		return dots > 1
+	case c == '/' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for i := 1; i < len(s); i++ {
+			switch c := s[i]; {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+			case c == '/', c == '.', c == '-', c == '_':
+			default:
+				return false
+			}
+		}
+		return !isYAMLKeyword(s)
+	}
+	return false
+}
+
+// isYAMLKeyword returns whether yaml.v2 reads the plain scalar s as a bool or a null.
+func isYAMLKeyword(s string) bool {
+	switch s {
+	case "y", "Y", "yes", "Yes", "YES", "n", "N", "no", "No", "NO",
+		"true", "True", "TRUE", "false", "False", "FALSE",
+		"on", "On", "ON", "off", "Off", "OFF",
+		"null", "Null", "NULL":
+		return true
+	}
+	return false
+}
+
+// isEmpty returns whether m has no field set, without the allocations of m.Range.
+func isEmpty(m protoreflect.Message) bool {
+	for _, fd := range fieldsOf(m.Descriptor()) {
+		if m.Has(fd) {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldsOf returns the fields of desc sorted by JSON name, the order yaml.v2 writes them in.
+func fieldsOf(desc protoreflect.MessageDescriptor) []protoreflect.FieldDescriptor {
+	if fields, ok := sortedFields.Load(desc.FullName()); ok {
+		return fields.([]protoreflect.FieldDescriptor)
+	}
+	fds := desc.Fields()
+	fields := make([]protoreflect.FieldDescriptor, fds.Len())
+	for i := range fields {
+		fields[i] = fds.Get(i)
+	}
+	sort.Slice(fields, func(i, j int) bool { return yamlKeyLess(fields[i].JSONName(), fields[j].JSONName()) })
+	sortedFields.Store(desc.FullName(), fields)
+	return fields
+}
+
+// yamlKeyLess orders the string keys of a mapping like yaml.v2 does, comparing the runs of digits
+// by their numeric value.
+func yamlKeyLess(a, b string) bool {
+	ar, br := []rune(a), []rune(b)
+	for i := 0; i < len(ar) && i < len(br); i++ {
+		if ar[i] == br[i] {
+			continue
+		}
+		al := unicode.IsLetter(ar[i])
+		bl := unicode.IsLetter(br[i])
+		if al && bl {
+			return ar[i] < br[i]
+		}
+		if al || bl {
+			return bl
+		}
+		var ai, bi int
+		var an, bn int64
+		if ar[i] == '0' || br[i] == '0' {
+			for j := i - 1; j >= 0 && unicode.IsDigit(ar[j]); j-- {
+				if ar[j] != '0' {
+					an = 1
+					bn = 1
+					break
+				}
+			}
+		}
+		for ai = i; ai < len(ar) && unicode.IsDigit(ar[ai]); ai++ {
+			an = an*10 + int64(ar[ai]-'0')
+		}
+		for bi = i; bi < len(br) && unicode.IsDigit(br[bi]); bi++ {
+			bn = bn*10 + int64(br[bi]-'0')
+		}
+		if an != bn {
+			return an < bn
+		}
+		if ai != bi {
+			return ai < bi
+		}
+		return ar[i] < br[i]
+	}
+	return len(ar) < len(br)
+}
@@ -0,0 +1,124 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"text/template"
+)
+
+// githubCommentMarker starts the PR comments of the github report, so that the automation posting
+// them can find and update its previous comment.
+const githubCommentMarker = "<!-- generate-policies-report -->"
+
+// githubMetric is a result compared by the github report, a column of the exported results.
+type githubMetric struct {
+	column string
+	label  string
+	// format prints the values of the metric.
+	format string
+	// higherIsBetter is set for the metrics which regress when they decrease, such as the QPS.
+	higherIsBetter bool
+}
+
+var githubMetrics = []githubMetric{
+	{"latency_p50_ms", "Latency p50 (ms)", "%.3f", false},
+	{"latency_p99_ms", "Latency p99 (ms)", "%.3f", false},
+	{"denied_latency_p99_ms", "Denied latency p99 (ms)", "%.3f", false},
+	{"load_qps", "QPS", "%.1f", true},
+	{"ext_authz_added_p99_ms", "ext_authz added p99 (ms)", "%.3f", false},
+	{"apply_seconds", "Apply (s)", "%.1f", false},
+	{"push_latency_p99_seconds", "Push latency p99 (s)", "%.3f", false},
+	{"convergence_seconds", "Convergence (s)", "%.1f", false},
+	{"config_size_p99_bytes", "Config size p99 (B)", "%.0f", false},
+}
+
+// githubRow is a metric of a run compared with its baseline.
+type githubRow struct {
+	Metric, Baseline, Current, Delta string
+	Regression                       bool
+}
+
+// githubRun is a run of the github report.
+type githubRun struct {
+	File, Command string
+	Metadata      *RunMetadata
+	Baseline      string
+	Rows          []githubRow
+	Errors        int
+	Regressions   int
+}
+
+// compareRuns returns the metrics of report compared with the ones of baseline, which may be nil.
+// A metric worse than its baseline by more than threshold percent regressed.
+func compareRuns(file string, report *RunReport, baselineFile string, baseline *RunReport, threshold float64) (githubRun, error) {
+	run := githubRun{File: file, Command: report.Command, Metadata: report.Metadata, Baseline: baselineFile, Errors: len(report.Errors)}
+	current, err := resultRow(report, nil)
+	if err != nil {
+		return run, err
+	}
+	base := map[string]interface{}{}
+	if baseline != nil {
+		if base, err = resultRow(baseline, nil); err != nil {
+			return run, err
+		}
+	}
+	for _, m := range githubMetrics {
+		value, ok := current[m.column].(float64)
+		if !ok {
+			continue
+		}
+		row := githubRow{Metric: m.label, Current: fmt.Sprintf(m.format, value), Baseline: "-", Delta: "-"}
+		if before, ok := base[m.column].(float64); ok {
+			row.Baseline = fmt.Sprintf(m.format, before)
+			if before != 0 {
+				delta := (value - before) / math.Abs(before) * 100
+				row.Delta = fmt.Sprintf("%+.1f%%", delta)
+				if m.higherIsBetter {
+					delta = -delta
+				}
+				row.Regression = delta > threshold
+			}
+		}
+		if row.Regression {
+			run.Regressions++
+		}
+		run.Rows = append(run.Rows, row)
+	}
+	return run, nil
+}
+
+var githubReportTemplate = template.Must(template.New("github").Parse(githubCommentMarker + `
+### Security policy benchmark
+{{range .Runs}}
+**{{.Command}}** ` + "`{{.File}}`" + `{{with .Metadata}} · generate_policies {{.ToolVersion}}{{if .GitSHA}} ({{.GitSHA}}){{end}}{{end}}{{if .Baseline}} vs ` + "`{{.Baseline}}`" + `{{end}}
+{{if .Rows}}
+| Metric | Baseline | Current | Delta |
+|--------|---------:|--------:|------:|
+{{range .Rows}}| {{.Metric}} | {{.Baseline}} | {{.Current}} | {{.Delta}}{{if .Regression}} :warning:{{end}} |
+{{end}}{{end}}
+{{if .Regressions}}:warning: {{.Regressions}} regressions over {{$.Threshold}}%{{else if .Baseline}}:white_check_mark: No regression over {{$.Threshold}}%{{end}}{{if .Errors}}{{if or .Regressions .Baseline}}, {{end}}:x: {{.Errors}} errors{{end}}
+{{end}}`))
+
+// writeGitHubReport writes the compact comparison of the runs with their baselines, Markdown for
+// a GitHub PR comment.
+func writeGitHubReport(w io.Writer, runs []githubRun, threshold float64) error {
+	return githubReportTemplate.Execute(w, struct {
+		Runs      []githubRun
+		Threshold float64
+	}{runs, threshold})
+}
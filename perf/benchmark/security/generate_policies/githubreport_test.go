@@ -0,0 +1,66 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGitHubReport(t *testing.T) {
+	baseline := &RunReport{Command: "bench", Load: &LoadResult{ActualQPS: 100, Latency: LatencySummary{P50: 1, P90: 2, P99: 3}}}
+	current := &RunReport{
+		Command:  "bench",
+		Metadata: &RunMetadata{ToolVersion: "v1.2.3", GitSHA: "abc"},
+		Load:     &LoadResult{ActualQPS: 80, Latency: LatencySummary{P50: 1.05, P90: 2, P99: 3.6}},
+		Errors:   []string{"timeout"},
+	}
+	run, err := compareRuns("pr/report.json", current, "main/report.json", baseline, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// p99 +20% and QPS -20% regressed, p50 +5% is within the threshold.
+	if run.Regressions != 2 {
+		t.Errorf("got %d regressions, want 2: %+v", run.Regressions, run.Rows)
+	}
+	var out bytes.Buffer
+	if err := writeGitHubReport(&out, []githubRun{run}, 10); err != nil {
+		t.Fatal(err)
+	}
+	want := githubCommentMarker + `
+### Security policy benchmark
+
+**bench** ` + "`pr/report.json`" + ` · generate_policies v1.2.3 (abc) vs ` + "`main/report.json`" + `
+
+| Metric | Baseline | Current | Delta |
+|--------|---------:|--------:|------:|
+| Latency p50 (ms) | 1.000 | 1.050 | +5.0% |
+| Latency p99 (ms) | 3.000 | 3.600 | +20.0% :warning: |
+| QPS | 100.0 | 80.0 | -20.0% :warning: |
+
+:warning: 2 regressions over 10%, :x: 1 errors
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+
+	run, err = compareRuns("pr/report.json", baseline, "", nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Regressions != 0 || len(run.Rows) != 3 || run.Rows[0].Baseline != "-" || run.Rows[0].Delta != "-" {
+		t.Errorf("got %+v without a baseline", run)
+	}
+}
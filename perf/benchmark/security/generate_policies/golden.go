@@ -0,0 +1,118 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+const goldenSuffix = ".golden.yaml"
+
+// goldenConfigs returns the config files of dir, each compared with the golden file of the same
+// name.
+func goldenConfigs(dir string) ([]string, error) {
+	configs, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no config files in %s", dir)
+	}
+	return configs, nil
+}
+
+func goldenFile(configFile string) string {
+	return strings.TrimSuffix(configFile, filepath.Ext(configFile)) + goldenSuffix
+}
+
+// generateGolden returns the output of the policies generated from configFile, round-trip
+// checked. A relative
+// requestAuthN.keyFile is resolved against the directory of configFile, so that the fixtures
+// can commit the key the golden output is signed with.
+func generateGolden(configFile string) (string, error) {
+	policyData, err := loadSecurityPolicy("", configFile)
+	if err != nil {
+		return "", err
+	}
+	policyData.RoundTripCheck = true
+	if keyFile := policyData.RequestAuthN.KeyFile; keyFile != "" && !filepath.IsAbs(keyFile) {
+		policyData.RequestAuthN.KeyFile = filepath.Join(filepath.Dir(configFile), keyFile)
+	}
+	policies, err := generatePolicies(context.Background(), policyData)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	for _, policy := range policies {
+		out.WriteString(policy + "---\n")
+	}
+	return out.String(), nil
+}
+
+// checkGolden compares the policies generated from configFile with its golden file, which is
+// rewritten instead when update is set.
+func checkGolden(configFile string, update bool) error {
+	got, err := generateGolden(configFile)
+	if err != nil {
+		return fmt.Errorf("%s: %v", configFile, err)
+	}
+	golden := goldenFile(configFile)
+	if update {
+		return ioutil.WriteFile(golden, []byte(got), 0644)
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		return err
+	}
+	if got == string(want) {
+		return nil
+	}
+	gotLines, wantLines := strings.Split(got, "\n"), strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			return fmt.Errorf("%s: line %d: got %q, want %q", golden, i+1, g, w)
+		}
+	}
+	return fmt.Errorf("%s: output differs", golden)
+}
+
+// checkGoldenDir runs checkGolden on every config file of dir.
+func checkGoldenDir(dir string, update bool) error {
+	configs, err := goldenConfigs(dir)
+	if err != nil {
+		return err
+	}
+	var failures []string
+	for _, config := range configs {
+		if err := checkGolden(config, update); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d golden files differ:\n%s", len(failures), len(configs), strings.Join(failures, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// goString returns s as a Go string literal, raw unless s has characters a raw string cannot hold.
+func goString(s string) string {
+	if strings.ContainsAny(s, "`\r") {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
+
+// writeGoSource writes docs as the Go source of package pkg, for integration tests of the Istio
+// test framework to embed a scenario without file fixtures: the variable name lists the documents
+// with their namespace, and Apply<Name> applies them with the ApplyYAML of a config manager of the
+// framework, e.g. ctx.Config(), batching the consecutive documents of a namespace. The documents
+// keep their order, so that the namespaces and identities are applied before the policies bound to
+// them. source describes how the documents were generated.
+func writeGoSource(w io.Writer, docs []string, pkg, name, source string) error {
+	if !token.IsIdentifier(pkg) {
+		return fmt.Errorf("invalid Go package name %q", pkg)
+	}
+	if !token.IsIdentifier(name) {
+		return fmt.Errorf("invalid Go variable name %q", name)
+	}
+	apply := "Apply" + strings.ToUpper(name[:1]) + name[1:]
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by generate_policies. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	fmt.Fprintf(&b, "// %s are the documents, in the order they are applied and with their namespace, of\n// %s.\n", name, source)
+	fmt.Fprintf(&b, "var %s = []struct {\n\tNamespace string\n\tYAML string\n}{\n", name)
+	for _, doc := range docs {
+		objects, err := parsePolicyObjects([]string{doc})
+		if err != nil {
+			return err
+		}
+		namespace := ""
+		if len(objects) > 0 {
+			namespace = objects[0].Namespace
+		}
+		fmt.Fprintf(&b, "{Namespace: %q, YAML: %s},\n", namespace, goString(strings.TrimLeft(doc, "\n")))
+	}
+	b.WriteString("}\n\n")
+	fmt.Fprintf(&b, `// %[2]s applies %[1]s with the ApplyYAML of a config manager of the Istio test framework,
+// e.g. %[2]s(ctx.Config()), batching the consecutive documents of a namespace.
+func %[2]s(c interface {
+	ApplyYAML(ns string, yamlText ...string) error
+}) error {
+	for i := 0; i < len(%[1]s); {
+		ns := %[1]s[i].Namespace
+		var docs []string
+		for ; i < len(%[1]s) && %[1]s[i].Namespace == ns; i++ {
+			docs = append(docs, %[1]s[i].YAML)
+		}
+		if err := c.ApplyYAML(ns, docs...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+`, name, apply)
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
@@ -0,0 +1,66 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestWriteGoSource(t *testing.T) {
+	docs := splitYAMLDocuments(`
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: ns
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: allow
+  namespace: ns
+spec:
+  rules:
+  - to:
+    - operation:
+        paths: ["/a` + "`" + `b"]
+`)
+	var b bytes.Buffer
+	if err := writeGoSource(&b, docs, "scenarios", "tieredOrg", "generate_policies -scenario=tiered-org"); err != nil {
+		t.Fatal(err)
+	}
+	src := b.String()
+	if _, err := parser.ParseFile(token.NewFileSet(), "policies.go", src, 0); err != nil {
+		t.Fatalf("the source does not parse: %v\n%s", err, src)
+	}
+	for _, want := range []string{
+		"// Code generated by generate_policies. DO NOT EDIT.\n\npackage scenarios\n",
+		"// generate_policies -scenario=tiered-org.\nvar tieredOrg = []struct {",
+		"{Namespace: \"\", YAML: `apiVersion: v1\nkind: Namespace\n",
+		`{Namespace: "ns", YAML: "apiVersion: security.istio.io/v1beta1\n`,
+		"func ApplyTieredOrg(c interface {",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("the source does not contain\n%s\ngot\n%s", want, src)
+		}
+	}
+
+	if err := writeGoSource(&b, docs, "scenarios", "tiered-org", ""); err == nil {
+		t.Error("got no error for an invalid variable name")
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	authzpb "istio.io/api/security/v1beta1"
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// underscoresActions are the values of the headers_with_underscores_action of Envoy's HTTP
+// connection manager, ALLOW being its default.
+var underscoresActions = []string{"ALLOW", "DROP_HEADER", "REJECT_REQUEST"}
+
+// maxRequestHeadersBytes is the default max_request_headers_kb of Envoy, larger requests are
+// rejected with 431 before any filter runs.
+const maxRequestHeadersBytes = 60 * 1024
+
+var headerNameRegexp = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// headerCase derives the headers of an edge case request from the protected header name, its
+// value and the long value the policy also matches.
+type headerCase struct {
+	name    string
+	headers func(name, value, long string) map[string][]string
+}
+
+var headerCases = []headerCase{
+	{"exact", func(n, v, _ string) map[string][]string { return map[string][]string{n: {v}} }},
+	{"upper-case-name", func(n, v, _ string) map[string][]string { return map[string][]string{strings.ToUpper(n): {v}} }},
+	{"mixed-case-name", func(n, v, _ string) map[string][]string { return map[string][]string{mixedCase(n): {v}} }},
+	{"upper-case-value", func(n, v, _ string) map[string][]string { return map[string][]string{n: {strings.ToUpper(v)}} }},
+	{"underscore-name", func(n, v, _ string) map[string][]string {
+		return map[string][]string{strings.Replace(n, "-", "_", -1): {v}}
+	}},
+	{"duplicated", func(n, v, _ string) map[string][]string { return map[string][]string{n: {v, v}} }},
+	{"duplicated-other-value", func(n, v, _ string) map[string][]string { return map[string][]string{n: {"other", v}} }},
+	{"duplicated-case-variant", func(n, v, _ string) map[string][]string {
+		return map[string][]string{n: {v}, strings.ToUpper(n): {v}}
+	}},
+	{"long-value", func(n, _, long string) map[string][]string { return map[string][]string{n: {long}} }},
+	{"oversized-value", func(n, v, _ string) map[string][]string {
+		return map[string][]string{n: {v + strings.Repeat("x", maxRequestHeadersBytes)}}
+	}},
+}
+
+// mixedCase upper cases every other letter of s.
+func mixedCase(s string) string {
+	b := []byte(s)
+	for i := 0; i < len(b); i += 2 {
+		b[i] = strings.ToUpper(string(b[i]))[0]
+	}
+	return string(b)
+}
+
+// headerValue returns the value a header matcher on name sees in headers when the mesh handles
+// header names with underscores with action, and whether the request is rejected before
+// authorization. Header names are case insensitive, and the values of a header sent several
+// times are joined with commas, as Envoy does before matching.
+func headerValue(headers map[string][]string, name, action string) (string, bool) {
+	size := 0
+	var values []string
+	for _, k := range sortedHeaderNames(headers) {
+		for _, v := range headers[k] {
+			size += len(k) + len(v)
+		}
+		if strings.Contains(k, "_") {
+			if action == "REJECT_REQUEST" {
+				return "", true
+			}
+			if action == "DROP_HEADER" {
+				continue
+			}
+		}
+		if strings.EqualFold(k, name) {
+			values = append(values, headers[k]...)
+		}
+	}
+	if size > maxRequestHeadersBytes {
+		return "", true
+	}
+	return strings.Join(values, ","), false
+}
+
+func sortedHeaderNames(headers map[string][]string) []string {
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// headerNormalizationCase is one edge case request of the matrix, with the decision expected
+// under every headers_with_underscores_action.
+type headerNormalizationCase struct {
+	Case    string              `json:"case"`
+	Headers map[string][]string `json:"headers"`
+	Expect  map[string]string   `json:"expect"`
+}
+
+// headerNormalizationPolicy returns the policy matching the header name with value or long.
+func headerNormalizationPolicy(namespace string, action authzpb.AuthorizationPolicy_Action, name, value, long string) parsedAuthorizationPolicy {
+	return parsedAuthorizationPolicy{
+		Name:      "header-normalization-" + strings.ToLower(action.String()),
+		Namespace: namespace,
+		Spec: &authzpb.AuthorizationPolicy{
+			Action: action,
+			Rules: []*authzpb.Rule{{When: []*authzpb.Condition{{
+				Key:    "request.headers[" + name + "]",
+				Values: []string{value, long},
+			}}}},
+		},
+	}
+}
+
+// headerNormalizationMatrix returns the edge cases of the header name with their expected
+// decisions under policy.
+func headerNormalizationMatrix(policy parsedAuthorizationPolicy, name, value, long string) ([]headerNormalizationCase, error) {
+	if !headerNameRegexp.MatchString(name) || !strings.Contains(name, "-") {
+		return nil, fmt.Errorf("invalid header %q: must be a lower case header name with a dash and without underscores", name)
+	}
+	if value == "" || strings.ContainsAny(value, "*,") || strings.ToUpper(value) == value {
+		return nil, fmt.Errorf("invalid value %q: must be an exact value with lower case letters and without commas", value)
+	}
+	w := workload{namespace: policy.Namespace}
+	var cases []headerNormalizationCase
+	for _, c := range headerCases {
+		hc := headerNormalizationCase{Case: c.name, Headers: c.headers(name, value, long), Expect: map[string]string{}}
+		for _, action := range underscoresActions {
+			v, rejected := headerValue(hc.Headers, name, action)
+			if rejected {
+				hc.Expect[action] = expectRejected
+				continue
+			}
+			r := simulatedRequest{}
+			r.set("request.headers["+name+"]", v)
+			hc.Expect[action] = expectDeny
+			if evaluate([]parsedAuthorizationPolicy{policy}, w, "", r).Allowed {
+				hc.Expect[action] = expectAllow
+			}
+		}
+		cases = append(cases, hc)
+	}
+	return cases, nil
+}
+
+func printHeaderNormalizationMatrix(cases []headerNormalizationCase) {
+	tw := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CASE\tHEADERS\t"+strings.Join(underscoresActions, "\t"))
+	for _, c := range cases {
+		var headers []string
+		for _, k := range sortedHeaderNames(c.Headers) {
+			for _, v := range c.Headers[k] {
+				if len(v) > 16 {
+					v = fmt.Sprintf("%s... (%d bytes)", v[:16], len(v))
+				}
+				headers = append(headers, k+": "+v)
+			}
+		}
+		row := []string{c.Case, strings.Join(headers, ", ")}
+		for _, action := range underscoresActions {
+			row = append(row, c.Expect[action])
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	_ = tw.Flush()
+}
+
+func runHeaderNormalization(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("header-normalization", flag.ExitOnError)
+	namespace := fs.String("namespace", generatepolicies.DefaultNamespace, "The namespace of the policy")
+	headerName := fs.String("header", "x-tenant-id", "The lower case name of the header the policy matches, containing a dash")
+	value := fs.String("value", "tenant-a", "The exact value of the header the policy matches")
+	longValueBytes := fs.Int("longValueBytes", 8192, "The length of the long value the policy also matches")
+	action := fs.String("action", "DENY", "The action of the policy on the matched header, DENY or ALLOW")
+	underscores := fs.String("underscoresAction", "ALLOW", "The headers_with_underscores_action of the mesh under test, the decisions of the traffic profile are expected for it")
+	expectFile := fs.String("expectFile", "", "A JSON file the expected decisions of every case under every underscores action are written to")
+	trafficFile := fs.String("trafficFile", "", "A traffic profile file with one request per case expected to be decided as under -underscoresAction")
+	_ = fs.Parse(args)
+
+	act, ok := authzpb.AuthorizationPolicy_Action_value[*action]
+	if !ok || (act != int32(authzpb.AuthorizationPolicy_DENY) && act != int32(authzpb.AuthorizationPolicy_ALLOW)) {
+		return fmt.Errorf("invalid action %q, must be DENY or ALLOW", *action)
+	}
+	known := false
+	for _, a := range underscoresActions {
+		known = known || a == *underscores
+	}
+	if !known {
+		return fmt.Errorf("invalid underscoresAction %q, must be one of %s", *underscores, strings.Join(underscoresActions, ", "))
+	}
+	if *longValueBytes <= len(*value) || *longValueBytes >= maxRequestHeadersBytes {
+		return fmt.Errorf("invalid longValueBytes %d, must be longer than the value and below %d", *longValueBytes, maxRequestHeadersBytes)
+	}
+	long := *value + "-" + strings.Repeat("x", *longValueBytes-len(*value)-1)
+	policy := headerNormalizationPolicy(*namespace, authzpb.AuthorizationPolicy_Action(act), *headerName, *value, long)
+	cases, err := headerNormalizationMatrix(policy, *headerName, *value, long)
+	if err != nil {
+		return err
+	}
+
+	if *expectFile != "" {
+		js, err := json.MarshalIndent(cases, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(*expectFile, js, 0644); err != nil {
+			return err
+		}
+	}
+	if *trafficFile != "" {
+		profile := &TrafficProfile{Scenario: "header-normalization-" + strings.ToLower(*underscores)}
+		for _, c := range cases {
+			profile.Requests = append(profile.Requests, TrafficRequest{Method: "GET", Path: "/", HeaderValues: c.Headers, Expect: c.Expect[*underscores]})
+		}
+		if err := writeTrafficProfile(profile, *trafficFile); err != nil {
+			return err
+		}
+	}
+
+	header := &generatepolicies.MyPolicy{
+		APIVersion: "security.istio.io/v1beta1",
+		Kind:       "AuthorizationPolicy",
+		Metadata:   generatepolicies.MetadataStruct{Namespace: policy.Namespace, Name: policy.Name},
+	}
+	doc, err := generatepolicies.PolicyToYAML(header, policy.Spec)
+	if err != nil {
+		return err
+	}
+	fmt.Println(doc + "---")
+	printHeaderNormalizationMatrix(cases)
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+func TestHeaderValue(t *testing.T) {
+	cases := []struct {
+		headers  map[string][]string
+		action   string
+		want     string
+		rejected bool
+	}{
+		{map[string][]string{"X-Token": {"a"}}, "ALLOW", "a", false},
+		{map[string][]string{"x-token": {"a", "b"}}, "ALLOW", "a,b", false},
+		{map[string][]string{"X-TOKEN": {"a"}, "x-token": {"b"}}, "ALLOW", "a,b", false},
+		{map[string][]string{"x_token": {"a"}}, "ALLOW", "", false},
+		{map[string][]string{"x_other": {"a"}, "x-token": {"b"}}, "DROP_HEADER", "b", false},
+		{map[string][]string{"x_other": {"a"}, "x-token": {"b"}}, "REJECT_REQUEST", "", true},
+		{map[string][]string{"x-token": {strings.Repeat("a", maxRequestHeadersBytes)}}, "ALLOW", "", true},
+	}
+	for _, c := range cases {
+		got, rejected := headerValue(c.headers, "x-token", c.action)
+		if got != c.want || rejected != c.rejected {
+			t.Errorf("headerValue(%v, %s) = %q, %v, want %q, %v", c.headers, c.action, got, rejected, c.want, c.rejected)
+		}
+	}
+}
+
+func TestHeaderNormalizationMatrix(t *testing.T) {
+	long := "a-" + strings.Repeat("x", 100)
+	policy := headerNormalizationPolicy("ns", authzpb.AuthorizationPolicy_ALLOW, "x-token", "a", long)
+	cases, err := headerNormalizationMatrix(policy, "x-token", "a", long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != len(headerCases) {
+		t.Fatalf("got %d cases, want %d", len(cases), len(headerCases))
+	}
+	want := map[string]map[string]string{
+		"exact":           {"ALLOW": expectAllow},
+		"mixed-case-name": {"ALLOW": expectAllow},
+		"underscore-name": {"ALLOW": expectDeny, "REJECT_REQUEST": expectRejected},
+		"duplicated":      {"ALLOW": expectDeny},
+		"long-value":      {"ALLOW": expectAllow},
+		"oversized-value": {"DROP_HEADER": expectRejected},
+	}
+	for _, c := range cases {
+		for action, expect := range want[c.Case] {
+			if c.Expect[action] != expect {
+				t.Errorf("%s under %s: got %s, want %s", c.Case, action, c.Expect[action], expect)
+			}
+		}
+	}
+
+	for _, name := range []string{"X-Token", "x_token", "token"} {
+		if _, err := headerNormalizationMatrix(policy, name, "a", long); err == nil {
+			t.Errorf("expected an error for header %q", name)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// importedKinds are the kinds of the imported policies, other resources are skipped.
+var importedKinds = map[string]bool{
+	"AuthorizationPolicy":   true,
+	"PeerAuthentication":    true,
+	"RequestAuthentication": true,
+}
+
+// variedFields are the fields whose values differ between the scaled variants of a policy. The
+// other fields, such as selectors, methods, ports and JWKS, are copied as is.
+var variedFields = map[string]bool{
+	"paths": true, "notPaths": true,
+	"hosts": true, "notHosts": true,
+	"principals": true, "notPrincipals": true,
+	"requestPrincipals": true, "notRequestPrincipals": true,
+	"namespaces": true, "notNamespaces": true,
+	"ipBlocks": true, "notIpBlocks": true,
+	"remoteIpBlocks": true, "notRemoteIpBlocks": true,
+	"values": true, "notValues": true,
+	"audiences": true,
+	"issuer":    true,
+}
+
+// importPolicies returns the security policies of path, a YAML file or a directory of YAML and
+// JSON files, or else of the cluster.
+func importPolicies(ctx context.Context, path string) ([]policyObject, error) {
+	return importObjects(ctx, path, importedKinds,
+		"authorizationpolicies.security.istio.io,peerauthentications.security.istio.io,requestauthentications.security.istio.io")
+}
+
+// importObjects returns the objects of kinds of path, a YAML file or a directory of YAML and JSON
+// files, or else the resources of the cluster.
+func importObjects(ctx context.Context, path string, kinds map[string]bool, resources string) ([]policyObject, error) {
+	var docs []string
+	if path != "" {
+		files := []string{path}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			entries, err := ioutil.ReadDir(path)
+			if err != nil {
+				return nil, err
+			}
+			files = nil
+			for _, entry := range entries {
+				switch filepath.Ext(entry.Name()) {
+				case ".yaml", ".yml", ".json":
+					files = append(files, filepath.Join(path, entry.Name()))
+				}
+			}
+		}
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, splitYAMLDocuments(string(data))...)
+		}
+	} else {
+		out, err := kubectl(ctx, nil, "get", "--all-namespaces", "-o", "yaml", resources)
+		if err != nil {
+			return nil, err
+		}
+		docs = []string{string(out)}
+	}
+
+	objects, err := parsePolicyObjects(docs)
+	if err != nil {
+		return nil, err
+	}
+	var policies []policyObject
+	for _, p := range objects {
+		if kinds[p.Kind] {
+			policies = append(policies, p)
+		}
+	}
+	return policies, nil
+}
+
+// scalePolicy returns the n variants of p named <name>-scaled-<i>. A variant has the shape of p,
+// the same rules with the same fields and numbers of values, with the values of variedFields
+// made unique to the variant.
+func scalePolicy(p policyObject, n int, namespace string) []policyObject {
+	if namespace == "" {
+		namespace = p.Namespace
+	}
+	variants := make([]policyObject, n)
+	for i := range variants {
+		spec, _ := varyValue(p.Spec, "", i+1).(map[string]interface{})
+		if spec == nil {
+			spec = map[string]interface{}{}
+		}
+		variants[i] = policyObject{
+			APIVersion: p.APIVersion,
+			Kind:       p.Kind,
+			Namespace:  namespace,
+			Name:       fmt.Sprintf("%s-scaled-%d", p.Name, i+1),
+			Spec:       spec,
+		}
+	}
+	return variants
+}
+
+// varyValue returns a copy of v, the value of field, with the strings of variedFields varied for
+// the variant i.
+func varyValue(v interface{}, field string, i int) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		varied := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			varied[key] = varyValue(child, key, i)
+		}
+		return varied
+	case []interface{}:
+		varied := make([]interface{}, len(v))
+		for j, child := range v {
+			varied[j] = varyValue(child, field, i)
+		}
+		return varied
+	case string:
+		if variedFields[field] {
+			return varyString(v, i)
+		}
+	}
+	return v
+}
+
+// varyString returns the value s of the variant i. IP addresses and CIDR blocks are moved by
+// varyIP, numbers and the wildcard are kept, and the other values get the suffix -<i>, before the
+// wildcard of a prefix match.
+func varyString(s string, i int) string {
+	if s == "" || s == "*" {
+		return s
+	}
+	if varied, ok := varyIP(s, i); ok {
+		return varied
+	}
+	if _, err := strconv.Atoi(s); err == nil {
+		return s
+	}
+	suffix := "-" + strconv.Itoa(i)
+	switch {
+	case strings.HasSuffix(s, "*"):
+		return strings.TrimSuffix(s, "*") + strconv.Itoa(i) + "-*"
+	case strings.HasPrefix(s, "*"):
+		return "*" + suffix + strings.TrimPrefix(s, "*")
+	}
+	return s + suffix
+}
+
+// varyIP returns the IP address or the CIDR block s moved by i times 256 blocks of its size, or
+// false if s is neither. The consecutive blocks of a policy, such as 10.0.0.0/24 and 10.0.1.0/24,
+// then do not overlap the blocks of the other variants.
+func varyIP(s string, i int) (string, bool) {
+	ip, block, err := net.ParseCIDR(s)
+	if err != nil {
+		if ip = net.ParseIP(s); ip == nil {
+			return "", false
+		}
+		if v4 := ip.To4(); v4 != nil {
+			ip = v4
+		}
+		block = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+	}
+	if v4 := block.IP.To4(); v4 != nil {
+		block.IP = v4
+	}
+	ones, bits := block.Mask.Size()
+
+	// The address space wraps around, blocks too large to be moved by 256 blocks are moved by one.
+	shift := bits - ones + 8
+	if shift >= bits {
+		shift = bits - ones
+	}
+	addr := new(big.Int).SetBytes(block.IP)
+	addr.Add(addr, new(big.Int).Lsh(big.NewInt(int64(i)), uint(shift)))
+	addr.Mod(addr, new(big.Int).Lsh(big.NewInt(1), uint(bits)))
+	varied := make(net.IP, bits/8)
+	addr.FillBytes(varied)
+
+	if err != nil {
+		return varied.String(), true
+	}
+	return fmt.Sprintf("%s/%d", varied, ones), true
+}
+
+// policyObjectYAML returns the YAML document of p.
+func policyObjectYAML(p policyObject) (string, error) {
+	yml, err := yaml.Marshal(struct {
+		generatepolicies.MyPolicy
+		Spec map[string]interface{} `json:"spec"`
+	}{
+		MyPolicy: generatepolicies.MyPolicy{
+			APIVersion: p.APIVersion,
+			Kind:       p.Kind,
+			Metadata:   generatepolicies.MetadataStruct{Name: p.Name, Namespace: p.Namespace},
+		},
+		Spec: p.Spec,
+	})
+	return string(yml), err
+}
+
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dir := fs.String("dir", "", "A YAML file or a directory of YAML files of policies to import instead of the policies of the cluster")
+	scale := fs.Int("scale", 10, "The number of variants generated from every imported policy")
+	namespace := fs.String("namespace", "", "The namespace of the variants, defaults to the namespace of their policy")
+	validateSchema := fs.Bool("validateSchema", false, "Validate the variants against the OpenAPI schemas of their CRDs")
+	schemaFile := fs.String("schemaFile", "", "A path or URL of the CRDs to validate against, defaults to the bundled security.istio.io CRDs")
+	_ = fs.Parse(args)
+
+	if *scale < 1 {
+		return fmt.Errorf("-scale must be at least 1, got %d", *scale)
+	}
+	policies, err := importPolicies(ctx, *dir)
+	if err != nil {
+		return err
+	}
+	if len(policies) == 0 {
+		return fmt.Errorf("no AuthorizationPolicy, PeerAuthentication or RequestAuthentication to import")
+	}
+
+	kinds := make(map[string]int)
+	var docs []string
+	for _, p := range policies {
+		kinds[p.Kind]++
+		for _, variant := range scalePolicy(p, *scale, *namespace) {
+			doc, err := policyObjectYAML(variant)
+			if err != nil {
+				return fmt.Errorf("%s: %v", p, err)
+			}
+			docs = append(docs, doc)
+		}
+	}
+	if *validateSchema {
+		if err := validateSchemas(docs, *schemaFile); err != nil {
+			return err
+		}
+	}
+	for _, doc := range docs {
+		fmt.Println(doc + "---")
+	}
+
+	var imported []string
+	for kind, n := range kinds {
+		imported = append(imported, fmt.Sprintf("%d %s", n, kind))
+	}
+	sort.Strings(imported)
+	fmt.Fprintf(os.Stderr, "imported %s, wrote %d policies\n", strings.Join(imported, ", "), len(docs))
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestVaryString(t *testing.T) {
+	for _, c := range []struct {
+		in, want string
+	}{
+		{"/api", "/api-2"},
+		{"/api/*", "/api/2-*"},
+		{"*.example.com", "*-2.example.com"},
+		{"*", "*"},
+		{"8080", "8080"},
+		{"10.0.0.0/24", "10.2.0.0/24"},
+		{"10.0.1.0/24", "10.2.1.0/24"},
+		{"192.168.0.7", "192.168.2.7"},
+		{"10.0.0.0/8", "12.0.0.0/8"},
+		{"255.255.255.0/24", "0.1.255.0/24"},
+		{"2001:db8::/64", "2001:db8:0:200::/64"},
+	} {
+		if got := varyString(c.in, 2); got != c.want {
+			t.Errorf("varyString(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestScalePolicy(t *testing.T) {
+	policies, err := parsePolicyObjects([]string{`
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: allow
+  namespace: prod
+spec:
+  selector:
+    matchLabels:
+      app: web
+  rules:
+  - from:
+    - source:
+        principals: ["cluster.local/ns/prod/sa/api"]
+    to:
+    - operation:
+        methods: ["GET"]
+        paths: ["/v1/*"]
+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	variants := scalePolicy(policies[0], 2, "bench")
+	doc, err := policyObjectYAML(variants[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: allow-scaled-2
+  namespace: bench
+spec:
+  rules:
+  - from:
+    - source:
+        principals:
+        - cluster.local/ns/prod/sa/api-2
+    to:
+    - operation:
+        methods:
+        - GET
+        paths:
+        - /v1/2-*
+  selector:
+    matchLabels:
+      app: web
+`
+	if doc != want {
+		t.Errorf("got\n%s\nwant\n%s", doc, want)
+	}
+	if policies[0].Spec["rules"].([]interface{})[0].(map[string]interface{})["from"] == nil {
+		t.Error("scalePolicy changed the imported policy")
+	}
+}
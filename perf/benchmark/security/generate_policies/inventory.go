@@ -0,0 +1,156 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+// Inventory summarizes the security policies of a cluster.
+type Inventory struct {
+	GenerationStats
+	// Namespaces are the policies and rules of every namespace.
+	Namespaces map[string]*NamespaceInventory `json:"namespaces"`
+	// ConditionKeys counts the uses of the condition keys of the AuthorizationPolicies.
+	ConditionKeys map[string]fieldCoverage `json:"conditionKeys,omitempty"`
+}
+
+// NamespaceInventory is the share of a namespace of an Inventory.
+type NamespaceInventory struct {
+	Policies map[string]int `json:"policies"`
+	Rules    int            `json:"rules"`
+	Bytes    int            `json:"bytes"`
+}
+
+func (n *NamespaceInventory) total() int {
+	total := 0
+	for _, count := range n.Policies {
+		total += count
+	}
+	return total
+}
+
+// takeInventory returns the inventory of policies. Their size is the one of their YAML without
+// the metadata added by the API server, such as managedFields.
+func takeInventory(policies []policyObject) (*Inventory, error) {
+	docs := make([]string, 0, len(policies))
+	inventory := &Inventory{Namespaces: map[string]*NamespaceInventory{}}
+	for _, p := range policies {
+		doc, err := policyObjectYAML(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", p, err)
+		}
+		docs = append(docs, doc)
+		ns, ok := inventory.Namespaces[p.Namespace]
+		if !ok {
+			ns = &NamespaceInventory{Policies: map[string]int{}}
+			inventory.Namespaces[p.Namespace] = ns
+		}
+		ns.Policies[p.Kind]++
+		ns.Bytes += len(doc)
+		if p.Kind == "AuthorizationPolicy" {
+			ns.Rules += countValues(p.Spec["rules"])
+		}
+	}
+	stats, err := generationStats(docs)
+	if err != nil {
+		return nil, err
+	}
+	inventory.GenerationStats = *stats
+	coverage, err := policyCoverage(docs)
+	if err != nil {
+		return nil, err
+	}
+	inventory.ConditionKeys = coverage["AuthorizationPolicy"].ConditionKeys
+	return inventory, nil
+}
+
+// print writes the inventory to w, with the top namespaces by number of policies.
+func (inv *Inventory) print(w io.Writer, top int) error {
+	if err := inv.GenerationStats.print(w); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(inv.Namespaces))
+	for name := range inv.Namespaces {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ni, nj := inv.Namespaces[names[i]].total(), inv.Namespaces[names[j]].total()
+		if ni != nj {
+			return ni > nj
+		}
+		return names[i] < names[j]
+	})
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "\nNAMESPACE\tAUTHZ\tPEERAUTHN\tREQUESTAUTHN\tRULES\tBYTES\n")
+	for i, name := range names {
+		if i == top {
+			fmt.Fprintf(tw, "... %d more namespaces\t\t\t\t\t\n", len(names)-top)
+			break
+		}
+		ns := inv.Namespaces[name]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\n", name, ns.Policies["AuthorizationPolicy"], ns.Policies["PeerAuthentication"],
+			ns.Policies["RequestAuthentication"], ns.Rules, ns.Bytes)
+	}
+	if len(inv.ConditionKeys) > 0 {
+		fmt.Fprintf(tw, "\nCONDITION KEY\tPOLICIES\tVALUES\n")
+		for _, key := range sortedKeys(inv.ConditionKeys) {
+			c := inv.ConditionKeys[key]
+			fmt.Fprintf(tw, "%s\t%d\t%d\n", key, c.Policies, c.Values)
+		}
+	}
+	return tw.Flush()
+}
+
+func runInventory(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("inventory", flag.ExitOnError)
+	dir := fs.String("dir", "", "A YAML file or a directory of YAML files, e.g. the output of kubectl get -o yaml, to summarize instead of the policies of the cluster")
+	format := fs.String("format", "text", "The output format: text or json")
+	top := fs.Int("top", 20, "The number of namespaces listed in the text output, by number of policies")
+	_ = fs.Parse(args)
+
+	policies, err := importPolicies(ctx, *dir)
+	if err != nil {
+		return err
+	}
+	inventory, err := takeInventory(policies)
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "json":
+		out, err := json.MarshalIndent(inventory, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	case "text":
+		if len(policies) == 0 {
+			fmt.Println("no AuthorizationPolicy, PeerAuthentication or RequestAuthentication found")
+			return nil
+		}
+		return inventory.print(os.Stdout, *top)
+	default:
+		return fmt.Errorf("unknown format %q, must be text or json", *format)
+	}
+}
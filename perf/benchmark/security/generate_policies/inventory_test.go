@@ -0,0 +1,90 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTakeInventory(t *testing.T) {
+	policies, err := parsePolicyObjects([]string{`
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: allow
+  namespace: prod
+  managedFields:
+  - manager: kubectl
+spec:
+  rules:
+  - from:
+    - source:
+        principals: ["cluster.local/ns/prod/sa/api", "cluster.local/ns/prod/sa/web"]
+  - when:
+    - key: request.headers[x-tenant]
+      values: ["a"]
+`, `
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: default
+  namespace: prod
+spec:
+  mtls:
+    mode: STRICT
+`, `
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: deny
+  namespace: staging
+spec:
+  action: DENY
+  rules:
+  - to:
+    - operation:
+        paths: ["/admin"]
+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inventory, err := takeInventory(policies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inventory.Resources != 3 || inventory.Rules != 3 {
+		t.Errorf("got %d resources and %d rules, want 3 and 3", inventory.Resources, inventory.Rules)
+	}
+	if got := inventory.Values["rules.from.source.principals"]; got != 2 {
+		t.Errorf("got %d principals, want 2", got)
+	}
+	prod := inventory.Namespaces["prod"]
+	if prod == nil || prod.Policies["AuthorizationPolicy"] != 1 || prod.Policies["PeerAuthentication"] != 1 || prod.Rules != 2 {
+		t.Errorf("prod = %+v, want 1 AuthorizationPolicy, 1 PeerAuthentication and 2 rules", prod)
+	}
+	if got := inventory.ConditionKeys["request.headers[x-tenant]"].Policies; got != 1 {
+		t.Errorf("got %d policies with request.headers[x-tenant], want 1", got)
+	}
+
+	var out bytes.Buffer
+	if err := inventory.print(&out, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "... 1 more namespaces") || strings.Contains(out.String(), "managedFields") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
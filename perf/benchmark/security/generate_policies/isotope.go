@@ -0,0 +1,365 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	authzpb "istio.io/api/security/v1beta1"
+	typepb "istio.io/api/type/v1beta1"
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// isotopeNamespace is the namespace of the services of the isotope converter.
+const isotopeNamespace = "service-graph"
+
+// isotopeGraph is the part of an isotope MockServiceGraph declaring its call edges.
+type isotopeGraph struct {
+	Defaults struct {
+		Script []json.RawMessage `json:"script"`
+	} `json:"defaults"`
+	Services []struct {
+		Name         string             `json:"name"`
+		IsEntrypoint bool               `json:"isEntrypoint"`
+		Script       *[]json.RawMessage `json:"script"`
+	} `json:"services"`
+}
+
+// isotopeService is a service of the graph with the services calling it.
+type isotopeService struct {
+	name       string
+	entrypoint bool
+	callers    []string
+}
+
+// isotopeCalls returns the services called by a step of a script, a command or a list of
+// commands run concurrently.
+func isotopeCalls(step json.RawMessage) ([]string, error) {
+	commands := []json.RawMessage{step}
+	if bytes.HasPrefix(bytes.TrimSpace(step), []byte("[")) {
+		if err := json.Unmarshal(step, &commands); err != nil {
+			return nil, err
+		}
+	}
+	var calls []string
+	for _, c := range commands {
+		var command struct {
+			Call json.RawMessage `json:"call"`
+		}
+		if err := json.Unmarshal(c, &command); err != nil {
+			return nil, err
+		}
+		if len(command.Call) == 0 {
+			continue
+		}
+		var service string
+		if err := json.Unmarshal(command.Call, &service); err != nil {
+			var request struct {
+				Service string `json:"service"`
+			}
+			if err := json.Unmarshal(command.Call, &request); err != nil {
+				return nil, err
+			}
+			service = request.Service
+		}
+		calls = append(calls, service)
+	}
+	return calls, nil
+}
+
+// parseIsotopeGraph returns the services of an isotope service graph, in their order, with their
+// callers sorted.
+func parseIsotopeGraph(data []byte) ([]isotopeService, error) {
+	var g isotopeGraph
+	if err := yaml.Unmarshal(data, &g); err != nil {
+		return nil, err
+	}
+	if len(g.Services) == 0 {
+		return nil, fmt.Errorf("the service graph has no services")
+	}
+	services := make([]isotopeService, len(g.Services))
+	index := map[string]int{}
+	for i, s := range g.Services {
+		if _, ok := index[s.Name]; ok || s.Name == "" {
+			return nil, fmt.Errorf("invalid or duplicate service name %q", s.Name)
+		}
+		index[s.Name] = i
+		services[i] = isotopeService{name: s.Name, entrypoint: s.IsEntrypoint}
+	}
+	callers := make([]map[string]bool, len(services))
+	for i := range callers {
+		callers[i] = map[string]bool{}
+	}
+	for _, s := range g.Services {
+		script := g.Defaults.Script
+		if s.Script != nil {
+			script = *s.Script
+		}
+		for _, step := range script {
+			calls, err := isotopeCalls(step)
+			if err != nil {
+				return nil, fmt.Errorf("script of %s: %v", s.Name, err)
+			}
+			for _, call := range calls {
+				callee, ok := index[call]
+				if !ok {
+					return nil, fmt.Errorf("%s calls the undefined service %q", s.Name, call)
+				}
+				callers[callee][s.Name] = true
+			}
+		}
+	}
+	for i := range services {
+		for caller := range callers[i] {
+			services[i].callers = append(services[i].callers, caller)
+		}
+		sort.Strings(services[i].callers)
+	}
+	return services, nil
+}
+
+// isotopePolicies returns an ALLOW policy per service, on the pods of the isotope converter labeled
+// with its name, allowing the service accounts of its callers and, for the entrypoints, of
+// entrypointPrincipals. A service without callers allows nothing.
+func isotopePolicies(services []isotopeService, namespace, trustDomain string, entrypointPrincipals []string) ([]string, error) {
+	var docs []string
+	for _, s := range services {
+		var principals []string
+		for _, caller := range s.callers {
+			principals = append(principals, fmt.Sprintf("%s/ns/%s/sa/%s", trustDomain, namespace, caller))
+		}
+		if s.entrypoint {
+			principals = append(principals, entrypointPrincipals...)
+		}
+		spec := &authzpb.AuthorizationPolicy{
+			Selector: &typepb.WorkloadSelector{MatchLabels: map[string]string{"name": s.name}},
+			Action:   authzpb.AuthorizationPolicy_ALLOW,
+		}
+		if len(principals) > 0 {
+			spec.Rules = []*authzpb.Rule{{From: []*authzpb.Rule_From{{Source: &authzpb.Source{Principals: principals}}}}}
+		}
+		header := &generatepolicies.MyPolicy{
+			APIVersion: "security.istio.io/v1beta1",
+			Kind:       "AuthorizationPolicy",
+			Metadata:   generatepolicies.MetadataStruct{Namespace: namespace, Name: "isotope-" + s.name},
+		}
+		doc, err := generatepolicies.PolicyToYAML(header, spec)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// isotopeServiceAccounts returns the service accounts of the services and of the client, which
+// the policies identify the callers by.
+func isotopeServiceAccounts(services []isotopeService, namespace string, extra ...string) ([]string, error) {
+	names := extra
+	for _, s := range services {
+		names = append(names, s.name)
+	}
+	var docs []string
+	for _, name := range names {
+		doc, err := yaml.Marshal(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ServiceAccount",
+			"metadata":   map[string]string{"name": name, "namespace": namespace},
+		})
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, string(doc))
+	}
+	return docs, nil
+}
+
+// maxIsotopePaths bounds the number of candidate paths walked in large service graphs.
+const maxIsotopePaths = 10000
+
+// IsotopeTrafficPlan is the traffic of a benchmark of a service graph with isotopePolicies applied.
+type IsotopeTrafficPlan struct {
+	Namespace string `json:"namespace"`
+	// DenyRate is the share of the paths expected to be denied.
+	DenyRate float64       `json:"denyRate,omitempty"`
+	Paths    []TrafficPath `json:"paths"`
+}
+
+// TrafficPath is a chain of calls from the client through the graph. A denied path ends with the
+// call expected to be denied.
+type TrafficPath struct {
+	Hops   []TrafficHop `json:"hops"`
+	Expect string       `json:"expect"`
+}
+
+// TrafficHop is a call of a service by the service account From.
+type TrafficHop struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Expect string `json:"expect"`
+}
+
+// isotopePaths returns the paths of at most maxHops calls the policies are expected to allow, the
+// calls declared by the graph starting from client, and to deny, an allowed path followed by a call
+// of a service not allowing the last caller. maxHops 0 walks until the services calling no one.
+// Paths do not visit a service twice.
+func isotopePaths(services []isotopeService, client string, maxHops int) ([]TrafficPath, []TrafficPath) {
+	allowedBy := map[string]map[string]bool{}
+	callees := map[string][]string{}
+	for _, s := range services {
+		allowedBy[s.name] = map[string]bool{}
+		for _, caller := range s.callers {
+			allowedBy[s.name][caller] = true
+			callees[caller] = append(callees[caller], s.name)
+		}
+		if s.entrypoint {
+			allowedBy[s.name][client] = true
+			callees[client] = append(callees[client], s.name)
+		}
+	}
+	for caller := range callees {
+		sort.Strings(callees[caller])
+	}
+
+	var allowed, denied []TrafficPath
+	var walk func(hops []TrafficHop, visited map[string]bool)
+	walk = func(hops []TrafficHop, visited map[string]bool) {
+		from := client
+		if len(hops) > 0 {
+			from = hops[len(hops)-1].To
+			allowed = append(allowed, TrafficPath{Hops: append([]TrafficHop(nil), hops...), Expect: expectAllow})
+		}
+		if maxHops > 0 && len(hops) == maxHops {
+			return
+		}
+		for _, s := range services {
+			if len(denied) < maxIsotopePaths && !allowedBy[s.name][from] && !visited[s.name] && s.name != from {
+				path := append(append([]TrafficHop(nil), hops...), TrafficHop{From: from, To: s.name, Expect: expectDeny})
+				denied = append(denied, TrafficPath{Hops: path, Expect: expectDeny})
+			}
+		}
+		for _, to := range callees[from] {
+			if visited[to] || len(allowed) >= maxIsotopePaths {
+				continue
+			}
+			visited[to] = true
+			walk(append(hops, TrafficHop{From: from, To: to, Expect: expectAllow}), visited)
+			delete(visited, to)
+		}
+	}
+	walk(nil, map[string]bool{})
+	return allowed, denied
+}
+
+// isotopeTrafficPlan returns numPaths paths spread over the allowed and denied paths of the graph,
+// a share of denyRate of them expected to be denied.
+func isotopeTrafficPlan(services []isotopeService, namespace, client string, numPaths, maxHops int, denyRate float64) (*IsotopeTrafficPlan, error) {
+	if err := validateDenyRate(denyRate); err != nil {
+		return nil, err
+	}
+	allowed, denied := isotopePaths(services, client, maxHops)
+	numDenied := int(math.Round(float64(numPaths) * denyRate))
+	plan := &IsotopeTrafficPlan{Namespace: namespace, DenyRate: denyRate}
+	for _, c := range []struct {
+		candidates []TrafficPath
+		n          int
+		expect     string
+	}{{allowed, numPaths - numDenied, expectAllow}, {denied, numDenied, expectDeny}} {
+		if c.n > 0 && len(c.candidates) == 0 {
+			return nil, fmt.Errorf("the service graph has no paths to %s", c.expect)
+		}
+		for i := 0; i < c.n; i++ {
+			plan.Paths = append(plan.Paths, c.candidates[i*len(c.candidates)/c.n])
+		}
+	}
+	return plan, nil
+}
+
+func runIsotope(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("isotope", flag.ExitOnError)
+	graphFile := fs.String("graph", "", "The isotope service graph YAML file")
+	namespace := fs.String("namespace", isotopeNamespace, "The namespace of the services of the graph")
+	trustDomain := fs.String("trustDomain", "cluster.local", "The trust domain of the principals of the callers")
+	client := fs.String("client", "client", "The service account of the client calling the entrypoints")
+	entrypointPrincipals := fs.String("entrypointPrincipals", "",
+		"Comma separated principals also allowed to call the entrypoints, e.g. the ingress gateway cluster.local/ns/istio-system/sa/istio-ingressgateway-service-account")
+	serviceAccounts := fs.Bool("serviceAccounts", true, "Also write a service account per service and for the client, which the pods of the graph must run as")
+	trafficFile := fs.String("trafficFile", "", "If set, write a traffic plan of paths of calls through the graph to this json file")
+	numPaths := fs.Int("paths", 10, "The number of paths of the traffic plan")
+	denyRate := fs.Float64("denyRate", 0, "The share of the paths of the traffic plan expected to be denied, between 0 and 1")
+	maxHops := fs.Int("maxHops", 0, "The maximum number of calls of a path of the traffic plan, 0 for no limit")
+	_ = fs.Parse(args)
+
+	if *graphFile == "" {
+		return fmt.Errorf("-graph is required")
+	}
+	data, err := ioutil.ReadFile(*graphFile)
+	if err != nil {
+		return err
+	}
+	services, err := parseIsotopeGraph(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", *graphFile, err)
+	}
+	var entrypoints []string
+	if *client != "" {
+		entrypoints = append(entrypoints, fmt.Sprintf("%s/ns/%s/sa/%s", *trustDomain, *namespace, *client))
+	}
+	if *entrypointPrincipals != "" {
+		entrypoints = append(entrypoints, strings.Split(*entrypointPrincipals, ",")...)
+	}
+	docs, err := isotopePolicies(services, *namespace, *trustDomain, entrypoints)
+	if err != nil {
+		return err
+	}
+	if *trafficFile != "" {
+		plan, err := isotopeTrafficPlan(services, *namespace, *client, *numPaths, *maxHops, *denyRate)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(*trafficFile, data, 0644); err != nil {
+			return err
+		}
+	}
+	if *serviceAccounts {
+		var extra []string
+		if *client != "" {
+			extra = append(extra, *client)
+		}
+		accounts, err := isotopeServiceAccounts(services, *namespace, extra...)
+		if err != nil {
+			return err
+		}
+		docs = append(accounts, docs...)
+	}
+	for _, doc := range docs {
+		fmt.Println(doc + "---")
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const isotopeTestGraph = `
+defaults:
+  script:
+  - sleep: 10ms
+services:
+- name: a
+  isEntrypoint: true
+  script:
+  - call: b
+  - - call: c
+    - call:
+        service: d
+- name: b
+  script:
+  - call: d
+- name: c
+- name: d
+`
+
+func TestParseIsotopeGraph(t *testing.T) {
+	services, err := parseIsotopeGraph([]byte(isotopeTestGraph))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []isotopeService{
+		{name: "a", entrypoint: true},
+		{name: "b", callers: []string{"a"}},
+		{name: "c", callers: []string{"a"}},
+		{name: "d", callers: []string{"a", "b"}},
+	}
+	if !reflect.DeepEqual(services, want) {
+		t.Errorf("got %+v, want %+v", services, want)
+	}
+
+	if _, err := parseIsotopeGraph([]byte("services:\n- name: a\n  script:\n  - call: x\n")); err == nil {
+		t.Error("expected an error calling an undefined service")
+	}
+}
+
+func TestIsotopePolicies(t *testing.T) {
+	services, err := parseIsotopeGraph([]byte(isotopeTestGraph))
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs, err := isotopePolicies(services, isotopeNamespace, "cluster.local", []string{"cluster.local/ns/service-graph/sa/client"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policies, err := parsePolicyObjects(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != len(services) {
+		t.Fatalf("got %d policies, want %d", len(policies), len(services))
+	}
+	if !strings.Contains(docs[0], "cluster.local/ns/service-graph/sa/client") {
+		t.Errorf("the entrypoint does not allow the client:\n%s", docs[0])
+	}
+	if !strings.Contains(docs[3], "sa/a\n") || !strings.Contains(docs[3], "sa/b\n") || strings.Contains(docs[3], "sa/c\n") {
+		t.Errorf("d does not allow exactly its callers a and b:\n%s", docs[3])
+	}
+	if strings.Contains(docs[1], "sa/client") {
+		t.Errorf("b, not an entrypoint, allows the client:\n%s", docs[1])
+	}
+}
+
+func TestIsotopeTrafficPlan(t *testing.T) {
+	services, err := parseIsotopeGraph([]byte(isotopeTestGraph))
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed, denied := isotopePaths(services, "client", 2)
+	// client>a, client>a>b, client>a>c, client>a>d.
+	if len(allowed) != 4 {
+		t.Errorf("got %d allowed paths, want 4: %+v", len(allowed), allowed)
+	}
+	for _, p := range denied {
+		if len(p.Hops) > 2 {
+			t.Errorf("denied path %+v has more than 2 hops", p)
+		}
+		last := p.Hops[len(p.Hops)-1]
+		if last.Expect != expectDeny {
+			t.Errorf("denied path %+v does not end with a denied call", p)
+		}
+		for _, h := range p.Hops[:len(p.Hops)-1] {
+			if h.Expect != expectAllow {
+				t.Errorf("denied path %+v has a denied call before its last", p)
+			}
+		}
+		if last.From == "b" && last.To == "d" || last.From == "client" && last.To == "a" {
+			t.Errorf("denied path %+v ends with an allowed call", p)
+		}
+	}
+
+	plan, err := isotopeTrafficPlan(services, isotopeNamespace, "client", 10, 0, 0.3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numDenied := 0
+	for _, p := range plan.Paths {
+		if p.Expect == expectDeny {
+			numDenied++
+		}
+	}
+	if len(plan.Paths) != 10 || numDenied != 3 {
+		t.Errorf("got %d paths, %d of them denied, want 10 and 3", len(plan.Paths), numDenied)
+	}
+}
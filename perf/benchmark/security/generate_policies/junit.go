@@ -0,0 +1,206 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// resultThreshold bounds a result of a run, a column of the exported results.
+type resultThreshold struct {
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+// readThresholds reads a JSON object of thresholds by result column, e.g.
+// {"latency_p99_ms": {"max": 5}, "load_qps": {"min": 900}}.
+func readThresholds(file string) (map[string]resultThreshold, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	thresholds := map[string]resultThreshold{}
+	if err := json.Unmarshal(data, &thresholds); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	columns := map[string]bool{}
+	for _, c := range resultColumns {
+		columns[c.Name] = true
+	}
+	for name := range thresholds {
+		if !columns[name] {
+			return nil, fmt.Errorf("%s: unknown result %q", file, name)
+		}
+	}
+	return thresholds, nil
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     float64         `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// junitSuite returns the test cases of a run: its errors, thresholds, regressions against its
+// baseline, and the validation of the decisions of its load and probes.
+func junitSuite(file string, report *RunReport, thresholds map[string]resultThreshold, comparison *githubRun) (junitTestSuite, error) {
+	className := report.Command
+	if report.ConfigFile != "" {
+		className += "." + strings.TrimSuffix(report.ConfigFile, ".json")
+	}
+	suite := junitTestSuite{Name: file, Time: report.EndTime.Sub(report.StartTime).Seconds()}
+	add := func(name string, failure string, details ...string) {
+		c := junitTestCase{Name: name, ClassName: className}
+		if failure != "" {
+			c.Failure = &junitFailure{Message: failure, Text: strings.Join(details, "\n")}
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	failure := ""
+	if len(report.Errors) > 0 {
+		failure = fmt.Sprintf("%d errors", len(report.Errors))
+	} else if report.Interrupted {
+		failure = "interrupted"
+	}
+	add("run", failure, report.Errors...)
+
+	row, err := resultRow(report, nil)
+	if err != nil {
+		return suite, err
+	}
+	names := make([]string, 0, len(thresholds))
+	for name := range thresholds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var value float64
+		ok := true
+		switch v := row[name].(type) {
+		case float64:
+			value = v
+		case int:
+			value = float64(v)
+		case bool:
+			if v {
+				value = 1
+			}
+		default:
+			ok = false
+		}
+		if !ok {
+			suite.Cases = append(suite.Cases, junitTestCase{Name: "threshold " + name, ClassName: className,
+				Skipped: &junitSkipped{Message: "the run has no " + name}})
+			suite.Skipped++
+			continue
+		}
+		failure := ""
+		if t := thresholds[name]; t.Max != nil && value > *t.Max {
+			failure = fmt.Sprintf("%s is %g, above the maximum %g", name, value, *t.Max)
+		} else if t.Min != nil && value < *t.Min {
+			failure = fmt.Sprintf("%s is %g, below the minimum %g", name, value, *t.Min)
+		}
+		add("threshold "+name, failure)
+	}
+
+	if comparison != nil && comparison.Baseline != "" {
+		for _, r := range comparison.Rows {
+			failure := ""
+			if r.Regression {
+				failure = fmt.Sprintf("%s regressed by %s: %s against %s in %s", r.Metric, r.Delta, r.Current, r.Baseline, comparison.Baseline)
+			}
+			add("regression "+r.Metric, failure)
+		}
+	}
+
+	if l := report.Load; l != nil {
+		failure := ""
+		if l.UnexpectedDecisions > 0 {
+			failure = fmt.Sprintf("%d of %d responses did not match the expected decision", l.UnexpectedDecisions, l.Requests)
+		}
+		add("load decisions", failure)
+	}
+	probes := func(kind string, results []ProbeResult) {
+		for _, p := range results {
+			failure := ""
+			if !p.Matched {
+				failure = fmt.Sprintf("expected %s, got %d (%s)", p.Expect, p.Status, p.Outcome)
+			}
+			add(fmt.Sprintf("%s %s %s%s", kind, p.Method, p.Host, p.Path), failure)
+		}
+	}
+	if e := report.E2E; e != nil {
+		probes("e2e", e.Probes)
+	}
+	if r := report.Readiness; r != nil {
+		failure := ""
+		if !r.Ready {
+			failure = fmt.Sprintf("corpus %s not enforced after %d attempts", r.Generation, r.Attempts)
+		}
+		add("readiness", failure)
+		probes("readiness", r.Probes)
+	}
+	suite.Tests = len(suite.Cases)
+	return suite, nil
+}
+
+// writeJUnit writes the suites as JUnit XML.
+func writeJUnit(w io.Writer, suites []junitTestSuite) error {
+	all := junitTestSuites{Suites: suites}
+	for _, s := range suites {
+		all.Tests += s.Tests
+		all.Failures += s.Failures
+	}
+	out, err := xml.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, out)
+	return err
+}
@@ -0,0 +1,89 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestJUnitSuite(t *testing.T) {
+	max, min := 3.0, 90.0
+	thresholds := map[string]resultThreshold{
+		"latency_p99_ms": {Max: &max},
+		"load_qps":       {Min: &min},
+		"e2e_passed":     {Min: &min},
+	}
+	baseline := &RunReport{Command: "bench", Load: &LoadResult{ActualQPS: 100, Latency: LatencySummary{P99: 3}}}
+	report := &RunReport{
+		Command:    "bench",
+		ConfigFile: "large.json",
+		Load:       &LoadResult{Requests: 1000, ActualQPS: 95, Latency: LatencySummary{P99: 3.6}, UnexpectedDecisions: 2},
+	}
+	run, err := compareRuns("report.json", report, "main.json", baseline, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	suite, err := junitSuite("report.json", report, thresholds, &run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := map[string]string{}
+	for _, c := range suite.Cases {
+		if c.ClassName != "bench.large" {
+			t.Errorf("got class %q, want bench.large", c.ClassName)
+		}
+		switch {
+		case c.Failure != nil:
+			results[c.Name] = "failed"
+		case c.Skipped != nil:
+			results[c.Name] = "skipped"
+		default:
+			results[c.Name] = "passed"
+		}
+	}
+	want := map[string]string{
+		"run":                      "passed",
+		"threshold e2e_passed":     "skipped",
+		"threshold latency_p99_ms": "failed",
+		"threshold load_qps":       "passed",
+		"load decisions":           "failed",
+	}
+	for name, result := range want {
+		if results[name] != result {
+			t.Errorf("%s: got %q, want %q", name, results[name], result)
+		}
+	}
+	if results["regression Latency p99 (ms)"] != "failed" {
+		t.Errorf("got %v, want a failed p99 regression", results)
+	}
+	if suite.Tests != len(suite.Cases) || suite.Skipped != 1 || suite.Failures != 3 {
+		t.Errorf("got %d tests, %d failures, %d skipped", suite.Tests, suite.Failures, suite.Skipped)
+	}
+
+	var out bytes.Buffer
+	if err := writeJUnit(&out, []junitTestSuite{suite}); err != nil {
+		t.Fatal(err)
+	}
+	var parsed junitTestSuites
+	if err := xml.Unmarshal(out.Bytes(), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Failures != 3 || len(parsed.Suites) != 1 || !strings.HasPrefix(out.String(), xml.Header) {
+		t.Errorf("got\n%s", out.String())
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"text/template"
+
+	"sigs.k8s.io/yaml"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// jwksPath is the path the jwks server is expected to be queried on.
+const jwksPath = "/jwks.json"
+
+var jwksServerTemplate = template.Must(template.New("jwks").Parse(`apiVersion: v1
+kind: Service
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+spec:
+  selector:
+    app: {{.Name}}
+  ports:
+  - name: http
+    port: {{.Port}}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: {{.Name}}
+  template:
+    metadata:
+      labels:
+        app: {{.Name}}
+      annotations:
+        sidecar.istio.io/inject: "false"
+    spec:
+      containers:
+      - name: jwks
+        image: {{.Image}}
+        args: ["jwks", "serve", "-port={{.Port}}", "-jwksFile=/etc/jwks/jwks.json"]
+        ports:
+        - containerPort: {{.Port}}
+        volumeMounts:
+        - name: jwks
+          mountPath: /etc/jwks
+      volumes:
+      - name: jwks
+        configMap:
+          name: {{.Name}}
+`))
+
+type jwksServer struct {
+	Name      string
+	Namespace string
+	Image     string
+	Port      int
+}
+
+func (s jwksServer) uri() string {
+	return fmt.Sprintf("http://%s.%s.svc.cluster.local:%d%s", s.Name, s.Namespace, s.Port, jwksPath)
+}
+
+func runJwks(ctx context.Context, args []string) error {
+	commands := map[string]func(ctx context.Context, args []string) error{
+		"serve":    runJwksServe,
+		"generate": runJwksGenerate,
+	}
+	if len(args) == 0 || commands[args[0]] == nil {
+		return fmt.Errorf("usage: jwks <serve|generate> [flags]")
+	}
+	return commands[args[0]](ctx, args[1:])
+}
+
+func jwksFromKeyFile(keyFile string) (string, error) {
+	privateKey, err := generatepolicies.SigningKey(keyFile)
+	if err != nil {
+		return "", err
+	}
+	return generatepolicies.GenerateJwks(privateKey)
+}
+
+func runJwksServe(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("jwks serve", flag.ExitOnError)
+	port := fs.Int("port", 8000, "The port to serve the JWKS on")
+	keyFile := fs.String("keyFile", "", "The PEM file of the signing key, created if it does not exist")
+	jwksFile := fs.String("jwksFile", "", "A file with the JWKS to serve, instead of deriving it from keyFile")
+	_ = fs.Parse(args)
+
+	var jwks []byte
+	switch {
+	case *jwksFile != "":
+		data, err := ioutil.ReadFile(*jwksFile)
+		if err != nil {
+			return err
+		}
+		jwks = data
+	case *keyFile != "":
+		data, err := jwksFromKeyFile(*keyFile)
+		if err != nil {
+			return err
+		}
+		jwks = []byte(data)
+	default:
+		return fmt.Errorf("either keyFile or jwksFile is required")
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(jwks)
+	})
+	log.Printf("serving JWKS on :%d%s", *port, jwksPath)
+	return serveHTTP(ctx, fmt.Sprintf(":%d", *port), handler)
+}
+
+func runJwksGenerate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("jwks generate", flag.ExitOnError)
+	keyFile := fs.String("keyFile", "", "The PEM file of the signing key, created if it does not exist")
+	name := fs.String("name", "jwks", "The name of the JWKS server")
+	namespace := fs.String("namespace", "twopods-istio", "The namespace of the JWKS server")
+	image := fs.String("image", "generate-policies:latest", "The image of this tool, used to run the JWKS server")
+	port := fs.Int("port", 8000, "The port of the JWKS server")
+	_ = fs.Parse(args)
+
+	if *keyFile == "" {
+		return fmt.Errorf("keyFile is required so that the generated policies can use the same key")
+	}
+	jwks, err := jwksFromKeyFile(*keyFile)
+	if err != nil {
+		return err
+	}
+	server := jwksServer{Name: *name, Namespace: *namespace, Image: *image, Port: *port}
+	configMap, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   generatepolicies.MetadataStruct{Name: server.Name, Namespace: server.Namespace},
+		"data":       map[string]string{"jwks.json": jwks},
+	})
+	if err != nil {
+		return err
+	}
+	var manifest bytes.Buffer
+	manifest.Write(configMap)
+	manifest.WriteString("---\n")
+	if err := jwksServerTemplate.Execute(&manifest, server); err != nil {
+		return err
+	}
+	fmt.Print(manifest.String())
+	fmt.Fprintf(os.Stderr, "set requestAuthN.keyFile to %s and requestAuthN.jwksUri to %s\n", *keyFile, server.uri())
+	return nil
+}
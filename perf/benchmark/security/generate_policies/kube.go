@@ -0,0 +1,109 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// kubectl runs kubectl with args, feeding it stdin if not nil, and returns its stdout. kubectl is
+// killed when ctx is cancelled.
+func kubectl(ctx context.Context, stdin io.Reader, args ...string) ([]byte, error) {
+	return command(ctx, stdin, "kubectl", args...)
+}
+
+// command runs the program name like kubectl, e.g. kind or istioctl.
+func command(ctx context.Context, stdin io.Reader, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = stdin
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.Bytes(), fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// kubectlApply applies the given YAML documents in a single kubectl invocation.
+func kubectlApply(ctx context.Context, docs []string) error {
+	_, err := kubectl(ctx, strings.NewReader(strings.Join(docs, "---\n")), "apply", "-f", "-")
+	return err
+}
+
+// firstPod returns the name of the first pod in namespace matching the label selector.
+func firstPod(ctx context.Context, namespace, selector string) (string, error) {
+	out, err := kubectl(ctx, nil, "-n", namespace, "get", "pods", "-l", selector, "-o", "jsonpath={.items[0].metadata.name}")
+	if err != nil {
+		return "", err
+	}
+	pod := strings.TrimSpace(string(out))
+	if pod == "" {
+		return "", fmt.Errorf("no pod matching %q in namespace %s", selector, namespace)
+	}
+	return pod, nil
+}
+
+var forwardingRegexp = regexp.MustCompile(`Forwarding from (127\.0\.0\.1:\d+)`)
+
+// portForward forwards a random local port to remotePort of the pod and returns the local
+// address together with a function that stops the forwarding.
+func portForward(ctx context.Context, namespace, pod string, remotePort int) (string, func(), error) {
+	cmd := exec.CommandContext(ctx, "kubectl", "-n", namespace, "port-forward", pod, fmt.Sprintf(":%d", remotePort))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", nil, err
+	}
+	stop := func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}
+
+	addr := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if m := forwardingRegexp.FindStringSubmatch(scanner.Text()); m != nil {
+				addr <- m[1]
+				break
+			}
+		}
+		// Keep draining so kubectl never blocks on a full pipe.
+		_, _ = io.Copy(ioutil.Discard, stdout)
+	}()
+
+	select {
+	case a := <-addr:
+		return a, stop, nil
+	case <-time.After(30 * time.Second):
+		stop()
+		return "", nil, fmt.Errorf("timed out port-forwarding to %s/%s:%d", namespace, pod, remotePort)
+	case <-ctx.Done():
+		stop()
+		return "", nil, ctx.Err()
+	}
+}
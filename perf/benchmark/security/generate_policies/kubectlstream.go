@@ -0,0 +1,113 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// generationAnnotation is a hash of the whole generated stream, identifying the objects
+	// applied by the same generation.
+	generationAnnotation = "generate-policies.istio.io/generation"
+	// batchAnnotation is the index of the batch of the object in the stream, starting from 1.
+	batchAnnotation = "generate-policies.istio.io/batch"
+)
+
+// annotate returns doc with annotations added to its metadata.
+func annotate(doc string, annotations map[string]string) (string, error) {
+	object := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(doc), &object); err != nil {
+		return "", err
+	}
+	metadata, ok := object["metadata"].(map[string]interface{})
+	if !ok {
+		metadata = map[string]interface{}{}
+		object["metadata"] = metadata
+	}
+	existing, ok := metadata["annotations"].(map[string]interface{})
+	if !ok {
+		existing = map[string]interface{}{}
+		metadata["annotations"] = existing
+	}
+	for k, v := range annotations {
+		existing[k] = v
+	}
+	out, err := yaml.Marshal(object)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// generationHash returns a short hash of docs.
+func generationHash(docs []string) string {
+	h := sha256.New()
+	for _, doc := range docs {
+		_, _ = io.WriteString(h, doc+"---\n")
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// writeKubectlStream writes docs to w as Lists of batchSize objects for kubectl apply
+// --server-side -f -. Every object is annotated with the generation of docs and its batch, so
+// that the objects of an interrupted or partial apply can be found, and the stream starts with the
+// kubectl command applying it with fieldManager.
+func writeKubectlStream(w io.Writer, docs []string, batchSize int, fieldManager string) error {
+	if batchSize <= 0 {
+		return fmt.Errorf("invalid batchSize: %d", batchSize)
+	}
+	generation := generationHash(docs)
+	numBatches := (len(docs) + batchSize - 1) / batchSize
+	if _, err := fmt.Fprintf(w, "# kubectl apply --server-side --field-manager=%s -f -\n# generation %s: %d objects in %d batches\n",
+		fieldManager, generation, len(docs), numBatches); err != nil {
+		return err
+	}
+	for batch := 0; batch < numBatches; batch++ {
+		end := (batch + 1) * batchSize
+		if end > len(docs) {
+			end = len(docs)
+		}
+		items := make([]interface{}, 0, end-batch*batchSize)
+		for _, doc := range docs[batch*batchSize : end] {
+			annotated, err := annotate(doc, map[string]string{
+				generationAnnotation: generation,
+				batchAnnotation:      fmt.Sprint(batch + 1),
+			})
+			if err != nil {
+				return err
+			}
+			var item interface{}
+			if err := yaml.Unmarshal([]byte(annotated), &item); err != nil {
+				return err
+			}
+			items = append(items, item)
+		}
+		list, err := yaml.Marshal(map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": items})
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "---\n# batch %d of %d\n%s", batch+1, numBatches, strings.TrimSuffix(string(list), "\n")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestKubectlStream(t *testing.T) {
+	var docs []string
+	for i := 1; i <= 5; i++ {
+		docs = append(docs, fmt.Sprintf("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: ns-%d\n", i))
+	}
+	var buf bytes.Buffer
+	if err := writeKubectlStream(&buf, docs, 2, "bench"); err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(buf.String(), "---\n")
+	if !strings.Contains(parts[0], "--field-manager=bench") {
+		t.Errorf("the stream does not start with the kubectl command:\n%s", parts[0])
+	}
+	lists := parts[1:]
+	if len(lists) != 3 {
+		t.Fatalf("got %d batches, want 3:\n%s", len(lists), buf.String())
+	}
+	names := 0
+	for i, doc := range lists {
+		var list struct {
+			Kind  string `json:"kind"`
+			Items []struct {
+				Metadata struct {
+					Name        string            `json:"name"`
+					Annotations map[string]string `json:"annotations"`
+				} `json:"metadata"`
+			} `json:"items"`
+		}
+		if err := yaml.Unmarshal([]byte(doc), &list); err != nil {
+			t.Fatal(err)
+		}
+		if list.Kind != "List" {
+			t.Errorf("batch %d is a %s", i+1, list.Kind)
+		}
+		for _, item := range list.Items {
+			names++
+			if item.Metadata.Name != fmt.Sprintf("ns-%d", names) {
+				t.Errorf("object %d is %s", names, item.Metadata.Name)
+			}
+			a := item.Metadata.Annotations
+			if a[batchAnnotation] != fmt.Sprint(i+1) || a[generationAnnotation] != generationHash(docs) {
+				t.Errorf("%s has annotations %v", item.Metadata.Name, a)
+			}
+		}
+	}
+	if names != len(docs) {
+		t.Errorf("got %d objects, want %d", names, len(docs))
+	}
+}
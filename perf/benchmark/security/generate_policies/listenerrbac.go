@@ -0,0 +1,198 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// ListenerRBACResult is the number of RBAC policies on the filter chains of the targeted proxies
+// after the apply.
+type ListenerRBACResult struct {
+	// SkewThreshold is the skew above which a proxy is reported as skewed.
+	SkewThreshold float64             `json:"skewThreshold"`
+	Proxies       []ProxyListenerRBAC `json:"proxies"`
+}
+
+// Skewed returns the number of skewed proxies.
+func (r *ListenerRBACResult) Skewed() int {
+	n := 0
+	for _, p := range r.Proxies {
+		if p.Skewed {
+			n++
+		}
+	}
+	return n
+}
+
+// ProxyListenerRBAC is the number of RBAC policies on the filter chains of a proxy.
+type ProxyListenerRBAC struct {
+	Pod string `json:"pod"`
+	// Chains are the filter chains with an RBAC filter.
+	Chains       []ChainRBAC `json:"chains"`
+	MaxPolicies  int         `json:"maxPolicies"`
+	MeanPolicies float64     `json:"meanPolicies"`
+	// Skew is MaxPolicies divided by MeanPolicies, 1 when every chain has the same policies.
+	Skew   float64 `json:"skew"`
+	Skewed bool    `json:"skewed"`
+}
+
+// ChainRBAC is the number of RBAC policies of the filters of a filter chain, one per rule of an
+// AuthorizationPolicy applying to its port.
+type ChainRBAC struct {
+	Listener string `json:"listener"`
+	Chain    string `json:"chain"`
+	// Port is the destination port the chain matches, 0 for any.
+	Port           int `json:"port,omitempty"`
+	Filters        int `json:"filters"`
+	Policies       int `json:"policies"`
+	ShadowPolicies int `json:"shadowPolicies,omitempty"`
+}
+
+// chainRBAC returns the filter chains of the listeners of an Envoy /config_dump with an RBAC
+// filter, network or HTTP.
+func chainRBAC(data []byte) ([]ChainRBAC, error) {
+	var dump struct {
+		Configs []struct {
+			DynamicListeners []struct {
+				ActiveState *struct {
+					Listener json.RawMessage `json:"listener"`
+				} `json:"active_state"`
+			} `json:"dynamic_listeners"`
+		} `json:"configs"`
+	}
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return nil, fmt.Errorf("invalid config dump: %v", err)
+	}
+	type filterChain struct {
+		Name             string `json:"name"`
+		FilterChainMatch struct {
+			DestinationPort int `json:"destination_port"`
+		} `json:"filter_chain_match"`
+		Filters []envoyFilter `json:"filters"`
+	}
+	var chains []ChainRBAC
+	for _, c := range dump.Configs {
+		for _, l := range c.DynamicListeners {
+			if l.ActiveState == nil {
+				continue
+			}
+			var listener struct {
+				Name               string        `json:"name"`
+				FilterChains       []filterChain `json:"filter_chains"`
+				DefaultFilterChain *filterChain  `json:"default_filter_chain"`
+			}
+			if err := json.Unmarshal(l.ActiveState.Listener, &listener); err != nil {
+				return nil, err
+			}
+			all := listener.FilterChains
+			if listener.DefaultFilterChain != nil {
+				all = append(all, *listener.DefaultFilterChain)
+			}
+			for i, fc := range all {
+				chain := ChainRBAC{Listener: listener.Name, Chain: fc.Name, Port: fc.FilterChainMatch.DestinationPort}
+				if chain.Chain == "" {
+					chain.Chain = fmt.Sprint(i)
+				}
+				var add func(f envoyFilter)
+				add = func(f envoyFilter) {
+					if strings.HasSuffix(f.Name, ".rbac") {
+						chain.Filters++
+						if f.TypedConfig.Rules != nil {
+							chain.Policies += len(f.TypedConfig.Rules.Policies)
+						}
+						if f.TypedConfig.ShadowRules != nil {
+							chain.ShadowPolicies += len(f.TypedConfig.ShadowRules.Policies)
+						}
+					}
+					for _, h := range f.TypedConfig.HTTPFilters {
+						add(h)
+					}
+				}
+				for _, f := range fc.Filters {
+					add(f)
+				}
+				if chain.Filters > 0 {
+					chains = append(chains, chain)
+				}
+			}
+		}
+	}
+	return chains, nil
+}
+
+// newProxyListenerRBAC returns the skew of the policies over chains.
+func newProxyListenerRBAC(pod string, chains []ChainRBAC, skewThreshold float64) ProxyListenerRBAC {
+	p := ProxyListenerRBAC{Pod: pod, Chains: chains}
+	total := 0
+	for _, c := range chains {
+		total += c.Policies
+		if c.Policies > p.MaxPolicies {
+			p.MaxPolicies = c.Policies
+		}
+	}
+	if len(chains) > 0 {
+		p.MeanPolicies = float64(total) / float64(len(chains))
+	}
+	if p.MeanPolicies > 0 {
+		p.Skew = float64(p.MaxPolicies) / p.MeanPolicies
+	}
+	p.Skewed = len(chains) > 1 && p.Skew >= skewThreshold
+	return p
+}
+
+// listenerRBAC returns the RBAC policies of the filter chains of the proxies of pods.
+func listenerRBAC(ctx context.Context, namespace string, pods []string, skewThreshold float64) (*ListenerRBACResult, error) {
+	r := &ListenerRBACResult{SkewThreshold: skewThreshold}
+	for _, pod := range pods {
+		data, err := configDump(ctx, namespace, pod)
+		if err != nil {
+			return r, err
+		}
+		chains, err := chainRBAC(data)
+		if err != nil {
+			return r, fmt.Errorf("config dump of %s: %v", pod, err)
+		}
+		r.Proxies = append(r.Proxies, newProxyListenerRBAC(pod, chains, skewThreshold))
+	}
+	return r, nil
+}
+
+func (r *ListenerRBACResult) print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "pod\tlistener\tchain\tport\trbac filters\tpolicies\tshadow policies\t")
+	for _, p := range r.Proxies {
+		for _, c := range p.Chains {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t\n", p.Pod, c.Listener, c.Chain, c.Port, c.Filters, c.Policies, c.ShadowPolicies)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, p := range r.Proxies {
+		skewed := ""
+		if p.Skewed {
+			skewed = ", SKEWED"
+		}
+		fmt.Fprintf(w, "%s: %d chains with RBAC, at most %d policies, %.1f on average, skew %.1f%s\n",
+			p.Pod, len(p.Chains), p.MaxPolicies, p.MeanPolicies, p.Skew, skewed)
+	}
+	return nil
+}
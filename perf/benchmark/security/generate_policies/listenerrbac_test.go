@@ -0,0 +1,57 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChainRBAC(t *testing.T) {
+	dump := `{"configs": [{"dynamic_listeners": [
+  {"name": "virtualOutbound", "active_state": {"listener": {"name": "virtualOutbound",
+    "filter_chains": [{"filters": [{"name": "envoy.filters.network.tcp_proxy"}]}]}}},
+  {"name": "virtualInbound", "active_state": {"listener": {"name": "virtualInbound", "filter_chains": [
+    {"name": "0.0.0.0_8080", "filter_chain_match": {"destination_port": 8080}, "filters": [
+      {"name": "envoy.filters.network.http_connection_manager", "typed_config": {"http_filters": [
+        {"name": "envoy.filters.http.rbac", "typed_config": {
+          "rules": {"policies": {"ns[ns]-policy[a]-rule[0]": {}, "ns[ns]-policy[b]-rule[0]": {}, "ns[ns]-policy[c]-rule[0]": {}}},
+          "shadow_rules": {"policies": {"ns[ns]-policy[d]-rule[0]": {}}}}},
+        {"name": "envoy.filters.http.router"}]}}]},
+    {"name": "0.0.0.0_9090", "filter_chain_match": {"destination_port": 9090}, "filters": [
+      {"name": "envoy.filters.network.rbac", "typed_config": {"rules": {}}},
+      {"name": "envoy.filters.network.tcp_proxy"}]}]}}}
+]}]}`
+	chains, err := chainRBAC([]byte(dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ChainRBAC{
+		{Listener: "virtualInbound", Chain: "0.0.0.0_8080", Port: 8080, Filters: 1, Policies: 3, ShadowPolicies: 1},
+		{Listener: "virtualInbound", Chain: "0.0.0.0_9090", Port: 9090, Filters: 1},
+	}
+	if !reflect.DeepEqual(chains, want) {
+		t.Fatalf("got %+v, want %+v", chains, want)
+	}
+
+	p := newProxyListenerRBAC("server", chains, 2)
+	if p.MaxPolicies != 3 || p.MeanPolicies != 1.5 || p.Skew != 2 || !p.Skewed {
+		t.Errorf("got %+v, want the 8080 chain absorbing the policies reported skewed", p)
+	}
+	chains[1].Policies = 3
+	if p := newProxyListenerRBAC("server", chains, 2); p.Skew != 1 || p.Skewed {
+		t.Errorf("got %+v, want chains with the same policies not skewed", p)
+	}
+}
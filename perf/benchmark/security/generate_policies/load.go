@@ -0,0 +1,296 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+type loadOptions struct {
+	// url is the base URL the paths of the requests are appended to.
+	url      string
+	qps      float64
+	conns    int
+	duration time.Duration
+	// warmup and warmupRequests bound a warmup phase excluded from the result, so that matcher
+	// compilation and connection setup do not skew small runs. The phase ends as soon as one
+	// of the set bounds is reached.
+	warmup         time.Duration
+	warmupRequests int
+	// requests are sent round robin. A single GET of url is sent if empty.
+	requests []TrafficRequest
+}
+
+// LoadResult summarizes a load run.
+type LoadResult struct {
+	Requests int `json:"requests"`
+	// WarmupRequests is the number of requests sent before the measurement started.
+	WarmupRequests  int            `json:"warmupRequests,omitempty"`
+	Errors          int            `json:"errors"`
+	StatusCodes     map[int]int    `json:"statusCodes"`
+	DurationSeconds float64        `json:"durationSeconds"`
+	ActualQPS       float64        `json:"actualQPS"`
+	Latency         LatencySummary `json:"latency"`
+	// LatencyByOutcome breaks down the latency by statusOutcome, since denials short-circuit
+	// the filter chain and blended percentiles hide the cost of each path.
+	LatencyByOutcome map[string]LatencySummary `json:"latencyByOutcome,omitempty"`
+	// QPSByOutcome is the throughput of each outcome, the deny path throughput differs from
+	// the allow path throughput.
+	QPSByOutcome map[string]float64 `json:"qpsByOutcome,omitempty"`
+	// UnexpectedDecisions counts responses not matching the expectation of their request.
+	UnexpectedDecisions int `json:"unexpectedDecisions,omitempty"`
+}
+
+const (
+	outcomeAllowed         = "allowed"
+	outcomeDenied          = "denied"
+	outcomeUnauthenticated = "unauthenticated"
+	outcomeOther           = "other"
+)
+
+// outcomes lists the outcomes in the order they are reported.
+var outcomes = []string{outcomeAllowed, outcomeDenied, outcomeUnauthenticated, outcomeOther}
+
+// statusOutcome classifies a response: 2xx are allowed, 403 are denied by an AuthorizationPolicy
+// and 401 are rejected by a RequestAuthentication because of an invalid JWT.
+func statusOutcome(code int) string {
+	switch {
+	case code >= 200 && code < 300:
+		return outcomeAllowed
+	case code == http.StatusForbidden:
+		return outcomeDenied
+	case code == http.StatusUnauthorized:
+		return outcomeUnauthenticated
+	default:
+		return outcomeOther
+	}
+}
+
+// LatencySummary holds latency statistics in milliseconds.
+type LatencySummary struct {
+	Min float64 `json:"min"`
+	Avg float64 `json:"avg"`
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// sub returns the statistics of l minus the ones of o, e.g. the latency added by policies.
+func (l LatencySummary) sub(o LatencySummary) LatencySummary {
+	return LatencySummary{l.Min - o.Min, l.Avg - o.Avg, l.P50 - o.P50, l.P90 - o.P90, l.P99 - o.P99, l.Max - o.Max}
+}
+
+func (o loadOptions) validate() error {
+	if o.url == "" {
+		return fmt.Errorf("url is required")
+	}
+	if o.conns <= 0 {
+		return fmt.Errorf("invalid number of connections: %d", o.conns)
+	}
+	if o.duration <= 0 {
+		return fmt.Errorf("invalid duration: %v", o.duration)
+	}
+	if o.warmup < 0 || o.warmupRequests < 0 {
+		return fmt.Errorf("invalid warmup: %v, %d requests", o.warmup, o.warmupRequests)
+	}
+	return nil
+}
+
+// runLoad sends requests with opts.conns concurrent workers for opts.duration. A qps of 0 or
+// less sends as fast as possible. The warmup phase, if configured, runs first with the same
+// workers and is excluded from the result. When ctx is cancelled the load stops and the result
+// covers the requests completed so far.
+func runLoad(ctx context.Context, opts loadOptions) (*LoadResult, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	requests := opts.requests
+	if len(requests) == 0 {
+		requests = []TrafficRequest{{Method: "GET", Path: ""}}
+	}
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{MaxIdleConnsPerHost: opts.conns},
+	}
+
+	warmupRequests := 0
+	if opts.warmup > 0 || opts.warmupRequests > 0 {
+		warmup := runLoadPhase(ctx, client, opts, requests, opts.warmup, opts.warmupRequests)
+		warmupRequests = warmup.Requests
+	}
+	result := runLoadPhase(ctx, client, opts, requests, opts.duration, 0)
+	result.WarmupRequests = warmupRequests
+	return result, nil
+}
+
+// runLoadPhase sends requests until duration elapsed or maxRequests were sent. A zero
+// duration or maxRequests does not limit the phase.
+func runLoadPhase(ctx context.Context, client *http.Client, opts loadOptions, requests []TrafficRequest, duration time.Duration, maxRequests int) *LoadResult {
+	var interval time.Duration
+	if opts.qps > 0 {
+		interval = time.Duration(float64(time.Second) * float64(opts.conns) / opts.qps)
+	}
+
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+		byOutcome = map[string][]time.Duration{}
+		result    = &LoadResult{StatusCodes: map[int]int{}}
+		wg        sync.WaitGroup
+	)
+	start := time.Now()
+	started := 0
+	// next claims the next request, reporting false once the phase is over.
+	next := func() bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		if duration > 0 && !time.Now().Before(start.Add(duration)) {
+			return false
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if maxRequests > 0 && started >= maxRequests {
+			return false
+		}
+		started++
+		return true
+	}
+	for w := 0; w < opts.conns; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			sendAt := time.Now()
+			for i := w; next(); i += opts.conns {
+				if interval > 0 {
+					select {
+					case <-time.After(time.Until(sendAt)):
+					case <-ctx.Done():
+						return
+					}
+					sendAt = sendAt.Add(interval)
+				}
+				r := requests[i%len(requests)]
+				code, latency, err := sendRequest(ctx, client, opts.url, r)
+				if ctx.Err() != nil {
+					// Requests cut short by the cancellation are neither errors nor decisions.
+					return
+				}
+				mu.Lock()
+				result.Requests++
+				if err != nil {
+					result.Errors++
+				} else {
+					result.StatusCodes[code]++
+					latencies = append(latencies, latency)
+					outcome := statusOutcome(code)
+					byOutcome[outcome] = append(byOutcome[outcome], latency)
+					if !matchesExpectation(r.Expect, outcome) {
+						result.UnexpectedDecisions++
+					}
+				}
+				mu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	result.DurationSeconds = elapsed.Seconds()
+	result.ActualQPS = float64(result.Requests) / elapsed.Seconds()
+	result.Latency = summarizeLatencies(latencies)
+	result.LatencyByOutcome = map[string]LatencySummary{}
+	result.QPSByOutcome = map[string]float64{}
+	for outcome, l := range byOutcome {
+		result.LatencyByOutcome[outcome] = summarizeLatencies(l)
+		result.QPSByOutcome[outcome] = float64(len(l)) / elapsed.Seconds()
+	}
+	return result
+}
+
+func sendRequest(ctx context.Context, client *http.Client, url string, r TrafficRequest) (int, time.Duration, error) {
+	method := r.Method
+	if method == "" {
+		method = "GET"
+	}
+	req, err := http.NewRequest(method, url+r.Path, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range r.Headers {
+		req.Header.Set(k, v)
+	}
+	for k, values := range r.HeaderValues {
+		req.Header[k] = append(req.Header[k], values...)
+	}
+	if r.Host != "" {
+		req.Host = r.Host
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, time.Since(start), nil
+}
+
+// matchesExpectation reports whether outcome is the expected decision, which is always the
+// case for requests without an expectation.
+func matchesExpectation(expect, outcome string) bool {
+	switch expect {
+	case expectAllow:
+		return outcome == outcomeAllowed
+	case expectDeny:
+		return outcome == outcomeDenied
+	case expectRejected:
+		return outcome == outcomeOther
+	default:
+		return true
+	}
+}
+
+func summarizeLatencies(latencies []time.Duration) LatencySummary {
+	if len(latencies) == 0 {
+		return LatencySummary{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	percentile := func(p float64) float64 {
+		return ms(latencies[int(p*float64(len(latencies)-1))])
+	}
+	return LatencySummary{
+		Min: ms(latencies[0]),
+		Avg: ms(total / time.Duration(len(latencies))),
+		P50: percentile(0.50),
+		P90: percentile(0.90),
+		P99: percentile(0.99),
+		Max: ms(latencies[len(latencies)-1]),
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// lockVersion is the version of the format of the lock files, reproduce refuses other versions.
+const lockVersion = 1
+
+// ScenarioLock records how a corpus was generated together with the hashes of its documents, so
+// that reproduce regenerates it exactly or fails.
+type ScenarioLock struct {
+	Version int `json:"version"`
+	// Metadata are the tool version, git SHA, seed and flags of the generation.
+	Metadata   *RunMetadata `json:"metadata"`
+	Scenario   string       `json:"scenario,omitempty"`
+	ConfigFile string       `json:"configFile,omitempty"`
+	// Config is the config resolved from the scenario, the config file and the flags, so that
+	// reproducing the corpus does not depend on them.
+	Config generatepolicies.SecurityPolicy `json:"config"`
+	// Stamped reports whether the documents written were annotated with Metadata.
+	Stamped bool `json:"stamped"`
+	// SHA256 is the hash of the documents in order, before they are stamped.
+	SHA256    string           `json:"sha256"`
+	Documents []LockedDocument `json:"documents"`
+}
+
+// LockedDocument is the hash of a generated document.
+type LockedDocument struct {
+	Object string `json:"object"`
+	SHA256 string `json:"sha256"`
+}
+
+// seededPolicy returns policyData with the values of its rules drawn from seed, or unchanged
+// without a seed.
+func seededPolicy(policyData generatepolicies.SecurityPolicy, seed *int64) (generatepolicies.SecurityPolicy, error) {
+	if seed == nil {
+		return policyData, nil
+	}
+	g, err := generatepolicies.NewGenerator(generatepolicies.WithSecurityPolicy(policyData), generatepolicies.WithSeed(*seed))
+	if err != nil {
+		return policyData, err
+	}
+	return g.SecurityPolicy(), nil
+}
+
+// lockDocuments returns the hash of every document and of all of them.
+func lockDocuments(docs []string) ([]LockedDocument, string, error) {
+	locked := make([]LockedDocument, len(docs))
+	all := sha256.New()
+	for i, doc := range docs {
+		objects, err := parsePolicyObjects([]string{doc})
+		if err != nil {
+			return nil, "", err
+		}
+		if len(objects) > 0 {
+			locked[i].Object = objects[0].String()
+		}
+		sum := sha256.Sum256([]byte(doc))
+		locked[i].SHA256 = hex.EncodeToString(sum[:])
+		all.Write([]byte(doc + "---\n"))
+	}
+	return locked, hex.EncodeToString(all.Sum(nil)), nil
+}
+
+// lockable returns an error when the documents of policyData cannot be reproduced: the inline
+// JWKS of the RequestAuthentications hold the public key of a key generated for every run, unless
+// requestAuthN.keyFile saves it.
+func lockable(policyData generatepolicies.SecurityPolicy) error {
+	if policyData.RequestAuthN.NumPolicies > 0 && policyData.RequestAuthN.KeyFile == "" {
+		return fmt.Errorf("cannot lock RequestAuthentications signed by a key generated for the run, set requestAuthN.keyFile")
+	}
+	return nil
+}
+
+// newScenarioLock returns the lock of docs, generated from policyData as recorded by metadata.
+func newScenarioLock(scenario, configFile string, policyData generatepolicies.SecurityPolicy, metadata *RunMetadata, stamped bool, docs []string) (*ScenarioLock, error) {
+	if err := lockable(policyData); err != nil {
+		return nil, err
+	}
+	documents, sum, err := lockDocuments(docs)
+	if err != nil {
+		return nil, err
+	}
+	return &ScenarioLock{
+		Version:    lockVersion,
+		Metadata:   metadata,
+		Scenario:   scenario,
+		ConfigFile: configFile,
+		Config:     policyData,
+		Stamped:    stamped,
+		SHA256:     sum,
+		Documents:  documents,
+	}, nil
+}
+
+func writeScenarioLock(file string, lock *ScenarioLock) error {
+	js, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(js, '\n'), 0644)
+}
+
+func readScenarioLock(file string) (*ScenarioLock, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	lock := &ScenarioLock{}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if lock.Version != lockVersion {
+		return nil, fmt.Errorf("%s: unsupported lock version %d, want %d", file, lock.Version, lockVersion)
+	}
+	if lock.Metadata == nil {
+		return nil, fmt.Errorf("%s: no metadata", file)
+	}
+	return lock, nil
+}
+
+// reproduceLock regenerates the documents of lock, stamped as they were written, and fails when
+// they differ from the locked ones. It writes nothing, neither the token of the
+// RequestAuthentications nor their key file.
+func reproduceLock(ctx context.Context, lock *ScenarioLock) ([]string, error) {
+	if err := lockable(lock.Config); err != nil {
+		return nil, err
+	}
+	if keyFile := lock.Config.RequestAuthN.KeyFile; lock.Config.RequestAuthN.NumPolicies > 0 {
+		// A missing key file would be created with a new key, which cannot match the lock.
+		if _, err := os.Stat(keyFile); err != nil {
+			return nil, fmt.Errorf("the key file of the RequestAuthentications: %v", err)
+		}
+	}
+	policyData, err := seededPolicy(lock.Config, lock.Metadata.Seed)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := generateDocuments(ctx, policyData)
+	if err != nil {
+		return nil, err
+	}
+	documents, sum, err := lockDocuments(docs)
+	if err != nil {
+		return nil, err
+	}
+	if sum != lock.SHA256 {
+		mismatch := fmt.Sprintf("%d documents generated, %d locked", len(documents), len(lock.Documents))
+		for i := range documents {
+			if i < len(lock.Documents) && documents[i] != lock.Documents[i] {
+				mismatch = fmt.Sprintf("document %d is %s, locked %s", i, documents[i].Object, lock.Documents[i].Object)
+				if documents[i].Object == lock.Documents[i].Object {
+					mismatch = fmt.Sprintf("document %d, %s, changed", i, documents[i].Object)
+				}
+				break
+			}
+		}
+		return nil, fmt.Errorf("cannot reproduce the corpus of tool version %s with %s: %s, sha256 %s, locked %s",
+			lock.Metadata.ToolVersion, toolVersion(), mismatch, sum, lock.SHA256)
+	}
+	if lock.Stamped {
+		return stampDocs(docs, lock.Metadata)
+	}
+	return docs, nil
+}
+
+func runReproduce(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reproduce", flag.ExitOnError)
+	lockFile := fs.String("lock", "", "The lock file written by -lockFile when the corpus was generated")
+	out := fs.String("out", "", "The file the reproduced policies are written to. Default: stdout")
+	_ = fs.Parse(args)
+
+	if *lockFile == "" {
+		return fmt.Errorf("usage: reproduce -lock=<lock.json>")
+	}
+	lock, err := readScenarioLock(*lockFile)
+	if err != nil {
+		return err
+	}
+	docs, err := reproduceLock(ctx, lock)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, doc := range docs {
+		buf.WriteString(doc + "---\n")
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	if err := ioutil.WriteFile(*out, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("%d documents of %s reproduced, sha256 %s\n", len(docs), *lockFile, lock.SHA256)
+	return nil
+}
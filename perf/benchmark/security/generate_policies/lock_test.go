@@ -0,0 +1,124 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+func TestReproduceLock(t *testing.T) {
+	ctx := context.Background()
+	policyData := generatepolicies.SecurityPolicy{AuthZ: generatepolicies.AuthorizationPolicy{NumPolicies: 3, NumPaths: 2, NumPrincipals: 2}}
+	seed := int64(42)
+	seeded, err := seededPolicy(policyData, &seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs, err := generatePolicies(ctx, seeded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := &RunMetadata{ToolVersion: "v1", Seed: &seed, Flags: []string{"-seed=42"}}
+	lock, err := newScenarioLock("", "config.json", policyData, metadata, true, docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Documents) != 3 || lock.Documents[0].Object != "AuthorizationPolicy twopods-istio/test-authorizationpolicy-1" {
+		t.Errorf("got locked documents %+v", lock.Documents)
+	}
+
+	// The lock is reproduced from its JSON, without the config file.
+	js, err := json.Marshal(lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := &ScenarioLock{}
+	if err := json.Unmarshal(js, read); err != nil {
+		t.Fatal(err)
+	}
+	reproduced, err := reproduceLock(ctx, read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stamped, err := stampDocs(docs, metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reproduced, stamped) {
+		t.Errorf("got\n%v\nwant\n%v", reproduced, stamped)
+	}
+
+	// Another seed draws other values.
+	other := int64(43)
+	read.Metadata.Seed = &other
+	if _, err := reproduceLock(ctx, read); err == nil || !strings.Contains(err.Error(), "document 0, AuthorizationPolicy twopods-istio/test-authorizationpolicy-1, changed") {
+		t.Errorf("got error %v, want the first changed document", err)
+	}
+	read.Metadata.Seed = &seed
+	read.Config.AuthZ.NumPolicies = 4
+	if _, err := reproduceLock(ctx, read); err == nil || !strings.Contains(err.Error(), "4 documents generated, 3 locked") {
+		t.Errorf("got error %v, want the numbers of documents", err)
+	}
+}
+
+func TestReproduceLockRequestAuthentications(t *testing.T) {
+	inTempDir(t)
+	ctx := context.Background()
+	policyData := generatepolicies.SecurityPolicy{RequestAuthN: generatepolicies.RequestAuthentication{NumPolicies: 2}}
+	metadata := &RunMetadata{ToolVersion: "v1", Flags: []string{}}
+	if _, err := newScenarioLock("", "", policyData, metadata, false, nil); err == nil || !strings.Contains(err.Error(), "set requestAuthN.keyFile") {
+		t.Errorf("got error %v, want a RequestAuthentication without a key file refused", err)
+	}
+
+	policyData.RequestAuthN.KeyFile = "key.pem"
+	docs, err := generatePolicies(ctx, policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock, err := newScenarioLock("", "", policyData, metadata, false, docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove("token.txt"); err != nil {
+		t.Fatal(err)
+	}
+	reproduced, err := reproduceLock(ctx, lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reproduced, docs) {
+		t.Errorf("got\n%v\nwant\n%v", reproduced, docs)
+	}
+	if _, err := os.Stat("token.txt"); !os.IsNotExist(err) {
+		t.Errorf("reproduce wrote token.txt: %v", err)
+	}
+
+	if err := os.Remove("key.pem"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reproduceLock(ctx, lock); err == nil {
+		t.Error("reproduced the lock without its key file")
+	}
+	if _, err := os.Stat("key.pem"); !os.IsNotExist(err) {
+		t.Errorf("reproduce created the key file: %v", err)
+	}
+}
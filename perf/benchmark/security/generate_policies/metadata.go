@@ -0,0 +1,120 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// version and gitSHA identify the build, set with
+// -ldflags "-X main.version=<version> -X main.gitSHA=$(git rev-parse HEAD)".
+var (
+	version = ""
+	gitSHA  = ""
+)
+
+const (
+	toolVersionAnnotation = "generate-policies.istio.io/tool-version"
+	gitSHAAnnotation      = "generate-policies.istio.io/git-sha"
+	seedAnnotation        = "generate-policies.istio.io/seed"
+	flagsAnnotation       = "generate-policies.istio.io/flags"
+)
+
+// RunMetadata records how a corpus or a run was produced.
+type RunMetadata struct {
+	ToolVersion string `json:"toolVersion"`
+	GitSHA      string `json:"gitSHA,omitempty"`
+	// Seed is the seed of the random values, nil when the values are not random.
+	Seed *int64 `json:"seed,omitempty"`
+	// Flags are the flags set on the command line, as -name=value.
+	Flags []string `json:"flags"`
+}
+
+// toolVersion returns the version of the build, the module version when it is not set at link
+// time.
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "unknown"
+}
+
+// buildGitSHA returns the git commit of the build, the vcs.revision the go command records when
+// it is not set at link time, or "" when it is unknown.
+func buildGitSHA() string {
+	if gitSHA != "" {
+		return gitSHA
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return ""
+}
+
+// newRunMetadata returns the metadata of a run with the flags set on fs.
+func newRunMetadata(fs *flag.FlagSet, seed *int64) *RunMetadata {
+	m := &RunMetadata{ToolVersion: toolVersion(), GitSHA: buildGitSHA(), Seed: seed, Flags: []string{}}
+	fs.Visit(func(f *flag.Flag) {
+		m.Flags = append(m.Flags, fmt.Sprintf("-%s=%s", f.Name, f.Value))
+	})
+	sort.Strings(m.Flags)
+	return m
+}
+
+// annotations returns the annotations stamping m on a generated object.
+func (m *RunMetadata) annotations() map[string]string {
+	a := map[string]string{
+		toolVersionAnnotation: m.ToolVersion,
+		flagsAnnotation:       strings.Join(m.Flags, " "),
+	}
+	if m.GitSHA != "" {
+		a[gitSHAAnnotation] = m.GitSHA
+	}
+	if m.Seed != nil {
+		a[seedAnnotation] = strconv.FormatInt(*m.Seed, 10)
+	}
+	return a
+}
+
+// stampDocs returns docs with the annotations of m.
+func stampDocs(docs []string, m *RunMetadata) ([]string, error) {
+	annotations := m.annotations()
+	stamped := make([]string, len(docs))
+	for i, doc := range docs {
+		var err error
+		if stamped[i], err = annotate(doc, annotations); err != nil {
+			return nil, err
+		}
+	}
+	return stamped, nil
+}
+
+// newRunReport returns the report of a run of command, stamped with the metadata of fs.
+func newRunReport(command, configFile string, fs *flag.FlagSet) *RunReport {
+	return &RunReport{Command: command, ConfigFile: configFile, StartTime: time.Now(), Metadata: newRunMetadata(fs, nil)}
+}
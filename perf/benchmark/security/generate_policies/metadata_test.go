@@ -0,0 +1,81 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestStampDocs(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("scenario", "", "")
+	fs.Int("tenants", 0, "")
+	fs.Bool("unset", false, "")
+	if err := fs.Parse([]string{"-tenants=3", "-scenario=jwt-heavy"}); err != nil {
+		t.Fatal(err)
+	}
+	seed := int64(7)
+	m := newRunMetadata(fs, &seed)
+	if want := []string{"-scenario=jwt-heavy", "-tenants=3"}; !reflect.DeepEqual(m.Flags, want) {
+		t.Errorf("flags = %v, want %v", m.Flags, want)
+	}
+
+	docs, err := stampDocs([]string{`apiVersion: v1
+kind: Namespace
+metadata:
+  annotations:
+    owner: team-a
+  name: ns-1
+`}, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var object struct {
+		Metadata struct {
+			Name        string            `json:"name"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	if err := yaml.Unmarshal([]byte(docs[0]), &object); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"owner":               "team-a",
+		toolVersionAnnotation: m.ToolVersion,
+		seedAnnotation:        "7",
+		flagsAnnotation:       "-scenario=jwt-heavy -tenants=3",
+	}
+	if m.GitSHA != "" {
+		want[gitSHAAnnotation] = m.GitSHA
+	}
+	if object.Metadata.Name != "ns-1" || !reflect.DeepEqual(object.Metadata.Annotations, want) {
+		t.Errorf("stamped %s with %v, want %v", object.Metadata.Name, object.Metadata.Annotations, want)
+	}
+}
+
+func TestAnnotationsWithoutGitSHA(t *testing.T) {
+	m := &RunMetadata{ToolVersion: "v1", Flags: []string{}}
+	if _, ok := m.annotations()[gitSHAAnnotation]; ok {
+		t.Errorf("got a %s annotation without a git SHA", gitSHAAnnotation)
+	}
+	m.GitSHA = "abc"
+	if got := m.annotations()[gitSHAAnnotation]; got != "abc" {
+		t.Errorf("got %s %q, want abc", gitSHAAnnotation, got)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// istiodMonitoringPort is the istiod port serving the Prometheus metrics.
+const istiodMonitoringPort = 15014
+
+// metricFamilies are the metrics of a scrape, keyed by name.
+type metricFamilies map[string]*dto.MetricFamily
+
+// istiodMetrics scrapes the metrics of an istiod pod through a port-forward.
+type istiodMetrics struct {
+	pod  string
+	addr string
+	stop func()
+}
+
+// newIstiodMetrics port-forwards to the monitoring port of the first istiod pod in namespace
+// matching selector. close stops the port-forward.
+func newIstiodMetrics(ctx context.Context, namespace, selector string) (*istiodMetrics, error) {
+	pod, err := firstPod(ctx, namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+	addr, stop, err := portForward(ctx, namespace, pod, istiodMonitoringPort)
+	if err != nil {
+		return nil, err
+	}
+	return &istiodMetrics{pod: pod, addr: addr, stop: stop}, nil
+}
+
+func (m *istiodMetrics) close() {
+	m.stop()
+}
+
+// scrape returns the current metrics of istiod.
+func (m *istiodMetrics) scrape(ctx context.Context) (metricFamilies, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s/metrics", m.addr), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scraping istiod %s: %s", m.pod, resp.Status)
+	}
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("scraping istiod %s: %v", m.pod, err)
+	}
+	return families, nil
+}
+
+// counter returns the sum of the series of the counter or gauge name, 0 when it is missing.
+func (f metricFamilies) counter(name string) float64 {
+	family, ok := f[name]
+	if !ok {
+		return 0
+	}
+	sum := 0.0
+	for _, m := range family.Metric {
+		switch {
+		case m.Counter != nil:
+			sum += m.Counter.GetValue()
+		case m.Gauge != nil:
+			sum += m.Gauge.GetValue()
+		case m.Untyped != nil:
+			sum += m.Untyped.GetValue()
+		}
+	}
+	return sum
+}
+
+// counterBy returns the sums of the series of the counter or gauge name by the value of label.
+func (f metricFamilies) counterBy(name, label string) map[string]float64 {
+	sums := make(map[string]float64)
+	family, ok := f[name]
+	if !ok {
+		return sums
+	}
+	for _, m := range family.Metric {
+		value := ""
+		for _, l := range m.Label {
+			if l.GetName() == label {
+				value = l.GetValue()
+			}
+		}
+		switch {
+		case m.Counter != nil:
+			sums[value] += m.Counter.GetValue()
+		case m.Gauge != nil:
+			sums[value] += m.Gauge.GetValue()
+		case m.Untyped != nil:
+			sums[value] += m.Untyped.GetValue()
+		}
+	}
+	return sums
+}
+
+// histogram is a histogram summed over its series, with cumulative bucket counts.
+type histogram struct {
+	count   float64
+	sum     float64
+	buckets map[float64]float64
+}
+
+// histogram returns the histogram name summed over its series.
+func (f metricFamilies) histogram(name string) histogram {
+	h := histogram{buckets: make(map[float64]float64)}
+	family, ok := f[name]
+	if !ok {
+		return h
+	}
+	for _, m := range family.Metric {
+		if m.Histogram == nil {
+			continue
+		}
+		h.count += float64(m.Histogram.GetSampleCount())
+		h.sum += m.Histogram.GetSampleSum()
+		for _, b := range m.Histogram.Bucket {
+			h.buckets[b.GetUpperBound()] += float64(b.GetCumulativeCount())
+		}
+	}
+	return h
+}
+
+// sub returns the observations of h which are not in before, the histogram of an interval.
+func (h histogram) sub(before histogram) histogram {
+	d := histogram{count: h.count - before.count, sum: h.sum - before.sum, buckets: make(map[float64]float64)}
+	for bound, count := range h.buckets {
+		d.buckets[bound] = count - before.buckets[bound]
+	}
+	return d
+}
+
+// HistogramSummary summarizes the observations of a histogram.
+type HistogramSummary struct {
+	Count float64 `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P99   float64 `json:"p99"`
+}
+
+func (h histogram) summary() HistogramSummary {
+	s := HistogramSummary{Count: h.count}
+	if h.count > 0 {
+		s.Mean = h.sum / h.count
+		s.P50 = h.quantile(0.5)
+		s.P99 = h.quantile(0.99)
+	}
+	return s
+}
+
+// quantile estimates the q quantile like the histogram_quantile of Prometheus, interpolating
+// linearly within the bucket it falls into.
+func (h histogram) quantile(q float64) float64 {
+	bounds := make([]float64, 0, len(h.buckets))
+	for bound := range h.buckets {
+		bounds = append(bounds, bound)
+	}
+	sort.Float64s(bounds)
+	rank := q * h.count
+	lower, lowerCount := 0.0, 0.0
+	for _, bound := range bounds {
+		count := h.buckets[bound]
+		if count >= rank {
+			if math.IsInf(bound, 1) {
+				return lower
+			}
+			if count == lowerCount {
+				return bound
+			}
+			return lower + (bound-lower)*(rank-lowerCount)/(count-lowerCount)
+		}
+		lower, lowerCount = bound, count
+	}
+	return lower
+}
@@ -0,0 +1,68 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+func parseMetrics(t *testing.T, text string) metricFamilies {
+	t.Helper()
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return families
+}
+
+func TestHistogramSummary(t *testing.T) {
+	before := parseMetrics(t, `# TYPE pilot_xds_pushes counter
+pilot_xds_pushes{type="cds"} 10
+pilot_xds_pushes{type="lds"} 5
+# TYPE pilot_proxy_convergence_time histogram
+pilot_proxy_convergence_time_bucket{le="0.1"} 10
+pilot_proxy_convergence_time_bucket{le="1"} 10
+pilot_proxy_convergence_time_bucket{le="+Inf"} 10
+pilot_proxy_convergence_time_sum 0.5
+pilot_proxy_convergence_time_count 10
+`)
+	after := parseMetrics(t, `# TYPE pilot_xds_pushes counter
+pilot_xds_pushes{type="cds"} 40
+pilot_xds_pushes{type="lds"} 25
+# TYPE pilot_proxy_convergence_time histogram
+pilot_proxy_convergence_time_bucket{le="0.1"} 60
+pilot_proxy_convergence_time_bucket{le="1"} 110
+pilot_proxy_convergence_time_bucket{le="+Inf"} 110
+pilot_proxy_convergence_time_sum 30.5
+pilot_proxy_convergence_time_count 110
+`)
+	if got := after.counter("pilot_xds_pushes") - before.counter("pilot_xds_pushes"); got != 50 {
+		t.Errorf("got %v pushes, want 50", got)
+	}
+	got := after.histogram("pilot_proxy_convergence_time").sub(before.histogram("pilot_proxy_convergence_time")).summary()
+	// 50 observations under 0.1s and 50 between 0.1s and 1s.
+	want := HistogramSummary{Count: 100, Mean: 0.3, P50: 0.1, P99: 0.982}
+	if got.Count != want.Count || !near(got.Mean, want.Mean) || !near(got.P50, want.P50) || !near(got.P99, want.P99) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func near(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
@@ -0,0 +1,233 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// reproduces reports whether the policies of the given indexes reproduce the problem.
+type reproduces func(ctx context.Context, subset []int) (bool, error)
+
+// minimizeSet returns a subset of the n policies which still reproduces the problem and from
+// which no single policy can be removed, with the ddmin algorithm: it tries chunks of the set and
+// their complements, refining the chunks when none of them reproduces the problem.
+func minimizeSet(ctx context.Context, n int, test reproduces) ([]int, error) {
+	set := make([]int, n)
+	for i := range set {
+		set[i] = i
+	}
+	chunks := 2
+	for len(set) >= 2 {
+		parts := splitChunks(set, chunks)
+		reduced := false
+		for _, part := range parts {
+			ok, err := test(ctx, part)
+			if err != nil {
+				return set, err
+			}
+			if ok {
+				set, chunks, reduced = part, 2, true
+				break
+			}
+		}
+		if !reduced && chunks > 2 {
+			for i := range parts {
+				complement := complementOf(parts, i)
+				ok, err := test(ctx, complement)
+				if err != nil {
+					return set, err
+				}
+				if ok {
+					set, chunks, reduced = complement, chunks-1, true
+					break
+				}
+			}
+		}
+		if reduced {
+			continue
+		}
+		if chunks >= len(set) {
+			break
+		}
+		chunks *= 2
+		if chunks > len(set) {
+			chunks = len(set)
+		}
+	}
+	return set, nil
+}
+
+// splitChunks splits set into n chunks of nearly equal sizes.
+func splitChunks(set []int, n int) [][]int {
+	parts := make([][]int, 0, n)
+	start := 0
+	for i := 0; i < n; i++ {
+		end := start + (len(set)-start)/(n-i)
+		parts = append(parts, set[start:end])
+		start = end
+	}
+	return parts
+}
+
+// complementOf returns the elements of every part but parts[skip].
+func complementOf(parts [][]int, skip int) []int {
+	var complement []int
+	for i, part := range parts {
+		if i != skip {
+			complement = append(complement, part...)
+		}
+	}
+	return complement
+}
+
+// clusterProbe applies subsets of docs to the cluster and runs the probe command against them.
+type clusterProbe struct {
+	docs    []string
+	command string
+	settle  time.Duration
+	// applied are the indexes of the policies in the cluster.
+	applied map[int]bool
+	tests   int
+}
+
+// test replaces the policies in the cluster with the subset, waits for them to take effect and
+// runs the probe, which reproduces the problem when it fails.
+func (p *clusterProbe) test(ctx context.Context, subset []int) (bool, error) {
+	wanted := make(map[int]bool, len(subset))
+	var apply []string
+	for _, i := range subset {
+		wanted[i] = true
+		if !p.applied[i] {
+			apply = append(apply, p.docs[i])
+		}
+	}
+	var remove []int
+	for i := range p.applied {
+		if !wanted[i] {
+			remove = append(remove, i)
+		}
+	}
+	if err := p.delete(ctx, remove); err != nil {
+		return false, err
+	}
+	if len(apply) > 0 {
+		if err := kubectlApply(ctx, apply); err != nil {
+			return false, err
+		}
+	}
+	for _, i := range subset {
+		p.applied[i] = true
+	}
+
+	select {
+	case <-time.After(p.settle):
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+	p.tests++
+	err := exec.CommandContext(ctx, "sh", "-c", p.command).Run()
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	_, failed := err.(*exec.ExitError)
+	if err != nil && !failed {
+		return false, fmt.Errorf("probe %q: %v", p.command, err)
+	}
+	result := "not reproduced"
+	if failed {
+		result = "reproduced"
+	}
+	log.Printf("test %d, %d of %d policies: %s", p.tests, len(subset), len(p.docs), result)
+	return failed, nil
+}
+
+// delete removes the policies of the given indexes from the cluster.
+func (p *clusterProbe) delete(ctx context.Context, indexes []int) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+	docs := make([]string, len(indexes))
+	for j, i := range indexes {
+		docs[j] = p.docs[i]
+		delete(p.applied, i)
+	}
+	_, err := kubectl(ctx, strings.NewReader(strings.Join(docs, "---\n")), "delete", "--ignore-not-found", "-f", "-")
+	return err
+}
+
+func runMinimize(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("minimize", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the generated policies")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	policyFile := fs.String("policyFile", "", "A YAML file of policies to minimize instead of the generated ones")
+	probe := fs.String("probe", "", "A shell command exiting with a non-zero status when the problem occurs, run after every apply")
+	settle := fs.Duration("settle", 30*time.Second, "The time to wait for the policies to take effect before running the probe")
+	outFile := fs.String("outFile", "minimal.yaml", "The file the minimal reproducing set of policies is written to")
+	_ = fs.Parse(args)
+
+	if *probe == "" {
+		return fmt.Errorf("-probe is required")
+	}
+	docs, err := loadPolicyDocuments(ctx, *scenarioName, *configFile, *policyFile)
+	if err != nil {
+		return err
+	}
+	p := &clusterProbe{docs: docs, command: *probe, settle: *settle, applied: make(map[int]bool)}
+	defer func() {
+		// Delete the policies even when interrupted, so that the cluster is left clean.
+		var applied []int
+		for i := range p.applied {
+			applied = append(applied, i)
+		}
+		if err := p.delete(context.Background(), applied); err != nil {
+			log.Printf("failed to delete the applied policies: %v", err)
+		}
+	}()
+
+	all := make([]int, len(docs))
+	for i := range all {
+		all[i] = i
+	}
+	ok, err := p.test(ctx, all)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("the probe does not reproduce the problem with the %d policies of the whole set", len(docs))
+	}
+
+	minimal, err := minimizeSet(ctx, len(docs), p.test)
+	// The smallest reproducing set found so far is written even when interrupted.
+	var minimalDocs []string
+	for _, i := range minimal {
+		minimalDocs = append(minimalDocs, docs[i])
+	}
+	if writeErr := ioutil.WriteFile(*outFile, []byte(strings.Join(minimalDocs, "---\n")), 0644); writeErr != nil {
+		return writeErr
+	}
+	if err != nil {
+		return fmt.Errorf("interrupted with %d reproducing policies, see %s: %v", len(minimal), *outFile, err)
+	}
+	fmt.Printf("%d of %d policies reproduce the problem after %d tests, see %s\n", len(minimal), len(docs), p.tests, *outFile)
+	return nil
+}
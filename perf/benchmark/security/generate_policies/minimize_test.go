@@ -0,0 +1,42 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestMinimizeSet(t *testing.T) {
+	// The problem occurs when the policies 3 and 17 are both applied.
+	tests := 0
+	minimal, err := minimizeSet(context.Background(), 40, func(_ context.Context, subset []int) (bool, error) {
+		tests++
+		found := 0
+		for _, i := range subset {
+			if i == 3 || i == 17 {
+				found++
+			}
+		}
+		return found == 2, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{3, 17}; !reflect.DeepEqual(minimal, want) {
+		t.Errorf("got %v after %d tests, want %v", minimal, tests, want)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+func runMintCert(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("mint-cert", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the generated policies, authZ.numPrincipals certs are minted")
+	caCert := fs.String("caCert", "ca-cert.pem", "The PEM file of the CA certificate, a self-signed CA is created if it does not exist")
+	caKey := fs.String("caKey", "ca-key.pem", "The PEM file of the CA key, created together with caCert")
+	outDir := fs.String("outDir", "certs", "The directory the client certificates and keys are written to")
+	validity := fs.Duration("validity", 24*time.Hour, "The validity of the client certificates")
+	_ = fs.Parse(args)
+
+	policyData, err := loadSecurityPolicy("", *configFile)
+	if err != nil {
+		return err
+	}
+	numPrincipals := policyData.AuthZ.NumPrincipals
+	if numPrincipals <= 0 {
+		return fmt.Errorf("invalid number of principals: %d", numPrincipals)
+	}
+	ca, caPrivateKey, err := loadOrCreateCA(*caCert, *caKey)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+	for i := 0; i < numPrincipals; i++ {
+		certPEM, keyPEM, err := mintSVID(ca, caPrivateKey, generatepolicies.PrincipalName(i), *validity)
+		if err != nil {
+			return err
+		}
+		base := filepath.Join(*outDir, fmt.Sprintf("principal-%d", i))
+		if err := ioutil.WriteFile(base+"-cert.pem", certPEM, 0644); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(base+"-key.pem", keyPEM, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mintSVID returns a client certificate whose URI SAN is the SPIFFE ID of principal, which
+// must have the trustDomain/ns/namespace/sa/serviceAccount form used in AuthorizationPolicies.
+func mintSVID(ca *x509.Certificate, caKey *rsa.PrivateKey, principal string, validity time.Duration) ([]byte, []byte, error) {
+	spiffeID, err := url.Parse("spiffe://" + principal)
+	if err != nil {
+		return nil, nil, err
+	}
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		URIs:         []*url.URL{spiffeID},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &privateKey.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	return certPEM, keyPEM, nil
+}
+
+// loadOrCreateCA loads the CA from certFile and keyFile, or creates a self-signed CA and writes
+// it to them if certFile does not exist. The mesh must trust the CA, e.g. by plugging it in as
+// the Istio root CA through the cacerts secret.
+func loadOrCreateCA(certFile, keyFile string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	certPEM, err := ioutil.ReadFile(certFile)
+	if err == nil {
+		block, _ := pem.Decode(certPEM)
+		if block == nil || block.Type != "CERTIFICATE" {
+			return nil, nil, fmt.Errorf("%s does not contain a PEM encoded certificate", certFile)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := generatepolicies.LoadOrCreateKey(keyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return cert, key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	key, err := generatepolicies.LoadOrCreateKey(keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"generate-policies"}, CommonName: "generate-policies root CA"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	return cert, key, err
+}
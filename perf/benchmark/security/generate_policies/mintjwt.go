@@ -0,0 +1,121 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// padClaim is the claim used to grow tokens to the requested size.
+const padClaim = "pad"
+
+func runMintJwt(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("mint-jwt", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the generated policies, used for the default key, issuer and claims")
+	keyFile := fs.String("keyFile", "", "The PEM file of the signing key. Default: requestAuthN.keyFile of the config")
+	issuer := fs.String("issuer", "", "The iss claim. Default: the issuer of the token accepted by the generated policies")
+	subject := fs.String("subject", "", "The sub claim. Default: subject")
+	claimsJSON := fs.String("claims", "", "Additional claims as a JSON object, e.g. {\"groups\":[\"member\"]}")
+	expiry := fs.Duration("expiry", 0, "Sets exp relative to now, a negative value mints an expired token. 0 omits exp")
+	size := fs.Int("size", 0, "Pads the token with a pad claim to at least this many bytes")
+	count := fs.Int("count", 1, "The number of tokens to mint, each with a unique jti claim if more than 1")
+	invalid := fs.Bool("invalid", false, "Signs the tokens with a new key, so that they are rejected")
+	header := fs.Bool("header", false, "Prints the tokens as Authorization headers, in the format of token.txt")
+	_ = fs.Parse(args)
+
+	policyData, err := loadSecurityPolicy("", *configFile)
+	if err != nil {
+		return err
+	}
+	if *keyFile == "" {
+		*keyFile = policyData.RequestAuthN.KeyFile
+	}
+	if *keyFile == "" {
+		return fmt.Errorf("keyFile is required, either as a flag or as requestAuthN.keyFile of the config")
+	}
+	privateKey, err := generatepolicies.SigningKey(*keyFile)
+	if err != nil {
+		return err
+	}
+	if *invalid {
+		if privateKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			return err
+		}
+	}
+
+	claims := generatepolicies.TokenClaims(policyData)
+	if *issuer != "" {
+		claims["iss"] = *issuer
+	}
+	if *subject != "" {
+		claims["sub"] = *subject
+	}
+	if *claimsJSON != "" {
+		extra := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(*claimsJSON), &extra); err != nil {
+			return fmt.Errorf("invalid claims: %v", err)
+		}
+		for k, v := range extra {
+			claims[k] = v
+		}
+	}
+	if *expiry != 0 {
+		claims["exp"] = time.Now().Add(*expiry).Unix()
+	}
+
+	for i := 0; i < *count; i++ {
+		if *count > 1 {
+			claims["jti"] = fmt.Sprintf("token-%d", i)
+		}
+		token, err := mintSizedToken(claims, privateKey, *size)
+		if err != nil {
+			return err
+		}
+		if *header {
+			fmt.Printf("\"Authorization\":\"Bearer %s\"\n", token)
+		} else {
+			fmt.Println(token)
+		}
+	}
+	return nil
+}
+
+// mintSizedToken signs claims, growing the pad claim until the token has at least size bytes.
+func mintSizedToken(claims map[string]interface{}, privateKey *rsa.PrivateKey, size int) (string, error) {
+	delete(claims, padClaim)
+	token, err := generatepolicies.SignToken(claims, privateKey)
+	if err != nil || len(token) >= size {
+		return token, err
+	}
+	// Every 3 bytes of the payload take 4 bytes once base64 encoded.
+	pad := (size - len(token)) * 3 / 4
+	for len(token) < size {
+		claims[padClaim] = strings.Repeat("x", pad)
+		if token, err = generatepolicies.SignToken(claims, privateKey); err != nil {
+			return "", err
+		}
+		pad++
+	}
+	return token, nil
+}
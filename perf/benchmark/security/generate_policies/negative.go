@@ -0,0 +1,198 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	authzpb "istio.io/api/security/v1beta1"
+	typepb "istio.io/api/type/v1beta1"
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// negativeCase is an AuthorizationPolicy the admission webhook must reject.
+type negativeCase struct {
+	name string
+	// invalidate makes a valid spec invalid.
+	invalidate func(spec *authzpb.AuthorizationPolicy)
+}
+
+var negativeCases = []negativeCase{
+	{"bad-cidr", func(spec *authzpb.AuthorizationPolicy) {
+		spec.Rules[0].From[0].Source.IpBlocks = []string{"10.0.0.0/33"}
+	}},
+	{"bad-ip", func(spec *authzpb.AuthorizationPolicy) {
+		spec.Rules[0].From[0].Source.RemoteIpBlocks = []string{"300.1.1.1"}
+	}},
+	{"bad-condition-cidr", func(spec *authzpb.AuthorizationPolicy) {
+		spec.Rules[0].When = []*authzpb.Condition{{Key: "source.ip", Values: []string{"10.0.0/8"}}}
+	}},
+	{"unknown-condition-key", func(spec *authzpb.AuthorizationPolicy) {
+		spec.Rules[0].When = []*authzpb.Condition{{Key: "request.unknown", Values: []string{"value"}}}
+	}},
+	{"condition-key-without-name", func(spec *authzpb.AuthorizationPolicy) {
+		spec.Rules[0].When = []*authzpb.Condition{{Key: "request.headers[]", Values: []string{"value"}}}
+	}},
+	{"condition-without-values", func(spec *authzpb.AuthorizationPolicy) {
+		spec.Rules[0].When = []*authzpb.Condition{{Key: "request.headers[x-token]"}}
+	}},
+	{"empty-source", func(spec *authzpb.AuthorizationPolicy) {
+		spec.Rules[0].From = []*authzpb.Rule_From{{Source: &authzpb.Source{}}}
+	}},
+	{"empty-operation", func(spec *authzpb.AuthorizationPolicy) {
+		spec.Rules[0].To = []*authzpb.Rule_To{{Operation: &authzpb.Operation{}}}
+	}},
+	{"empty-value", func(spec *authzpb.AuthorizationPolicy) {
+		spec.Rules[0].To[0].Operation.Paths = []string{""}
+	}},
+	{"invalid-method", func(spec *authzpb.AuthorizationPolicy) {
+		spec.Rules[0].To[0].Operation.Methods = []string{"FETCH"}
+	}},
+	{"custom-without-provider", func(spec *authzpb.AuthorizationPolicy) {
+		spec.Action = authzpb.AuthorizationPolicy_CUSTOM
+	}},
+	{"provider-without-custom", func(spec *authzpb.AuthorizationPolicy) {
+		spec.ActionDetail = &authzpb.AuthorizationPolicy_Provider{
+			Provider: &authzpb.AuthorizationPolicy_ExtensionProvider{Name: "ext-authz"},
+		}
+	}},
+	{"empty-label-key", func(spec *authzpb.AuthorizationPolicy) {
+		spec.Selector = &typepb.WorkloadSelector{MatchLabels: map[string]string{"": "fortioserver"}}
+	}},
+}
+
+// validNegativeBase returns the valid AuthorizationPolicy the negative cases invalidate.
+func validNegativeBase() *authzpb.AuthorizationPolicy {
+	return &authzpb.AuthorizationPolicy{
+		Action:   authzpb.AuthorizationPolicy_DENY,
+		Selector: &typepb.WorkloadSelector{MatchLabels: map[string]string{"app": "fortioserver"}},
+		Rules: []*authzpb.Rule{{
+			From: []*authzpb.Rule_From{{Source: &authzpb.Source{Principals: []string{generatepolicies.PrincipalName(0)}}}},
+			To:   []*authzpb.Rule_To{{Operation: &authzpb.Operation{Methods: []string{"GET"}, Paths: []string{"/invalid-path-0"}}}},
+		}},
+	}
+}
+
+// negativePolicy is a generated invalid policy with the error it must be rejected with.
+type negativePolicy struct {
+	Case      string `json:"case"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Error is the error of the validation of the tool, the admission webhook words it its own
+	// way.
+	Error string `json:"error"`
+	doc   string
+}
+
+// generateNegativePolicies returns count policies of each negative case.
+func generateNegativePolicies(namespace string, count int) ([]negativePolicy, error) {
+	var policies []negativePolicy
+	for _, c := range negativeCases {
+		spec := validNegativeBase()
+		c.invalidate(spec)
+		var pe *generatepolicies.PolicyError
+		if err := generatepolicies.ValidateAuthorizationPolicy(spec); !errors.As(err, &pe) {
+			return nil, fmt.Errorf("negative case %s is not rejected by the validation: %v", c.name, err)
+		}
+		expected := pe.Err.Error()
+		if pe.Rule >= 0 {
+			expected = fmt.Sprintf("rules[%d]: %s", pe.Rule, expected)
+		}
+
+		for i := 1; i <= count; i++ {
+			header := &generatepolicies.MyPolicy{
+				APIVersion: "security.istio.io/v1beta1",
+				Kind:       "AuthorizationPolicy",
+				Metadata:   generatepolicies.MetadataStruct{Namespace: namespace, Name: fmt.Sprintf("negative-%s-%d", c.name, i)},
+			}
+			doc, err := generatepolicies.PolicyToYAML(header, spec)
+			if err != nil {
+				return nil, err
+			}
+			policies = append(policies, negativePolicy{
+				Case:      c.name,
+				Namespace: namespace,
+				Name:      header.Metadata.Name,
+				Error:     expected,
+				doc:       doc,
+			})
+		}
+	}
+	return policies, nil
+}
+
+// checkNegativePolicies submits the policies to the admission webhook of the cluster with a
+// server side dry run, and fails when some of them are admitted.
+func checkNegativePolicies(ctx context.Context, policies []negativePolicy) error {
+	admitted := 0
+	for _, p := range policies {
+		_, err := kubectl(ctx, strings.NewReader(p.doc), "apply", "--dry-run=server", "-f", "-")
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			admitted++
+			fmt.Printf("ADMITTED %s/%s, expected: %s\n", p.Namespace, p.Name, p.Error)
+			continue
+		}
+		fmt.Printf("rejected %s/%s: %v\n", p.Namespace, p.Name, err)
+	}
+	fmt.Printf("%d of %d invalid policies rejected\n", len(policies)-admitted, len(policies))
+	if admitted > 0 {
+		return fmt.Errorf("%d invalid policies were admitted", admitted)
+	}
+	return nil
+}
+
+func runNegative(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("negative", flag.ExitOnError)
+	namespace := fs.String("namespace", generatepolicies.DefaultNamespace, "The namespace of the invalid policies")
+	count := fs.Int("count", 1, "The number of policies of every negative case")
+	expectFile := fs.String("expectFile", "", "A JSON file the expected error of every policy is written to")
+	check := fs.Bool("check", false, "Submit the policies to the cluster with a server side dry run instead of printing them, and fail when one is admitted")
+	_ = fs.Parse(args)
+
+	if *count < 1 {
+		return fmt.Errorf("-count must be at least 1, got %d", *count)
+	}
+	policies, err := generateNegativePolicies(*namespace, *count)
+	if err != nil {
+		return err
+	}
+	if *expectFile != "" {
+		js, err := json.MarshalIndent(policies, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(*expectFile, js, 0644); err != nil {
+			return err
+		}
+	}
+	if *check {
+		return checkNegativePolicies(ctx, policies)
+	}
+	for _, p := range policies {
+		fmt.Println("# expect: " + p.Error + "\n" + p.doc + "---")
+	}
+	fmt.Fprintf(os.Stderr, "wrote %d invalid policies of %d cases\n", len(policies), len(negativeCases))
+	return nil
+}
@@ -0,0 +1,42 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+func TestNegativePolicies(t *testing.T) {
+	policies, err := generateNegativePolicies("negative", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(policies), 2*len(negativeCases); got != want {
+		t.Fatalf("got %d policies, want %d", got, want)
+	}
+	// The invalid policies must still parse, so that the admission webhook rejects them rather
+	// than kubectl.
+	for _, p := range policies {
+		parsed, err := parseAuthorizationPolicies([]string{p.doc})
+		if err != nil {
+			t.Fatalf("%s: %v", p.Name, err)
+		}
+		if err := generatepolicies.ValidateAuthorizationPolicy(parsed[0].Spec); err == nil {
+			t.Errorf("%s: parsed policy is valid, want %s", p.Name, p.Error)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	authzpb "istio.io/api/security/v1beta1"
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// namespaceNameLabel is the label the API server sets on every namespace to its name.
+const namespaceNameLabel = "kubernetes.io/metadata.name"
+
+// networkPolicy is a networking.k8s.io/v1 NetworkPolicy.
+type networkPolicy struct {
+	generatepolicies.MyPolicy
+	Spec networkPolicySpec `json:"spec"`
+}
+
+type networkPolicySpec struct {
+	PodSelector labelSelector              `json:"podSelector"`
+	PolicyTypes []string                   `json:"policyTypes"`
+	Ingress     []networkPolicyIngressRule `json:"ingress,omitempty"`
+	// Egress is only read from imported NetworkPolicies, AuthorizationPolicies do not control
+	// the egress traffic.
+	Egress []json.RawMessage `json:"egress,omitempty"`
+}
+
+type labelSelector struct {
+	MatchLabels      map[string]string          `json:"matchLabels,omitempty"`
+	MatchExpressions []labelSelectorRequirement `json:"matchExpressions,omitempty"`
+}
+
+type labelSelectorRequirement struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+}
+
+type networkPolicyIngressRule struct {
+	From  []networkPolicyPeer `json:"from,omitempty"`
+	Ports []networkPolicyPort `json:"ports,omitempty"`
+}
+
+type networkPolicyPeer struct {
+	IPBlock           *networkPolicyIPBlock `json:"ipBlock,omitempty"`
+	NamespaceSelector *labelSelector        `json:"namespaceSelector,omitempty"`
+	PodSelector       *labelSelector        `json:"podSelector,omitempty"`
+}
+
+type networkPolicyIPBlock struct {
+	CIDR   string   `json:"cidr"`
+	Except []string `json:"except,omitempty"`
+}
+
+type networkPolicyPort struct {
+	Protocol string `json:"protocol,omitempty"`
+	// Port is the number or the name of the port.
+	Port    interface{} `json:"port,omitempty"`
+	EndPort int         `json:"endPort,omitempty"`
+}
+
+// networkPolicyConversion counts what toNetworkPolicies could not convert exactly.
+type networkPolicyConversion struct {
+	// skipped are the policies without a NetworkPolicy equivalent: DENY, AUDIT and CUSTOM
+	// policies, and the policies of the root namespace.
+	skipped int
+	// approximated are the rules whose NetworkPolicy ingress rules allow more than them.
+	approximated int
+}
+
+// toNetworkPolicies returns the NetworkPolicies closest to the L3/L4 part of the ALLOW
+// AuthorizationPolicies. Every clause of a rule, see ruleClauses, becomes an ingress rule: the
+// source IPs, the source namespaces, or the namespaces of the source principals as peers, and
+// the destination ports. NetworkPolicies cannot express the other constraints, the negations and
+// the conjunctions of several source attributes, which are dropped: the NetworkPolicies allow
+// the L4 traffic of every request the AuthorizationPolicies allow, and possibly more.
+func toNetworkPolicies(policies []parsedAuthorizationPolicy, rootNamespace string) ([]networkPolicy, networkPolicyConversion) {
+	var conversion networkPolicyConversion
+	var out []networkPolicy
+	for _, p := range policies {
+		if p.Spec.Action != authzpb.AuthorizationPolicy_ALLOW || p.Namespace == rootNamespace {
+			conversion.skipped++
+			continue
+		}
+		np := networkPolicy{
+			MyPolicy: generatepolicies.MyPolicy{
+				APIVersion: "networking.k8s.io/v1",
+				Kind:       "NetworkPolicy",
+				Metadata:   generatepolicies.MetadataStruct{Name: p.Name, Namespace: p.Namespace},
+			},
+			Spec: networkPolicySpec{
+				PodSelector: labelSelector{MatchLabels: p.Spec.GetSelector().GetMatchLabels()},
+				PolicyTypes: []string{"Ingress"},
+			},
+		}
+		for _, rule := range p.Spec.Rules {
+			approximated := false
+			for _, c := range ruleClauses(rule) {
+				ingress, exact := clauseIngressRule(c)
+				np.Spec.Ingress = append(np.Spec.Ingress, ingress)
+				approximated = approximated || !exact
+			}
+			if approximated {
+				conversion.approximated++
+			}
+		}
+		out = append(out, np)
+	}
+	return out, conversion
+}
+
+// clauseIngressRule returns the ingress rule allowing the L4 traffic of the requests matching c,
+// and whether it allows exactly them.
+func clauseIngressRule(c clause) (networkPolicyIngressRule, bool) {
+	var ingress networkPolicyIngressRule
+	exact := true
+	// Peers are ORed, so a single source attribute is converted, the most precise one.
+	var source *constraint
+	for _, attribute := range []string{"source.ip", "source.namespace", "source.principal"} {
+		for i := range c {
+			if c[i].attribute == attribute && !c[i].not && source == nil {
+				source = &c[i]
+			}
+		}
+	}
+	for i := range c {
+		switch {
+		case &c[i] == source:
+			for _, value := range c[i].values {
+				peer, ok := networkPolicyPeerOf(c[i].attribute, value)
+				ingress.From = append(ingress.From, peer)
+				exact = exact && ok
+			}
+		case c[i].attribute == "destination.port" && !c[i].not && ingress.Ports == nil:
+			for _, value := range c[i].values {
+				port, err := strconv.Atoi(value)
+				if err != nil {
+					// Every port.
+					ingress.Ports, exact = nil, false
+					break
+				}
+				ingress.Ports = append(ingress.Ports, networkPolicyPort{Protocol: "TCP", Port: port})
+			}
+		default:
+			exact = false
+		}
+	}
+	return ingress, exact
+}
+
+// networkPolicyPeerOf returns the peer matching the sources of the value of a source attribute,
+// and whether it matches exactly them.
+func networkPolicyPeerOf(attribute, value string) (networkPolicyPeer, bool) {
+	anyNamespace := networkPolicyPeer{NamespaceSelector: &labelSelector{}}
+	switch attribute {
+	case "source.ip":
+		if network := parseIPBlock(value); network != nil {
+			return networkPolicyPeer{IPBlock: &networkPolicyIPBlock{CIDR: network.String()}}, true
+		}
+		return anyNamespace, false
+	case "source.namespace":
+		if strings.Contains(value, "*") {
+			return anyNamespace, value == "*"
+		}
+		return namespacePeer(value), true
+	default:
+		// Principals are <trust domain>/ns/<namespace>/sa/<service account>, a NetworkPolicy
+		// only selects their namespace.
+		i := strings.Index(value, "/ns/")
+		if i < 0 {
+			return anyNamespace, value == "*"
+		}
+		namespace := strings.SplitN(value[i+len("/ns/"):], "/", 2)[0]
+		if namespace == "" || strings.Contains(namespace, "*") {
+			return anyNamespace, false
+		}
+		return namespacePeer(namespace), false
+	}
+}
+
+func namespacePeer(namespace string) networkPolicyPeer {
+	return networkPolicyPeer{NamespaceSelector: &labelSelector{MatchLabels: map[string]string{namespaceNameLabel: namespace}}}
+}
+
+// networkPoliciesYAML returns the YAML documents of the NetworkPolicies converted from the
+// AuthorizationPolicies of docs, and a summary of the conversion.
+func networkPoliciesYAML(docs []string, rootNamespace string) ([]string, string, error) {
+	policies, err := parseAuthorizationPolicies(docs)
+	if err != nil {
+		return nil, "", err
+	}
+	converted, conversion := toNetworkPolicies(policies, rootNamespace)
+	out := make([]string, len(converted))
+	for i, np := range converted {
+		doc, err := yaml.Marshal(np)
+		if err != nil {
+			return nil, "", err
+		}
+		out[i] = string(doc)
+	}
+	summary := fmt.Sprintf("converted %d of %d AuthorizationPolicies to NetworkPolicies, skipped %d without an equivalent, %d rules allow more than the original ones",
+		len(converted), len(policies), conversion.skipped, conversion.approximated)
+	return out, summary, nil
+}
@@ -0,0 +1,118 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNetworkPoliciesYAML(t *testing.T) {
+	docs := splitYAMLDocuments(`
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: allow
+  namespace: ns
+spec:
+  selector:
+    matchLabels:
+      app: a
+  rules:
+  - from:
+    - source:
+        ipBlocks: ["10.0.0.1", "10.1.0.0/16"]
+    - source:
+        principals: ["cluster.local/ns/other/sa/sleep"]
+    to:
+    - operation:
+        ports: ["8080"]
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: allow-nothing
+  namespace: ns
+spec: {}
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: deny
+  namespace: ns
+spec:
+  action: DENY
+  rules:
+  - {}
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: mesh
+  namespace: istio-system
+spec:
+  rules:
+  - {}
+`)
+	got, summary, err := networkPoliciesYAML(docs, "istio-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: allow
+  namespace: ns
+spec:
+  ingress:
+  - from:
+    - ipBlock:
+        cidr: 10.0.0.1/32
+    - ipBlock:
+        cidr: 10.1.0.0/16
+    ports:
+    - port: 8080
+      protocol: TCP
+  - from:
+    - namespaceSelector:
+        matchLabels:
+          kubernetes.io/metadata.name: other
+    ports:
+    - port: 8080
+      protocol: TCP
+  podSelector:
+    matchLabels:
+      app: a
+  policyTypes:
+  - Ingress
+`, `apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: allow-nothing
+  namespace: ns
+spec:
+  podSelector: {}
+  policyTypes:
+  - Ingress
+`}
+	if strings.Join(got, "---\n") != strings.Join(want, "---\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "---\n"), strings.Join(want, "---\n"))
+	}
+	// The principal is only converted to its namespace, and the DENY and root namespace policies
+	// have no equivalent.
+	if wantSummary := "converted 2 of 4 AuthorizationPolicies to NetworkPolicies, skipped 2 without an equivalent, 1 rules allow more than the original ones"; summary != wantSummary {
+		t.Errorf("got summary %q, want %q", summary, wantSummary)
+	}
+}
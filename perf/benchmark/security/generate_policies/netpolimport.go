@@ -0,0 +1,201 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	authzpb "istio.io/api/security/v1beta1"
+	typepb "istio.io/api/type/v1beta1"
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// networkPolicyImport counts what fromNetworkPolicies could not convert exactly.
+type networkPolicyImport struct {
+	// skipped are the NetworkPolicies without ingress policy type, or selecting their pods with
+	// expressions, which AuthorizationPolicy selectors do not support.
+	skipped int
+	// approximated are the ingress rules whose AuthorizationPolicy rules allow more than them.
+	approximated int
+	// dropped are the egress rules and the non TCP ports, which AuthorizationPolicies do not
+	// control.
+	dropped int
+}
+
+// fromNetworkPolicies returns the ALLOW AuthorizationPolicies closest to the ingress rules of
+// the NetworkPolicies, with the same name, namespace and selector. An ingress rule becomes an
+// AuthorizationPolicy rule with a source per peer, the ipBlocks and the namespaces selected by
+// name, and the TCP ports, port ranges of at most maxPortRange ports expanded. The peers selected
+// by labels, namespace labels or pod labels, become every namespace or the namespace of the
+// policy, and the named ports and larger port ranges every port, which allow more.
+func fromNetworkPolicies(policies []networkPolicy, maxPortRange int) ([]generatepolicies.Resource, networkPolicyImport) {
+	var conversion networkPolicyImport
+	var out []generatepolicies.Resource
+	for _, np := range policies {
+		ingress := len(np.Spec.PolicyTypes) == 0
+		for _, policyType := range np.Spec.PolicyTypes {
+			ingress = ingress || policyType == "Ingress"
+		}
+		conversion.dropped += len(np.Spec.Egress)
+		if !ingress || len(np.Spec.PodSelector.MatchExpressions) > 0 {
+			conversion.skipped++
+			continue
+		}
+		spec := &authzpb.AuthorizationPolicy{Action: authzpb.AuthorizationPolicy_ALLOW}
+		if labels := np.Spec.PodSelector.MatchLabels; len(labels) > 0 {
+			spec.Selector = &typepb.WorkloadSelector{MatchLabels: labels}
+		}
+		for _, ingressRule := range np.Spec.Ingress {
+			rule, exact, dropped := authorizationRule(ingressRule, np.Metadata.Namespace, maxPortRange)
+			if rule == nil {
+				// Only non TCP ports, no request is allowed.
+				conversion.dropped += dropped
+				continue
+			}
+			spec.Rules = append(spec.Rules, rule)
+			conversion.dropped += dropped
+			if !exact {
+				conversion.approximated++
+			}
+		}
+		header := np.MyPolicy
+		header.APIVersion = "security.istio.io/v1beta1"
+		header.Kind = "AuthorizationPolicy"
+		out = append(out, generatepolicies.Resource{MyPolicy: header, Spec: spec})
+	}
+	return out, conversion
+}
+
+// authorizationRule returns the rule allowing the requests allowed by r, a rule of a
+// NetworkPolicy of namespace, whether it allows exactly them, and the number of its non TCP ports
+// it drops. It returns a nil rule when r only allows non TCP ports.
+func authorizationRule(r networkPolicyIngressRule, namespace string, maxPortRange int) (*authzpb.Rule, bool, int) {
+	rule := &authzpb.Rule{}
+	exact := true
+	for _, peer := range r.From {
+		source := &authzpb.Source{}
+		switch {
+		case peer.IPBlock != nil:
+			source.IpBlocks = []string{peer.IPBlock.CIDR}
+			source.NotIpBlocks = peer.IPBlock.Except
+		case peer.NamespaceSelector != nil:
+			name, ok := peer.NamespaceSelector.MatchLabels[namespaceNameLabel]
+			if !ok || len(peer.NamespaceSelector.MatchLabels) > 1 || len(peer.NamespaceSelector.MatchExpressions) > 0 {
+				name = "*"
+				exact = exact && len(peer.NamespaceSelector.MatchLabels) == 0 && len(peer.NamespaceSelector.MatchExpressions) == 0
+			}
+			source.Namespaces = []string{name}
+			exact = exact && peer.PodSelector == nil
+		default:
+			// The pods of the namespace selected by labels.
+			source.Namespaces = []string{namespace}
+			exact = false
+		}
+		rule.From = append(rule.From, &authzpb.Rule_From{Source: source})
+	}
+
+	var ports []string
+	dropped := 0
+	anyPort := len(r.Ports) == 0
+	for _, port := range r.Ports {
+		if port.Protocol != "" && port.Protocol != "TCP" {
+			dropped++
+			continue
+		}
+		number, ok := port.Port.(float64)
+		switch {
+		case port.Port == nil:
+			// Every port.
+			anyPort = true
+		case !ok || port.EndPort-int(number) >= maxPortRange:
+			// A named port, resolved by the pods, or a large range.
+			anyPort, exact = true, false
+		default:
+			ports = append(ports, strconv.Itoa(int(number)))
+			for p := int(number) + 1; p <= port.EndPort; p++ {
+				ports = append(ports, strconv.Itoa(p))
+			}
+		}
+	}
+	switch {
+	case anyPort:
+	case len(ports) == 0:
+		return nil, exact, dropped
+	default:
+		rule.To = []*authzpb.Rule_To{{Operation: &authzpb.Operation{Ports: ports}}}
+	}
+	return rule, exact, dropped
+}
+
+// parseNetworkPolicies returns the NetworkPolicies of objects.
+func parseNetworkPolicies(objects []policyObject) ([]networkPolicy, error) {
+	policies := make([]networkPolicy, len(objects))
+	for i, o := range objects {
+		js, err := json.Marshal(o.Spec)
+		if err != nil {
+			return nil, err
+		}
+		policies[i].MyPolicy = generatepolicies.MyPolicy{
+			APIVersion: o.APIVersion,
+			Kind:       o.Kind,
+			Metadata:   generatepolicies.MetadataStruct{Name: o.Name, Namespace: o.Namespace},
+		}
+		if err := json.Unmarshal(js, &policies[i].Spec); err != nil {
+			return nil, fmt.Errorf("%s: %v", o, err)
+		}
+	}
+	return policies, nil
+}
+
+func runImportNetworkPolicies(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import-networkpolicies", flag.ExitOnError)
+	dir := fs.String("dir", "", "A YAML file or a directory of YAML files of NetworkPolicies to import instead of the ones of the cluster")
+	maxPortRange := fs.Int("maxPortRange", 256, "Port ranges of more ports allow every port instead of being expanded")
+	validateSchema := fs.Bool("validateSchema", false, "Validate the AuthorizationPolicies against the OpenAPI schema of their CRD")
+	schemaFile := fs.String("schemaFile", "", "A path or URL of the CRDs to validate against, defaults to the bundled security.istio.io CRDs")
+	_ = fs.Parse(args)
+
+	objects, err := importObjects(ctx, *dir, map[string]bool{"NetworkPolicy": true}, "networkpolicies.networking.k8s.io")
+	if err != nil {
+		return err
+	}
+	policies, err := parseNetworkPolicies(objects)
+	if err != nil {
+		return err
+	}
+	resources, conversion := fromNetworkPolicies(policies, *maxPortRange)
+	docs := make([]string, len(resources))
+	for i, r := range resources {
+		if docs[i], err = r.YAML(); err != nil {
+			return err
+		}
+	}
+	if *validateSchema {
+		if err := validateSchemas(docs, *schemaFile); err != nil {
+			return err
+		}
+	}
+	for _, doc := range docs {
+		fmt.Println(doc + "---")
+	}
+	fmt.Fprintf(os.Stderr, "converted %d of %d NetworkPolicies to AuthorizationPolicies, skipped %d, %d rules allow more than the original ones, dropped %d egress rules and non TCP ports\n",
+		len(resources), len(policies), conversion.skipped, conversion.approximated, conversion.dropped)
+	return nil
+}
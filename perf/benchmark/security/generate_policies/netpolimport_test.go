@@ -0,0 +1,145 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+func TestFromNetworkPolicies(t *testing.T) {
+	objects, err := parsePolicyObjects(splitYAMLDocuments(`
+apiVersion: v1
+kind: List
+items:
+- apiVersion: networking.k8s.io/v1
+  kind: NetworkPolicy
+  metadata:
+    name: web
+    namespace: shop
+  spec:
+    podSelector:
+      matchLabels:
+        app: web
+    policyTypes: [Ingress, Egress]
+    ingress:
+    - from:
+      - ipBlock:
+          cidr: 10.0.0.0/16
+          except: [10.0.1.0/24]
+      - namespaceSelector:
+          matchLabels:
+            kubernetes.io/metadata.name: frontend
+      ports:
+      - port: 8080
+      - port: 9000
+        endPort: 9002
+      - port: 53
+        protocol: UDP
+    # The pods of the namespace, selected by labels.
+    - from:
+      - podSelector:
+          matchLabels:
+            app: cache
+    egress:
+    - {}
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: default-deny
+  namespace: shop
+spec:
+  podSelector: {}
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: egress-only
+  namespace: shop
+spec:
+  podSelector: {}
+  policyTypes: [Egress]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policies, err := parseNetworkPolicies(objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources, conversion := fromNetworkPolicies(policies, 256)
+	var docs []string
+	for _, r := range resources {
+		doc, err := r.YAML()
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, doc)
+	}
+	want := `apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: web
+  namespace: shop
+spec:
+  rules:
+  - from:
+    - source:
+        ipBlocks:
+        - 10.0.0.0/16
+        notIpBlocks:
+        - 10.0.1.0/24
+    - source:
+        namespaces:
+        - frontend
+    to:
+    - operation:
+        ports:
+        - "8080"
+        - "9000"
+        - "9001"
+        - "9002"
+  - from:
+    - source:
+        namespaces:
+        - shop
+  selector:
+    matchLabels:
+      app: web
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: default-deny
+  namespace: shop
+spec: {}
+`
+	if got := strings.Join(docs, "---\n"); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if conversion.skipped != 1 || conversion.approximated != 1 || conversion.dropped != 2 {
+		t.Errorf("got %d skipped, %d approximated and %d dropped, want 1, 1 and 2", conversion.skipped, conversion.approximated, conversion.dropped)
+	}
+
+	// A range larger than maxPortRange allows every port.
+	resources, conversion = fromNetworkPolicies(policies[:1], 2)
+	rule := resources[0].Spec.(*authzpb.AuthorizationPolicy).Rules[0]
+	if len(rule.To) > 0 || conversion.approximated != 2 {
+		t.Errorf("got rule %v with %d approximated rules, want every port and 2 approximated rules", rule, conversion.approximated)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// runLabel names the run of the parent ConfigMaps owning the policies of a corpus.
+const runLabel = "generate-policies.istio.io/run"
+
+// ownerReference is the ownerReference of an object to the parent ConfigMap of its run.
+type ownerReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	UID        string `json:"uid"`
+}
+
+// runConfigMap returns the parent ConfigMap of the policies of the run name in namespace.
+func runConfigMap(namespace, name, generation string) (string, error) {
+	data, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+			"labels":    map[string]string{runLabel: name},
+		},
+		"data": map[string]string{"generation": generation},
+	})
+	return string(data), err
+}
+
+// docNamespaces returns the sorted namespaces of the namespaced objects of docs.
+func docNamespaces(docs []string) ([]string, error) {
+	seen := map[string]bool{}
+	for _, doc := range docs {
+		var object struct {
+			Metadata struct {
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+		}
+		if err := yaml.Unmarshal([]byte(doc), &object); err != nil {
+			return nil, err
+		}
+		if object.Metadata.Namespace != "" {
+			seen[object.Metadata.Namespace] = true
+		}
+	}
+	namespaces := make([]string, 0, len(seen))
+	for ns := range seen {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// namespaceDocs returns the Namespace documents of docs.
+func namespaceDocs(docs []string) ([]string, error) {
+	var namespaces []string
+	for _, doc := range docs {
+		var object struct {
+			Kind string `json:"kind"`
+		}
+		if err := yaml.Unmarshal([]byte(doc), &object); err != nil {
+			return nil, err
+		}
+		if object.Kind == "Namespace" {
+			namespaces = append(namespaces, doc)
+		}
+	}
+	return namespaces, nil
+}
+
+// createRunOwners applies the parent ConfigMap of the run name to every namespace of docs and
+// returns their ownerReferences by namespace. Kubernetes does not garbage collect namespaced
+// objects owned by an object of another namespace, so every namespace has a parent of its own.
+// The Namespaces created by docs are applied first, since the parents are created in them.
+func createRunOwners(ctx context.Context, name, generation string, docs []string) (map[string]ownerReference, error) {
+	namespaces, err := docNamespaces(docs)
+	if err != nil {
+		return nil, err
+	}
+	created, err := namespaceDocs(docs)
+	if err != nil {
+		return nil, err
+	}
+	if len(created) > 0 {
+		if err := kubectlApply(ctx, created); err != nil {
+			return nil, err
+		}
+	}
+	var parents []string
+	for _, ns := range namespaces {
+		doc, err := runConfigMap(ns, name, generation)
+		if err != nil {
+			return nil, err
+		}
+		parents = append(parents, doc)
+	}
+	if err := kubectlApply(ctx, parents); err != nil {
+		return nil, err
+	}
+	owners := map[string]ownerReference{}
+	for _, ns := range namespaces {
+		out, err := kubectl(ctx, nil, "-n", ns, "get", "configmap", name, "-o", "jsonpath={.metadata.uid}")
+		if err != nil {
+			return nil, err
+		}
+		uid := strings.TrimSpace(string(out))
+		if uid == "" {
+			return nil, fmt.Errorf("configmap %s/%s has no uid", ns, name)
+		}
+		owners[ns] = ownerReference{APIVersion: "v1", Kind: "ConfigMap", Name: name, UID: uid}
+	}
+	return owners, nil
+}
+
+// setOwner returns doc owned by the owner of its namespace. Cluster scoped objects, which a
+// namespaced owner cannot own, are returned unchanged.
+func setOwner(doc string, owners map[string]ownerReference) (string, error) {
+	object := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(doc), &object); err != nil {
+		return "", err
+	}
+	metadata, _ := object["metadata"].(map[string]interface{})
+	namespace, _ := metadata["namespace"].(string)
+	if namespace == "" {
+		return doc, nil
+	}
+	owner, ok := owners[namespace]
+	if !ok {
+		return "", fmt.Errorf("no owner in namespace %s", namespace)
+	}
+	refs, _ := metadata["ownerReferences"].([]interface{})
+	metadata["ownerReferences"] = append(refs, owner)
+	out, err := yaml.Marshal(object)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
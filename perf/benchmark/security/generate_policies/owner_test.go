@@ -0,0 +1,116 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+func TestSetOwner(t *testing.T) {
+	docs := []string{
+		"apiVersion: security.istio.io/v1beta1\nkind: AuthorizationPolicy\nmetadata:\n  name: a\n  namespace: ns-2\n",
+		"apiVersion: security.istio.io/v1beta1\nkind: AuthorizationPolicy\nmetadata:\n  name: b\n  namespace: ns-1\n",
+		"apiVersion: v1\nkind: Namespace\nmetadata:\n  name: ns-1\n",
+	}
+	namespaces, err := docNamespaces(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(namespaces, []string{"ns-1", "ns-2"}) {
+		t.Errorf("got namespaces %v, want ns-1 and ns-2", namespaces)
+	}
+
+	owners := map[string]ownerReference{
+		"ns-1": {APIVersion: "v1", Kind: "ConfigMap", Name: "run-1", UID: "uid-1"},
+		"ns-2": {APIVersion: "v1", Kind: "ConfigMap", Name: "run-1", UID: "uid-2"},
+	}
+	owned, err := setOwner(docs[0], owners)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects, err := parsePolicyObjects([]string{owned})
+	if err != nil || len(objects) != 1 || objects[0].Name != "a" {
+		t.Fatalf("got %v, err %v, want policy a", objects, err)
+	}
+	for _, want := range []string{"ownerReferences:", "kind: ConfigMap", "name: run-1", "uid: uid-2"} {
+		if !strings.Contains(owned, want) {
+			t.Errorf("owned policy has no %q:\n%s", want, owned)
+		}
+	}
+	// A namespaced owner cannot own a cluster scoped object.
+	if got, err := setOwner(docs[2], owners); err != nil || got != docs[2] {
+		t.Errorf("got %q, err %v, want the namespace unchanged", got, err)
+	}
+	if _, err := setOwner(docs[0], map[string]ownerReference{}); err == nil {
+		t.Error("got no error without an owner in the namespace")
+	}
+
+	cm, err := runConfigMap("ns-1", "run-1", "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(cm, runLabel+": run-1") || !strings.Contains(cm, "generation: abc") {
+		t.Errorf("unexpected ConfigMap:\n%s", cm)
+	}
+}
+
+func TestCreateRunOwnersNamespaces(t *testing.T) {
+	dir := t.TempDir()
+	// The fake kubectl logs its stdin and answers every get with a uid.
+	script := "#!/bin/sh\nif [ \"$1\" = apply ]; then cat >> " + filepath.Join(dir, "applied.yaml") + "; echo '#' >> " +
+		filepath.Join(dir, "applied.yaml") + "; else echo uid-1; fi\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(path string) { os.Setenv("PATH", path) }(os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	policyData := generatepolicies.SecurityPolicy{
+		NamespaceIsolation: &generatepolicies.NamespaceIsolation{NumNamespaces: 2, Namespaces: true},
+	}
+	docs, err := generateDocuments(context.Background(), policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owners, err := createRunOwners(context.Background(), "run-1", "1", docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(owners) != 2 {
+		t.Errorf("got owners in %d namespaces, want 2", len(owners))
+	}
+	applied, err := ioutil.ReadFile(filepath.Join(dir, "applied.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	batches := strings.Split(strings.TrimSuffix(string(applied), "#\n"), "#\n")
+	if len(batches) != 2 {
+		t.Fatalf("got %d kubectl apply, want the Namespaces then the ConfigMaps", len(batches))
+	}
+	if strings.Count(batches[0], "kind: Namespace") != 2 || strings.Contains(batches[0], "kind: ConfigMap") {
+		t.Errorf("the first apply is not the Namespaces of the corpus:\n%s", batches[0])
+	}
+	if strings.Count(batches[1], "kind: ConfigMap") != 2 {
+		t.Errorf("the second apply is not the ConfigMaps of the namespaces:\n%s", batches[1])
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	authzpb "istio.io/api/security/v1beta1"
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// pathNormalizations are the values of the pathNormalization.normalization field of MeshConfig,
+// from the least to the most normalizing.
+var pathNormalizations = []string{"NONE", "BASE", "MERGE_SLASHES", "DECODE_AND_MERGE_SLASHES"}
+
+// pathCase derives an edge case request path from a protected path with at least two segments.
+type pathCase struct {
+	name    string
+	variant func(segments []string) string
+}
+
+func joinSegments(segments []string, sep string) string {
+	return "/" + strings.Join(segments, sep)
+}
+
+var pathCases = []pathCase{
+	{"exact", func(s []string) string { return joinSegments(s, "/") }},
+	{"trailing-slash", func(s []string) string { return joinSegments(s, "/") + "/" }},
+	{"double-slash", func(s []string) string { return "/" + joinSegments(s, "//") }},
+	{"encoded-slash", func(s []string) string { return joinSegments(s, "%2F") }},
+	{"encoded-slash-lower", func(s []string) string { return joinSegments(s, "%2f") }},
+	{"encoded-backslash", func(s []string) string { return joinSegments(s, "%5C") }},
+	{"dot-segment", func(s []string) string { return joinSegments(s, "/./") }},
+	{"dot-dot-segment", func(s []string) string { return joinSegments(s, "/x/../") }},
+	{"encoded-dot-segment", func(s []string) string { return joinSegments(s, "/%2e/") }},
+	{"encoded-dot-dot-segment", func(s []string) string { return joinSegments(s, "/x/%2E%2e/") }},
+	{"encoded-unreserved", func(s []string) string {
+		return fmt.Sprintf("/%%%02X", s[0][0]) + joinSegments(s, "/")[2:]
+	}},
+	{"upper-case", func(s []string) string { return strings.ToUpper(joinSegments(s, "/")) }},
+	{"query", func(s []string) string { return joinSegments(s, "/") + "?debug=1" }},
+}
+
+var slashesRegexp = regexp.MustCompile(`/{2,}`)
+
+// normalizePath returns the path AuthorizationPolicy paths are matched against when the mesh
+// uses normalization. It models Envoy's normalize_path (RFC 3986 normalization with backslashes
+// turned into slashes, as canonicalized by the Chromium URL library), merge_slashes and
+// path_with_escaped_slashes_action UNESCAPE_AND_FORWARD, the settings the normalizations map to.
+// The query is never part of the matched path.
+func normalizePath(path, normalization string) string {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	if normalization == "NONE" {
+		return path
+	}
+	if normalization == "DECODE_AND_MERGE_SLASHES" {
+		path = strings.NewReplacer("%2F", "/", "%2f", "/", "%5C", `\`, "%5c", `\`).Replace(path)
+	}
+	path = removeDotSegments(decodeUnreserved(strings.Replace(path, `\`, "/", -1)))
+	if normalization != "BASE" {
+		path = slashesRegexp.ReplaceAllString(path, "/")
+	}
+	return path
+}
+
+// decodeUnreserved decodes the percent-encoded unreserved characters of path and upper cases
+// the hex digits of the other percent-encodings.
+func decodeUnreserved(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '%' && i+2 < len(path) {
+			if c, err := strconv.ParseUint(path[i+1:i+3], 16, 8); err == nil {
+				if isUnreserved(byte(c)) {
+					b.WriteByte(byte(c))
+				} else {
+					b.WriteString(strings.ToUpper(path[i : i+3]))
+				}
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0
+}
+
+// removeDotSegments removes the "." and ".." segments of an absolute path as RFC 3986 section
+// 5.2.4 does.
+func removeDotSegments(path string) string {
+	segments := strings.Split(path, "/")[1:]
+	var out []string
+	for i, s := range segments {
+		last := i == len(segments)-1
+		switch s {
+		case ".":
+		case "..":
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, s)
+			continue
+		}
+		if last {
+			out = append(out, "")
+		}
+	}
+	return "/" + strings.Join(out, "/")
+}
+
+// pathNormalizationCase is one edge case request of the matrix, with the path it is matched as
+// and the decision expected under every normalization.
+type pathNormalizationCase struct {
+	Case       string            `json:"case"`
+	Protected  string            `json:"protected"`
+	Path       string            `json:"path"`
+	Normalized map[string]string `json:"normalized"`
+	Expect     map[string]string `json:"expect"`
+}
+
+// pathNormalizationPolicy returns the policy protecting paths with action.
+func pathNormalizationPolicy(namespace string, action authzpb.AuthorizationPolicy_Action, paths []string) parsedAuthorizationPolicy {
+	return parsedAuthorizationPolicy{
+		Name:      "path-normalization-" + strings.ToLower(action.String()),
+		Namespace: namespace,
+		Spec: &authzpb.AuthorizationPolicy{
+			Action: action,
+			Rules:  []*authzpb.Rule{{To: []*authzpb.Rule_To{{Operation: &authzpb.Operation{Paths: paths}}}}},
+		},
+	}
+}
+
+// pathNormalizationMatrix returns the edge cases of every protected path with their expected
+// decisions under policy.
+func pathNormalizationMatrix(policy parsedAuthorizationPolicy, protected []string) ([]pathNormalizationCase, error) {
+	w := workload{namespace: policy.Namespace}
+	var cases []pathNormalizationCase
+	for _, p := range protected {
+		segments := strings.Split(strings.Trim(p, "/"), "/")
+		if !strings.HasPrefix(p, "/") || len(segments) < 2 || strings.ContainsAny(p, "*%?\\") {
+			return nil, fmt.Errorf("invalid protected path %q: must be an exact path of at least two segments", p)
+		}
+		for _, c := range pathCases {
+			pc := pathNormalizationCase{
+				Case:       c.name,
+				Protected:  p,
+				Path:       c.variant(segments),
+				Normalized: map[string]string{},
+				Expect:     map[string]string{},
+			}
+			for _, n := range pathNormalizations {
+				pc.Normalized[n] = normalizePath(pc.Path, n)
+				r := simulatedRequest{}
+				r.set("request.path", pc.Normalized[n])
+				pc.Expect[n] = expectDeny
+				if evaluate([]parsedAuthorizationPolicy{policy}, w, "", r).Allowed {
+					pc.Expect[n] = expectAllow
+				}
+			}
+			cases = append(cases, pc)
+		}
+	}
+	return cases, nil
+}
+
+func printPathNormalizationMatrix(cases []pathNormalizationCase) {
+	tw := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CASE\tPATH\t"+strings.Join(pathNormalizations, "\t"))
+	for _, c := range cases {
+		row := []string{c.Case, c.Path}
+		for _, n := range pathNormalizations {
+			row = append(row, c.Expect[n])
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	_ = tw.Flush()
+}
+
+func runPathNormalization(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("path-normalization", flag.ExitOnError)
+	namespace := fs.String("namespace", generatepolicies.DefaultNamespace, "The namespace of the policy")
+	paths := fs.String("paths", "/admin/config", "Comma separated exact paths of at least two segments the policy protects")
+	action := fs.String("action", "DENY", "The action of the policy on the protected paths, DENY or ALLOW")
+	normalization := fs.String("normalization", "BASE", "The pathNormalization of the mesh under test, the decisions of the traffic profile are expected for it")
+	expectFile := fs.String("expectFile", "", "A JSON file the expected decisions of every case under every normalization are written to")
+	trafficFile := fs.String("trafficFile", "", "A traffic profile file with one request per case expected to be decided as under -normalization")
+	_ = fs.Parse(args)
+
+	act, ok := authzpb.AuthorizationPolicy_Action_value[*action]
+	if !ok || (act != int32(authzpb.AuthorizationPolicy_DENY) && act != int32(authzpb.AuthorizationPolicy_ALLOW)) {
+		return fmt.Errorf("invalid action %q, must be DENY or ALLOW", *action)
+	}
+	known := false
+	for _, n := range pathNormalizations {
+		known = known || n == *normalization
+	}
+	if !known {
+		return fmt.Errorf("invalid normalization %q, must be one of %s", *normalization, strings.Join(pathNormalizations, ", "))
+	}
+	policy := pathNormalizationPolicy(*namespace, authzpb.AuthorizationPolicy_Action(act), strings.Split(*paths, ","))
+	cases, err := pathNormalizationMatrix(policy, policy.Spec.Rules[0].To[0].Operation.Paths)
+	if err != nil {
+		return err
+	}
+
+	if *expectFile != "" {
+		js, err := json.MarshalIndent(cases, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(*expectFile, js, 0644); err != nil {
+			return err
+		}
+	}
+	if *trafficFile != "" {
+		profile := &TrafficProfile{Scenario: "path-normalization-" + strings.ToLower(*normalization)}
+		for _, c := range cases {
+			profile.Requests = append(profile.Requests, TrafficRequest{Method: "GET", Path: c.Path, Expect: c.Expect[*normalization]})
+		}
+		if err := writeTrafficProfile(profile, *trafficFile); err != nil {
+			return err
+		}
+	}
+
+	header := &generatepolicies.MyPolicy{
+		APIVersion: "security.istio.io/v1beta1",
+		Kind:       "AuthorizationPolicy",
+		Metadata:   generatepolicies.MetadataStruct{Namespace: policy.Namespace, Name: policy.Name},
+	}
+	doc, err := generatepolicies.PolicyToYAML(header, policy.Spec)
+	if err != nil {
+		return err
+	}
+	fmt.Println(doc + "---")
+	printPathNormalizationMatrix(cases)
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+func TestNormalizePath(t *testing.T) {
+	cases := []struct {
+		path          string
+		normalization string
+		want          string
+	}{
+		{"/a/b?x=1", "NONE", "/a/b"},
+		{"/a/./b", "NONE", "/a/./b"},
+		{"/a/./b", "BASE", "/a/b"},
+		{"/a/x/%2e%2E/b", "BASE", "/a/b"},
+		{"/a/x/..", "BASE", "/a/"},
+		{"/../a", "BASE", "/a"},
+		{`/a\b`, "BASE", "/a/b"},
+		{"/%61/%2fb", "BASE", "/a/%2Fb"},
+		{"//a//b", "BASE", "//a//b"},
+		{"//a//b", "MERGE_SLASHES", "/a/b"},
+		{"/a%2Fb", "MERGE_SLASHES", "/a%2Fb"},
+		{"/a%2F%2fb", "DECODE_AND_MERGE_SLASHES", "/a/b"},
+		{"/a%5Cb", "DECODE_AND_MERGE_SLASHES", "/a/b"},
+	}
+	for _, c := range cases {
+		if got := normalizePath(c.path, c.normalization); got != c.want {
+			t.Errorf("normalizePath(%q, %s) = %q, want %q", c.path, c.normalization, got, c.want)
+		}
+	}
+}
+
+func TestPathNormalizationMatrix(t *testing.T) {
+	policy := pathNormalizationPolicy("ns", authzpb.AuthorizationPolicy_ALLOW, []string{"/admin/config"})
+	cases, err := pathNormalizationMatrix(policy, []string{"/admin/config"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != len(pathCases) {
+		t.Fatalf("got %d cases, want %d", len(cases), len(pathCases))
+	}
+	want := map[string]map[string]string{
+		"exact":         {"NONE": expectAllow, "DECODE_AND_MERGE_SLASHES": expectAllow},
+		"double-slash":  {"BASE": expectDeny, "MERGE_SLASHES": expectAllow},
+		"encoded-slash": {"MERGE_SLASHES": expectDeny, "DECODE_AND_MERGE_SLASHES": expectAllow},
+		"dot-segment":   {"NONE": expectDeny, "BASE": expectAllow},
+		"upper-case":    {"DECODE_AND_MERGE_SLASHES": expectDeny},
+	}
+	for _, c := range cases {
+		for n, expect := range want[c.Case] {
+			if c.Expect[n] != expect {
+				t.Errorf("%s %s under %s: got %s, want %s", c.Case, c.Path, n, c.Expect[n], expect)
+			}
+		}
+	}
+
+	if _, err := pathNormalizationMatrix(policy, []string{"/admin"}); err == nil {
+		t.Error("expected an error for a protected path of one segment")
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	authzpb "istio.io/api/security/v1beta1"
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// parsedAuthorizationPolicy is an AuthorizationPolicy read back from its YAML.
+type parsedAuthorizationPolicy struct {
+	Name      string
+	Namespace string
+	Spec      *authzpb.AuthorizationPolicy
+}
+
+func (p parsedAuthorizationPolicy) String() string {
+	return p.Namespace + "/" + p.Name
+}
+
+// loadAuthorizationPolicies returns the AuthorizationPolicies of policyFile, a multi-document
+// YAML file, or else the ones generated from the scenario and the config file.
+func loadAuthorizationPolicies(ctx context.Context, scenarioName, configFile, policyFile string) ([]parsedAuthorizationPolicy, error) {
+	docs, err := loadPolicyDocuments(ctx, scenarioName, configFile, policyFile)
+	if err != nil {
+		return nil, err
+	}
+	return parseAuthorizationPolicies(docs)
+}
+
+// loadPolicyDocuments returns the YAML documents of policyFile, or else the policies generated
+// from the scenario and the config file.
+func loadPolicyDocuments(ctx context.Context, scenarioName, configFile, policyFile string) ([]string, error) {
+	if policyFile != "" {
+		data, err := ioutil.ReadFile(policyFile)
+		if err != nil {
+			return nil, err
+		}
+		return splitYAMLDocuments(string(data)), nil
+	}
+	policyData, err := loadSecurityPolicy(scenarioName, configFile)
+	if err != nil {
+		return nil, err
+	}
+	return generatePolicies(ctx, policyData)
+}
+
+// splitYAMLDocuments splits a multi-document YAML file into its non-empty documents.
+func splitYAMLDocuments(data string) []string {
+	var docs []string
+	for _, doc := range strings.Split("\n"+data, "\n---") {
+		if strings.TrimSpace(doc) != "" {
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+// parseAuthorizationPolicies returns the AuthorizationPolicies of docs, other kinds are skipped.
+func parseAuthorizationPolicies(docs []string) ([]parsedAuthorizationPolicy, error) {
+	var policies []parsedAuthorizationPolicy
+	for _, doc := range docs {
+		js, err := yaml.YAMLToJSON([]byte(doc))
+		if err != nil {
+			return nil, err
+		}
+		var resource struct {
+			Kind     string                          `json:"kind"`
+			Metadata generatepolicies.MetadataStruct `json:"metadata"`
+			Spec     json.RawMessage                 `json:"spec"`
+		}
+		if err := json.Unmarshal(js, &resource); err != nil {
+			return nil, err
+		}
+		if resource.Kind != "AuthorizationPolicy" {
+			continue
+		}
+		spec := &authzpb.AuthorizationPolicy{}
+		if len(resource.Spec) > 0 {
+			if err := spec.UnmarshalJSON(resource.Spec); err != nil {
+				return nil, fmt.Errorf("%s/%s: %v", resource.Metadata.Namespace, resource.Metadata.Name, err)
+			}
+		}
+		policies = append(policies, parsedAuthorizationPolicy{
+			Name:      resource.Metadata.Name,
+			Namespace: resource.Metadata.Namespace,
+			Spec:      spec,
+		})
+	}
+	return policies, nil
+}
+
+// policyObject is a policy of any kind read back from its YAML, generated or exported from a
+// cluster.
+type policyObject struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	// Spec is the spec decoded into generic JSON values, which compare with reflect.DeepEqual.
+	Spec map[string]interface{}
+}
+
+func (p policyObject) String() string {
+	return p.Kind + " " + p.Namespace + "/" + p.Name
+}
+
+// parsePolicyObjects returns the policies of docs. The items of a List, the output of
+// kubectl get -o yaml, are returned as policies of their own.
+func parsePolicyObjects(docs []string) ([]policyObject, error) {
+	var objects []policyObject
+	for _, doc := range docs {
+		js, err := yaml.YAMLToJSON([]byte(doc))
+		if err != nil {
+			return nil, err
+		}
+		var resource struct {
+			APIVersion string                          `json:"apiVersion"`
+			Kind       string                          `json:"kind"`
+			Metadata   generatepolicies.MetadataStruct `json:"metadata"`
+			Spec       map[string]interface{}          `json:"spec"`
+			Items      []json.RawMessage               `json:"items"`
+		}
+		if err := json.Unmarshal(js, &resource); err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(resource.Kind, "List") {
+			items := make([]string, len(resource.Items))
+			for i, item := range resource.Items {
+				items[i] = string(item)
+			}
+			listed, err := parsePolicyObjects(items)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, listed...)
+			continue
+		}
+		if resource.Kind == "" {
+			continue
+		}
+		objects = append(objects, policyObject{
+			APIVersion: resource.APIVersion,
+			Kind:       resource.Kind,
+			Namespace:  resource.Metadata.Namespace,
+			Name:       resource.Metadata.Name,
+			Spec:       resource.Spec,
+		})
+	}
+	return objects, nil
+}
@@ -0,0 +1,190 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// istiodDebugPort is the istiod port serving /debug/pprof.
+const istiodDebugPort = 8080
+
+type profileOptions struct {
+	// points are the percentages of the corpus applied at which profiles are captured.
+	points     []int
+	cpuSeconds int
+	heap       bool
+	namespace  string
+	selector   string
+}
+
+// ProfileArtifact records a profile downloaded from istiod.
+type ProfileArtifact struct {
+	Kind      string    `json:"kind"`
+	Point     string    `json:"point"`
+	Pod       string    `json:"pod"`
+	File      string    `json:"file"`
+	StartTime time.Time `json:"startTime"`
+}
+
+func parseProfilePoints(s string) ([]int, error) {
+	var points []int
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		point, err := strconv.Atoi(p)
+		if err != nil || point < 0 || point > 100 {
+			return nil, fmt.Errorf("invalid profile point %q: must be a percentage between 0 and 100", p)
+		}
+		points = append(points, point)
+	}
+	sort.Ints(points)
+	return points, nil
+}
+
+// profiler captures istiod profiles in the background so that applying the corpus is not
+// paused while a CPU profile is being recorded.
+type profiler struct {
+	opts profileOptions
+	dir  string
+
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	artifacts []ProfileArtifact
+	errs      []error
+}
+
+func newProfiler(opts profileOptions, dir string) *profiler {
+	return &profiler{opts: opts, dir: dir}
+}
+
+// capture starts capturing the configured profiles, labelled with point. The capture is aborted
+// when ctx is cancelled.
+func (p *profiler) capture(ctx context.Context, point string) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		artifacts, err := captureIstiodProfiles(ctx, p.opts, p.dir, point)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.artifacts = append(p.artifacts, artifacts...)
+		if err != nil {
+			p.errs = append(p.errs, err)
+		}
+	}()
+}
+
+// wait blocks until every capture finished and returns the downloaded profiles.
+func (p *profiler) wait() ([]ProfileArtifact, []error) {
+	p.wg.Wait()
+	return p.captured()
+}
+
+// captured returns the profiles downloaded so far, without waiting for the captures in flight.
+func (p *profiler) captured() ([]ProfileArtifact, []error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	artifacts := append([]ProfileArtifact(nil), p.artifacts...)
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].StartTime.Before(artifacts[j].StartTime)
+	})
+	return artifacts, append([]error(nil), p.errs...)
+}
+
+func captureIstiodProfiles(ctx context.Context, opts profileOptions, dir string, point string) ([]ProfileArtifact, error) {
+	pod, err := firstPod(ctx, opts.namespace, opts.selector)
+	if err != nil {
+		return nil, err
+	}
+	addr, stop, err := portForward(ctx, opts.namespace, pod, istiodDebugPort)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	var artifacts []ProfileArtifact
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []string
+	download := func(kind, query string) {
+		defer wg.Done()
+		artifact := ProfileArtifact{
+			Kind:      kind,
+			Point:     point,
+			Pod:       pod,
+			File:      filepath.Join(dir, fmt.Sprintf("istiod-%s-%s.pprof", kind, point)),
+			StartTime: time.Now(),
+		}
+		err := downloadFile(ctx, fmt.Sprintf("http://%s/debug/pprof/%s", addr, query), artifact.File)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s profile at %s: %v", kind, point, err))
+			return
+		}
+		artifacts = append(artifacts, artifact)
+	}
+
+	if opts.cpuSeconds > 0 {
+		wg.Add(1)
+		go download("cpu", fmt.Sprintf("profile?seconds=%d", opts.cpuSeconds))
+	}
+	if opts.heap {
+		wg.Add(1)
+		go download("heap", "heap")
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return artifacts, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return artifacts, nil
+}
+
+func downloadFile(ctx context.Context, url, file string) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
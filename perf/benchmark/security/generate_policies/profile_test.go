@@ -0,0 +1,38 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProfilerCaptured(t *testing.T) {
+	start := time.Now()
+	p := newProfiler(profileOptions{}, t.TempDir())
+	p.artifacts = []ProfileArtifact{
+		{Kind: "cpu", Point: "soak-2", StartTime: start.Add(time.Minute)},
+		{Kind: "cpu", Point: "soak-1", StartTime: start},
+	}
+	// The soak report lists the profiles captured so far, in the order they were started.
+	artifacts, errs := p.captured()
+	if len(errs) != 0 || len(artifacts) != 2 || artifacts[0].Point != "soak-1" {
+		t.Fatalf("got %+v, %v, want soak-1 then soak-2", artifacts, errs)
+	}
+	artifacts[0].Point = "changed"
+	if p.artifacts[1].Point != "soak-1" {
+		t.Error("captured returned the profiles of the profiler instead of a copy")
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+
+	mcp "istio.io/api/mcp/v1alpha1"
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+// protoSpec is the spec of a policy kind serialized by the proto output.
+type protoSpec interface {
+	proto.Message
+	UnmarshalJSON([]byte) error
+}
+
+// protoSpecs returns a new spec of each kind serialized by the proto output.
+var protoSpecs = map[string]func() protoSpec{
+	"AuthorizationPolicy":   func() protoSpec { return &authzpb.AuthorizationPolicy{} },
+	"PeerAuthentication":    func() protoSpec { return &authzpb.PeerAuthentication{} },
+	"RequestAuthentication": func() protoSpec { return &authzpb.RequestAuthentication{} },
+}
+
+// protoResources returns the policies of docs as MCP resources, named <namespace>/<name> with
+// their spec in the body. The objects of other kinds, such as namespaces, are skipped and counted.
+func protoResources(docs []string) ([]*mcp.Resource, int, error) {
+	objects, err := parsePolicyObjects(docs)
+	if err != nil {
+		return nil, 0, err
+	}
+	var resources []*mcp.Resource
+	skipped := 0
+	for _, o := range objects {
+		newSpec, ok := protoSpecs[o.Kind]
+		if !ok {
+			skipped++
+			continue
+		}
+		js, err := json.Marshal(o.Spec)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %v", o, err)
+		}
+		spec := newSpec()
+		if err := spec.UnmarshalJSON(js); err != nil {
+			return nil, 0, fmt.Errorf("%s: %v", o, err)
+		}
+		body, err := types.MarshalAny(spec)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %v", o, err)
+		}
+		resources = append(resources, &mcp.Resource{
+			Metadata: &mcp.Metadata{Name: o.Namespace + "/" + o.Name},
+			Body:     body,
+		})
+	}
+	return resources, skipped, nil
+}
+
+// writeProtoStream writes resources to w as a length-delimited stream: every resource is
+// preceded by its size as a varint, as written by writeDelimitedTo of the Java protobuf runtime.
+func writeProtoStream(w io.Writer, resources []*mcp.Resource) error {
+	bw := bufio.NewWriter(w)
+	size := make([]byte, binary.MaxVarintLen64)
+	for _, r := range resources {
+		data, err := proto.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("%s: %v", r.Metadata.Name, err)
+		}
+		if _, err := bw.Write(size[:binary.PutUvarint(size, uint64(len(data)))]); err != nil {
+			return err
+		}
+		if _, err := bw.Write(data); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
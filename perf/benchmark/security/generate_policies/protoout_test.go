@@ -0,0 +1,88 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+
+	mcp "istio.io/api/mcp/v1alpha1"
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+func TestProtoStream(t *testing.T) {
+	policyData, err := loadSecurityPolicy("namespace-isolation", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs, err := generatePolicies(context.Background(), policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources, skipped, err := protoResources(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped == 0 {
+		t.Error("the namespaces of the scenario are not skipped")
+	}
+	var buf bytes.Buffer
+	if err := writeProtoStream(&buf, resources); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := parseAuthorizationPolicies(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(&buf)
+	for i := 0; ; i++ {
+		size, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			if i != len(want) {
+				t.Errorf("read %d resources, want %d", i, len(want))
+			}
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			t.Fatal(err)
+		}
+		resource := &mcp.Resource{}
+		if err := proto.Unmarshal(data, resource); err != nil {
+			t.Fatal(err)
+		}
+		spec := &authzpb.AuthorizationPolicy{}
+		if err := types.UnmarshalAny(resource.Body, spec); err != nil {
+			t.Fatal(err)
+		}
+		if i >= len(want) {
+			t.Fatalf("read more than %d resources", len(want))
+		}
+		if resource.Metadata.Name != want[i].String() || !proto.Equal(spec, want[i].Spec) {
+			t.Errorf("resource %d is %s %v, want %s %v", i, resource.Metadata.Name, spec, want[i], want[i].Spec)
+		}
+	}
+}
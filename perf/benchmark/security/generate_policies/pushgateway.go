@@ -0,0 +1,107 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// pushMetricsPrefix prefixes the names of the metrics pushed to a Pushgateway.
+const pushMetricsPrefix = "security_benchmark_"
+
+// reportMetrics returns the results of a run report as gauges: the latency percentiles of its
+// loads, the push latency and config sizes of istiod, and the apply times of its batches.
+func reportMetrics(report *RunReport) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	gauge := func(name, help string, labels ...string) *prometheus.GaugeVec {
+		g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: pushMetricsPrefix + name, Help: help}, labels)
+		registry.MustRegister(g)
+		return g
+	}
+
+	info := gauge("info", "The version of the tool of the run, always 1.", "tool_version", "git_sha")
+	if m := report.Metadata; m != nil {
+		info.WithLabelValues(m.ToolVersion, m.GitSHA).Set(1)
+	}
+	gauge("duration_seconds", "The duration of the run.").WithLabelValues().Set(report.EndTime.Sub(report.StartTime).Seconds())
+	gauge("policies_applied", "The number of policies applied.").WithLabelValues().Set(float64(report.PoliciesApplied))
+	gauge("errors", "The number of errors of the run.").WithLabelValues().Set(float64(len(report.Errors)))
+
+	if len(report.Batches) > 0 {
+		apply := gauge("apply_seconds", "The time spent applying the batches of the corpus.")
+		for _, b := range report.Batches {
+			apply.WithLabelValues().Add(b.DurationSeconds)
+		}
+	}
+
+	latency := gauge("latency_milliseconds", "The latency percentiles of the requests of a load.", "load", "outcome", "quantile")
+	qps := gauge("qps", "The throughput of a load.", "load", "outcome")
+	addLoad := func(load string, l *LoadResult) {
+		if l == nil {
+			return
+		}
+		setLatency := func(outcome string, s LatencySummary) {
+			latency.WithLabelValues(load, outcome, "0.5").Set(s.P50)
+			latency.WithLabelValues(load, outcome, "0.9").Set(s.P90)
+			latency.WithLabelValues(load, outcome, "0.99").Set(s.P99)
+		}
+		setLatency("all", l.Latency)
+		qps.WithLabelValues(load, "all").Set(l.ActualQPS)
+		for outcome, s := range l.LatencyByOutcome {
+			setLatency(outcome, s)
+			qps.WithLabelValues(load, outcome).Set(l.QPSByOutcome[outcome])
+		}
+	}
+	addLoad("load", report.Load)
+	if e := report.ExtAuthz; e != nil {
+		addLoad("baseline", e.Baseline)
+		addLoad("ext_authz", e.ExtAuthz)
+	}
+
+	pushLatency := gauge("push_latency_seconds", "The pilot_proxy_convergence_time of the pushes of istiod.", "revision", "stat")
+	configSize := gauge("config_size_bytes", "The pilot_xds_config_size_bytes of the pushes of istiod.", "revision", "stat")
+	convergence := gauge("convergence_seconds", "The time from the first apply to the last push of istiod.", "revision")
+	setSummary := func(g *prometheus.GaugeVec, revision string, s HistogramSummary) {
+		g.WithLabelValues(revision, "mean").Set(s.Mean)
+		g.WithLabelValues(revision, "p50").Set(s.P50)
+		g.WithLabelValues(revision, "p99").Set(s.P99)
+	}
+	if ab := report.AB; ab != nil {
+		for _, r := range ab.Revisions {
+			setSummary(pushLatency, r.Revision, r.PushLatency)
+			setSummary(configSize, r.Revision, r.ConfigSize)
+			convergence.WithLabelValues(r.Revision).Set(r.ConvergenceSeconds)
+		}
+	}
+	if c := report.Convergence; c != nil && len(c.Batches) > 0 {
+		// The last batch measures istiod with the whole corpus.
+		last := c.Batches[len(c.Batches)-1]
+		setSummary(pushLatency, "", last.PushLatency)
+		convergence.WithLabelValues("").Set(last.ConvergenceSeconds)
+		gauge("convergence_correlation", "The correlation of the mean push latency with the policies applied.").WithLabelValues().Set(c.Correlation)
+	}
+	return registry
+}
+
+// pushReport replaces the metrics of the group of job, the command of the report and labels in
+// the Pushgateway at url by the results of the report.
+func pushReport(url, job string, labels map[string]string, report *RunReport) error {
+	pusher := push.New(url, job).Gatherer(reportMetrics(report)).Grouping("command", report.Command)
+	for name, value := range labels {
+		pusher = pusher.Grouping(name, value)
+	}
+	return pusher.Push()
+}
@@ -0,0 +1,95 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportMetrics(t *testing.T) {
+	start := time.Date(2021, 1, 7, 0, 0, 0, 0, time.UTC)
+	report := &RunReport{
+		Command:         "bench",
+		Metadata:        &RunMetadata{ToolVersion: "v1.2.3", GitSHA: "abc"},
+		StartTime:       start,
+		EndTime:         start.Add(90 * time.Second),
+		PoliciesApplied: 200,
+		Batches:         []BatchResult{{DurationSeconds: 1.5}, {DurationSeconds: 2.5}},
+		Load: &LoadResult{
+			ActualQPS:        100,
+			Latency:          LatencySummary{P50: 1, P90: 2, P99: 3},
+			LatencyByOutcome: map[string]LatencySummary{outcomeDenied: {P50: 0.5, P90: 0.6, P99: 0.7}},
+			QPSByOutcome:     map[string]float64{outcomeDenied: 20},
+		},
+		AB: &ABResult{Revisions: []RevisionResult{{Revision: "canary", PushLatency: HistogramSummary{Mean: 0.2}, ConfigSize: HistogramSummary{P99: 4096}}}},
+	}
+	families, err := reportMetrics(report).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]float64{}
+	for _, f := range families {
+		for _, m := range f.Metric {
+			key := f.GetName()
+			for _, l := range m.Label {
+				key += "," + l.GetName() + "=" + l.GetValue()
+			}
+			values[key] = m.Gauge.GetValue()
+		}
+	}
+	for key, want := range map[string]float64{
+		"security_benchmark_duration_seconds":                                           90,
+		"security_benchmark_apply_seconds":                                              4,
+		"security_benchmark_info,git_sha=abc,tool_version=v1.2.3":                       1,
+		"security_benchmark_latency_milliseconds,load=load,outcome=all,quantile=0.99":   3,
+		"security_benchmark_latency_milliseconds,load=load,outcome=denied,quantile=0.5": 0.5,
+		"security_benchmark_qps,load=load,outcome=denied":                               20,
+		"security_benchmark_push_latency_seconds,revision=canary,stat=mean":             0.2,
+		"security_benchmark_config_size_bytes,revision=canary,stat=p99":                 4096,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestPushReport(t *testing.T) {
+	var method, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	report := &RunReport{Command: "apply", PoliciesApplied: 10}
+	if err := pushReport(server.URL, "security_benchmark", map[string]string{"cluster": "ci", "branch": "main"}, report); err != nil {
+		t.Fatal(err)
+	}
+	// The grouping labels follow the job in any order.
+	segments := strings.Split(strings.TrimPrefix(path, "/metrics/job/security_benchmark/"), "/")
+	grouping := map[string]string{}
+	for i := 0; i+1 < len(segments); i += 2 {
+		grouping[segments[i]] = segments[i+1]
+	}
+	want := map[string]string{"command": "apply", "branch": "main", "cluster": "ci"}
+	if method != http.MethodPut || !strings.HasPrefix(path, "/metrics/job/security_benchmark/") || !reflect.DeepEqual(grouping, want) {
+		t.Errorf("got %s %s, want the grouping %v", method, path, want)
+	}
+}
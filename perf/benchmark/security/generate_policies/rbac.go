@@ -0,0 +1,285 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net"
+	"strings"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+// A constraint restricts a request attribute to one of its values, or to none of them.
+// Attributes use the names of the condition keys, the attributes of operations are named
+// request.host, request.method and request.path.
+type constraint struct {
+	attribute string
+	values    []string
+	not       bool
+}
+
+// A clause is a conjunction of constraints. A rule matches a request when any of its clauses does.
+type clause []constraint
+
+// ruleClauses returns rule as ORed clauses. The from and to entries of a rule are ORed, their
+// fields and the when conditions are ANDed, so every clause combines one from entry, one to
+// entry and all the conditions.
+func ruleClauses(rule *authzpb.Rule) []clause {
+	sources := []clause{nil}
+	if len(rule.From) > 0 {
+		sources = nil
+		for _, from := range rule.From {
+			sources = append(sources, sourceConstraints(from.GetSource()))
+		}
+	}
+	operations := []clause{nil}
+	if len(rule.To) > 0 {
+		operations = nil
+		for _, to := range rule.To {
+			operations = append(operations, operationConstraints(to.GetOperation()))
+		}
+	}
+	var conditions clause
+	for _, condition := range rule.When {
+		conditions = appendConstraint(conditions, condition.Key, condition.Values, false)
+		conditions = appendConstraint(conditions, condition.Key, condition.NotValues, true)
+	}
+
+	clauses := make([]clause, 0, len(sources)*len(operations))
+	for _, source := range sources {
+		for _, operation := range operations {
+			c := make(clause, 0, len(source)+len(operation)+len(conditions))
+			c = append(append(append(c, source...), operation...), conditions...)
+			clauses = append(clauses, c)
+		}
+	}
+	return clauses
+}
+
+func sourceConstraints(source *authzpb.Source) clause {
+	var c clause
+	c = appendConstraint(c, "source.principal", source.GetPrincipals(), false)
+	c = appendConstraint(c, "source.principal", source.GetNotPrincipals(), true)
+	c = appendConstraint(c, "request.auth.principal", source.GetRequestPrincipals(), false)
+	c = appendConstraint(c, "request.auth.principal", source.GetNotRequestPrincipals(), true)
+	c = appendConstraint(c, "source.namespace", source.GetNamespaces(), false)
+	c = appendConstraint(c, "source.namespace", source.GetNotNamespaces(), true)
+	c = appendConstraint(c, "source.ip", source.GetIpBlocks(), false)
+	c = appendConstraint(c, "source.ip", source.GetNotIpBlocks(), true)
+	c = appendConstraint(c, "remote.ip", source.GetRemoteIpBlocks(), false)
+	c = appendConstraint(c, "remote.ip", source.GetNotRemoteIpBlocks(), true)
+	return c
+}
+
+func operationConstraints(operation *authzpb.Operation) clause {
+	var c clause
+	c = appendConstraint(c, "request.host", operation.GetHosts(), false)
+	c = appendConstraint(c, "request.host", operation.GetNotHosts(), true)
+	c = appendConstraint(c, "destination.port", operation.GetPorts(), false)
+	c = appendConstraint(c, "destination.port", operation.GetNotPorts(), true)
+	c = appendConstraint(c, "request.method", operation.GetMethods(), false)
+	c = appendConstraint(c, "request.method", operation.GetNotMethods(), true)
+	c = appendConstraint(c, "request.path", operation.GetPaths(), false)
+	c = appendConstraint(c, "request.path", operation.GetNotPaths(), true)
+	return c
+}
+
+func appendConstraint(c clause, attribute string, values []string, not bool) clause {
+	if len(values) == 0 {
+		return c
+	}
+	return append(c, constraint{attribute: attribute, values: values, not: not})
+}
+
+func isIPAttribute(attribute string) bool {
+	return attribute == "source.ip" || attribute == "remote.ip" || attribute == "destination.ip"
+}
+
+// parseIPBlock returns an IP address or a CIDR as a network.
+func parseIPBlock(block string) *net.IPNet {
+	if !strings.Contains(block, "/") {
+		ip := net.ParseIP(block)
+		if ip == nil {
+			return nil
+		}
+		bits := 8 * net.IPv4len
+		if ip.To4() == nil {
+			bits = 8 * net.IPv6len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+	_, network, err := net.ParseCIDR(block)
+	if err != nil {
+		return nil
+	}
+	return network
+}
+
+// matchValue reports whether value matches pattern, an exact, prefix ("abc*"), suffix ("*abc")
+// or presence ("*") match, or a network for the IP attributes.
+func matchValue(attribute, pattern, value string) bool {
+	if isIPAttribute(attribute) {
+		network, ip := parseIPBlock(pattern), net.ParseIP(value)
+		return network != nil && ip != nil && network.Contains(ip)
+	}
+	switch {
+	case pattern == "*":
+		return value != ""
+	case strings.HasSuffix(pattern, "*"):
+		return strings.HasPrefix(value, strings.TrimSuffix(pattern, "*"))
+	case strings.HasPrefix(pattern, "*"):
+		return strings.HasSuffix(value, strings.TrimPrefix(pattern, "*"))
+	default:
+		return value == pattern
+	}
+}
+
+// patternsIntersect reports whether some value matches both patterns.
+func patternsIntersect(attribute, a, b string) bool {
+	if isIPAttribute(attribute) {
+		na, nb := parseIPBlock(a), parseIPBlock(b)
+		return na != nil && nb != nil && (na.Contains(nb.IP) || nb.Contains(na.IP))
+	}
+	if a == "*" || b == "*" {
+		return true
+	}
+	aPrefix, aSuffix := strings.HasSuffix(a, "*"), strings.HasPrefix(a, "*")
+	bPrefix, bSuffix := strings.HasSuffix(b, "*"), strings.HasPrefix(b, "*")
+	switch {
+	case !aPrefix && !aSuffix:
+		return matchValue(attribute, b, a)
+	case !bPrefix && !bSuffix:
+		return matchValue(attribute, a, b)
+	case aPrefix && bPrefix:
+		pa, pb := strings.TrimSuffix(a, "*"), strings.TrimSuffix(b, "*")
+		return strings.HasPrefix(pa, pb) || strings.HasPrefix(pb, pa)
+	case aSuffix && bSuffix:
+		sa, sb := strings.TrimPrefix(a, "*"), strings.TrimPrefix(b, "*")
+		return strings.HasSuffix(sa, sb) || strings.HasSuffix(sb, sa)
+	default:
+		// A prefix and a suffix match are both matched by their concatenation.
+		return true
+	}
+}
+
+// patternCovers reports whether every value matching inner matches outer.
+func patternCovers(attribute, outer, inner string) bool {
+	if isIPAttribute(attribute) {
+		no, ni := parseIPBlock(outer), parseIPBlock(inner)
+		if no == nil || ni == nil {
+			return false
+		}
+		outerOnes, _ := no.Mask.Size()
+		innerOnes, _ := ni.Mask.Size()
+		return no.Contains(ni.IP) && outerOnes <= innerOnes
+	}
+	switch {
+	case outer == "*":
+		return inner != ""
+	case strings.HasSuffix(outer, "*"):
+		prefix := strings.TrimSuffix(outer, "*")
+		return !strings.HasPrefix(inner, "*") && strings.HasPrefix(strings.TrimSuffix(inner, "*"), prefix)
+	case strings.HasPrefix(outer, "*"):
+		suffix := strings.TrimPrefix(outer, "*")
+		return !strings.HasSuffix(inner, "*") && strings.HasSuffix(strings.TrimPrefix(inner, "*"), suffix)
+	default:
+		return inner == outer
+	}
+}
+
+// clausesIntersect reports whether a request may match both clauses. It compares the positive
+// constraints on the same attributes pairwise and ignores the negative ones, so it can report
+// intersections no request matches but never misses one.
+func clausesIntersect(a, b clause) bool {
+	all := append(append(clause{}, a...), b...)
+	for i, ci := range all {
+		for _, cj := range all[i+1:] {
+			if ci.not || cj.not || ci.attribute != cj.attribute {
+				continue
+			}
+			if !valuesIntersect(ci.attribute, ci.values, cj.values) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func valuesIntersect(attribute string, a, b []string) bool {
+	for _, va := range a {
+		for _, vb := range b {
+			if patternsIntersect(attribute, va, vb) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// clauseCovers reports whether every request matching inner matches outer.
+func clauseCovers(outer, inner clause) bool {
+	for _, co := range outer {
+		if co.not {
+			return false
+		}
+		covered := false
+		for _, ci := range inner {
+			if !ci.not && ci.attribute == co.attribute && valuesCovered(co.attribute, co.values, ci.values) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+func valuesCovered(attribute string, outer, inner []string) bool {
+	for _, vi := range inner {
+		covered := false
+		for _, vo := range outer {
+			if patternCovers(attribute, vo, vi) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// selectorsOverlap reports whether a workload may carry the labels of both selectors.
+func selectorsOverlap(a, b map[string]string) bool {
+	for key, value := range a {
+		if other, ok := b[key]; ok && other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// selectorCovers reports whether every workload selected by inner is selected by outer.
+func selectorCovers(outer, inner map[string]string) bool {
+	for key, value := range outer {
+		if inner[key] != value {
+			return false
+		}
+	}
+	return true
+}
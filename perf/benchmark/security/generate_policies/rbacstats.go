@@ -0,0 +1,155 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+// RBACResult records the decisions of the RBAC filters of the proxies during a load, to confirm
+// that the traffic profile achieved the intended deny ratio.
+type RBACResult struct {
+	Proxies []ProxyRBAC `json:"proxies"`
+	Total   RBACCounts  `json:"total"`
+	// ExpectedDenyRatio is the share of the requests of the traffic profile expected to be denied.
+	ExpectedDenyRatio float64 `json:"expectedDenyRatio"`
+	// DenyRatio is the share of the decisions of the RBAC filters which denied the request.
+	DenyRatio float64 `json:"denyRatio"`
+}
+
+// RBACCounts are the decisions of RBAC filters. The shadow decisions are the ones of dry-run
+// policies, which do not change the outcome of the requests.
+type RBACCounts struct {
+	Allowed       float64 `json:"allowed"`
+	Denied        float64 `json:"denied"`
+	ShadowAllowed float64 `json:"shadowAllowed,omitempty"`
+	ShadowDenied  float64 `json:"shadowDenied,omitempty"`
+}
+
+// ProxyRBAC are the decisions of the RBAC filters of the proxy of a pod.
+type ProxyRBAC struct {
+	Pod string `json:"pod"`
+	RBACCounts
+}
+
+func (c RBACCounts) add(o RBACCounts) RBACCounts {
+	return RBACCounts{c.Allowed + o.Allowed, c.Denied + o.Denied, c.ShadowAllowed + o.ShadowAllowed, c.ShadowDenied + o.ShadowDenied}
+}
+
+func (c RBACCounts) sub(o RBACCounts) RBACCounts {
+	return RBACCounts{c.Allowed - o.Allowed, c.Denied - o.Denied, c.ShadowAllowed - o.ShadowAllowed, c.ShadowDenied - o.ShadowDenied}
+}
+
+// rbacCounts sums the RBAC counters of the stats of a proxy. Their names depend on the stat
+// prefixes of the filters, e.g. envoy_http_rbac_allowed or
+// envoy_http_inbound_0_0_0_0_8080_rbac_istio_dry_run_allow_shadow_denied, so they are matched by
+// their suffix.
+func rbacCounts(families metricFamilies) RBACCounts {
+	var c RBACCounts
+	for name := range families {
+		if !strings.Contains(name, "rbac") {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(name, "shadow_allowed"):
+			c.ShadowAllowed += families.counter(name)
+		case strings.HasSuffix(name, "shadow_denied"):
+			c.ShadowDenied += families.counter(name)
+		case strings.HasSuffix(name, "_allowed"):
+			c.Allowed += families.counter(name)
+		case strings.HasSuffix(name, "_denied"):
+			c.Denied += families.counter(name)
+		}
+	}
+	return c
+}
+
+// proxyPods returns the pods of namespace matching selector.
+func proxyPods(ctx context.Context, namespace, selector string) ([]string, error) {
+	out, err := kubectl(ctx, nil, "-n", namespace, "get", "pods", "-l", selector, "-o", "jsonpath={.items[*].metadata.name}")
+	if err != nil {
+		return nil, err
+	}
+	pods := strings.Fields(string(out))
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("no pod matching %q in namespace %s", selector, namespace)
+	}
+	sort.Strings(pods)
+	return pods, nil
+}
+
+// scrapeRBAC returns the RBAC counters of the istio-proxy containers of pods, read from the Envoy
+// admin through pilot-agent.
+func scrapeRBAC(ctx context.Context, namespace string, pods []string) (map[string]RBACCounts, error) {
+	counts := make(map[string]RBACCounts, len(pods))
+	for _, pod := range pods {
+		out, err := kubectl(ctx, nil, "-n", namespace, "exec", pod, "-c", "istio-proxy", "--",
+			"pilot-agent", "request", "GET", "stats/prometheus")
+		if err != nil {
+			return nil, err
+		}
+		var parser expfmt.TextParser
+		families, err := parser.TextToMetricFamilies(bytes.NewReader(out))
+		if err != nil {
+			return nil, fmt.Errorf("scraping proxy %s: %v", pod, err)
+		}
+		counts[pod] = rbacCounts(families)
+	}
+	return counts, nil
+}
+
+// newRBACResult returns the decisions of the proxies between the before and after scrapes.
+func newRBACResult(before, after map[string]RBACCounts, expectedDenyRatio float64) *RBACResult {
+	result := &RBACResult{ExpectedDenyRatio: expectedDenyRatio}
+	for pod, counts := range after {
+		proxy := ProxyRBAC{Pod: pod, RBACCounts: counts.sub(before[pod])}
+		result.Proxies = append(result.Proxies, proxy)
+		result.Total = result.Total.add(proxy.RBACCounts)
+	}
+	sort.Slice(result.Proxies, func(i, j int) bool { return result.Proxies[i].Pod < result.Proxies[j].Pod })
+	if decisions := result.Total.Allowed + result.Total.Denied; decisions > 0 {
+		result.DenyRatio = result.Total.Denied / decisions
+	}
+	return result
+}
+
+// expectedDenyRatio returns the deny rate of a traffic profile, or else the share of its requests
+// expected to be denied, as the load sends them in turn.
+func expectedDenyRatio(requests []TrafficRequest, denyRate float64) float64 {
+	if denyRate > 0 || len(requests) == 0 {
+		return denyRate
+	}
+	denied := 0
+	for _, r := range requests {
+		if r.Expect == expectDeny {
+			denied++
+		}
+	}
+	return float64(denied) / float64(len(requests))
+}
+
+func printRBACResult(result *RBACResult) {
+	fmt.Printf("RBAC filters: %.0f allowed, %.0f denied, deny ratio %.3f, expected %.3f\n",
+		result.Total.Allowed, result.Total.Denied, result.DenyRatio, result.ExpectedDenyRatio)
+	if result.Total.ShadowAllowed > 0 || result.Total.ShadowDenied > 0 {
+		fmt.Printf("RBAC shadow rules: %.0f allowed, %.0f denied\n", result.Total.ShadowAllowed, result.Total.ShadowDenied)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestRBACCounts(t *testing.T) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(`# TYPE envoy_http_rbac_allowed counter
+envoy_http_rbac_allowed{envoy_http_conn_manager_prefix="inbound_0.0.0.0_8080"} 90
+# TYPE envoy_http_rbac_denied counter
+envoy_http_rbac_denied{envoy_http_conn_manager_prefix="inbound_0.0.0.0_8080"} 10
+# TYPE envoy_http_rbac_istio_dry_run_allow_shadow_denied counter
+envoy_http_rbac_istio_dry_run_allow_shadow_denied{envoy_http_conn_manager_prefix="inbound_0.0.0.0_8080"} 5
+# TYPE envoy_http_downstream_rq_total counter
+envoy_http_downstream_rq_total 100
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := map[string]RBACCounts{"server-a": rbacCounts(families), "server-b": {Allowed: 30, Denied: 10}}
+	if want := (RBACCounts{Allowed: 90, Denied: 10, ShadowDenied: 5}); after["server-a"] != want {
+		t.Errorf("got %+v, want %+v", after["server-a"], want)
+	}
+
+	before := map[string]RBACCounts{"server-a": {Allowed: 60}, "server-b": {Allowed: 10}}
+	result := newRBACResult(before, after, 0.2)
+	if want := (RBACCounts{Allowed: 50, Denied: 20, ShadowDenied: 5}); result.Total != want {
+		t.Errorf("got total %+v, want %+v", result.Total, want)
+	}
+	if len(result.Proxies) != 2 || result.Proxies[0].Pod != "server-a" || result.Proxies[0].Allowed != 30 {
+		t.Errorf("got proxies %+v", result.Proxies)
+	}
+	if got, want := result.DenyRatio, 20.0/70; got != want {
+		t.Errorf("got deny ratio %v, want %v", got, want)
+	}
+}
+
+func TestExpectedDenyRatio(t *testing.T) {
+	requests := []TrafficRequest{{Expect: expectAllow}, {Expect: expectDeny}, {Expect: expectAllow}, {}}
+	if got := expectedDenyRatio(requests, 0); got != 0.25 {
+		t.Errorf("got %v, want 0.25", got)
+	}
+	if got := expectedDenyRatio(requests, 0.5); got != 0.5 {
+		t.Errorf("got %v for a deny rate of 0.5", got)
+	}
+}
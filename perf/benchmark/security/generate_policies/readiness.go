@@ -0,0 +1,116 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ReadinessResult records when the proxies started enforcing a corpus.
+type ReadinessResult struct {
+	// ConfigMap is the <namespace>/<name> of the ConfigMap signaling the readiness of the corpus.
+	ConfigMap  string `json:"configMap"`
+	Generation string `json:"generation"`
+	Ready      bool   `json:"ready"`
+	Attempts   int    `json:"attempts"`
+	// SecondsToReady is the time from the end of the apply to the first attempt deciding every
+	// probe as expected.
+	SecondsToReady float64       `json:"secondsToReady,omitempty"`
+	Probes         []ProbeResult `json:"probes"`
+}
+
+// readinessOptions configure the probes of the readiness of a corpus.
+type readinessOptions struct {
+	namespace string
+	configMap string
+	client    probeClient
+	url       string
+	interval  time.Duration
+	timeout   time.Duration
+}
+
+// readyConfigMap returns the ConfigMap signaling whether the corpus of generation is enforced, its
+// data.ready is "true" once it is.
+func readyConfigMap(namespace, name, generation string, ready bool, message string) (string, error) {
+	data, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":        name,
+			"namespace":   namespace,
+			"annotations": map[string]string{generationAnnotation: generation},
+		},
+		"data": map[string]string{
+			"generation": generation,
+			"ready":      strconv.FormatBool(ready),
+			"message":    message,
+		},
+	})
+	return string(data), err
+}
+
+// signalReadiness applies the ConfigMap of opts with the readiness of generation.
+func signalReadiness(ctx context.Context, opts readinessOptions, generation string, ready bool, message string) error {
+	cm, err := readyConfigMap(opts.namespace, opts.configMap, generation, ready, message)
+	if err != nil {
+		return err
+	}
+	return kubectlApply(ctx, []string{cm})
+}
+
+// waitCorpusReady probes until the proxies take the expected decision on every request of
+// profile or the timeout expires, then signals the readiness of generation.
+func waitCorpusReady(ctx context.Context, opts readinessOptions, generation string, profile *TrafficProfile) (*ReadinessResult, error) {
+	result := &ReadinessResult{ConfigMap: opts.namespace + "/" + opts.configMap, Generation: generation}
+	start := time.Now()
+	deadline := start.Add(opts.timeout)
+	for !result.Ready {
+		probes, err := probe(ctx, opts.client, opts.url, profile)
+		if err != nil {
+			return result, err
+		}
+		result.Attempts++
+		result.Probes = probes
+		result.Ready = true
+		for _, p := range probes {
+			result.Ready = result.Ready && p.Matched
+		}
+		if result.Ready {
+			result.SecondsToReady = time.Since(start).Seconds()
+			break
+		}
+		if time.Now().After(deadline) {
+			message := fmt.Sprintf("probes not decided as expected after %v", opts.timeout)
+			if err := signalReadiness(ctx, opts, generation, false, message); err != nil {
+				return result, err
+			}
+			return result, fmt.Errorf("corpus %s not ready: %s", generation, message)
+		}
+		log.Printf("corpus %s not enforced yet, probing again in %v", generation, opts.interval)
+		select {
+		case <-time.After(opts.interval):
+		case <-ctx.Done():
+			return result, ctx.Err()
+		}
+	}
+	message := fmt.Sprintf("%d probes decided as expected after %.1fs", len(result.Probes), result.SecondsToReady)
+	return result, signalReadiness(ctx, opts, generation, true, message)
+}
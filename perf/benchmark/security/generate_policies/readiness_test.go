@@ -0,0 +1,51 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestReadyConfigMap(t *testing.T) {
+	for _, ready := range []bool{false, true} {
+		doc, err := readyConfigMap("twopods-istio", "corpus", "a68a3dd7bd6b", ready, "applying")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cm struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Name        string            `json:"name"`
+				Namespace   string            `json:"namespace"`
+				Annotations map[string]string `json:"annotations"`
+			} `json:"metadata"`
+			Data map[string]string `json:"data"`
+		}
+		if err := yaml.Unmarshal([]byte(doc), &cm); err != nil {
+			t.Fatal(err)
+		}
+		want := "false"
+		if ready {
+			want = "true"
+		}
+		if cm.Kind != "ConfigMap" || cm.Metadata.Namespace != "twopods-istio" || cm.Metadata.Name != "corpus" ||
+			cm.Data["ready"] != want || cm.Data["generation"] != "a68a3dd7bd6b" ||
+			cm.Metadata.Annotations[generationAnnotation] != "a68a3dd7bd6b" {
+			t.Errorf("unexpected ConfigMap of ready=%v:\n%s", ready, doc)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+// regoPackage is the package of the generated Rego module, its decision is
+// data.istio.authz.allow.
+const regoPackage = "istio.authz"
+
+// regoPrelude defines the request attributes, from the CheckRequest of the Envoy ext_authz
+// filter as input by OPA-Envoy, and the functions matching them.
+const regoPrelude = `import rego.v1
+
+http_request := input.attributes.request.http
+
+# Istio matches the path without its query, and the host ignoring its case.
+path := split(http_request.path, "?")[0]
+
+host := lower(http_request.host)
+
+source_ip := input.attributes.source.address.socketAddress.address
+
+remote_ip := ip if {
+	xff := http_request.headers["x-forwarded-for"]
+	ip := trim_space(split(xff, ",")[0])
+} else := source_ip
+
+destination_ip := input.attributes.destination.address.socketAddress.address
+
+destination_port := format_int(input.attributes.destination.address.socketAddress.portValue, 10)
+
+sni := input.attributes.tlsSession.sni
+
+source_principal := trim_prefix(input.attributes.source.principal, "spiffe://")
+
+source_namespace := parts[2] if {
+	parts := split(source_principal, "/")
+	parts[1] == "ns"
+}
+
+# The JWT of the request was validated by the RequestAuthentications before the ext_authz check.
+claims := payload if {
+	authorization := http_request.headers.authorization
+	startswith(authorization, "Bearer ")
+	[_, payload, _] := io.jwt.decode(substring(authorization, count("Bearer "), -1))
+}
+
+request_principal := concat("/", [claims.iss, claims.sub])
+
+matches(value, patterns) if {
+	some pattern in patterns
+	pattern_matches(value, pattern)
+}
+
+pattern_matches(value, pattern) if {
+	pattern == "*"
+	value != ""
+}
+
+pattern_matches(value, pattern) if value == pattern
+
+pattern_matches(value, pattern) if {
+	endswith(pattern, "*")
+	startswith(value, trim_suffix(pattern, "*"))
+}
+
+pattern_matches(value, pattern) if {
+	startswith(pattern, "*")
+	endswith(value, trim_prefix(pattern, "*"))
+}
+
+cidr_matches(ip, cidrs) if {
+	some cidr in cidrs
+	net.cidr_contains(cidr, ip)
+}
+
+claim_matches(claim, patterns) if {
+	is_array(claim)
+	some value in claim
+	matches(value, patterns)
+}
+
+claim_matches(claim, patterns) if {
+	is_string(claim)
+	matches(claim, patterns)
+}
+`
+
+// regoInputSchema is the JSON schema of the input fields the generated module reads.
+const regoInputSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "The CheckRequest of the Envoy ext_authz filter, as input by OPA-Envoy",
+  "type": "object",
+  "definitions": {
+    "peer": {
+      "type": "object",
+      "properties": {
+        "principal": {"type": "string"},
+        "address": {
+          "type": "object",
+          "properties": {
+            "socketAddress": {
+              "type": "object",
+              "properties": {
+                "address": {"type": "string"},
+                "portValue": {"type": "integer"}
+              }
+            }
+          }
+        }
+      }
+    }
+  },
+  "properties": {
+    "attributes": {
+      "type": "object",
+      "properties": {
+        "source": {"$ref": "#/definitions/peer"},
+        "destination": {"$ref": "#/definitions/peer"},
+        "request": {
+          "type": "object",
+          "properties": {
+            "http": {
+              "type": "object",
+              "properties": {
+                "method": {"type": "string"},
+                "path": {"type": "string"},
+                "host": {"type": "string"},
+                "headers": {"type": "object", "additionalProperties": {"type": "string"}}
+              }
+            }
+          }
+        },
+        "tlsSession": {
+          "type": "object",
+          "properties": {
+            "sni": {"type": "string"}
+          }
+        }
+      }
+    }
+  }
+}
+`
+
+// regoValue returns the Rego expression of the value of attribute, and the function matching it.
+func regoValue(attribute string) (string, string, error) {
+	variables := map[string]string{
+		"request.host":           "host",
+		"request.method":         "http_request.method",
+		"request.path":           "path",
+		"destination.port":       "destination_port",
+		"connection.sni":         "sni",
+		"source.principal":       "source_principal",
+		"source.namespace":       "source_namespace",
+		"request.auth.principal": "request_principal",
+	}
+	if variable, ok := variables[attribute]; ok {
+		return variable, "matches", nil
+	}
+	switch attribute {
+	case "source.ip", "remote.ip", "destination.ip":
+		return strings.Replace(attribute, ".", "_", 1), "cidr_matches", nil
+	case "request.auth.audiences":
+		return `object.get(claims, ["aud"], null)`, "claim_matches", nil
+	case "request.auth.presenter":
+		return `object.get(claims, ["azp"], null)`, "claim_matches", nil
+	}
+	if m := headerKeyRegexp.FindStringSubmatch(attribute); m != nil {
+		// Envoy lower cases the names of the headers.
+		name, err := json.Marshal(strings.ToLower(m[1]))
+		return fmt.Sprintf("http_request.headers[%s]", name), "matches", err
+	}
+	if m := claimKeyRegexp.FindStringSubmatch(attribute); m != nil {
+		path, err := regoStrings(strings.Split(m[1], "]["))
+		return fmt.Sprintf("object.get(claims, %s, null)", path), "claim_matches", err
+	}
+	return "", "", fmt.Errorf("unsupported attribute %s", attribute)
+}
+
+// regoStrings returns the Rego array of values.
+func regoStrings(values []string) (string, error) {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		q, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		quoted[i] = string(q)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]", nil
+}
+
+// regoConstraint returns the Rego expression of c.
+func regoConstraint(c constraint) (string, error) {
+	value, function, err := regoValue(c.attribute)
+	if err != nil {
+		return "", err
+	}
+	values := c.values
+	switch {
+	case function == "cidr_matches":
+		values = make([]string, len(c.values))
+		for i, v := range c.values {
+			network := parseIPBlock(v)
+			if network == nil {
+				return "", fmt.Errorf("invalid IP block %q", v)
+			}
+			values[i] = network.String()
+		}
+	case c.attribute == "request.host":
+		values = make([]string, len(c.values))
+		for i, v := range c.values {
+			values[i] = strings.ToLower(v)
+		}
+	}
+	patterns, err := regoStrings(values)
+	if err != nil {
+		return "", err
+	}
+	expr := fmt.Sprintf("%s(%s, %s)", function, value, patterns)
+	if c.not {
+		expr = "not " + expr
+	}
+	return expr, nil
+}
+
+// regoModule returns the Rego module taking the decision of the DENY and ALLOW policies:
+// allow is true when no clause of a DENY rule matches the request, and without ALLOW
+// policies or when a clause of an ALLOW rule does. Every clause of a rule, see ruleClauses, is a
+// definition of the deny or allowed rule.
+func regoModule(policies []parsedAuthorizationPolicy, w workload) (string, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# The AuthorizationPolicies applying to %s, generated by generate_policies.\n", workloadCost{namespace: w.namespace, selector: w.labels})
+	fmt.Fprintf(&b, "package %s\n\n%s\n", regoPackage, regoPrelude)
+	b.WriteString("default allow := false\n\nallow if {\n\tnot deny\n\tallowed\n}\n\ndefault deny := false\n")
+
+	allowPolicies := false
+	for _, p := range policies {
+		head := "deny"
+		if p.Spec.Action == authzpb.AuthorizationPolicy_ALLOW {
+			head, allowPolicies = "allowed", true
+		}
+		for i, rule := range p.Spec.Rules {
+			for _, c := range ruleClauses(rule) {
+				fmt.Fprintf(&b, "\n# %s/%s rule %d\n%s if {\n", p.Namespace, p.Name, i, head)
+				if len(c) == 0 {
+					b.WriteString("\ttrue\n")
+				}
+				for _, constraint := range c {
+					expr, err := regoConstraint(constraint)
+					if err != nil {
+						return "", fmt.Errorf("%s/%s rule %d: %v", p.Namespace, p.Name, i, err)
+					}
+					fmt.Fprintf(&b, "\t%s\n", expr)
+				}
+				b.WriteString("}\n")
+			}
+		}
+	}
+	if allowPolicies {
+		b.WriteString("\ndefault allowed := false\n")
+	} else {
+		b.WriteString("\n# No ALLOW policy applies, the requests not denied are allowed.\nallowed := true\n")
+	}
+	return b.String(), nil
+}
+
+func runRego(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("rego", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the generated policies")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	policyFile := fs.String("policyFile", "", "A YAML file of policies to convert instead of the generated ones")
+	rootNamespace := fs.String("rootNamespace", "istio-system", "The root namespace, its policies apply to every namespace")
+	namespace := fs.String("namespace", "twopods-istio", "The namespace of the workload whose policies are converted")
+	labels := fs.String("labels", "app=fortioserver", "The labels of the workload whose policies are converted, as key=value,...")
+	outDir := fs.String("outDir", "rego", "The directory policy.rego and the input.json schema are written to")
+	_ = fs.Parse(args)
+
+	policies, err := loadAuthorizationPolicies(ctx, *scenarioName, *configFile, *policyFile)
+	if err != nil {
+		return err
+	}
+	workloadLabels, err := parseLabels(*labels)
+	if err != nil {
+		return err
+	}
+	w := workload{namespace: *namespace, labels: workloadLabels}
+	applying, skipped := enforcedPolicies(policies, w, *rootNamespace)
+	module, err := regoModule(applying, w)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(*outDir, "policy.rego"), []byte(module), 0644); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(*outDir, "input.json"), []byte(regoInputSchema), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "converted %d of %d policies applying to the workload to %s, skipped %d CUSTOM and AUDIT policies\n",
+		len(applying), len(policies), filepath.Join(*outDir, "policy.rego"), skipped)
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegoModule(t *testing.T) {
+	policies, err := parseAuthorizationPolicies(splitYAMLDocuments(`
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: allow
+  namespace: ns
+spec:
+  rules:
+  - from:
+    - source:
+        ipBlocks: ["10.0.0.1"]
+        notNamespaces: ["blocked"]
+    to:
+    - operation:
+        hosts: ["*.Example.com"]
+    when:
+    - key: request.headers[X-Token]
+      values: ["admin"]
+    - key: request.auth.claims[groups]
+      values: ["dev"]
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: deny
+  namespace: ns
+spec:
+  action: DENY
+  rules:
+  - {}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	module, err := regoModule(policies, workload{namespace: "ns"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"package istio.authz\n",
+		`# ns/allow rule 0
+allowed if {
+	not matches(source_namespace, ["blocked"])
+	cidr_matches(source_ip, ["10.0.0.1/32"])
+	matches(host, ["*.example.com"])
+	matches(http_request.headers["x-token"], ["admin"])
+	claim_matches(object.get(claims, ["groups"], null), ["dev"])
+}
+`,
+		"# ns/deny rule 0\ndeny if {\n\ttrue\n}\n",
+		"default allowed := false\n",
+	} {
+		if !strings.Contains(module, want) {
+			t.Errorf("the module does not contain\n%s\ngot\n%s", want, module)
+		}
+	}
+
+	// Without ALLOW policies the requests not denied are allowed.
+	module, err = regoModule(policies[1:], workload{namespace: "ns"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(module, "\nallowed := true\n") {
+		t.Errorf("the module does not allow the requests without ALLOW policies:\n%s", module)
+	}
+}
@@ -0,0 +1,452 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// reportChart is a bar chart rendered as inline SVG in HTML and as text bars in Markdown.
+type reportChart struct {
+	Title  string
+	Unit   string
+	Labels []string
+	Values []float64
+	// Counts renders the values as integers.
+	Counts bool
+}
+
+// value returns v formatted with the unit of the chart.
+func (c reportChart) value(v float64) string {
+	if c.Counts {
+		return fmt.Sprintf("%.0f %s", v, c.Unit)
+	}
+	return fmt.Sprintf("%.3f %s", v, c.Unit)
+}
+
+func (c reportChart) max() float64 {
+	m := 0.0
+	for _, v := range c.Values {
+		if v > m {
+			m = v
+		}
+	}
+	return m
+}
+
+// SVG renders the chart as horizontal bars.
+func (c reportChart) SVG() htmltemplate.HTML {
+	const barHeight, barWidth = 20, 400
+	labelWidth := 160
+	for _, l := range c.Labels {
+		// Fit the labels at about 7 pixels per character of the 12px font.
+		if w := 7 * len(l); w > labelWidth {
+			labelWidth = w
+		}
+	}
+	m := c.max()
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d">`,
+		labelWidth+barWidth+100, barHeight*len(c.Values)+4)
+	for i, v := range c.Values {
+		w := 0.0
+		if m > 0 {
+			w = v / m * barWidth
+		}
+		y := i * barHeight
+		fmt.Fprintf(&b, `<text x="0" y="%d" font-size="12">%s</text>`, y+14, htmltemplate.HTMLEscapeString(c.Labels[i]))
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%.1f" height="%d" fill="#466bb0"/>`, labelWidth, y+2, w, barHeight-4)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" font-size="12">%s</text>`, float64(labelWidth)+w+4, y+14, htmltemplate.HTMLEscapeString(c.value(v)))
+	}
+	b.WriteString(`</svg>`)
+	// The chart only contains escaped labels and numbers.
+	return htmltemplate.HTML(b.String())
+}
+
+// Text renders the chart as text bars for Markdown code blocks.
+func (c reportChart) Text() string {
+	const width = 40
+	m := c.max()
+	labelWidth := 0
+	for _, l := range c.Labels {
+		if len(l) > labelWidth {
+			labelWidth = len(l)
+		}
+	}
+	var b strings.Builder
+	for i, v := range c.Values {
+		n := 0
+		if m > 0 {
+			n = int(v / m * width)
+		}
+		fmt.Fprintf(&b, "%-*s %s %s\n", labelWidth, c.Labels[i], strings.Repeat("█", n), c.value(v))
+	}
+	return b.String()
+}
+
+// reportRun is a RunReport together with the charts rendered for it.
+type reportRun struct {
+	File   string
+	Report *RunReport
+	Charts []reportChart
+	// Outcomes are the latencies of Report.Load by outcome, in reporting order.
+	Outcomes []reportOutcome
+}
+
+type reportOutcome struct {
+	Name     string
+	Requests int
+	QPS      float64
+	Latency  LatencySummary
+}
+
+func (r reportRun) DurationSeconds() float64 {
+	return r.Report.EndTime.Sub(r.Report.StartTime).Seconds()
+}
+
+func latencyChart(title string, series map[string]LatencySummary, order []string) reportChart {
+	c := reportChart{Title: title, Unit: "ms"}
+	for _, name := range order {
+		l, ok := series[name]
+		if !ok {
+			continue
+		}
+		for _, p := range []struct {
+			name  string
+			value float64
+		}{{"p50", l.P50}, {"p90", l.P90}, {"p99", l.P99}} {
+			c.Labels = append(c.Labels, name+" "+p.name)
+			c.Values = append(c.Values, p.value)
+		}
+	}
+	return c
+}
+
+func newReportRun(file string, report *RunReport) reportRun {
+	run := reportRun{File: file, Report: report}
+	if l := report.Load; l != nil {
+		counts := map[string]int{}
+		for code, n := range l.StatusCodes {
+			counts[statusOutcome(code)] += n
+		}
+		for _, outcome := range outcomes {
+			if latency, ok := l.LatencyByOutcome[outcome]; ok {
+				run.Outcomes = append(run.Outcomes, reportOutcome{Name: outcome, Requests: counts[outcome], QPS: l.QPSByOutcome[outcome], Latency: latency})
+			}
+		}
+	}
+	if len(report.Batches) > 0 {
+		c := reportChart{Title: "Apply duration per batch", Unit: "s"}
+		for _, b := range report.Batches {
+			c.Labels = append(c.Labels, fmt.Sprintf("batch %d (%d)", b.Index, b.Policies))
+			c.Values = append(c.Values, b.DurationSeconds)
+		}
+		run.Charts = append(run.Charts, c)
+	}
+	if cv := report.Convergence; cv != nil && len(cv.Batches) > 0 {
+		c := reportChart{Title: "Mean push latency per policies applied", Unit: "s"}
+		for _, b := range cv.Batches {
+			c.Labels = append(c.Labels, fmt.Sprintf("%d policies", b.PoliciesApplied))
+			c.Values = append(c.Values, b.PushLatency.Mean)
+		}
+		run.Charts = append(run.Charts, c)
+	}
+	if e := report.Enforcement; e != nil && len(e.Batches) > 0 {
+		c := reportChart{Title: "Time to enforcement of a DENY policy per policies applied", Unit: "s"}
+		for _, b := range e.Batches {
+			c.Labels = append(c.Labels, fmt.Sprintf("%d policies", b.PoliciesApplied))
+			c.Values = append(c.Values, b.SecondsToEnforcement)
+		}
+		run.Charts = append(run.Charts, c)
+	}
+	if l := report.Load; l != nil && len(l.LatencyByOutcome) > 0 {
+		run.Charts = append(run.Charts, latencyChart("Latency by outcome", l.LatencyByOutcome, outcomes))
+	}
+	if e := report.ExtAuthz; e != nil && e.Baseline != nil && e.ExtAuthz != nil {
+		run.Charts = append(run.Charts, latencyChart("ext_authz latency",
+			map[string]LatencySummary{"baseline": e.Baseline.Latency, "ext_authz": e.ExtAuthz.Latency},
+			[]string{"baseline", "ext_authz"}))
+	}
+	return run
+}
+
+var markdownReportTemplate = template.Must(template.New("markdown").Parse(`# Security policy benchmark report
+{{range .}}
+## {{.File}}
+
+| Command | Config | Start | Duration (s) | Policies applied | Errors |
+|---------|--------|-------|--------------|------------------|--------|
+| {{.Report.Command}} | {{.Report.ConfigFile}} | {{.Report.StartTime.Format "2006-01-02 15:04:05"}} | {{printf "%.1f" .DurationSeconds}} | {{.Report.PoliciesApplied}} | {{len .Report.Errors}} |
+{{with .Report.Metadata}}
+generate_policies {{.ToolVersion}}{{if .GitSHA}} ({{.GitSHA}}){{end}}, flags:{{range .Flags}} ` + "`{{.}}`" + `{{end}}
+{{end}}{{with .Report.ExtAuthz}}{{if and .Baseline .ExtAuthz}}
+| Latency (ms) | p50 | p90 | p99 |
+|--------------|-----|-----|-----|
+| baseline | {{printf "%.3f" .Baseline.Latency.P50}} | {{printf "%.3f" .Baseline.Latency.P90}} | {{printf "%.3f" .Baseline.Latency.P99}} |
+| ext_authz | {{printf "%.3f" .ExtAuthz.Latency.P50}} | {{printf "%.3f" .ExtAuthz.Latency.P90}} | {{printf "%.3f" .ExtAuthz.Latency.P99}} |
+| added | {{printf "%.3f" .AddedLatency.P50}} | {{printf "%.3f" .AddedLatency.P90}} | {{printf "%.3f" .AddedLatency.P99}} |
+{{end}}{{end}}{{with .Report.Throttling}}
+Throttled by the API server: {{.ThrottledBatches}} batches retried {{.Retries}} times, {{printf "%.1f" .BackoffSeconds}}s backoff.
+{{end}}{{with .Report.Convergence}}
+| Batch | Policies applied | Convergence (s) | Push latency mean (s) | Push latency p99 (s) | Full pushes | Partial pushes |
+|-------|------------------|-----------------|-----------------------|----------------------|-------------|----------------|
+{{range .Batches}}| {{.Index}} | {{.PoliciesApplied}} | {{if not .Converged}}>{{end}}{{printf "%.1f" .ConvergenceSeconds}} | {{printf "%.3f" .PushLatency.Mean}} | {{printf "%.3f" .PushLatency.P99}} | {{printf "%.0f" .FullPushes}} | {{printf "%.0f" .PartialPushes}} |
+{{end}}
+Correlation of the mean push latency with the policies applied: {{printf "%.3f" .Correlation}}.
+{{end}}{{with .Report.Enforcement}}
+| Batch | Policies applied | Time to enforcement (s) | Time to lift (s) | Probes |
+|-------|------------------|-------------------------|------------------|--------|
+{{range .Batches}}| {{.Index}} | {{.PoliciesApplied}} | {{if not .Enforced}}>{{end}}{{printf "%.1f" .SecondsToEnforcement}} | {{if not .Lifted}}>{{end}}{{printf "%.1f" .SecondsToLift}} | {{.Probes}} |
+{{end}}
+Time to enforcement of a DENY policy on the path {{.Request.Path}}.
+{{end}}{{with .Report.Status}}
+Control plane status: {{.Acknowledged}} of {{.Policies}} policies acknowledged{{if .Condition}} by {{.Condition}}{{end}}, latency p50 {{printf "%.1f" .Latency.P50}} ms, p99 {{printf "%.1f" .Latency.P99}} ms.
+{{end}}{{with .Report.Readiness}}
+Corpus {{.Generation}}: {{if .Ready}}enforced after {{printf "%.1f" .SecondsToReady}}s{{else}}NOT enforced{{end}}, {{.Attempts}} probe attempts.
+{{end}}{{with .Report.Chaos}}
+Chaos: {{if .Stable}}stable{{else}}NOT stable{{end}} after {{.Ops}} operations, {{.Applied}} applied, {{.Deleted}} deleted, {{.Rejected}} invalid rejected, {{.Admitted}} invalid admitted, {{.ApplyErrors}} failed; istiod {{.IstiodRestarts}} restarts, {{printf "%.0f" .XDSRejects}} xDS rejects, converged after {{if not .Converged}}>{{end}}{{printf "%.1f" .ConvergenceSeconds}}s; {{.Missing}} policies missing, {{.Extra}} extra, {{.Modified}} modified.
+{{end}}{{with .Report.Soak}}
+Soak: {{.Policies}} policies, {{.Churned}} churned{{if .ChurnErrors}} ({{.ChurnErrors}} errors){{end}}, {{.FailedProbeRounds}} of {{.ProbeRounds}} probe rounds not decided as expected{{if .ProbeErrors}}, {{.ProbeErrors}} probe errors{{end}}, {{len .Snapshots}} snapshots; {{printf "%.0f" .FullPushes}} full and {{printf "%.0f" .PartialPushes}} incremental pushes, incremental ratio {{printf "%.2f" .IncrementalRatio}}{{if .Triggers}}, triggers{{range $trigger, $n := .Triggers}} {{$trigger}} {{printf "%.0f" $n}}{{end}}{{end}}.
+{{end}}{{with .Report.ConfigDiff}}
+Config diff of {{.Pod}}: {{.BytesBefore}} bytes of listeners and routes before, {{.BytesAfter}} after, {{printf "%.0f" .BytesPerPolicy}} per policy applied, {{len .Listeners}} listeners and {{len .Routes}} routes changed.
+{{end}}{{with .Report.ListenerRBAC}}
+RBAC per filter chain: {{.Skewed}} of {{len .Proxies}} proxies skewed{{range .Proxies}}; {{.Pod}} at most {{.MaxPolicies}} policies on a chain, {{printf "%.1f" .MeanPolicies}} on average{{if .Skewed}}, SKEWED{{end}}{{end}}.
+{{end}}{{with .Report.APIServer}}
+API server: {{printf "%.0f" .Requests}} requests in {{printf "%.1f" .DurationSeconds}}s, {{printf "%.1f" .RequestsPerSecond}}/s, {{printf "%.0f" .Throttled}} throttled; etcd database {{printf "%.0f" .DBSizeBytesBefore}} bytes before, {{printf "%.0f" .DBSizeBytesAfter}} after, {{printf "%.0f" .DBGrowthBytesPerPolicy}} per policy{{range .Objects}}; {{.Resource}} {{printf "%.0f" .Before}} to {{printf "%.0f" .After}} objects{{end}}.
+{{end}}{{with .Report.Canary}}
+Canary rollout of {{.Policies}} policies{{if .HeldBack}}, {{.HeldBack}} CUSTOM only enforced{{end}}{{range .Stages}}; {{.Name}}{{with .Load}} p99 {{printf "%.3f" .Latency.P99}} ms{{end}}{{with .AddedLatency}} ({{printf "%+.3f" .P99}} ms){{end}}{{with .RBAC}}, deny ratio {{printf "%.3f" .DenyRatio}}{{end}}, shadow deny ratio {{printf "%.3f" .ShadowDenyRatio}}{{end}}.
+{{end}}{{with .Report.E2E}}
+End-to-end enforcement: {{if .Passed}}passed{{else}}FAILED, {{.FailedProbes}} of {{len .Probes}} probes not decided as expected{{end}} after {{.Attempts}} attempts.
+{{end}}{{with .Report.Load}}
+{{.Requests}} requests, {{.Errors}} errors, {{printf "%.1f" .ActualQPS}} qps{{if .WarmupRequests}}, {{.WarmupRequests}} warmup requests excluded{{end}}{{if .UnexpectedDecisions}}, {{.UnexpectedDecisions}} unexpected decisions{{end}}.
+{{end}}{{with .Report.RBAC}}
+RBAC filters of {{len .Proxies}} proxies: {{printf "%.0f" .Total.Allowed}} allowed, {{printf "%.0f" .Total.Denied}} denied, deny ratio {{printf "%.3f" .DenyRatio}}, expected {{printf "%.3f" .ExpectedDenyRatio}}{{if or .Total.ShadowAllowed .Total.ShadowDenied}}; shadow rules {{printf "%.0f" .Total.ShadowAllowed}} allowed, {{printf "%.0f" .Total.ShadowDenied}} denied{{end}}.
+{{end}}{{if .Outcomes}}
+| Outcome | Requests | QPS | p50 (ms) | p90 (ms) | p99 (ms) |
+|---------|----------|-----|----------|----------|----------|
+{{range .Outcomes}}| {{.Name}} | {{.Requests}} | {{printf "%.1f" .QPS}} | {{printf "%.3f" .Latency.P50}} | {{printf "%.3f" .Latency.P90}} | {{printf "%.3f" .Latency.P99}} |
+{{end}}{{end}}{{range .Charts}}
+### {{.Title}}
+
+` + "```" + `
+{{.Text}}` + "```" + `
+{{end}}{{if .Report.Profiles}}
+### Profiles
+{{range .Report.Profiles}}
+- {{.Kind}} at {{.Point}}: ` + "`{{.File}}`" + `{{end}}
+{{end}}{{if .Report.Errors}}
+### Errors
+{{range .Report.Errors}}
+- {{.}}{{end}}
+{{end}}{{end}}`))
+
+var htmlReportTemplate = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Security policy benchmark report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+</style>
+</head>
+<body>
+<h1>Security policy benchmark report</h1>
+{{range .}}
+<h2>{{.File}}</h2>
+<table>
+<tr><th>Command</th><th>Config</th><th>Start</th><th>Duration (s)</th><th>Policies applied</th><th>Errors</th></tr>
+<tr><td>{{.Report.Command}}</td><td>{{.Report.ConfigFile}}</td><td>{{.Report.StartTime.Format "2006-01-02 15:04:05"}}</td>
+<td>{{printf "%.1f" .DurationSeconds}}</td><td>{{.Report.PoliciesApplied}}</td><td>{{len .Report.Errors}}</td></tr>
+</table>
+{{with .Report.Metadata}}<p>generate_policies {{.ToolVersion}}{{if .GitSHA}} ({{.GitSHA}}){{end}}, flags:{{range .Flags}} <code>{{.}}</code>{{end}}</p>{{end}}
+{{with .Report.ExtAuthz}}{{if and .Baseline .ExtAuthz}}
+<table>
+<tr><th>Latency (ms)</th><th>p50</th><th>p90</th><th>p99</th></tr>
+<tr><td>baseline</td><td>{{printf "%.3f" .Baseline.Latency.P50}}</td><td>{{printf "%.3f" .Baseline.Latency.P90}}</td><td>{{printf "%.3f" .Baseline.Latency.P99}}</td></tr>
+<tr><td>ext_authz</td><td>{{printf "%.3f" .ExtAuthz.Latency.P50}}</td><td>{{printf "%.3f" .ExtAuthz.Latency.P90}}</td><td>{{printf "%.3f" .ExtAuthz.Latency.P99}}</td></tr>
+<tr><td>added</td><td>{{printf "%.3f" .AddedLatency.P50}}</td><td>{{printf "%.3f" .AddedLatency.P90}}</td><td>{{printf "%.3f" .AddedLatency.P99}}</td></tr>
+</table>
+{{end}}{{end}}
+{{with .Report.Throttling}}<p>Throttled by the API server: {{.ThrottledBatches}} batches retried {{.Retries}} times, {{printf "%.1f" .BackoffSeconds}}s backoff.</p>{{end}}
+{{with .Report.Convergence}}<table>
+<tr><th>Batch</th><th>Policies applied</th><th>Convergence (s)</th><th>Push latency mean (s)</th><th>Push latency p99 (s)</th><th>Full pushes</th><th>Partial pushes</th></tr>
+{{range .Batches}}<tr><td>{{.Index}}</td><td>{{.PoliciesApplied}}</td><td>{{if not .Converged}}&gt;{{end}}{{printf "%.1f" .ConvergenceSeconds}}</td><td>{{printf "%.3f" .PushLatency.Mean}}</td><td>{{printf "%.3f" .PushLatency.P99}}</td><td>{{printf "%.0f" .FullPushes}}</td><td>{{printf "%.0f" .PartialPushes}}</td></tr>
+{{end}}</table>
+<p>Correlation of the mean push latency with the policies applied: {{printf "%.3f" .Correlation}}.</p>{{end}}
+{{with .Report.Enforcement}}<table>
+<tr><th>Batch</th><th>Policies applied</th><th>Time to enforcement (s)</th><th>Time to lift (s)</th><th>Probes</th></tr>
+{{range .Batches}}<tr><td>{{.Index}}</td><td>{{.PoliciesApplied}}</td><td>{{if not .Enforced}}&gt;{{end}}{{printf "%.1f" .SecondsToEnforcement}}</td><td>{{if not .Lifted}}&gt;{{end}}{{printf "%.1f" .SecondsToLift}}</td><td>{{.Probes}}</td></tr>
+{{end}}</table>
+<p>Time to enforcement of a DENY policy on the path {{.Request.Path}}.</p>{{end}}
+{{with .Report.Status}}<p>Control plane status: {{.Acknowledged}} of {{.Policies}} policies acknowledged{{if .Condition}} by {{.Condition}}{{end}}, latency p50 {{printf "%.1f" .Latency.P50}} ms, p99 {{printf "%.1f" .Latency.P99}} ms.</p>{{end}}
+{{with .Report.Readiness}}<p>Corpus {{.Generation}}: {{if .Ready}}enforced after {{printf "%.1f" .SecondsToReady}}s{{else}}NOT enforced{{end}}, {{.Attempts}} probe attempts.</p>{{end}}
+{{with .Report.Chaos}}<p>Chaos: {{if .Stable}}stable{{else}}NOT stable{{end}} after {{.Ops}} operations, {{.Applied}} applied, {{.Deleted}} deleted, {{.Rejected}} invalid rejected, {{.Admitted}} invalid admitted, {{.ApplyErrors}} failed; istiod {{.IstiodRestarts}} restarts, {{printf "%.0f" .XDSRejects}} xDS rejects, converged after {{if not .Converged}}&gt;{{end}}{{printf "%.1f" .ConvergenceSeconds}}s; {{.Missing}} policies missing, {{.Extra}} extra, {{.Modified}} modified.</p>{{end}}
+{{with .Report.Soak}}<p>Soak: {{.Policies}} policies, {{.Churned}} churned{{if .ChurnErrors}} ({{.ChurnErrors}} errors){{end}}, {{.FailedProbeRounds}} of {{.ProbeRounds}} probe rounds not decided as expected{{if .ProbeErrors}}, {{.ProbeErrors}} probe errors{{end}}, {{len .Snapshots}} snapshots; {{printf "%.0f" .FullPushes}} full and {{printf "%.0f" .PartialPushes}} incremental pushes, incremental ratio {{printf "%.2f" .IncrementalRatio}}{{if .Triggers}}, triggers{{range $trigger, $n := .Triggers}} {{$trigger}} {{printf "%.0f" $n}}{{end}}{{end}}.</p>{{end}}
+{{with .Report.ConfigDiff}}<p>Config diff of {{.Pod}}: {{.BytesBefore}} bytes of listeners and routes before, {{.BytesAfter}} after, {{printf "%.0f" .BytesPerPolicy}} per policy applied, {{len .Listeners}} listeners and {{len .Routes}} routes changed.</p>{{end}}
+{{with .Report.ListenerRBAC}}<p>RBAC per filter chain: {{.Skewed}} of {{len .Proxies}} proxies skewed{{range .Proxies}}; {{.Pod}} at most {{.MaxPolicies}} policies on a chain, {{printf "%.1f" .MeanPolicies}} on average{{if .Skewed}}, SKEWED{{end}}{{end}}.</p>{{end}}
+{{with .Report.APIServer}}<p>API server: {{printf "%.0f" .Requests}} requests in {{printf "%.1f" .DurationSeconds}}s, {{printf "%.1f" .RequestsPerSecond}}/s, {{printf "%.0f" .Throttled}} throttled; etcd database {{printf "%.0f" .DBSizeBytesBefore}} bytes before, {{printf "%.0f" .DBSizeBytesAfter}} after, {{printf "%.0f" .DBGrowthBytesPerPolicy}} per policy{{range .Objects}}; {{.Resource}} {{printf "%.0f" .Before}} to {{printf "%.0f" .After}} objects{{end}}.</p>{{end}}
+{{with .Report.Canary}}<p>Canary rollout of {{.Policies}} policies{{if .HeldBack}}, {{.HeldBack}} CUSTOM only enforced{{end}}{{range .Stages}}; {{.Name}}{{with .Load}} p99 {{printf "%.3f" .Latency.P99}} ms{{end}}{{with .AddedLatency}} ({{printf "%+.3f" .P99}} ms){{end}}{{with .RBAC}}, deny ratio {{printf "%.3f" .DenyRatio}}{{end}}, shadow deny ratio {{printf "%.3f" .ShadowDenyRatio}}{{end}}.</p>{{end}}
+{{with .Report.E2E}}<p>End-to-end enforcement: {{if .Passed}}passed{{else}}FAILED, {{.FailedProbes}} of {{len .Probes}} probes not decided as expected{{end}} after {{.Attempts}} attempts.</p>{{end}}
+{{with .Report.Load}}<p>{{.Requests}} requests, {{.Errors}} errors, {{printf "%.1f" .ActualQPS}} qps{{if .WarmupRequests}}, {{.WarmupRequests}} warmup requests excluded{{end}}{{if .UnexpectedDecisions}}, {{.UnexpectedDecisions}} unexpected decisions{{end}}.</p>{{end}}
+{{with .Report.RBAC}}<p>RBAC filters of {{len .Proxies}} proxies: {{printf "%.0f" .Total.Allowed}} allowed, {{printf "%.0f" .Total.Denied}} denied, deny ratio {{printf "%.3f" .DenyRatio}}, expected {{printf "%.3f" .ExpectedDenyRatio}}{{if or .Total.ShadowAllowed .Total.ShadowDenied}}; shadow rules {{printf "%.0f" .Total.ShadowAllowed}} allowed, {{printf "%.0f" .Total.ShadowDenied}} denied{{end}}.</p>{{end}}
+{{if .Outcomes}}<table>
+<tr><th>Outcome</th><th>Requests</th><th>QPS</th><th>p50 (ms)</th><th>p90 (ms)</th><th>p99 (ms)</th></tr>
+{{range .Outcomes}}<tr><td>{{.Name}}</td><td>{{.Requests}}</td><td>{{printf "%.1f" .QPS}}</td><td>{{printf "%.3f" .Latency.P50}}</td><td>{{printf "%.3f" .Latency.P90}}</td><td>{{printf "%.3f" .Latency.P99}}</td></tr>
+{{end}}</table>{{end}}
+{{range .Charts}}<h3>{{.Title}}</h3>
+{{.SVG}}
+{{end}}
+{{if .Report.Profiles}}<h3>Profiles</h3>
+<ul>{{range .Report.Profiles}}<li>{{.Kind}} at {{.Point}}: <code>{{.File}}</code></li>{{end}}</ul>
+{{end}}
+{{if .Report.Errors}}<h3>Errors</h3>
+<ul>{{range .Report.Errors}}<li>{{.}}</li>{{end}}</ul>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+func readRunReport(file string) (*RunReport, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	report := &RunReport{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return report, nil
+}
+
+func runReport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	format := fs.String("format", "markdown", "The output format, markdown, html, github for a compact comparison with -baseline to post as a PR comment, or junit for the -thresholds, regressions and validations of the runs as JUnit XML")
+	out := fs.String("out", "", "The file the report is written to. Default: stdout")
+	pushgateway := fs.String("pushgateway", "", "The URL of a Prometheus Pushgateway the results of the reports are pushed to")
+	job := fs.String("job", "security_benchmark", "The job of the metrics pushed to the Pushgateway")
+	labels := fs.String("labels", "", "Comma separated name=value labels grouping the metrics pushed to the Pushgateway, e.g. branch=main,cluster=ci")
+	baseline := fs.String("baseline", "", "Comma separated report.json files the reports are compared with by -format=github, in the order of the reports, or a single one for all of them")
+	threshold := fs.Float64("threshold", 10, "The percentage by which a metric of -format=github or junit worse than its baseline is a regression")
+	thresholdsFile := fs.String("thresholds", "", "A JSON file of the minimum or maximum results of -format=junit, e.g. {\"latency_p99_ms\": {\"max\": 5}}")
+	failOnFailures := fs.Bool("exitCode", false, "Exit with an error when a test case of -format=junit fails")
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: report [flags] <report.json>...")
+	}
+	grouping, err := parseLabels(*labels)
+	if err != nil {
+		return err
+	}
+	var baselines []string
+	if *baseline != "" {
+		baselines = strings.Split(*baseline, ",")
+		if len(baselines) != 1 && len(baselines) != fs.NArg() {
+			return fmt.Errorf("got %d baselines for %d reports, want one or one per report", len(baselines), fs.NArg())
+		}
+	}
+	var thresholds map[string]resultThreshold
+	if *thresholdsFile != "" {
+		if thresholds, err = readThresholds(*thresholdsFile); err != nil {
+			return err
+		}
+	}
+	var runs []reportRun
+	var githubRuns []githubRun
+	var suites []junitTestSuite
+	for i, file := range fs.Args() {
+		report, err := readRunReport(file)
+		if err != nil {
+			return err
+		}
+		runs = append(runs, newReportRun(filepath.Clean(file), report))
+		if *format == "github" || *format == "junit" {
+			var baselineFile string
+			var baselineReport *RunReport
+			if len(baselines) > 0 {
+				baselineFile = baselines[0]
+				if len(baselines) > 1 {
+					baselineFile = baselines[i]
+				}
+				if baselineReport, err = readRunReport(baselineFile); err != nil {
+					return err
+				}
+			}
+			run, err := compareRuns(filepath.Clean(file), report, baselineFile, baselineReport, *threshold)
+			if err != nil {
+				return fmt.Errorf("%s: %v", file, err)
+			}
+			githubRuns = append(githubRuns, run)
+			if *format == "junit" {
+				suite, err := junitSuite(filepath.Clean(file), report, thresholds, &run)
+				if err != nil {
+					return fmt.Errorf("%s: %v", file, err)
+				}
+				suites = append(suites, suite)
+			}
+		}
+		if *pushgateway != "" {
+			if err := pushReport(*pushgateway, *job, grouping, report); err != nil {
+				return fmt.Errorf("pushing %s: %v", file, err)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	switch *format {
+	case "markdown":
+		err = markdownReportTemplate.Execute(&buf, runs)
+	case "html":
+		err = htmlReportTemplate.Execute(&buf, runs)
+	case "github":
+		err = writeGitHubReport(&buf, githubRuns, *threshold)
+	case "junit":
+		err = writeJUnit(&buf, suites)
+	default:
+		return fmt.Errorf("unknown format %q, must be markdown, html, github or junit", *format)
+	}
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+	} else {
+		err = ioutil.WriteFile(*out, buf.Bytes(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	failures := 0
+	for _, s := range suites {
+		failures += s.Failures
+	}
+	if *failOnFailures && failures > 0 {
+		return fmt.Errorf("%d test cases failed", failures)
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resultsSchemaVersion is the version of the columns of the exported results. A new version only
+// adds nullable columns, so that the rows of the previous versions stay valid in the same table.
+const resultsSchemaVersion = 1
+
+// resultColumn is a column of the exported results, with its BigQuery type.
+type resultColumn struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Mode        string `json:"mode"`
+	Description string `json:"description"`
+}
+
+// resultColumns are the columns of a row of the exported results, one row per run.
+var resultColumns = []resultColumn{
+	{"schema_version", "INTEGER", "REQUIRED", "The version of the columns of the row"},
+	{"run_id", "STRING", "REQUIRED", "The id of the run, a hash of its command and start time"},
+	{"command", "STRING", "REQUIRED", "The subcommand of the run"},
+	{"config_file", "STRING", "NULLABLE", "The config file of the policies"},
+	{"labels", "STRING", "NULLABLE", "The labels of the export as a JSON object, e.g. the branch"},
+	{"tool_version", "STRING", "NULLABLE", "The version of generate_policies"},
+	{"git_sha", "STRING", "NULLABLE", "The git SHA of generate_policies"},
+	{"flags", "STRING", "NULLABLE", "The flags of the run, space separated"},
+	{"start_time", "TIMESTAMP", "REQUIRED", "The start of the run"},
+	{"duration_seconds", "FLOAT", "REQUIRED", "The duration of the run"},
+	{"interrupted", "BOOLEAN", "REQUIRED", "Whether the run was interrupted"},
+	{"errors", "INTEGER", "REQUIRED", "The number of errors of the run"},
+	{"policies_applied", "INTEGER", "REQUIRED", "The number of policies applied"},
+	{"apply_seconds", "FLOAT", "NULLABLE", "The time spent applying the batches"},
+	{"load_requests", "INTEGER", "NULLABLE", "The number of requests of the load"},
+	{"load_qps", "FLOAT", "NULLABLE", "The throughput of the load"},
+	{"latency_p50_ms", "FLOAT", "NULLABLE", "The median latency of the load"},
+	{"latency_p90_ms", "FLOAT", "NULLABLE", "The p90 latency of the load"},
+	{"latency_p99_ms", "FLOAT", "NULLABLE", "The p99 latency of the load"},
+	{"denied_latency_p99_ms", "FLOAT", "NULLABLE", "The p99 latency of the denied requests of the load"},
+	{"ext_authz_added_p99_ms", "FLOAT", "NULLABLE", "The p99 latency added by ext_authz"},
+	{"push_latency_mean_seconds", "FLOAT", "NULLABLE", "The mean pilot_proxy_convergence_time of the last batch, or of the first revision"},
+	{"push_latency_p99_seconds", "FLOAT", "NULLABLE", "The p99 pilot_proxy_convergence_time of the last batch, or of the first revision"},
+	{"config_size_p99_bytes", "FLOAT", "NULLABLE", "The p99 pilot_xds_config_size_bytes of the first revision"},
+	{"convergence_seconds", "FLOAT", "NULLABLE", "The convergence time of the last batch, or of the first revision"},
+	{"convergence_correlation", "FLOAT", "NULLABLE", "The correlation of the mean push latency with the policies applied"},
+	{"enforcement_seconds", "FLOAT", "NULLABLE", "The time to enforcement of a DENY policy after the last batch"},
+	{"incremental_push_ratio", "FLOAT", "NULLABLE", "The share of the incremental pushes of istiod during the churn of a soak run"},
+	{"apiserver_requests_per_second", "FLOAT", "NULLABLE", "The requests per second served by the API server during the apply"},
+	{"etcd_growth_bytes_per_policy", "FLOAT", "NULLABLE", "The growth of the etcd database per policy applied"},
+	{"canary_dry_run_added_p99_ms", "FLOAT", "NULLABLE", "The p99 latency added by the dry-run stage of a canary run"},
+	{"canary_enforced_added_p99_ms", "FLOAT", "NULLABLE", "The p99 latency added by the enforced stage of a canary run"},
+	{"canary_shadow_deny_ratio", "FLOAT", "NULLABLE", "The share of the shadow decisions which denied the request in the dry-run stage of a canary run"},
+	{"rbac_deny_ratio", "FLOAT", "NULLABLE", "The share of the requests denied by the RBAC filters"},
+	{"e2e_passed", "BOOLEAN", "NULLABLE", "Whether the end-to-end enforcement test passed"},
+}
+
+// resultRow returns the row of a run report, keyed by column. The columns of the results the
+// report does not have are missing.
+func resultRow(report *RunReport, labels map[string]string) (map[string]interface{}, error) {
+	id := sha256.Sum256([]byte(report.Command + " " + report.StartTime.UTC().Format(time.RFC3339Nano)))
+	row := map[string]interface{}{
+		"schema_version":   resultsSchemaVersion,
+		"run_id":           hex.EncodeToString(id[:8]),
+		"command":          report.Command,
+		"start_time":       report.StartTime.UTC().Format(time.RFC3339Nano),
+		"duration_seconds": report.EndTime.Sub(report.StartTime).Seconds(),
+		"interrupted":      report.Interrupted,
+		"errors":           len(report.Errors),
+		"policies_applied": report.PoliciesApplied,
+	}
+	if report.ConfigFile != "" {
+		row["config_file"] = report.ConfigFile
+	}
+	if len(labels) > 0 {
+		js, err := json.Marshal(labels)
+		if err != nil {
+			return nil, err
+		}
+		row["labels"] = string(js)
+	}
+	if m := report.Metadata; m != nil {
+		row["tool_version"] = m.ToolVersion
+		if m.GitSHA != "" {
+			row["git_sha"] = m.GitSHA
+		}
+		row["flags"] = strings.Join(m.Flags, " ")
+	}
+	if len(report.Batches) > 0 {
+		apply := 0.0
+		for _, b := range report.Batches {
+			apply += b.DurationSeconds
+		}
+		row["apply_seconds"] = apply
+	}
+	if l := report.Load; l != nil {
+		row["load_requests"] = l.Requests
+		row["load_qps"] = l.ActualQPS
+		row["latency_p50_ms"] = l.Latency.P50
+		row["latency_p90_ms"] = l.Latency.P90
+		row["latency_p99_ms"] = l.Latency.P99
+		if denied, ok := l.LatencyByOutcome[outcomeDenied]; ok {
+			row["denied_latency_p99_ms"] = denied.P99
+		}
+	}
+	if e := report.ExtAuthz; e != nil {
+		row["ext_authz_added_p99_ms"] = e.AddedLatency.P99
+	}
+	if ab := report.AB; ab != nil && len(ab.Revisions) > 0 {
+		r := ab.Revisions[0]
+		row["push_latency_mean_seconds"] = r.PushLatency.Mean
+		row["push_latency_p99_seconds"] = r.PushLatency.P99
+		row["config_size_p99_bytes"] = r.ConfigSize.P99
+		row["convergence_seconds"] = r.ConvergenceSeconds
+	}
+	if e := report.Enforcement; e != nil && len(e.Batches) > 0 {
+		row["enforcement_seconds"] = e.Batches[len(e.Batches)-1].SecondsToEnforcement
+	}
+	if a := report.APIServer; a != nil {
+		row["apiserver_requests_per_second"] = a.RequestsPerSecond
+		row["etcd_growth_bytes_per_policy"] = a.DBGrowthBytesPerPolicy
+	}
+	if s := report.Soak; s != nil && s.FullPushes+s.PartialPushes > 0 {
+		row["incremental_push_ratio"] = s.IncrementalRatio()
+	}
+	if c := report.Convergence; c != nil && len(c.Batches) > 0 {
+		last := c.Batches[len(c.Batches)-1]
+		row["push_latency_mean_seconds"] = last.PushLatency.Mean
+		row["push_latency_p99_seconds"] = last.PushLatency.P99
+		row["convergence_seconds"] = last.ConvergenceSeconds
+		row["convergence_correlation"] = c.Correlation
+	}
+	if c := report.Canary; c != nil {
+		if s := c.stage(canaryDryRun); s != nil && s.AddedLatency != nil {
+			row["canary_dry_run_added_p99_ms"] = s.AddedLatency.P99
+			row["canary_shadow_deny_ratio"] = s.ShadowDenyRatio
+		}
+		if s := c.stage(canaryEnforced); s != nil && s.AddedLatency != nil {
+			row["canary_enforced_added_p99_ms"] = s.AddedLatency.P99
+		}
+	}
+	if r := report.RBAC; r != nil {
+		row["rbac_deny_ratio"] = r.DenyRatio
+	}
+	if e := report.E2E; e != nil {
+		row["e2e_passed"] = e.Passed
+	}
+	return row, nil
+}
+
+// writeNDJSON writes the rows as newline delimited JSON, the format of bq load.
+func writeNDJSON(w io.Writer, rows []map[string]interface{}) error {
+	for _, row := range rows {
+		js, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", js); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqlTypes maps the BigQuery types of the columns to standard SQL types.
+var sqlTypes = map[string]string{
+	"STRING":    "TEXT",
+	"INTEGER":   "BIGINT",
+	"FLOAT":     "DOUBLE PRECISION",
+	"BOOLEAN":   "BOOLEAN",
+	"TIMESTAMP": "TIMESTAMP",
+}
+
+// sqlLiteral returns the SQL literal of a value of a row.
+func sqlLiteral(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		// SQL has no literal for NaN and the infinities, e.g. a ratio with a zero denominator.
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "NULL"
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return sqlLiteral(fmt.Sprint(v))
+	}
+}
+
+// writeSQL writes the statements creating table, unless it exists, and inserting the rows, for
+// psql, sqlite3 and the other SQL clients.
+func writeSQL(w io.Writer, table string, rows []map[string]interface{}) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "-- generate_policies results, schema version %d\n", resultsSchemaVersion)
+	fmt.Fprintf(&b, "CREATE TABLE IF NOT EXISTS %s (\n", table)
+	for i, c := range resultColumns {
+		notNull := ""
+		if c.Mode == "REQUIRED" {
+			notNull = " NOT NULL"
+		}
+		sep := ","
+		if i == len(resultColumns)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(&b, "  %s %s%s%s\n", c.Name, sqlTypes[c.Type], notNull, sep)
+	}
+	fmt.Fprintf(&b, ");\n")
+	names := make([]string, len(resultColumns))
+	for i, c := range resultColumns {
+		names[i] = c.Name
+	}
+	for _, row := range rows {
+		values := make([]string, len(resultColumns))
+		for i, c := range resultColumns {
+			values[i] = sqlLiteral(row[c.Name])
+		}
+		fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES (%s);\n", table, strings.Join(names, ", "), strings.Join(values, ", "))
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// bigQuerySchema returns the schema of the results in the JSON format of bq.
+func bigQuerySchema() ([]byte, error) {
+	return json.MarshalIndent(resultColumns, "", "  ")
+}
+
+// loadBigQuery appends the rows to table, project:dataset.table, with bq load. Allowing the
+// columns of new schema versions lets bq add them to an existing table.
+func loadBigQuery(ctx context.Context, table string, rows []map[string]interface{}) error {
+	dir, err := ioutil.TempDir("", "generate-policies-results")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	schema, err := bigQuerySchema()
+	if err != nil {
+		return err
+	}
+	schemaFile := filepath.Join(dir, "schema.json")
+	if err := ioutil.WriteFile(schemaFile, schema, 0644); err != nil {
+		return err
+	}
+	var data bytes.Buffer
+	if err := writeNDJSON(&data, rows); err != nil {
+		return err
+	}
+	dataFile := filepath.Join(dir, "rows.json")
+	if err := ioutil.WriteFile(dataFile, data.Bytes(), 0644); err != nil {
+		return err
+	}
+	_, err = command(ctx, nil, "bq", "load", "--source_format=NEWLINE_DELIMITED_JSON",
+		"--schema_update_option=ALLOW_FIELD_ADDITION", table, dataFile, schemaFile)
+	return err
+}
+
+func runExportResults(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export-results", flag.ExitOnError)
+	sink := fs.String("sink", "ndjson", "Where the results are exported: bigquery appends them to -table with bq load, sql writes SQL statements, ndjson newline delimited JSON rows, schema the BigQuery schema of the rows")
+	table := fs.String("table", "security_benchmark_runs", "The table of the results, project:dataset.table for bigquery")
+	labels := fs.String("labels", "", "Comma separated name=value labels recorded with every row, e.g. branch=main,cluster=ci")
+	out := fs.String("out", "", "The file the sql, ndjson or schema output is written to. Default: stdout")
+	_ = fs.Parse(args)
+
+	grouping, err := parseLabels(*labels)
+	if err != nil {
+		return err
+	}
+	var rows []map[string]interface{}
+	if *sink != "schema" {
+		if fs.NArg() == 0 {
+			return fmt.Errorf("usage: export-results [flags] <report.json>...")
+		}
+		for _, file := range fs.Args() {
+			report, err := readRunReport(file)
+			if err != nil {
+				return err
+			}
+			row, err := resultRow(report, grouping)
+			if err != nil {
+				return fmt.Errorf("%s: %v", file, err)
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	var buf bytes.Buffer
+	switch *sink {
+	case "bigquery":
+		if err := loadBigQuery(ctx, *table, rows); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "appended %d rows to %s\n", len(rows), *table)
+		return nil
+	case "sql":
+		err = writeSQL(&buf, *table, rows)
+	case "ndjson":
+		err = writeNDJSON(&buf, rows)
+	case "schema":
+		var schema []byte
+		schema, err = bigQuerySchema()
+		buf.Write(append(schema, '\n'))
+	default:
+		return fmt.Errorf("unknown sink %q, must be bigquery, sql, ndjson or schema", *sink)
+	}
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	return ioutil.WriteFile(*out, buf.Bytes(), 0644)
+}
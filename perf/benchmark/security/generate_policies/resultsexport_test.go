@@ -0,0 +1,117 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResultRow(t *testing.T) {
+	start := time.Date(2021, 1, 7, 0, 0, 0, 0, time.UTC)
+	report := &RunReport{
+		Command:     "bench",
+		Metadata:    &RunMetadata{ToolVersion: "v1.2.3", Flags: []string{"-qps=100"}},
+		StartTime:   start,
+		EndTime:     start.Add(time.Minute),
+		Load:        &LoadResult{Requests: 6000, ActualQPS: 100, Latency: LatencySummary{P99: 3.5}},
+		RBAC:        &RBACResult{DenyRatio: 0.25},
+		Convergence: &ConvergenceResult{Batches: []BatchConvergence{{PushLatency: HistogramSummary{P99: 0.4}}}, Correlation: 0.9},
+	}
+	row, err := resultRow(report, map[string]string{"branch": "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := map[string]resultColumn{}
+	for _, c := range resultColumns {
+		columns[c.Name] = c
+	}
+	for name := range row {
+		if _, ok := columns[name]; !ok {
+			t.Errorf("column %s of the row is not in the schema", name)
+		}
+	}
+	for _, c := range resultColumns {
+		if _, ok := row[c.Name]; c.Mode == "REQUIRED" && !ok {
+			t.Errorf("required column %s is missing", c.Name)
+		}
+	}
+	for name, want := range map[string]interface{}{
+		"schema_version":           resultsSchemaVersion,
+		"labels":                   `{"branch":"main"}`,
+		"duration_seconds":         60.0,
+		"latency_p99_ms":           3.5,
+		"rbac_deny_ratio":          0.25,
+		"push_latency_p99_seconds": 0.4,
+		"flags":                    "-qps=100",
+		"start_time":               "2021-01-07T00:00:00Z",
+	} {
+		if row[name] != want {
+			t.Errorf("%s = %v, want %v", name, row[name], want)
+		}
+	}
+	if _, ok := row["e2e_passed"]; ok {
+		t.Errorf("the row of a run without e2e results has e2e_passed")
+	}
+
+	var ndjson bytes.Buffer
+	if err := writeNDJSON(&ndjson, []map[string]interface{}{row, row}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(ndjson.String()), "\n")
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &parsed); len(lines) != 2 || err != nil || parsed["command"] != "bench" {
+		t.Errorf("unexpected rows %s: %v", ndjson.String(), err)
+	}
+
+	var sql bytes.Buffer
+	if err := writeSQL(&sql, "runs", []map[string]interface{}{row}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"CREATE TABLE IF NOT EXISTS runs (\n  schema_version BIGINT NOT NULL,",
+		"  e2e_passed BOOLEAN\n);",
+		"INSERT INTO runs (schema_version, run_id, command, config_file, labels,",
+		"VALUES (1, '", "'bench', NULL, '{\"branch\":\"main\"}', 'v1.2.3',",
+	} {
+		if !strings.Contains(sql.String(), want) {
+			t.Errorf("missing %q in\n%s", want, sql.String())
+		}
+	}
+}
+
+func TestSQLLiteral(t *testing.T) {
+	for _, c := range []struct {
+		in   interface{}
+		want string
+	}{
+		{nil, "NULL"},
+		{"it's", "'it''s'"},
+		{true, "TRUE"},
+		{42, "42"},
+		{0.5, "0.5"},
+		{math.NaN(), "NULL"},
+		{math.Inf(1), "NULL"},
+		{math.Inf(-1), "NULL"},
+	} {
+		if got := sqlLiteral(c.in); got != c.want {
+			t.Errorf("sqlLiteral(%v) = %s, want %s", c.in, got, c.want)
+		}
+	}
+}
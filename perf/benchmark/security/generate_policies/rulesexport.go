@@ -0,0 +1,160 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+// ruleColumns are the columns of the CSV export of the rules.
+var ruleColumns = []string{"namespace", "policy", "action", "provider", "selector", "rule", "sources", "operations", "conditions"}
+
+// csvField is a field of a source or an operation with its values.
+type csvField struct {
+	name   string
+	values []string
+}
+
+// csvFields returns the fields with values as name=value,value, ANDed.
+func csvFields(fields []csvField) string {
+	var parts []string
+	for _, f := range fields {
+		if len(f.values) > 0 {
+			parts = append(parts, f.name+"="+strings.Join(f.values, ","))
+		}
+	}
+	return strings.Join(parts, " AND ")
+}
+
+func csvSources(rule *authzpb.Rule) string {
+	var sources []string
+	for _, from := range rule.From {
+		s := from.GetSource()
+		sources = append(sources, csvFields([]csvField{
+			{"principals", s.GetPrincipals()},
+			{"notPrincipals", s.GetNotPrincipals()},
+			{"requestPrincipals", s.GetRequestPrincipals()},
+			{"notRequestPrincipals", s.GetNotRequestPrincipals()},
+			{"namespaces", s.GetNamespaces()},
+			{"notNamespaces", s.GetNotNamespaces()},
+			{"ipBlocks", s.GetIpBlocks()},
+			{"notIpBlocks", s.GetNotIpBlocks()},
+			{"remoteIpBlocks", s.GetRemoteIpBlocks()},
+			{"notRemoteIpBlocks", s.GetNotRemoteIpBlocks()},
+		}))
+	}
+	return strings.Join(sources, " OR ")
+}
+
+func csvOperations(rule *authzpb.Rule) string {
+	var operations []string
+	for _, to := range rule.To {
+		o := to.GetOperation()
+		operations = append(operations, csvFields([]csvField{
+			{"hosts", o.GetHosts()},
+			{"notHosts", o.GetNotHosts()},
+			{"ports", o.GetPorts()},
+			{"notPorts", o.GetNotPorts()},
+			{"methods", o.GetMethods()},
+			{"notMethods", o.GetNotMethods()},
+			{"paths", o.GetPaths()},
+			{"notPaths", o.GetNotPaths()},
+		}))
+	}
+	return strings.Join(operations, " OR ")
+}
+
+// csvConditions returns the conditions of rule as key=value,value and key!=value,value, ANDed.
+func csvConditions(rule *authzpb.Rule) string {
+	var conditions []string
+	for _, c := range rule.When {
+		if len(c.Values) > 0 {
+			conditions = append(conditions, c.Key+"="+strings.Join(c.Values, ","))
+		}
+		if len(c.NotValues) > 0 {
+			conditions = append(conditions, c.Key+"!="+strings.Join(c.NotValues, ","))
+		}
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// ruleRows returns a row of ruleColumns per rule of the policies. The from and to entries of a
+// rule are ORed in its sources and operations cells, their fields and the conditions are ANDed.
+// A policy without rules has a row with an empty rule, so that allow-nothing policies are listed.
+func ruleRows(policies []parsedAuthorizationPolicy) [][]string {
+	var rows [][]string
+	for _, p := range policies {
+		labels := p.Spec.GetSelector().GetMatchLabels()
+		var selector []string
+		for _, k := range getSortedLabelKeys(labels) {
+			selector = append(selector, k+"="+labels[k])
+		}
+		policy := []string{p.Namespace, p.Name, p.Spec.Action.String(), p.Spec.GetProvider().GetName(), strings.Join(selector, ",")}
+		if len(p.Spec.Rules) == 0 {
+			rows = append(rows, append(policy, "", "", "", ""))
+			continue
+		}
+		for i, rule := range p.Spec.Rules {
+			row := append(append([]string(nil), policy...), strconv.Itoa(i), csvSources(rule), csvOperations(rule), csvConditions(rule))
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// writeRuleCSV writes the header and the rows of the rules of the policies to w.
+func writeRuleCSV(w io.Writer, policies []parsedAuthorizationPolicy) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(ruleColumns); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(ruleRows(policies)); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func runExportRules(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export-rules", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the generated policies")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	policyFile := fs.String("policyFile", "", "A YAML file of policies to export instead of the generated ones")
+	out := fs.String("out", "", "The file the CSV is written to. Default: stdout")
+	_ = fs.Parse(args)
+
+	policies, err := loadAuthorizationPolicies(ctx, *scenarioName, *configFile, *policyFile)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := writeRuleCSV(&buf, policies); err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	return ioutil.WriteFile(*out, buf.Bytes(), 0644)
+}
@@ -0,0 +1,73 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteRuleCSV(t *testing.T) {
+	policies, err := parseAuthorizationPolicies(splitYAMLDocuments(`
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: deny
+  namespace: ns
+spec:
+  action: DENY
+  selector:
+    matchLabels:
+      app: web
+  rules:
+  - from:
+    - source:
+        namespaces: ["x", "y"]
+        notPrincipals: ["cluster.local/ns/x/sa/admin"]
+    - source:
+        ipBlocks: ["10.0.0.0/8"]
+    to:
+    - operation:
+        paths: ["/a", "/b"]
+        methods: ["GET"]
+    when:
+    - key: request.auth.claims[groups]
+      values: ["dev"]
+      notValues: ["ops"]
+  - {}
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: allow-nothing
+  namespace: istio-system
+spec: {}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := writeRuleCSV(&b, policies); err != nil {
+		t.Fatal(err)
+	}
+	want := `namespace,policy,action,provider,selector,rule,sources,operations,conditions
+ns,deny,DENY,,app=web,0,"notPrincipals=cluster.local/ns/x/sa/admin AND namespaces=x,y OR ipBlocks=10.0.0.0/8","methods=GET AND paths=/a,/b",request.auth.claims[groups]=dev AND request.auth.claims[groups]!=ops
+ns,deny,DENY,,app=web,1,,,
+istio-system,allow-nothing,ALLOW,,,,,,
+`
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+// RunReport summarizes a run of a subcommand that talks to a cluster. It is written as
+// report.json into the run's output directory, next to any artifacts it references.
+type RunReport struct {
+	Command         string              `json:"command"`
+	ConfigFile      string              `json:"configFile,omitempty"`
+	Metadata        *RunMetadata        `json:"metadata,omitempty"`
+	StartTime       time.Time           `json:"startTime"`
+	EndTime         time.Time           `json:"endTime"`
+	PoliciesApplied int                 `json:"policiesApplied"`
+	Batches         []BatchResult       `json:"batches,omitempty"`
+	Convergence     *ConvergenceResult  `json:"convergence,omitempty"`
+	Enforcement     *EnforcementResult  `json:"enforcement,omitempty"`
+	Profiles        []ProfileArtifact   `json:"profiles,omitempty"`
+	ExtAuthz        *ExtAuthzResult     `json:"extAuthz,omitempty"`
+	Load            *LoadResult         `json:"load,omitempty"`
+	RBAC            *RBACResult         `json:"rbac,omitempty"`
+	AB              *ABResult           `json:"ab,omitempty"`
+	Chaos           *ChaosResult        `json:"chaos,omitempty"`
+	Throttling      *ThrottlingResult   `json:"throttling,omitempty"`
+	E2E             *E2EResult          `json:"e2e,omitempty"`
+	Status          *StatusResult       `json:"status,omitempty"`
+	Readiness       *ReadinessResult    `json:"readiness,omitempty"`
+	Soak            *SoakResult         `json:"soak,omitempty"`
+	ConfigDiff      *ConfigDiffResult   `json:"configDiff,omitempty"`
+	ListenerRBAC    *ListenerRBACResult `json:"listenerRBAC,omitempty"`
+	APIServer       *APIServerResult    `json:"apiServer,omitempty"`
+	Canary          *CanaryResult       `json:"canary,omitempty"`
+	// Interrupted is set when the run was cancelled, the report covers the partial run.
+	Interrupted bool     `json:"interrupted,omitempty"`
+	Errors      []string `json:"errors,omitempty"`
+}
+
+// BatchResult records one kubectl apply of a slice of the corpus.
+type BatchResult struct {
+	Index           int     `json:"index"`
+	Policies        int     `json:"policies"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	// Retries is the number of times the batch was applied again after being throttled, the
+	// duration includes the backoff between them.
+	Retries        int     `json:"retries,omitempty"`
+	BackoffSeconds float64 `json:"backoffSeconds,omitempty"`
+}
+
+// ThrottlingResult summarizes the batches the API server throttled with 429 Too Many Requests.
+type ThrottlingResult struct {
+	ThrottledBatches int     `json:"throttledBatches"`
+	Retries          int     `json:"retries"`
+	BackoffSeconds   float64 `json:"backoffSeconds"`
+}
+
+func (r *RunReport) addThrottling(retries int, waited time.Duration) {
+	if r.Throttling == nil {
+		r.Throttling = &ThrottlingResult{}
+	}
+	r.Throttling.ThrottledBatches++
+	r.Throttling.Retries += retries
+	r.Throttling.BackoffSeconds += waited.Seconds()
+}
+
+func writeRunReport(dir string, report *RunReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "report.json"), data, 0644)
+}
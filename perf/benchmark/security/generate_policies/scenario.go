@@ -0,0 +1,322 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// scenario is a named preset reproducing a policy shape commonly seen in real meshes.
+type scenario struct {
+	description string
+	// tags name the data planes enforcing every field of the policies: "sidecar", "ambient" when
+	// ztunnel does so without a waypoint, "waypoint" for policies bound to ambient waypoints and
+	// "ingress" and "egress" for policies of the ingress and egress gateways.
+	tags   []string
+	policy generatepolicies.SecurityPolicy
+	// traffic, if set, returns the load that should be sent while the scenario is applied.
+	traffic func(policyData generatepolicies.SecurityPolicy) (*TrafficProfile, error)
+}
+
+var scenarios = map[string]scenario{
+	"jwt-heavy": {
+		description: "RequestAuthentications with many issuers and ALLOW policies matching request principals and token claims",
+		tags:        []string{"sidecar"},
+		policy: generatepolicies.SecurityPolicy{
+			AuthZ: generatepolicies.AuthorizationPolicy{
+				Action:               "ALLOW",
+				NumPolicies:          10,
+				NumRequestPrincipals: 100,
+				NumClaims:            100,
+			},
+			RequestAuthN: generatepolicies.RequestAuthentication{
+				NumPolicies: 1,
+				NumJwks:     100,
+			},
+		},
+		traffic: tokenTraffic,
+	},
+	"ip-allowlist": {
+		description: "DENY policies with thousands of ipBlocks and remoteIpBlocks modeling WAF style IP lists",
+		tags:        []string{"sidecar"},
+		policy: generatepolicies.SecurityPolicy{
+			AuthZ: generatepolicies.AuthorizationPolicy{
+				Action:      "DENY",
+				NumPolicies: 10,
+				NumSourceIP: 5000,
+				NumRemoteIP: 5000,
+			},
+		},
+	},
+	"path-matrix": {
+		description: "An ALLOW policy on a single service with one operation per path and method, modeling API gateway style per-route authorization",
+		tags:        []string{"sidecar"},
+		policy: generatepolicies.SecurityPolicy{
+			AuthZ: generatepolicies.AuthorizationPolicy{
+				Action:      "ALLOW",
+				Selector:    map[string]string{"app": "fortioserver"},
+				NumPolicies: 1,
+				NumPaths:    100,
+				NumMethods:  5,
+			},
+		},
+		traffic: pathMatrixTraffic,
+	},
+	"ingress-edge": {
+		description: "An ALLOW policy on the ingress gateway with one operation per host, path and method and SNI conditions, modeling edge authorization",
+		tags:        []string{"ingress"},
+		policy: generatepolicies.SecurityPolicy{
+			Namespace: "istio-system",
+			AuthZ: generatepolicies.AuthorizationPolicy{
+				Action:      "ALLOW",
+				Selector:    map[string]string{"istio": "ingressgateway"},
+				NumPolicies: 1,
+				NumHosts:    10,
+				NumPaths:    20,
+				NumMethods:  3,
+				NumSNIs:     10,
+			},
+		},
+		traffic: ingressTraffic,
+	},
+	"authz-access-logs": {
+		description: "An ALLOW policy on a single service with a Telemetry resource logging the decisions of its RBAC filters, to verify the enforcement from the access logs",
+		tags:        []string{"sidecar"},
+		policy: generatepolicies.SecurityPolicy{
+			AccessLogs: &generatepolicies.AccessLogs{},
+			AuthZ: generatepolicies.AuthorizationPolicy{
+				Action:      "ALLOW",
+				Selector:    map[string]string{"app": "fortioserver"},
+				NumPolicies: 1,
+				NumPaths:    10,
+			},
+		},
+	},
+	"egress-control": {
+		description: "An ALLOW policy on the egress gateway matching many external hosts and a DENY policy for blocked hosts, with their ServiceEntries and egress gateway routing",
+		tags:        []string{"egress"},
+		policy: generatepolicies.SecurityPolicy{
+			Namespace:          "istio-system",
+			Egress:             true,
+			EgressBlockedHosts: 20,
+			AuthZ: generatepolicies.AuthorizationPolicy{
+				Action:      "ALLOW",
+				Selector:    map[string]string{"istio": "egressgateway"},
+				NumPolicies: 1,
+				NumHosts:    100,
+			},
+		},
+	},
+	"namespace-isolation": {
+		description: "An allow-nothing policy and an ALLOW policy for the namespace itself and the ingress gateway in each of 1000 namespaces",
+		tags:        []string{"ambient", "sidecar"},
+		policy: generatepolicies.SecurityPolicy{
+			NamespaceIsolation: &generatepolicies.NamespaceIsolation{NumNamespaces: 1000, Namespaces: true},
+		},
+	},
+	"tiered-org": {
+		description: "300 policies layered in mesh-wide DENY, namespace-wide ALLOW and per-workload ALLOW tiers over 10 namespaces of 5 workloads",
+		tags:        []string{"sidecar"},
+		policy: generatepolicies.SecurityPolicy{
+			AuthZ: generatepolicies.AuthorizationPolicy{
+				NumPrincipals: 10,
+				NumPaths:      10,
+			},
+			Tiers: &generatepolicies.Tiers{
+				NumPolicies:   300,
+				Mesh:          generatepolicies.Tier{Weight: 1, Action: "DENY"},
+				Namespace:     generatepolicies.Tier{Weight: 3, Action: "ALLOW"},
+				Workload:      generatepolicies.Tier{Weight: 6, Action: "ALLOW"},
+				NumNamespaces: 10,
+				NumWorkloads:  5,
+			},
+		},
+	},
+	"sidecar-scoped": {
+		description: "The policies of tiered-org with a Sidecar narrowing the egress of the proxies of each of their namespaces, to compare with tiered-org",
+		tags:        []string{"sidecar"},
+		policy: generatepolicies.SecurityPolicy{
+			SidecarScope: &generatepolicies.SidecarScope{},
+			AuthZ: generatepolicies.AuthorizationPolicy{
+				NumPrincipals: 10,
+				NumPaths:      10,
+			},
+			Tiers: &generatepolicies.Tiers{
+				NumPolicies:   300,
+				Mesh:          generatepolicies.Tier{Weight: 1, Action: "DENY"},
+				Namespace:     generatepolicies.Tier{Weight: 3, Action: "ALLOW"},
+				Workload:      generatepolicies.Tier{Weight: 6, Action: "ALLOW"},
+				NumNamespaces: 10,
+				NumWorkloads:  5,
+			},
+		},
+	},
+	"selector-unique": {
+		description: "1000 ALLOW policies each selecting its own workloads, stressing the selector index of istiod",
+		tags:        []string{"sidecar"},
+		policy: generatepolicies.SecurityPolicy{
+			AuthZ: generatepolicies.AuthorizationPolicy{
+				Action:       "ALLOW",
+				NumPolicies:  1000,
+				NumSelectors: 1000,
+				NumPaths:     5,
+			},
+		},
+	},
+	"selector-shared": {
+		description: "1000 ALLOW policies sharing 10 selectors, stressing the filtering of the policies of a proxy",
+		tags:        []string{"sidecar"},
+		policy: generatepolicies.SecurityPolicy{
+			AuthZ: generatepolicies.AuthorizationPolicy{
+				Action:       "ALLOW",
+				NumPolicies:  1000,
+				NumSelectors: 10,
+				NumPaths:     5,
+			},
+		},
+	},
+	"waypoint-l7": {
+		description: "ALLOW policies bound to an ambient waypoint with one operation per path and method, with the waypoint Gateway",
+		tags:        []string{"waypoint"},
+		policy: generatepolicies.SecurityPolicy{
+			Ambient: true,
+			AuthZ: generatepolicies.AuthorizationPolicy{
+				Action:        "ALLOW",
+				Waypoint:      &generatepolicies.Waypoint{Gateways: true},
+				NumPolicies:   10,
+				NumPrincipals: 10,
+				NumPaths:      20,
+				NumMethods:    3,
+			},
+		},
+		traffic: pathMatrixTraffic,
+	},
+	"ambient-l4": {
+		description: "ALLOW policies matching principals, namespaces, ipBlocks and ports only, which ztunnel enforces without a waypoint",
+		tags:        []string{"ambient", "sidecar"},
+		policy: generatepolicies.SecurityPolicy{
+			Ambient: true,
+			AuthZ: generatepolicies.AuthorizationPolicy{
+				Action:        "ALLOW",
+				NumPolicies:   10,
+				NumPrincipals: 100,
+				NumNamespaces: 100,
+				NumSourceIP:   100,
+				NumPorts:      10,
+			},
+		},
+	},
+	"deep-claims": {
+		description: "ALLOW policies with conditions on claims nested 10 levels deep in the token, 10 claims per level, stressing JWT claim extraction",
+		tags:        []string{"sidecar"},
+		policy: generatepolicies.SecurityPolicy{
+			AuthZ: generatepolicies.AuthorizationPolicy{
+				Action:       "ALLOW",
+				NumPolicies:  10,
+				ClaimNesting: &generatepolicies.ClaimNesting{Depth: 10, FanOut: 10},
+			},
+			RequestAuthN: generatepolicies.RequestAuthentication{
+				NumPolicies: 1,
+				NumJwks:     1,
+			},
+		},
+		traffic: tokenTraffic,
+	},
+	"unicode-values": {
+		description: "ALLOW policies with paths, hosts, SNIs and claim values in several scripts, raw and percent-encoded, measuring matchers with non-ASCII values",
+		tags:        []string{"sidecar"},
+		policy: generatepolicies.SecurityPolicy{
+			AuthZ: generatepolicies.AuthorizationPolicy{
+				Action:      "ALLOW",
+				NumPolicies: 10,
+				NumPaths:    100,
+				NumHosts:    20,
+				NumSNIs:     10,
+				NumClaims:   50,
+				Unicode:     true,
+			},
+			RequestAuthN: generatepolicies.RequestAuthentication{
+				NumPolicies: 1,
+				NumJwks:     1,
+			},
+		},
+		traffic: tokenTraffic,
+	},
+}
+
+// scenarioNames lists the scenarios with their tags.
+func scenarioNames() string {
+	var names []string
+	for name, s := range scenarios {
+		names = append(names, fmt.Sprintf("%s (%s)", name, strings.Join(s.tags, ", ")))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// loadSecurityPolicy returns the preset of the named scenario overlaid with the fields set in
+// configFile. Either may be empty. The preset is deep copied, so that changing the result, its
+// pointers, slices and maps included, leaves the preset unchanged.
+func loadSecurityPolicy(scenarioName, configFile string) (generatepolicies.SecurityPolicy, error) {
+	policyData := generatepolicies.SecurityPolicy{}
+	if scenarioName != "" {
+		s, ok := scenarios[scenarioName]
+		if !ok {
+			return policyData, fmt.Errorf("unknown scenario %q, must be one of: %s", scenarioName, scenarioNames())
+		}
+		preset, err := json.Marshal(s.policy)
+		if err != nil {
+			return policyData, err
+		}
+		if err := json.Unmarshal(preset, &policyData); err != nil {
+			return policyData, err
+		}
+	}
+	if configFile != "" {
+		jsonBytes, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			return policyData, err
+		}
+		if err := json.Unmarshal(jsonBytes, &policyData); err != nil {
+			return policyData, err
+		}
+	}
+	return policyData, nil
+}
+
+// writeScenarioTraffic writes the traffic profile of the named scenario to trafficFile, mixed with
+// a share of denyRate of requests expected to be denied. It is a no-op for scenarios that do not
+// define one.
+func writeScenarioTraffic(scenarioName string, policyData generatepolicies.SecurityPolicy, trafficFile string, denyRate float64) error {
+	s, ok := scenarios[scenarioName]
+	if !ok || s.traffic == nil {
+		return nil
+	}
+	profile, err := s.traffic(policyData)
+	if err != nil {
+		return err
+	}
+	if err := mixDeniedTraffic(profile, policyData, denyRate); err != nil {
+		return err
+	}
+	profile.Scenario = scenarioName
+	return writeTrafficProfile(profile, trafficFile)
+}
@@ -0,0 +1,193 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+	"sigs.k8s.io/yaml"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// schemaValidator validates emitted documents against the OpenAPI schemas of their CRDs.
+type schemaValidator struct {
+	// schemas are the schemas of the specs, keyed by group/kind.
+	schemas map[string]*gojsonschema.Schema
+}
+
+// newSchemaValidator returns a validator of the CRDs of schemaFile, a path or an http(s) URL of
+// a multi-document CRD YAML file, or else of the bundled security.istio.io CRDs.
+func newSchemaValidator(schemaFile string) (*schemaValidator, error) {
+	crds := securityCRDs
+	if schemaFile != "" {
+		data, err := readSchemaFile(schemaFile)
+		if err != nil {
+			return nil, err
+		}
+		crds = string(data)
+	}
+
+	v := &schemaValidator{schemas: map[string]*gojsonschema.Schema{}}
+	for _, doc := range splitYAMLDocuments(crds) {
+		js, err := yaml.YAMLToJSON([]byte(doc))
+		if err != nil {
+			return nil, err
+		}
+		var crd struct {
+			Kind string `json:"kind"`
+			Spec struct {
+				Group string `json:"group"`
+				Names struct {
+					Kind string `json:"kind"`
+				} `json:"names"`
+				Validation *struct {
+					OpenAPIV3Schema map[string]interface{} `json:"openAPIV3Schema"`
+				} `json:"validation"`
+				Versions []struct {
+					Name   string `json:"name"`
+					Schema *struct {
+						OpenAPIV3Schema map[string]interface{} `json:"openAPIV3Schema"`
+					} `json:"schema"`
+				} `json:"versions"`
+			} `json:"spec"`
+		}
+		if err := json.Unmarshal(js, &crd); err != nil {
+			return nil, err
+		}
+		if crd.Kind != "CustomResourceDefinition" {
+			continue
+		}
+		// apiextensions.k8s.io/v1beta1 CRDs have a single schema, v1 CRDs one per version. Every
+		// version of the Istio CRDs shares the same schema.
+		var schema map[string]interface{}
+		if crd.Spec.Validation != nil {
+			schema = crd.Spec.Validation.OpenAPIV3Schema
+		}
+		for _, version := range crd.Spec.Versions {
+			if schema == nil && version.Schema != nil {
+				schema = version.Schema.OpenAPIV3Schema
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		spec, ok := properties["spec"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		disallowUnknownFields(spec)
+		compiled, err := gojsonschema.NewSchema(gojsonschema.NewGoLoader(spec))
+		if err != nil {
+			return nil, fmt.Errorf("schema of %s/%s: %v", crd.Spec.Group, crd.Spec.Names.Kind, err)
+		}
+		v.schemas[crd.Spec.Group+"/"+crd.Spec.Names.Kind] = compiled
+	}
+	if len(v.schemas) == 0 {
+		return nil, fmt.Errorf("no CRD schemas found")
+	}
+	return v, nil
+}
+
+func readSchemaFile(schemaFile string) ([]byte, error) {
+	if !strings.HasPrefix(schemaFile, "http://") && !strings.HasPrefix(schemaFile, "https://") {
+		return ioutil.ReadFile(schemaFile)
+	}
+	resp, err := http.Get(schemaFile)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", schemaFile, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// disallowUnknownFields rejects the fields not declared by the objects of schema. The API server
+// silently prunes them, which hides typos of field names.
+func disallowUnknownFields(schema interface{}) {
+	switch s := schema.(type) {
+	case map[string]interface{}:
+		if _, ok := s["properties"]; ok {
+			if _, set := s["additionalProperties"]; !set && s["x-kubernetes-preserve-unknown-fields"] != true {
+				s["additionalProperties"] = false
+			}
+		}
+		for _, value := range s {
+			disallowUnknownFields(value)
+		}
+	case []interface{}:
+		for _, item := range s {
+			disallowUnknownFields(item)
+		}
+	}
+}
+
+// validate checks the spec of doc against the schema of its kind.
+func (v *schemaValidator) validate(doc string) error {
+	js, err := yaml.YAMLToJSON([]byte(doc))
+	if err != nil {
+		return err
+	}
+	var resource struct {
+		APIVersion string                          `json:"apiVersion"`
+		Kind       string                          `json:"kind"`
+		Metadata   generatepolicies.MetadataStruct `json:"metadata"`
+		Spec       json.RawMessage                 `json:"spec"`
+	}
+	if err := json.Unmarshal(js, &resource); err != nil {
+		return err
+	}
+	group := strings.SplitN(resource.APIVersion, "/", 2)[0]
+	schema, ok := v.schemas[group+"/"+resource.Kind]
+	if !ok {
+		return fmt.Errorf("%s %s/%s: no schema for %s", resource.Kind, resource.Metadata.Namespace, resource.Metadata.Name, resource.APIVersion)
+	}
+	spec := resource.Spec
+	if len(spec) == 0 {
+		spec = json.RawMessage("{}")
+	}
+	result, err := schema.Validate(gojsonschema.NewBytesLoader(spec))
+	if err != nil {
+		return err
+	}
+	if !result.Valid() {
+		var errs []string
+		for _, e := range result.Errors() {
+			errs = append(errs, e.String())
+		}
+		return fmt.Errorf("%s %s/%s does not match its schema: %s", resource.Kind, resource.Metadata.Namespace, resource.Metadata.Name,
+			strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// validateSchemas validates every document of docs against the CRDs of schemaFile.
+func validateSchemas(docs []string, schemaFile string) error {
+	v, err := newSchemaValidator(schemaFile)
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if err := v.validate(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	authzpb "istio.io/api/security/v1beta1"
+)
+
+// simulatedRequest holds the values of the attributes of a request, keyed by the names used by
+// constraints.
+type simulatedRequest map[string][]string
+
+func (r simulatedRequest) set(attribute string, values ...string) {
+	if strings.HasPrefix(attribute, "request.headers[") {
+		attribute = strings.ToLower(attribute)
+	}
+	for _, value := range values {
+		if value != "" {
+			r[attribute] = append(r[attribute], value)
+		}
+	}
+}
+
+func (r simulatedRequest) values(attribute string) []string {
+	if strings.HasPrefix(attribute, "request.headers[") {
+		attribute = strings.ToLower(attribute)
+	}
+	return r[attribute]
+}
+
+// matches reports whether the request satisfies c. A request without the attribute satisfies
+// only negative constraints, as Envoy RBAC does.
+func (r simulatedRequest) matches(c constraint) bool {
+	matched := false
+	for _, value := range r.values(c.attribute) {
+		for _, pattern := range c.values {
+			if matchValue(c.attribute, pattern, value) {
+				matched = true
+			}
+		}
+	}
+	return matched != c.not
+}
+
+func (r simulatedRequest) matchesRule(rule policyRule) bool {
+	for _, c := range rule.clauses {
+		matched := true
+		for _, constraint := range c {
+			if !r.matches(constraint) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// decision is the outcome of the evaluation of a request.
+type decision struct {
+	Allowed bool
+	// Custom is the CUSTOM rule delegating the request to its provider, the decision is the one
+	// taken when the provider allows the request.
+	Custom *policyRule
+	// Rule is the rule taking the decision, nil when no rule matches.
+	Rule   *policyRule
+	Reason string
+}
+
+func (d decision) String() string {
+	s := "DENY"
+	if d.Allowed {
+		s = "ALLOW"
+	}
+	s += ": " + d.Reason
+	if d.Custom != nil {
+		s = fmt.Sprintf("CUSTOM %s calls provider %s, when it allows the request\n%s",
+			*d.Custom, d.Custom.policy.Spec.GetProvider().GetName(), s)
+	}
+	return s
+}
+
+// workload is the target of the evaluated requests.
+type workload struct {
+	namespace string
+	labels    map[string]string
+}
+
+// appliesTo reports whether policy applies to w.
+func (w workload) appliesTo(policy parsedAuthorizationPolicy, rootNamespace string) bool {
+	if policy.Namespace != w.namespace && policy.Namespace != rootNamespace {
+		return false
+	}
+	return selectorCovers(policy.Spec.GetSelector().GetMatchLabels(), w.labels)
+}
+
+// evaluate returns the decision of the policies applying to w on request, following the
+// evaluation order of Envoy's RBAC filters: CUSTOM, DENY, then ALLOW policies.
+func evaluate(policies []parsedAuthorizationPolicy, w workload, rootNamespace string, request simulatedRequest) decision {
+	var applying []parsedAuthorizationPolicy
+	for _, policy := range policies {
+		if w.appliesTo(policy, rootNamespace) {
+			applying = append(applying, policy)
+		}
+	}
+	firstMatch := func(action authzpb.AuthorizationPolicy_Action) *policyRule {
+		rules := policyRules(applying, action)
+		for i := range rules {
+			if request.matchesRule(rules[i]) {
+				return &rules[i]
+			}
+		}
+		return nil
+	}
+
+	d := decision{}
+	d.Custom = firstMatch(authzpb.AuthorizationPolicy_CUSTOM)
+	if rule := firstMatch(authzpb.AuthorizationPolicy_DENY); rule != nil {
+		d.Rule, d.Reason = rule, fmt.Sprintf("matched DENY %s", *rule)
+		return d
+	}
+	numAllowPolicies := 0
+	for _, policy := range applying {
+		if policy.Spec.Action == authzpb.AuthorizationPolicy_ALLOW {
+			numAllowPolicies++
+		}
+	}
+	if numAllowPolicies == 0 {
+		d.Allowed, d.Reason = true, "no ALLOW policy applies to the workload"
+		return d
+	}
+	if rule := firstMatch(authzpb.AuthorizationPolicy_ALLOW); rule != nil {
+		d.Allowed, d.Rule, d.Reason = true, rule, fmt.Sprintf("matched ALLOW %s", *rule)
+		return d
+	}
+	d.Reason = fmt.Sprintf("none of the %d ALLOW policies applying to the workload matched", numAllowPolicies)
+	return d
+}
+
+// setToken sets the attributes of a request authenticated with a JWT with claims on r.
+func setToken(r simulatedRequest, claims map[string]interface{}) {
+	setClaims(r, "", claims)
+	iss, sub := claims["iss"], claims["sub"]
+	if iss != nil && sub != nil {
+		r.set("request.auth.principal", fmt.Sprintf("%v/%v", iss, sub))
+	}
+	if aud, ok := claims["aud"]; ok {
+		r.set("request.auth.audiences", claimValues(aud)...)
+	}
+	if azp, ok := claims["azp"]; ok {
+		r.set("request.auth.presenter", claimValues(azp)...)
+	}
+}
+
+// setClaims sets the claims of a token on r, the claims of nested objects as
+// request.auth.claims[<object>][<claim>].
+func setClaims(r simulatedRequest, prefix string, claims map[string]interface{}) {
+	for name, value := range claims {
+		if object, ok := value.(map[string]interface{}); ok {
+			setClaims(r, prefix+name+"][", object)
+			continue
+		}
+		r.set("request.auth.claims["+prefix+name+"]", claimValues(value)...)
+	}
+}
+
+// claimValues returns the values of a JWT claim as strings, a list claim has one value per item.
+func claimValues(claim interface{}) []string {
+	switch v := claim.(type) {
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			values = append(values, claimValues(item)...)
+		}
+		return values
+	case string:
+		return []string{v}
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+func runSimulate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the generated policies")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	policyFile := fs.String("policyFile", "", "A YAML file of policies to evaluate instead of the generated ones")
+	rootNamespace := fs.String("rootNamespace", "istio-system", "The root namespace, its policies apply to every namespace")
+	namespace := fs.String("namespace", "twopods-istio", "The namespace of the workload receiving the request")
+	labels := fs.String("labels", "app=fortioserver", "The labels of the workload receiving the request, as key=value,...")
+	principal := fs.String("sourcePrincipal", "", "The principal of the source, e.g. cluster.local/ns/default/sa/sleep")
+	sourceNamespace := fs.String("sourceNamespace", "", "The namespace of the source, defaults to the one of sourcePrincipal")
+	sourceIP := fs.String("sourceIP", "", "The IP address of the source")
+	remoteIP := fs.String("remoteIP", "", "The original client IP address, defaults to sourceIP")
+	host := fs.String("host", "", "The host of the request")
+	port := fs.String("port", "8080", "The destination port of the request")
+	method := fs.String("method", "GET", "The method of the request")
+	path := fs.String("path", "/", "The path of the request")
+	headers := fs.String("headers", "", "The headers of the request, as name=value,...")
+	claimsJSON := fs.String("claims", "", "The claims of the validated JWT of the request as a JSON object, e.g. {\"iss\":\"issuer-1\",\"sub\":\"subject\"}")
+	_ = fs.Parse(args)
+
+	policies, err := loadAuthorizationPolicies(ctx, *scenarioName, *configFile, *policyFile)
+	if err != nil {
+		return err
+	}
+	workloadLabels, err := parseLabels(*labels)
+	if err != nil {
+		return err
+	}
+	headerValues, err := parseLabels(*headers)
+	if err != nil {
+		return err
+	}
+
+	request := simulatedRequest{}
+	request.set("source.principal", *principal)
+	if *sourceNamespace == "" {
+		if parts := strings.Split(*principal, "/"); len(parts) == 5 && parts[1] == "ns" {
+			*sourceNamespace = parts[2]
+		}
+	}
+	request.set("source.namespace", *sourceNamespace)
+	request.set("source.ip", *sourceIP)
+	if *remoteIP == "" {
+		*remoteIP = *sourceIP
+	}
+	request.set("remote.ip", *remoteIP)
+	request.set("request.host", *host)
+	request.set("destination.port", *port)
+	request.set("request.method", *method)
+	request.set("request.path", strings.SplitN(*path, "?", 2)[0])
+	for name, value := range headerValues {
+		request.set(fmt.Sprintf("request.headers[%s]", name), value)
+	}
+	if *claimsJSON != "" {
+		claims := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(*claimsJSON), &claims); err != nil {
+			return fmt.Errorf("invalid claims: %v", err)
+		}
+		setToken(request, claims)
+	}
+
+	fmt.Println(evaluate(policies, workload{namespace: *namespace, labels: workloadLabels}, *rootNamespace, request))
+	return nil
+}
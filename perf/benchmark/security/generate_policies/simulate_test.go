@@ -0,0 +1,148 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testPolicy returns an AuthorizationPolicy document of namespace ns-1 with rules, a YAML list.
+func testPolicy(name, action, rules string) string {
+	doc := fmt.Sprintf("apiVersion: security.istio.io/v1beta1\nkind: AuthorizationPolicy\nmetadata:\n  name: %s\n  namespace: ns-1\nspec:\n  action: %s\n", name, action)
+	if action == "CUSTOM" {
+		doc += "  provider:\n    name: ext-authz\n"
+	}
+	if rules != "" {
+		doc += "  rules:\n" + rules
+	}
+	return doc
+}
+
+func TestEvaluate(t *testing.T) {
+	const (
+		getAdmin = "  - to:\n    - operation:\n        paths: [\"/admin\"]\n"
+		anyRule  = "  - {}\n"
+	)
+	admin := simulatedRequest{"request.method": {"GET"}, "request.path": {"/admin"}}
+	other := simulatedRequest{"request.method": {"GET"}, "request.path": {"/other"}}
+	cases := []struct {
+		name        string
+		policies    []string
+		request     simulatedRequest
+		wantAllowed bool
+		wantCustom  bool
+		wantRule    string
+	}{
+		// CUSTOM, then DENY, then ALLOW policies.
+		{"custom then allow", []string{testPolicy("c", "CUSTOM", getAdmin), testPolicy("a", "ALLOW", getAdmin)}, admin, true, true, "ns-1/a rules[0]"},
+		{"custom then deny", []string{testPolicy("c", "CUSTOM", getAdmin), testPolicy("d", "DENY", getAdmin)}, admin, false, true, "ns-1/d rules[0]"},
+		{"deny before allow", []string{testPolicy("a", "ALLOW", getAdmin), testPolicy("d", "DENY", getAdmin)}, admin, false, false, "ns-1/d rules[0]"},
+		{"custom not matching", []string{testPolicy("c", "CUSTOM", getAdmin)}, other, true, false, ""},
+		// Without ALLOW policies, the requests no DENY rule matches are allowed.
+		{"no policy", nil, admin, true, false, ""},
+		{"deny not matching", []string{testPolicy("d", "DENY", getAdmin)}, other, true, false, ""},
+		{"allow not matching", []string{testPolicy("a", "ALLOW", getAdmin)}, other, false, false, ""},
+		{"allow nothing", []string{testPolicy("a", "ALLOW", "")}, admin, false, false, ""},
+		{"allow any", []string{testPolicy("a", "ALLOW", anyRule)}, other, true, false, "ns-1/a rules[0]"},
+	}
+	for _, c := range cases {
+		policies, err := parseAuthorizationPolicies(c.policies)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := evaluate(policies, workload{namespace: "ns-1"}, "istio-system", c.request)
+		rule := ""
+		if d.Rule != nil {
+			rule = d.Rule.String()
+		}
+		if d.Allowed != c.wantAllowed || (d.Custom != nil) != c.wantCustom || rule != c.wantRule {
+			t.Errorf("%s: got %v, rule %q, want allowed %v, custom %v, rule %q", c.name, d, rule, c.wantAllowed, c.wantCustom, c.wantRule)
+		}
+	}
+}
+
+func TestEvaluateRules(t *testing.T) {
+	cases := []struct {
+		name    string
+		rule    string
+		request simulatedRequest
+		want    bool
+	}{
+		// The negative fields match the requests without any of their values, including the
+		// requests without the attribute.
+		{"notPaths", "  - to:\n    - operation:\n        notPaths: [\"/admin\"]\n", simulatedRequest{"request.path": {"/admin"}}, false},
+		{"notPaths other", "  - to:\n    - operation:\n        notPaths: [\"/admin\"]\n", simulatedRequest{"request.path": {"/other"}}, true},
+		{"notMethods", "  - to:\n    - operation:\n        notMethods: [\"POST\"]\n", simulatedRequest{"request.method": {"POST"}}, false},
+		{"notPrincipals missing", "  - from:\n    - source:\n        notPrincipals: [\"cluster.local/ns/a/sa/b\"]\n", simulatedRequest{}, true},
+		{"notNamespaces", "  - from:\n    - source:\n        notNamespaces: [\"ns-2\"]\n", simulatedRequest{"source.namespace": {"ns-2"}}, false},
+		{"notIpBlocks", "  - from:\n    - source:\n        notIpBlocks: [\"10.0.0.0/8\"]\n", simulatedRequest{"source.ip": {"10.1.2.3"}}, false},
+		{"notValues", "  - when:\n    - key: request.headers[x-token]\n      notValues: [\"guest\"]\n", simulatedRequest{"request.headers[x-token]": {"guest"}}, false},
+		{"notValues missing", "  - when:\n    - key: request.headers[x-token]\n      notValues: [\"guest\"]\n", simulatedRequest{}, true},
+		// Prefix, suffix and presence patterns.
+		{"prefix", "  - to:\n    - operation:\n        paths: [\"/api/*\"]\n", simulatedRequest{"request.path": {"/api/v1"}}, true},
+		{"prefix other", "  - to:\n    - operation:\n        paths: [\"/api/*\"]\n", simulatedRequest{"request.path": {"/apis"}}, false},
+		{"suffix", "  - to:\n    - operation:\n        hosts: [\"*.example.com\"]\n", simulatedRequest{"request.host": {"a.example.com"}}, true},
+		{"suffix other", "  - to:\n    - operation:\n        hosts: [\"*.example.com\"]\n", simulatedRequest{"request.host": {"example.org"}}, false},
+		{"presence", "  - when:\n    - key: request.headers[x-token]\n      values: [\"*\"]\n", simulatedRequest{"request.headers[x-token]": {"any"}}, true},
+		{"presence missing", "  - when:\n    - key: request.headers[x-token]\n      values: [\"*\"]\n", simulatedRequest{}, false},
+		{"cidr", "  - from:\n    - source:\n        ipBlocks: [\"10.0.0.0/8\"]\n", simulatedRequest{"source.ip": {"10.1.2.3"}}, true},
+		// The from, to and when of a rule are ANDed, its from and to entries are ORed.
+		{"and", andRule, andRequest(), true},
+		{"and without from", andRule, without(andRequest(), "request.auth.principal"), false},
+		{"and without to", andRule, without(andRequest(), "request.path"), false},
+		{"and without when", andRule, without(andRequest(), "request.headers[x-token]"), false},
+		{"or of to", "  - to:\n    - operation:\n        paths: [\"/a\"]\n    - operation:\n        methods: [\"POST\"]\n", simulatedRequest{"request.path": {"/b"}, "request.method": {"POST"}}, true},
+		{"and of fields", "  - to:\n    - operation:\n        paths: [\"/a\"]\n        methods: [\"POST\"]\n", simulatedRequest{"request.path": {"/b"}, "request.method": {"POST"}}, false},
+	}
+	for _, c := range cases {
+		policies, err := parseAuthorizationPolicies([]string{testPolicy("a", "ALLOW", c.rule)})
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if d := evaluate(policies, workload{namespace: "ns-1"}, "", c.request); d.Allowed != c.want {
+			t.Errorf("%s: got %v, want allowed %v", c.name, d, c.want)
+		}
+	}
+}
+
+const andRule = "  - from:\n    - source:\n        requestPrincipals: [\"issuer-1/*\"]\n" +
+	"    to:\n    - operation:\n        paths: [\"/admin\"]\n" +
+	"    when:\n    - key: request.headers[x-token]\n      values: [\"admin\"]\n"
+
+func andRequest() simulatedRequest {
+	return simulatedRequest{
+		"request.auth.principal":   {"issuer-1/subject"},
+		"request.path":             {"/admin"},
+		"request.headers[x-token]": {"admin"},
+	}
+}
+
+func without(r simulatedRequest, attribute string) simulatedRequest {
+	delete(r, attribute)
+	return r
+}
+
+func TestDecisionString(t *testing.T) {
+	policies, err := parseAuthorizationPolicies([]string{testPolicy("c", "CUSTOM", "  - {}\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := evaluate(policies, workload{namespace: "ns-1"}, "", simulatedRequest{})
+	if s := d.String(); !strings.Contains(s, "calls provider ext-authz") || !strings.Contains(s, "ALLOW: no ALLOW policy") {
+		t.Errorf("got %q, want the CUSTOM provider and the decision", s)
+	}
+}
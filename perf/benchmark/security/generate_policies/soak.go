@@ -0,0 +1,416 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+// churnAnnotation is bumped on the policies updated by the churn of a soak run.
+const churnAnnotation = "generate-policies.istio.io/churn"
+
+// SoakResult summarizes a soak run. Its report.json is written again at every snapshot, so that
+// a run of days is inspectable while it runs and survives a restart of its pod.
+type SoakResult struct {
+	Policies          int `json:"policies"`
+	Churned           int `json:"churned"`
+	ChurnErrors       int `json:"churnErrors"`
+	ProbeRounds       int `json:"probeRounds"`
+	FailedProbeRounds int `json:"failedProbeRounds"`
+	ProbeErrors       int `json:"probeErrors"`
+	// FullPushes, PartialPushes and Triggers are the totals of the snapshots of the run, including
+	// the ones dropped beyond -maxSnapshots.
+	FullPushes    float64            `json:"fullPushes"`
+	PartialPushes float64            `json:"partialPushes"`
+	Triggers      map[string]float64 `json:"triggers,omitempty"`
+	// Snapshots are the latest snapshots of the metrics of istiod, at most -maxSnapshots.
+	Snapshots []SoakSnapshot `json:"snapshots"`
+}
+
+// SoakSnapshot is a periodic snapshot of a soak run and of the metrics of istiod, the push
+// latency and pushes being those since the previous snapshot.
+type SoakSnapshot struct {
+	Time              time.Time        `json:"time"`
+	Churned           int              `json:"churned"`
+	ProbeRounds       int              `json:"probeRounds"`
+	FailedProbeRounds int              `json:"failedProbeRounds"`
+	PushLatency       HistogramSummary `json:"pushLatency"`
+	Pushes            float64          `json:"pushes"`
+	// FullPushes and PartialPushes split the pushes as the convergence of apply does, see
+	// pushesBetween. The churn only updates policies, the pushes should stay incremental.
+	FullPushes    float64 `json:"fullPushes"`
+	PartialPushes float64 `json:"partialPushes"`
+	// Triggers are the pilot_push_triggers by type, the reasons of the pushes of istiod.
+	Triggers map[string]float64 `json:"triggers,omitempty"`
+	// ConnectedProxies is pilot_xds, the proxies connected to istiod.
+	ConnectedProxies    float64 `json:"connectedProxies"`
+	ResidentMemoryBytes float64 `json:"residentMemoryBytes"`
+	Goroutines          float64 `json:"goroutines"`
+}
+
+// soakSnapshot returns the snapshot of the metrics of istiod from the scrapes of the previous and
+// of the current snapshot.
+func soakSnapshot(now time.Time, result *SoakResult, before, after metricFamilies) SoakSnapshot {
+	s := SoakSnapshot{
+		Time:                now,
+		Churned:             result.Churned,
+		ProbeRounds:         result.ProbeRounds,
+		FailedProbeRounds:   result.FailedProbeRounds,
+		PushLatency:         after.histogram("pilot_proxy_convergence_time").sub(before.histogram("pilot_proxy_convergence_time")).summary(),
+		Pushes:              after.counter("pilot_xds_pushes") - before.counter("pilot_xds_pushes"),
+		ConnectedProxies:    after.counter("pilot_xds"),
+		ResidentMemoryBytes: after.counter("process_resident_memory_bytes"),
+		Goroutines:          after.counter("go_goroutines"),
+	}
+	s.FullPushes, s.PartialPushes = pushesBetween(before, after)
+	triggersBefore := before.counterBy("pilot_push_triggers", "type")
+	for typ, n := range after.counterBy("pilot_push_triggers", "type") {
+		if d := n - triggersBefore[typ]; d > 0 {
+			if s.Triggers == nil {
+				s.Triggers = map[string]float64{}
+			}
+			s.Triggers[typ] = d
+		}
+	}
+	return s
+}
+
+// IncrementalRatio returns the share of the partial pushes of the run, 0 without pushes.
+func (r *SoakResult) IncrementalRatio() float64 {
+	if r.FullPushes+r.PartialPushes == 0 {
+		return 0
+	}
+	return r.PartialPushes / (r.FullPushes + r.PartialPushes)
+}
+
+// addSnapshot appends s to the snapshots, dropping the oldest ones beyond max, and adds its pushes
+// to the totals of the run.
+func (r *SoakResult) addSnapshot(s SoakSnapshot, max int) {
+	r.FullPushes += s.FullPushes
+	r.PartialPushes += s.PartialPushes
+	for typ, n := range s.Triggers {
+		if r.Triggers == nil {
+			r.Triggers = map[string]float64{}
+		}
+		r.Triggers[typ] += n
+	}
+	r.Snapshots = append(r.Snapshots, s)
+	if max > 0 && len(r.Snapshots) > max {
+		r.Snapshots = append([]SoakSnapshot(nil), r.Snapshots[len(r.Snapshots)-max:]...)
+	}
+}
+
+// churnDocs returns n of docs starting at next round robin, annotated with round so that they
+// are updated without changing the number of policies or their decisions, and the next index.
+func churnDocs(docs []string, next, n, round int) ([]string, int, error) {
+	if n > len(docs) {
+		n = len(docs)
+	}
+	churned := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		doc, err := annotate(docs[next], map[string]string{churnAnnotation: strconv.Itoa(round)})
+		if err != nil {
+			return nil, next, err
+		}
+		churned = append(churned, doc)
+		next = (next + 1) % len(docs)
+	}
+	return churned, next, nil
+}
+
+// soakMetrics are the metrics of a soak run served to the Prometheus of the stability tests.
+type soakMetrics struct {
+	registry *prometheus.Registry
+	policies prometheus.Gauge
+	churned  prometheus.Counter
+	errors   *prometheus.CounterVec
+	probes   *prometheus.CounterVec
+}
+
+func newSoakMetrics() *soakMetrics {
+	m := &soakMetrics{
+		registry: prometheus.NewRegistry(),
+		policies: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "security_soak_policies", Help: "The number of policies the soak run maintains.",
+		}),
+		churned: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "security_soak_churned_policies_total", Help: "The number of policy updates of the churn.",
+		}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "security_soak_errors_total", Help: "The number of failed churns, probes and snapshots.",
+		}, []string{"phase"}),
+		probes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "security_soak_probes_total", Help: "The number of enforcement probes by whether they were decided as expected.",
+		}, []string{"matched"}),
+	}
+	m.registry.MustRegister(m.policies, m.churned, m.errors, m.probes)
+	return m
+}
+
+func runSoak(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("soak", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The name of the config json file")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	namespace := fs.String("namespace", "", "The namespace of the policies and the probe client, overrides the namespace of the config")
+	batchSize := fs.Int("batchSize", 100, "The number of policies applied per kubectl invocation when applying the corpus")
+	duration := fs.Duration("duration", 0, "The duration of the soak run, 0 runs until it is stopped")
+	churnInterval := fs.Duration("churnInterval", time.Minute, "The interval between two updates of the churn")
+	churnSize := fs.Int("churnSize", 1, "The number of policies updated by every churn, round robin over the corpus, 0 disables the churn")
+	probeInterval := fs.Duration("probeInterval", 5*time.Minute, "The interval between two rounds of enforcement probes")
+	numProbes := fs.Int("probes", 4, "The number of probe requests sampled from the policies, 0 disables the probes")
+	denyRate := fs.Float64("denyRate", 0.5, "The share of probe requests expected to be denied")
+	client := fs.String("client", "deploy/client", "The pod sending the probes with curl, as a kubectl exec target")
+	clientContainer := fs.String("clientContainer", "", "The container of client with curl, defaults to its default container")
+	url := fs.String("url", "http://fortioserver:8080", "The URL of the workload of the policies the probes are sent to")
+	snapshotInterval := fs.Duration("snapshotInterval", 15*time.Minute, "The interval between two snapshots of the metrics of istiod and of report.json")
+	maxSnapshots := fs.Int("maxSnapshots", 1000, "The number of latest snapshots kept in report.json")
+	istioNamespace := fs.String("istioNamespace", "istio-system", "The namespace istiod runs in")
+	profileInterval := fs.Duration("profileInterval", 0, "The interval between two captures of istiod profiles while soaking, 0 disables the profiles")
+	profileSeconds := fs.Int("profileSeconds", 30, "The duration of each istiod CPU profile, 0 disables CPU profiles")
+	profileHeap := fs.Bool("profileHeap", true, "Whether to capture an istiod heap profile at each capture")
+	metricsAddr := fs.String("metricsAddr", ":9090", "The address the Prometheus metrics of the run are served on, empty disables them")
+	cleanup := fs.Bool("cleanup", false, "Delete the policies at the end of the run")
+	outDir := fs.String("outDir", "run", "The directory the run report is written to")
+	stamp := fs.Bool("stamp", false, "Annotate every generated object with the tool version, git SHA and flags of the run")
+	_ = fs.Parse(args)
+
+	if *batchSize <= 0 {
+		return fmt.Errorf("invalid batchSize: %d", *batchSize)
+	}
+	if *churnInterval <= 0 || *probeInterval <= 0 || *snapshotInterval <= 0 {
+		return fmt.Errorf("invalid intervals: churnInterval, probeInterval and snapshotInterval must be positive")
+	}
+	if *profileInterval < 0 {
+		return fmt.Errorf("invalid profileInterval: %v", *profileInterval)
+	}
+	policyData, err := loadSecurityPolicy(*scenarioName, *configFile)
+	if err != nil {
+		return err
+	}
+	if *namespace != "" {
+		policyData.Namespace = *namespace
+	}
+	if policyData.Namespace == "" {
+		policyData.Namespace = generatepolicies.DefaultNamespace
+	}
+	var profile *TrafficProfile
+	if *numProbes > 0 {
+		if profile, err = sampleTraffic(policyData, *numProbes, *denyRate); err != nil {
+			return err
+		}
+		if profile.External {
+			return fmt.Errorf("the traffic of scenario %s is sent from outside the mesh, soak probes from a client in the mesh", *scenarioName)
+		}
+	}
+	policies, err := generatePolicies(ctx, policyData)
+	if err != nil {
+		return err
+	}
+	if *stamp {
+		if policies, err = stampDocs(policies, newRunMetadata(fs, nil)); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+
+	metrics := newSoakMetrics()
+	if *metricsAddr != "" {
+		server := &http.Server{Addr: *metricsAddr, Handler: promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{})}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("serving the metrics: %v", err)
+			}
+		}()
+		defer server.Close()
+	}
+
+	report := newRunReport("soak", *configFile, fs)
+	result := &SoakResult{Policies: len(policies)}
+	report.Soak = result
+	// Applying is idempotent, a restarted run applies the corpus again.
+	for start := 0; start < len(policies); start += *batchSize {
+		end := start + *batchSize
+		if end > len(policies) {
+			end = len(policies)
+		}
+		if err := kubectlApply(ctx, policies[start:end]); err != nil {
+			return err
+		}
+		report.PoliciesApplied = end
+	}
+	metrics.policies.Set(float64(len(policies)))
+	log.Printf("applied %d policies, soaking", len(policies))
+
+	istiod, err := newIstiodMetrics(ctx, *istioNamespace, "app=istiod")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if istiod != nil {
+			istiod.close()
+		}
+	}()
+	before, err := istiod.scrape(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+	churnTicker := time.NewTicker(*churnInterval)
+	defer churnTicker.Stop()
+	probeTicker := time.NewTicker(*probeInterval)
+	defer probeTicker.Stop()
+	snapshotTicker := time.NewTicker(*snapshotInterval)
+	defer snapshotTicker.Stop()
+	// The profiles are captured in the background while the churn goes on, a nil channel never
+	// fires when they are disabled.
+	prof := newProfiler(profileOptions{
+		cpuSeconds: *profileSeconds,
+		heap:       *profileHeap,
+		namespace:  *istioNamespace,
+		selector:   "app=istiod",
+	}, *outDir)
+	var profileTick <-chan time.Time
+	if *profileInterval > 0 {
+		profileTicker := time.NewTicker(*profileInterval)
+		defer profileTicker.Stop()
+		profileTick = profileTicker.C
+	}
+	numProfiles := 0
+	probes := probeClient{namespace: policyData.Namespace, target: *client, container: *clientContainer}
+	next, round := 0, 0
+	logError := func(phase string, err error) {
+		if ctx.Err() != nil {
+			return
+		}
+		metrics.errors.WithLabelValues(phase).Inc()
+		log.Printf("%s: %v", phase, err)
+	}
+	for ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case <-churnTicker.C:
+			if *churnSize == 0 {
+				continue
+			}
+			round++
+			var churned []string
+			churned, next, err = churnDocs(policies, next, *churnSize, round)
+			if err == nil {
+				err = kubectlApply(ctx, churned)
+			}
+			if err != nil {
+				result.ChurnErrors++
+				logError("churn", err)
+				continue
+			}
+			result.Churned += len(churned)
+			metrics.churned.Add(float64(len(churned)))
+		case <-probeTicker.C:
+			if profile == nil {
+				continue
+			}
+			results, err := probe(ctx, probes, *url, profile)
+			if err != nil {
+				result.ProbeErrors++
+				logError("probe", err)
+				continue
+			}
+			result.ProbeRounds++
+			failed := 0
+			for _, r := range results {
+				metrics.probes.WithLabelValues(strconv.FormatBool(r.Matched)).Inc()
+				if !r.Matched {
+					failed++
+					log.Printf("probe %s %s: expected %s, got %d", r.Method, r.Path, r.Expect, r.Status)
+				}
+			}
+			if failed > 0 {
+				result.FailedProbeRounds++
+			}
+		case <-profileTick:
+			numProfiles++
+			prof.capture(ctx, fmt.Sprintf("soak-%d", numProfiles))
+		case <-snapshotTicker.C:
+			if istiod == nil {
+				// istiod may have been rescheduled during days of soaking, the next snapshot
+				// covers the metrics of the new pod.
+				if istiod, err = newIstiodMetrics(ctx, *istioNamespace, "app=istiod"); err != nil {
+					istiod = nil
+					logError("snapshot", err)
+				} else if before, err = istiod.scrape(ctx); err != nil {
+					logError("snapshot", err)
+				}
+				continue
+			}
+			after, err := istiod.scrape(ctx)
+			if err != nil {
+				logError("snapshot", err)
+				istiod.close()
+				istiod = nil
+				continue
+			}
+			result.addSnapshot(soakSnapshot(time.Now(), result, before, after), *maxSnapshots)
+			before = after
+			report.Profiles, _ = prof.captured()
+			report.EndTime = time.Now()
+			if err := writeRunReport(*outDir, report); err != nil {
+				logError("snapshot", err)
+			}
+		}
+	}
+
+	// The end of the duration is the expected end of the run, not an interruption.
+	if ctx.Err() == context.Canceled {
+		report.Interrupted = true
+	}
+	profiles, profileErrs := prof.wait()
+	report.Profiles = profiles
+	for _, e := range profileErrs {
+		report.Errors = append(report.Errors, e.Error())
+	}
+	if *cleanup {
+		_, err := kubectl(context.Background(), strings.NewReader(strings.Join(policies, "---\n")), "delete", "--ignore-not-found", "-f", "-")
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+	log.Printf("%.0f full and %.0f incremental pushes, incremental ratio %.2f, triggers %v",
+		result.FullPushes, result.PartialPushes, result.IncrementalRatio(), result.Triggers)
+	if result.FailedProbeRounds > 0 {
+		report.Errors = append(report.Errors, fmt.Sprintf("%d of %d probe rounds not decided as expected", result.FailedProbeRounds, result.ProbeRounds))
+	}
+	report.EndTime = time.Now()
+	return writeRunReport(*outDir, report)
+}
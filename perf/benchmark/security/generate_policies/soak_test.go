@@ -0,0 +1,100 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChurnDocs(t *testing.T) {
+	docs := []string{
+		"apiVersion: security.istio.io/v1beta1\nkind: AuthorizationPolicy\nmetadata:\n  name: a\n",
+		"apiVersion: security.istio.io/v1beta1\nkind: AuthorizationPolicy\nmetadata:\n  name: b\n",
+		"apiVersion: security.istio.io/v1beta1\nkind: AuthorizationPolicy\nmetadata:\n  name: c\n",
+	}
+	churned, next, err := churnDocs(docs, 2, 2, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(churned) != 2 || next != 1 {
+		t.Fatalf("got %d docs and next %d, want 2 and 1", len(churned), next)
+	}
+	if !strings.Contains(churned[0], "name: c") || !strings.Contains(churned[1], "name: a") {
+		t.Errorf("got docs not round robin from c:\n%s", strings.Join(churned, "---\n"))
+	}
+	for _, doc := range churned {
+		if !strings.Contains(doc, churnAnnotation+`: "7"`) {
+			t.Errorf("doc not annotated with the round:\n%s", doc)
+		}
+	}
+
+	if churned, _, err = churnDocs(docs, 0, 10, 1); err != nil || len(churned) != 3 {
+		t.Errorf("got %d docs, err %v, want every doc once", len(churned), err)
+	}
+}
+
+func TestSoakSnapshot(t *testing.T) {
+	before := parseMetrics(t, `# TYPE pilot_xds_pushes counter
+pilot_xds_pushes{type="cds"} 10
+# TYPE pilot_proxy_convergence_time histogram
+pilot_proxy_convergence_time_bucket{le="1"} 10
+pilot_proxy_convergence_time_bucket{le="+Inf"} 10
+pilot_proxy_convergence_time_sum 2
+pilot_proxy_convergence_time_count 10
+`)
+	after := parseMetrics(t, `# TYPE pilot_xds_pushes counter
+pilot_xds_pushes{type="cds"} 14
+pilot_xds_pushes{type="eds"} 2
+# TYPE pilot_push_triggers counter
+pilot_push_triggers{type="config"} 3
+pilot_push_triggers{type="endpoint"} 1
+# TYPE pilot_proxy_convergence_time histogram
+pilot_proxy_convergence_time_bucket{le="1"} 12
+pilot_proxy_convergence_time_bucket{le="+Inf"} 12
+pilot_proxy_convergence_time_sum 3
+pilot_proxy_convergence_time_count 12
+# TYPE pilot_xds gauge
+pilot_xds{version="1.9"} 40
+# TYPE process_resident_memory_bytes gauge
+process_resident_memory_bytes 1e+08
+# TYPE go_goroutines gauge
+go_goroutines 500
+`)
+	result := &SoakResult{Churned: 5, ProbeRounds: 3, FailedProbeRounds: 1}
+	s := soakSnapshot(time.Unix(0, 0), result, before, after)
+	if s.Pushes != 6 || s.PushLatency.Count != 2 || s.PushLatency.Mean != 0.5 {
+		t.Errorf("got %v pushes of latency %+v, want 6 pushes and 2 of 0.5s", s.Pushes, s.PushLatency)
+	}
+	if s.ConnectedProxies != 40 || s.ResidentMemoryBytes != 1e8 || s.Goroutines != 500 || s.Churned != 5 || s.FailedProbeRounds != 1 {
+		t.Errorf("unexpected snapshot %+v", s)
+	}
+
+	if s.FullPushes != 4 || s.PartialPushes != 2 || !reflect.DeepEqual(s.Triggers, map[string]float64{"config": 3, "endpoint": 1}) {
+		t.Errorf("got %v full and %v partial pushes, triggers %v, want 4, 2 and 3 config and 1 endpoint", s.FullPushes, s.PartialPushes, s.Triggers)
+	}
+
+	for i := 0; i < 5; i++ {
+		result.addSnapshot(SoakSnapshot{Churned: i, FullPushes: 1, PartialPushes: 3, Triggers: map[string]float64{"config": 1}}, 3)
+	}
+	if len(result.Snapshots) != 3 || result.Snapshots[0].Churned != 2 {
+		t.Errorf("got snapshots %+v, want the latest 3", result.Snapshots)
+	}
+	if result.FullPushes != 5 || result.IncrementalRatio() != 0.75 || result.Triggers["config"] != 5 {
+		t.Errorf("got totals %v full pushes, ratio %v, triggers %v, want those of the 5 snapshots", result.FullPushes, result.IncrementalRatio(), result.Triggers)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// GenerationStats summarizes what a generation produced.
+type GenerationStats struct {
+	Resources       int            `json:"resources"`
+	ResourcesByKind map[string]int `json:"resourcesByKind"`
+	// Rules is the number of rules of the AuthorizationPolicies.
+	Rules int `json:"rules"`
+	// Values is the number of values of each field of the AuthorizationPolicies and
+	// RequestAuthentications, e.g. rules.to.operation.paths, fields without values are omitted.
+	Values  map[string]int `json:"values"`
+	Bytes   int            `json:"bytes"`
+	Largest *LargestPolicy `json:"largest,omitempty"`
+}
+
+// LargestPolicy is the largest generated document.
+type LargestPolicy struct {
+	Policy string `json:"policy"`
+	Bytes  int    `json:"bytes"`
+	Rules  int    `json:"rules,omitempty"`
+}
+
+// generationStats returns the statistics of the generated docs.
+func generationStats(docs []string) (*GenerationStats, error) {
+	stats := &GenerationStats{ResourcesByKind: map[string]int{}, Values: map[string]int{}}
+	for _, doc := range docs {
+		objects, err := parsePolicyObjects([]string{doc})
+		if err != nil {
+			return nil, err
+		}
+		stats.Bytes += len(doc)
+		for _, o := range objects {
+			stats.Resources++
+			stats.ResourcesByKind[o.Kind]++
+			rules := 0
+			if o.Kind == "AuthorizationPolicy" {
+				rules = countValues(o.Spec["rules"])
+				stats.Rules += rules
+			}
+			if stats.Largest == nil || len(doc) > stats.Largest.Bytes {
+				stats.Largest = &LargestPolicy{Policy: o.String(), Bytes: len(doc), Rules: rules}
+			}
+		}
+	}
+	coverage, err := policyCoverage(docs)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range coverage {
+		for path, f := range c.Fields {
+			if !c.messages[path] && f.Values > 0 {
+				stats.Values[path] += f.Values
+			}
+		}
+	}
+	return stats, nil
+}
+
+// print writes stats to w, with a histogram of the values per field.
+func (s *GenerationStats) print(w io.Writer) error {
+	kinds := make([]string, 0, len(s.ResourcesByKind))
+	for kind := range s.ResourcesByKind {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for i, kind := range kinds {
+		kinds[i] = fmt.Sprintf("%d %s", s.ResourcesByKind[kind], kind)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "resources\t%d (%s)\n", s.Resources, strings.Join(kinds, ", "))
+	fmt.Fprintf(tw, "rules\t%d\n", s.Rules)
+	fmt.Fprintf(tw, "bytes\t%d\n", s.Bytes)
+	if s.Largest != nil {
+		fmt.Fprintf(tw, "largest\t%s, %d bytes, %d rules\n", s.Largest.Policy, s.Largest.Bytes, s.Largest.Rules)
+	}
+	fields := make([]string, 0, len(s.Values))
+	max := 0
+	for field, n := range s.Values {
+		fields = append(fields, field)
+		if n > max {
+			max = n
+		}
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		n := s.Values[field]
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", field, n, strings.Repeat("#", (n*40+max-1)/max))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,84 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGenerationStats(t *testing.T) {
+	docs := []string{
+		`apiVersion: v1
+kind: Namespace
+metadata:
+  name: ns-1
+`,
+		`apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: large
+  namespace: ns-1
+spec:
+  rules:
+  - to:
+    - operation:
+        paths: ["/a", "/b", "/c"]
+        methods: ["GET"]
+  - from:
+    - source:
+        principals: ["cluster.local/ns/ns-1/sa/a"]
+`,
+		`apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: small
+  namespace: ns-1
+spec:
+  rules:
+  - to:
+    - operation:
+        paths: ["/d"]
+`,
+	}
+	stats, err := generationStats(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Resources != 3 || stats.ResourcesByKind["AuthorizationPolicy"] != 2 || stats.Rules != 3 {
+		t.Errorf("got %d resources %v with %d rules", stats.Resources, stats.ResourcesByKind, stats.Rules)
+	}
+	if stats.Values["rules.to.operation.paths"] != 4 || stats.Values["rules.from.source.principals"] != 1 {
+		t.Errorf("values = %v", stats.Values)
+	}
+	if _, ok := stats.Values["rules.to.operation.hosts"]; ok {
+		t.Error("fields without values are reported")
+	}
+	if stats.Bytes != len(docs[0])+len(docs[1])+len(docs[2]) {
+		t.Errorf("bytes = %d", stats.Bytes)
+	}
+	if stats.Largest == nil || stats.Largest.Policy != "AuthorizationPolicy ns-1/large" || stats.Largest.Rules != 2 {
+		t.Errorf("largest = %+v", stats.Largest)
+	}
+
+	var buf bytes.Buffer
+	if err := stats.print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "3 (2 AuthorizationPolicy, 1 Namespace)") {
+		t.Errorf("unexpected stats:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// securityResources are the kubectl resources of the security policy kinds.
+var securityResources = map[string]string{
+	"AuthorizationPolicy":   "authorizationpolicies.security.istio.io",
+	"PeerAuthentication":    "peerauthentications.security.istio.io",
+	"RequestAuthentication": "requestauthentications.security.istio.io",
+}
+
+// StatusResult records when the control plane acknowledged the policies of a corpus.
+type StatusResult struct {
+	// Condition is the status condition acknowledging a policy, empty when a policy is
+	// acknowledged once it exists.
+	Condition    string `json:"condition,omitempty"`
+	Policies     int    `json:"policies"`
+	Acknowledged int    `json:"acknowledged"`
+	// Latency is the time from the creation to the acknowledgement of the policies, in ms.
+	Latency  LatencySummary `json:"latency"`
+	Statuses []PolicyStatus `json:"statuses"`
+}
+
+// PolicyStatus is the status of one policy.
+type PolicyStatus struct {
+	Policy         string  `json:"policy"`
+	Acknowledged   bool    `json:"acknowledged"`
+	LatencySeconds float64 `json:"latencySeconds,omitempty"`
+	// Message is the message of the condition, e.g. the number of proxies up to date.
+	Message string `json:"message,omitempty"`
+}
+
+// generation is a metadata.generation or status.observedGeneration, written as a number or as a
+// string depending on the writer.
+type generation int64
+
+func (g *generation) UnmarshalJSON(data []byte) error {
+	var n json.Number
+	if err := json.Unmarshal([]byte(strings.Trim(string(data), `"`)), &n); err != nil {
+		return err
+	}
+	i, err := n.Int64()
+	*g = generation(i)
+	return err
+}
+
+// statusObject is the metadata and status of a resource, as returned by kubectl get -o json.
+type statusObject struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name              string     `json:"name"`
+		Namespace         string     `json:"namespace"`
+		Generation        generation `json:"generation"`
+		CreationTimestamp time.Time  `json:"creationTimestamp"`
+	} `json:"metadata"`
+	Status struct {
+		ObservedGeneration *generation `json:"observedGeneration"`
+		Conditions         []struct {
+			Type               string    `json:"type"`
+			Status             string    `json:"status"`
+			LastTransitionTime time.Time `json:"lastTransitionTime"`
+			Message            string    `json:"message"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+func (o statusObject) String() string {
+	return o.Kind + " " + o.Metadata.Namespace + "/" + o.Metadata.Name
+}
+
+// acknowledged reports whether condition of o is true for its current generation, and returns the
+// time it became true and its message. An empty condition acknowledges every object.
+func (o statusObject) acknowledged(condition string) (bool, time.Time, string) {
+	if condition == "" {
+		return true, time.Time{}, ""
+	}
+	if g := o.Status.ObservedGeneration; g != nil && *g != o.Metadata.Generation {
+		return false, time.Time{}, fmt.Sprintf("observed generation %d of %d", *g, o.Metadata.Generation)
+	}
+	for _, c := range o.Status.Conditions {
+		if c.Type == condition {
+			return c.Status == "True", c.LastTransitionTime, c.Message
+		}
+	}
+	return false, time.Time{}, ""
+}
+
+// getStatusObjects returns the objects of resources in the cluster by String.
+func getStatusObjects(ctx context.Context, resources []string) (map[string]statusObject, error) {
+	out, err := kubectl(ctx, nil, "get", "--all-namespaces", "-o", "json", strings.Join(resources, ","))
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Items []statusObject `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, err
+	}
+	objects := make(map[string]statusObject, len(list.Items))
+	for _, o := range list.Items {
+		objects[o.String()] = o
+	}
+	return objects, nil
+}
+
+// watchStatus polls the status of policies until condition acknowledges all of them or timeout
+// expires. The latency of a policy is measured from its creation to the transition of its
+// condition, or to the poll observing it when the condition has no transition time.
+func watchStatus(ctx context.Context, policies []policyObject, condition string, interval, timeout time.Duration) (*StatusResult, error) {
+	kinds := map[string]bool{}
+	for _, p := range policies {
+		kinds[securityResources[p.Kind]] = true
+	}
+	var resources []string
+	for r := range kinds {
+		resources = append(resources, r)
+	}
+	sort.Strings(resources)
+
+	acknowledged := map[string]PolicyStatus{}
+	deadline := time.Now().Add(timeout)
+	for {
+		objects, err := getStatusObjects(ctx, resources)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		result := &StatusResult{Condition: condition, Policies: len(policies)}
+		var latencies []time.Duration
+		for _, p := range policies {
+			s, ok := acknowledged[p.String()]
+			if !ok {
+				s = PolicyStatus{Policy: p.String(), Message: "not found"}
+				if o, found := objects[p.String()]; found {
+					var at time.Time
+					s.Acknowledged, at, s.Message = o.acknowledged(condition)
+					if s.Acknowledged {
+						if at.IsZero() {
+							at = now
+						}
+						s.LatencySeconds = at.Sub(o.Metadata.CreationTimestamp).Seconds()
+						acknowledged[p.String()] = s
+					}
+				}
+			}
+			if s.Acknowledged {
+				result.Acknowledged++
+				latencies = append(latencies, time.Duration(s.LatencySeconds*float64(time.Second)))
+			}
+			result.Statuses = append(result.Statuses, s)
+		}
+		result.Latency = summarizeLatencies(latencies)
+		if result.Acknowledged == result.Policies || now.After(deadline) {
+			return result, nil
+		}
+		log.Printf("%d of %d policies acknowledged", result.Acknowledged, result.Policies)
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return result, ctx.Err()
+		}
+	}
+}
+
+func runStatus(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the applied policies")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	policyFile := fs.String("policyFile", "", "A YAML file of the applied policies instead of the generated ones")
+	condition := fs.String("condition", "Reconciled", "The status condition acknowledging a policy, empty to only wait for the policies to exist")
+	interval := fs.Duration("interval", 2*time.Second, "The interval between two polls of the status")
+	timeout := fs.Duration("timeout", 5*time.Minute, "The maximum time waited for the policies to be acknowledged")
+	outDir := fs.String("outDir", "run", "The directory of the report.json the status is added to, created when missing")
+	_ = fs.Parse(args)
+
+	docs, err := loadPolicyDocuments(ctx, *scenarioName, *configFile, *policyFile)
+	if err != nil {
+		return err
+	}
+	objects, err := parsePolicyObjects(docs)
+	if err != nil {
+		return err
+	}
+	var policies []policyObject
+	for _, o := range objects {
+		if _, ok := securityResources[o.Kind]; ok {
+			policies = append(policies, o)
+		}
+	}
+	if len(policies) == 0 {
+		return fmt.Errorf("no security policies to watch")
+	}
+
+	// The status is added to the report of the apply run of the same directory.
+	reportFile := filepath.Join(*outDir, "report.json")
+	report, err := readRunReport(reportFile)
+	if os.IsNotExist(err) {
+		report, err = newRunReport("status", *configFile, fs), nil
+	}
+	if err != nil {
+		return err
+	}
+	result, err := watchStatus(ctx, policies, *condition, *interval, *timeout)
+	if err != nil && result == nil {
+		return err
+	}
+	report.Status = result
+	if ctx.Err() != nil {
+		report.Interrupted = true
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+	if err := writeRunReport(*outDir, report); err != nil {
+		return err
+	}
+	fmt.Printf("%d of %d policies acknowledged, latency p50 %.1fs p99 %.1fs max %.1fs\n", result.Acknowledged, result.Policies,
+		result.Latency.P50/1000, result.Latency.P99/1000, result.Latency.Max/1000)
+	if result.Acknowledged < result.Policies {
+		for _, s := range result.Statuses {
+			if !s.Acknowledged {
+				fmt.Printf("NOT ACKNOWLEDGED %s: %s\n", s.Policy, s.Message)
+			}
+		}
+		return fmt.Errorf("%d policies not acknowledged after %v", result.Policies-result.Acknowledged, *timeout)
+	}
+	return nil
+}
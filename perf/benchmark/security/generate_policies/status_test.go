@@ -0,0 +1,56 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestStatusAcknowledged(t *testing.T) {
+	cases := []struct {
+		name      string
+		object    string
+		condition string
+		want      bool
+		message   string
+	}{
+		{"reconciled", `{"metadata":{"generation":2},"status":{"observedGeneration":"2","conditions":[
+			{"type":"Reconciled","status":"True","lastTransitionTime":"2026-01-01T00:00:05Z","message":"3/3 proxies up to date."}]}}`,
+			"Reconciled", true, "3/3 proxies up to date."},
+		{"partially distributed", `{"metadata":{"generation":1},"status":{"conditions":[
+			{"type":"Reconciled","status":"False","message":"1/3 proxies up to date."}]}}`,
+			"Reconciled", false, "1/3 proxies up to date."},
+		{"stale generation", `{"metadata":{"generation":3},"status":{"observedGeneration":2,"conditions":[
+			{"type":"Reconciled","status":"True"}]}}`,
+			"Reconciled", false, "observed generation 2 of 3"},
+		{"no status", `{"metadata":{"generation":1}}`, "Reconciled", false, ""},
+		{"exists", `{"metadata":{"generation":1}}`, "", true, ""},
+	}
+	for _, c := range cases {
+		var o statusObject
+		if err := json.Unmarshal([]byte(c.object), &o); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		got, at, message := o.acknowledged(c.condition)
+		if got != c.want || message != c.message {
+			t.Errorf("%s: acknowledged() = %v, %q, want %v, %q", c.name, got, message, c.want, c.message)
+		}
+		if c.name == "reconciled" && !at.Equal(time.Date(2026, 1, 1, 0, 0, 5, 0, time.UTC)) {
+			t.Errorf("%s: acknowledged at %v", c.name, at)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"text/template"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+var topologyTemplate = template.Must(template.New("topology").Parse(`{{range .Namespaces}}apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{.}}
+  labels:
+    istio-injection: enabled
+---
+{{end}}{{range .ServiceAccounts}}apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+---
+{{end}}{{range .Workloads}}apiVersion: v1
+kind: Service
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+spec:
+  selector:
+    workload: {{.Name}}
+  ports:
+  - name: http
+    port: 8080
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+spec:
+  replicas: {{$.Replicas}}
+  selector:
+    matchLabels:
+      workload: {{.Name}}
+  template:
+    metadata:
+      labels:
+{{- range $k, $v := .Labels}}
+        {{$k}}: {{$v}}
+{{- end}}
+    spec:
+      serviceAccountName: {{.ServiceAccount}}
+      containers:
+      - name: app
+        image: {{$.Image}}
+        args: ["server"]
+        ports:
+        - containerPort: 8080
+---
+{{end}}`))
+
+type topology struct {
+	Image           string
+	Replicas        int
+	Namespaces      []string
+	ServiceAccounts []topologyServiceAccount
+	Workloads       []topologyWorkload
+}
+
+type topologyServiceAccount struct {
+	Name      string
+	Namespace string
+}
+
+type topologyWorkload struct {
+	Name           string
+	Namespace      string
+	ServiceAccount string
+	Labels         map[string]string
+}
+
+func runTopology(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("topology", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the generated policies")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	numNamespaces := fs.Int("namespaces", -1, "The number of source namespaces. Default: authZ.numNamespaces")
+	numWorkloads := fs.Int("workloads", 1, "The number of workloads per namespace")
+	replicas := fs.Int("replicas", 1, "The number of replicas per workload")
+	image := fs.String("image", "fortio/fortio:latest_release", "The image of the workloads, which must accept a server argument")
+	_ = fs.Parse(args)
+
+	policyData, err := loadSecurityPolicy(*scenarioName, *configFile)
+	if err != nil {
+		return err
+	}
+	if *numNamespaces < 0 {
+		*numNamespaces = policyData.AuthZ.NumNamespaces
+	}
+	if *numWorkloads <= 0 {
+		return fmt.Errorf("invalid number of workloads: %d", *numWorkloads)
+	}
+	t := buildTopology(policyData, *numNamespaces, *numWorkloads)
+	t.Image = *image
+	t.Replicas = *replicas
+
+	var out bytes.Buffer
+	if err := topologyTemplate.Execute(&out, t); err != nil {
+		return err
+	}
+	fmt.Print(out.String())
+	return nil
+}
+
+// buildTopology returns numWorkloads workloads in each of the policy namespace, the namespace of
+// the generated principals and numNamespaces of the generated source namespaces. Workloads of
+// the principal namespace run as the service accounts of the generated principals, and the first
+// workload of the policy namespace carries the labels of authZ.selector. The Services and the
+// Deployments select the pods by the workload label, which the selector labels do not override.
+func buildTopology(policyData generatepolicies.SecurityPolicy, numNamespaces, numWorkloads int) *topology {
+	policyNamespace := policyData.Namespace
+	if policyNamespace == "" {
+		policyNamespace = generatepolicies.DefaultNamespace
+	}
+	namespaceSet := map[string]bool{policyNamespace: true, generatepolicies.PrincipalNamespace: true}
+	for i := 0; i < numNamespaces; i++ {
+		namespaceSet[generatepolicies.NamespaceName(i)] = true
+	}
+	t := &topology{}
+	for ns := range namespaceSet {
+		t.Namespaces = append(t.Namespaces, ns)
+	}
+	sort.Strings(t.Namespaces)
+
+	for i := 0; i < policyData.AuthZ.NumPrincipals; i++ {
+		t.ServiceAccounts = append(t.ServiceAccounts, topologyServiceAccount{Name: generatepolicies.ServiceAccountName(i), Namespace: generatepolicies.PrincipalNamespace})
+	}
+	for _, ns := range t.Namespaces {
+		for j := 0; j < numWorkloads; j++ {
+			w := topologyWorkload{
+				Name:      fmt.Sprintf("workload-%d", j),
+				Namespace: ns,
+				Labels:    map[string]string{},
+			}
+			w.Labels["app"] = w.Name
+			w.ServiceAccount = w.Name
+			if ns == generatepolicies.PrincipalNamespace && j < policyData.AuthZ.NumPrincipals {
+				w.ServiceAccount = generatepolicies.ServiceAccountName(j)
+			} else {
+				t.ServiceAccounts = append(t.ServiceAccounts, topologyServiceAccount{Name: w.ServiceAccount, Namespace: ns})
+			}
+			if ns == policyNamespace && j == 0 {
+				for k, v := range policyData.AuthZ.Selector {
+					w.Labels[k] = v
+				}
+			}
+			w.Labels["workload"] = w.Name
+			t.Workloads = append(t.Workloads, w)
+		}
+	}
+	return t
+}
@@ -0,0 +1,91 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+func TestTopologySelectors(t *testing.T) {
+	policyData := generatepolicies.SecurityPolicy{}
+	policyData.AuthZ.Selector = map[string]string{"app": "fortioserver"}
+	policyData.AuthZ.NumPrincipals = 1
+	topo := buildTopology(policyData, 1, 2)
+	topo.Image = "fortio/fortio:latest_release"
+	topo.Replicas = 1
+	var out bytes.Buffer
+	if err := topologyTemplate.Execute(&out, topo); err != nil {
+		t.Fatal(err)
+	}
+
+	type resource struct {
+		Kind     string `json:"kind"`
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+		Spec struct {
+			Selector map[string]interface{} `json:"selector"`
+			Template struct {
+				Metadata struct {
+					Labels map[string]string `json:"labels"`
+				} `json:"metadata"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	podLabels := map[string]map[string]string{}
+	services := map[string]map[string]interface{}{}
+	for _, doc := range splitYAMLDocuments(out.String()) {
+		var r resource
+		if err := yaml.Unmarshal([]byte(doc), &r); err != nil {
+			t.Fatalf("%v:\n%s", err, doc)
+		}
+		key := r.Metadata.Namespace + "/" + r.Metadata.Name
+		switch r.Kind {
+		case "Deployment":
+			labels := r.Spec.Template.Metadata.Labels
+			matchLabels, _ := r.Spec.Selector["matchLabels"].(map[string]interface{})
+			if len(matchLabels) == 0 {
+				t.Errorf("%s has no matchLabels", key)
+			}
+			for k, v := range matchLabels {
+				if labels[k] != v {
+					t.Errorf("%s selects %s=%v, its pods are labeled %v", key, k, v, labels)
+				}
+			}
+			podLabels[key] = labels
+		case "Service":
+			services[key] = r.Spec.Selector
+		}
+	}
+	if len(services) != len(topo.Workloads) || len(podLabels) != len(topo.Workloads) {
+		t.Fatalf("got %d services and %d deployments for %d workloads", len(services), len(podLabels), len(topo.Workloads))
+	}
+	for key, selector := range services {
+		for k, v := range selector {
+			if podLabels[key][k] != v {
+				t.Errorf("service %s selects %s=%v, the pods of its deployment are labeled %v", key, k, v, podLabels[key])
+			}
+		}
+	}
+	if labels := podLabels[generatepolicies.DefaultNamespace+"/workload-0"]; labels["app"] != "fortioserver" {
+		t.Errorf("the first workload of the policy namespace is labeled %v, want the authZ selector", labels)
+	}
+}
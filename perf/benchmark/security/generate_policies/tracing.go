@@ -0,0 +1,247 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The tracer exports the spans of the phases of a run with OTLP over HTTP in the JSON encoding,
+// configured by the environment variables of the OpenTelemetry SDKs.
+const (
+	otlpEndpointEnv       = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	otlpTracesEndpointEnv = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	otlpServiceNameEnv    = "OTEL_SERVICE_NAME"
+)
+
+// maxPendingSpans and flushInterval bound the spans kept before they are exported, so that the
+// timeline of a run of hours is available while it runs.
+const (
+	maxPendingSpans = 100
+	flushInterval   = 10 * time.Second
+)
+
+// otlpSpan is a span of the OTLP JSON encoding, with hex encoded ids and times in nanoseconds
+// as strings.
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otlpStatus struct {
+	// Code 2 is STATUS_CODE_ERROR.
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// otlpValue returns the AnyValue of v.
+func otlpValue(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": v}
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case int:
+		return map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case float64:
+		return map[string]interface{}{"doubleValue": v}
+	default:
+		return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+}
+
+// tracer collects the spans of a run, all in the same trace, and exports them to endpoint.
+type tracer struct {
+	endpoint    string
+	serviceName string
+	traceID     string
+	client      *http.Client
+
+	mu        sync.Mutex
+	pending   []otlpSpan
+	lastFlush time.Time
+}
+
+// newTracerFromEnv returns the tracer configured by the environment, nil when no endpoint is set.
+func newTracerFromEnv() *tracer {
+	endpoint := os.Getenv(otlpTracesEndpointEnv)
+	if endpoint == "" {
+		if base := os.Getenv(otlpEndpointEnv); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return nil
+	}
+	serviceName := os.Getenv(otlpServiceNameEnv)
+	if serviceName == "" {
+		serviceName = "generate_policies"
+	}
+	return newTracer(endpoint, serviceName)
+}
+
+func newTracer(endpoint, serviceName string) *tracer {
+	return &tracer{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		traceID:     randomID(16),
+		client:      &http.Client{Timeout: 10 * time.Second},
+		lastFlush:   time.Now(),
+	}
+}
+
+func randomID(n int) string {
+	id := make([]byte, n)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// flush exports the pending spans. Export errors are logged, tracing never fails a run.
+func (t *tracer) flush() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	spans := t.pending
+	t.pending = nil
+	t.lastFlush = time.Now()
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+	request := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttribute{{Key: "service.name", Value: otlpValue(t.serviceName)}},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "generate_policies", "version": toolVersion()},
+				"spans": spans,
+			}},
+		}},
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		log.Printf("exporting %d spans: %v", len(spans), err)
+		return
+	}
+	resp, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("exporting %d spans: %v", len(spans), err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Printf("exporting %d spans to %s: %s", len(spans), t.endpoint, resp.Status)
+	}
+}
+
+type tracerKey struct{}
+
+type spanKey struct{}
+
+// withTracer returns a context whose spans are collected by t.
+func withTracer(ctx context.Context, t *tracer) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// span is a phase of a run. The methods of a nil span, returned when tracing is disabled, do
+// nothing.
+type span struct {
+	tracer *tracer
+	data   otlpSpan
+	start  time.Time
+}
+
+// startSpan starts a span, the child of the span of ctx, and returns a context with it.
+func startSpan(ctx context.Context, name string) (context.Context, *span) {
+	t, _ := ctx.Value(tracerKey{}).(*tracer)
+	if t == nil {
+		return ctx, nil
+	}
+	s := &span{tracer: t, start: time.Now(), data: otlpSpan{
+		TraceID: t.traceID,
+		SpanID:  randomID(8),
+		Name:    name,
+		// SPAN_KIND_INTERNAL.
+		Kind: 1,
+	}}
+	if parent, ok := ctx.Value(spanKey{}).(*span); ok {
+		s.data.ParentSpanID = parent.data.SpanID
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *span) setAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.data.Attributes = append(s.data.Attributes, otlpAttribute{Key: key, Value: otlpValue(value)})
+}
+
+// inSpan runs f in a span named name, failed when f returns an error.
+func inSpan(ctx context.Context, name string, f func(ctx context.Context) error) error {
+	ctx, s := startSpan(ctx, name)
+	err := f(ctx)
+	s.end(err)
+	return err
+}
+
+// end ends the span, failed when err is not nil.
+func (s *span) end(err error) {
+	if s == nil {
+		return
+	}
+	s.data.StartTimeUnixNano = strconv.FormatInt(s.start.UnixNano(), 10)
+	s.data.EndTimeUnixNano = strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err != nil {
+		s.data.Status = &otlpStatus{Code: 2, Message: err.Error()}
+	}
+	t := s.tracer
+	t.mu.Lock()
+	t.pending = append(t.pending, s.data)
+	flush := len(t.pending) >= maxPendingSpans || time.Since(t.lastFlush) >= flushInterval
+	t.mu.Unlock()
+	if flush {
+		t.flush()
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// setenv sets an environment variable for the duration of the test.
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+	old, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestTracer(t *testing.T) {
+	var spans []otlpSpan
+	var serviceName string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		var request struct {
+			ResourceSpans []struct {
+				Resource struct {
+					Attributes []otlpAttribute `json:"attributes"`
+				} `json:"resource"`
+				ScopeSpans []struct {
+					Spans []otlpSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+		}
+		for _, rs := range request.ResourceSpans {
+			serviceName, _ = rs.Resource.Attributes[0].Value["stringValue"].(string)
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	defer server.Close()
+
+	setenv(t, otlpEndpointEnv, server.URL+"/")
+	setenv(t, otlpServiceNameEnv, "bench-ci")
+	tracer := newTracerFromEnv()
+	ctx := withTracer(context.Background(), tracer)
+	err := inSpan(ctx, "apply", func(ctx context.Context) error {
+		_, batch := startSpan(ctx, "batch")
+		batch.setAttribute("policies", 100)
+		batch.end(errors.New("throttled"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer.flush()
+
+	if len(spans) != 2 || serviceName != "bench-ci" {
+		t.Fatalf("got %d spans of %q, want 2 of bench-ci", len(spans), serviceName)
+	}
+	batch, apply := spans[0], spans[1]
+	if batch.Name != "batch" || apply.Name != "apply" || batch.ParentSpanID != apply.SpanID || apply.ParentSpanID != "" {
+		t.Errorf("got spans %+v and %+v, want batch as a child of apply", batch, apply)
+	}
+	if batch.TraceID != apply.TraceID || len(batch.TraceID) != 32 || len(batch.SpanID) != 16 {
+		t.Errorf("got trace %s and span %s", batch.TraceID, batch.SpanID)
+	}
+	if batch.Status == nil || batch.Status.Code != 2 || batch.Status.Message != "throttled" || apply.Status != nil {
+		t.Errorf("got statuses %+v and %+v", batch.Status, apply.Status)
+	}
+	if len(batch.Attributes) != 1 || batch.Attributes[0].Value["intValue"] != "100" {
+		t.Errorf("got attributes %+v", batch.Attributes)
+	}
+}
+
+func TestTracingDisabled(t *testing.T) {
+	setenv(t, otlpEndpointEnv, "")
+	setenv(t, otlpTracesEndpointEnv, "")
+	tracer := newTracerFromEnv()
+	if tracer != nil {
+		t.Fatalf("got a tracer without an endpoint")
+	}
+	ctx, s := startSpan(withTracer(context.Background(), tracer), "apply")
+	if s != nil || ctx.Value(spanKey{}) != nil {
+		t.Errorf("got a span without a tracer")
+	}
+	s.setAttribute("policies", 1)
+	s.end(nil)
+	tracer.flush()
+}
@@ -0,0 +1,491 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	authzpb "istio.io/api/security/v1beta1"
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+const (
+	expectAllow = "allow"
+	expectDeny  = "deny"
+	// expectRejected is a request rejected by the proxy before authorization, e.g. with 400 or
+	// 431.
+	expectRejected = "rejected"
+)
+
+var headerKeyRegexp = regexp.MustCompile(`^request\.headers\[(.+)\]$`)
+var claimKeyRegexp = regexp.MustCompile(`^request\.auth\.claims\[(.+)\]$`)
+
+// TrafficProfile describes the load to send while a generated corpus is applied.
+type TrafficProfile struct {
+	Scenario string `json:"scenario,omitempty"`
+	// DenyRate is the share of the requests expected to be denied.
+	DenyRate float64 `json:"denyRate,omitempty"`
+	// External reports that the requests model traffic from outside the mesh, to be sent to the
+	// ingress gateway rather than from a client in the mesh.
+	External bool             `json:"external,omitempty"`
+	Requests []TrafficRequest `json:"requests"`
+}
+
+// TrafficRequest is one kind of request of a TrafficProfile.
+type TrafficRequest struct {
+	Method string `json:"method,omitempty"`
+	// Host overrides the host of the url of the load.
+	Host    string            `json:"host,omitempty"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// HeaderValues are sent verbatim: their names are not canonicalized and every value is sent
+	// as a header line of its own.
+	HeaderValues map[string][]string `json:"headerValues,omitempty"`
+	// Expect is the decision the generated policies are expected to take, allow or deny, or
+	// rejected.
+	Expect string `json:"expect,omitempty"`
+}
+
+// tokenTraffic sends every request with the token that the generated RequestAuthentications
+// accept.
+func tokenTraffic(policyData generatepolicies.SecurityPolicy) (*TrafficProfile, error) {
+	privateKey, err := generatepolicies.SigningKey(policyData.RequestAuthN.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	token, err := generatepolicies.GenerateToken(policyData, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &TrafficProfile{
+		Requests: []TrafficRequest{{
+			Method:  "GET",
+			Path:    "/",
+			Headers: map[string]string{"Authorization": "Bearer " + token},
+		}},
+	}, nil
+}
+
+func writeTrafficProfile(profile *TrafficProfile, trafficFile string) error {
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(trafficFile, data, 0644)
+}
+
+// pathMatrixTraffic sends one request per route of the path x method matrix.
+func pathMatrixTraffic(policyData generatepolicies.SecurityPolicy) (*TrafficProfile, error) {
+	profile := &TrafficProfile{}
+	for _, path := range generatepolicies.PathMatrixPaths(policyData.AuthZ.NumPaths) {
+		for _, method := range generatepolicies.PathMatrixMethods(policyData.AuthZ.NumMethods) {
+			profile.Requests = append(profile.Requests, TrafficRequest{Method: method, Path: path})
+		}
+	}
+	return profile, nil
+}
+
+// ingressTraffic sends one request per route of the host x path x method matrix from outside the
+// mesh.
+func ingressTraffic(policyData generatepolicies.SecurityPolicy) (*TrafficProfile, error) {
+	profile := &TrafficProfile{External: true}
+	for _, host := range generatepolicies.PathMatrixHosts(policyData.AuthZ.NumHosts) {
+		for _, path := range generatepolicies.PathMatrixPaths(policyData.AuthZ.NumPaths) {
+			for _, method := range generatepolicies.PathMatrixMethods(policyData.AuthZ.NumMethods) {
+				profile.Requests = append(profile.Requests, TrafficRequest{Method: method, Host: host, Path: path})
+			}
+		}
+	}
+	return profile, nil
+}
+
+// sampleTraffic returns numRequests requests built from the values of the generated
+// AuthorizationPolicy rules, of which a share of denyRate is expected to be denied. Rules on
+// source IPs, namespaces and principals cannot be controlled by the load generator and are not
+// sampled.
+func sampleTraffic(policyData generatepolicies.SecurityPolicy, numRequests int, denyRate float64) (*TrafficProfile, error) {
+	if err := validateDenyRate(denyRate); err != nil {
+		return nil, err
+	}
+	allowed, denied, err := trafficCandidates(policyData)
+	if err != nil {
+		return nil, err
+	}
+	numDenied := int(math.Round(float64(numRequests) * denyRate))
+	profile := &TrafficProfile{DenyRate: denyRate}
+	if profile.Requests, err = pickRequests(allowed, numRequests-numDenied, expectAllow); err != nil {
+		return nil, err
+	}
+	deniedRequests, err := pickRequests(denied, numDenied, expectDeny)
+	if err != nil {
+		return nil, err
+	}
+	profile.Requests = append(profile.Requests, deniedRequests...)
+	return profile, nil
+}
+
+// mixDeniedTraffic adds requests expected to be denied to profile, so that they make up a share
+// of denyRate of its requests. The existing requests are expected to be allowed.
+func mixDeniedTraffic(profile *TrafficProfile, policyData generatepolicies.SecurityPolicy, denyRate float64) error {
+	if err := validateDenyRate(denyRate); err != nil {
+		return err
+	}
+	if denyRate == 0 {
+		return nil
+	}
+	if denyRate == 1 {
+		profile.Requests = nil
+	}
+	_, denied, err := trafficCandidates(policyData)
+	if err != nil {
+		return err
+	}
+	numAllowed := len(profile.Requests)
+	numDenied := 1
+	if numAllowed > 0 {
+		numDenied = int(math.Round(float64(numAllowed) * denyRate / (1 - denyRate)))
+	}
+	for i := range profile.Requests {
+		profile.Requests[i].Expect = expectAllow
+	}
+	deniedRequests, err := pickRequests(denied, numDenied, expectDeny)
+	if err != nil {
+		return err
+	}
+	profile.Requests = append(profile.Requests, deniedRequests...)
+	profile.DenyRate = denyRate
+	return nil
+}
+
+func validateDenyRate(denyRate float64) error {
+	if denyRate < 0 || denyRate > 1 {
+		return fmt.Errorf("invalid denyRate %v: must be between 0 and 1", denyRate)
+	}
+	return nil
+}
+
+// trafficCandidates returns requests the generated AuthorizationPolicies are expected to allow
+// and deny, as decided by the simulator.
+func trafficCandidates(policyData generatepolicies.SecurityPolicy) ([]TrafficRequest, []TrafficRequest, error) {
+	if policyData.AuthZ.NumPolicies <= 0 {
+		return nil, nil, fmt.Errorf("no AuthorizationPolicies to sample traffic from")
+	}
+	// Every generated AuthorizationPolicy has the same rules, sampling one of them is enough.
+	spec, err := generatepolicies.BuildAuthorizationPolicy(policyData)
+	if err != nil {
+		return nil, nil, err
+	}
+	matching, err := matchingRequests(policyData, spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	notMatching := []TrafficRequest{{Method: "GET", Path: "/not-matched"}}
+
+	var allowed, denied []TrafficRequest
+	switch spec.Action {
+	case authzpb.AuthorizationPolicy_ALLOW:
+		allowed, denied = matching, notMatching
+	case authzpb.AuthorizationPolicy_DENY:
+		allowed, denied = notMatching, matching
+	default:
+		return nil, nil, fmt.Errorf("cannot predict the decision of %v policies", spec.Action)
+	}
+	// Keep only the requests on which the simulator takes the expected decision.
+	policies := []parsedAuthorizationPolicy{{Spec: spec}}
+	w := workload{labels: spec.GetSelector().GetMatchLabels()}
+	decided := func(requests []TrafficRequest, allow bool) ([]TrafficRequest, error) {
+		var kept []TrafficRequest
+		for _, r := range requests {
+			request, err := requestAttributes(r)
+			if err != nil {
+				return nil, err
+			}
+			if evaluate(policies, w, "", request).Allowed == allow {
+				kept = append(kept, r)
+			}
+		}
+		return kept, nil
+	}
+	if allowed, err = decided(allowed, true); err != nil {
+		return nil, nil, err
+	}
+	if denied, err = decided(denied, false); err != nil {
+		return nil, nil, err
+	}
+	return allowed, denied, nil
+}
+
+// pickRequests returns n requests spread over candidates, labelled with expect.
+func pickRequests(candidates []TrafficRequest, n int, expect string) ([]TrafficRequest, error) {
+	if n > 0 && len(candidates) == 0 {
+		return nil, fmt.Errorf("the generated rules have no values to build %s requests from", expect)
+	}
+	requests := make([]TrafficRequest, 0, n)
+	for i := 0; i < n; i++ {
+		r := candidates[i*len(candidates)/n]
+		r.Expect = expect
+		requests = append(requests, r)
+	}
+	return requests, nil
+}
+
+// matchingRequests returns requests matching a rule of spec, one per sampled value. The fields
+// of a rule are ANDed, so every request of a rule satisfies all of its conditions together, e.g.
+// sends the header of a condition with a token carrying the claim of another. Rules on
+// attributes the load generator cannot control, such as connection.sni, are not sampled.
+func matchingRequests(policyData generatepolicies.SecurityPolicy, spec *authzpb.AuthorizationPolicy) ([]TrafficRequest, error) {
+	var requests []TrafficRequest
+	for _, rule := range spec.Rules {
+		ruleRequests, err := ruleRequests(policyData, rule)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, ruleRequests...)
+	}
+	return requests, nil
+}
+
+// ruleRequests returns requests matching rule, none when it cannot be satisfied.
+func ruleRequests(policyData generatepolicies.SecurityPolicy, rule *authzpb.Rule) ([]TrafficRequest, error) {
+	operations := []TrafficRequest{{Method: "GET", Path: "/"}}
+	if len(rule.To) > 0 {
+		operations = nil
+	}
+	for _, to := range rule.To {
+		paths := to.Operation.GetPaths()
+		if len(paths) == 0 {
+			paths = []string{"/"}
+		}
+		methods := to.Operation.GetMethods()
+		if len(methods) == 0 {
+			methods = []string{"GET"}
+		}
+		hosts := to.Operation.GetHosts()
+		if len(hosts) == 0 {
+			hosts = []string{""}
+		}
+		for _, host := range hosts {
+			for _, path := range paths {
+				for _, method := range methods {
+					operations = append(operations, TrafficRequest{
+						Method: method, Host: strings.TrimPrefix(host, "*"), Path: strings.TrimSuffix(path, "*"),
+					})
+				}
+			}
+		}
+	}
+
+	// principals are the issuer and subject of the token of every source, nil without sources.
+	principals := [][]string{nil}
+	if len(rule.From) > 0 {
+		principals = nil
+	}
+	for _, from := range rule.From {
+		for _, principal := range from.Source.GetRequestPrincipals() {
+			parts := strings.SplitN(principal, "/", 2)
+			// Only issuers of the generated RequestAuthentications can be authenticated.
+			if len(parts) == 2 && isGeneratedIssuer(policyData, parts[0]) {
+				principals = append(principals, parts)
+			}
+		}
+	}
+
+	var headers, claims []*authzpb.Condition
+	for _, when := range rule.When {
+		if len(when.Values) == 0 {
+			continue
+		}
+		if headerKeyRegexp.MatchString(when.Key) {
+			headers = append(headers, when)
+		} else if claimKeyRegexp.MatchString(when.Key) && policyData.RequestAuthN.NumPolicies > 0 {
+			claims = append(claims, when)
+		} else {
+			return nil, nil
+		}
+	}
+
+	n := len(operations) * len(principals)
+	for _, when := range append(headers, claims...) {
+		if len(when.Values) > n {
+			n = len(when.Values)
+		}
+	}
+	requests := make([]TrafficRequest, 0, n)
+	for i := 0; i < n; i++ {
+		r := operations[i%len(operations)]
+		r.Headers = map[string]string{}
+		for _, when := range headers {
+			r.Headers[headerKeyRegexp.FindStringSubmatch(when.Key)[1]] = when.Values[i%len(when.Values)]
+		}
+		principal := principals[i/len(operations)%len(principals)]
+		if principal != nil || len(claims) > 0 {
+			tokenClaims := generatepolicies.TokenClaims(policyData)
+			if principal != nil {
+				tokenClaims["iss"], tokenClaims["sub"] = principal[0], principal[1]
+			}
+			for _, when := range claims {
+				path := strings.Split(claimKeyRegexp.FindStringSubmatch(when.Key)[1], "][")
+				setNestedClaim(tokenClaims, path, []string{when.Values[i%len(when.Values)]})
+			}
+			privateKey, err := generatepolicies.SigningKey(policyData.RequestAuthN.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+			token, err := generatepolicies.SignToken(tokenClaims, privateKey)
+			if err != nil {
+				return nil, err
+			}
+			r.Headers["Authorization"] = "Bearer " + token
+		}
+		if len(r.Headers) == 0 {
+			r.Headers = nil
+		}
+		requests = append(requests, r)
+	}
+	return requests, nil
+}
+
+// setNestedClaim sets the claim at path, a claim name per nested object, to value.
+func setNestedClaim(claims map[string]interface{}, path []string, value interface{}) {
+	for _, name := range path[:len(path)-1] {
+		object, ok := claims[name].(map[string]interface{})
+		if !ok {
+			object = map[string]interface{}{}
+			claims[name] = object
+		}
+		claims = object
+	}
+	claims[path[len(path)-1]] = value
+}
+
+func isGeneratedIssuer(policyData generatepolicies.SecurityPolicy, issuer string) bool {
+	if policyData.RequestAuthN.NumPolicies <= 0 {
+		return false
+	}
+	for i := 1; i <= policyData.RequestAuthN.NumJwks; i++ {
+		if issuer == fmt.Sprintf("issuer-%d", i) {
+			return true
+		}
+	}
+	return false
+}
+
+// fortioJob returns a Kubernetes Job running one fortio load container per request of profile,
+// splitting qps and connections evenly between them.
+func fortioJob(profile *TrafficProfile, namespace, image, url string, qps float64, conns int, duration time.Duration) ([]byte, error) {
+	if len(profile.Requests) == 0 {
+		return nil, fmt.Errorf("the traffic profile has no requests")
+	}
+	n := len(profile.Requests)
+	containerConns := conns / n
+	if containerConns < 1 {
+		containerConns = 1
+	}
+	var containers []interface{}
+	for i, r := range profile.Requests {
+		args := []string{
+			"load",
+			"-qps", fmt.Sprintf("%g", qps/float64(n)),
+			"-c", fmt.Sprint(containerConns),
+			"-t", duration.String(),
+			"-X", r.Method,
+			"-labels", fmt.Sprintf("request-%d-%s", i, r.Expect),
+		}
+		names := make([]string, 0, len(r.Headers))
+		for name := range r.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			args = append(args, "-H", fmt.Sprintf("%s: %s", name, r.Headers[name]))
+		}
+		if r.Host != "" {
+			args = append(args, "-H", "Host: "+r.Host)
+		}
+		args = append(args, url+r.Path)
+		containers = append(containers, map[string]interface{}{
+			"name":  fmt.Sprintf("request-%d", i),
+			"image": image,
+			"args":  args,
+		})
+	}
+	job := map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata":   generatepolicies.MetadataStruct{Name: "authz-traffic", Namespace: namespace},
+		"spec": map[string]interface{}{
+			"backoffLimit": 0,
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"restartPolicy": "Never",
+					"containers":    containers,
+				},
+			},
+		},
+	}
+	return yaml.Marshal(job)
+}
+
+func runTraffic(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("traffic", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the generated policies")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	numRequests := fs.Int("requests", 10, "The number of distinct requests to sample from the rules")
+	denyRate := fs.Float64("denyRate", 0, "The share of the sampled requests expected to be denied, between 0 and 1")
+	format := fs.String("format", "json", "The output format: json for a traffic profile, fortio for a Kubernetes Job running fortio")
+	namespace := fs.String("namespace", "twopods-istio", "The namespace of the fortio Job")
+	image := fs.String("image", "fortio/fortio:latest_release", "The image of the fortio Job")
+	url := fs.String("url", "http://fortioserver:8080", "The base URL of the fortio Job requests")
+	qps := fs.Float64("qps", 1000, "The total requests per second of the fortio Job")
+	conns := fs.Int("conns", 64, "The total number of connections of the fortio Job")
+	duration := fs.Duration("duration", 240*time.Second, "The duration of the fortio Job load")
+	_ = fs.Parse(args)
+
+	policyData, err := loadSecurityPolicy(*scenarioName, *configFile)
+	if err != nil {
+		return err
+	}
+	profile, err := sampleTraffic(policyData, *numRequests, *denyRate)
+	if err != nil {
+		return err
+	}
+	profile.Scenario = *scenarioName
+
+	var out []byte
+	switch *format {
+	case "json":
+		out, err = json.MarshalIndent(profile, "", "  ")
+	case "fortio":
+		out, err = fortioJob(profile, *namespace, *image, *url, *qps, *conns, *duration)
+	default:
+		return fmt.Errorf("unknown format %q, must be json or fortio", *format)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(strings.TrimSpace(string(out)))
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"istio.io/tools/perf/benchmark/security/generate_policies/generatepolicies"
+)
+
+func TestFortioJobHeaderOrder(t *testing.T) {
+	profile := &TrafficProfile{Requests: []TrafficRequest{{
+		Method:  "GET",
+		Path:    "/",
+		Headers: map[string]string{"x-c": "3", "x-a": "1", "x-d": "4", "x-b": "2"},
+		Expect:  expectAllow,
+	}}}
+	var first string
+	for i := 0; i < 10; i++ {
+		job, err := fortioJob(profile, "twopods-istio", "fortio/fortio", "http://fortioserver:8080", 100, 8, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			first = string(job)
+			if a, d := strings.Index(first, "x-a: 1"), strings.Index(first, "x-d: 4"); a < 0 || d < a {
+				t.Fatalf("headers are not sorted:\n%s", first)
+			}
+			continue
+		}
+		if string(job) != first {
+			t.Fatalf("run %d generated a different Job", i)
+		}
+	}
+}
+
+func TestIngressTraffic(t *testing.T) {
+	policyData, err := loadSecurityPolicy("ingress-edge", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, err := ingressTraffic(policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authZ := policyData.AuthZ
+	if want := authZ.NumHosts * authZ.NumPaths * authZ.NumMethods; len(profile.Requests) != want || !profile.External {
+		t.Fatalf("got %d requests, external %v, want %d external requests", len(profile.Requests), profile.External, want)
+	}
+	// The sampled requests of the policies must be the routes of the profile.
+	allowed, _, err := trafficCandidates(policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes := map[string]bool{}
+	for _, r := range profile.Requests {
+		routes[r.Method+" "+r.Host+r.Path] = true
+	}
+	for _, r := range allowed {
+		if !routes[r.Method+" "+r.Host+r.Path] {
+			t.Errorf("allowed request %+v is not a route of the traffic profile", r)
+		}
+	}
+
+	job, err := fortioJob(profile, "istio-system", "fortio/fortio", "http://istio-ingressgateway", 100, 8, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(job), "Host: route-9.example.com") {
+		t.Errorf("the Job does not set the host of the requests")
+	}
+}
+
+func TestNestedClaims(t *testing.T) {
+	inTempDir(t)
+	policyData, err := loadSecurityPolicy("deep-claims", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policyData.AuthZ.NumPolicies = 1
+	policyData.AuthZ.ClaimNesting = &generatepolicies.ClaimNesting{Depth: 3, FanOut: 2}
+	docs, err := generatePolicies(context.Background(), policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policies, err := parseAuthorizationPolicies(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := workload{namespace: policies[0].Namespace}
+	decide := func(claims map[string]interface{}) decision {
+		request := simulatedRequest{}
+		setClaims(request, "", claims)
+		return evaluate(policies, w, "", request)
+	}
+
+	if d := decide(generatepolicies.TokenClaims(policyData)); !d.Allowed {
+		t.Errorf("the generated token is denied: %v", d)
+	}
+	claims := generatepolicies.TokenClaims(policyData)
+	setNestedClaim(claims, []string{"level-1", "level-2", "level-3", "claim-1"}, "other")
+	if d := decide(claims); d.Allowed {
+		t.Errorf("a token with another deepest claim is allowed: %v", d)
+	}
+}
+
+func TestConditionTraffic(t *testing.T) {
+	inTempDir(t)
+	policyData := generatepolicies.SecurityPolicy{
+		AuthZ:        generatepolicies.AuthorizationPolicy{Action: "ALLOW", NumPolicies: 1, NumValues: 2, NumClaims: 3},
+		RequestAuthN: generatepolicies.RequestAuthentication{NumPolicies: 1, NumJwks: 1},
+	}
+	allowed, denied, err := trafficCandidates(policyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The header and the claim conditions of the rule are ANDed, so every request has both.
+	if len(allowed) != 3 {
+		t.Fatalf("got %d allowed requests, want one per claim value", len(allowed))
+	}
+	for _, r := range allowed {
+		if r.Headers["x-token"] == "" || !strings.HasPrefix(r.Headers["Authorization"], "Bearer ") {
+			t.Errorf("allowed request %+v does not send both the header and the token", r)
+		}
+	}
+	if len(denied) != 1 {
+		t.Errorf("got %d denied requests, want 1", len(denied))
+	}
+
+	// The load generator cannot set the SNI, which is ANDed with the other conditions.
+	policyData.AuthZ.NumSNIs = 1
+	if allowed, _, err = trafficCandidates(policyData); err != nil || len(allowed) != 0 {
+		t.Errorf("got allowed requests %+v, error %v, want none", allowed, err)
+	}
+	if _, err := sampleTraffic(policyData, 10, 0); err == nil {
+		t.Error("sampled allowed requests of a rule on the SNI")
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// visualizeTopNamespaces is the number of namespaces charted, the others are summed.
+const visualizeTopNamespaces = 20
+
+// ruleCountBuckets are the upper bounds of the buckets of the rule counts chart.
+var ruleCountBuckets = []int{0, 1, 5, 10, 50, 100}
+
+// visualizePolicy is a row of the table of the policies of a corpus.
+type visualizePolicy struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Action    string
+	Selector  string
+	Rules     int
+	Bytes     int
+}
+
+// visualizeCorpus is a corpus together with the charts rendered for it.
+type visualizeCorpus struct {
+	Name     string
+	Stats    *GenerationStats
+	Charts   []reportChart
+	Policies []visualizePolicy
+}
+
+// newVisualizeCorpus returns the policies and the charts of the rule counts, field usage,
+// namespaces and kinds of docs.
+func newVisualizeCorpus(name string, docs []string) (*visualizeCorpus, error) {
+	stats, err := generationStats(docs)
+	if err != nil {
+		return nil, err
+	}
+	c := &visualizeCorpus{Name: name, Stats: stats}
+	buckets := make([]float64, len(ruleCountBuckets)+1)
+	namespaces := map[string]int{}
+	for _, doc := range docs {
+		objects, err := parsePolicyObjects([]string{doc})
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range objects {
+			p := visualizePolicy{Kind: o.Kind, Namespace: o.Namespace, Name: o.Name, Bytes: len(doc)}
+			if selector, ok := o.Spec["selector"].(map[string]interface{}); ok {
+				if labels, ok := selector["matchLabels"].(map[string]interface{}); ok {
+					var matches []string
+					for k, v := range labels {
+						matches = append(matches, fmt.Sprintf("%s=%v", k, v))
+					}
+					sort.Strings(matches)
+					p.Selector = strings.Join(matches, ",")
+				}
+			}
+			if o.Kind == "AuthorizationPolicy" {
+				p.Action = "ALLOW"
+				if action, ok := o.Spec["action"].(string); ok {
+					p.Action = action
+				}
+				p.Rules = countValues(o.Spec["rules"])
+				i := sort.SearchInts(ruleCountBuckets, p.Rules)
+				buckets[i]++
+			}
+			namespaces[o.Namespace]++
+			c.Policies = append(c.Policies, p)
+		}
+	}
+
+	rules := reportChart{Title: "AuthorizationPolicies by number of rules", Unit: "policies", Counts: true, Values: buckets}
+	low := 0
+	for _, high := range ruleCountBuckets {
+		if high == low {
+			rules.Labels = append(rules.Labels, fmt.Sprint(high))
+		} else {
+			rules.Labels = append(rules.Labels, fmt.Sprintf("%d-%d", low, high))
+		}
+		low = high + 1
+	}
+	rules.Labels = append(rules.Labels, fmt.Sprintf("more than %d", ruleCountBuckets[len(ruleCountBuckets)-1]))
+	c.Charts = append(c.Charts, rules)
+
+	fields := reportChart{Title: "Values per field", Unit: "values", Counts: true}
+	for _, field := range sortedCounts(stats.Values) {
+		fields.Labels = append(fields.Labels, field)
+		fields.Values = append(fields.Values, float64(stats.Values[field]))
+	}
+	c.Charts = append(c.Charts, fields)
+
+	byNamespace := reportChart{Title: "Resources per namespace", Unit: "resources", Counts: true}
+	sorted := sortedCounts(namespaces)
+	for i, ns := range sorted {
+		if i == visualizeTopNamespaces {
+			other := 0
+			for _, ns := range sorted[i:] {
+				other += namespaces[ns]
+			}
+			byNamespace.Labels = append(byNamespace.Labels, fmt.Sprintf("%d other namespaces", len(sorted)-i))
+			byNamespace.Values = append(byNamespace.Values, float64(other))
+			break
+		}
+		byNamespace.Labels = append(byNamespace.Labels, ns)
+		byNamespace.Values = append(byNamespace.Values, float64(namespaces[ns]))
+	}
+	c.Charts = append(c.Charts, byNamespace)
+
+	kinds := reportChart{Title: "Resources per kind", Unit: "resources", Counts: true}
+	for _, kind := range sortedCounts(stats.ResourcesByKind) {
+		kinds.Labels = append(kinds.Labels, kind)
+		kinds.Values = append(kinds.Values, float64(stats.ResourcesByKind[kind]))
+	}
+	c.Charts = append(c.Charts, kinds)
+	return c, nil
+}
+
+// sortedCounts returns the keys of counts by decreasing count, then in order.
+func sortedCounts(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// manifestCorpora returns the corpora listed by the manifest.json of publish-corpus, read from
+// the directory of the manifest.
+func manifestCorpora(file string) ([]*visualizeCorpus, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &CorpusManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	var corpora []*visualizeCorpus
+	for _, summary := range manifest.Corpora {
+		data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(file), summary.File))
+		if err != nil {
+			return nil, err
+		}
+		c, err := newVisualizeCorpus(fmt.Sprintf("%s (%s)", summary.Name, manifest.Version), splitYAMLDocuments(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", summary.File, err)
+		}
+		corpora = append(corpora, c)
+	}
+	return corpora, nil
+}
+
+var visualizeTemplate = htmltemplate.Must(htmltemplate.New("visualize").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Security policy corpus</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+</style>
+</head>
+<body>
+<h1>Security policy corpus</h1>
+{{range $i, $c := .}}
+<h2>{{.Name}}</h2>
+{{with .Stats}}<p>{{.Resources}} resources, {{.Rules}} rules, {{.Bytes}} bytes{{with .Largest}}, the largest is {{.Policy}} with {{.Bytes}} bytes and {{.Rules}} rules{{end}}.</p>{{end}}
+{{range .Charts}}<h3>{{.Title}}</h3>
+{{.SVG}}
+{{end}}
+<h3>Policies</h3>
+<p><input type="search" placeholder="Search" oninput="search(this.value, 'policies-{{$i}}')"></p>
+<table id="policies-{{$i}}">
+<tr><th>Kind</th><th>Namespace</th><th>Name</th><th>Action</th><th>Selector</th><th>Rules</th><th>Bytes</th></tr>
+{{range .Policies}}<tr><td>{{.Kind}}</td><td>{{.Namespace}}</td><td>{{.Name}}</td><td>{{.Action}}</td><td>{{.Selector}}</td><td>{{.Rules}}</td><td>{{.Bytes}}</td></tr>
+{{end}}</table>
+{{end}}
+<script>
+function search(query, id) {
+  query = query.toLowerCase();
+  var rows = document.getElementById(id).rows;
+  for (var i = 1; i < rows.length; i++) {
+    rows[i].style.display = rows[i].textContent.toLowerCase().indexOf(query) < 0 ? "none" : "";
+  }
+}
+</script>
+</body>
+</html>
+`))
+
+func runVisualize(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("visualize", flag.ExitOnError)
+	configFile := fs.String("configFile", "", "The config json file of the generated policies")
+	scenarioName := fs.String("scenario", "", "The name of a preset scenario, overlaid by the fields set in configFile")
+	policyFile := fs.String("policyFile", "", "A YAML file of policies to visualize instead of the generated ones")
+	manifest := fs.String("manifest", "", "The manifest.json of publish-corpus, its corpora are visualized instead of the generated policies")
+	out := fs.String("out", "", "The file the HTML page is written to. Default: stdout")
+	_ = fs.Parse(args)
+
+	var corpora []*visualizeCorpus
+	if *manifest != "" {
+		var err error
+		if corpora, err = manifestCorpora(*manifest); err != nil {
+			return err
+		}
+	} else {
+		docs, err := loadPolicyDocuments(ctx, *scenarioName, *configFile, *policyFile)
+		if err != nil {
+			return err
+		}
+		name := *policyFile
+		switch {
+		case name != "":
+		case *scenarioName != "" && *configFile != "":
+			name = *scenarioName + " with " + *configFile
+		case *scenarioName != "":
+			name = *scenarioName
+		default:
+			name = *configFile
+		}
+		c, err := newVisualizeCorpus(name, docs)
+		if err != nil {
+			return err
+		}
+		corpora = append(corpora, c)
+	}
+
+	var buf bytes.Buffer
+	if err := visualizeTemplate.Execute(&buf, corpora); err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	return ioutil.WriteFile(*out, buf.Bytes(), 0644)
+}
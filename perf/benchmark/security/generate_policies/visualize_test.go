@@ -0,0 +1,96 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVisualizeCorpus(t *testing.T) {
+	docs := splitYAMLDocuments(`
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: deny
+  namespace: a
+spec:
+  action: DENY
+  selector:
+    matchLabels:
+      version: v1
+      app: web
+  rules:
+  - to:
+    - operation:
+        paths: ["/a", "/b"]
+  - {}
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: allow-nothing
+  namespace: a
+spec: {}
+---
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: strict
+  namespace: b
+spec:
+  mtls:
+    mode: STRICT
+`)
+	c, err := newVisualizeCorpus("test", docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.Policies[0], (visualizePolicy{Kind: "AuthorizationPolicy", Namespace: "a", Name: "deny", Action: "DENY", Selector: "app=web,version=v1", Rules: 2, Bytes: len(docs[0])}); got != want {
+		t.Errorf("got policy %+v, want %+v", got, want)
+	}
+	if got := c.Policies[1].Action; got != "ALLOW" {
+		t.Errorf("got action %q for an empty spec, want ALLOW", got)
+	}
+	rules := c.Charts[0]
+	if want := []string{"0", "1", "2-5", "6-10", "11-50", "51-100", "more than 100"}; !reflect.DeepEqual(rules.Labels, want) {
+		t.Errorf("got rule count buckets %v, want %v", rules.Labels, want)
+	}
+	if want := []float64{1, 0, 1, 0, 0, 0, 0}; !reflect.DeepEqual(rules.Values, want) {
+		t.Errorf("got rule counts %v, want %v", rules.Values, want)
+	}
+	namespaces := c.Charts[2]
+	if want := []string{"a", "b"}; !reflect.DeepEqual(namespaces.Labels, want) {
+		t.Errorf("got namespaces %v, want %v", namespaces.Labels, want)
+	}
+
+	var b bytes.Buffer
+	if err := visualizeTemplate.Execute(&b, []*visualizeCorpus{c}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<h2>test</h2>",
+		"<p>3 resources, 2 rules,",
+		"<tr><td>AuthorizationPolicy</td><td>a</td><td>deny</td><td>DENY</td><td>app=web,version=v1</td><td>2</td>",
+		"<h3>Values per field</h3>",
+		">2 values</text>",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("the page does not contain %s", want)
+		}
+	}
+}
@@ -5,7 +5,7 @@ STABILITY = $(WD)/setup_test.sh
 stable_tests = http10 graceful-shutdown gateway-bouncer mysql redis rabbitmq looper
 
 # Tests that need no special setup
-standard_tests = http10 graceful-shutdown redis rabbitmq istio-chaos-total istio-chaos-partial multicluster-vpn looper
+standard_tests = http10 graceful-shutdown redis rabbitmq istio-chaos-total istio-chaos-partial multicluster-vpn looper security-policy-soak
 
 # Tests that have a special ./setup script in their folder
 extra_setup_tests = mysql sds-certmanager gateway-bouncer allconfig
@@ -19,7 +19,7 @@ $(extra_setup_tests):
 stability: $(stable_tests)
 
 # Extra tests that may be unstable or require additional configuration
-stability_all: stability sds-certmanager allconfig istio-chaos-total istio-chaos-partial multicluster-vpn
+stability_all: stability sds-certmanager allconfig istio-chaos-total istio-chaos-partial multicluster-vpn security-policy-soak
 
 clean-stability:
 	kubectl get namespaces -oname | grep "istio-stability-" | xargs kubectl delete